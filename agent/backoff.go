@@ -0,0 +1,62 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the delay between WebSocket reconnect attempts.
+//
+// WHY exponential backoff:
+// A hub that is down for maintenance or a laptop off the tailnet would
+// otherwise be retried every few seconds for hours - log spam on the agent
+// and wasted requests at the hub. Doubling the delay after each failure
+// keeps the first retries fast (a hub restart takes seconds) and the later
+// ones rare, up to reconnect_max_seconds.
+//
+// WHY jitter:
+// When the hub restarts, every agent loses its connection at the same
+// moment. Without jitter they would all retry in lockstep and hit the
+// freshly started hub together on every round.
+
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// reconnectBaseDelay is the delay before the first reconnect attempt.
+const reconnectBaseDelay = time.Second
+
+// stableConnection is how long a connection must last for the backoff to
+// start over.
+// WHY not reset on every successful connect: A hub that accepts the
+// connection and drops it at once (e.g., refusing the device) would
+// otherwise be retried at full speed forever.
+const stableConnection = 30 * time.Second
+
+// reconnectBackoff computes delays between reconnect attempts.
+type reconnectBackoff struct {
+	max      time.Duration
+	failures int
+}
+
+// newReconnectBackoff creates a backoff whose delays never exceed max.
+func newReconnectBackoff(max time.Duration) *reconnectBackoff {
+	return &reconnectBackoff{max: max}
+}
+
+// next returns the delay before the next attempt and counts a failure.
+// WHY "equal jitter" (half fixed, half random): Agents still spread out,
+// but none retries almost immediately after a failure, as full jitter
+// would allow.
+func (b *reconnectBackoff) next() time.Duration {
+	delay := reconnectBaseDelay
+	for i := 0; i < b.failures && delay < b.max; i++ {
+		delay *= 2
+	}
+	delay = min(delay, b.max)
+	b.failures++
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// reset starts over from reconnectBaseDelay.
+func (b *reconnectBackoff) reset() {
+	b.failures = 0
+}
@@ -0,0 +1,214 @@
+// Author: Toluwalase Mebaanne
+// Package main provides catch-up from hub history after time offline.
+//
+// WHY catch up when the hub keeps sessions:
+// A resumed WebSocket session replays what was missed, but sessions live in
+// the hub's memory and in the running agent's. After an agent restart, a hub
+// restart, or more missed clips than the hub keeps, the agent would start
+// with whatever its clipboard held, while every other device has moved on.
+//
+// WHY only the newest clip:
+// Writing every missed clip to the clipboard in a row would leave only the
+// last one there anyway, and fire a notification for each. The newest clip
+// is what the other devices hold now.
+//
+// WHY remember the last seen event on disk:
+// "Since when" is the question catch-up has to answer after a restart. The
+// file holds an event ID and a time, never content.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// lastSeenFileName is the catch-up state file created next to the agent
+// config.
+const lastSeenFileName = "last-seen.json"
+
+// catchUpPageSize and catchUpMaxPages bound how much history catch-up reads.
+// WHY a bound: Only the newest clip is applied; after a long absence the
+// rest is in `agent search`, not worth paging through on every connect.
+const (
+	catchUpPageSize = 100
+	catchUpMaxPages = 10
+)
+
+// lastSeen is the newest event this agent knows the hub has.
+type lastSeen struct {
+	EventID string    `json:"event_id"`
+	Time    time.Time `json:"time"`
+}
+
+// catchUpState tracks lastSeen and persists it.
+// WHY a mutex: Pushes update it from the main loop, received events from
+// the WebSocket goroutine.
+type catchUpState struct {
+	mu   sync.Mutex
+	path string
+	seen lastSeen
+}
+
+// lastSeenPath returns the catch-up state location for an agent config path.
+func lastSeenPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), lastSeenFileName)
+}
+
+// CatchUpFrom enables catch-up from hub history, keeping the last seen
+// event in the file at path.
+// WHY start empty on an unreadable file: It only costs one catch-up; the
+// next event seen rewrites it.
+func (s *Syncer) CatchUpFrom(path string) {
+	state := &catchUpState{path: path}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &state.seen); err != nil {
+			syncLog.Warnf("ignoring unreadable %s: %v", path, err)
+		}
+	}
+	s.catchUp = state
+}
+
+// markSeen records event as the newest event the hub has.
+func (s *Syncer) markSeen(event *models.Event) {
+	if s.catchUp == nil || event.EventID == "" {
+		return
+	}
+	s.catchUp.mu.Lock()
+	defer s.catchUp.mu.Unlock()
+	s.catchUp.seen = lastSeen{EventID: event.EventID, Time: event.Timestamp}
+	if err := s.catchUp.save(); err != nil {
+		syncLog.Warnf("failed to save catch-up state: %v", err)
+	}
+}
+
+// save writes the state with write-then-rename. Caller must hold mu.
+func (c *catchUpState) save() error {
+	data, err := json.Marshal(c.seen)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// lastSeenEvent returns the newest event recorded by markSeen.
+func (s *Syncer) lastSeenEvent() lastSeen {
+	s.catchUp.mu.Lock()
+	defer s.catchUp.mu.Unlock()
+	return s.catchUp.seen
+}
+
+// catchUpCandidate reports whether event is one this device would have been
+// sent, or pushed itself.
+// WHY own clips count: If the newest clip came from this device, its
+// clipboard already holds the latest content and nothing is applied.
+func (s *Syncer) catchUpCandidate(event *models.Event) bool {
+	if event.ContentType == models.ContentTypeFile {
+		return false
+	}
+	channel := event.Channel
+	if channel == "" {
+		channel = models.DefaultChannel
+	}
+	if len(s.channels) > 0 && !slices.Contains(s.channels, channel) {
+		return false
+	}
+	if event.SourceDeviceID == s.deviceID {
+		return true
+	}
+	return s.accepts(event.SourceDeviceID)
+}
+
+// catchUpFromHistory reads the hub's history since the last seen event and
+// applies the newest clip this device missed. Called by ReceiveFromHub when
+// the hub starts a new session (nothing is replayed) or missed clips beyond
+// what it keeps.
+// WHY give up quietly on a refusal: Listing history needs the hub's shared
+// token; an agent enrolled with a device token relies on session replay.
+func (s *Syncer) catchUpFromHistory(conn *websocket.Conn) {
+	if s.catchUp == nil {
+		return
+	}
+	seen := s.lastSeenEvent()
+	var status *client.StatusError
+
+	// WHY not apply anything on the first connect: There is nothing this
+	// device missed yet; an old clip would only overwrite its clipboard.
+	if seen.EventID == "" {
+		latest, err := s.hub.Latest()
+		if err != nil {
+			syncLog.Debugf("not recording the hub's latest event: %v", err)
+			return
+		}
+		if latest != nil {
+			s.markSeen(latest)
+		}
+		return
+	}
+
+	opts := client.HistoryOptions{SinceEventID: seen.EventID, Limit: catchUpPageSize}
+	var newest, last *models.Event
+	missed := 0
+	for page := 0; page < catchUpMaxPages; page++ {
+		events, err := s.hub.History(opts)
+		// WHY fall back to the time: The last seen event may have been
+		// pruned, deleted, or never stored (a transient clip).
+		if errors.As(err, &status) && status.StatusCode == http.StatusNotFound && opts.SinceEventID != "" {
+			opts = client.HistoryOptions{Since: seen.Time, Limit: catchUpPageSize}
+			events, err = s.hub.History(opts)
+		}
+		if errors.As(err, &status) && status.StatusCode == http.StatusUnauthorized {
+			syncLog.Debugf("not catching up from hub history: %v", err)
+			return
+		}
+		if err != nil {
+			syncLog.Warnf("failed to catch up from hub history: %v", err)
+			return
+		}
+		for i := range events {
+			if events[i].EventID == seen.EventID {
+				continue
+			}
+			last = &events[i]
+			if s.catchUpCandidate(last) {
+				newest = last
+				missed++
+			}
+		}
+		if len(events) < catchUpPageSize || last == nil {
+			break
+		}
+		opts = client.HistoryOptions{SinceEventID: last.EventID, Limit: catchUpPageSize}
+	}
+	if last == nil {
+		return
+	}
+	s.markSeen(last)
+	if newest == nil || newest.SourceDeviceID == s.deviceID {
+		syncLog.Infof("Caught up with hub history: nothing newer to apply")
+		return
+	}
+
+	syncLog.Infof("Caught up with hub history: %d clip(s) missed, applying the newest (event %s from %s)",
+		missed, newest.EventID, newest.SourceDeviceID)
+	// WHY mark replayed: Like a session replay, it arrives late on purpose
+	// and says nothing about sync speed (see receiveEvent).
+	event := *newest
+	event.Replayed = true
+	s.receiveEvent(conn, event)
+}
@@ -17,17 +17,68 @@
 // The trade-off is a small latency (up to one poll interval) before detecting
 // changes, which is acceptable for clipboard sync (humans don't paste
 // faster than ~1 second apart).
+// On Linux and macOS, a change watcher replaces the timer when one is
+// available (see clipwatch_linux.go, clipwatch_darwin.go); the change
+// detection below stays the same.
 
 package main
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
-	"log"
+	"net/url"
+	"strings"
+	"unicode/utf16"
 
 	"github.com/atotto/clipboard"
 )
 
+// platformWriter, when set, replaces atotto's writer for WriteClipboard.
+// WHY a hook instead of build-tagged WriteClipboard variants: Platform files
+// only install a writer when an optional mode is enabled in config (see
+// configurePlatformClipboard), so the common path stays identical everywhere.
+var platformWriter func(text string) error
+
+// primaryReader, when set, reads a secondary selection that the main loop
+// monitors alongside the clipboard (the X11/Wayland PRIMARY selection).
+// WHY nil by default: Only Linux has such a selection, and only when
+// primary_monitor is enabled in config (see clipboard_linux.go).
+var primaryReader func() string
+
+// ClipboardWatcher starts watching the clipboard and returns a channel that
+// receives a value after each change and is closed when the watcher stops.
+// The main loop then checks the clipboard on changes instead of on a timer.
+type ClipboardWatcher func() <-chan struct{}
+
+// clipboardWatcher is the platform's ClipboardWatcher, if it has one.
+// WHY nil by default: Watching needs clipboard_watch on, and on Linux
+// clipnotify or wl-paste installed (see clipwatch_linux.go); macOS watches
+// the pasteboard's change count (see clipwatch_darwin.go). Windows polls.
+var clipboardWatcher ClipboardWatcher
+
+// signalChange signals changed without blocking.
+// WHY buffered with size 1: Like watchWake - a burst of changes while the
+// main loop is busy collapses into one check, which reads the latest state.
+func signalChange(changed chan<- struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
+
+// formatsReader, when set, returns the rich text versions of the current
+// clipboard content, keyed by models.FormatHTML / models.FormatRTF.
+// formatsWriter, when set, places text on the clipboard together with rich
+// versions of it.
+// WHY hooks like platformWriter: Every platform stores rich text differently,
+// and platform files only install them when sync_rich_text is enabled (see
+// configurePlatformClipboard).
+var (
+	formatsReader func() map[string]string
+	formatsWriter func(text string, formats map[string]string) error
+)
+
 // ReadClipboard returns the current clipboard text content.
 //
 // WHY return empty string on error instead of propagating:
@@ -41,7 +92,7 @@ func ReadClipboard() string {
 		// WHY log instead of return error: Clipboard errors are frequent and
 		// usually harmless (empty clipboard, app holding lock). Logging keeps
 		// visibility without disrupting the sync loop.
-		log.Printf("WARN: failed to read clipboard: %v", err)
+		clipboardLog.Warnf("failed to read clipboard: %v", err)
 		return ""
 	}
 	return text
@@ -54,14 +105,54 @@ func ReadClipboard() string {
 // problem worth reporting to the caller so it can decide how to handle it
 // (retry, notify user, etc.). Read failures are invisible; write failures are not.
 func WriteClipboard(text string) error {
-	if err := clipboard.WriteAll(text); err != nil {
-		log.Printf("ERROR: failed to write clipboard: %v", err)
+	write := clipboard.WriteAll
+	if platformWriter != nil {
+		write = platformWriter
+	}
+	if err := write(text); err != nil {
+		clipboardLog.Errorf("failed to write clipboard: %v", err)
 		return err
 	}
 	return nil
 }
 
+// WriteClipboardFormats sets the clipboard to text and, where the platform
+// supports it, the given rich text formats.
+// WHY fall back to plain text: The plain text is what every paste target
+// understands; a clip that lost its formatting beats a clip that never
+// arrived.
+func WriteClipboardFormats(text string, formats map[string]string) error {
+	if len(formats) == 0 || formatsWriter == nil {
+		return WriteClipboard(text)
+	}
+	if err := formatsWriter(text, formats); err != nil {
+		clipboardLog.Warnf("failed to write rich text to clipboard, writing plain text: %v", err)
+		return WriteClipboard(text)
+	}
+	return nil
+}
+
+// clipboardString converts raw clipboard data to a string.
+// WHY not a plain conversion: Browsers on X11 offer text/html as UTF-16 with
+// a byte order mark, and Windows clipboard data ends in a NUL terminator.
+func clipboardString(data []byte) string {
+	if len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE {
+		units := make([]uint16, (len(data)-2)/2)
+		for i := range units {
+			units[i] = uint16(data[2+2*i]) | uint16(data[3+2*i])<<8
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
+
 // GetClipboardHash reads the current clipboard and returns its SHA-256 hash.
+// WHY delegate to hashText: The PRIMARY selection poller hashes its own reads
+// the same way, so both sources share the loop-prevention cache.
 //
 // WHY hash-based change detection instead of comparing full text:
 //   - Memory efficiency: Clipboard can hold megabytes of text. Storing and
@@ -73,10 +164,42 @@ func WriteClipboard(text string) error {
 //   - Privacy-friendly: Hashes can be logged or transmitted for debugging
 //     without exposing actual clipboard content.
 func GetClipboardHash() string {
-	text := ReadClipboard()
+	return hashText(ReadClipboard())
+}
+
+// hashText returns the SHA-256 hex digest of text, or "" for empty text.
+func hashText(text string) string {
 	if text == "" {
 		return ""
 	}
 	hash := sha256.Sum256([]byte(text))
 	return hex.EncodeToString(hash[:])
 }
+
+// parseFileURIList extracts local file paths from text that consists solely
+// of file:// URIs (text/uri-list, or GNOME's x-special/gnome-copied-files,
+// which prefixes the list with "copy" or "cut").
+//
+// WHY detect this in text at all: Some file managers expose copied files only
+// as a URI list in the plain-text target. Syncing "file:///home/me/report.pdf"
+// to another machine is useless - the path doesn't exist there.
+func parseFileURIList(text string) []string {
+	var files []string
+	for i, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i == 0 && (line == "copy" || line == "cut") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Scheme != "file" {
+			// WHY all-or-nothing: Regular text that merely mentions a
+			// file:// link on one line must still sync as text.
+			return nil
+		}
+		files = append(files, u.Path)
+	}
+	return files
+}
@@ -0,0 +1,129 @@
+// Author: Toluwalase Mebaanne
+// Package main provides macOS-specific clipboard hooks for the TailClip agent.
+//
+// WHY a darwin file: When files are copied in Finder, pbpaste returns just
+// the file *name* as plain text. Without an explicit check, TailClip would
+// sync "report.pdf" to other devices as if the user had copied that text.
+// It also moves rich text (HTML, RTF) on and off the pasteboard, which
+// pbcopy and pbpaste only handle as plain text.
+
+//go:build darwin
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// configurePlatformClipboard applies macOS-specific clipboard settings.
+// WHY no plain text hooks: atotto/clipboard (pbcopy/pbpaste) covers plain
+// text fully, but pbcopy can't put more than one format on the pasteboard.
+func configurePlatformClipboard(cfg *config.AgentConfig) {
+	if cfg.SyncRichText {
+		formatsReader = clipboardFormats
+		formatsWriter = writeClipboardFormats
+	}
+	if cfg.ClipboardWatch {
+		clipboardWatcher = findClipboardWatcher()
+	}
+}
+
+// pasteboardClasses maps the AppleScript classes of the pasteboard's rich
+// text types (public.html, public.rtf) to the formats they hold.
+// WHY the trailing space: AppleScript class codes are exactly four
+// characters.
+var pasteboardClasses = []struct{ class, format string }{
+	{"HTML", models.FormatHTML},
+	{"RTF ", models.FormatRTF},
+}
+
+// clipboardFormats returns the rich text versions of the pasteboard content.
+// WHY osascript: Like clipboardFileList, it reaches pasteboard types without
+// cgo. "clipboard info" is checked first so absent types cost no extra
+// process.
+func clipboardFormats() map[string]string {
+	info, err := exec.Command("osascript", "-e", "clipboard info").Output()
+	if err != nil {
+		return nil
+	}
+	formats := make(map[string]string)
+	for _, pb := range pasteboardClasses {
+		if !bytes.Contains(info, []byte("«class "+pb.class+"»")) {
+			continue
+		}
+		out, err := exec.Command("osascript", "-e", "the clipboard as «class "+pb.class+"»").Output()
+		if err != nil {
+			continue
+		}
+		// osascript prints the data as «data HTML3C68746D6C3E...».
+		data := strings.TrimSuffix(strings.TrimSpace(string(out)), "»")
+		data, ok := strings.CutPrefix(data, "«data "+pb.class)
+		if !ok {
+			continue
+		}
+		raw, err := hex.DecodeString(data)
+		if err != nil {
+			continue
+		}
+		if content := clipboardString(raw); content != "" {
+			formats[pb.format] = content
+		}
+	}
+	return formats
+}
+
+// writeClipboardFormats puts text and its rich versions on the pasteboard as
+// one item.
+// WHY the script goes to stdin: A clip near the size limit, hex-encoded,
+// would exceed the maximum command-line length.
+func writeClipboardFormats(text string, formats map[string]string) error {
+	var script strings.Builder
+	script.WriteString("set the clipboard to {text:")
+	script.WriteString(appleScriptString(text))
+	for _, pb := range pasteboardClasses {
+		if content, ok := formats[pb.format]; ok {
+			fmt.Fprintf(&script, ", «class %s»:«data %s%X»", pb.class, pb.class, content)
+		}
+	}
+	script.WriteString("}")
+
+	cmd := exec.Command("osascript", "-")
+	cmd.Stdin = strings.NewReader(script.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("osascript failed: %w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// appleScriptString quotes text as an AppleScript string literal.
+func appleScriptString(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	text = strings.ReplaceAll(text, `"`, `\"`)
+	return `"` + text + `"`
+}
+
+// clipboardFileList returns the file on the pasteboard if Finder put one there.
+// WHY osascript: "clipboard info" lists pasteboard types without cgo; a file
+// copy shows up as «class furl». AppleScript only exposes the first file of a
+// multi-file copy, which is enough to recognize and report the skip.
+func clipboardFileList() []string {
+	info, err := exec.Command("osascript", "-e", "clipboard info").Output()
+	if err != nil || !bytes.Contains(info, []byte("furl")) {
+		return nil
+	}
+
+	path, err := exec.Command("osascript", "-e", "POSIX path of (the clipboard as «class furl»)").Output()
+	if err != nil {
+		return nil
+	}
+	return []string{strings.TrimSpace(string(path))}
+}
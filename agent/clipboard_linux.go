@@ -0,0 +1,216 @@
+// Author: Toluwalase Mebaanne
+// Package main provides Linux PRIMARY selection support for the TailClip agent.
+//
+// WHY PRIMARY matters:
+// X11 (and most Wayland compositors) keep two independent selections:
+// CLIPBOARD (Ctrl+C / Ctrl+V) and PRIMARY (select text, middle-click to paste).
+// Many Linux users live on middle-click, which TailClip would otherwise ignore.
+// atotto/clipboard only talks to CLIPBOARD, so PRIMARY is handled here by
+// calling the same command-line tools directly with their primary flags.
+//
+// WHY two separate switches (monitor vs. set):
+// PRIMARY changes every time text is highlighted, which is far noisier than
+// explicit copies. Some users want received clips available for middle-click
+// (set) without broadcasting every highlight (monitor), or vice versa.
+
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// selectionTool describes how to read and write PRIMARY with one CLI tool.
+type selectionTool struct {
+	name      string
+	readArgs  []string
+	writeArgs []string
+}
+
+// primaryTools lists supported tools in preference order.
+// WHY wl-clipboard first: Under Wayland, X11 tools only see XWayland apps.
+// Each entry is only used if its binary is on PATH (see findPrimaryTool).
+var primaryTools = []selectionTool{
+	{name: "wl-paste", readArgs: []string{"--primary", "--no-newline"}},
+	{name: "xclip", readArgs: []string{"-selection", "primary", "-o"}, writeArgs: []string{"-selection", "primary", "-i"}},
+	{name: "xsel", readArgs: []string{"--primary", "--output"}, writeArgs: []string{"--primary", "--input"}},
+}
+
+// configurePlatformClipboard applies Linux-specific clipboard settings.
+func configurePlatformClipboard(cfg *config.AgentConfig) {
+	// WHY read rich text but never write it: xclip and wl-copy offer exactly
+	// one format per invocation. Offering only text/html would leave
+	// terminals and plain-text fields with nothing to paste, so received
+	// clips are written as plain text.
+	if cfg.SyncRichText {
+		formatsReader = clipboardFormats
+	}
+
+	if cfg.ClipboardWatch {
+		clipboardWatcher = findClipboardWatcher()
+	}
+
+	if !cfg.PrimaryMonitor && !cfg.PrimarySet {
+		return
+	}
+
+	reader, writer, err := findPrimaryTool()
+	if err != nil {
+		clipboardLog.Warnf("PRIMARY selection sync disabled: %v", err)
+		return
+	}
+
+	if cfg.PrimaryMonitor {
+		primaryReader = reader
+		clipboardLog.Infof("Monitoring PRIMARY selection")
+	}
+
+	if cfg.PrimarySet {
+		// WHY wrap instead of replace: CLIPBOARD stays the source of truth.
+		// A PRIMARY failure is logged but doesn't fail the sync, since the
+		// clip is already pasteable with Ctrl+V.
+		platformWriter = func(text string) error {
+			if err := clipboard.WriteAll(text); err != nil {
+				return err
+			}
+			if err := writer(text); err != nil {
+				clipboardLog.Warnf("failed to set PRIMARY selection: %v", err)
+			}
+			return nil
+		}
+		clipboardLog.Infof("Setting PRIMARY selection on received clips")
+	}
+}
+
+// findPrimaryTool returns reader and writer functions backed by the first
+// available selection tool.
+func findPrimaryTool() (func() string, func(string) error, error) {
+	wayland := os.Getenv("WAYLAND_DISPLAY") != ""
+	for _, tool := range primaryTools {
+		if tool.name == "wl-paste" && !wayland {
+			continue
+		}
+		if _, err := exec.LookPath(tool.name); err != nil {
+			continue
+		}
+
+		readCmd := tool
+		reader := func() string {
+			out, err := exec.Command(readCmd.name, readCmd.readArgs...).Output()
+			if err != nil {
+				// WHY silent: An empty PRIMARY selection makes these tools
+				// exit non-zero, which happens constantly and isn't an error.
+				return ""
+			}
+			return string(out)
+		}
+
+		var writer func(string) error
+		if tool.name == "wl-paste" {
+			writer = func(text string) error {
+				return runWithStdin("wl-copy", []string{"--primary"}, text)
+			}
+		} else {
+			writer = func(text string) error {
+				return runWithStdin(readCmd.name, readCmd.writeArgs, text)
+			}
+		}
+		return reader, writer, nil
+	}
+	return nil, nil, fmt.Errorf("no selection tool found (install xclip, xsel, or wl-clipboard)")
+}
+
+// runWithStdin runs a command feeding text on stdin.
+func runWithStdin(name string, args []string, text string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w (%s)", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// clipboardTargets returns the formats the CLIPBOARD owner offers, and a
+// function reading one of them, or nil when no tool is available.
+// WHY check targets first: Reading a target from an owner that doesn't
+// offer it makes xclip block or error; TARGETS is always answered.
+func clipboardTargets() ([]string, func(target string) ([]byte, error)) {
+	var listCmd []string
+	var readCmd func(target string) []string
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		listCmd = []string{"wl-paste", "--list-types"}
+		readCmd = func(target string) []string { return []string{"wl-paste", "--type", target} }
+	default:
+		listCmd = []string{"xclip", "-selection", "clipboard", "-t", "TARGETS", "-o"}
+		readCmd = func(target string) []string { return []string{"xclip", "-selection", "clipboard", "-t", target, "-o"} }
+	}
+
+	if _, err := exec.LookPath(listCmd[0]); err != nil {
+		return nil, nil
+	}
+	out, err := exec.Command(listCmd[0], listCmd[1:]...).Output()
+	if err != nil {
+		return nil, nil
+	}
+	read := func(target string) ([]byte, error) {
+		args := readCmd(target)
+		return exec.Command(args[0], args[1:]...).Output()
+	}
+	return strings.Fields(string(out)), read
+}
+
+// clipboardFileList returns the files on CLIPBOARD if the owner advertised a
+// file-list target (as Nautilus, Dolphin, and Thunar do).
+func clipboardFileList() []string {
+	targets, read := clipboardTargets()
+	if !slices.Contains(targets, "text/uri-list") {
+		return nil
+	}
+	list, err := read("text/uri-list")
+	if err != nil {
+		return nil
+	}
+	return parseFileURIList(string(list))
+}
+
+// richTextTargets maps the clipboard targets carrying rich text to the
+// format each one holds, in preference order.
+// WHY two RTF names: LibreOffice offers text/rtf, some GTK apps only
+// application/rtf.
+var richTextTargets = []struct{ target, format string }{
+	{"text/html", models.FormatHTML},
+	{"text/rtf", models.FormatRTF},
+	{"application/rtf", models.FormatRTF},
+}
+
+// clipboardFormats returns the rich text versions of the CLIPBOARD content.
+func clipboardFormats() map[string]string {
+	targets, read := clipboardTargets()
+	formats := make(map[string]string)
+	for _, rich := range richTextTargets {
+		if _, ok := formats[rich.format]; ok || !slices.Contains(targets, rich.target) {
+			continue
+		}
+		data, err := read(rich.target)
+		if err != nil {
+			continue
+		}
+		if content := clipboardString(data); content != "" {
+			formats[rich.format] = content
+		}
+	}
+	return formats
+}
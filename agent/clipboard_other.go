@@ -0,0 +1,19 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the default (non-Windows) platform clipboard hooks.
+
+//go:build !windows && !linux && !darwin
+
+package main
+
+import "github.com/tmair/tailclip/shared/config"
+
+// configurePlatformClipboard applies platform-specific clipboard settings.
+// WHY a no-op here: atotto/clipboard already covers this platform; only
+// Windows (Win+V history) and Linux (PRIMARY selection) have optional
+// native behavior.
+func configurePlatformClipboard(cfg *config.AgentConfig) {}
+
+// clipboardFileList reports files on the clipboard.
+// WHY nil: No file-list probe exists for this platform; URI lists exposed
+// as plain text are still caught by parseFileURIList.
+func clipboardFileList() []string { return nil }
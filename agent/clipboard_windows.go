@@ -0,0 +1,332 @@
+// Author: Toluwalase Mebaanne
+// Package main provides Windows clipboard history (Win+V) interoperability.
+//
+// WHY a native writer on Windows:
+// atotto/clipboard only places CF_UNICODETEXT on the clipboard. Windows decides
+// whether an item lands in the Win+V history (and whether it's uploaded to the
+// Microsoft cloud clipboard) by looking for two registered formats alongside
+// the text. Writing those formats ourselves lets synced clips show up in Win+V
+// like any local copy, while keeping them out of Microsoft's cloud sync -
+// TailClip is already syncing them over the Tailnet. The same writer places
+// the HTML and RTF versions of rich text clips next to the plain text.
+//
+// WHY no reader for pinned items:
+// The only API exposing clipboard history (WinRT Clipboard.GetHistoryItemsAsync)
+// does not report which items are pinned. Pasting a pinned item from Win+V
+// puts it on the live clipboard, where the normal polling loop picks it up and
+// syncs it - so pinned items already flow through TailClip without extra code.
+
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+const (
+	cfUnicodeText = 13
+	cfHDrop       = 15
+	gmemMoveable  = 0x0002
+)
+
+var (
+	user32                      = syscall.NewLazyDLL("user32.dll")
+	kernel32                    = syscall.NewLazyDLL("kernel32.dll")
+	shell32                     = syscall.NewLazyDLL("shell32.dll")
+	procIsClipboardFormatAvail  = user32.NewProc("IsClipboardFormatAvailable")
+	procGetClipboardData        = user32.NewProc("GetClipboardData")
+	procDragQueryFile           = shell32.NewProc("DragQueryFileW")
+	procOpenClipboard           = user32.NewProc("OpenClipboard")
+	procCloseClipboard          = user32.NewProc("CloseClipboard")
+	procEmptyClipboard          = user32.NewProc("EmptyClipboard")
+	procSetClipboardData        = user32.NewProc("SetClipboardData")
+	procRegisterClipboardFormat = user32.NewProc("RegisterClipboardFormatW")
+	procGlobalAlloc             = kernel32.NewProc("GlobalAlloc")
+	procGlobalFree              = kernel32.NewProc("GlobalFree")
+	procGlobalLock              = kernel32.NewProc("GlobalLock")
+	procGlobalSize              = kernel32.NewProc("GlobalSize")
+	procGlobalUnlock            = kernel32.NewProc("GlobalUnlock")
+	procMoveMemory              = kernel32.NewProc("RtlMoveMemory")
+)
+
+// configurePlatformClipboard applies Windows-specific clipboard settings.
+// WHY opt-in: Writing extra formats changes what other clipboard tools see.
+// Users who never open Win+V get exactly the previous behavior.
+func configurePlatformClipboard(cfg *config.AgentConfig) {
+	history := cfg.WindowsClipboardHistory
+	if history {
+		platformWriter = func(text string) error {
+			return writeClipboardNative(text, nil, true)
+		}
+	}
+	if cfg.SyncRichText {
+		formatsReader = clipboardFormats
+		formatsWriter = func(text string, formats map[string]string) error {
+			return writeClipboardNative(text, formats, history)
+		}
+	}
+}
+
+// Registered clipboard formats holding rich text.
+// WHY registered names: Windows has no predefined CF_ constants for HTML
+// or RTF; Office, browsers, and WordPad all agree on these names.
+const (
+	htmlFormatName = "HTML Format"
+	rtfFormatName  = "Rich Text Format"
+)
+
+// writeClipboardNative places text on the clipboard together with any rich
+// formats and, when history is set, the formats that control Win+V history
+// and cloud clipboard behavior.
+// WHY one function for both: Every format must be set between one
+// OpenClipboard and CloseClipboard, or the last writer empties the rest.
+func writeClipboardNative(text string, formats map[string]string, history bool) error {
+	// WHY lock the OS thread: The clipboard is owned per thread between
+	// OpenClipboard and CloseClipboard. Go may otherwise move this goroutine
+	// to another thread mid-sequence.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := openClipboard(); err != nil {
+		return err
+	}
+	defer procCloseClipboard.Call()
+
+	if r, _, err := procEmptyClipboard.Call(); r == 0 {
+		return fmt.Errorf("EmptyClipboard failed: %w", err)
+	}
+
+	utf16, err := syscall.UTF16FromString(text)
+	if err != nil {
+		return fmt.Errorf("failed to encode clipboard text: %w", err)
+	}
+	if err := setClipboardBytes(cfUnicodeText, unsafe.Slice((*byte)(unsafe.Pointer(&utf16[0])), len(utf16)*2)); err != nil {
+		return err
+	}
+
+	if html, ok := formats[models.FormatHTML]; ok {
+		if err := setClipboardNamed(htmlFormatName, encodeCFHTML(html)); err != nil {
+			return err
+		}
+	}
+	if rtf, ok := formats[models.FormatRTF]; ok {
+		if err := setClipboardNamed(rtfFormatName, append([]byte(rtf), 0)); err != nil {
+			return err
+		}
+	}
+
+	if !history {
+		return nil
+	}
+	// WHY 1 for history, 0 for cloud: Show the clip in Win+V on this machine,
+	// but don't hand it to Microsoft's cloud clipboard a second time.
+	if err := setClipboardDWORD("CanIncludeInClipboardHistory", 1); err != nil {
+		return err
+	}
+	return setClipboardDWORD("CanUploadToCloudClipboard", 0)
+}
+
+// cfHTMLHeader is the description block that starts CF_HTML data; the
+// offsets are byte positions in the whole block, zero-padded to a fixed
+// width so the header's own length doesn't depend on them.
+const cfHTMLHeader = "Version:0.9\r\nStartHTML:%010d\r\nEndHTML:%010d\r\nStartFragment:%010d\r\nEndFragment:%010d\r\n"
+
+// encodeCFHTML wraps html in the CF_HTML clipboard format.
+// WHY mark the whole document as the fragment: Clips from other platforms
+// are complete documents, not selections; pasting all of it is right.
+func encodeCFHTML(html string) []byte {
+	start := len(fmt.Sprintf(cfHTMLHeader, 0, 0, 0, 0))
+	end := start + len(html)
+	return append([]byte(fmt.Sprintf(cfHTMLHeader, start, end, start, end)+html), 0)
+}
+
+// decodeCFHTML extracts the HTML document from CF_HTML data, or "" if the
+// header is malformed.
+func decodeCFHTML(data []byte) string {
+	offsets := make(map[string]int)
+	for _, line := range strings.SplitN(string(data), "\n", 8) {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(value); err == nil {
+			offsets[key] = n
+		}
+	}
+	// WHY fall back to the fragment: StartHTML may be -1 when the writer
+	// only provides the selected fragment.
+	start, end := offsets["StartHTML"], offsets["EndHTML"]
+	if start <= 0 || end <= start {
+		start, end = offsets["StartFragment"], offsets["EndFragment"]
+	}
+	if start <= 0 || end <= start || end > len(data) {
+		return ""
+	}
+	return string(data[start:end])
+}
+
+// clipboardFormats returns the rich text versions of the clipboard content.
+func clipboardFormats() map[string]string {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := openClipboard(); err != nil {
+		return nil
+	}
+	defer procCloseClipboard.Call()
+
+	formats := make(map[string]string)
+	if data := clipboardNamedBytes(htmlFormatName); data != nil {
+		if html := decodeCFHTML(data); html != "" {
+			formats[models.FormatHTML] = html
+		}
+	}
+	if data := clipboardNamedBytes(rtfFormatName); data != nil {
+		if rtf := clipboardString(data); rtf != "" {
+			formats[models.FormatRTF] = rtf
+		}
+	}
+	return formats
+}
+
+// clipboardNamedBytes copies the data stored under a registered format out
+// of the open clipboard, or returns nil if there is none.
+func clipboardNamedBytes(formatName string) []byte {
+	format, err := registerClipboardFormat(formatName)
+	if err != nil {
+		return nil
+	}
+	if r, _, _ := procIsClipboardFormatAvail.Call(format); r == 0 {
+		return nil
+	}
+	handle, _, _ := procGetClipboardData.Call(format)
+	if handle == 0 {
+		return nil
+	}
+	size, _, _ := procGlobalSize.Call(handle)
+	ptr, _, _ := procGlobalLock.Call(handle)
+	if ptr == 0 || size == 0 {
+		return nil
+	}
+	defer procGlobalUnlock.Call(handle)
+
+	data := make([]byte, size)
+	// WHY RtlMoveMemory: See setClipboardBytes.
+	procMoveMemory.Call(uintptr(unsafe.Pointer(&data[0])), ptr, size)
+	return data
+}
+
+// openClipboard retries OpenClipboard briefly.
+// WHY retry: Another process (including Windows' own history service) often
+// holds the clipboard for a few milliseconds right after a change.
+func openClipboard() error {
+	var err error
+	for i := 0; i < 10; i++ {
+		var r uintptr
+		if r, _, err = procOpenClipboard.Call(0); r != 0 {
+			return nil
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return fmt.Errorf("OpenClipboard failed: %w", err)
+}
+
+// registerClipboardFormat returns the ID of a registered clipboard format.
+func registerClipboardFormat(formatName string) (uintptr, error) {
+	name, err := syscall.UTF16PtrFromString(formatName)
+	if err != nil {
+		return 0, err
+	}
+	format, _, err := procRegisterClipboardFormat.Call(uintptr(unsafe.Pointer(name)))
+	if format == 0 {
+		return 0, fmt.Errorf("RegisterClipboardFormat(%s) failed: %w", formatName, err)
+	}
+	return format, nil
+}
+
+// setClipboardNamed stores data under a registered clipboard format.
+func setClipboardNamed(formatName string, data []byte) error {
+	format, err := registerClipboardFormat(formatName)
+	if err != nil {
+		return err
+	}
+	return setClipboardBytes(format, data)
+}
+
+// setClipboardDWORD stores a 4-byte value under a registered clipboard format.
+func setClipboardDWORD(formatName string, value uint32) error {
+	data := []byte{byte(value), byte(value >> 8), byte(value >> 16), byte(value >> 24)}
+	return setClipboardNamed(formatName, data)
+}
+
+// setClipboardBytes copies data into a movable global memory block and hands
+// it to the clipboard under the given format.
+// WHY free only on failure: After a successful SetClipboardData the system
+// owns the memory block; freeing it ourselves would corrupt the clipboard.
+func setClipboardBytes(format uintptr, data []byte) error {
+	handle, _, err := procGlobalAlloc.Call(gmemMoveable, uintptr(len(data)))
+	if handle == 0 {
+		return fmt.Errorf("GlobalAlloc failed: %w", err)
+	}
+
+	ptr, _, err := procGlobalLock.Call(handle)
+	if ptr == 0 {
+		procGlobalFree.Call(handle)
+		return fmt.Errorf("GlobalLock failed: %w", err)
+	}
+	// WHY RtlMoveMemory instead of a Go copy: ptr is memory owned by the
+	// Windows heap; converting it back to a Go pointer isn't allowed by the
+	// unsafe.Pointer rules, so let the OS do the copy.
+	procMoveMemory.Call(ptr, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)))
+	procGlobalUnlock.Call(handle)
+
+	if r, _, err := procSetClipboardData.Call(format, handle); r == 0 {
+		procGlobalFree.Call(handle)
+		return fmt.Errorf("SetClipboardData failed: %w", err)
+	}
+	return nil
+}
+
+// clipboardFileList returns the files Explorer placed on the clipboard.
+// WHY CF_HDROP: Explorer copies files as a drop handle with no text format,
+// so ReadClipboard sees an empty clipboard. Checking CF_HDROP is what lets
+// the agent explain why nothing synced.
+func clipboardFileList() []string {
+	if r, _, _ := procIsClipboardFormatAvail.Call(cfHDrop); r == 0 {
+		return nil
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := openClipboard(); err != nil {
+		return nil
+	}
+	defer procCloseClipboard.Call()
+
+	drop, _, _ := procGetClipboardData.Call(cfHDrop)
+	if drop == 0 {
+		return nil
+	}
+
+	// WHY 0xFFFFFFFF: DragQueryFile returns the file count for that index.
+	count, _, _ := procDragQueryFile.Call(drop, 0xFFFFFFFF, 0, 0)
+	files := make([]string, 0, count)
+	for i := uintptr(0); i < count; i++ {
+		length, _, _ := procDragQueryFile.Call(drop, i, 0, 0)
+		buf := make([]uint16, length+1)
+		procDragQueryFile.Call(drop, i, uintptr(unsafe.Pointer(&buf[0])), length+1)
+		files = append(files, syscall.UTF16ToString(buf))
+	}
+	return files
+}
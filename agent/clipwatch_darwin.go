@@ -0,0 +1,99 @@
+// Author: Toluwalase Mebaanne
+// Package main provides clipboard change watching on macOS for the TailClip
+// agent.
+//
+// WHY watch the change count:
+// macOS sends no notification when the pasteboard changes, but
+// NSPasteboard.changeCount goes up with every copy. Reading it is a property
+// access inside one long-running process, where polling runs pbpaste every
+// tick. Checking it every changeCountInterval picks up a copy within a
+// fraction of the poll interval, and the clipboard itself is only read when
+// something changed.
+//
+// WHY a JavaScript for Automation script:
+// Like the rest of the macOS support, it reaches AppKit through osascript
+// instead of cgo, so the agent still cross-compiles with CGO_ENABLED=0. If
+// the script can't run (no window server session, osascript missing), the
+// watcher stops and the agent polls as before.
+
+//go:build darwin
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// changeCountInterval is how often the watcher reads the change count.
+const changeCountInterval = 100 * time.Millisecond
+
+// changeCountScript prints the pasteboard's change count each time it
+// changes. argv[0] is the interval in seconds.
+// WHY NSFileHandle instead of console.log: osascript sends console.log to
+// stderr. A write to a closed pipe throws, so the script ends with the agent.
+const changeCountScript = `ObjC.import('AppKit');
+function run(argv) {
+	var pb = $.NSPasteboard.generalPasteboard;
+	var out = $.NSFileHandle.fileHandleWithStandardOutput;
+	var last = pb.changeCount;
+	for (;;) {
+		delay(Number(argv[0]));
+		var count = pb.changeCount;
+		if (count !== last) {
+			last = count;
+			out.writeData($(count + '\n').dataUsingEncoding($.NSUTF8StringEncoding));
+		}
+	}
+}`
+
+// findClipboardWatcher returns the change count watcher, or nil when
+// osascript isn't available.
+func findClipboardWatcher() ClipboardWatcher {
+	if _, err := exec.LookPath("osascript"); err != nil {
+		return nil
+	}
+	return watchChangeCount
+}
+
+// watchChangeCount runs changeCountScript, signaling a change for every line
+// it prints. The channel closes when the script stops.
+func watchChangeCount() <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	go func() {
+		defer close(changed)
+		err := runChangeCountScript(changed)
+		clipboardLog.Warnf("pasteboard change count watcher stopped: %v", err)
+	}()
+
+	clipboardLog.Infof("Watching the pasteboard change count (every %s)", changeCountInterval)
+	return changed
+}
+
+// runChangeCountScript runs changeCountScript until it exits.
+func runChangeCountScript(changed chan<- struct{}) error {
+	interval := strconv.FormatFloat(changeCountInterval.Seconds(), 'f', -1, 64)
+	cmd := exec.Command("osascript", "-l", "JavaScript", "-", interval)
+	cmd.Stdin = strings.NewReader(changeCountScript)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		signalChange(changed)
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return fmt.Errorf("osascript exited")
+}
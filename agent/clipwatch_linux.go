@@ -0,0 +1,129 @@
+// Author: Toluwalase Mebaanne
+// Package main provides clipboard change watching on Linux for the TailClip
+// agent.
+//
+// WHY watch instead of poll where possible:
+// Polling costs a process spawn per tick on Linux (atotto shells out to
+// xclip, xsel, or wl-paste), and still leaves up to a poll interval of
+// latency. clipnotify (X11) and `wl-paste --watch` (Wayland) block until the
+// clipboard changes, so the agent reacts immediately and does nothing while
+// the clipboard is idle.
+//
+// WHY external tools again: The X11 XFixes and Wayland data-control
+// protocols would need cgo or a protocol implementation. The tools are small
+// and packaged everywhere; when they are missing, or the compositor doesn't
+// offer data-control (GNOME doesn't), the agent keeps polling as before.
+
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// findClipboardWatcher returns a watcher backed by the tool for the current
+// session, or nil when it isn't installed.
+// WHY not clipnotify under Wayland: Through XWayland it only sees X11 apps'
+// copies; polling sees them all.
+func findClipboardWatcher() ClipboardWatcher {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-paste"); err != nil {
+			return nil
+		}
+		return watchWlPaste
+	}
+	if os.Getenv("DISPLAY") == "" {
+		return nil
+	}
+	if _, err := exec.LookPath("clipnotify"); err != nil {
+		return nil
+	}
+	return watchClipnotify
+}
+
+// watchWlPaste runs `wl-paste --watch`, plus a second one for PRIMARY when it
+// is monitored. If either stops, both are stopped and the channel closed.
+// WHY stop both: The main loop falls back to polling every selection; a
+// half-working watcher would leave one of them unchecked.
+func watchWlPaste() <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// WHY echo: wl-paste runs the command on every change; its output is the
+	// only signal needed, not the content.
+	watches := [][]string{{"--watch", "echo"}}
+	if primaryReader != nil {
+		watches = append(watches, []string{"--primary", "--watch", "echo"})
+	}
+	done := make(chan error, len(watches))
+	for _, args := range watches {
+		go func() {
+			done <- runWatcher(ctx, "wl-paste", args, changed)
+		}()
+	}
+	go func() {
+		err := <-done
+		cancel()
+		for range len(watches) - 1 {
+			<-done
+		}
+		clipboardLog.Warnf("wl-paste --watch stopped: %v", err)
+		close(changed)
+	}()
+
+	clipboardLog.Infof("Watching the clipboard with wl-paste --watch")
+	return changed
+}
+
+// runWatcher runs a watching command until it exits or ctx is canceled,
+// signaling changed for every line it prints.
+func runWatcher(ctx context.Context, name string, args []string, changed chan<- struct{}) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	// WHY Pdeathsig: The watcher would otherwise outlive an agent that
+	// crashes or is killed.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		signalChange(changed)
+	}
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s exited", name)
+}
+
+// watchClipnotify runs clipnotify in a loop, signaling a change each time
+// it exits. clipnotify watches PRIMARY as well as CLIPBOARD.
+func watchClipnotify() <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	go func() {
+		defer close(changed)
+		for {
+			cmd := exec.Command("clipnotify")
+			cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+			// WHY stop on failure: clipnotify exits non-zero when it can't
+			// open the display, which retrying won't fix.
+			if err := cmd.Run(); err != nil {
+				clipboardLog.Warnf("clipnotify stopped: %v", err)
+				return
+			}
+			signalChange(changed)
+		}
+	}()
+
+	clipboardLog.Infof("Watching the clipboard with clipnotify")
+	return changed
+}
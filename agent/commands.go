@@ -0,0 +1,342 @@
+// Author: Toluwalase Mebaanne
+// Package main provides subcommands for the TailClip agent binary.
+//
+// WHY subcommands on the agent binary:
+// Troubleshooting tools need the same config path resolution as the running
+// agent (the journal lives next to the config). Shipping them in the same
+// binary means they always match the on-disk formats of the agent that
+// wrote them.
+//
+// Usage: agent [--json] <command> [flags] [config-path]
+// Running the agent with no command (or just a config path) starts syncing.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/i18n"
+)
+
+// agentCommand is an agent subcommand.
+type agentCommand struct {
+	// summary is the one-line description shown in usage output.
+	summary string
+	// run executes the command with the arguments after its name.
+	run func(args []string) error
+	// hidden commands run normally but are left out of usage output.
+	hidden bool
+}
+
+// agentCommands maps subcommand names to their implementations.
+// WHY a map checked before treating os.Args[1] as a config path: Keeps the
+// existing `agent agent-config.json` invocation working unchanged.
+var agentCommands = map[string]agentCommand{
+	"copy": {
+		summary: "send TEXT (or stdin, for -) to the other devices, like push",
+		run:     runCopy,
+	},
+	"devices": {
+		summary: "list the devices registered with the hub and whether they are online",
+		run:     runDevices,
+	},
+	"enroll": {
+		summary: "replace the shared auth_token in the config with a token for this device",
+		run:     runEnroll,
+	},
+	"history": {
+		summary: "list recent clips from the local history, or copy one back (-copy ID)",
+		run:     runHistory,
+	},
+	"journal": {
+		summary: "show recent sync decisions from the local journal",
+		run:     runJournal,
+	},
+	"paste": {
+		summary: "print the newest text clip from the hub, like pull",
+		run:     runPaste,
+	},
+	"pause": {
+		summary: "pause sync in the running agent, for DURATION (e.g. 30m) or until resume",
+		run:     runPause,
+	},
+	"pick": {
+		summary: "choose one of the hub's newest clips from a list and copy it",
+		run:     runPick,
+	},
+	"pins": {
+		summary: "list clips pinned for this device, copy one back (-copy ID), or pin one (-add ID)",
+		run:     runPins,
+	},
+	"pull": {
+		summary: "print the newest text clip from the hub (-copy puts it on the clipboard)",
+		run:     runPull,
+	},
+	"push": {
+		summary: "send stdin (or -text TEXT) to the other devices",
+		run:     runPush,
+	},
+	"resume": {
+		summary: "resume sync in the running agent after pause",
+		run:     runResume,
+	},
+	"run": {
+		summary: "start the agent, the same as giving just the config path",
+		run:     runRun,
+	},
+	"search": {
+		summary: "search the hub's history, falling back to cached results offline",
+		run:     runSearch,
+	},
+	"signers": {
+		summary: "list the signing keys pinned for other devices, or forget one (-forget DEVICE)",
+		run:     runSigners,
+	},
+	"status": {
+		summary: "show whether the hub is reachable and when clips were last synced",
+		run:     runStatus,
+	},
+	"send-file": {
+		summary: "send a file to the other devices (-file PATH)",
+		run:     runSendFile,
+	},
+	// WHY keep genkey: Setup scripts written before `agent keys` use it.
+	"genkey": {
+		summary: "print a new encryption_key for end-to-end encryption",
+		run:     runGenkey,
+		hidden:  true,
+	},
+	"keys": {
+		summary: "manage the encryption key (generate, export, import, rotate)",
+		run:     runKeys,
+	},
+	"loadtest": {
+		summary: "simulate many agents pushing to a hub (developer tool)",
+		run:     runLoadtest,
+		hidden:  true,
+	},
+}
+
+// WHY register completion in init: Its script lists agentCommands, which
+// can't refer to itself in its own initializer.
+func init() {
+	agentCommands["completion"] = agentCommand{
+		summary: "print a shell completion script (bash, zsh, or fish)",
+		run:     runCompletion,
+	}
+}
+
+// jsonOutput is set by --json, before the command name or as a command's
+// own -json flag (see addJSONFlag). Commands that list things then print
+// JSON instead of a table.
+var jsonOutput bool
+
+// addJSONFlag lets a command take -json after its name as well.
+func addJSONFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&jsonOutput, cli.JSONFlag, jsonOutput, "print machine-readable JSON instead of a table")
+}
+
+// runAgentCommand executes a subcommand if args[0] names one.
+// WHY return a handled flag: main falls through to starting the agent when
+// the first argument isn't a known command (e.g., it's a config path).
+func runAgentCommand(args []string) (bool, error) {
+	args, jsonOutput = cli.CutJSONFlag(args)
+	if jsonOutput && (len(args) == 0 || agentCommands[args[0]].run == nil) {
+		return true, fmt.Errorf("--json must be followed by a command, e.g. agent --json history")
+	}
+	if len(args) == 0 {
+		return false, nil
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printAgentUsage()
+		return true, nil
+	}
+	cmd, ok := agentCommands[args[0]]
+	if !ok {
+		return false, nil
+	}
+	// WHY the environment's locale here: Most commands never load a config
+	// (or load it after failing fast on flags); those that do switch to its
+	// locale in loadCommandConfig.
+	i18n.Init("")
+	return true, cmd.run(args[1:])
+}
+
+// printAgentUsage lists the available subcommands.
+func printAgentUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n  agent %-36s %s\n", "[config-path]", "start the agent")
+	fmt.Fprintf(os.Stderr, "  agent %-36s %s\n", "--json <command> ...", "print a command's output as JSON")
+	names := make([]string, 0, len(agentCommands))
+	for name, cmd := range agentCommands {
+		if !cmd.hidden {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  agent %-36s %s\n", name+" [flags] [config-path]", agentCommands[name].summary)
+	}
+}
+
+// newCommandFlags creates a FlagSet whose usage line matches the agent's
+// `agent <command> [flags] [config-path]` convention.
+func newCommandFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent %s [flags] [config-path]\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// commandConfigPath returns the config path named by the first positional
+// argument, or the default path.
+func commandConfigPath(fs *flag.FlagSet) string {
+	if fs.NArg() > 0 {
+		return fs.Arg(0)
+	}
+	return defaultConfigPath
+}
+
+// loadCommandConfig loads the agent config for a command and switches its
+// output to the config's locale.
+func loadCommandConfig(path string) (*config.AgentConfig, error) {
+	cfg, err := config.LoadAgentConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	i18n.Init(cfg.Locale)
+	return cfg, nil
+}
+
+// runRun implements `agent run [config-path]`.
+// WHY a command for what a bare path already does: With every other
+// action a command, scripts and service files read better naming this one
+// too, and a config file named like a command can still be started.
+func runRun(args []string) error {
+	fs := newCommandFlags("run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	runAgent(commandConfigPath(fs))
+	return nil
+}
+
+// runCompletion implements `agent completion <bash|zsh|fish>`.
+func runCompletion(args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent completion <%s>\n", strings.Join(cli.Shells, "|"))
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("a shell is required")
+	}
+	var commands []cli.Command
+	for name, cmd := range agentCommands {
+		if !cmd.hidden {
+			commands = append(commands, cli.Command{Name: name, Summary: cmd.summary})
+		}
+	}
+	return cli.Completion(os.Stdout, fs.Arg(0), "agent", commands)
+}
+
+// runJournal prints the newest journal entries, oldest first.
+// WHY no config loading: The journal only needs the config's directory.
+// Requiring a valid config would make the tool useless in exactly the
+// situation it's for - an agent that isn't working.
+func runJournal(args []string) error {
+	fs := newCommandFlags("journal")
+	limit := fs.Int("n", 50, "number of entries to show (0 for all)")
+	match := fs.String("event", "", "only show entries whose event ID or hash starts with this")
+	addJSONFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path := journalPath(commandConfigPath(fs))
+	entries, err := ReadJournal(path)
+	if err != nil {
+		return err
+	}
+
+	if *match != "" {
+		filtered := entries[:0]
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.EventID, *match) || strings.HasPrefix(entry.Hash, *match) {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+
+	if jsonOutput {
+		return cli.PrintJSON(nonNil(entries))
+	}
+	if len(entries) == 0 {
+		fmt.Println(i18n.T("cli.journal.none", path))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, i18n.T("cli.journal.header"))
+	for _, e := range entries {
+		size := ""
+		if e.Size > 0 {
+			size = formatBytes(e.Size)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"), e.Action,
+			dashIfEmpty(e.EventID), dashIfEmpty(e.Device), dashIfEmpty(e.Hash),
+			dashIfEmpty(size), e.Detail)
+	}
+	return tw.Flush()
+}
+
+// runGenkey prints a new random encryption key.
+// WHY print instead of writing the config: The same key has to go into
+// every agent's config, so the user copies it anyway.
+func runGenkey(args []string) error {
+	fs := newCommandFlags("genkey")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	key, err := e2e.GenerateKey()
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+	return nil
+}
+
+// nonNil returns items, or an empty slice for nil.
+// WHY: JSON output lists nothing as [], not null, so scripts can iterate
+// over it without a special case.
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+// dashIfEmpty keeps table columns aligned when a field doesn't apply.
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,271 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the running agent's local control endpoint and the
+// `agent pause` and `agent resume` commands that use it.
+//
+// WHY a control endpoint:
+// Pausing sync before copying something sensitive has to be quick and
+// can't mean editing the config and restarting. The tray has a switch, but
+// not every machine runs one, and a script or a hotkey daemon needs a
+// command. The running agent serves a small HTTP API on a unix socket,
+// control.sock next to the config, and the commands talk to it.
+//
+// WHY a unix socket instead of a localhost port:
+// A port is open to every local user, so it would need its own token. The
+// socket is a file only the agent's user can open (0600), which is all the
+// authentication a pause switch needs. Windows 10 and later support unix
+// sockets too.
+//
+// Usage:
+//
+//	agent pause [DURATION] [config-path]
+//	agent resume [config-path]
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/i18n"
+)
+
+// controlSocketName is the control socket created next to the agent config.
+const controlSocketName = "control.sock"
+
+// controlTimeout bounds a command's request to the running agent.
+const controlTimeout = 5 * time.Second
+
+// controlStatus is what the control endpoint reports after every request.
+type controlStatus struct {
+	Paused bool `json:"paused"`
+	// PausedUntil is when a timed pause ends; nil if sync isn't paused or
+	// is paused until resumed.
+	PausedUntil *time.Time `json:"paused_until,omitempty"`
+	Connected   bool       `json:"connected"`
+	// Traffic is what the agent has exchanged with the hub since it
+	// started (see max_upload_kb_per_sec).
+	Traffic client.Traffic `json:"traffic"`
+	// Metered is set while the connection is metered; HeldClips are the
+	// large clips waiting for it not to be.
+	Metered   bool `json:"metered"`
+	HeldClips int  `json:"held_clips,omitempty"`
+}
+
+// controlSocketPath returns the control socket location for an agent config
+// path.
+func controlSocketPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), controlSocketName)
+}
+
+// controlServer serves the control endpoint.
+type controlServer struct {
+	server *http.Server
+}
+
+// startControl serves the control endpoint for syncer on the socket next to
+// configPath. It returns nil, after logging why, when it can't; the agent
+// runs on without it.
+func startControl(syncer *Syncer, configPath string) *controlServer {
+	path := controlSocketPath(configPath)
+	// WHY dial first: A socket left by an agent that crashed has to be
+	// removed before listening, but one a running agent answers on must
+	// not be taken over.
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		agentLog.Warnf("control endpoint disabled: another agent is serving %s", path)
+		return nil
+	}
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		agentLog.Warnf("control endpoint disabled: %v", err)
+		return nil
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		agentLog.Warnf("control endpoint disabled: %v", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		writeControlStatus(w, syncer)
+	})
+	mux.HandleFunc("/v1/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		d, err := parsePauseDuration(r.URL.Query().Get("for"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if d > 0 {
+			syncer.PauseFor(d)
+		} else {
+			syncer.SetPaused(true)
+		}
+		writeControlStatus(w, syncer)
+	})
+	mux.HandleFunc("/v1/resume", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		syncer.SetPaused(false)
+		writeControlStatus(w, syncer)
+	})
+
+	agentLog.Infof("Control endpoint listening on %s", path)
+	c := &controlServer{server: &http.Server{Handler: mux, ReadHeaderTimeout: controlTimeout}}
+	go func() {
+		if err := c.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			agentLog.Warnf("control endpoint stopped: %v", err)
+		}
+	}()
+	return c
+}
+
+// Close stops serving and removes the socket. A nil server does nothing.
+func (c *controlServer) Close() {
+	if c != nil {
+		c.server.Close()
+	}
+}
+
+// writeControlStatus replies with syncer's pause state.
+func writeControlStatus(w http.ResponseWriter, syncer *Syncer) {
+	status := controlStatus{Paused: syncer.Paused(), Connected: syncer.Connected(), Traffic: syncer.Traffic()}
+	status.Metered, status.HeldClips = syncer.Metered()
+	if until := syncer.PausedUntil(); !until.IsZero() {
+		status.PausedUntil = &until
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// parsePauseDuration parses a pause's length, e.g. "30m" or "1h30m". Empty
+// is 0: paused until resumed.
+func parsePauseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("pause length must be a positive duration such as 30m or 1h, got %q", s)
+	}
+	return d, nil
+}
+
+// controlRequest sends a request to the agent running with configPath and
+// returns the status it replies with.
+func controlRequest(configPath, method, endpoint string) (*controlStatus, error) {
+	path := controlSocketPath(configPath)
+	httpClient := &http.Client{
+		Timeout: controlTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	// WHY any host: The transport always dials the socket.
+	req, err := http.NewRequest(method, "http://agent"+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("the agent isn't running with this config (no answer on %s)", path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body [512]byte
+		n, _ := resp.Body.Read(body[:])
+		return nil, fmt.Errorf("the agent refused: %s", string(body[:n]))
+	}
+	var status controlStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to read the agent's reply: %w", err)
+	}
+	return &status, nil
+}
+
+// runPause implements `agent pause [DURATION] [config-path]`.
+func runPause(args []string) error {
+	fs := newCommandFlags("pause")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent pause [flags] [duration, e.g. 30m] [config-path]\n")
+		fs.PrintDefaults()
+	}
+	addJSONFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// WHY tell the two apart by the first digit: Both are optional, and a
+	// forgotten unit ("30") should get an error rather than be taken for a
+	// config path.
+	length, configPath := "", defaultConfigPath
+	for _, arg := range fs.Args() {
+		if length == "" && arg != "" && arg[0] >= '0' && arg[0] <= '9' {
+			length = arg
+		} else {
+			configPath = arg
+		}
+	}
+	if _, err := parsePauseDuration(length); err != nil {
+		return err
+	}
+
+	endpoint := "/v1/pause"
+	if length != "" {
+		endpoint += "?for=" + length
+	}
+	status, err := controlRequest(configPath, http.MethodPost, endpoint)
+	if err != nil {
+		return err
+	}
+	return printControlStatus(status)
+}
+
+// runResume implements `agent resume [config-path]`.
+func runResume(args []string) error {
+	fs := newCommandFlags("resume")
+	addJSONFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	status, err := controlRequest(commandConfigPath(fs), http.MethodPost, "/v1/resume")
+	if err != nil {
+		return err
+	}
+	return printControlStatus(status)
+}
+
+// printControlStatus prints the running agent's pause state.
+func printControlStatus(status *controlStatus) error {
+	if jsonOutput {
+		return cli.PrintJSON(status)
+	}
+	switch {
+	case status.PausedUntil != nil:
+		fmt.Println(i18n.T("cli.sync.paused_until", status.PausedUntil.Local().Format(time.TimeOnly)))
+	case status.Paused:
+		fmt.Println(i18n.T("cli.sync.paused"))
+	default:
+		fmt.Println(i18n.T("cli.sync.resumed"))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the per-day data keys of end-to-end encryption.
+//
+// WHY per-day keys instead of the shared key alone:
+// A clip sealed with encryption_key stays readable for as long as anyone
+// has that key and a copy of the history. Sealing with a random key per day,
+// stored on the hub wrapped by encryption_key, lets `hub shred` destroy a
+// day's key and with it every copy of that day's clips (see models.DataKey).
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// dataKeyCacheTTL is how long an unwrapped data key is kept in memory.
+// WHY not forever: A shredded key must stop working on running agents too,
+// not only on the hub. Refetching a key every few minutes costs nothing.
+const dataKeyCacheTTL = 10 * time.Minute
+
+// cachedDataKey is an unwrapped data key and when it was fetched.
+type cachedDataKey struct {
+	key     []byte
+	fetched time.Time
+}
+
+// dataKeyring fetches, creates, and caches data keys.
+// WHY a mutex: Pushes (main loop) and receives (WebSocket goroutine) both
+// need keys.
+type dataKeyring struct {
+	hub       *client.Client
+	sharedKey []byte
+
+	mu    sync.Mutex
+	cache map[string]cachedDataKey
+	// latest maps a day to the ID of its newest key, which clips are sealed
+	// with; it expires with that key's cache entry.
+	latest map[string]string
+}
+
+// newDataKeyring creates a keyring wrapping keys with sharedKey.
+func newDataKeyring(hub *client.Client, sharedKey []byte) *dataKeyring {
+	return &dataKeyring{hub: hub, sharedKey: sharedKey,
+		cache: make(map[string]cachedDataKey), latest: make(map[string]string)}
+}
+
+// current returns the ID and key for clips sealed now: the newest key of
+// the day, creating and uploading one if no agent has yet.
+// WHY the newest: `agent keys rotate` starts a new key for the rest of the
+// day (see models.NextDataKeyID). A hub from before key generations returns
+// the day's only key.
+func (k *dataKeyring) current(now time.Time) (string, []byte, error) {
+	day := models.DataKeyID(now)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if keyID, ok := k.latest[day]; ok {
+		if key := k.cached(keyID); key != nil {
+			return keyID, key, nil
+		}
+	}
+
+	stored, err := k.hub.LatestDataKey(day)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch data key %s: %w", day, err)
+	}
+	if stored == nil {
+		if stored, err = k.upload(day); err != nil {
+			return "", nil, err
+		}
+	}
+	key, err := k.unwrap(stored)
+	if err != nil {
+		return "", nil, err
+	}
+	k.latest[day] = stored.KeyID
+	return stored.KeyID, key, nil
+}
+
+// get returns the data key keyID; a key missing on the hub is an error.
+func (k *dataKeyring) get(keyID string) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key := k.cached(keyID); key != nil {
+		return key, nil
+	}
+	stored, err := k.hub.DataKey(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch data key %s: %w", keyID, err)
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("data key %s is not on the hub (shredded?)", keyID)
+	}
+	return k.unwrap(stored)
+}
+
+// cached returns the cached key keyID, or nil if it isn't cached or has
+// expired. The caller holds k.mu.
+func (k *dataKeyring) cached(keyID string) []byte {
+	if cached, ok := k.cache[keyID]; ok && time.Since(cached.fetched) < dataKeyCacheTTL {
+		return cached.key
+	}
+	delete(k.cache, keyID)
+	return nil
+}
+
+// unwrap opens a key fetched from the hub and caches it. The caller holds
+// k.mu.
+func (k *dataKeyring) unwrap(stored *models.DataKey) ([]byte, error) {
+	key, err := e2e.UnwrapKey(k.sharedKey, stored.KeyID, stored.Wrapped)
+	if err != nil {
+		return nil, err
+	}
+	k.cache[stored.KeyID] = cachedDataKey{key: key, fetched: time.Now()}
+	return key, nil
+}
+
+// upload creates a data key for keyID and stores it on the hub, returning
+// whichever key the hub kept.
+func (k *dataKeyring) upload(keyID string) (*models.DataKey, error) {
+	key, err := e2e.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := e2e.WrapKey(k.sharedKey, keyID, key)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := k.hub.AddDataKey(&models.DataKey{KeyID: keyID, Wrapped: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload data key %s: %w", keyID, err)
+	}
+	return stored, nil
+}
+
+// forget drops a cached key, so the next use fetches it again.
+func (k *dataKeyring) forget(keyID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.cache, keyID)
+}
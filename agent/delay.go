@@ -0,0 +1,116 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the agent's send delay: a grace period between
+// copying a clip and pushing it.
+//
+// WHY hold clips back:
+// Once a clip reaches the hub it is on every device and in history; deleting
+// it afterwards (see Deleted) is damage control. A few seconds' delay, with
+// a notification offering to cancel, lets an accidental copy of a password
+// be stopped before it ever leaves the machine.
+//
+// WHY copying something else replaces the held clip:
+// It is the one way to cancel that works on every platform, with or without
+// notifications; and had both been sent, the other devices would end up
+// with the newer clip anyway.
+//
+// WHY nothing survives a restart:
+// A held clip is only in memory. An agent that stops during the delay has
+// not sent it, which is the safe side to err on.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// heldClip is a clip waiting for the send delay to pass.
+type heldClip struct {
+	event *models.Event
+	send  func()
+	timer *time.Timer
+}
+
+// sendDelay holds the one clip waiting to be sent.
+// WHY a mutex: The clip is held from the main loop and released from its
+// timer's goroutine or a notification's.
+type sendDelay struct {
+	mu     sync.Mutex
+	delay  time.Duration
+	notify bool
+	held   *heldClip
+}
+
+// DelaySendsBy holds each copied clip for delay before pushing it, showing
+// a notification that can cancel it when notify is set. 0 sends at once.
+func (s *Syncer) DelaySendsBy(delay time.Duration, notify bool) {
+	if delay > 0 {
+		s.sendDelay = &sendDelay{delay: delay, notify: notify}
+	}
+}
+
+// holdClip holds event for the send delay and then calls send, unless it is
+// canceled or a newer clip replaces it first. It reports false without a
+// send delay; the caller then sends at once.
+func (s *Syncer) holdClip(event *models.Event, send func()) bool {
+	d := s.sendDelay
+	if d == nil {
+		return false
+	}
+	held := &heldClip{event: event, send: send}
+
+	d.mu.Lock()
+	if replaced := d.held; replaced != nil {
+		replaced.timer.Stop()
+		s.journal.Record(JournalEntry{Action: journalCanceled, EventID: replaced.event.EventID,
+			Hash: replaced.event.TextHash, Size: len(replaced.event.Text), Detail: "replaced by a newer copy"})
+	}
+	d.held = held
+	held.timer = time.AfterFunc(d.delay, func() { s.releaseHeld(held) })
+	d.mu.Unlock()
+
+	syncLog.Infof("Holding event %s for %s before sending", event.EventID, d.delay)
+	s.journal.Record(JournalEntry{Action: journalHeld, EventID: event.EventID, Hash: event.TextHash,
+		Size: len(event.Text), Detail: "send delay " + d.delay.String()})
+	if d.notify {
+		go func() {
+			if ShowHeldNotification(d.delay) {
+				s.cancelHeld(held, "canceled from the notification")
+			}
+		}()
+	}
+	return true
+}
+
+// take clears held if it is still the held clip, reporting whether it was.
+// WHY: The timer, a cancel, and a newer clip can race; whichever takes the
+// clip first decides its fate.
+func (d *sendDelay) take(held *heldClip) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.held != held {
+		return false
+	}
+	d.held = nil
+	return true
+}
+
+// releaseHeld sends held once its delay has passed.
+func (s *Syncer) releaseHeld(held *heldClip) {
+	if s.sendDelay.take(held) {
+		held.send()
+	}
+}
+
+// cancelHeld drops held without sending it.
+func (s *Syncer) cancelHeld(held *heldClip, reason string) {
+	if !s.sendDelay.take(held) {
+		return
+	}
+	held.timer.Stop()
+	syncLog.Infof("Not sending event %s: %s", held.event.EventID, reason)
+	s.journal.Record(JournalEntry{Action: journalCanceled, EventID: held.event.EventID,
+		Hash: held.event.TextHash, Size: len(held.event.Text), Detail: reason})
+}
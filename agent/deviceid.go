@@ -0,0 +1,78 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the agent's device identity on first run.
+//
+// WHY generate the device ID:
+// Asking users to invent a unique slug for every machine is friction, and
+// two machines set up from the same copied config end up sharing one,
+// which the hub treats as a conflict. A config without a device_id gets a
+// random UUID the first time the agent runs, and one without a device_name
+// gets the machine's host name. Both are written back to the config, so
+// the device keeps its identity, and its history on the hub, from then on.
+//
+// WHY an error when they can't be saved:
+// An ID that isn't saved would be a new device on every start, filling the
+// hub with ghosts. Better to stop and say why.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Agent config fields holding the device's identity.
+const (
+	deviceIDField   = "device_id"
+	deviceNameField = "device_name"
+)
+
+// ensureDeviceIdentity writes a generated device_id and a device_name from
+// the host name into the config at path when it has none, creating the
+// file if needed. A device_id from TAILCLIP_DEVICE_ID counts as set.
+func ensureDeviceIdentity(path string) error {
+	fields, err := readConfigFields(path)
+	if err != nil {
+		return err
+	}
+	values := map[string]string{}
+	for _, f := range fields {
+		var value string
+		if json.Unmarshal(f.value, &value) == nil {
+			values[f.name] = value
+		}
+	}
+
+	if values[deviceIDField] == "" && os.Getenv("TAILCLIP_DEVICE_ID") == "" {
+		deviceID := uuid.NewString()
+		if err := writeConfigString(path, deviceIDField, deviceID); err != nil {
+			return fmt.Errorf("failed to save the generated device_id %s: %w", deviceID, err)
+		}
+		agentLog.Infof("Generated device_id %s and saved it to %s", deviceID, path)
+	}
+	if values[deviceNameField] == "" {
+		name := hostDeviceName()
+		if err := writeConfigString(path, deviceNameField, name); err != nil {
+			return fmt.Errorf("failed to save device_name %q: %w", name, err)
+		}
+		agentLog.Infof("Named this device %q after its host name and saved it to %s", name, path)
+	}
+	return nil
+}
+
+// hostDeviceName returns the machine's host name without its domain, or
+// the OS name when it has none.
+// WHY without the domain: "laptop.tail1234.ts.net" or "laptop.local" says
+// nothing more in a notification than "laptop".
+func hostDeviceName() string {
+	host, err := os.Hostname()
+	host, _, _ = strings.Cut(host, ".")
+	if err != nil || host == "" {
+		return runtime.GOOS + " device"
+	}
+	return host
+}
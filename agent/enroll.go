@@ -0,0 +1,82 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the `agent enroll` command: trading the hub's shared
+// auth token in this agent's config for a token of the device's own.
+//
+// WHY replace the token in the config rather than store a second one:
+// The point is that the shared token is no longer on this machine. A
+// config that kept it next to the device token would lose nothing if the
+// laptop were stolen - the thief would use the shared one.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/i18n"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// authTokenField is the agent config field holding the hub token.
+const authTokenField = "auth_token"
+
+// runEnroll implements `agent enroll [config-path]`.
+func runEnroll(args []string) error {
+	fs := newCommandFlags("enroll")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := commandConfigPath(fs)
+	if os.Getenv("TAILCLIP_AGENT_AUTH_TOKEN") != "" {
+		return fmt.Errorf("TAILCLIP_AGENT_AUTH_TOKEN is set; enroll where the token is stored in the config")
+	}
+
+	// WHY here too: Enrolling may come before the agent's first run, and
+	// the token is issued for the device ID in the config.
+	if err := ensureDeviceIdentity(path); err != nil {
+		return err
+	}
+	cfg, err := loadCommandConfig(path)
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+	hub := client.New(cfg.HubURL, cfg.AuthToken)
+	if proxy := cfg.GetProxy(); proxy != nil {
+		hub.UseProxy(proxy)
+	}
+
+	device := &models.Device{
+		DeviceID:   cfg.DeviceID,
+		DeviceName: cfg.DeviceName,
+		Enabled:    true,
+	}
+	// WHY register the signing key here too: Enrolling is when a device is
+	// set up deliberately, with the shared token in hand; the first key
+	// registered is the one the hub holds it to.
+	if cfg.SignClips {
+		key, err := signingKey(cfg.DeviceID, true)
+		if err != nil {
+			return fmt.Errorf("sign_clips is on, but: %w", err)
+		}
+		device.SigningKey = e2e.PublicSigningKey(key)
+	}
+	token, err := hub.Enroll(device)
+	if err != nil {
+		return fmt.Errorf("failed to enroll (auth_token must be the hub's shared token): %w", err)
+	}
+	if token == "" {
+		return fmt.Errorf("device %s already has a device token; revoke it on the hub (DELETE /api/v1/devices/%s/token) to enroll again",
+			cfg.DeviceID, cfg.DeviceID)
+	}
+
+	if err := writeConfigString(path, authTokenField, token); err != nil {
+		// WHY print the token anyway: The hub shows it only once; without it
+		// the device would have to be revoked and enrolled again.
+		fmt.Fprintln(os.Stderr, i18n.T("cli.enroll.unsaved", token))
+		return err
+	}
+	fmt.Println(i18n.T("cli.enroll.done", cfg.DeviceID, path, cfg.DeviceID))
+	return nil
+}
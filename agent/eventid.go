@@ -0,0 +1,61 @@
+// Author: Toluwalase Mebaanne
+// Package main provides event ID generation for the TailClip agent.
+//
+// WHY time-ordered IDs:
+// Random UUIDv4s scatter inserts across the hub's event_id index and say
+// nothing about when a clip was made. UUIDv7s and ULIDs start with the
+// creation time, so new IDs land at the end of the index and a list of IDs
+// reads in the order the clips were copied. The hub still orders history by
+// timestamp - clocks on different devices disagree - so the scheme is a
+// per-agent choice (event_id_scheme) rather than a protocol change.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// crockford is the Crockford base32 alphabet ULIDs are written in.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newEventID returns a new event ID in the given scheme (one of
+// models.KnownEventIDSchemes, as checked by LoadAgentConfig).
+// WHY panic on a random source failure: uuid.New does the same; an agent
+// whose system randomness is broken can't do anything safely.
+func newEventID(scheme string) string {
+	switch scheme {
+	case models.EventIDUUIDv4:
+		return uuid.New().String()
+	case models.EventIDULID:
+		return newULID(time.Now())
+	default:
+		return uuid.Must(uuid.NewV7()).String()
+	}
+}
+
+// newULID returns a ULID for t: 48 bits of Unix milliseconds followed by 80
+// random bits, encoded as 26 Crockford base32 characters.
+func newULID(t time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(t.UnixMilli())<<16)
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(err)
+	}
+
+	// WHY 130 bits for 128: The first character carries only the top 3
+	// bits, which is why a ULID never starts above '7'.
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
@@ -0,0 +1,253 @@
+// Author: Toluwalase Mebaanne
+// Package main provides file transfer for the TailClip agent.
+//
+// WHY files travel as events:
+// A small file copied on one machine should be ready on the other the same
+// way text is - no share links, no second tool. Files ride the existing
+// event pipeline (base64 in Text, see handlers.FileHandler), so routing,
+// channels, quiet hours, and history apply to them unchanged.
+//
+// Receivers save files into download_dir rather than onto the clipboard:
+// clipboard file formats only point at paths on disk, so the file has to
+// land somewhere first, and a predictable folder is easier to find than a
+// temp directory.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/handlers"
+	"github.com/tmair/tailclip/shared/i18n"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// errFileSkipped marks files that were deliberately not sent (folders,
+// empty files, files over the limit), as opposed to push failures.
+var errFileSkipped = errors.New("file not sent")
+
+// pushFileList sends each file copied to the clipboard and reports the ones
+// that could not be sent.
+func pushFileList(syncer *Syncer, cfg *config.AgentConfig, hash string, files []string) {
+	limit := syncer.MaxFileSize()
+	if limit == 0 {
+		filesLog.Infof("Skipping clipboard file list (%d file(s)): the hub does not support file sync", len(files))
+		syncer.journal.Record(JournalEntry{Action: journalFiltered, Hash: hash,
+			Detail: fmt.Sprintf("file list (%d file(s)): the hub does not support file sync", len(files))})
+		if cfg.NotifyEnabled {
+			ShowFilesSkippedNotification(files, 0)
+		}
+		return
+	}
+
+	var skipped []string
+	for _, path := range files {
+		_, err := pushFile(syncer, cfg, path)
+		switch {
+		case errors.Is(err, errFileSkipped):
+			filesLog.Infof("Not sending file %s: %v", path, err)
+		case err != nil:
+			filesLog.Errorf("failed to send file %s: %v", path, err)
+		default:
+			continue
+		}
+		skipped = append(skipped, path)
+	}
+	if len(skipped) > 0 && cfg.NotifyEnabled {
+		ShowFilesSkippedNotification(skipped, limit)
+	}
+}
+
+// pushFile reads the file at path and pushes it to the hub as a file event.
+// Errors wrapping errFileSkipped mean the file was not eligible.
+func pushFile(syncer *Syncer, cfg *config.AgentConfig, path string) (*models.Event, error) {
+	name := fileBaseName(path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	// WHY refuse folders and special files: Only a regular file's bytes
+	// mean the same thing on the receiving machine.
+	if !info.Mode().IsRegular() {
+		return nil, skipFile(syncer, name, 0, "not a regular file")
+	}
+	// WHY check the size before reading: A multi-gigabyte video copied in a
+	// file manager must not be read into memory just to be refused.
+	if limit := syncer.MaxFileSize(); info.Size() > int64(limit) {
+		return nil, skipFile(syncer, name, int(info.Size()),
+			fmt.Sprintf("%s exceeds the %s file limit", formatBytes(int(info.Size())), formatBytes(limit)))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	event := &models.Event{
+		EventID:        newEventID(cfg.EventIDScheme),
+		SourceDeviceID: cfg.DeviceID,
+		Timestamp:      time.Now().UTC(),
+		ContentType:    models.ContentTypeFile,
+		Text:           handlers.EncodeFile(data),
+		FileName:       name,
+		Channel:        cfg.Channel,
+	}
+	event.SetTextHash()
+
+	// WHY the same rules as the hub: They reject empty files and catch a
+	// file that grew between Stat and ReadFile.
+	if err := handlers.NewFileHandler(syncer.MaxFileSize()).Process(event.Text); err != nil {
+		return nil, skipFile(syncer, name, len(data), err.Error())
+	}
+	if err := models.ValidateEvent(event); err != nil {
+		return nil, skipFile(syncer, name, len(data), err.Error())
+	}
+
+	syncer.CacheEvent(event.EventID)
+	if syncer.deferWhileMetered(event) {
+		return event, nil
+	}
+	if err := syncer.PushToHub(event); err != nil {
+		syncer.journal.Record(JournalEntry{Action: journalFailed, EventID: event.EventID,
+			Hash: event.TextHash, Size: len(data), Detail: "file " + name + ": " + err.Error()})
+		return nil, err
+	}
+	syncer.journal.Record(JournalEntry{Action: journalPushed, EventID: event.EventID,
+		Hash: event.TextHash, Size: len(data), Detail: "file " + name})
+	return event, nil
+}
+
+// skipFile journals a file that was not sent and returns the error for it.
+func skipFile(syncer *Syncer, name string, size int, reason string) error {
+	syncer.journal.Record(JournalEntry{Action: journalFiltered, Size: size,
+		Detail: "file " + name + ": " + reason})
+	return fmt.Errorf("%w: %s", errFileSkipped, reason)
+}
+
+// receiveFile saves a file event from the hub into the download directory.
+// WHY no latency report: A file's delivery time is dominated by its size,
+// and it would skew the percentiles the hub keeps for clipboard sync.
+func (s *Syncer) receiveFile(event *models.Event) {
+	s.cache.Add(event.EventID)
+	if s.downloadDir == "" {
+		// WHY possible at all: The hub only sends files to agents that ask,
+		// but replays and older hubs shouldn't be trusted to get that right.
+		s.journal.Record(JournalEntry{Action: journalFiltered, EventID: event.EventID,
+			Device: event.SourceDeviceID, Detail: "file received but receive_files is off"})
+		return
+	}
+
+	path, size, err := saveReceivedFile(s.downloadDir, event)
+	if err != nil {
+		filesLog.Errorf("failed to save file %q from %s: %v", event.FileName, event.SourceDeviceID, err)
+		s.journal.Record(JournalEntry{Action: journalApplyFail, EventID: event.EventID,
+			Device: event.SourceDeviceID, Hash: event.TextHash, Detail: err.Error()})
+		return
+	}
+
+	filesLog.Infof("Saved file %s from device %s (event %s)", path, event.SourceDeviceID, event.EventID)
+	s.journal.Record(JournalEntry{Action: journalApplied, EventID: event.EventID,
+		Device: event.SourceDeviceID, Hash: event.TextHash, Size: size, Detail: "saved to " + path})
+
+	if s.notifyEnabled.Load() && !event.Silent {
+		ShowFileReceivedNotification(event.SourceDeviceID, filepath.Base(path), s.downloadDir)
+	}
+}
+
+// saveReceivedFile writes a file event's content into dir and returns the
+// path and size written.
+// WHY never overwrite: Receiving "notes.txt" twice must not destroy the
+// first copy, which the user may have edited since. Later copies get
+// "notes (1).txt", "notes (2).txt", and so on, like a browser download.
+func saveReceivedFile(dir string, event *models.Event) (string, int, error) {
+	data, err := handlers.DecodeFile(event.Text)
+	if err != nil {
+		return "", 0, err
+	}
+	// WHY check again after the hub did: The name decides where the file
+	// lands on this machine; only this machine should vouch for it.
+	name := filepath.Base(event.FileName)
+	if name != event.FileName || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", 0, fmt.Errorf("refusing unsafe file name %q", event.FileName)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 0; n < 1000; n++ {
+		candidate := name
+		if n > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", stem, n, ext)
+		}
+		path := filepath.Join(dir, candidate)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			os.Remove(path)
+			return "", 0, err
+		}
+		return path, len(data), f.Close()
+	}
+	return "", 0, fmt.Errorf("too many files named %q in %s", name, dir)
+}
+
+// runSendFile implements `agent send-file -file PATH [config-path]`.
+// WHY a command as well as copy-and-paste: Not every file manager puts
+// copied files on the clipboard in a form the agent can read, and scripts
+// need a way to hand a file to the other machines.
+func runSendFile(args []string) error {
+	fs := newCommandFlags("send-file")
+	file := fs.String("file", "", "path of the file to send (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		fs.Usage()
+		return fmt.Errorf("-file is required")
+	}
+
+	configPath := commandConfigPath(fs)
+	cfg, err := loadCommandConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+	// WHY the agent's journal: `agent journal` then shows files sent from
+	// the command next to everything else.
+	journal, err := OpenJournal(journalPath(configPath))
+	if err != nil {
+		filesLog.Warnf("sync journal disabled: %v", err)
+	}
+
+	syncer := NewSyncer(cfg.HubURL, cfg.AuthToken, cfg.DeviceID, journal)
+	syncer.EncryptWith(cfg.GetEncryptionKey())
+	syncer.CompressAbove(cfg.CompressThreshold)
+	syncer.LimitBandwidth(cfg.GetBandwidthLimits())
+	if proxy := cfg.GetProxy(); proxy != nil {
+		syncer.UseProxy(proxy)
+	}
+	syncer.NegotiateCapabilities(cfg.MaxTextLength, cfg.MaxFileSize)
+	if syncer.MaxFileSize() == 0 {
+		return fmt.Errorf("the hub at %s does not support file sync", cfg.HubURL)
+	}
+
+	event, err := pushFile(syncer, cfg, *file)
+	if err != nil {
+		return err
+	}
+	fmt.Println(i18n.T("cli.file_sent", event.FileName, event.EventID))
+	return nil
+}
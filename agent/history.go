@@ -0,0 +1,416 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the agent's local clip history.
+//
+// WHY a local history when the hub has one:
+// The hub's history needs the hub. On a train, or when the hub machine is
+// down, the clip copied on another device an hour ago is only useful if this
+// machine kept it. `agent history` lists and restores clips from a small
+// file next to the config that survives reboots.
+//
+// WHY encrypted, with the key in the OS keyring:
+// Unlike the journal, this file holds clip text - exactly what a stolen
+// laptop or a synced backup folder shouldn't reveal. The key lives in the
+// Keychain / Credential Manager / Secret Service, so the file alone is
+// useless. Without a keyring (a headless Linux box) the history stays off
+// rather than keeping the key next to the file.
+//
+// WHY opt-in (local_history):
+// Writing clipboard text to disk at all is a decision the user should make.
+// Transient (sensitive) clips are never written, and clips deleted from the
+// hub's history are removed here too.
+
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/i18n"
+	"github.com/zalando/go-keyring"
+)
+
+// historyFileName is the local history file created next to the agent config.
+const historyFileName = "history.jsonl"
+
+// historyKeyringService is the service name the history key is stored under
+// in the OS keyring.
+const historyKeyringService = "TailClip"
+
+// historyPruneInterval is how often RunPruning drops expired clips.
+// WHY hourly: local_history_days is counted in days; an hour late is
+// nothing, and every prune decrypts the whole file.
+const historyPruneInterval = time.Hour
+
+// historySealLabel binds sealed history lines to their purpose (see
+// e2e.SealLocal).
+const historySealLabel = "history"
+
+// LocalClip is one clip in the local history.
+type LocalClip struct {
+	Time    time.Time `json:"time"`
+	EventID string    `json:"event_id"`
+	Device  string    `json:"device"` // source device
+	Channel string    `json:"channel,omitempty"`
+	Text    string    `json:"text"`
+}
+
+// LocalHistory appends clips to a bounded file of sealed JSON lines.
+//
+// WHY the journal's append-then-compact: One small write per clip; the file
+// is rewritten (down to the newest maxClips) once it holds twice that many,
+// and by Prune on a schedule to drop clips older than maxAge.
+//
+// A nil *LocalHistory is valid and records nothing, like a nil *Journal.
+type LocalHistory struct {
+	mu       sync.Mutex
+	path     string
+	key      []byte
+	maxClips int
+	maxAge   time.Duration
+	count    int // lines currently in the file
+}
+
+// historyPath returns the local history location for an agent config path.
+func historyPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), historyFileName)
+}
+
+// historyKeyringUser is the keyring account the history key of deviceID is
+// stored under.
+// WHY per device: Several agents (e.g., a test config) on one machine each
+// keep their own history and key.
+func historyKeyringUser(deviceID string) string {
+	return "local-history:" + deviceID
+}
+
+// historyKey returns this device's history key from the OS keyring,
+// creating and storing one if create is set and there is none yet.
+func historyKey(deviceID string, create bool) ([]byte, error) {
+	user := historyKeyringUser(deviceID)
+	encoded, err := keyring.Get(historyKeyringService, user)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != e2e.KeySize {
+			return nil, fmt.Errorf("history key in the OS keyring (%s / %s) is malformed", historyKeyringService, user)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("OS keyring unavailable: %w", err)
+	}
+	if !create {
+		return nil, fmt.Errorf("no history key in the OS keyring for device %s", deviceID)
+	}
+
+	key, err := e2e.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := keyring.Set(historyKeyringService, user, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("failed to store history key in the OS keyring: %w", err)
+	}
+	return key, nil
+}
+
+// openAgentHistory opens the local history of the agent with the given
+// config, creating its key in the OS keyring on first use.
+func openAgentHistory(configPath string, cfg *config.AgentConfig) (*LocalHistory, error) {
+	key, err := historyKey(cfg.DeviceID, true)
+	if err != nil {
+		return nil, err
+	}
+	return OpenLocalHistory(historyPath(configPath), key, cfg.LocalHistory, cfg.GetLocalHistoryAge())
+}
+
+// OpenLocalHistory prepares the history at path, keeping at most maxClips
+// clips no older than maxAge.
+func OpenLocalHistory(path string, key []byte, maxClips int, maxAge time.Duration) (*LocalHistory, error) {
+	clips, skipped, err := ReadLocalHistory(path, key)
+	if err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		historyLog.Warnf("%d local history entries can't be read with the current key and will be dropped", skipped)
+	}
+	h := &LocalHistory{path: path, key: key, maxClips: maxClips, maxAge: maxAge, count: len(clips) + skipped}
+	h.Prune()
+	return h, nil
+}
+
+// Add appends a clip.
+// WHY log instead of returning errors: Like the journal, the history must
+// never interrupt clipboard sync.
+func (h *LocalHistory) Add(clip LocalClip) {
+	if h == nil {
+		return
+	}
+	line, err := sealClip(h.key, clip)
+	if err != nil {
+		historyLog.Warnf("%v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		historyLog.Warnf("failed to open local history: %v", err)
+		return
+	}
+	_, err = f.WriteString(line + "\n")
+	f.Close()
+	if err != nil {
+		historyLog.Warnf("failed to write local history: %v", err)
+		return
+	}
+
+	h.count++
+	if h.count >= 2*h.maxClips {
+		if err := h.compact(""); err != nil {
+			historyLog.Warnf("failed to compact local history: %v", err)
+		}
+	}
+}
+
+// Remove drops the clip of eventID, e.g. after it was deleted from the
+// hub's history.
+func (h *LocalHistory) Remove(eventID string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.compact(eventID); err != nil {
+		historyLog.Warnf("failed to remove event %s from local history: %v", eventID, err)
+	}
+}
+
+// Prune drops clips older than maxAge and beyond maxClips.
+func (h *LocalHistory) Prune() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.compact(""); err != nil {
+		historyLog.Warnf("failed to prune local history: %v", err)
+	}
+}
+
+// compact rewrites the file with only the clips to keep: the newest
+// maxClips no older than maxAge, without the clip of dropEventID (if set).
+// WHY write-then-rename: See Journal.compact. Caller must hold h.mu.
+func (h *LocalHistory) compact(dropEventID string) error {
+	clips, skipped, err := ReadLocalHistory(h.path, h.key)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-h.maxAge)
+	kept := clips[:0]
+	for _, clip := range clips {
+		if clip.Time.After(cutoff) && (dropEventID == "" || clip.EventID != dropEventID) {
+			kept = append(kept, clip)
+		}
+	}
+	if len(kept) > h.maxClips {
+		kept = kept[len(kept)-h.maxClips:]
+	}
+	if len(kept) == len(clips) && skipped == 0 {
+		return nil
+	}
+
+	tmp := h.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	w := bufio.NewWriter(f)
+	for _, clip := range kept {
+		line, err := sealClip(h.key, clip)
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+		w.WriteString(line + "\n")
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return fmt.Errorf("failed to replace local history: %w", err)
+	}
+
+	h.count = len(kept)
+	return nil
+}
+
+// RunPruning prunes the history every historyPruneInterval, so clips
+// expire on time even on a machine where nothing is copied.
+func (h *LocalHistory) RunPruning() {
+	if h == nil {
+		return
+	}
+	ticker := time.NewTicker(historyPruneInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.Prune()
+	}
+}
+
+// sealClip encodes and seals a clip as one history line.
+func sealClip(key []byte, clip LocalClip) (string, error) {
+	data, err := json.Marshal(clip)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode local history entry: %w", err)
+	}
+	line, err := e2e.SealLocal(key, historySealLabel, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to seal local history entry: %w", err)
+	}
+	return line, nil
+}
+
+// ReadLocalHistory loads all clips from a history file, oldest first, and
+// counts the lines it couldn't open. A missing file is an empty history.
+// WHY skip unreadable lines: A crash mid-append leaves a partial line, and
+// a reset keyring leaves lines sealed with a lost key; neither should hide
+// the rest.
+func ReadLocalHistory(path string, key []byte) ([]LocalClip, int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open local history %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var clips []LocalClip
+	skipped := 0
+	scanner := bufio.NewScanner(f)
+	// WHY a large buffer: One line holds a whole clip, sealed and base64
+	// encoded, which can be far beyond bufio's 64 KB default.
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var clip LocalClip
+		data, err := e2e.OpenLocal(key, historySealLabel, line)
+		if err == nil {
+			err = json.Unmarshal(data, &clip)
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+		clips = append(clips, clip)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read local history %s: %w", path, err)
+	}
+	return clips, skipped, nil
+}
+
+// runHistory implements `agent history [-n N] [-q TEXT] [-copy ID] [config-path]`.
+// WHY work without the agent or the hub running: Offline access is the
+// point; the command only needs the file and the keyring.
+func runHistory(args []string) error {
+	fs := newCommandFlags("history")
+	limit := fs.Int("n", 20, "number of clips to show, newest last (0 for all)")
+	query := fs.String("q", "", "only show clips containing this text (case-insensitive)")
+	copyID := fs.String("copy", "", "put the clip whose event ID starts with this on the clipboard")
+	addJSONFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	configPath := commandConfigPath(fs)
+	cfg, err := loadCommandConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+	key, err := historyKey(cfg.DeviceID, false)
+	if err != nil {
+		return err
+	}
+	path := historyPath(configPath)
+	clips, skipped, err := ReadLocalHistory(path, key)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("cli.unreadable", skipped, path))
+	}
+
+	if *copyID != "" {
+		for i := len(clips) - 1; i >= 0; i-- {
+			if strings.HasPrefix(clips[i].EventID, *copyID) {
+				if err := WriteClipboard(clips[i].Text); err != nil {
+					return fmt.Errorf("failed to write clipboard: %w", err)
+				}
+				fmt.Println(i18n.T("cli.copied", clips[i].EventID, formatBytes(len(clips[i].Text))))
+				return nil
+			}
+		}
+		return fmt.Errorf("no clip with event ID %s... in %s", *copyID, path)
+	}
+
+	if *query != "" {
+		needle := strings.ToLower(*query)
+		filtered := clips[:0]
+		for _, clip := range clips {
+			if strings.Contains(strings.ToLower(clip.Text), needle) {
+				filtered = append(filtered, clip)
+			}
+		}
+		clips = filtered
+	}
+	if *limit > 0 && len(clips) > *limit {
+		clips = clips[len(clips)-*limit:]
+	}
+
+	if jsonOutput {
+		return cli.PrintJSON(nonNil(clips))
+	}
+	if len(clips) == 0 {
+		fmt.Println(i18n.T("cli.history.none", path))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, i18n.T("cli.clips.header"))
+	for _, clip := range clips {
+		// WHY one line per clip: Multi-line clips would break the table;
+		// -copy gets the full text.
+		preview := strings.Join(strings.Fields(clip.Text), " ")
+		if len(preview) > 60 {
+			preview = preview[:60] + "..."
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			clip.Time.Local().Format("2006-01-02 15:04:05"), clip.EventID,
+			clip.Device, formatBytes(len(clip.Text)), preview)
+	}
+	return tw.Flush()
+}
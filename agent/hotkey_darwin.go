@@ -0,0 +1,97 @@
+// Author: Toluwalase Mebaanne
+// Package main provides global hotkeys on macOS for the TailClip agent.
+//
+// WHY a global event monitor in a JavaScript for Automation script:
+// Like the pasteboard watcher, it reaches AppKit through osascript instead
+// of cgo. NSEvent's global monitor only sees keys once osascript is allowed
+// under System Settings > Privacy & Security > Accessibility; until then
+// the hotkey does nothing, and the agent's log says where to allow it.
+
+//go:build darwin
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/config"
+)
+
+// NSEvent modifier flags.
+const (
+	nsShift   = 1 << 17
+	nsControl = 1 << 18
+	nsOption  = 1 << 19
+	nsCommand = 1 << 20
+)
+
+// hotkeyScript prints a line each time the key argv[0] is pressed with
+// exactly the modifiers argv[1].
+const hotkeyScript = `ObjC.import('AppKit');
+function run(argv) {
+	var key = argv[0];
+	var mods = Number(argv[1]);
+	var mask = (1 << 17) | (1 << 18) | (1 << 19) | (1 << 20);
+	var out = $.NSFileHandle.fileHandleWithStandardOutput;
+	$.NSEvent.addGlobalMonitorForEventsMatchingMaskHandler($.NSEventMaskKeyDown, function (event) {
+		if ((event.modifierFlags & mask) !== mods) return;
+		if (ObjC.unwrap(event.charactersIgnoringModifiers).toUpperCase() !== key) return;
+		out.writeData($('pressed\n').dataUsingEncoding($.NSUTF8StringEncoding));
+	});
+	$.NSApplication.sharedApplication.run;
+}`
+
+// watchHotkey runs hotkeyScript for hotkey and returns a channel signalled
+// each time it is pressed. The channel closes if the script stops.
+func watchHotkey(hotkey *config.Hotkey) (<-chan struct{}, error) {
+	if _, err := exec.LookPath("osascript"); err != nil {
+		return nil, fmt.Errorf("osascript not found")
+	}
+	mods := 0
+	if hotkey.Ctrl {
+		mods |= nsControl
+	}
+	if hotkey.Alt {
+		mods |= nsOption
+	}
+	if hotkey.Shift {
+		mods |= nsShift
+	}
+	if hotkey.Super {
+		mods |= nsCommand
+	}
+	// WHY: Function keys arrive as the characters NSF1FunctionKey onwards.
+	key := hotkey.Key
+	if len(key) > 1 {
+		n, _ := strconv.Atoi(key[1:])
+		key = string(rune(0xF704 + n - 1))
+	}
+
+	cmd := exec.Command("osascript", "-l", "JavaScript", "-e", hotkeyScript, key, strconv.Itoa(mods))
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	agentLog.Infof("If %s does nothing, allow osascript under System Settings > Privacy & Security > Accessibility", hotkey)
+
+	pressed := make(chan struct{}, 1)
+	go func() {
+		defer close(pressed)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			signalChange(pressed)
+		}
+		err := cmd.Wait()
+		agentLog.Warnf("hotkey watcher stopped: %v %s", err, strings.TrimSpace(stderr.String()))
+	}()
+	return pressed, nil
+}
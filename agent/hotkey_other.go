@@ -0,0 +1,22 @@
+// Author: Toluwalase Mebaanne
+// Package main provides global hotkeys on Linux and the BSDs: none.
+//
+// WHY not grab the key here:
+// On X11 that needs Xlib through cgo, and Wayland lets no application grab
+// keys at all. Every desktop can bind a key to a command instead, so
+// history_hotkey points the user at `agent pick`.
+
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/tmair/tailclip/shared/config"
+)
+
+// watchHotkey reports that global hotkeys aren't available here.
+func watchHotkey(hotkey *config.Hotkey) (<-chan struct{}, error) {
+	return nil, fmt.Errorf("global hotkeys aren't supported on this platform; bind %s to `agent pick` in your desktop's keyboard settings instead", hotkey)
+}
@@ -0,0 +1,99 @@
+// Author: Toluwalase Mebaanne
+// Package main provides global hotkeys on Windows for the TailClip agent.
+//
+// WHY RegisterHotKey:
+// It is the system's own hotkey table: no hook sees every keystroke, and
+// registration fails cleanly when another application already holds the
+// combination.
+
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"unsafe"
+
+	"github.com/tmair/tailclip/shared/config"
+)
+
+var (
+	procRegisterHotKey = user32.NewProc("RegisterHotKey")
+	procGetMessage     = user32.NewProc("GetMessageW")
+)
+
+// RegisterHotKey modifiers and the message it posts.
+const (
+	modAlt      = 0x0001
+	modControl  = 0x0002
+	modShift    = 0x0004
+	modWin      = 0x0008
+	modNoRepeat = 0x4000
+	wmHotkey    = 0x0312
+)
+
+// winMsg is the Win32 MSG structure.
+type winMsg struct {
+	hwnd    uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	x, y    int32
+	private uint32
+}
+
+// watchHotkey registers hotkey and returns a channel signalled each time it
+// is pressed.
+// WHY a locked OS thread: WM_HOTKEY is posted to the queue of the thread
+// that registered the hotkey, so the same thread has to read it.
+func watchHotkey(hotkey *config.Hotkey) (<-chan struct{}, error) {
+	mods := uintptr(modNoRepeat)
+	if hotkey.Ctrl {
+		mods |= modControl
+	}
+	if hotkey.Alt {
+		mods |= modAlt
+	}
+	if hotkey.Shift {
+		mods |= modShift
+	}
+	if hotkey.Super {
+		mods |= modWin
+	}
+	vk := uintptr(hotkey.Key[0])
+	if len(hotkey.Key) > 1 {
+		n, _ := strconv.Atoi(hotkey.Key[1:])
+		vk = 0x70 + uintptr(n-1) // VK_F1
+	}
+
+	pressed := make(chan struct{}, 1)
+	registered := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		r, _, err := procRegisterHotKey.Call(0, 1, mods, vk)
+		if r == 0 {
+			registered <- err
+			return
+		}
+		registered <- nil
+		defer close(pressed)
+		var msg winMsg
+		for {
+			r, _, err := procGetMessage.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0)
+			if int32(r) <= 0 {
+				agentLog.Warnf("hotkey message loop stopped: %v", err)
+				return
+			}
+			if msg.message == wmHotkey {
+				signalChange(pressed)
+			}
+		}
+	}()
+	if err := <-registered; err != nil {
+		return nil, fmt.Errorf("can't register %s (another application may be using it): %w", hotkey, err)
+	}
+	return pressed, nil
+}
@@ -0,0 +1,99 @@
+// Author: Toluwalase Mebaanne
+// Package main provides notification icons for the TailClip agent.
+//
+// WHY embed icons instead of shipping them next to the binary:
+// The agent is distributed as a single executable (and as a hidden helper
+// inside the macOS/Windows installers). Loose asset files get lost when users
+// move the binary around. go:embed guarantees the icons are always available.
+//
+// WHY write them to disk at all:
+// beeep and the Windows toast API take an icon *path*, not image bytes - the
+// OS notification service loads the file itself. So embedded icons are
+// extracted once into the user cache directory and reused from there.
+
+package main
+
+import (
+	"embed"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//go:embed icons/*.png
+var iconFiles embed.FS
+
+// defaultIcon is used for content types without a dedicated icon.
+const defaultIcon = "tailclip.png"
+
+// contentTypeIcons maps event content types to embedded icon file names.
+// WHY per-type icons: The toast itself tells the user what arrived (text,
+// image, file) before they read the message body.
+var contentTypeIcons = map[string]string{
+	"text":  "text.png",
+	"image": "image.png",
+	"file":  "file.png",
+}
+
+var (
+	// iconMu protects iconPaths.
+	// WHY: Notifications may be shown from the WebSocket goroutine while the
+	// main loop shows its own (e.g., skipped-clip warnings).
+	iconMu    sync.Mutex
+	iconPaths = map[string]string{}
+)
+
+// iconPath returns a filesystem path to the icon for the given content type,
+// extracting it from the binary on first use.
+//
+// WHY return "" on failure: An empty icon path makes beeep/toast fall back
+// to the system default icon - a missing icon must never block a notification.
+func iconPath(contentType string) string {
+	name, ok := contentTypeIcons[contentType]
+	if !ok {
+		name = defaultIcon
+	}
+
+	iconMu.Lock()
+	defer iconMu.Unlock()
+
+	if path, ok := iconPaths[name]; ok {
+		return path
+	}
+
+	path, err := extractIcon(name)
+	if err != nil {
+		notifyLog.Warnf("failed to prepare notification icon %s: %v", name, err)
+		path = ""
+	}
+	iconPaths[name] = path
+	return path
+}
+
+// extractIcon writes an embedded icon into the cache directory.
+// WHY the user cache dir: It survives across runs (no re-extraction on every
+// start) but is safe for the OS to clean up. Falls back to the temp dir on
+// systems without a cache dir (e.g., minimal containers with no $HOME).
+func extractIcon(name string) (string, error) {
+	data, err := iconFiles.ReadFile("icons/" + name)
+	if err != nil {
+		return "", err
+	}
+
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	dir := filepath.Join(base, "tailclip", "icons")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, name)
+	// WHY always rewrite: Keeps the cached copy in sync after an upgrade
+	// ships new artwork. Icons are tiny, so the cost is negligible.
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
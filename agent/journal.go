@@ -0,0 +1,216 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the agent's sync journal.
+//
+// WHY a journal in addition to agent.log:
+// "Why didn't this clip sync?" is the most common question users ask, and
+// agent.log answers it poorly - it mixes connection noise with decisions and
+// grows without bound. The journal records only sync *decisions* (detected,
+// filtered, pushed, received, applied, skipped) in a small structured file
+// that `agent journal` can print on demand.
+//
+// WHY a ring file instead of log rotation:
+// The journal is for recent troubleshooting, not auditing. Keeping the last
+// few hundred decisions in one file needs no rotation config and keeps disk
+// usage fixed.
+//
+// WHY never record clipboard text:
+// The journal sits unencrypted next to the config. Hashes, sizes, and event
+// IDs are enough to correlate entries with what the user copied.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journalFileName is the journal file created next to the agent config.
+const journalFileName = "journal.jsonl"
+
+// journalMaxEntries is how many entries the ring file keeps.
+// WHY 500: Covers several hours of normal copying while staying well under
+// 100KB on disk.
+const journalMaxEntries = 500
+
+// Journal actions.
+// WHY string constants: They are written to disk and shown to users, so they
+// must stay stable and readable.
+const (
+	journalDetected  = "detected"
+	journalFiltered  = "filtered"
+	journalPushed    = "pushed"
+	journalFailed    = "push-failed"
+	journalQueued    = "queued"
+	journalHeld      = "held"
+	journalCanceled  = "canceled"
+	journalPaused    = "paused"
+	journalReceived  = "received"
+	journalApplied   = "applied"
+	journalSkipOwn   = "skipped-own"
+	journalSkipDup   = "skipped-duplicate"
+	journalSkipBad   = "skipped-invalid"
+	journalSkipDeny  = "skipped-untrusted"
+	journalSkipOld   = "skipped-expired"
+	journalSkipSign  = "skipped-unverified"
+	journalApplyFail = "apply-failed"
+	journalRestored  = "restored"
+	journalCleared   = "cleared"
+)
+
+// JournalEntry is one recorded sync decision.
+type JournalEntry struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	EventID string    `json:"event_id,omitempty"`
+	Device  string    `json:"device,omitempty"` // source device for received events
+	Hash    string    `json:"hash,omitempty"`   // shortened content hash
+	Size    int       `json:"size,omitempty"`   // content size in bytes
+	Detail  string    `json:"detail,omitempty"` // reason for filters and failures
+}
+
+// Journal appends entries to a bounded JSON-lines file.
+//
+// WHY append-then-compact instead of rewriting on every entry: Appending is
+// one small write per decision. The file is only rewritten (down to the last
+// journalMaxEntries lines) once it reaches twice that size.
+//
+// A nil *Journal is valid and records nothing, so callers never need to
+// check whether journaling is available.
+type Journal struct {
+	mu    sync.Mutex
+	path  string
+	count int // lines currently in the file
+}
+
+// journalPath returns the journal location for a given agent config path.
+// WHY next to the config: Same reasoning as agent.log - it's the one
+// directory the agent is guaranteed to know and be able to write.
+func journalPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), journalFileName)
+}
+
+// OpenJournal prepares the journal at path, counting existing entries.
+func OpenJournal(path string) (*Journal, error) {
+	entries, err := ReadJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{path: path, count: len(entries)}, nil
+}
+
+// Record appends an entry, stamping it with the current time.
+// WHY log instead of returning errors: Journaling is diagnostic. A full disk
+// must never interrupt clipboard sync.
+func (j *Journal) Record(entry JournalEntry) {
+	if j == nil {
+		return
+	}
+	entry.Time = time.Now().UTC()
+	if len(entry.Hash) > 12 {
+		entry.Hash = entry.Hash[:12]
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		journalLog.Warnf("failed to encode journal entry: %v", err)
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		journalLog.Warnf("failed to open journal: %v", err)
+		return
+	}
+	_, err = f.Write(append(line, '\n'))
+	f.Close()
+	if err != nil {
+		journalLog.Warnf("failed to write journal: %v", err)
+		return
+	}
+
+	j.count++
+	if j.count >= 2*journalMaxEntries {
+		if err := j.compact(); err != nil {
+			journalLog.Warnf("failed to compact journal: %v", err)
+		}
+	}
+}
+
+// compact rewrites the file with only the newest journalMaxEntries lines.
+// WHY write-then-rename: A crash mid-compaction leaves the old file intact
+// rather than a truncated one. Caller must hold j.mu.
+func (j *Journal) compact() error {
+	entries, err := ReadJournal(j.path)
+	if err != nil {
+		return err
+	}
+	if len(entries) > journalMaxEntries {
+		entries = entries[len(entries)-journalMaxEntries:]
+	}
+
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	enc := json.NewEncoder(f)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write %s: %w", tmp, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("failed to replace journal: %w", err)
+	}
+
+	j.count = len(entries)
+	return nil
+}
+
+// ReadJournal loads all entries from a journal file, oldest first.
+// A missing file is an empty journal.
+// WHY skip malformed lines: A crash mid-append can leave a partial last
+// line; that must not hide every other entry.
+func ReadJournal(path string) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal %s: %w", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,459 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the `agent keys` commands for end-to-end encryption.
+//
+// WHY commands instead of editing configs by hand:
+// Every agent needs the same encryption_key, and a key that is off by one
+// character doesn't fail loudly - clips just stop decrypting. These commands
+// move keys between machines in a checked form (a phrase with a checksum,
+// or a QR code), and rotate a leaked key without losing history: the hub's
+// per-day data keys are rewrapped with the new key, so the clips they seal
+// stay readable, and clips sealed afterwards use a new data key the leaked
+// one can't open. The hub only ever stores wrapped keys, which it can't
+// open.
+//
+// Usage:
+//
+//	agent keys generate [-write] [config-path]
+//	agent keys export [-qr] [config-path]
+//	agent keys import [-key KEY] [-force] [config-path]
+//	agent keys rotate [-apply] [config-path]
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/i18n"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// encryptionKeyField is the agent config field holding the shared key.
+const encryptionKeyField = "encryption_key"
+
+// keysCommands maps `agent keys` subcommands to their implementations.
+var keysCommands = map[string]agentCommand{
+	"generate": {summary: "create a new encryption key (-write stores it in the config)", run: runKeysGenerate},
+	"export":   {summary: "show this agent's key as a phrase, or a QR code with -qr", run: runKeysExport},
+	"import":   {summary: "store a key (base64 or phrase) in the config", run: runKeysImport},
+	"rotate":   {summary: "replace the key, rewrapping the hub's data keys", run: runKeysRotate},
+}
+
+// runKeys dispatches `agent keys <subcommand>`.
+func runKeys(args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printKeysUsage()
+		return nil
+	}
+	cmd, ok := keysCommands[args[0]]
+	if !ok {
+		printKeysUsage()
+		return fmt.Errorf("unknown keys command %q", args[0])
+	}
+	return cmd.run(args[1:])
+}
+
+// printKeysUsage lists the `agent keys` subcommands.
+func printKeysUsage() {
+	names := make([]string, 0, len(keysCommands))
+	for name := range keysCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  agent keys %-31s %s\n", name+" [flags] [config-path]", keysCommands[name].summary)
+	}
+}
+
+// runKeysGenerate prints a new key, and with -write stores it in the
+// config.
+// WHY refuse to overwrite an existing key: Clips sealed with it would
+// become unreadable. Replacing a key in use is what `keys rotate` is for.
+func runKeysGenerate(args []string) error {
+	fs := newCommandFlags("keys generate")
+	write := fs.Bool("write", false, "store the key in the agent config")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	encoded, err := e2e.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if *write {
+		path := commandConfigPath(fs)
+		if existing, err := readConfigString(path, encryptionKeyField); err != nil {
+			return err
+		} else if existing != "" {
+			return fmt.Errorf("%s already has an encryption_key; use `agent keys rotate` to replace it", path)
+		}
+		if err := writeConfigString(path, encryptionKeyField, encoded); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, i18n.T("cli.keys.stored", path))
+	}
+	key, _ := e2e.ParseKey(encoded)
+	printKey(key)
+	return nil
+}
+
+// runKeysExport shows the configured key for setting up another device.
+// WHY no config validation: Like `agent journal`, exporting the key must
+// work from a config that is otherwise incomplete - the new device is
+// often being set up from a half-finished one.
+func runKeysExport(args []string) error {
+	fs := newCommandFlags("keys export")
+	qr := fs.Bool("qr", false, "also show the key as a QR code")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := configuredKey(commandConfigPath(fs))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, i18n.T("cli.keys.secret"))
+	printKey(key)
+	if *qr {
+		code, err := encodeQR([]byte(e2e.FormatPhrase(key)))
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+		code.render(os.Stdout)
+	}
+	return nil
+}
+
+// runKeysImport stores a key in the config, read from -key or stdin.
+// WHY stdin by default: A key on the command line lands in the shell
+// history.
+func runKeysImport(args []string) error {
+	fs := newCommandFlags("keys import")
+	keyFlag := fs.String("key", "", "the key, base64 or phrase (default: read from stdin)")
+	force := fs.Bool("force", false, "replace a different key already in the config")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	input := *keyFlag
+	if input == "" {
+		fmt.Fprint(os.Stderr, i18n.T("cli.keys.prompt"))
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read key: %w", err)
+		}
+		input = line
+	}
+	key, err := e2e.ParseKey(input)
+	if err != nil {
+		return err
+	}
+
+	path := commandConfigPath(fs)
+	existing, err := readConfigString(path, encryptionKeyField)
+	if err != nil {
+		return err
+	}
+	if old, err := e2e.ParseKey(existing); existing != "" && (err != nil || !bytes.Equal(old, key)) && !*force {
+		return fmt.Errorf("%s already has a different encryption_key; re-run with -force to replace it", path)
+	}
+	if err := writeConfigString(path, encryptionKeyField, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return err
+	}
+	fmt.Println(i18n.T("cli.keys.imported", e2e.Fingerprint(key), path))
+	if os.Getenv("TAILCLIP_ENCRYPTION_KEY") != "" {
+		fmt.Fprintln(os.Stderr, i18n.T("cli.keys.env_override"))
+	}
+	return nil
+}
+
+// runKeysRotate replaces the shared key: every data key on the hub is
+// rewrapped with a new key, which is then stored in the config. Rewrapping
+// needs the hub's shared token, which is read from stdin.
+// WHY report-only by default: After a rotation every other agent stops
+// decrypting until it imports the new key.
+// WHY rewrap instead of re-encrypting clips: The data keys stay the same,
+// so history stays readable without touching a single event - and the hub,
+// which only sees wrapped keys, can do nothing but store the new ones.
+// WHY start a new data key for today: Whoever holds the leaked key may
+// also hold today's key in its old wrapped form. Without a new one, clips
+// sealed until midnight UTC would still open for them.
+func runKeysRotate(args []string) error {
+	fs := newCommandFlags("keys rotate")
+	apply := fs.Bool("apply", false, "rotate the key (default: only report what would change)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path := commandConfigPath(fs)
+	cfg, err := loadCommandConfig(path)
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+	oldKey := cfg.GetEncryptionKey()
+	if oldKey == nil {
+		return fmt.Errorf("%s has no encryption_key to rotate; use `agent keys generate -write`", path)
+	}
+	if os.Getenv("TAILCLIP_ENCRYPTION_KEY") != "" {
+		return fmt.Errorf("TAILCLIP_ENCRYPTION_KEY is set; rotate where the key is stored in the config")
+	}
+
+	hub := client.New(cfg.HubURL, cfg.AuthToken)
+	if proxy := cfg.GetProxy(); proxy != nil {
+		hub.UseProxy(proxy)
+	}
+	stored, err := hub.DataKeys()
+	if err != nil {
+		return fmt.Errorf("failed to list the hub's data keys: %w", err)
+	}
+
+	// WHY unwrap everything first: A key this agent can't open was wrapped
+	// with another shared key; rotating around it would lose that day.
+	dataKeys := make([][]byte, len(stored))
+	for i, key := range stored {
+		if dataKeys[i], err = e2e.UnwrapKey(oldKey, key.KeyID, key.Wrapped); err != nil {
+			return fmt.Errorf("cannot rotate: %w", err)
+		}
+	}
+
+	fmt.Println(i18n.T("cli.keys.rotate_plan", len(stored), cfg.HubURL, e2e.Fingerprint(oldKey)))
+	if !*apply {
+		fmt.Println(i18n.T("cli.keys.rotate_apply"))
+		return nil
+	}
+
+	// WHY ask for the hub token: The hub only rewraps keys for its shared
+	// token (see handleDataKeys in the hub), and an enrolled agent's config
+	// holds a device token. Read from stdin like `keys import`, so it stays
+	// out of the shell history.
+	fmt.Fprint(os.Stderr, i18n.T("cli.keys.token_prompt"))
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read hub token: %w", err)
+	}
+	token := strings.TrimSpace(line)
+	if token == "" {
+		token = cfg.AuthToken
+	}
+	admin := client.New(cfg.HubURL, token)
+	if proxy := cfg.GetProxy(); proxy != nil {
+		admin.UseProxy(proxy)
+	}
+
+	encoded, err := e2e.GenerateKey()
+	if err != nil {
+		return err
+	}
+	newKey, _ := e2e.ParseKey(encoded)
+	if err := rewrapDataKeys(admin, stored, dataKeys, newKey); err != nil {
+		var status *client.StatusError
+		if errors.As(err, &status) && status.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("%w (rewrapping needs the hub's shared token, not a device token)", err)
+		}
+		return err
+	}
+	// WHY only warn: The hub's keys are already rewrapped, so the new key
+	// must be saved either way.
+	if err := startNextDataKey(admin, newKey, time.Now()); err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("cli.keys.rotate_no_next", err))
+	}
+
+	if err := writeConfigString(path, encryptionKeyField, encoded); err != nil {
+		// WHY print the key anyway: The hub's keys are already wrapped with
+		// it; losing it now would lose the history.
+		fmt.Fprintln(os.Stderr, i18n.T("cli.keys.rotate_unsaved"))
+		printKey(newKey)
+		return err
+	}
+	fmt.Println(i18n.T("cli.keys.rotated", len(stored), path))
+	printKey(newKey)
+	return nil
+}
+
+// rewrapDataKeys replaces the wrapped form of every stored key with one
+// under newKey. If a replacement fails, those already made are undone.
+// WHY undo: Half-rotated, the hub's keys would need two shared keys to
+// open, and no agent holds both.
+func rewrapDataKeys(hub *client.Client, stored []models.DataKey, dataKeys [][]byte, newKey []byte) error {
+	var done []models.DataKeyRewrap
+	for i, key := range stored {
+		wrapped, err := e2e.WrapKey(newKey, key.KeyID, dataKeys[i])
+		if err == nil {
+			rewrap := models.DataKeyRewrap{KeyID: key.KeyID, Wrapped: wrapped, Previous: key.Wrapped}
+			if _, err = hub.RewrapDataKey(&rewrap); err == nil {
+				done = append(done, rewrap)
+				continue
+			}
+		}
+
+		for _, rewrap := range done {
+			undo := models.DataKeyRewrap{KeyID: rewrap.KeyID, Wrapped: rewrap.Previous, Previous: rewrap.Wrapped}
+			if _, undoErr := hub.RewrapDataKey(&undo); undoErr != nil {
+				return fmt.Errorf("failed to rewrap data key %s (%v), and undoing %s failed too: %w",
+					key.KeyID, err, rewrap.KeyID, undoErr)
+			}
+		}
+		return fmt.Errorf("failed to rewrap data key %s, nothing was changed: %w", key.KeyID, err)
+	}
+	return nil
+}
+
+// startNextDataKey uploads a new data key for the rest of today, wrapped
+// with sharedKey, if today already has one. Agents seal with the newest key
+// of the day (see dataKeyring.current).
+func startNextDataKey(hub *client.Client, sharedKey []byte, now time.Time) error {
+	latest, err := hub.LatestDataKey(models.DataKeyID(now))
+	if err != nil || latest == nil {
+		return err
+	}
+	keyID := models.NextDataKeyID(latest.KeyID)
+	key, err := e2e.NewDataKey()
+	if err != nil {
+		return err
+	}
+	wrapped, err := e2e.WrapKey(sharedKey, keyID, key)
+	if err != nil {
+		return err
+	}
+	if _, err := hub.AddDataKey(&models.DataKey{KeyID: keyID, Wrapped: wrapped}); err != nil {
+		return fmt.Errorf("failed to upload data key %s: %w", keyID, err)
+	}
+	return nil
+}
+
+// printKey prints key in both forms and its fingerprint.
+func printKey(key []byte) {
+	fmt.Println(i18n.T("cli.keys.phrase", e2e.FormatPhrase(key)))
+	fmt.Println(i18n.T("cli.keys.base64", base64.StdEncoding.EncodeToString(key)))
+	fmt.Println(i18n.T("cli.keys.fingerprint", e2e.Fingerprint(key)))
+}
+
+// configuredKey returns the key in the config at path, or from
+// TAILCLIP_ENCRYPTION_KEY, which overrides it as it does for the agent.
+func configuredKey(path string) ([]byte, error) {
+	encoded := os.Getenv("TAILCLIP_ENCRYPTION_KEY")
+	if encoded == "" {
+		var err error
+		if encoded, err = readConfigString(path, encryptionKeyField); err != nil {
+			return nil, err
+		}
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("%s has no encryption_key (create one with `agent keys generate -write`)", path)
+	}
+	return e2e.ParseKey(encoded)
+}
+
+// readConfigString returns a string field of the JSON config at path, or
+// "" if the file or field doesn't exist.
+func readConfigString(path, field string) (string, error) {
+	fields, err := readConfigFields(path)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range fields {
+		if f.name == field {
+			var value string
+			if err := json.Unmarshal(f.value, &value); err != nil {
+				return "", fmt.Errorf("%s in %s is not a string", field, path)
+			}
+			return value, nil
+		}
+	}
+	return "", nil
+}
+
+// configField is one top-level field of a JSON config, as written.
+type configField struct {
+	name  string
+	value json.RawMessage
+}
+
+// readConfigFields returns the top-level fields of the JSON config at path
+// in file order, or none if the file doesn't exist.
+func readConfigFields(path string) ([]configField, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("failed to parse %s: not a JSON object", path)
+	}
+	var fields []configField
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		fields = append(fields, configField{name: tok.(string), value: value})
+	}
+	return fields, nil
+}
+
+// writeConfigString sets a string field in the JSON config at path,
+// creating the file if needed.
+// WHY rewrite field by field instead of unmarshalling into AgentConfig:
+// The file keeps its field order, its formatting within values, and values
+// the agent doesn't know, and doesn't fill up with every default.
+// WHY 0600: The file now holds a secret.
+func writeConfigString(path, field, value string) error {
+	fields, err := readConfigFields(path)
+	if err != nil {
+		return err
+	}
+	encoded, _ := json.Marshal(value)
+	found := false
+	for i := range fields {
+		if fields[i].name == field {
+			fields[i].value, found = encoded, true
+		}
+	}
+	if !found {
+		fields = append(fields, configField{name: field, value: encoded})
+	}
+
+	var out strings.Builder
+	out.WriteString("{\n")
+	for i, f := range fields {
+		name, _ := json.Marshal(f.name)
+		fmt.Fprintf(&out, "  %s: %s", name, f.value)
+		if i < len(fields)-1 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("}\n")
+
+	if err := os.WriteFile(path, []byte(out.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	// WHY chmod as well: WriteFile only applies the mode to new files.
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("failed to restrict config permissions: %w", err)
+	}
+	return nil
+}
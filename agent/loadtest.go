@@ -0,0 +1,276 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the hidden `agent loadtest` command.
+//
+// WHY a load generator inside the agent binary:
+// Changes to the broadcaster or SQLite tuning need numbers, not impressions.
+// Virtual agents built from the real Syncer exercise exactly the push and
+// WebSocket code paths production agents use, so a regression in either
+// shows up here.
+//
+// WHY hidden from `agent help`: It fills the hub's history with synthetic
+// clips. It's meant for developers pointing it at a test hub, not for users
+// troubleshooting their own setup.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// loadtestDrainPeriod is how long receivers keep listening after the last
+// push, so in-flight broadcasts are counted instead of reported as lost.
+const loadtestDrainPeriod = 2 * time.Second
+
+// memoryClipboard is the fake clipboard backend of a virtual agent.
+// WHY not the system clipboard: Dozens of virtual agents in one process
+// would fight over the single real clipboard - and overwrite the user's.
+type memoryClipboard struct {
+	mu   sync.Mutex
+	text string
+}
+
+// Write stores text as the clipboard content.
+func (c *memoryClipboard) Write(text string) {
+	c.mu.Lock()
+	c.text = text
+	c.mu.Unlock()
+}
+
+// virtualAgent is one simulated device.
+type virtualAgent struct {
+	deviceID      string
+	eventIDScheme string
+	syncer        *Syncer
+	conn          *websocket.Conn
+	clipboard     memoryClipboard
+}
+
+// loadtestStats accumulates results from all virtual agents.
+type loadtestStats struct {
+	mu         sync.Mutex
+	pushed     int
+	pushFailed int
+	pushErrors map[string]int
+	received   int
+	pushMs     []int64
+	deliveryMs []int64
+}
+
+// recordPush records the outcome of one push.
+func (st *loadtestStats) recordPush(elapsed time.Duration, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err != nil {
+		st.pushFailed++
+		st.pushErrors[err.Error()]++
+		return
+	}
+	st.pushed++
+	st.pushMs = append(st.pushMs, elapsed.Milliseconds())
+}
+
+// recordDelivery records one broadcast received by a virtual agent.
+func (st *loadtestStats) recordDelivery(latency time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.received++
+	st.deliveryMs = append(st.deliveryMs, latency.Milliseconds())
+}
+
+// runLoadtest implements `agent loadtest [flags] [config-path]`.
+// The hub URL and auth token come from the agent config.
+func runLoadtest(args []string) error {
+	fs := newCommandFlags("loadtest")
+	agents := fs.Int("agents", 10, "number of virtual agents")
+	rate := fs.Float64("rate", 1, "pushes per second per virtual agent")
+	duration := fs.Duration("duration", 30*time.Second, "how long to push")
+	size := fs.Int("size", 256, "clip size in bytes")
+	channel := fs.String("channel", "loadtest", "channel to push to and subscribe to")
+	prefix := fs.String("prefix", "loadtest-", "device ID prefix for virtual agents")
+	verbose := fs.Bool("v", false, "keep per-request agent logging")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *agents < 1 || *rate <= 0 || *duration <= 0 || *size < 1 {
+		fs.Usage()
+		return fmt.Errorf("-agents, -rate, -duration, and -size must be positive")
+	}
+
+	cfg, err := loadCommandConfig(commandConfigPath(fs))
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+
+	// WHY silence the log: The Syncer logs every push and connection, which
+	// at load-test rates buries the summary and costs measurable time.
+	if !*verbose {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	fmt.Printf("Load test: %d agent(s) x %.2f push/s for %s against %s (channel %q, %d-byte clips)\n",
+		*agents, *rate, *duration, cfg.HubURL, *channel, *size)
+
+	stats := &loadtestStats{pushErrors: make(map[string]int)}
+	var receivers sync.WaitGroup
+
+	// WHY connect everyone before pushing: Otherwise early pushes have fewer
+	// receivers than later ones and the delivery ratio means nothing.
+	// WHY a dedicated channel by default: Real agents on the same hub only
+	// subscribe to their own channels, so their clipboards stay untouched.
+	fleet := make([]*virtualAgent, *agents)
+	for i := range fleet {
+		agent := &virtualAgent{deviceID: fmt.Sprintf("%s%d", *prefix, i+1), eventIDScheme: cfg.EventIDScheme}
+		agent.syncer = NewSyncer(cfg.HubURL, cfg.AuthToken, agent.deviceID, nil)
+		if proxy := cfg.GetProxy(); proxy != nil {
+			agent.syncer.UseProxy(proxy)
+		}
+		agent.conn, err = agent.syncer.ConnectWebSocket([]string{*channel})
+		if err != nil {
+			for _, connected := range fleet[:i] {
+				connected.conn.Close()
+			}
+			return fmt.Errorf("virtual agent %s failed to connect: %w", agent.deviceID, err)
+		}
+		fleet[i] = agent
+
+		receivers.Add(1)
+		go func() {
+			defer receivers.Done()
+			agent.receive(stats)
+		}()
+	}
+
+	start := time.Now()
+	deadline := start.Add(*duration)
+	interval := time.Duration(float64(time.Second) / *rate)
+
+	var pushers sync.WaitGroup
+	for _, agent := range fleet {
+		pushers.Add(1)
+		go func() {
+			defer pushers.Done()
+			agent.push(stats, *channel, *size, interval, deadline)
+		}()
+	}
+	pushers.Wait()
+	elapsed := time.Since(start)
+
+	time.Sleep(loadtestDrainPeriod)
+	for _, agent := range fleet {
+		agent.conn.Close()
+	}
+	receivers.Wait()
+
+	stats.print(elapsed, *agents)
+	return nil
+}
+
+// push sends a synthetic clip every interval until deadline.
+// WHY a ticker: If the hub falls behind, ticks are dropped rather than
+// queued, so the achieved rate in the summary shows the hub's real limit.
+func (a *virtualAgent) push(stats *loadtestStats, channel string, size int, interval time.Duration, deadline time.Time) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for seq := 1; time.Now().Before(deadline); seq++ {
+		event := &models.Event{
+			EventID:        newEventID(a.eventIDScheme),
+			SourceDeviceID: a.deviceID,
+			Timestamp:      time.Now().UTC(),
+			ContentType:    "text",
+			Text:           syntheticClip(a.deviceID, seq, size),
+			Channel:        channel,
+		}
+		event.SetTextHash()
+
+		started := time.Now()
+		err := a.syncer.PushToHub(event)
+		stats.recordPush(time.Since(started), err)
+
+		<-ticker.C
+	}
+}
+
+// receive reads broadcasts until the connection is closed.
+// WHY measure on the receiver with the origin timestamp: Pusher and receiver
+// share this process's clock, so the end-to-end figure has no clock skew.
+func (a *virtualAgent) receive(stats *loadtestStats) {
+	for {
+		_, message, err := a.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		receivedAt := time.Now()
+
+		var event models.Event
+		if err := json.Unmarshal(message, &event); err != nil || event.EventID == "" {
+			continue // control messages (presence, alerts)
+		}
+		if event.SourceDeviceID == a.deviceID {
+			continue
+		}
+		a.clipboard.Write(event.Text)
+		stats.recordDelivery(receivedAt.Sub(event.Timestamp))
+	}
+}
+
+// syntheticClip builds a unique clip of exactly size bytes (when size allows).
+func syntheticClip(deviceID string, seq, size int) string {
+	header := fmt.Sprintf("tailclip loadtest %s #%d ", deviceID, seq)
+	if len(header) >= size {
+		return header[:size]
+	}
+	return header + strings.Repeat("x", size-len(header))
+}
+
+// print writes the load test summary to stdout.
+func (st *loadtestStats) print(elapsed time.Duration, agents int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	attempted := st.pushed + st.pushFailed
+	seconds := elapsed.Seconds()
+	fmt.Printf("\nPushes:     %d attempted, %d ok, %d failed (%.1f%% errors)\n",
+		attempted, st.pushed, st.pushFailed, percentOf(st.pushFailed, attempted))
+	fmt.Printf("Throughput: %.1f pushes/s over %s\n", float64(st.pushed)/seconds, elapsed.Round(time.Millisecond))
+
+	// WHY expected = ok pushes x other agents: Every virtual agent subscribes
+	// to the channel, and the hub never echoes an event to its source.
+	expected := st.pushed * (agents - 1)
+	fmt.Printf("Deliveries: %d of %d expected (%.1f%%), %.1f/s\n",
+		st.received, expected, percentOf(st.received, expected), float64(st.received)/seconds)
+
+	printPercentiles("Push latency (ms):     ", models.NewPercentiles(st.pushMs))
+	printPercentiles("Delivery latency (ms): ", models.NewPercentiles(st.deliveryMs))
+
+	if len(st.pushErrors) > 0 {
+		fmt.Println("Push errors:")
+		for msg, count := range st.pushErrors {
+			fmt.Printf("  %6d  %s\n", count, msg)
+		}
+	}
+}
+
+// printPercentiles prints one latency distribution line.
+func printPercentiles(label string, p models.Percentiles) {
+	fmt.Printf("%sp50=%d p90=%d p99=%d max=%d\n", label, p.P50, p.P90, p.P99, p.Max)
+}
+
+// percentOf returns part as a percentage of total, or 0 when total is 0.
+func percentOf(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
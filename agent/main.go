@@ -10,16 +10,22 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/tmair/tailclip/shared/cli"
 	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/handlers"
+	"github.com/tmair/tailclip/shared/i18n"
+	"github.com/tmair/tailclip/shared/logging"
 	"github.com/tmair/tailclip/shared/models"
 )
 
@@ -32,48 +38,169 @@ const defaultConfigPath = "agent-config.json"
 // to avoid unnecessary lock contention on the cache mutex.
 const pruneInterval = 1 * time.Minute
 
+// Component loggers (see shared/logging).
+var (
+	agentLog     = logging.For("agent")
+	syncLog      = logging.For("sync")
+	clipboardLog = logging.For("clipboard")
+	filesLog     = logging.For("files")
+	historyLog   = logging.For("history")
+	journalLog   = logging.For("journal")
+	notifyLog    = logging.For("notify")
+)
+
 func main() {
-	// --- Step 1: Load configuration -------------------------------------------
-	// WHY load config first: The entire agent depends on knowing its device ID,
-	// hub URL, auth token, and polling interval. If any required field is missing,
-	// fail immediately with a clear message rather than panicking later.
+	// --- Step 0: Subcommands --------------------------------------------------
+	// WHY before config and log setup: Commands like `journal` print to the
+	// terminal and must work even when the config is broken.
+	// WHY cli.ExitCode: Scripts branch on the code (see shared/cli).
+	if handled, err := runAgentCommand(os.Args[1:]); handled {
+		if err != nil {
+			if !cli.Silent(err) {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			os.Exit(cli.ExitCode(err))
+		}
+		return
+	}
+
 	configPath := defaultConfigPath
 	if len(os.Args) > 1 {
 		// WHY allow CLI override: Useful for running multiple agent instances
 		// during development or testing different configurations.
 		configPath = os.Args[1]
 	}
+	runAgent(configPath)
+}
+
+// runAgent runs the agent with the config at configPath until it is told
+// to stop.
+// WHY separate from main: `agent run` starts it too (see commands.go).
+func runAgent(configPath string) {
+	// --- Step 1: Load configuration -------------------------------------------
+	// WHY load config first: The entire agent depends on knowing its device ID,
+	// hub URL, auth token, and polling interval. If any required field is missing,
+	// fail immediately with a clear message rather than panicking later.
 
 	// Set up persistent file logging
 	// WHY: Because Windows UI apps (built with -H=windowsgui) have no console,
 	// fatal errors would otherwise be invisible. Writing logs next to the config
 	// file provides a way to troubleshoot crashes.
 	logPath := filepath.Join(filepath.Dir(configPath), "agent.log")
+	var logOutput io.Writer = os.Stderr
 	if logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666); err == nil {
+		logOutput = logFile
 		log.SetOutput(logFile)
 		defer logFile.Close()
 	}
 
+	// WHY before loading: A config without a device_id would not load (see
+	// deviceid.go).
+	if err := ensureDeviceIdentity(configPath); err != nil {
+		agentLog.Fatalf("%v", err)
+	}
 	cfg, err := config.LoadAgentConfig(configPath)
 	if err != nil {
-		log.Fatalf("FATAL: failed to load agent config from %s: %v", configPath, err)
+		agentLog.Fatalf("failed to load agent config from %s: %v", configPath, err)
 	}
-	log.Printf("Agent config loaded: device=%s (%s), hub=%s",
+	// WHY after loading: Until then (including a config that fails to
+	// load) lines go to agent.log in the default format.
+	logging.Setup(logOutput, cfg.LogLevel, cfg.LogFormat)
+	agentLog.Infof("Agent config loaded: device=%s (%s), hub=%s",
 		cfg.DeviceID, cfg.DeviceName, cfg.HubURL)
 
+	// WHY right after config: The locale comes from config (or environment)
+	// and must be set before anything user-facing is displayed.
+	locale := i18n.Init(cfg.Locale)
+	agentLog.Infof("Using locale %s", locale)
+
+	// WHY before any clipboard access: Platform options (e.g., Win+V history
+	// mode) change how WriteClipboard behaves for the whole session.
+	configurePlatformClipboard(cfg)
+
 	// --- Step 2: Check if agent is enabled ------------------------------------
 	// WHY check early: If the user disabled the agent in config, exit cleanly
 	// instead of starting goroutines and network connections for nothing.
 	if !cfg.Enabled {
-		log.Printf("Agent is disabled in config. Exiting.")
+		agentLog.Infof("Agent is disabled in config. Exiting.")
 		return
 	}
 
 	// --- Step 3: Initialize syncer --------------------------------------------
 	// WHY create syncer before starting loops: Both the polling loop and
 	// WebSocket receiver need the syncer, so it must be ready first.
-	syncer := NewSyncer(cfg.HubURL, cfg.AuthToken, cfg.DeviceID)
-	log.Printf("Syncer initialized for hub %s", cfg.HubURL)
+	// WHY continue without a journal: It's a troubleshooting aid; an
+	// unwritable directory shouldn't stop sync.
+	journal, err := OpenJournal(journalPath(configPath))
+	if err != nil {
+		agentLog.Warnf("sync journal disabled: %v", err)
+	}
+	syncer := NewSyncer(cfg.HubURL, cfg.AuthToken, cfg.DeviceID, journal)
+	agentLog.Infof("Syncer initialized for hub %s", cfg.HubURL)
+	syncer.NotifyOnReceive(cfg.NotifyEnabled)
+	if len(cfg.AcceptFromDevices) > 0 {
+		syncer.AcceptOnlyFrom(cfg.AcceptFromDevices)
+		agentLog.Infof("Accepting clips only from: %s", strings.Join(cfg.AcceptFromDevices, ", "))
+	}
+	if cfg.ReceiveFiles {
+		syncer.ReceiveFilesInto(cfg.DownloadDir)
+		agentLog.Infof("Saving received files to %s", cfg.DownloadDir)
+	}
+	if key := cfg.GetEncryptionKey(); key != nil {
+		syncer.EncryptWith(key)
+		agentLog.Infof("End-to-end encryption enabled")
+	}
+	setUpSigning(syncer, configPath, cfg)
+	syncer.CompressAbove(cfg.CompressThreshold)
+	syncer.QueueOfflineUpTo(cfg.OfflineQueueSize)
+	syncer.DeferLargeWhileMetered(cfg.MeteredMaxSize)
+	syncer.DelaySendsBy(cfg.GetSendDelay(), cfg.NotifyEnabled)
+	if cfg.CatchUp {
+		syncer.CatchUpFrom(lastSeenPath(configPath))
+	}
+	if cfg.LocalHistory > 0 {
+		// WHY continue without it: Like the journal, the local history is
+		// a convenience; a machine without a keyring still syncs.
+		history, err := openAgentHistory(configPath, cfg)
+		if err != nil {
+			agentLog.Warnf("local history disabled: %v", err)
+		} else {
+			syncer.KeepHistoryIn(history)
+			go history.RunPruning()
+			agentLog.Infof("Keeping the last %d clips (up to %d days) in %s", cfg.LocalHistory, cfg.LocalHistoryDays, historyPath(configPath))
+			// WHY with the history: Same opt-in, same key (see pins.go).
+			syncer.KeepPinsIn(NewPinnedClips(pinsPath(configPath), history.key))
+		}
+	}
+	if proxy := cfg.GetProxy(); proxy != nil {
+		syncer.UseProxy(proxy)
+		// WHY Redacted: proxy_url may carry credentials.
+		agentLog.Infof("Using proxy %s for hub traffic", proxy.Redacted())
+	}
+	// WHY always: Without limits it still counts the traffic `agent status`
+	// reports.
+	syncer.LimitBandwidth(cfg.GetBandwidthLimits())
+	if cfg.MaxUploadKBPerSec > 0 || cfg.MaxDownloadKBPerSec > 0 {
+		agentLog.Infof("Limiting hub traffic to %s up, %s down", formatRate(cfg.MaxUploadKBPerSec), formatRate(cfg.MaxDownloadKBPerSec))
+	}
+
+	// WHY register but not fail on error: Registration only feeds hub-side
+	// device preferences and health info. Sync itself works without it, so
+	// an unreachable hub at startup shouldn't stop the agent.
+	if err := syncer.Register(cfg.DeviceName); err != nil {
+		agentLog.Warnf("device registration failed: %v", err)
+	}
+
+	// WHY before the receiver starts: The tray gives the syncer the list
+	// of recent clips it fills in (see tray.go).
+	var trayIcon *tray
+	if cfg.Tray {
+		trayIcon = startTray(syncer, cfg.NotifyEnabled)
+	}
+	// WHY defer Close: The socket file is removed with it, so `agent pause`
+	// finds no agent rather than a dead socket (see control.go).
+	control := startControl(syncer, configPath)
+	defer control.Close()
 
 	// --- Step 4: Set up graceful shutdown -------------------------------------
 	// WHY handle SIGINT and SIGTERM:
@@ -90,12 +217,27 @@ func main() {
 	// polling loop continue independently. The two paths are:
 	//   - Local clipboard → hub (polling loop below)
 	//   - Hub → local clipboard (WebSocket goroutine)
-	wsDone := make(chan struct{})
-	go func() {
-		defer close(wsDone)
-		connectAndReceive(syncer, cfg)
-	}()
-	log.Printf("WebSocket receiver started")
+	// WHY nil while waiting to reconnect: A closed wsDone would be ready on
+	// every pass of the loop below; reconnectTimer takes over until the
+	// next attempt starts.
+	var (
+		wsDone         chan struct{}
+		wsStarted      time.Time
+		reconnectTimer <-chan time.Time
+	)
+	backoff := newReconnectBackoff(cfg.GetReconnectMax())
+	startReceiver := func() {
+		reconnectTimer = nil
+		wsStarted = time.Now()
+		wsDone = make(chan struct{})
+		// WHY pass cfg: The loop below replaces it on a reload.
+		go func(done chan struct{}, cfg *config.AgentConfig) {
+			defer close(done)
+			connectAndReceive(syncer, cfg)
+		}(wsDone, cfg)
+	}
+	startReceiver()
+	agentLog.Infof("WebSocket receiver started")
 
 	// --- Step 6: Start clipboard polling loop ---------------------------------
 	// WHY a ticker-based loop:
@@ -113,7 +255,7 @@ func main() {
 	//   - Default 1000ms: Good balance for most users. Fast enough to feel
 	//     "instant" (human reaction time is ~200ms), slow enough to be
 	//     imperceptible on CPU monitors.
-	pollInterval := cfg.GetPollInterval()
+	pollInterval := currentPollInterval(syncer, cfg)
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
@@ -123,11 +265,50 @@ func main() {
 	// entire previous clipboard content in memory.
 	lastHash := GetClipboardHash()
 
+	// WHY a separate hash for PRIMARY: The two selections change independently.
+	// Sharing one lastHash would make every highlight look like a clipboard
+	// change and vice versa.
+	var lastPrimaryHash string
+	if primaryReader != nil {
+		lastPrimaryHash = hashText(primaryReader())
+	}
+
+	// WHY watch for wake-ups and network changes: See wake.go and
+	// network.go. reconnectNow skips the usual reconnect delay for a
+	// connection the agent dropped on purpose.
+	wake := watchWake()
+	networkChanged := watchNetwork(cfg.TailscaleCLI)
+	reconnectNow := false
+
+	// WHY nil when unset: A nil channel never fires (see pick.go).
+	hotkeyPressed := watchHistoryHotkey(cfg)
+
+	// WHY: See reload.go.
+	configChanged := watchConfig(configPath)
+
+	// WHY nil for metered "never": See metered.go.
+	meteredChanged := watchMetered(cfg.Metered)
+
 	// Prune timer for event cache cleanup.
 	pruneTicker := time.NewTicker(pruneInterval)
 	defer pruneTicker.Stop()
 
-	log.Printf("Clipboard polling started (interval: %s)", pollInterval)
+	// WHY stop the ticker while a watcher runs: Every change arrives on
+	// clipboardChanged, so polling would only cost CPU. If the watcher
+	// stops, its channel closes and polling resumes.
+	var clipboardChanged <-chan struct{}
+	if clipboardWatcher != nil {
+		clipboardChanged = clipboardWatcher()
+		ticker.Stop()
+	} else {
+		agentLog.Infof("Clipboard polling started (interval: %s)", pollInterval)
+	}
+	checkSelections := func() {
+		handleClipboardPoll(syncer, cfg, &lastHash, ReadClipboard, clipboardFileList, formatsReader)
+		if primaryReader != nil {
+			handleClipboardPoll(syncer, cfg, &lastPrimaryHash, primaryReader, nil, nil)
+		}
+	}
 
 	// --- Main event loop ------------------------------------------------------
 	// WHY select over multiple channels:
@@ -137,40 +318,170 @@ func main() {
 	for {
 		select {
 		case <-ticker.C:
-			handleClipboardPoll(syncer, cfg, &lastHash)
+			checkSelections()
+
+		case _, ok := <-clipboardChanged:
+			if !ok {
+				pollInterval = currentPollInterval(syncer, cfg)
+				agentLog.Infof("Clipboard watcher stopped; polling every %s instead", pollInterval)
+				clipboardChanged = nil
+				ticker.Reset(pollInterval)
+				continue
+			}
+			checkSelections()
 
 		case <-pruneTicker.C:
 			syncer.PruneCache()
 
+		case <-syncer.PresenceChanged():
+			// WHY poll right away when speeding up: A peer just came online;
+			// whatever was copied during the slow interval should reach it
+			// now rather than up to one idle interval later.
+			interval := currentPollInterval(syncer, cfg)
+			if interval == pollInterval || clipboardChanged != nil {
+				continue
+			}
+			agentLog.Infof("Clipboard polling interval changed to %s (peers online: %d)",
+				interval, syncer.PeersOnline())
+			if interval < pollInterval {
+				handleClipboardPoll(syncer, cfg, &lastHash, ReadClipboard, clipboardFileList, formatsReader)
+			}
+			pollInterval = interval
+			ticker.Reset(pollInterval)
+
+		case slept := <-wake:
+			agentLog.Infof("System resumed after ~%s asleep; reconnecting to hub now", slept.Round(time.Second))
+			reconnectNow = true
+			syncer.DropConnection()
+			// WHY also cut a pending backoff short: The failures it counted
+			// happened on the network the machine just left.
+			if reconnectTimer != nil {
+				backoff.reset()
+				startReceiver()
+			}
+
+		case <-networkChanged:
+			agentLog.Infof("Network changed; reconnecting to hub now")
+			reconnectNow = true
+			syncer.DropConnection()
+			if reconnectTimer != nil {
+				backoff.reset()
+				startReceiver()
+			}
+
+		case <-configChanged:
+			cfg = reloadConfig(syncer, cfg, configPath)
+			// WHY only the interval: The ticker is stopped while a watcher
+			// runs, and the watcher's end picks the interval up anyway.
+			if interval := currentPollInterval(syncer, cfg); interval != pollInterval {
+				pollInterval = interval
+				if clipboardChanged == nil {
+					agentLog.Infof("Clipboard polling interval changed to %s", pollInterval)
+					ticker.Reset(pollInterval)
+				}
+			}
+
+		case metered := <-meteredChanged:
+			syncer.SetMetered(metered)
+
 		case sig := <-sigChan:
-			log.Printf("Received signal %v, shutting down...", sig)
+			agentLog.Infof("Received signal %v, shutting down...", sig)
+			return
+
+		case _, ok := <-hotkeyPressed:
+			if !ok {
+				hotkeyPressed = nil
+				continue
+			}
+			// WHY a goroutine: The picker waits for the user; the loop
+			// must keep polling meanwhile.
+			go showHistoryPicker(syncer)
+
+		case <-trayIcon.Quit():
+			agentLog.Infof("Quit from the tray, shutting down...")
 			return
 
 		case <-wsDone:
 			// WHY restart on disconnect: WebSocket connections can drop due
 			// to network changes, hub restarts, or Tailscale reconnections.
-			// Rather than exiting, wait briefly and reconnect to maintain
-			// real-time sync.
-			log.Printf("WebSocket disconnected, reconnecting in 5s...")
-			time.Sleep(5 * time.Second)
-			wsDone = make(chan struct{})
-			go func() {
-				defer close(wsDone)
-				connectAndReceive(syncer, cfg)
-			}()
+			// Rather than exiting, wait (see backoff.go) and reconnect to
+			// maintain real-time sync.
+			// WHY not wait after a wake or network change: The connection
+			// was dropped on purpose, not because the hub is unreachable.
+			// WHY a timer instead of sleeping: Clipboard changes must keep
+			// reaching the hub's push endpoint while the socket is down.
+			wsDone = nil
+			if time.Since(wsStarted) >= stableConnection {
+				backoff.reset()
+			}
+			if reconnectNow {
+				reconnectNow = false
+				startReceiver()
+				continue
+			}
+			delay := backoff.next()
+			agentLog.Infof("WebSocket disconnected, reconnecting in %s...", delay.Round(100*time.Millisecond))
+			reconnectTimer = time.After(delay)
+
+		case <-reconnectTimer:
+			startReceiver()
 		}
 	}
 }
 
-// handleClipboardPoll checks if the clipboard has changed and pushes to hub.
+// currentPollInterval picks the poll interval for the current presence state.
+//
+// WHY slow down instead of pausing pushes: A clip copied while alone should
+// still reach the hub, so a device that comes online later (or checks
+// history) sees it. Polling less often saves nearly all of the battery cost
+// without losing that.
+func currentPollInterval(syncer *Syncer, cfg *config.AgentConfig) time.Duration {
+	if syncer.PeersOnline() == 0 {
+		return cfg.GetIdlePollInterval()
+	}
+	return cfg.GetPollInterval()
+}
+
+// handleClipboardPoll checks if a selection has changed and pushes to hub.
 //
 // WHY extract from the loop: Keeps the main select clean and makes the
 // polling logic testable independently.
-func handleClipboardPoll(syncer *Syncer, cfg *config.AgentConfig, lastHash *string) {
-	currentHash := GetClipboardHash()
+//
+// WHY take a read function: The same change-detection and loop-prevention
+// logic applies to both CLIPBOARD and the Linux PRIMARY selection; only the
+// source differs. readFiles is the platform file-list probe for that source,
+// or nil when the source can't hold files; readFormats likewise reads its
+// rich text versions, or is nil.
+func handleClipboardPoll(syncer *Syncer, cfg *config.AgentConfig, lastHash *string, read func() string,
+	readFiles func() []string, readFormats func() map[string]string) {
+	// WHY read once and hash locally: Reading again after detecting a change
+	// could return different content than the hash we just compared.
+	text := read()
+	currentHash := hashText(text)
+
+	// WHY probe for files even when text is empty: On Windows, a file copy
+	// in Explorer leaves no text format at all. The file list is hashed into
+	// lastHash so the same copy is only reported once.
+	if currentHash == "" {
+		if readFiles == nil {
+			return
+		}
+		files := readFiles()
+		if len(files) == 0 {
+			return
+		}
+		currentHash = hashText("files\n" + strings.Join(files, "\n"))
+		if currentHash != *lastHash {
+			*lastHash = currentHash
+			if !excludedSource(syncer, cfg, currentHash, 0) && !syncer.skipWhilePaused(currentHash, 0) {
+				pushFileList(syncer, cfg, currentHash, files)
+			}
+		}
+		return
+	}
 
 	// No change since last poll - nothing to do.
-	if currentHash == "" || currentHash == *lastHash {
+	if currentHash == *lastHash {
 		return
 	}
 
@@ -178,30 +489,134 @@ func handleClipboardPoll(syncer *Syncer, cfg *config.AgentConfig, lastHash *stri
 	// WHY before pushing: If PushToHub is slow or fails, we don't want
 	// the next poll to detect the same "change" again and retry immediately.
 	*lastHash = currentHash
+	syncer.journal.Record(JournalEntry{Action: journalDetected, Hash: currentHash, Size: len(text)})
 
 	// Check if this hash was recently synced FROM the hub.
 	// WHY: When ReceiveFromHub writes to the clipboard, the next poll will
 	// detect it as a "change". Without this check, we'd push it right back
 	// to the hub, creating a loop.
 	if syncer.IsEventCached(currentHash) {
+		syncer.journal.Record(JournalEntry{Action: journalSkipOwn, Hash: currentHash,
+			Detail: "content was just received from the hub"})
+		return
+	}
+
+	// WHY before anything else looks at the text: A local-only clip must
+	// not be sent, held, or even probed for files.
+	if stripped, ok := cfg.LocalOnly(text); ok {
+		keepLocal(syncer, lastHash, currentHash, stripped)
+		return
+	}
+
+	// WHY log the rule and not the text: The log is exactly where a
+	// blocked secret mustn't end up either.
+	if rule := cfg.Blocked(text); rule != "" {
+		agentLog.Warnf("Not sending clipboard change: it matches block_patterns entry %q", rule)
+		syncer.journal.Record(JournalEntry{Action: journalFiltered, Hash: currentHash, Size: len(text),
+			Detail: "block_patterns: " + rule})
+		return
+	}
+	if excludedSource(syncer, cfg, currentHash, len(text)) {
+		return
+	}
+
+	// WHY after updating lastHash: What was copied during a pause stays
+	// unsent after resuming; only the next copy goes out.
+	if syncer.skipWhilePaused(currentHash, len(text)) {
+		return
+	}
+
+	// Copied files must never sync as text - their local paths (or, on
+	// macOS, bare file names) are meaningless on other devices. The files
+	// themselves are sent instead.
+	// WHY only probe after a change: The probe may spawn a helper process,
+	// which is too expensive to run on every tick.
+	files := parseFileURIList(text)
+	if len(files) == 0 && readFiles != nil {
+		files = readFiles()
+	}
+	if len(files) > 0 {
+		pushFileList(syncer, cfg, currentHash, files)
 		return
 	}
 
-	// Read the actual clipboard text for the event payload.
-	text := ReadClipboard()
-	if text == "" {
+	// Apply the same content rules the hub enforces, with the negotiated
+	// size limit.
+	// WHY check locally: Uploading a clip the hub will reject wastes
+	// bandwidth and, worse, fails silently from the user's point of view.
+	if err := handlers.NewTextHandler(syncer.MaxTextLength()).Process(text); err != nil {
+		agentLog.Infof("Skipping clipboard change: %v", err)
+		syncer.journal.Record(JournalEntry{Action: journalFiltered, Hash: currentHash,
+			Size: len(text), Detail: err.Error()})
+		if errors.Is(err, handlers.ErrContentTooLarge) && cfg.NotifyEnabled {
+			ShowTooLargeNotification(len(text), syncer.MaxTextLength())
+		}
 		return
 	}
 
+	// Attach the rich text versions of the clip, if the platform has any.
+	// WHY send plain text when they don't fit: The text alone passed the
+	// checks above and is still worth syncing.
+	var formats map[string]string
+	if readFormats != nil {
+		formats = readFormats()
+		if err := handlers.NewRichTextHandler(syncer.MaxTextLength()).ProcessFormats(formats, len(text)); err != nil {
+			agentLog.Infof("Sending clipboard change as plain text only: %v", err)
+			formats = nil
+		}
+	}
+
 	event := &models.Event{
-		EventID:        uuid.New().String(),
+		EventID:        newEventID(cfg.EventIDScheme),
 		SourceDeviceID: cfg.DeviceID,
 		Timestamp:      time.Now().UTC(),
 		ContentType:    "text",
 		Text:           text,
+		Formats:        formats,
+		Channel:        cfg.Channel,
 	}
 	event.SetTextHash()
 
+	// WHY stamp the expiry on the sender: Receivers can't recognize a
+	// secret on their own - only this device's patterns say it is one.
+	if cfg.IsSensitive(text) {
+		event.ExpiresAt = event.Timestamp.Add(cfg.GetSensitiveTTL())
+		agentLog.Infof("Clipboard change matches sensitive_patterns; sending as transient (expires in %s)", cfg.GetSensitiveTTL())
+	}
+
+	// WHY hold after the checks: A clip that would be filtered anyway
+	// shouldn't announce that it is about to be sent.
+	if syncer.holdClip(event, func() { pushClip(syncer, event, currentHash) }) {
+		return
+	}
+	pushClip(syncer, event, currentHash)
+}
+
+// keepLocal handles a copy marked with local_only_prefix: it is journaled
+// and never sent, and the clipboard gets the text without the prefix.
+// WHY only rewrite the clipboard if it still holds the clip: The copy may
+// have come from the PRIMARY selection, or the user copied again since.
+// WHY cache the stripped text: The rewrite is a clipboard change like any
+// other; the cache keeps every selection's poll from sending it.
+func keepLocal(syncer *Syncer, lastHash *string, hash, stripped string) {
+	agentLog.Infof("Keeping clipboard change local: it starts with local_only_prefix")
+	syncer.journal.Record(JournalEntry{Action: journalFiltered, Hash: hash, Size: len(stripped),
+		Detail: "local_only_prefix: kept on this device"})
+	if hashText(ReadClipboard()) != hash {
+		return
+	}
+	strippedHash := hashText(stripped)
+	syncer.CacheEvent(strippedHash)
+	if err := WriteClipboard(stripped); err != nil {
+		clipboardLog.Errorf("failed to remove local_only_prefix from the clipboard: %v", err)
+		return
+	}
+	*lastHash = strippedHash
+}
+
+// pushClip pushes a copied clip (or queues it while the hub is away) and
+// journals the outcome.
+func pushClip(syncer *Syncer, event *models.Event, hash string) {
 	// Cache both the event ID and the text hash.
 	// WHY cache text hash: When the hub broadcasts this event back and
 	// ReceiveFromHub writes to clipboard, the poll loop will see a "new"
@@ -209,9 +624,22 @@ func handleClipboardPoll(syncer *Syncer, cfg *config.AgentConfig, lastHash *stri
 	syncer.CacheEvent(event.EventID)
 	syncer.CacheEvent(event.TextHash)
 
-	if err := syncer.PushToHub(event); err != nil {
-		log.Printf("ERROR: failed to push to hub: %v", err)
+	if syncer.deferWhileMetered(event) {
+		return
 	}
+	queued, err := syncer.PushOrQueue(event)
+	if queued {
+		return
+	}
+	if err != nil {
+		agentLog.Errorf("failed to push to hub: %v", err)
+		syncer.journal.Record(JournalEntry{Action: journalFailed, EventID: event.EventID,
+			Hash: hash, Size: len(event.Text), Detail: err.Error()})
+		return
+	}
+	syncer.journal.Record(JournalEntry{Action: journalPushed, EventID: event.EventID,
+		Hash: hash, Size: len(event.Text)})
+	syncer.keepInHistory(event)
 }
 
 // connectAndReceive establishes a WebSocket connection and starts receiving.
@@ -219,12 +647,29 @@ func handleClipboardPoll(syncer *Syncer, cfg *config.AgentConfig, lastHash *stri
 // WHY a helper function: Encapsulates the connect-then-receive pattern so
 // the reconnection logic in the main loop can call it cleanly.
 func connectAndReceive(syncer *Syncer, cfg *config.AgentConfig) {
-	conn, err := syncer.ConnectWebSocket()
+	// WHY renegotiate on every connect: The hub may have restarted with a
+	// different max_text_length since we last talked to it.
+	syncer.NegotiateCapabilities(cfg.MaxTextLength, cfg.MaxFileSize)
+
+	// WHY retry a failed registration here: A hub with
+	// require_registered_devices refuses the connection below until this
+	// device is registered, and the hub may have been down at startup.
+	if !syncer.Registered() {
+		if err := syncer.Register(cfg.DeviceName); err != nil {
+			agentLog.Warnf("device registration failed: %v", err)
+		}
+	}
+
+	// WHY before subscribing: Clips copied while the hub was away are older
+	// than anything the new connection will bring.
+	syncer.FlushQueue()
+
+	conn, err := syncer.ConnectWebSocket(cfg.Channels)
 	if err != nil {
-		log.Printf("ERROR: WebSocket connection failed: %v", err)
+		agentLog.Errorf("WebSocket connection failed: %v", err)
 		return
 	}
 	// Log connection details for debugging
 	_ = fmt.Sprintf("Connected to %s", cfg.HubURL)
-	syncer.ReceiveFromHub(conn, cfg.NotifyEnabled)
+	syncer.ReceiveFromHub(conn)
 }
@@ -0,0 +1,224 @@
+// Author: Toluwalase Mebaanne
+// Package main provides metered-connection awareness for the TailClip agent.
+//
+// WHY hold large clips on a metered connection:
+// A laptop tethered to a phone looks like any other network to sync, and
+// a few screenshots and files copied over an afternoon can use up a data
+// plan. On a metered connection clips up to metered_max_size still sync at
+// once, so text keeps flowing; larger ones wait, in the order they were
+// copied, and go out once the connection is unmetered again.
+//
+// WHY ask the OS instead of guessing from the interface:
+// Whether a network costs money is a user setting on Windows (and set by
+// the carrier for mobile broadband) and a connection property in
+// NetworkManager; a Wi-Fi interface can be a phone's hotspot. Where the OS
+// can't say (macOS, Linux without NetworkManager), the connection counts as
+// unmetered unless metered is "always".
+//
+// WHY in memory, like the offline queue:
+// Writing clip content to disk would bypass local_history's opt-in. Clips
+// still waiting when the agent stops are not sent; the journal shows them
+// as queued and never pushed.
+
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// meteredCheckInterval is how often the agent asks whether the connection
+// is metered.
+// WHY not more often: On Windows each check starts PowerShell, and a
+// large clip waiting half a minute longer costs nothing.
+const meteredCheckInterval = 30 * time.Second
+
+// meteredCheckTimeout bounds a single check.
+const meteredCheckTimeout = 10 * time.Second
+
+// meteredQueueSize is how many large clips wait for an unmetered
+// connection at most; the oldest is dropped beyond that.
+const meteredQueueSize = 10
+
+// meteredQueue holds the large clips copied on a metered connection.
+type meteredQueue struct {
+	mu      sync.Mutex
+	maxSize int
+	metered bool
+	events  []*models.Event
+	// sending is set while the held clips are being pushed after the
+	// connection became unmetered.
+	sending bool
+}
+
+// DeferLargeWhileMetered holds clips larger than maxSize bytes (as sent)
+// while SetMetered says the connection is metered.
+func (s *Syncer) DeferLargeWhileMetered(maxSize int) {
+	s.meteredHeld = &meteredQueue{maxSize: maxSize}
+}
+
+// Metered reports whether the syncer is holding large clips back, and how
+// many are waiting.
+func (s *Syncer) Metered() (metered bool, waiting int) {
+	if s.meteredHeld == nil {
+		return false, 0
+	}
+	s.meteredHeld.mu.Lock()
+	defer s.meteredHeld.mu.Unlock()
+	return s.meteredHeld.metered, len(s.meteredHeld.events)
+}
+
+// SetMetered records whether the connection is metered. Once it isn't,
+// the clips held back are pushed in the background, oldest first.
+// WHY in the background: Under an upload limit, or with the hub away and no
+// offline queue, pushing ten large clips takes minutes. SetMetered is
+// called from the agent's main loop, which must keep polling the clipboard
+// and handling signals meanwhile.
+func (s *Syncer) SetMetered(metered bool) {
+	q := s.meteredHeld
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.metered == metered {
+		return
+	}
+	q.metered = metered
+
+	if metered {
+		syncLog.Infof("Connection is metered; holding clips over %s until it isn't", formatBytes(q.maxSize))
+		return
+	}
+	syncLog.Infof("Connection is no longer metered; sending %d held clip(s)", len(q.events))
+	if !q.sending && len(q.events) > 0 {
+		q.sending = true
+		go s.sendHeld()
+	}
+}
+
+// sendHeld pushes the held clips one at a time, oldest first, until none
+// are left or the connection is metered again.
+// WHY take one clip at a time: Large clips copied meanwhile queue up behind
+// the held ones (see deferWhileMetered), so they can't overtake them.
+func (s *Syncer) sendHeld() {
+	q := s.meteredHeld
+	for {
+		q.mu.Lock()
+		if q.metered || len(q.events) == 0 {
+			q.sending = false
+			q.mu.Unlock()
+			return
+		}
+		event := q.events[0]
+		q.events = q.events[1:]
+		q.mu.Unlock()
+
+		s.sendHeldEvent(event)
+	}
+}
+
+// sendHeldEvent pushes one held clip and journals what became of it.
+func (s *Syncer) sendHeldEvent(event *models.Event) {
+	// WHY drop expired transient clips: As in the offline queue, they
+	// would be cleared from the receiving clipboards on arrival.
+	if event.IsTransient() && time.Now().After(event.ExpiresAt) {
+		s.journal.Record(JournalEntry{Action: journalFailed, EventID: event.EventID, Hash: event.TextHash,
+			Size: len(event.Text), Detail: "transient clip expired while the connection was metered"})
+		return
+	}
+	queued, err := s.PushOrQueue(event)
+	switch {
+	case queued:
+	case err != nil:
+		syncLog.Errorf("failed to push held event %s: %v", event.EventID, err)
+		s.journal.Record(JournalEntry{Action: journalFailed, EventID: event.EventID, Hash: event.TextHash,
+			Size: len(event.Text), Detail: err.Error()})
+	default:
+		s.journal.Record(JournalEntry{Action: journalPushed, EventID: event.EventID, Hash: event.TextHash,
+			Size: len(event.Text), Detail: "held while the connection was metered"})
+		if event.ContentType != models.ContentTypeFile {
+			s.keepInHistory(event)
+		}
+	}
+}
+
+// deferWhileMetered holds event if it is too large to send now - because
+// the connection is metered, or held clips are still being sent - and
+// reports whether it did.
+func (s *Syncer) deferWhileMetered(event *models.Event) bool {
+	q := s.meteredHeld
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.metered && !q.sending || len(event.Text) <= q.maxSize {
+		return false
+	}
+	// WHY replace a held copy of the same content: As in the offline
+	// queue, it should arrive once, in its latest position.
+	q.events = slices.DeleteFunc(q.events, func(held *models.Event) bool {
+		return held.TextHash == event.TextHash
+	})
+	if len(q.events) >= meteredQueueSize {
+		dropped := q.events[0]
+		q.events = q.events[1:]
+		syncLog.Warnf("%d clips are already waiting for an unmetered connection, dropping the oldest: event %s",
+			meteredQueueSize, dropped.EventID)
+		s.journal.Record(JournalEntry{Action: journalFailed, EventID: dropped.EventID, Hash: dropped.TextHash,
+			Size: len(dropped.Text), Detail: "dropped from the full metered queue"})
+	}
+	q.events = append(q.events, event)
+	if !q.metered {
+		syncLog.Infof("Sending event %s (%s) after the clips held while metered", event.EventID, formatBytes(len(event.Text)))
+		s.journal.Record(JournalEntry{Action: journalQueued, EventID: event.EventID, Hash: event.TextHash,
+			Size: len(event.Text), Detail: "waiting behind clips held while metered"})
+		return true
+	}
+	syncLog.Infof("Holding event %s (%s) until the connection is unmetered", event.EventID, formatBytes(len(event.Text)))
+	s.journal.Record(JournalEntry{Action: journalQueued, EventID: event.EventID, Hash: event.TextHash,
+		Size: len(event.Text), Detail: "metered connection"})
+	return true
+}
+
+// watchMetered reports on the returned channel whether the connection is
+// metered, according to mode (see config.AgentConfig.Metered): once at
+// the start, then on every change. "never" returns nil.
+func watchMetered(mode string) <-chan bool {
+	switch mode {
+	case config.MeteredNever:
+		return nil
+	case config.MeteredAlways:
+		always := make(chan bool, 1)
+		always <- true
+		return always
+	}
+	// WHY buffered with size 1 and replacing: Unlike a wake, only the
+	// latest state matters.
+	changed := make(chan bool, 1)
+	report := func(metered bool) {
+		select {
+		case <-changed:
+		default:
+		}
+		changed <- metered
+	}
+	go func() {
+		ticker := time.NewTicker(meteredCheckInterval)
+		defer ticker.Stop()
+		last := connectionMetered()
+		report(last)
+		for range ticker.C {
+			if current := connectionMetered(); current != last {
+				last = current
+				report(current)
+			}
+		}
+	}()
+	return changed
+}
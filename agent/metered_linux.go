@@ -0,0 +1,34 @@
+// Author: Toluwalase Mebaanne
+// Package main provides metered-connection detection on Linux.
+
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// NetworkManager's NMMetered values that mean metered: yes and guess-yes.
+// WHY the guesses too: NetworkManager guesses "yes" for mobile broadband
+// and for Wi-Fi hotspots that say they are a phone's, which is the case
+// this exists for.
+var nmMetered = map[string]bool{"1": true, "3": true}
+
+// connectionMetered asks NetworkManager, over D-Bus with busctl, whether
+// the primary connection is metered. Without NetworkManager (or busctl) it
+// reports false.
+func connectionMetered() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), meteredCheckTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "busctl", "get-property", "org.freedesktop.NetworkManager",
+		"/org/freedesktop/NetworkManager", "org.freedesktop.NetworkManager", "Metered").Output()
+	if err != nil {
+		return false
+	}
+	// WHY the last field: busctl prints the type first, e.g. "u 1".
+	fields := strings.Fields(string(out))
+	return len(fields) == 2 && nmMetered[fields[1]]
+}
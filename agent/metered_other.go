@@ -0,0 +1,12 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the fallback for platforms without metered-connection
+// detection, macOS among them.
+
+//go:build !windows && !linux
+
+package main
+
+// connectionMetered can't tell, so only metered "always" holds large clips.
+// WHY not macOS's Low Data Mode: It is only exposed to Network framework
+// path monitors, which need cgo.
+func connectionMetered() bool { return false }
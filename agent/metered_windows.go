@@ -0,0 +1,40 @@
+// Author: Toluwalase Mebaanne
+// Package main provides metered-connection detection on Windows.
+
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// meteredScript prints the cost type of the internet connection profile:
+// Unrestricted, Fixed, Variable, or Unknown; nothing when offline.
+// WHY PowerShell: The connection cost is only exposed through WinRT
+// (Windows.Networking.Connectivity), which PowerShell can call and Go
+// can't without cgo.
+const meteredScript = `$p = [Windows.Networking.Connectivity.NetworkInformation, Windows.Networking.Connectivity, ContentType = WindowsRuntime]::GetInternetConnectionProfile()
+if ($p) { $p.GetConnectionCost().NetworkCostType }`
+
+// connectionMetered reports whether Windows considers the internet
+// connection metered: a cellular connection, or one the user set as
+// metered in Settings.
+func connectionMetered() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), meteredCheckTimeout)
+	defer cancel()
+	script := powerShell(meteredScript)
+	cmd := exec.CommandContext(ctx, script.Path, script.Args[1:]...)
+	hideConsoleWindow(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	switch strings.TrimSpace(string(out)) {
+	case "Fixed", "Variable":
+		return true
+	}
+	return false
+}
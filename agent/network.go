@@ -0,0 +1,125 @@
+// Author: Toluwalase Mebaanne
+// Package main provides network change detection for the TailClip agent.
+//
+// WHY watch the network:
+// When a laptop moves from Wi-Fi to LTE, or the user toggles an exit node,
+// the path to the hub changes underneath the WebSocket. The old connection
+// usually doesn't fail - it goes silent until TCP gives up minutes later.
+// Reconnecting as soon as the network changes keeps sync working through
+// the switch, and the resumed hub session replays anything sent meanwhile.
+//
+// WHY poll instead of subscribing: Interface change notifications are
+// different on every OS (netlink, route sockets, NotifyIpInterfaceChange),
+// and the Tailscale LocalAPI speaks over a platform-specific socket with its
+// own permissions. Comparing a fingerprint of the local addresses and
+// `tailscale status` every few seconds works the same everywhere.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// networkCheckInterval is how often the agent fingerprints the network.
+const networkCheckInterval = 10 * time.Second
+
+// tailscaleStatusTimeout bounds a single `tailscale status` invocation.
+const tailscaleStatusTimeout = 5 * time.Second
+
+// tailscaleStatus is the part of `tailscale status --json` output that
+// describes this node's path into the tailnet.
+type tailscaleStatus struct {
+	BackendState   string `json:"BackendState"`
+	ExitNodeStatus *struct {
+		ID string `json:"ID"`
+	} `json:"ExitNodeStatus"`
+}
+
+// watchNetwork reports on the returned channel whenever the network
+// fingerprint changes. tailscaleCLI may be empty to only watch interfaces.
+// WHY buffered with size 1: Like watchWake - a burst of changes during a
+// handover collapses into one reconnect.
+func watchNetwork(tailscaleCLI string) <-chan string {
+	changed := make(chan string, 1)
+	go func() {
+		ticker := time.NewTicker(networkCheckInterval)
+		defer ticker.Stop()
+
+		last := networkFingerprint(tailscaleCLI)
+		for range ticker.C {
+			current := networkFingerprint(tailscaleCLI)
+			if current == last {
+				continue
+			}
+			last = current
+			select {
+			case changed <- current:
+			default:
+			}
+		}
+	}()
+	return changed
+}
+
+// networkFingerprint summarizes the local network: the addresses of every
+// interface that is up, plus Tailscale's state and exit node.
+// WHY addresses rather than interface names: Switching Wi-Fi networks keeps
+// the interface but changes its address.
+func networkFingerprint(tailscaleCLI string) string {
+	var parts []string
+	if ifaces, err := net.Interfaces(); err == nil {
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+				continue
+			}
+			addrs, err := iface.Addrs()
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				parts = append(parts, iface.Name+"="+addr.String())
+			}
+		}
+	}
+	// WHY sorted: Interface order isn't guaranteed to be stable.
+	slices.Sort(parts)
+
+	if status := readTailscaleStatus(tailscaleCLI); status != nil {
+		parts = append(parts, "tailscale="+status.BackendState)
+		if status.ExitNodeStatus != nil {
+			parts = append(parts, "exit-node="+status.ExitNodeStatus.ID)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// readTailscaleStatus runs `tailscale status --json`, or returns nil when
+// the CLI is not configured, not installed, or fails.
+// WHY nil instead of an error: Tailscale may legitimately be managed in a
+// way the CLI can't reach (e.g., a sandboxed app store build). Interface
+// monitoring still works without it.
+func readTailscaleStatus(cli string) *tailscaleStatus {
+	if cli == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tailscaleStatusTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, cli, "status", "--json")
+	hideConsoleWindow(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	var status tailscaleStatus
+	if err := json.Unmarshal(out, &status); err != nil {
+		return nil
+	}
+	return &status
+}
@@ -16,31 +16,40 @@
 // is checked by the caller (main.go/sync.go), not here, to keep this package
 // focused on the notification itself.
 //
-// WHY github.com/gen2brain/beeep:
-// Native notification APIs are OS-specific (NSUserNotificationCenter on macOS,
-// libnotify/D-Bus on Linux, WinToast on Windows). beeep provides a single
-// cross-platform Go API that maps to the correct native mechanism on each OS,
-// keeping TailClip's codebase free of build tags and platform-specific code.
-
-//go:build !windows
+// WHY platform files:
+// Message wording lives here; delivery lives in sendNotification, implemented
+// per platform. Linux uses beeep (notifications_other.go), while Windows
+// (notifications_windows.go) and macOS (notifications_darwin.go) have their
+// own files so notifications carry a proper TailClip app identity.
 
 package main
 
 import (
-	"log"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
 
-	"github.com/gen2brain/beeep"
+	"github.com/tmair/tailclip/shared/i18n"
 )
 
-// appName is the title shown in notification popups.
-// WHY a constant: Ensures consistent branding across all notifications
-// and provides a single place to update the app name if it changes.
-const appName = "TailClip"
+// notificationsMuted silences notifications for the rest of the session.
+// WHY separate from notify_enabled: The tray's toggle (see tray.go) is a
+// "not now" that shouldn't rewrite the user's config.
+var notificationsMuted atomic.Bool
+
+// deliverNotification sends a notification unless they are muted.
+func deliverNotification(title, body, contentType string) {
+	if notificationsMuted.Load() {
+		return
+	}
+	sendNotification(title, body, contentType)
+}
 
 // ShowNotification displays a desktop notification when clipboard content
 // arrives from another device.
 //
-// WHY accept sourceDevice and textPreview as parameters:
+// WHY accept sourceDevice, contentType, and textPreview as parameters:
 // The caller (ReceiveFromHub in sync.go) controls what information is shown.
 // This function doesn't need to know about Event structs or config - it just
 // displays the formatted message. This separation keeps notifications testable
@@ -54,18 +63,99 @@ const appName = "TailClip"
 // WHY log errors but don't return them:
 // Notification failures are non-critical - the clipboard sync still worked.
 // Crashing or complicating the caller's error handling for a failed toast
-// notification would be disproportionate. We log for debugging and move on.
-func ShowNotification(sourceDevice, textPreview string) {
-	title := appName + " - Clipboard Synced"
-	body := "From " + sourceDevice + ":\n" + textPreview
+// notification would be disproportionate. Platform senders log for debugging
+// and move on.
+func ShowNotification(sourceDevice, contentType, textPreview string) {
+	title := i18n.T("notify.synced.title")
+	body := i18n.T("notify.synced.body", sourceDevice, textPreview)
+	deliverNotification(title, body, contentType)
+}
+
+// ShowFilesSkippedNotification tells the user that copied files were not
+// synced. limit is the file size limit, or 0 when the hub can't take files.
+// WHY notify at all: Without feedback, copying a file and pasting on another
+// device silently does nothing - users assume TailClip is broken.
+func ShowFilesSkippedNotification(files []string, limit int) {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, fileBaseName(file))
+	}
+	title := i18n.T("notify.files_skipped.title")
+	body := i18n.T("notify.files_skipped.body", strings.Join(names, ", "))
+	if limit > 0 {
+		body = i18n.T("notify.files_skipped.limit_body", formatBytes(limit), strings.Join(names, ", "))
+	}
+	deliverNotification(title, body, "file")
+}
+
+// ShowFileReceivedNotification tells the user a file from another device
+// was saved, and where.
+// WHY name the folder: Unlike text, a file doesn't appear where the user
+// pastes - they need to know where to look.
+func ShowFileReceivedNotification(sourceDevice, fileName, dir string) {
+	title := i18n.T("notify.file_received.title")
+	body := i18n.T("notify.file_received.body", sourceDevice, fileName, dir)
+	deliverNotification(title, body, "file")
+}
+
+// ShowTooLargeNotification tells the user a clip exceeded the size limit.
+// WHY: A skipped clip otherwise looks exactly like a sync failure.
+func ShowTooLargeNotification(size, limit int) {
+	title := i18n.T("notify.too_large.title")
+	body := i18n.T("notify.too_large.body", formatBytes(size), formatBytes(limit))
+	deliverNotification(title, body, "text")
+}
+
+// ShowHubAlertNotification shows a message the hub sent for the user.
+// WHY the hub's wording is shown as-is: Alerts describe hub-side state the
+// agent knows nothing about.
+func ShowHubAlertNotification(message string) {
+	title := i18n.T("notify.hub_alert.title")
+	deliverNotification(title, message, "text")
+}
+
+// ShowAnnouncementNotification shows a message the hub's operator sent to
+// the devices.
+func ShowAnnouncementNotification(message string) {
+	title := i18n.T("notify.announcement.title")
+	deliverNotification(title, message, "text")
+}
+
+// ShowHeldNotification tells the user a copied clip is held for the send
+// delay, offering to cancel it. It blocks until the delay has passed and
+// reports whether the user canceled.
+// WHY the button depends on the platform: Reporting a click back needs
+// notify-send with actions (Linux) or alerter (macOS); elsewhere the
+// notification only says how to replace the clip (see delay.go).
+func ShowHeldNotification(delay time.Duration) bool {
+	if notificationsMuted.Load() {
+		return false
+	}
+	title := i18n.T("notify.held.title")
+	body := i18n.T("notify.held.body", delay)
+	return sendActionNotification(title, body, i18n.T("notify.held.cancel"), "text", delay)
+}
+
+// formatBytes renders a byte count for humans (e.g., "1.5 MB").
+func formatBytes(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := unit, 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
 
-	// beeep.Notify sends a native desktop notification.
-	// WHY empty string for icon path: Uses the system default notification
-	// icon. We can add a custom TailClip icon later without changing the API.
-	if err := beeep.Notify(title, body, ""); err != nil {
-		// WHY log instead of propagate: Notification failure should never
-		// interrupt clipboard sync. The sync itself already succeeded by
-		// the time we get here.
-		log.Printf("WARN: failed to show notification: %v", err)
+// fileBaseName returns the last path element for both / and \ separators.
+// WHY not filepath.Base: Paths may come from another OS's conventions
+// (e.g., a Windows path inside a URI list read on Linux).
+func fileBaseName(path string) string {
+	if i := strings.LastIndexAny(path, `/\`); i >= 0 && i < len(path)-1 {
+		return path[i+1:]
 	}
+	return path
 }
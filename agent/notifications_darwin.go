@@ -0,0 +1,96 @@
+// Author: Toluwalase Mebaanne
+// Package main provides macOS Notification Center support for the TailClip agent.
+//
+// WHY a darwin-specific path:
+// On macOS, beeep delivers notifications through osascript, so they appear as
+// coming from "Script Editor". Users can't find TailClip in System Settings >
+// Notifications to change its banner style, and clicking a notification opens
+// Script Editor. terminal-notifier can post on behalf of a real bundle
+// identifier, giving TailClip its own entry in Notification Center.
+//
+// WHY terminal-notifier instead of UNUserNotificationCenter via cgo:
+// UNUserNotificationCenter only works from inside a signed .app bundle, and
+// cgo would break the cross-compiled arm64 builds in installer/build-dmg.sh.
+// terminal-notifier is a single Homebrew install and keeps the agent pure Go.
+// When it's missing we fall back to beeep so notifications still work.
+//
+// WHY alerter for buttons: terminal-notifier 2.0 dropped action buttons.
+// alerter, a fork of it, keeps them and prints the one clicked.
+
+//go:build darwin
+
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gen2brain/beeep"
+)
+
+// notificationBundleID is the app identity notifications are posted under.
+// WHY this value: It matches the TailClip.app identity bundle created by
+// installer/build-dmg.sh, so System Settings lists notifications as "TailClip".
+const notificationBundleID = "com.tailclip.agent"
+
+// notificationGroup collapses TailClip notifications into a single entry.
+// WHY: Rapid syncs would otherwise stack dozens of banners - only the latest
+// clipboard content is relevant anyway.
+const notificationGroup = "tailclip"
+
+// sendNotification delivers a notification through Notification Center.
+func sendNotification(title, body, contentType string) {
+	notifier, err := exec.LookPath("terminal-notifier")
+	if err != nil {
+		// WHY fall back instead of failing: terminal-notifier is optional.
+		// An osascript notification is still better than none.
+		if err := beeep.Notify(title, body, iconPath(contentType)); err != nil {
+			notifyLog.Warnf("failed to show notification: %v", err)
+		}
+		return
+	}
+
+	args := []string{
+		"-title", title,
+		"-message", body,
+		"-group", notificationGroup,
+		"-sender", notificationBundleID,
+	}
+	// WHY -contentImage rather than -appIcon: -appIcon is ignored when
+	// -sender is set on recent macOS, while -contentImage still shows the
+	// per-content-type artwork alongside the app identity.
+	if icon := iconPath(contentType); icon != "" {
+		args = append(args, "-contentImage", icon)
+	}
+
+	if out, err := exec.Command(notifier, args...).CombinedOutput(); err != nil {
+		notifyLog.Warnf("terminal-notifier failed: %v (%s)", err, out)
+	}
+}
+
+// sendActionNotification shows a notification with one button for timeout
+// and reports whether the button was clicked. Without alerter it shows a
+// plain notification and reports false.
+func sendActionNotification(title, body, action, contentType string, timeout time.Duration) bool {
+	alerter, err := exec.LookPath("alerter")
+	if err != nil {
+		sendNotification(title, body, contentType)
+		return false
+	}
+	// alerter prints the clicked button's label, or @TIMEOUT, @CLOSED, ...
+	out, err := exec.Command(alerter,
+		"-title", title,
+		"-message", body,
+		"-actions", action,
+		"-timeout", strconv.Itoa(max(int(timeout.Seconds()), 1)),
+		"-group", notificationGroup,
+		"-sender", notificationBundleID,
+	).Output()
+	if err != nil {
+		notifyLog.Warnf("alerter failed: %v", err)
+		return false
+	}
+	return strings.TrimSpace(string(out)) == action
+}
@@ -0,0 +1,78 @@
+// Author: Toluwalase Mebaanne
+// Package main provides beeep-based notification delivery for the TailClip agent.
+//
+// WHY github.com/gen2brain/beeep:
+// On Linux and BSDs, notifications go through libnotify/D-Bus. beeep wraps
+// that (with a notify-send fallback) behind a single Go call.
+//
+// WHY notify-send for buttons: beeep can't report which button was clicked.
+// notify-send from libnotify 0.7.10 on can (--action with --wait).
+
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gen2brain/beeep"
+)
+
+// sendNotification delivers a notification through beeep.
+// WHY a per-content-type icon: Lets the user tell at a glance whether
+// text, an image, or a file just arrived (see icons.go).
+func sendNotification(title, body, contentType string) {
+	if err := beeep.Notify(title, body, iconPath(contentType)); err != nil {
+		// WHY log instead of propagate: Notification failure should never
+		// interrupt clipboard sync.
+		notifyLog.Warnf("failed to show notification: %v", err)
+	}
+}
+
+// notifySendActionKey identifies the button in notify-send's output.
+const notifySendActionKey = "tailclip-action"
+
+// notifySendActions reports whether the installed notify-send supports
+// buttons. Checked once; the answer doesn't change while the agent runs.
+var notifySendActions = sync.OnceValue(func() bool {
+	out, err := exec.Command("notify-send", "--help").Output()
+	return err == nil && bytes.Contains(out, []byte("--action"))
+})
+
+// sendActionNotification shows a notification with one button for timeout
+// and reports whether the button was clicked. Without notify-send actions
+// it shows a plain notification and reports false.
+func sendActionNotification(title, body, action, contentType string, timeout time.Duration) bool {
+	if !notifySendActions() {
+		sendNotification(title, body, contentType)
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	args := []string{
+		"--app-name=TailClip",
+		"--wait",
+		"--expire-time=" + strconv.FormatInt(timeout.Milliseconds(), 10),
+		"--action=" + notifySendActionKey + "=" + action,
+	}
+	if icon := iconPath(contentType); icon != "" {
+		args = append(args, "--icon="+icon)
+	}
+	args = append(args, title, body)
+	out, err := exec.CommandContext(ctx, "notify-send", args...).Output()
+	if err != nil {
+		// WHY quiet on timeout: Killing notify-send when the delay is over
+		// is how an unanswered notification ends.
+		if ctx.Err() == nil {
+			notifyLog.Warnf("notify-send failed: %v", err)
+		}
+		return false
+	}
+	return strings.TrimSpace(string(out)) == notifySendActionKey
+}
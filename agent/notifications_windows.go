@@ -1,27 +1,33 @@
 //go:build windows
+
 package main
 
 import (
-	"log"
+	"time"
 
 	"gopkg.in/toast.v1"
 )
 
-// ShowNotification displays a desktop notification when clipboard content
-// arrives from another device.
-func ShowNotification(sourceDevice, textPreview string) {
-	title := "TailClip - Clipboard Synced"
-	body := "From " + sourceDevice + ":\n" + textPreview
-
+// sendNotification delivers a Windows toast notification.
+func sendNotification(title, body, contentType string) {
 	notification := toast.Notification{
 		AppID:   "TailClip",
 		Title:   title,
 		Message: body,
-		Icon:    "",
+		Icon:    iconPath(contentType),
 		Actions: nil,
 	}
 
 	if err := notification.Push(); err != nil {
-		log.Printf("WARN: failed to show notification: %v", err)
+		notifyLog.Warnf("failed to show notification: %v", err)
 	}
 }
+
+// sendActionNotification shows a plain toast and reports false; the
+// button can't be offered.
+// WHY no button: A toast button activates a protocol URL or a COM server,
+// which the agent would have to register and receive in a second process.
+func sendActionNotification(title, body, action, contentType string, timeout time.Duration) bool {
+	sendNotification(title, body, contentType)
+	return false
+}
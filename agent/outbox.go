@@ -0,0 +1,199 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the agent's queue of clips waiting for the hub.
+//
+// WHY queue failed pushes:
+// A clip copied while the hub is unreachable - on a train, while the hub
+// machine reboots - used to be lost: the poll loop had already moved on to
+// its hash. Queued clips are pushed, in the order they were copied, as soon
+// as the hub answers again.
+//
+// WHY only connection failures and 5xx:
+// A refusal (too large, throttled, device disabled) would be refused again;
+// retrying it only delays the clips behind it.
+//
+// WHY deduplicate by hash:
+// Copying the same text twice while offline should arrive once, and in its
+// latest position, so the other devices end up with what this one holds.
+//
+// WHY in memory:
+// Writing queued clip text to disk would bypass local_history's opt-in. A
+// bounded in-memory queue covers the common case - the agent keeps running
+// while the hub is away.
+
+package main
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// outbox holds clips whose push failed, oldest first.
+// WHY one push at a time: Clips must reach the hub in order; a new clip
+// can't overtake a queued one that is being flushed.
+// WHY not hold mu while pushing: With the hub unreachable every push waits
+// for the client's timeout, and the poll loop would wait with it on each
+// copy. Clips arriving during a push are queued behind it at once.
+type outbox struct {
+	mu     sync.Mutex
+	max    int
+	events []*models.Event
+	// pushing is set while a push or a flush is under way.
+	pushing bool
+}
+
+// QueueOfflineUpTo keeps up to n clips whose push failed for a connection
+// problem and pushes them once the hub is back. 0 keeps none.
+func (s *Syncer) QueueOfflineUpTo(n int) {
+	if n > 0 {
+		s.outbox = &outbox{max: n}
+	}
+}
+
+// QueuedClips returns how many clips are waiting for the hub.
+func (s *Syncer) QueuedClips() int {
+	if s.outbox == nil {
+		return 0
+	}
+	s.outbox.mu.Lock()
+	defer s.outbox.mu.Unlock()
+	return len(s.outbox.events)
+}
+
+// pushRetryable reports whether a failed push may succeed later.
+func pushRetryable(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	var status *client.StatusError
+	return errors.As(err, &status) && status.StatusCode >= 500
+}
+
+// PushOrQueue pushes event, or queues it if the hub can't be reached (or
+// clips are already waiting, or being pushed). It reports whether the clip
+// was queued, in which case the queue journals what becomes of it; err is
+// only set for a push that failed for good. Only a push with nothing queued
+// waits for the hub; queued clips are pushed in the background.
+func (s *Syncer) PushOrQueue(event *models.Event) (queued bool, err error) {
+	if s.outbox == nil {
+		return false, s.PushToHub(event)
+	}
+	o := s.outbox
+	o.mu.Lock()
+	if o.pushing || len(o.events) > 0 {
+		s.enqueue(event, "waiting behind queued clips")
+		s.startFlushLocked()
+		o.mu.Unlock()
+		return true, nil
+	}
+	o.pushing = true
+	o.mu.Unlock()
+
+	err = s.PushToHub(event)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pushing = false
+	if err != nil && pushRetryable(err) {
+		syncLog.Warnf("hub unreachable, queueing event %s: %v", event.EventID, err)
+		s.enqueue(event, "hub unreachable")
+		return true, nil
+	}
+	// WHY flush only after a push got through: Clips that queued up behind
+	// it can follow now; after a failure they wait for the hub to be back.
+	if err == nil && len(o.events) > 0 {
+		s.startFlushLocked()
+	}
+	return false, err
+}
+
+// enqueue appends event, replacing a queued clip with the same content and
+// dropping the oldest one when the queue is full. Caller must hold
+// s.outbox.mu.
+func (s *Syncer) enqueue(event *models.Event, reason string) {
+	o := s.outbox
+	o.events = slices.DeleteFunc(o.events, func(queued *models.Event) bool {
+		return queued.TextHash == event.TextHash
+	})
+	if len(o.events) >= o.max {
+		dropped := o.events[0]
+		o.events = o.events[1:]
+		syncLog.Warnf("offline queue full (%d clips), dropping the oldest: event %s", o.max, dropped.EventID)
+		s.journal.Record(JournalEntry{Action: journalFailed, EventID: dropped.EventID, Hash: dropped.TextHash,
+			Size: len(dropped.Text), Detail: "dropped from the full offline queue"})
+	}
+	o.events = append(o.events, event)
+	s.journal.Record(JournalEntry{Action: journalQueued, EventID: event.EventID, Hash: event.TextHash,
+		Size: len(event.Text), Detail: reason})
+}
+
+// FlushQueue starts pushing the queued clips in the background, oldest
+// first, stopping at the first one the hub can't be reached for. Called
+// when the hub is reachable again.
+func (s *Syncer) FlushQueue() {
+	if s.outbox == nil {
+		return
+	}
+	s.outbox.mu.Lock()
+	defer s.outbox.mu.Unlock()
+	if len(s.outbox.events) > 0 {
+		s.startFlushLocked()
+	}
+}
+
+// startFlushLocked starts flush unless a push is already under way (which
+// flushes when it is done, if the hub answered). Caller must hold
+// s.outbox.mu.
+func (s *Syncer) startFlushLocked() {
+	if s.outbox.pushing {
+		return
+	}
+	s.outbox.pushing = true
+	go s.flush()
+}
+
+// flush pushes the queued clips, oldest first, until the queue is empty or
+// the hub can't be reached.
+func (s *Syncer) flush() {
+	o := s.outbox
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	defer func() { o.pushing = false }()
+	for len(o.events) > 0 {
+		event := o.events[0]
+		// WHY drop expired transient clips: They would be cleared from the
+		// receiving clipboards the moment they arrived.
+		if event.IsTransient() && time.Now().After(event.ExpiresAt) {
+			o.events = o.events[1:]
+			s.journal.Record(JournalEntry{Action: journalFailed, EventID: event.EventID, Hash: event.TextHash,
+				Size: len(event.Text), Detail: "transient clip expired in the offline queue"})
+			continue
+		}
+		o.mu.Unlock()
+		err := s.PushToHub(event)
+		o.mu.Lock()
+		if err != nil && pushRetryable(err) {
+			return
+		}
+		// WHY by identity: A copy of the same content may have replaced it
+		// at the end of the queue meanwhile; that one still goes out.
+		o.events = slices.DeleteFunc(o.events, func(queued *models.Event) bool {
+			return queued == event
+		})
+		if err != nil {
+			syncLog.Errorf("failed to push queued event %s: %v", event.EventID, err)
+			s.journal.Record(JournalEntry{Action: journalFailed, EventID: event.EventID, Hash: event.TextHash,
+				Size: len(event.Text), Detail: err.Error()})
+			continue
+		}
+		s.journal.Record(JournalEntry{Action: journalPushed, EventID: event.EventID, Hash: event.TextHash,
+			Size: len(event.Text), Detail: "from the offline queue"})
+		s.keepInHistory(event)
+	}
+}
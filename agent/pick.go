@@ -0,0 +1,139 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the history picker: a small list of the hub's
+// newest clips, opened with history_hotkey or `agent pick`, that copies the
+// one chosen.
+//
+// WHY the hub's history rather than the local one:
+// It has every device's clips whether or not this agent was running, and
+// needs no local_history opt-in. The picker is a helper process per platform
+// (picker_*.go), like the tray icon, so the agent stays free of UI toolkits.
+//
+// WHY the hotkey lives in the agent:
+// A global hotkey has to be registered by a process that keeps running
+// (hotkey_*.go). Where the agent can't register one, a desktop shortcut
+// running `agent pick` does the same.
+//
+// WHY the chosen clip syncs like a copy:
+// Putting it on the clipboard is what copying it would have done; the other
+// devices follow, as they would for any copy.
+
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/i18n"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// pickerClips is how many of the hub's newest events the picker reads.
+const pickerClips = 20
+
+// pickerPreviewLength is how many characters of a clip a picker row shows.
+const pickerPreviewLength = 80
+
+// picking is set while the hotkey's picker is open.
+// WHY: Pressing the hotkey again while it is open would stack pickers.
+var picking atomic.Bool
+
+// errNoHubClips is returned when the hub's history has no text clips.
+var errNoHubClips = fmt.Errorf("the hub has no text clips")
+
+// pickFromHistory shows the picker for the hub's newest text clips and
+// copies the one chosen. It reports whether one was.
+func pickFromHistory(syncer *Syncer) (bool, error) {
+	events, err := hubHistory(syncer, pickerClips)
+	if err != nil {
+		return false, err
+	}
+	var clips []models.Event
+	for _, event := range events {
+		if event.ContentType == models.ContentTypeFile {
+			continue
+		}
+		if err := syncer.signers.check(&event); err != nil {
+			syncLog.Warnf("leaving event %s out of the picker: %v", event.EventID, err)
+			continue
+		}
+		if event.Encrypted {
+			if err := syncer.openEvent(&event); err != nil {
+				syncLog.Warnf("leaving event %s out of the picker: %v", event.EventID, err)
+				continue
+			}
+		}
+		clips = append(clips, event)
+	}
+	if len(clips) == 0 {
+		return false, errNoHubClips
+	}
+
+	rows := make([]string, len(clips))
+	for i, clip := range clips {
+		rows[i] = fmt.Sprintf("%s  (%s)", clipPreview(clip.Text, pickerPreviewLength), clip.SourceDeviceID)
+	}
+	index, ok, err := choosePicker(i18n.T("picker.title"), i18n.T("picker.prompt"), rows)
+	if err != nil || !ok {
+		return false, err
+	}
+	chosen := clips[index]
+	if err := WriteClipboard(chosen.Text); err != nil {
+		return false, fmt.Errorf("failed to write clipboard: %w", err)
+	}
+	clipboardLog.Infof("Copied event %s from the history picker", chosen.EventID)
+	return true, nil
+}
+
+// showHistoryPicker runs pickFromHistory for a hotkey press, unless a
+// picker is already open.
+func showHistoryPicker(syncer *Syncer) {
+	if !picking.CompareAndSwap(false, true) {
+		return
+	}
+	defer picking.Store(false)
+	if _, err := pickFromHistory(syncer); err != nil {
+		agentLog.Warnf("history picker: %v", err)
+	}
+}
+
+// watchHistoryHotkey registers history_hotkey and returns a channel that is
+// signalled when it is pressed, or nil when it is unset or can't be
+// registered.
+func watchHistoryHotkey(cfg *config.AgentConfig) <-chan struct{} {
+	hotkey := cfg.GetHistoryHotkey()
+	if hotkey == nil {
+		return nil
+	}
+	pressed, err := watchHotkey(hotkey)
+	if err != nil {
+		agentLog.Warnf("history_hotkey disabled: %v", err)
+		return nil
+	}
+	agentLog.Infof("History picker hotkey: %s", hotkey)
+	return pressed
+}
+
+// runPick implements `agent pick [config-path]`.
+// WHY a command too: Where the agent can't register a global hotkey (Linux),
+// the desktop's own keyboard shortcuts can run it.
+func runPick(args []string) error {
+	fs := newCommandFlags("pick")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := commandConfigPath(fs)
+	cfg, err := config.LoadAgentConfig(path)
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+	i18n.Init(cfg.Locale)
+	syncer := newCommandSyncer(cfg, nil)
+	syncer.VerifySignersWith(openSignerPins(path, cfg))
+	_, err = pickFromHistory(syncer)
+	if err == errNoHubClips {
+		return cli.Exit(cli.ExitEmpty, err)
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the history picker on macOS, through the standard
+// "choose from list" dialog.
+
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// pickerScript shows argv[2:] in a list titled argv[0] and prints the index
+// of the row chosen, or nothing.
+// WHY numbered rows: The dialog returns the chosen text, and two rows may
+// read the same.
+const pickerScript = `function run(argv) {
+	var app = Application.currentApplication();
+	app.includeStandardAdditions = true;
+	var rows = argv.slice(2).map(function (row, i) { return (i + 1) + '. ' + row; });
+	app.activate();
+	var chosen = app.chooseFromList(rows, {withTitle: argv[0], withPrompt: argv[1]});
+	if (!chosen) return '';
+	return String(rows.indexOf(chosen[0]));
+}`
+
+// choosePicker shows rows in a list and returns the index of the one
+// chosen, or false if the user canceled.
+func choosePicker(title, prompt string, rows []string) (int, bool, error) {
+	if _, err := exec.LookPath("osascript"); err != nil {
+		return 0, false, fmt.Errorf("osascript not found")
+	}
+	args := append([]string{"-l", "JavaScript", "-e", pickerScript, title, prompt}, rows...)
+	out, err := exec.Command("osascript", args...).Output()
+	if err != nil {
+		return 0, false, err
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil || index < 0 || index >= len(rows) {
+		return 0, false, nil
+	}
+	return index, true, nil
+}
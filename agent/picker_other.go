@@ -0,0 +1,63 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the history picker on Linux and the BSDs, through
+// zenity or yad.
+//
+// WHY zenity first: GNOME and most other desktops ship it; yad, which the
+// tray icon needs anyway, takes the same list options.
+
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/i18n"
+)
+
+// choosePicker shows rows in a list and returns the index of the one
+// chosen, or false if the user closed the list.
+func choosePicker(title, prompt string, rows []string) (int, bool, error) {
+	tool := ""
+	for _, name := range []string{"zenity", "yad"} {
+		if path, err := exec.LookPath(name); err == nil {
+			tool = path
+			break
+		}
+	}
+	if tool == "" {
+		return 0, false, fmt.Errorf("the history picker needs zenity or yad")
+	}
+
+	// WHY a hidden index column: Two rows may read the same; the index
+	// says which clip was meant.
+	args := []string{"--list", "--title=" + title, "--text=" + prompt, "--width=700", "--height=450",
+		"--column=#", "--column=" + i18n.T("picker.column"), "--hide-column=1", "--print-column=1"}
+	for i, row := range rows {
+		// WHY the space: A row starting with "-" would be read as an option.
+		if strings.HasPrefix(row, "-") {
+			row = " " + row
+		}
+		args = append(args, strconv.Itoa(i), row)
+	}
+	out, err := exec.Command(tool, args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// WHY not an error: Both exit non-zero when the list is closed.
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	// WHY trim "|": yad ends each printed column with its separator.
+	choice := strings.TrimSuffix(strings.TrimSpace(string(out)), "|")
+	index, err := strconv.Atoi(choice)
+	if err != nil || index < 0 || index >= len(rows) {
+		return 0, false, nil
+	}
+	return index, true, nil
+}
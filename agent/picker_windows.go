@@ -0,0 +1,48 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the history picker on Windows, through PowerShell's
+// Out-GridView.
+
+//go:build windows
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pickerScript reads the rows as a JSON array on stdin, shows them in a
+// grid titled TAILCLIP_PICKER_TITLE, and prints the index of the row chosen,
+// or nothing.
+// WHY a stream reader: It reads UTF-8; [Console]::In uses the console's
+// code page.
+const pickerScript = `$stdin = New-Object System.IO.StreamReader([Console]::OpenStandardInput())
+$rows = @($stdin.ReadToEnd() | ConvertFrom-Json)
+$list = for ($i = 0; $i -lt $rows.Count; $i++) { [pscustomobject]@{ '#' = $i + 1; Clip = $rows[$i] } }
+$chosen = $list | Out-GridView -Title $env:TAILCLIP_PICKER_TITLE -OutputMode Single
+if ($chosen) { $chosen.'#' - 1 }`
+
+// choosePicker shows rows in a list and returns the index of the one
+// chosen, or false if the user closed the list.
+// WHY the prompt is unused: Out-GridView has only a title.
+func choosePicker(title, prompt string, rows []string) (int, bool, error) {
+	input, err := json.Marshal(rows)
+	if err != nil {
+		return 0, false, err
+	}
+	cmd := powerShell(pickerScript)
+	hideConsoleWindow(cmd)
+	cmd.Env = append(os.Environ(), "TAILCLIP_PICKER_TITLE="+title)
+	cmd.Stdin = strings.NewReader(string(input))
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, false, err
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil || index < 0 || index >= len(rows) {
+		return 0, false, nil
+	}
+	return index, true, nil
+}
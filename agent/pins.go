@@ -0,0 +1,376 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the agent's quick-access list of pinned clips.
+//
+// WHY a list next to the local history:
+// The local history is a rolling window; a clip copied a week ago is gone
+// from it, and from the clipboard the moment anything else is copied. Some
+// clips are worth keeping at hand on a particular machine - an address, a
+// snippet pasted every day. Pinning an event for a device (Event.PinnedFor
+// on the hub) puts it in that device's list until it is unpinned, and
+// `agent pins` lists it and copies it back.
+//
+// WHY the hub is the source of truth:
+// A clip can be pinned for this machine from another device or with
+// `hub pin -device`. The hub sends a Pin message when the device is
+// connected, and the agent re-reads its pinned events on every connect to
+// pick up changes made while it was away.
+//
+// WHY sealed with the history key:
+// The list holds clip text, so it gets the same protection and the same
+// opt-in as the local history (see history.go).
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/i18n"
+	"github.com/tmair/tailclip/shared/models"
+	"github.com/tmair/tailclip/shared/wire"
+)
+
+// pinsFileName is the quick-access list file created next to the agent
+// config.
+const pinsFileName = "pins.jsonl"
+
+// pinsSealLabel binds sealed pin lines to their purpose (see e2e.SealLocal).
+const pinsSealLabel = "pins"
+
+// maxPinnedFetch is how many pinned events the agent reads from the hub on
+// connect.
+// WHY a bound: A quick-access list is meant to be short; one page covers it.
+const maxPinnedFetch = 200
+
+// PinnedClips is the quick-access list: clips pinned for this device, in
+// the order they were pinned.
+// WHY rewrite the file on every change: Pins change rarely and the list is
+// short; write-then-rename never leaves a half-written list behind.
+//
+// A nil *PinnedClips is valid and keeps nothing, like a nil *LocalHistory.
+type PinnedClips struct {
+	mu   sync.Mutex
+	path string
+	key  []byte
+}
+
+// pinsPath returns the quick-access list location for an agent config path.
+func pinsPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), pinsFileName)
+}
+
+// NewPinnedClips keeps the quick-access list at path, sealed with key.
+func NewPinnedClips(path string, key []byte) *PinnedClips {
+	return &PinnedClips{path: path, key: key}
+}
+
+// Set adds clip to the list, replacing an older copy of the same event.
+func (p *PinnedClips) Set(clip LocalClip) {
+	if p == nil {
+		return
+	}
+	p.update(func(clips []LocalClip) []LocalClip {
+		i := slices.IndexFunc(clips, func(c LocalClip) bool { return c.EventID == clip.EventID })
+		if i >= 0 {
+			clips[i] = clip
+			return clips
+		}
+		return append(clips, clip)
+	})
+}
+
+// Remove drops the clip of eventID from the list.
+func (p *PinnedClips) Remove(eventID string) {
+	if p == nil {
+		return
+	}
+	p.update(func(clips []LocalClip) []LocalClip {
+		return slices.DeleteFunc(clips, func(c LocalClip) bool { return c.EventID == eventID })
+	})
+}
+
+// Replace makes the list exactly clips, keeping the order of those already
+// in it.
+func (p *PinnedClips) Replace(clips []LocalClip) {
+	if p == nil {
+		return
+	}
+	p.update(func(old []LocalClip) []LocalClip {
+		kept := make([]LocalClip, 0, len(clips))
+		for _, c := range old {
+			if i := slices.IndexFunc(clips, func(n LocalClip) bool { return n.EventID == c.EventID }); i >= 0 {
+				kept = append(kept, clips[i])
+			}
+		}
+		for _, c := range clips {
+			if !slices.ContainsFunc(kept, func(k LocalClip) bool { return k.EventID == c.EventID }) {
+				kept = append(kept, c)
+			}
+		}
+		return kept
+	})
+}
+
+// update rewrites the list with change applied.
+// WHY log instead of returning errors: Like the history, the list must
+// never interrupt clipboard sync.
+func (p *PinnedClips) update(change func([]LocalClip) []LocalClip) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clips, _, err := readPinnedClips(p.path, p.key)
+	if err == nil {
+		err = writePinnedClips(p.path, p.key, change(clips))
+	}
+	if err != nil {
+		historyLog.Warnf("failed to update pinned clips: %v", err)
+	}
+}
+
+// readPinnedClips loads the quick-access list and counts the lines it
+// couldn't open. A missing file is an empty list.
+func readPinnedClips(path string, key []byte) ([]LocalClip, int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open pinned clips %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var clips []LocalClip
+	skipped := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var clip LocalClip
+		data, err := e2e.OpenLocal(key, pinsSealLabel, line)
+		if err == nil {
+			err = json.Unmarshal(data, &clip)
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+		clips = append(clips, clip)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read pinned clips %s: %w", path, err)
+	}
+	return clips, skipped, nil
+}
+
+// writePinnedClips replaces the quick-access list with clips.
+func writePinnedClips(path string, key []byte, clips []LocalClip) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	w := bufio.NewWriter(f)
+	for _, clip := range clips {
+		data, err := json.Marshal(clip)
+		if err == nil {
+			var line string
+			if line, err = e2e.SealLocal(key, pinsSealLabel, data); err == nil {
+				_, err = w.WriteString(line + "\n")
+			}
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write pinned clips: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// KeepPinsIn keeps the events pinned for this device in pins, and asks the
+// hub for Pin messages.
+func (s *Syncer) KeepPinsIn(pins *PinnedClips) {
+	s.pins = pins
+}
+
+// pinnedClip opens a pinned event from the hub into a list entry.
+// WHY only text: Files aren't kept in the local history either; a pinned
+// file stays on the hub (and in download_dir if it was received).
+func (s *Syncer) pinnedClip(event *models.Event) (LocalClip, error) {
+	if event.ContentType == models.ContentTypeFile {
+		return LocalClip{}, fmt.Errorf("event %s is a file", event.EventID)
+	}
+	if err := wire.Decompress(event, maxReceivedTextLength); err != nil {
+		return LocalClip{}, err
+	}
+	if event.Encrypted {
+		if err := s.openEvent(event); err != nil {
+			return LocalClip{}, err
+		}
+	}
+	return LocalClip{Time: event.Timestamp, EventID: event.EventID,
+		Device: event.SourceDeviceID, Channel: event.Channel, Text: event.Text}, nil
+}
+
+// applyPin updates the quick-access list from a Pin message.
+func (s *Syncer) applyPin(pin models.Pin) {
+	if !pin.Pinned {
+		s.pins.Remove(pin.EventID)
+		syncLog.Infof("event %s unpinned for this device", pin.EventID)
+		return
+	}
+	if pin.Event == nil {
+		return
+	}
+	clip, err := s.pinnedClip(pin.Event)
+	if err != nil {
+		syncLog.Warnf("not keeping pinned event %s: %v", pin.EventID, err)
+		return
+	}
+	s.pins.Set(clip)
+	syncLog.Infof("event %s pinned for this device", pin.EventID)
+}
+
+// syncPins replaces the quick-access list with the events the hub has
+// pinned for this device, catching up on changes made while disconnected.
+// WHY give up quietly on a refusal: Listing history needs the hub's shared
+// token; an agent enrolled with a device token relies on Pin messages alone.
+func (s *Syncer) syncPins() {
+	if s.pins == nil {
+		return
+	}
+	events, err := s.hub.History(client.HistoryOptions{PinnedFor: s.deviceID, Limit: maxPinnedFetch})
+	var status *client.StatusError
+	if errors.As(err, &status) && status.StatusCode == http.StatusUnauthorized {
+		syncLog.Debugf("not catching up on pinned clips: %v", err)
+		return
+	}
+	if err != nil {
+		syncLog.Warnf("failed to catch up on pinned clips: %v", err)
+		return
+	}
+	clips := make([]LocalClip, 0, len(events))
+	for i := range events {
+		clip, err := s.pinnedClip(&events[i])
+		if err != nil {
+			syncLog.Warnf("not keeping pinned event %s: %v", events[i].EventID, err)
+			continue
+		}
+		clips = append(clips, clip)
+	}
+	// WHY oldest first: History is newest first; the list is in pin order,
+	// which for a fresh list is best approximated by clip age.
+	slices.Reverse(clips)
+	s.pins.Replace(clips)
+}
+
+// runPins implements `agent pins [-add ID] [-remove ID] [-copy ID] [config-path]`.
+func runPins(args []string) error {
+	fs := newCommandFlags("pins")
+	add := fs.String("add", "", "pin the event with this ID for this device")
+	remove := fs.String("remove", "", "unpin the event with this ID (or ID prefix) for this device")
+	copyID := fs.String("copy", "", "put the pinned clip whose event ID starts with this on the clipboard")
+	addJSONFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	configPath := commandConfigPath(fs)
+	cfg, err := loadCommandConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+	key, err := historyKey(cfg.DeviceID, false)
+	if err != nil {
+		return err
+	}
+	path := pinsPath(configPath)
+	clips, skipped, err := readPinnedClips(path, key)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("cli.unreadable", skipped, path))
+	}
+
+	// WHY through the hub: The running agent updates the list from the Pin
+	// message, and the pin survives this machine's list being lost.
+	if *add != "" || *remove != "" {
+		hub := newCommandClient(cfg)
+		eventID, pinned := *add, true
+		if *remove != "" {
+			eventID, pinned = *remove, false
+			for _, clip := range clips {
+				if strings.HasPrefix(clip.EventID, *remove) {
+					eventID = clip.EventID
+					break
+				}
+			}
+		}
+		if err := hub.PinEventFor(eventID, cfg.DeviceID, pinned); err != nil {
+			return err
+		}
+		if pinned {
+			fmt.Println(i18n.T("cli.pins.pinned", eventID, cfg.DeviceID))
+		} else {
+			fmt.Println(i18n.T("cli.pins.unpinned", eventID, cfg.DeviceID))
+		}
+		return nil
+	}
+
+	if *copyID != "" {
+		for _, clip := range clips {
+			if strings.HasPrefix(clip.EventID, *copyID) {
+				if err := WriteClipboard(clip.Text); err != nil {
+					return fmt.Errorf("failed to write clipboard: %w", err)
+				}
+				fmt.Println(i18n.T("cli.copied", clip.EventID, formatBytes(len(clip.Text))))
+				return nil
+			}
+		}
+		return fmt.Errorf("no pinned clip with event ID %s... in %s", *copyID, path)
+	}
+
+	if jsonOutput {
+		return cli.PrintJSON(nonNil(clips))
+	}
+	if len(clips) == 0 {
+		fmt.Println(i18n.T("cli.pins.none", path))
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, i18n.T("cli.clips.header"))
+	for _, clip := range clips {
+		preview := strings.Join(strings.Fields(clip.Text), " ")
+		if len(preview) > 60 {
+			preview = preview[:60] + "..."
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			clip.Time.Local().Format("2006-01-02 15:04:05"), clip.EventID,
+			clip.Device, formatBytes(len(clip.Text)), preview)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,12 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the default (non-Windows) helper-process settings.
+
+//go:build !windows
+
+package main
+
+import "os/exec"
+
+// hideConsoleWindow is a no-op: only Windows opens console windows for
+// helper processes.
+func hideConsoleWindow(cmd *exec.Cmd) {}
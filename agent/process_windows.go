@@ -0,0 +1,37 @@
+// Author: Toluwalase Mebaanne
+// Package main provides Windows helper-process settings.
+
+//go:build windows
+
+package main
+
+import (
+	"encoding/base64"
+	"os/exec"
+	"syscall"
+	"unicode/utf16"
+)
+
+// createNoWindow is the CREATE_NO_WINDOW process creation flag.
+const createNoWindow = 0x08000000
+
+// hideConsoleWindow keeps a console helper (e.g., tailscale.exe) from
+// flashing a window.
+// WHY: The agent is built as a GUI app (-H=windowsgui), so Windows gives
+// every console child process a new, visible console by default.
+func hideConsoleWindow(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, CreationFlags: createNoWindow}
+}
+
+// powerShell returns a Windows PowerShell command that runs script.
+// WHY -EncodedCommand: stdin stays free for the script's own input, and the
+// encoded form spares the script from command-line quoting.
+func powerShell(script string) *exec.Cmd {
+	encoded := utf16.Encode([]rune(script))
+	data := make([]byte, 0, 2*len(encoded))
+	for _, unit := range encoded {
+		data = append(data, byte(unit), byte(unit>>8))
+	}
+	return exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-STA",
+		"-ExecutionPolicy", "Bypass", "-EncodedCommand", base64.StdEncoding.EncodeToString(data))
+}
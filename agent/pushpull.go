@@ -0,0 +1,282 @@
+// Author: Toluwalase Mebaanne
+// Package main provides `agent push` and `agent pull`, and their shorthands
+// `agent copy` and `agent paste`: sending a clip from a script and reading
+// the newest one back.
+//
+// WHY commands that skip the clipboard:
+// A script on a server or in a build has text to share but often no
+// clipboard (no display, or one the user isn't looking at). push reads
+// stdin and pull writes stdout, so they compose with pipes.
+//
+// WHY -quiet:
+// With it, stdout carries only the clip (pull) or nothing (push), and stderr
+// only errors; the outcome is in the exit code (see shared/cli).
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/handlers"
+	"github.com/tmair/tailclip/shared/i18n"
+	"github.com/tmair/tailclip/shared/logging"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// pullScanLimit is how many of the hub's newest events pull looks through
+// for a text clip.
+// WHY more than one: The newest events may all be files.
+const pullScanLimit = 20
+
+// quietLogging limits the agent's log lines to errors, for -quiet.
+// WHY stderr still: An error a script doesn't see is a failure nobody can
+// explain later.
+func quietLogging() {
+	logging.Setup(os.Stderr, logging.LevelError, logging.FormatText)
+}
+
+// newCommandSyncer returns a Syncer for a one-shot command, set up from cfg
+// like the running agent's.
+func newCommandSyncer(cfg *config.AgentConfig, journal *Journal) *Syncer {
+	syncer := NewSyncer(cfg.HubURL, cfg.AuthToken, cfg.DeviceID, journal)
+	syncer.EncryptWith(cfg.GetEncryptionKey())
+	syncer.CompressAbove(cfg.CompressThreshold)
+	syncer.LimitBandwidth(cfg.GetBandwidthLimits())
+	if proxy := cfg.GetProxy(); proxy != nil {
+		syncer.UseProxy(proxy)
+	}
+	return syncer
+}
+
+// runPush implements `agent push [-text TEXT] [-quiet] [config-path]`.
+func runPush(args []string) error {
+	fs := newCommandFlags("push")
+	text := fs.String("text", "", "text to push (default: read stdin)")
+	quiet := fs.Bool("quiet", false, "print nothing but errors; check the exit code")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	content := *text
+	if !isFlagSet(fs, "text") {
+		data, err := readStdin()
+		if err != nil {
+			return err
+		}
+		content = data
+	}
+	return pushText(commandConfigPath(fs), content, "agent push", *quiet)
+}
+
+// runCopy implements `agent copy [-quiet] <text|-> [config-path]`: push with
+// the text as an argument, "-" reading it from stdin.
+func runCopy(args []string) error {
+	fs := newCommandFlags("copy")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent copy [flags] <text|-> [config-path]\n")
+		fs.PrintDefaults()
+	}
+	quiet := fs.Bool("quiet", false, "print nothing but errors; check the exit code")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("the text to copy is required (\"-\" reads stdin)")
+	}
+	content := fs.Arg(0)
+	if content == "-" {
+		data, err := readStdin()
+		if err != nil {
+			return err
+		}
+		content = data
+	}
+	configPath := defaultConfigPath
+	if fs.NArg() > 1 {
+		configPath = fs.Arg(1)
+	}
+	return pushText(configPath, content, "agent copy", *quiet)
+}
+
+// readStdin reads all of stdin.
+// WHY keep it as is: A trailing newline may be part of the clip; `printf %s`
+// leaves it out where it isn't.
+func readStdin() (string, error) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stdin: %w", err)
+	}
+	return string(data), nil
+}
+
+// pushText sends content to the hub as a clip from the agent at configPath,
+// like a copy, for the command named source.
+func pushText(configPath, content, source string, quiet bool) error {
+	if quiet {
+		quietLogging()
+	}
+	cfg, err := loadCommandConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+
+	journal, err := OpenJournal(journalPath(configPath))
+	if err != nil {
+		syncLog.Warnf("sync journal disabled: %v", err)
+	}
+	syncer := newCommandSyncer(cfg, journal)
+	syncer.NegotiateCapabilities(cfg.MaxTextLength, cfg.MaxFileSize)
+
+	hash := hashText(content)
+	if rule := cfg.Blocked(content); rule != "" {
+		syncer.journal.Record(JournalEntry{Action: journalFiltered, Hash: hash, Size: len(content),
+			Detail: source + ": block_patterns: " + rule})
+		return cli.Exit(cli.ExitFiltered, fmt.Errorf("not pushed: content matches block_patterns entry %q", rule))
+	}
+	if err := handlers.NewTextHandler(syncer.MaxTextLength()).Process(content); err != nil {
+		syncer.journal.Record(JournalEntry{Action: journalFiltered, Hash: hash, Size: len(content),
+			Detail: source + ": " + err.Error()})
+		return cli.Exit(cli.ExitFiltered, fmt.Errorf("not pushed: %w", err))
+	}
+
+	event := &models.Event{
+		EventID:        newEventID(cfg.EventIDScheme),
+		SourceDeviceID: cfg.DeviceID,
+		Timestamp:      time.Now().UTC(),
+		ContentType:    models.ContentTypeText,
+		Text:           content,
+		Channel:        cfg.Channel,
+	}
+	event.SetTextHash()
+	// WHY the same sensitive_patterns rule: A password piped in from a
+	// script is no less a secret than a copied one.
+	if cfg.IsSensitive(content) {
+		event.ExpiresAt = event.Timestamp.Add(cfg.GetSensitiveTTL())
+	}
+
+	// WHY no offline queue: The command exits right away; the exit code
+	// tells the script to retry.
+	if err := syncer.PushToHub(event); err != nil {
+		syncer.journal.Record(JournalEntry{Action: journalFailed, EventID: event.EventID, Hash: hash,
+			Size: len(content), Detail: source + ": " + err.Error()})
+		return fmt.Errorf("push failed: %w", err)
+	}
+	syncer.journal.Record(JournalEntry{Action: journalPushed, EventID: event.EventID, Hash: hash,
+		Size: len(content), Detail: source})
+	if !quiet {
+		fmt.Println(i18n.T("cli.pushed", event.EventID, formatBytes(len(content))))
+	}
+	return nil
+}
+
+// runPull implements `agent pull [-copy] [-quiet] [config-path]`.
+func runPull(args []string) error {
+	return pullClip("pull", args)
+}
+
+// runPaste implements `agent paste`, another name for pull.
+func runPaste(args []string) error {
+	return pullClip("paste", args)
+}
+
+// pullClip prints (or copies) the hub's newest text clip, for the command
+// called name.
+// WHY exit with ExitEmpty when there is nothing: A script reading the
+// newest clip needs "none yet" apart from an empty clip and from failure.
+func pullClip(name string, args []string) error {
+	fs := newCommandFlags(name)
+	toClipboard := fs.Bool("copy", false, "put the clip on the clipboard instead of printing it")
+	quiet := fs.Bool("quiet", false, "print nothing but the clip and errors; check the exit code")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *quiet {
+		quietLogging()
+	}
+	path := commandConfigPath(fs)
+	cfg, err := loadCommandConfig(path)
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+	syncer := newCommandSyncer(cfg, nil)
+	syncer.VerifySignersWith(openSignerPins(path, cfg))
+
+	events, err := hubHistory(syncer, pullScanLimit)
+	if err != nil {
+		return fmt.Errorf("pull failed: %w", err)
+	}
+	var event *models.Event
+	for i := range events {
+		if events[i].ContentType != models.ContentTypeFile {
+			event = &events[i]
+			break
+		}
+	}
+	if event == nil {
+		if *quiet {
+			return cli.Exit(cli.ExitEmpty, nil)
+		}
+		return cli.Exit(cli.ExitEmpty, fmt.Errorf("the hub has no text clips"))
+	}
+	// WHY refuse rather than fall back to an older clip: The newest clip is
+	// what was asked for; printing another would hide the forgery.
+	if err := syncer.signers.check(event); err != nil {
+		return fmt.Errorf("refusing event %s from %s: %w", event.EventID, event.SourceDeviceID, err)
+	}
+	if event.Encrypted {
+		if err := syncer.openEvent(event); err != nil {
+			return fmt.Errorf("failed to decrypt event %s: %w", event.EventID, err)
+		}
+	}
+
+	if *toClipboard {
+		if err := WriteClipboard(event.Text); err != nil {
+			return fmt.Errorf("failed to write clipboard: %w", err)
+		}
+		if !*quiet {
+			fmt.Println(i18n.T("cli.copied", event.EventID, formatBytes(len(event.Text))))
+		}
+		return nil
+	}
+	fmt.Print(event.Text)
+	// WHY no added newline when quiet: Quiet output is the clip exactly,
+	// for redirection; the newline only keeps a terminal prompt readable.
+	if !*quiet && !strings.HasSuffix(event.Text, "\n") {
+		fmt.Println()
+	}
+	return nil
+}
+
+// hubHistory reads the hub's newest limit events, newest first.
+// WHY explain a 401: Device tokens can push but not read history, which
+// otherwise looks like a wrong token.
+func hubHistory(syncer *Syncer, limit int) ([]models.Event, error) {
+	events, err := syncer.hub.History(client.HistoryOptions{Limit: limit})
+	var status *client.StatusError
+	if errors.As(err, &status) && status.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("reading history needs the hub's shared auth_token, not a device token: %w", err)
+	}
+	return events, err
+}
+
+// isFlagSet reports whether the flag called name was given on the command
+// line, as opposed to left at its default.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,394 @@
+// Author: Toluwalase Mebaanne
+// Package main provides a minimal QR code encoder for `agent keys export -qr`.
+//
+// WHY a QR code:
+// Onboarding a phone or a second laptop means getting a 55-character key
+// onto it. Scanning it off the screen of a machine that already has it is
+// quicker and less error-prone than typing, and the key never passes
+// through a chat app or email.
+//
+// WHY our own encoder instead of a module:
+// The agent only ever encodes one short string. Byte mode at error
+// correction level L in versions 1-5 - all single-block, so no interleaving
+// - is all that takes, about as much code as vendoring a library would be
+// configuration.
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// qrVersion describes a QR version at error correction level L.
+type qrVersion struct {
+	// dataCodewords and ecCodewords are the byte counts of the single
+	// block of data and of error correction.
+	dataCodewords int
+	ecCodewords   int
+}
+
+// qrVersions lists versions 1-5 at level L (index 0 is version 1).
+var qrVersions = []qrVersion{{19, 7}, {34, 10}, {55, 15}, {80, 20}, {108, 26}}
+
+// qrCode is an encoded QR symbol.
+type qrCode struct {
+	size     int
+	modules  [][]bool // [row][col], true is dark
+	function [][]bool // finder, timing, alignment, and format modules
+}
+
+// encodeQR encodes data as a QR code in byte mode at level L, in the
+// smallest version that fits.
+func encodeQR(data []byte) (*qrCode, error) {
+	version := 0
+	for v, info := range qrVersions {
+		// WHY subtract 2: The mode (4 bits) and length (8 bits) header.
+		if len(data) <= info.dataCodewords-2 {
+			version = v + 1
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("%d bytes is too much for a QR code here", len(data))
+	}
+	info := qrVersions[version-1]
+
+	codewords := qrDataCodewords(data, info.dataCodewords)
+	codewords = append(codewords, reedSolomon(codewords, info.ecCodewords)...)
+
+	size := 17 + 4*version
+	q := &qrCode{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+	q.drawFunctionPatterns(version)
+	q.drawCodewords(codewords)
+
+	// WHY try every mask: The mask keeps large blank areas and finder-like
+	// shapes out of the data, which scanners otherwise stumble on.
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask) // masking is its own inverse
+	}
+	q.applyMask(best)
+	q.drawFormatBits(best)
+	return q, nil
+}
+
+// qrDataCodewords builds the data codewords: byte mode header, data,
+// terminator, and padding to capacity.
+func qrDataCodewords(data []byte, capacity int) []byte {
+	var bits []bool
+	put := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, value>>i&1 == 1)
+		}
+	}
+	put(0b0100, 4)
+	put(len(data), 8)
+	for _, b := range data {
+		put(int(b), 8)
+	}
+	put(0, min(4, capacity*8-len(bits)))
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	codewords := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for _, bit := range bits[i : i+8] {
+			b <<= 1
+			if bit {
+				b |= 1
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xEC); len(codewords) < capacity; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// reedSolomon returns n error correction codewords for data over GF(256)
+// with the QR polynomial 0x11D.
+func reedSolomon(data []byte, n int) []byte {
+	// generator holds the coefficients of (x - a^0)...(x - a^(n-1)),
+	// highest power first and without the leading 1.
+	generator := make([]byte, n)
+	generator[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			generator[j] = gfMultiply(generator[j], root)
+			if j+1 < n {
+				generator[j] ^= generator[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	remainder := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[n-1] = 0
+		for i := range remainder {
+			remainder[i] ^= gfMultiply(generator[i], factor)
+		}
+	}
+	return remainder
+}
+
+// gfMultiply multiplies in GF(256) modulo 0x11D.
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// set draws a function module.
+func (q *qrCode) set(col, row int, dark bool) {
+	q.modules[row][col] = dark
+	q.function[row][col] = true
+}
+
+// drawFunctionPatterns draws the timing, finder, and alignment patterns
+// and reserves the format areas.
+func (q *qrCode) drawFunctionPatterns(version int) {
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	// WHY radius 4: Draws the light separator around each finder as well.
+	for _, center := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				col, row := center[0]+dx, center[1]+dy
+				if col < 0 || col >= q.size || row < 0 || row >= q.size {
+					continue
+				}
+				dist := max(abs(dx), abs(dy))
+				q.set(col, row, dist != 2 && dist != 4)
+			}
+		}
+	}
+	// WHY a single alignment pattern: Versions 2-6 have exactly one.
+	if version > 1 {
+		center := q.size - 7
+		for dy := -2; dy <= 2; dy++ {
+			for dx := -2; dx <= 2; dx++ {
+				q.set(center+dx, center+dy, max(abs(dx), abs(dy)) != 1)
+			}
+		}
+	}
+	q.drawFormatBits(0)
+}
+
+// drawFormatBits draws both copies of the format information for level L
+// and mask, and the dark module.
+func (q *qrCode) drawFormatBits(mask int) {
+	data := 0b01<<3 | mask // 01 is level L
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// drawCodewords places the codewords in the zigzag order of the standard:
+// two-column strips from the right, alternately upward and downward,
+// skipping the vertical timing pattern.
+func (q *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				col := right - j
+				row := vert
+				if (right+1)&2 == 0 {
+					row = q.size - 1 - vert
+				}
+				if q.function[row][col] || i >= len(codewords)*8 {
+					continue
+				}
+				q.modules[row][col] = codewords[i>>3]>>(7-i&7)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by mask.
+func (q *qrCode) applyMask(mask int) {
+	for row := 0; row < q.size; row++ {
+		for col := 0; col < q.size; col++ {
+			if q.function[row][col] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (col+row)%2 == 0
+			case 1:
+				invert = row%2 == 0
+			case 2:
+				invert = col%3 == 0
+			case 3:
+				invert = (col+row)%3 == 0
+			case 4:
+				invert = (col/3+row/2)%2 == 0
+			case 5:
+				invert = col*row%2+col*row%3 == 0
+			case 6:
+				invert = (col*row%2+col*row%3)%2 == 0
+			case 7:
+				invert = ((col+row)%2+col*row%3)%2 == 0
+			}
+			if invert {
+				q.modules[row][col] = !q.modules[row][col]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol by the standard's four rules; lower is easier
+// to scan.
+func (q *qrCode) penalty() int {
+	at := func(col, row int, transpose bool) bool {
+		if transpose {
+			return q.modules[col][row]
+		}
+		return q.modules[row][col]
+	}
+	finderLike := []bool{true, false, true, true, true, false, true}
+
+	score, dark := 0, 0
+	for _, transpose := range []bool{false, true} {
+		for row := 0; row < q.size; row++ {
+			// Rule 1: runs of five or more modules of one color.
+			run := 1
+			for col := 1; col <= q.size; col++ {
+				if col < q.size && at(col, row, transpose) == at(col-1, row, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += run - 2
+				}
+				run = 1
+			}
+			// Rule 3: 1:1:3:1:1 finder-like shapes with four light
+			// modules on either side.
+			for col := 0; col+len(finderLike) <= q.size; col++ {
+				match := true
+				for k, want := range finderLike {
+					if at(col+k, row, transpose) != want {
+						match = false
+						break
+					}
+				}
+				if match && (q.lightRun(col-4, col, row, transpose, at) || q.lightRun(col+7, col+11, row, transpose, at)) {
+					score += 40
+				}
+			}
+		}
+	}
+	for row := 0; row < q.size; row++ {
+		for col := 0; col < q.size; col++ {
+			if q.modules[row][col] {
+				dark++
+			}
+			// Rule 2: 2x2 blocks of one color.
+			if row+1 < q.size && col+1 < q.size {
+				c := q.modules[row][col]
+				if q.modules[row][col+1] == c && q.modules[row+1][col] == c && q.modules[row+1][col+1] == c {
+					score += 3
+				}
+			}
+		}
+	}
+	// Rule 4: distance from a 50% dark share, in steps of 5%.
+	total := q.size * q.size
+	score += abs(dark*20-total*10) / total * 10
+	return score
+}
+
+// lightRun reports whether columns from (inclusive) to to (exclusive) of
+// row are light, counting the quiet zone outside the symbol as light.
+func (q *qrCode) lightRun(from, to, row int, transpose bool, at func(int, int, bool) bool) bool {
+	for col := from; col < to; col++ {
+		if col >= 0 && col < q.size && at(col, row, transpose) {
+			return false
+		}
+	}
+	return true
+}
+
+// render draws the code with two module rows per text line, using half
+// blocks and explicit colors.
+// WHY explicit colors: Terminals with a dark background would otherwise
+// show the code inverted, which many scanners can't read.
+// WHY a 2-module quiet zone instead of 4: It is what phone scanners need in
+// practice and keeps the code small on narrow terminals.
+func (q *qrCode) render(w io.Writer) {
+	const quiet = 2
+	dark := func(row, col int) bool {
+		row, col = row-quiet, col-quiet
+		return row >= 0 && row < q.size && col >= 0 && col < q.size && q.modules[row][col]
+	}
+	color := func(isDark bool, base int) int {
+		if isDark {
+			return base // black
+		}
+		return base + 67 // bright white: 97 foreground, 107 background
+	}
+	span := q.size + 2*quiet
+	for row := 0; row < span; row += 2 {
+		for col := 0; col < span; col++ {
+			fmt.Fprintf(w, "\x1b[%d;%dm▀", color(dark(row, col), 30), color(dark(row+1, col), 40))
+		}
+		fmt.Fprint(w, "\x1b[0m\n")
+	}
+}
+
+// abs returns the absolute value of x.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
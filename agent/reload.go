@@ -0,0 +1,184 @@
+// Author: Toluwalase Mebaanne
+// Package main provides hot reloading of the agent's config.
+//
+// WHY reload instead of restart:
+// Adding an app to exclude_apps or muting notifications is a one-line edit,
+// and restarting the agent for it means finding the process, losing the
+// hub session, and on Windows starting it again by hand. The agent reloads
+// its config when the file changes or on SIGHUP, and applies what it can
+// while running.
+//
+// WHY poll the file's modification time instead of fsnotify:
+// A check every few seconds is instant enough for an edit and needs no new
+// dependency. Editors that save by renaming a new file into place replace
+// the inode an inotify watch would be on; a stat by path sees them too.
+//
+// WHY some settings still need a restart:
+// The hub URL, token, device ID, channels, encryption key, proxy, and the
+// like shape the connection and the session the hub keeps for it. Those
+// are left as they were, with a log line saying a restart applies them.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tmair/tailclip/shared/config"
+)
+
+// configCheckInterval is how often the agent looks for a changed config.
+const configCheckInterval = 3 * time.Second
+
+// reloadableSettings are the config settings a reload applies while the
+// agent runs. Changes to any other setting take effect after a restart.
+var reloadableSettings = map[string]bool{
+	"enabled":               true,
+	"poll_interval_ms":      true,
+	"idle_poll_interval_ms": true,
+	"notify_enabled":        true,
+	"accept_from_devices":   true,
+	"sensitive_patterns":    true,
+	"sensitive_ttl_seconds": true,
+	"block_patterns":        true,
+	"exclude_apps":          true,
+	"local_only_prefix":     true,
+}
+
+// watchConfig reports on the returned channel whenever the config at path
+// changes or the agent receives SIGHUP.
+// WHY buffered with size 1: Like watchWake, several changes before the main
+// loop looks collapse into one reload.
+func watchConfig(path string) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	// WHY SIGHUP too: It's how daemons are told to reload, and it reloads
+	// a config whose change the check would miss (a restored backup with
+	// the old modification time). Windows has no SIGHUP; the check covers it.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		ticker := time.NewTicker(configCheckInterval)
+		defer ticker.Stop()
+		last := configStamp(path)
+		for {
+			select {
+			case <-hup:
+				notify()
+			case <-ticker.C:
+				if stamp := configStamp(path); stamp != last {
+					last = stamp
+					notify()
+				}
+			}
+		}
+	}()
+	return changed
+}
+
+// configStamp identifies a version of the file at path by its modification
+// time and size; "" if it can't be read.
+func configStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// reloadConfig loads the config at path again and applies the reloadable
+// settings to syncer. It returns the config to run with: the new one, or
+// cfg when the file doesn't load.
+// WHY keep running on a bad config: A half-saved file or a typo shouldn't
+// stop sync; the error is logged and the next save is tried again.
+func reloadConfig(syncer *Syncer, cfg *config.AgentConfig, path string) *config.AgentConfig {
+	next, err := config.LoadAgentConfig(path)
+	if err != nil {
+		agentLog.Warnf("Config changed but did not load, keeping the current one: %v", err)
+		return cfg
+	}
+	applied, restart := compareConfigs(cfg, next)
+	if len(applied) == 0 && len(restart) == 0 {
+		agentLog.Infof("Config reloaded; nothing changed")
+		return cfg
+	}
+	if len(restart) > 0 {
+		agentLog.Warnf("Config reloaded; changes to %s take effect after a restart", strings.Join(restart, ", "))
+		// WHY carry them over: The running agent keeps using the values it
+		// started with, so cfg must keep saying so for everything that
+		// reads it.
+		next = withRestartSettings(next, cfg)
+	}
+	if len(applied) == 0 {
+		return next
+	}
+	agentLog.Infof("Config reloaded; applied changes to %s", strings.Join(applied, ", "))
+
+	syncer.NotifyOnReceive(next.NotifyEnabled)
+	syncer.AcceptOnlyFrom(next.AcceptFromDevices)
+	// WHY pause rather than exit: A disabled agent that exits can't be
+	// enabled again by editing the file. Only a change pauses or resumes,
+	// so a pause from the tray or `agent pause` survives other edits.
+	if next.Enabled != cfg.Enabled {
+		if next.Enabled {
+			agentLog.Infof("Agent enabled in config")
+		} else {
+			agentLog.Infof("Agent disabled in config; sync is paused until it is enabled again")
+		}
+		syncer.SetPaused(!next.Enabled)
+	}
+	return next
+}
+
+// compareConfigs lists the settings, by JSON name, that differ between old
+// and next: applied are those a reload applies, restart the rest.
+func compareConfigs(old, next *config.AgentConfig) (applied, restart []string) {
+	oldValue, nextValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < oldValue.NumField(); i++ {
+		name, ok := configSettingName(oldValue.Type().Field(i))
+		if !ok || reflect.DeepEqual(oldValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			continue
+		}
+		if reloadableSettings[name] {
+			applied = append(applied, name)
+		} else {
+			restart = append(restart, name)
+		}
+	}
+	return applied, restart
+}
+
+// withRestartSettings returns a copy of next with the settings a reload
+// doesn't apply taken from running.
+// WHY start from next: Its compiled block_patterns and sensitive_patterns
+// go with the new settings. The parsed values behind restart settings (the
+// proxy, the encryption key, the hotkey) are only read at startup.
+func withRestartSettings(next, running *config.AgentConfig) *config.AgentConfig {
+	merged := *next
+	mergedValue, runningValue := reflect.ValueOf(&merged).Elem(), reflect.ValueOf(running).Elem()
+	for i := 0; i < mergedValue.NumField(); i++ {
+		if name, ok := configSettingName(mergedValue.Type().Field(i)); ok && !reloadableSettings[name] {
+			mergedValue.Field(i).Set(runningValue.Field(i))
+		}
+	}
+	return &merged
+}
+
+// configSettingName returns the JSON name of an exported config field.
+func configSettingName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name, name != "" && name != "-"
+}
@@ -0,0 +1,86 @@
+// Author: Toluwalase Mebaanne
+// Package main provides clipboard restore after transient clips.
+//
+// WHY restore instead of clearing:
+// A transient clip (a password flagged by the sender's sensitive_patterns)
+// replaces whatever the user had copied on every receiving device. Clearing
+// it on expiry would remove the secret but also lose that earlier content,
+// so the agent snapshots the clipboard before applying the clip and puts the
+// snapshot back once the clip expires.
+
+package main
+
+import (
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// pendingRestore is a scheduled restore of the pre-transient clipboard.
+type pendingRestore struct {
+	timer    *time.Timer
+	previous string
+}
+
+// snapshotForRestore returns the clipboard content to restore once the
+// transient clip about to be written expires.
+// WHY reuse a pending snapshot: When a second transient clip arrives before
+// the first expires, the clipboard holds the first secret. Snapshotting that
+// would "restore" a password; the content from before both is what the user
+// wants back.
+func (s *Syncer) snapshotForRestore() string {
+	s.restoreMu.Lock()
+	defer s.restoreMu.Unlock()
+
+	if s.restore != nil {
+		s.restore.timer.Stop()
+		previous := s.restore.previous
+		s.restore = nil
+		return previous
+	}
+	return ReadClipboard()
+}
+
+// scheduleRestore puts previous back on the clipboard when event expires.
+func (s *Syncer) scheduleRestore(event *models.Event, previous string) {
+	s.restoreMu.Lock()
+	defer s.restoreMu.Unlock()
+
+	r := &pendingRestore{previous: previous}
+	r.timer = time.AfterFunc(time.Until(event.ExpiresAt), func() {
+		s.restoreMu.Lock()
+		superseded := s.restore != r
+		if !superseded {
+			s.restore = nil
+		}
+		s.restoreMu.Unlock()
+		if superseded {
+			return
+		}
+
+		// WHY only if the clip is still there: If the user copied something
+		// since, that is newer than the snapshot and must not be overwritten.
+		if ReadClipboard() != event.Text {
+			clipboardLog.Infof("Transient event %s expired; clipboard changed since, not restoring", event.EventID)
+			return
+		}
+
+		// Cache the restored content's hash - WHY: The poll loop sees the
+		// restore as a clipboard change and would push the old content to
+		// every other device.
+		hash := hashText(previous)
+		if hash != "" {
+			s.cache.Add(hash)
+		}
+		if err := WriteClipboard(previous); err != nil {
+			clipboardLog.Errorf("failed to restore clipboard after transient event %s: %v", event.EventID, err)
+			s.journal.Record(JournalEntry{Action: journalApplyFail, EventID: event.EventID,
+				Device: event.SourceDeviceID, Detail: "restore: " + err.Error()})
+			return
+		}
+		clipboardLog.Infof("Transient event %s expired; restored previous clipboard", event.EventID)
+		s.journal.Record(JournalEntry{Action: journalRestored, EventID: event.EventID,
+			Device: event.SourceDeviceID, Hash: hash, Size: len(previous)})
+	})
+	s.restore = r
+}
@@ -0,0 +1,353 @@
+// Author: Toluwalase Mebaanne
+// Package main provides `agent search`: searching the hub's history from the
+// command line, with recent results cached for when the hub is unreachable.
+//
+// WHY search the hub rather than the local history:
+// The hub has every device's clips, not just the ones this machine saw. The
+// local history (`agent history -q`) only covers what passed through here.
+//
+// WHY cache results:
+// A search that worked at the office should still answer on the train. The
+// cache holds the last results of each recent query, and offline answers
+// come from it, marked as possibly stale since the hub may have changed.
+//
+// WHY only with local_history, and encrypted with its key:
+// The cache holds clip text, so it follows the same opt-in and the same
+// keyring protection as the local history (see history.go).
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/i18n"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// searchCacheFileName is the search cache file created next to the agent
+// config.
+const searchCacheFileName = "search-cache.jsonl"
+
+// searchCacheQueries is how many distinct queries the cache remembers.
+const searchCacheQueries = 50
+
+// searchSealLabel binds sealed search cache lines to their purpose (see
+// e2e.SealLocal).
+const searchSealLabel = "search"
+
+// SearchHit is one event in search results, as shown and as cached.
+type SearchHit struct {
+	Time        time.Time `json:"time"`
+	EventID     string    `json:"event_id"`
+	Device      string    `json:"device"` // source device
+	ContentType string    `json:"content_type"`
+	// FileName is set for file events, whose content is not kept.
+	FileName string `json:"file_name,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Size     int    `json:"size"`
+	Note     string `json:"note,omitempty"`
+}
+
+// searchCacheEntry is the last answer the hub gave to one query.
+type searchCacheEntry struct {
+	Query     string      `json:"query"`
+	FetchedAt time.Time   `json:"fetched_at"`
+	Hits      []SearchHit `json:"hits"`
+}
+
+// searchCachePath returns the search cache location for an agent config path.
+func searchCachePath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), searchCacheFileName)
+}
+
+// searchCacheKey normalizes a query so "Wifi" and "wifi " share an entry,
+// as they get the same answer from the hub.
+func searchCacheKey(query string) string {
+	return strings.ToLower(strings.TrimSpace(query))
+}
+
+// readSearchCache loads the cached entries, oldest first. A missing file is
+// an empty cache; unreadable lines are skipped as in ReadLocalHistory.
+func readSearchCache(path string, key []byte) ([]searchCacheEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search cache %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var entries []searchCacheEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry searchCacheEntry
+		data, err := e2e.OpenLocal(key, searchSealLabel, line)
+		if err == nil {
+			err = json.Unmarshal(data, &entry)
+		}
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read search cache %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// writeSearchCache replaces the cached answer for entry.Query, keeping the
+// newest searchCacheQueries queries and dropping hits older than maxAge.
+// WHY rewrite the whole file: It holds at most a few hundred small lines,
+// and write-then-rename never leaves a half-written cache behind.
+func writeSearchCache(path string, key []byte, entry searchCacheEntry, maxAge time.Duration) error {
+	entries, err := readSearchCache(path, key)
+	if err != nil {
+		return err
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.Query != entry.Query {
+			kept = append(kept, e)
+		}
+	}
+	kept = append(kept, entry)
+	if len(kept) > searchCacheQueries {
+		kept = kept[len(kept)-searchCacheQueries:]
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	w := bufio.NewWriter(f)
+	cutoff := time.Now().Add(-maxAge)
+	for _, e := range kept {
+		// WHY the local history's age limit: A clip that local_history_days
+		// says is too old to keep shouldn't linger here instead.
+		hits := make([]SearchHit, 0, len(e.Hits))
+		for _, hit := range e.Hits {
+			if hit.Time.After(cutoff) {
+				hits = append(hits, hit)
+			}
+		}
+		e.Hits = hits
+		data, err := json.Marshal(e)
+		if err == nil {
+			var line string
+			if line, err = e2e.SealLocal(key, searchSealLabel, data); err == nil {
+				_, err = w.WriteString(line + "\n")
+			}
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write search cache: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// searchHub asks the hub for the newest limit events matching query,
+// decrypting encrypted ones with syncer's key.
+// WHY skip clips that don't open: A clip sealed with another key is as
+// unreadable here as on the clipboard; the rest of the results still count.
+func searchHub(syncer *Syncer, query string, limit int) ([]SearchHit, error) {
+	events, err := syncer.hub.History(client.HistoryOptions{Query: query, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]SearchHit, 0, len(events))
+	for i := range events {
+		event := &events[i]
+		if event.Encrypted {
+			if err := syncer.openEvent(event); err != nil {
+				fmt.Fprintln(os.Stderr, i18n.T("cli.search.skipped", event.EventID, err))
+				continue
+			}
+		}
+		hits = append(hits, newSearchHit(event))
+	}
+	return hits, nil
+}
+
+// newSearchHit converts an event from the hub into a search hit. File
+// contents are left out; the hit only names the file.
+func newSearchHit(event *models.Event) SearchHit {
+	hit := SearchHit{
+		Time:        event.Timestamp,
+		EventID:     event.EventID,
+		Device:      event.SourceDeviceID,
+		ContentType: event.ContentType,
+		Size:        len(event.Text),
+		Note:        event.Note,
+	}
+	if event.ContentType == models.ContentTypeFile {
+		hit.FileName = event.FileName
+	} else {
+		hit.Text = event.Text
+	}
+	return hit
+}
+
+// runSearch implements `agent search [-n N] [-copy ID] <query> [config-path]`.
+func runSearch(args []string) error {
+	fs := newCommandFlags("search")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent search [flags] <query> [config-path]\n")
+		fs.PrintDefaults()
+	}
+	limit := fs.Int("n", 20, "number of matching clips to fetch, newest first")
+	copyID := fs.String("copy", "", "put the result whose event ID starts with this on the clipboard")
+	addJSONFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || strings.TrimSpace(fs.Arg(0)) == "" {
+		fs.Usage()
+		return fmt.Errorf("a search query is required")
+	}
+	if *limit <= 0 || *limit > 500 {
+		return fmt.Errorf("-n must be between 1 and 500")
+	}
+	query := fs.Arg(0)
+	configPath := defaultConfigPath
+	if fs.NArg() > 1 {
+		configPath = fs.Arg(1)
+	}
+
+	cfg, err := loadCommandConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+	syncer := NewSyncer(cfg.HubURL, cfg.AuthToken, cfg.DeviceID, nil)
+	syncer.EncryptWith(cfg.GetEncryptionKey())
+	if proxy := cfg.GetProxy(); proxy != nil {
+		syncer.UseProxy(proxy)
+	}
+
+	// WHY no cache without a history key: See the file header. Creating the
+	// key here is fine - local_history asked for one.
+	var cacheKey []byte
+	cachePath := searchCachePath(configPath)
+	if cfg.LocalHistory > 0 {
+		if cacheKey, err = historyKey(cfg.DeviceID, true); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.T("cli.search.cache_disabled", err))
+		}
+	}
+
+	hits, err := searchHub(syncer, query, *limit)
+	var status *client.StatusError
+	switch {
+	case err == nil:
+		if cacheKey != nil {
+			entry := searchCacheEntry{Query: searchCacheKey(query), FetchedAt: time.Now().UTC(), Hits: hits}
+			if err := writeSearchCache(cachePath, cacheKey, entry, cfg.GetLocalHistoryAge()); err != nil {
+				fmt.Fprintf(os.Stderr, "WARN: %v\n", err)
+			}
+		}
+
+	case errors.As(err, &status) || cacheKey == nil:
+		// WHY not fall back on a refusal: The hub answered; a 401 or 400
+		// is something to fix, not something to paper over with old results.
+		return fmt.Errorf("search failed: %w", err)
+
+	default:
+		entries, cacheErr := readSearchCache(cachePath, cacheKey)
+		if cacheErr != nil {
+			return fmt.Errorf("search failed: %w (and %v)", err, cacheErr)
+		}
+		var cached *searchCacheEntry
+		for i := range entries {
+			if entries[i].Query == searchCacheKey(query) {
+				cached = &entries[i]
+			}
+		}
+		if cached == nil {
+			return fmt.Errorf("search failed and %q was never searched while the hub was reachable: %w", query, err)
+		}
+		fmt.Fprintln(os.Stderr, i18n.T("cli.search.stale",
+			err, cached.FetchedAt.Local().Format("2006-01-02 15:04:05")))
+		hits = cached.Hits
+		if len(hits) > *limit {
+			hits = hits[:*limit]
+		}
+	}
+
+	if *copyID != "" {
+		for _, hit := range hits {
+			if !strings.HasPrefix(hit.EventID, *copyID) {
+				continue
+			}
+			if hit.FileName != "" {
+				return fmt.Errorf("event %s is a file (%s); only text results can be copied", hit.EventID, hit.FileName)
+			}
+			if err := WriteClipboard(hit.Text); err != nil {
+				return fmt.Errorf("failed to write clipboard: %w", err)
+			}
+			fmt.Println(i18n.T("cli.copied", hit.EventID, formatBytes(len(hit.Text))))
+			return nil
+		}
+		return fmt.Errorf("no result with event ID %s... for %q", *copyID, query)
+	}
+
+	// WHY ExitEmpty after printing: Scripts test the code, people read
+	// the message (or the empty list).
+	if jsonOutput {
+		if err := cli.PrintJSON(nonNil(hits)); err != nil || len(hits) > 0 {
+			return err
+		}
+		return cli.Exit(cli.ExitEmpty, nil)
+	}
+	if len(hits) == 0 {
+		fmt.Println(i18n.T("cli.search.none", query))
+		return cli.Exit(cli.ExitEmpty, nil)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, i18n.T("cli.clips.header"))
+	for _, hit := range hits {
+		preview := hit.Text
+		if hit.FileName != "" {
+			preview = i18n.T("cli.search.file", hit.FileName)
+		}
+		preview = strings.Join(strings.Fields(preview), " ")
+		if len(preview) > 60 {
+			preview = preview[:60] + "..."
+		}
+		if hit.Note != "" {
+			preview += i18n.T("cli.search.note", hit.Note)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			hit.Time.Local().Format("2006-01-02 15:04:05"), hit.EventID,
+			hit.Device, formatBytes(hit.Size), preview)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,270 @@
+// Author: Toluwalase Mebaanne
+// Package main provides clip signing for the TailClip agent: signing the
+// clips this device pushes, and checking the signatures of the clips it
+// receives.
+//
+// WHY the private key lives in the OS keyring:
+// Like the local history key, it must not sit in a config file that gets
+// copied between machines or into backups - a copied key signs as this
+// device. Without a keyring, sign_clips is off with a warning.
+//
+// WHY trust on first use:
+// A receiver has to learn each device's key from somewhere, and the hub is
+// the one party this is meant to protect against. So each agent pins the
+// key it first sees a device sign with, in signers.json next to the config,
+// and from then on applies that device's clips only if they verify with it.
+// The hub refuses keys other than the one a device registered, which keeps
+// another holder of the shared token from getting in first. To compare keys
+// out of band, `agent signers` shows fingerprints.
+//
+// Usage:
+//
+//	agent signers [-forget DEVICE] [config-path]
+
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/i18n"
+	"github.com/tmair/tailclip/shared/models"
+	"github.com/zalando/go-keyring"
+)
+
+// signersFileName is the pinned signing keys file created next to the
+// agent config.
+const signersFileName = "signers.json"
+
+// pinnedSigner is a device's signing key as first seen.
+type pinnedSigner struct {
+	Key   string    `json:"key"`
+	Since time.Time `json:"since"`
+}
+
+// signerPins maps device IDs to the keys their clips must be signed with.
+// WHY a mutex: Clips are checked on the WebSocket goroutine and by the
+// history picker's.
+type signerPins struct {
+	mu      sync.Mutex
+	path    string
+	signers map[string]pinnedSigner
+	// require refuses unsigned clips from devices without a pinned key too
+	// (require_signatures).
+	require bool
+}
+
+// signersPath returns the pinned signers location for an agent config path.
+func signersPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), signersFileName)
+}
+
+// signingKeyringUser is the keyring account the signing key of deviceID is
+// stored under.
+// WHY per device: Same as historyKeyringUser.
+func signingKeyringUser(deviceID string) string {
+	return "signing-key:" + deviceID
+}
+
+// signingKey returns this device's signing key from the OS keyring,
+// creating and storing one if create is set and there is none yet.
+func signingKey(deviceID string, create bool) (ed25519.PrivateKey, error) {
+	user := signingKeyringUser(deviceID)
+	encoded, err := keyring.Get(historyKeyringService, user)
+	if err == nil {
+		key, err := e2e.ParseSigningKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("signing key in the OS keyring (%s / %s) is malformed", historyKeyringService, user)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("OS keyring unavailable: %w", err)
+	}
+	if !create {
+		return nil, fmt.Errorf("no signing key in the OS keyring for device %s", deviceID)
+	}
+
+	key, err := e2e.GenerateSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := keyring.Set(historyKeyringService, user, e2e.EncodeSigningKey(key)); err != nil {
+		return nil, fmt.Errorf("failed to store signing key in the OS keyring: %w", err)
+	}
+	return key, nil
+}
+
+// loadSignerPins reads the pinned signers at path. A missing file has none.
+func loadSignerPins(path string, require bool) (*signerPins, error) {
+	pins := &signerPins{path: path, signers: map[string]pinnedSigner{}, require: require}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pins, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &pins.signers); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return pins, nil
+}
+
+// check decides whether event may be applied, pinning the key of a device
+// seen signing for the first time. A nil *signerPins accepts everything.
+// WHY refuse an unsigned clip from a pinned device: Dropping the signature
+// is the easiest forgery of all.
+func (p *signerPins) check(event *models.Event) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pinned, known := p.signers[event.SourceDeviceID]
+	if !event.IsSigned() {
+		switch {
+		case known:
+			return fmt.Errorf("clip is not signed, but device %s signs its clips (key %s)", event.SourceDeviceID, e2e.KeyFingerprint(pinned.Key))
+		case p.require:
+			return fmt.Errorf("clip is not signed (require_signatures)")
+		}
+		return nil
+	}
+	if err := e2e.VerifyEvent(event); err != nil {
+		return err
+	}
+	if known {
+		if pinned.Key != event.SigningKey {
+			return fmt.Errorf("clip is signed with key %s, but device %s signs with %s (run `agent signers -forget %s` if it was reinstalled)",
+				e2e.KeyFingerprint(event.SigningKey), event.SourceDeviceID, e2e.KeyFingerprint(pinned.Key), event.SourceDeviceID)
+		}
+		return nil
+	}
+
+	p.signers[event.SourceDeviceID] = pinnedSigner{Key: event.SigningKey, Since: time.Now().UTC()}
+	if err := p.save(); err != nil {
+		syncLog.Warnf("failed to save %s: %v", p.path, err)
+	}
+	syncLog.Infof("Pinned the signing key of device %s (%s)", event.SourceDeviceID, e2e.KeyFingerprint(event.SigningKey))
+	return nil
+}
+
+// save writes the pins with write-then-rename. Caller must hold mu.
+func (p *signerPins) save() error {
+	data, err := json.MarshalIndent(p.signers, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// SignWith signs every pushed clip with key, and registers its public half
+// with the hub.
+func (s *Syncer) SignWith(key ed25519.PrivateKey) {
+	s.signingKey = key
+}
+
+// VerifySignersWith checks received clips against pins (see
+// signerPins.check).
+func (s *Syncer) VerifySignersWith(pins *signerPins) {
+	s.signers = pins
+}
+
+// setUpSigning configures syncer for sign_clips and for checking received
+// clips against the signers pinned next to configPath.
+// WHY continue without them: Like the local history, a machine without a
+// keyring still syncs, and an unreadable pins file only loses the pins;
+// both are logged.
+func setUpSigning(syncer *Syncer, configPath string, cfg *config.AgentConfig) {
+	if cfg.SignClips {
+		key, err := signingKey(cfg.DeviceID, true)
+		if err != nil {
+			agentLog.Warnf("sign_clips disabled: %v", err)
+		} else {
+			syncer.SignWith(key)
+			agentLog.Infof("Signing clips with key %s", e2e.KeyFingerprint(e2e.PublicSigningKey(key)))
+		}
+	}
+	syncer.VerifySignersWith(openSignerPins(configPath, cfg))
+}
+
+// openSignerPins reads the signers pinned next to configPath, or starts
+// with none if the file can't be read.
+func openSignerPins(configPath string, cfg *config.AgentConfig) *signerPins {
+	path := signersPath(configPath)
+	pins, err := loadSignerPins(path, cfg.RequireSignatures)
+	if err != nil {
+		agentLog.Warnf("starting without pinned signing keys: %v", err)
+		return &signerPins{path: path, signers: map[string]pinnedSigner{}, require: cfg.RequireSignatures}
+	}
+	return pins
+}
+
+// runSigners implements `agent signers [-forget DEVICE] [config-path]`: it
+// lists this device's key and the pinned keys of others, or forgets one.
+func runSigners(args []string) error {
+	fs := newCommandFlags("signers")
+	forget := fs.String("forget", "", "forget the pinned key of `DEVICE`, so its next one is pinned")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := commandConfigPath(fs)
+	cfg, err := loadCommandConfig(path)
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+	pins, err := loadSignerPins(signersPath(path), false)
+	if err != nil {
+		return err
+	}
+
+	if *forget != "" {
+		if _, ok := pins.signers[*forget]; !ok {
+			return fmt.Errorf("no signing key pinned for device %s", *forget)
+		}
+		delete(pins.signers, *forget)
+		if err := pins.save(); err != nil {
+			return err
+		}
+		fmt.Println(i18n.T("cli.signers.forgot", *forget))
+		return nil
+	}
+
+	if key, err := signingKey(cfg.DeviceID, false); err == nil {
+		fmt.Println(i18n.T("cli.signers.self", cfg.DeviceID, e2e.KeyFingerprint(e2e.PublicSigningKey(key))))
+	} else {
+		fmt.Println(i18n.T("cli.signers.unsigned", cfg.DeviceID, err))
+	}
+	if len(pins.signers) == 0 {
+		fmt.Println(i18n.T("cli.signers.none"))
+		return nil
+	}
+	devices := make([]string, 0, len(pins.signers))
+	for device := range pins.signers {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, i18n.T("cli.signers.header"))
+	for _, device := range devices {
+		pinned := pins.signers[device]
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", device, e2e.KeyFingerprint(pinned.Key), pinned.Since.Local().Format(time.DateTime))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,37 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the exclude_apps check: copies made in a listed
+// application are never sent.
+//
+// WHY by application:
+// A password manager's copies are secrets by definition, whatever they look
+// like, so no content pattern can catch them all. Naming the app catches
+// every one of them, and nothing else.
+//
+// WHY one function per platform:
+// Each platform answers "who copied this?" differently - Windows knows the
+// clipboard's owner, macOS and X11 only the app in front. Each
+// clipboardSourceApp returns a name, or "" where it can't tell (Wayland, other
+// platforms), and the check then lets the copy through.
+
+package main
+
+import "github.com/tmair/tailclip/shared/config"
+
+// excludedSource reports whether the clipboard change with hash came from an
+// app in exclude_apps, and journals it if so.
+// WHY ask right away: The app in front can change soon after the copy; the
+// earlier the question, the likelier the answer is the app that copied.
+func excludedSource(syncer *Syncer, cfg *config.AgentConfig, hash string, size int) bool {
+	if len(cfg.ExcludeApps) == 0 {
+		return false
+	}
+	app := clipboardSourceApp()
+	if !cfg.ExcludesApp(app) {
+		clipboardLog.Debugf("Clipboard change came from %q", app)
+		return false
+	}
+	agentLog.Infof("Not sending clipboard change: it came from %s, which is in exclude_apps", app)
+	syncer.journal.Record(JournalEntry{Action: journalFiltered, Hash: hash, Size: size,
+		Detail: "exclude_apps: " + app})
+	return true
+}
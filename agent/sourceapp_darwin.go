@@ -0,0 +1,34 @@
+// Author: Toluwalase Mebaanne
+// Package main provides clipboard source detection on macOS.
+
+//go:build darwin
+
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// clipboardSourceApp returns the name of the frontmost application, e.g.
+// "1Password 7".
+// WHY the frontmost app: The pasteboard doesn't record who wrote it; the
+// app in front almost always did.
+// WHY lsappinfo: It answers without the Accessibility permission that
+// asking System Events through osascript needs.
+func clipboardSourceApp() string {
+	front, err := exec.Command("lsappinfo", "front").Output()
+	if err != nil {
+		return ""
+	}
+	info, err := exec.Command("lsappinfo", "info", "-only", "name", strings.TrimSpace(string(front))).Output()
+	if err != nil {
+		return ""
+	}
+	// The reply looks like: "LSDisplayName"="1Password 7"
+	_, name, ok := strings.Cut(strings.TrimSpace(string(info)), "=")
+	if !ok {
+		return ""
+	}
+	return strings.Trim(name, `"`)
+}
@@ -0,0 +1,46 @@
+// Author: Toluwalase Mebaanne
+// Package main provides clipboard source detection on Linux.
+
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// clipboardSourceApp returns the window class of the active X11 window,
+// e.g. "KeePassXC", or "" under Wayland or without xprop.
+// WHY the active window: X11 reports the selection owner only as a window
+// ID, and many apps hand ownership to a hidden window; the focused window is
+// almost always the app that just copied.
+// WHY nothing under Wayland: It deliberately tells clients nothing about
+// other apps' windows.
+func clipboardSourceApp() string {
+	if os.Getenv("WAYLAND_DISPLAY") != "" || os.Getenv("DISPLAY") == "" {
+		return ""
+	}
+	// The reply looks like: _NET_ACTIVE_WINDOW(WINDOW): window id # 0x3a00007
+	out, err := exec.Command("xprop", "-root", "_NET_ACTIVE_WINDOW").Output()
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 || !strings.HasPrefix(fields[len(fields)-1], "0x") {
+		return ""
+	}
+	// The reply looks like: WM_CLASS(STRING) = "keepassxc", "KeePassXC"
+	// WHY the second string: It is the application class; the first is the
+	// instance name, which varies with how the app was started.
+	out, err = exec.Command("xprop", "-id", fields[len(fields)-1], "WM_CLASS").Output()
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(string(out), `"`)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
@@ -0,0 +1,11 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the fallback for platforms without clipboard
+// source detection.
+
+//go:build !windows && !linux && !darwin
+
+package main
+
+// clipboardSourceApp can't tell which app copied, so exclude_apps lets
+// every copy through.
+func clipboardSourceApp() string { return "" }
@@ -0,0 +1,59 @@
+// Author: Toluwalase Mebaanne
+// Package main provides clipboard source detection on Windows.
+
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// processQueryLimitedInformation is the PROCESS_QUERY_LIMITED_INFORMATION
+// access right, enough to read another user process's image name.
+const processQueryLimitedInformation = 0x1000
+
+var (
+	procGetClipboardOwner          = user32.NewProc("GetClipboardOwner")
+	procGetForegroundWindow        = user32.NewProc("GetForegroundWindow")
+	procGetWindowThreadProcessId   = user32.NewProc("GetWindowThreadProcessId")
+	procQueryFullProcessImageNameW = kernel32.NewProc("QueryFullProcessImageNameW")
+)
+
+// clipboardSourceApp returns the executable name, without ".exe", of the
+// process that owns the clipboard, e.g. "KeePassXC".
+// WHY the owner: Windows records which window last wrote the clipboard, so
+// unlike the foreground window it is still right after a focus change. Apps
+// that write without a window leave no owner; the foreground window is the
+// best guess then.
+func clipboardSourceApp() string {
+	hwnd, _, _ := procGetClipboardOwner.Call()
+	if hwnd == 0 {
+		hwnd, _, _ = procGetForegroundWindow.Call()
+	}
+	if hwnd == 0 {
+		return ""
+	}
+	var pid uint32
+	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&pid)))
+	if pid == 0 {
+		return ""
+	}
+	process, err := syscall.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(process)
+
+	buf := make([]uint16, syscall.MAX_PATH)
+	size := uint32(len(buf))
+	if r, _, _ := procQueryFullProcessImageNameW.Call(uintptr(process), 0,
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size))); r == 0 {
+		return ""
+	}
+	name := filepath.Base(syscall.UTF16ToString(buf[:size]))
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
@@ -0,0 +1,248 @@
+// Author: Toluwalase Mebaanne
+// Package main provides `agent status` and `agent devices`: what this agent
+// and the hub look like from the command line.
+//
+// WHY commands next to the dashboard:
+// The dashboard needs a browser and the hub's token. These answer "is sync
+// working on this machine, and who else is there" from a terminal or a
+// script (with --json), using the agent's own config.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/i18n"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// agentStatus is what `agent status` reports.
+type agentStatus struct {
+	DeviceID     string `json:"device_id"`
+	DeviceName   string `json:"device_name"`
+	HubURL       string `json:"hub_url"`
+	HubReachable bool   `json:"hub_reachable"`
+	// HubError says why the hub couldn't be reached or refused the token.
+	HubError    string `json:"hub_error,omitempty"`
+	HubLatency  int64  `json:"hub_latency_ms,omitempty"`
+	WireVersion int    `json:"wire_version,omitempty"`
+	// DevicesOnline is nil when the agent's token can't list devices (a
+	// device token; see `agent enroll`).
+	DevicesOnline *int `json:"devices_online,omitempty"`
+	Encryption    bool `json:"encryption"`
+	// MaxUploadKBPerSec and MaxDownloadKBPerSec are the configured
+	// bandwidth limits; 0 is unlimited.
+	MaxUploadKBPerSec   int `json:"max_upload_kb_per_sec"`
+	MaxDownloadKBPerSec int `json:"max_download_kb_per_sec"`
+	// LastPushed and LastReceived come from the journal.
+	LastPushed   *time.Time `json:"last_pushed,omitempty"`
+	LastReceived *time.Time `json:"last_received,omitempty"`
+	// Agent is the running agent's state from its control endpoint; nil if
+	// no agent is running with this config.
+	Agent *controlStatus `json:"agent,omitempty"`
+}
+
+// newCommandClient returns a hub client for an agent config, using its proxy.
+func newCommandClient(cfg *config.AgentConfig) *client.Client {
+	hub := client.New(cfg.HubURL, cfg.AuthToken)
+	if proxy := cfg.GetProxy(); proxy != nil {
+		hub.UseProxy(proxy)
+	}
+	return hub
+}
+
+// runStatus implements `agent status [config-path]`.
+// WHY report an unreachable hub instead of failing: "The hub is down" is
+// the answer, not an error in the command.
+func runStatus(args []string) error {
+	fs := newCommandFlags("status")
+	addJSONFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	configPath := commandConfigPath(fs)
+	cfg, err := loadCommandConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+
+	status := agentStatus{DeviceID: cfg.DeviceID, DeviceName: cfg.DeviceName,
+		HubURL: cfg.HubURL, Encryption: cfg.GetEncryptionKey() != nil,
+		MaxUploadKBPerSec: cfg.MaxUploadKBPerSec, MaxDownloadKBPerSec: cfg.MaxDownloadKBPerSec}
+	hub := newCommandClient(cfg)
+	start := time.Now()
+	caps, err := hub.Capabilities()
+	if err != nil {
+		status.HubError = err.Error()
+	} else {
+		status.HubReachable = true
+		status.HubLatency = time.Since(start).Milliseconds()
+		status.WireVersion = caps.WireVersion
+		if devices, err := hub.Devices(); err == nil {
+			online := 0
+			for _, device := range devices {
+				if device.Online && device.DeviceID != cfg.DeviceID {
+					online++
+				}
+			}
+			status.DevicesOnline = &online
+		}
+	}
+	// WHY ignore a missing journal: A fresh install has none yet.
+	if entries, err := ReadJournal(journalPath(configPath)); err == nil {
+		for i := range entries {
+			switch entries[i].Action {
+			case journalPushed:
+				status.LastPushed = &entries[i].Time
+			case journalApplied:
+				status.LastReceived = &entries[i].Time
+			}
+		}
+	}
+	if agent, err := controlRequest(configPath, http.MethodGet, "/v1/status"); err == nil {
+		status.Agent = agent
+	}
+
+	if jsonOutput {
+		return cli.PrintJSON(status)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, i18n.T("cli.status.device", status.DeviceName, status.DeviceID))
+	fmt.Fprintln(tw, i18n.T("cli.status.agent", describeAgent(status.Agent)))
+	if status.HubReachable {
+		fmt.Fprintln(tw, i18n.T("cli.status.hub_reachable", status.HubURL, status.HubLatency, status.WireVersion))
+	} else {
+		fmt.Fprintln(tw, i18n.T("cli.status.hub_unreachable", status.HubURL, status.HubError))
+	}
+	if status.DevicesOnline != nil {
+		fmt.Fprintln(tw, i18n.T("cli.status.devices_online", *status.DevicesOnline))
+	}
+	fmt.Fprintln(tw, i18n.T("cli.status.encryption", onOff(status.Encryption)))
+	if status.Agent != nil {
+		fmt.Fprintln(tw, i18n.T("cli.status.traffic",
+			formatBytes(int(status.Agent.Traffic.SentBytes)), formatBytes(int(status.Agent.Traffic.ReceivedBytes))))
+	}
+	if status.Agent != nil && status.Agent.Metered {
+		fmt.Fprintln(tw, i18n.T("cli.status.metered", status.Agent.HeldClips))
+	}
+	fmt.Fprintln(tw, i18n.T("cli.status.bandwidth", describeRate(status.MaxUploadKBPerSec), describeRate(status.MaxDownloadKBPerSec)))
+	fmt.Fprintln(tw, i18n.T("cli.status.last_pushed", formatLast(status.LastPushed)))
+	fmt.Fprintln(tw, i18n.T("cli.status.last_received", formatLast(status.LastReceived)))
+	return tw.Flush()
+}
+
+// describeAgent describes the running agent's state in a few words.
+func describeAgent(agent *controlStatus) string {
+	switch {
+	case agent == nil:
+		return i18n.T("cli.agent.not_running")
+	case agent.PausedUntil != nil:
+		return i18n.T("cli.agent.paused_until", agent.PausedUntil.Local().Format(time.TimeOnly))
+	case agent.Paused:
+		return i18n.T("cli.agent.paused")
+	case !agent.Connected:
+		return i18n.T("cli.agent.disconnected")
+	default:
+		return i18n.T("cli.agent.running")
+	}
+}
+
+// runDevices implements `agent devices [config-path]`.
+func runDevices(args []string) error {
+	fs := newCommandFlags("devices")
+	addJSONFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loadCommandConfig(commandConfigPath(fs))
+	if err != nil {
+		return fmt.Errorf("failed to load agent config: %w", err)
+	}
+
+	devices, err := newCommandClient(cfg).Devices()
+	var status *client.StatusError
+	if errors.As(err, &status) && status.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("listing devices needs the hub's shared auth_token, not a device token: %w", err)
+	}
+	if err != nil {
+		return err
+	}
+	if devices == nil {
+		devices = []models.DeviceStatus{}
+	}
+
+	if jsonOutput {
+		return cli.PrintJSON(devices)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, i18n.T("cli.devices.header"))
+	for _, device := range devices {
+		state := i18n.T("cli.devices.offline")
+		switch {
+		case !device.Enabled:
+			state = i18n.T("cli.devices.disabled")
+		case device.Connected:
+			state = i18n.T("cli.devices.connected")
+		case device.Online:
+			state = i18n.T("cli.devices.online")
+		}
+		name := device.DeviceName
+		if device.DeviceID == cfg.DeviceID {
+			name += i18n.T("cli.devices.this")
+		}
+		lastSeen := "-"
+		if !device.LastSeenUTC.IsZero() {
+			lastSeen = device.LastSeenUTC.Local().Format("2006-01-02 15:04:05")
+		}
+		// WHY fingerprints: They can be compared with `agent signers` on
+		// each device, which is what makes the pinned keys trustworthy.
+		signer := "-"
+		if device.SigningKey != "" {
+			signer = e2e.KeyFingerprint(device.SigningKey)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", device.DeviceID, name, state, lastSeen, signer)
+	}
+	return tw.Flush()
+}
+
+// onOff formats a setting for status output.
+func onOff(on bool) string {
+	if on {
+		return i18n.T("cli.status.on")
+	}
+	return i18n.T("cli.status.off")
+}
+
+// formatRate formats a bandwidth limit in KB/s for the log.
+func formatRate(kbPerSec int) string {
+	if kbPerSec == 0 {
+		return "unlimited"
+	}
+	return formatBytes(kbPerSec*1024) + "/s"
+}
+
+// describeRate formats a bandwidth limit for status output.
+// WHY not formatRate: That one also goes into the log, which stays English.
+func describeRate(kbPerSec int) string {
+	if kbPerSec == 0 {
+		return i18n.T("cli.status.unlimited")
+	}
+	return formatRate(kbPerSec)
+}
+
+// formatLast formats a journal time for status output.
+func formatLast(t *time.Time) string {
+	if t == nil {
+		return i18n.T("cli.status.never")
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
@@ -1,5 +1,7 @@
 // Author: Toluwalase Mebaanne
 // Package main provides hub communication for the TailClip agent.
+// The wire protocol itself lives in shared/client; this file decides what
+// the agent does with it (caching, journaling, writing the clipboard).
 //
 // WHY separate sync logic from clipboard and main:
 // Sync handles all network communication with the hub (pushing events,
@@ -10,17 +12,22 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/handlers"
 	"github.com/tmair/tailclip/shared/models"
+	"github.com/tmair/tailclip/shared/wire"
 )
 
 // recentEventCache tracks recently seen event IDs to prevent sync loops.
@@ -104,38 +111,318 @@ func (c *recentEventCache) Prune() {
 	}
 }
 
+// maxReceivedTextLength caps the decompressed text of a received clip.
+// WHY not the negotiated limits: Those bound what this agent pushes; clips
+// from other devices only have to fit the hub's. This only stops a few KB
+// of gzip from expanding into gigabytes in memory.
+const maxReceivedTextLength = 64 * 1024 * 1024
+
 // Syncer handles all communication between the agent and the hub.
 //
 // WHY a struct instead of standalone functions:
-// Groups the hub URL, auth token, device ID, and event cache together.
+// Groups the hub client, device ID, and event cache together.
 // This avoids passing 4+ parameters to every sync function and makes
 // it easy to create test instances with mock configuration.
 type Syncer struct {
-	hubURL    string
-	authToken string
-	deviceID  string
-	cache     *recentEventCache
-	client    *http.Client
+	hub      *client.Client
+	deviceID string
+	cache    *recentEventCache
+
+	// maxTextLength is the negotiated text limit (see NegotiateCapabilities).
+	// WHY atomic: Written by the WebSocket goroutine on reconnect, read by
+	// the polling loop on every clipboard change.
+	maxTextLength atomic.Int64
+
+	// maxFileSize is the negotiated file limit; 0 when the hub can't take
+	// files. Atomic for the same reason as maxTextLength.
+	maxFileSize atomic.Int64
+
+	// downloadDir is where received files are saved; empty when this agent
+	// doesn't receive files (see ReceiveFilesInto).
+	downloadDir string
+
+	// journal records sync decisions for `agent journal`. May be nil.
+	journal *Journal
+
+	// history keeps sent and received clips for `agent history`. May be
+	// nil (see KeepHistoryIn).
+	history *LocalHistory
+
+	// catchUp tracks the last event seen for catch-up from history, or is
+	// nil (see CatchUpFrom).
+	catchUp *catchUpState
+
+	// channels are the channels subscribed to on the current connection.
+	// Only touched by the WebSocket goroutine.
+	channels []string
+
+	// outbox holds clips waiting for an unreachable hub, or is nil (see
+	// QueueOfflineUpTo).
+	outbox *outbox
+
+	// meteredHeld holds large clips while the connection is metered, or is
+	// nil (see DeferLargeWhileMetered).
+	meteredHeld *meteredQueue
+
+	// sendDelay holds copied clips before they are pushed, or is nil (see
+	// DelaySendsBy).
+	sendDelay *sendDelay
+
+	// pins is the quick-access list of clips pinned for this device, or
+	// nil (see KeepPinsIn).
+	pins *PinnedClips
+
+	// recent holds the last few synced clips for the tray menu, or is nil
+	// without a tray (see tray.go).
+	recent *recentClips
+
+	// paused stops clips from being sent or applied (see SetPaused).
+	// WHY atomic: Toggled from the tray's goroutine, read by the main loop
+	// and the WebSocket goroutine.
+	paused atomic.Bool
+
+	// pauseMu guards resumeAt and resumeTimer, which end a pause started
+	// with PauseFor.
+	pauseMu     sync.Mutex
+	resumeAt    time.Time
+	resumeTimer *time.Timer
+
+	// encryptionKey seals pushed clips and opens received ones; nil when
+	// clips travel in the clear (see EncryptWith).
+	encryptionKey []byte
+
+	// signingKey signs pushed clips; nil when this device doesn't sign
+	// (see SignWith).
+	signingKey ed25519.PrivateKey
+
+	// signers holds the keys received clips must be signed with; nil checks
+	// nothing (see VerifySignersWith).
+	signers *signerPins
+
+	// dataKeys provides the per-day keys clips are sealed with when the hub
+	// supports them; nil without encryptionKey.
+	dataKeys *dataKeyring
+
+	// hubDataKeys is set when the hub stores data keys (see
+	// NegotiateCapabilities). Atomic for the same reason as maxTextLength.
+	hubDataKeys atomic.Bool
+
+	// chunkSize is the hub's part size for chunked pushes, or 0 if it has
+	// none (see NegotiateCapabilities). Atomic for the same reason as
+	// maxTextLength.
+	chunkSize atomic.Int64
+
+	// compressThreshold is the text length above which pushes are
+	// compressed, or 0 (see CompressAbove).
+	compressThreshold int
+
+	// hubGzip is set when the hub can decompress pushes (see
+	// NegotiateCapabilities). Atomic for the same reason as maxTextLength.
+	hubGzip atomic.Bool
+
+	// registered is set once Register has succeeded.
+	// WHY atomic: Set on the main goroutine at startup, read by the
+	// WebSocket goroutine on every reconnect.
+	registered atomic.Bool
+
+	// acceptFrom, when non-empty, lists the only source devices whose clips
+	// are applied (see AcceptOnlyFrom).
+	// WHY atomic: A reloaded config replaces it while the WebSocket
+	// goroutine reads it (see reload.go).
+	acceptFrom atomic.Pointer[[]string]
+
+	// notifyEnabled shows notifications on receipt (see NotifyOnReceive).
+	// Atomic for the same reason as acceptFrom.
+	notifyEnabled atomic.Bool
+
+	// restore is the pending clipboard restore after a transient clip, or
+	// nil (see restore.go).
+	// WHY a mutex: Set by the WebSocket goroutine, cleared by the timer's.
+	restoreMu sync.Mutex
+	restore   *pendingRestore
+
+	// conn is the WebSocket connection ReceiveFromHub is reading, or nil.
+	// WHY kept: DropConnection closes it from the main loop after a wake.
+	connMu sync.Mutex
+	conn   *websocket.Conn
+
+	// sessionToken and lastSeq identify the hub WebSocket session to resume
+	// on reconnect and the last broadcast received in it (see
+	// models.Session). Only touched by the WebSocket goroutine.
+	sessionToken string
+	lastSeq      uint64
+
+	// appliedID and appliedHash identify the last clip written to the
+	// clipboard from the hub, for clearing it if it is deleted (see
+	// clearDeleted). Only touched by the WebSocket goroutine.
+	appliedID   string
+	appliedHash string
+
+	// peers is the number of other devices the hub reports online, or -1
+	// while unknown (disconnected, or a hub without presence support).
+	// WHY atomic: Written by the WebSocket goroutine, read by the main loop.
+	peers atomic.Int32
+
+	// presenceChanged is signalled whenever peers changes.
+	// WHY buffered with size 1: The main loop only needs to know "something
+	// changed" and re-reads peers; coalescing bursts avoids blocking the
+	// WebSocket goroutine.
+	presenceChanged chan struct{}
 }
 
 // NewSyncer creates a Syncer configured for the given hub.
+func NewSyncer(hubURL, authToken, deviceID string, journal *Journal) *Syncer {
+	s := &Syncer{
+		hub:             client.New(hubURL, authToken),
+		deviceID:        deviceID,
+		journal:         journal,
+		cache:           newRecentEventCache(5 * time.Minute),
+		presenceChanged: make(chan struct{}, 1),
+	}
+	s.maxTextLength.Store(handlers.DefaultMaxTextLength)
+	s.maxFileSize.Store(handlers.DefaultMaxFileSize)
+	s.peers.Store(-1)
+	return s
+}
+
+// UseProxy routes hub requests and the WebSocket connection through proxyURL
+// instead of the proxy environment variables.
+func (s *Syncer) UseProxy(proxyURL *url.URL) {
+	s.hub.UseProxy(proxyURL)
+}
+
+// LimitBandwidth caps the rates, in bytes per second, at which the syncer
+// sends to and receives from the hub (0 is unlimited), and counts its
+// traffic for Traffic. Like UseProxy, it is called before syncing starts.
+func (s *Syncer) LimitBandwidth(upload, download int) {
+	s.hub.LimitBandwidth(upload, download)
+}
+
+// Traffic returns what the syncer has sent to and received from the hub
+// since LimitBandwidth.
+func (s *Syncer) Traffic() client.Traffic {
+	return s.hub.Traffic()
+}
+
+// AcceptOnlyFrom restricts received clips to the given source device IDs.
+// An empty list accepts clips from every device.
+func (s *Syncer) AcceptOnlyFrom(deviceIDs []string) {
+	s.acceptFrom.Store(&deviceIDs)
+}
+
+// accepts reports whether clips from deviceID pass AcceptOnlyFrom.
+func (s *Syncer) accepts(deviceID string) bool {
+	acceptFrom := s.acceptFrom.Load()
+	return acceptFrom == nil || len(*acceptFrom) == 0 || slices.Contains(*acceptFrom, deviceID)
+}
+
+// NotifyOnReceive turns desktop notifications for received clips, files,
+// and hub alerts on or off.
+func (s *Syncer) NotifyOnReceive(enabled bool) {
+	s.notifyEnabled.Store(enabled)
+}
+
+// EncryptWith encrypts pushed clips end to end with key and decrypts
+// received ones (see shared/e2e). A nil key sends clips in the clear.
+func (s *Syncer) EncryptWith(key []byte) {
+	s.encryptionKey = key
+	if key != nil {
+		s.dataKeys = newDataKeyring(s.hub, key)
+	}
+}
+
+// CompressAbove compresses pushed clips whose text is longer than threshold
+// bytes, when the hub supports it. 0 pushes every clip uncompressed.
+func (s *Syncer) CompressAbove(threshold int) {
+	s.compressThreshold = threshold
+}
+
+// KeepHistoryIn records clips this agent sends and applies in history.
+func (s *Syncer) KeepHistoryIn(history *LocalHistory) {
+	s.history = history
+}
+
+// keepInHistory adds a text clip to the local history, unless it is
+// transient.
+// WHY not transient clips: They are sensitive by definition, and the point
+// of their expiry is that they don't stay around.
+func (s *Syncer) keepInHistory(event *models.Event) {
+	if event.IsTransient() {
+		return
+	}
+	clip := LocalClip{Time: event.Timestamp, EventID: event.EventID,
+		Device: event.SourceDeviceID, Channel: event.Channel, Text: event.Text}
+	s.history.Add(clip)
+	s.recent.add(clip)
+}
+
+// ReceiveFilesInto asks the hub for file clips and saves them in dir.
+// WHY opt-in: Without it the hub never sends this agent files, which is
+// what receive_files=false means.
+func (s *Syncer) ReceiveFilesInto(dir string) {
+	s.downloadDir = dir
+}
+
+// FetchCapabilities asks the hub which limits it enforces.
+func (s *Syncer) FetchCapabilities() (*models.Capabilities, error) {
+	return s.hub.Capabilities()
+}
+
+// NegotiateCapabilities adopts the stricter of the local and hub limits.
+//
+// WHY the stricter one: A clip larger than the hub's limit would be rejected
+// after uploading it; a clip larger than the local limit is one the user
+// asked not to send. Either way it should be skipped before pushing.
+//
+// WHY keep the local limit when the hub is unreachable: Older hubs lack the
+// endpoint, and an offline hub will be renegotiated on the next reconnect.
 //
-// WHY set an HTTP client timeout:
-// Without a timeout, a hung hub would block the agent's goroutine forever,
-// preventing it from detecting new clipboard changes or recovering.
-// 10 seconds is generous for a LAN/Tailnet round trip.
-func NewSyncer(hubURL, authToken, deviceID string) *Syncer {
-	return &Syncer{
-		hubURL:    hubURL,
-		authToken: authToken,
-		deviceID:  deviceID,
-		cache:     newRecentEventCache(5 * time.Minute),
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+// WHY a hub without max_file_size means no files: It predates file sync and
+// would reject every file push as an unknown content type.
+func (s *Syncer) NegotiateCapabilities(localMaxTextLength, localMaxFileSize int) {
+	limit := handlers.NewTextHandler(localMaxTextLength).MaxLength()
+	fileLimit := handlers.NewFileHandler(localMaxFileSize).MaxSize()
+
+	caps, err := s.FetchCapabilities()
+	if err != nil {
+		syncLog.Warnf("capability negotiation failed, using local limits: %v", err)
+	} else {
+		if !wire.Compatible(caps.WireVersion) {
+			syncLog.Warnf("hub speaks wire version %d, this agent supports %d-%d; upgrade the older side",
+				caps.WireVersion, wire.MinVersion, wire.Version)
+		}
+		if caps.MaxTextLength > 0 && caps.MaxTextLength < limit {
+			limit = caps.MaxTextLength
+		}
+		fileLimit = min(fileLimit, caps.MaxFileSize)
+		s.hubDataKeys.Store(caps.DataKeys)
+		s.chunkSize.Store(int64(caps.ChunkSize))
+		s.hubGzip.Store(slices.Contains(caps.Compression, models.CompressionGzip))
+	}
+
+	if old := s.maxTextLength.Swap(int64(limit)); old != int64(limit) {
+		syncLog.Infof("Max text length set to %d bytes", limit)
+	}
+	if old := s.maxFileSize.Swap(int64(fileLimit)); old != int64(fileLimit) {
+		if fileLimit == 0 {
+			syncLog.Infof("Hub does not support file sync")
+		} else {
+			syncLog.Infof("Max file size set to %d bytes", fileLimit)
+		}
 	}
 }
 
+// MaxTextLength returns the negotiated text size limit in bytes.
+func (s *Syncer) MaxTextLength() int {
+	return int(s.maxTextLength.Load())
+}
+
+// MaxFileSize returns the negotiated file size limit in bytes, or 0 if the
+// hub doesn't accept files.
+func (s *Syncer) MaxFileSize() int {
+	return int(s.maxFileSize.Load())
+}
+
 // PushToHub sends a clipboard event to the hub's push endpoint.
 //
 // WHY POST with JSON body:
@@ -153,33 +440,85 @@ func (s *Syncer) PushToHub(event *models.Event) error {
 	// return from this function, especially on a fast LAN.
 	s.cache.Add(event.EventID)
 
-	data, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+	// WHY seal a copy: The caller keeps the plaintext event, e.g. to show
+	// it in a notification or journal its size.
+	if s.encryptionKey != nil {
+		sealed, err := s.sealEvent(event)
+		if err != nil {
+			return err
+		}
+		event = sealed
 	}
 
-	pushURL := fmt.Sprintf("%s/api/v1/clipboard/push", s.hubURL)
-	req, err := http.NewRequest(http.MethodPost, pushURL, bytes.NewReader(data))
-	if err != nil {
-		return fmt.Errorf("failed to create push request: %w", err)
+	// WHY sign after sealing and before compressing: Receivers check the
+	// signature before opening the clip, and after decompressing it.
+	if s.signingKey != nil {
+		signed := *event
+		e2e.SignEvent(s.signingKey, &signed)
+		event = &signed
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Auth-Token", s.authToken)
 
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("push request failed: %w", err)
+	// WHY compress before deciding on chunks: A paste that compresses well
+	// may then fit into a single request.
+	if s.hubGzip.Load() {
+		event = wire.Compress(event, s.compressThreshold)
+	}
+
+	// WHY chunk only large clips: A single request is one round trip; parts
+	// only pay off where a dropped connection would cost a lot to resend.
+	push := s.hub.Push
+	if chunkSize := int(s.chunkSize.Load()); chunkSize > 0 && len(event.Text) > chunkSize {
+		push = func(event *models.Event) error { return s.hub.PushChunked(event, chunkSize) }
+	}
+	if err := push(event); err != nil {
+		var status *client.StatusError
+		if errors.As(err, &status) && status.StatusCode == http.StatusRequestEntityTooLarge {
+			// WHY a distinct message: The hub's limit may have shrunk since we
+			// last negotiated; the next reconnect picks up the new value.
+			return fmt.Errorf("hub rejected event as too large (limit may have changed)")
+		}
+		if errors.As(err, &status) && status.StatusCode == http.StatusTooManyRequests {
+			// WHY a distinct message: The hub throttles devices that push
+			// too fast; the user should look for what is filling the clipboard.
+			return fmt.Errorf("hub is throttling this device for pushing too many clips: %s", status.Body)
+		}
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("hub returned status %d on push", resp.StatusCode)
+	syncLog.Infof("Pushed event %s to hub", event.EventID)
+	s.markSeen(event)
+	return nil
+}
+
+// Register announces this device to the hub.
+//
+// WHY register on startup:
+// The hub keys per-device settings (such as whether clips from this device
+// should trigger notifications elsewhere) off the devices table. Registering
+// guarantees the row exists, and doubles as a heartbeat for last-seen.
+func (s *Syncer) Register(deviceName string) error {
+	device := models.Device{
+		DeviceID:   s.deviceID,
+		DeviceName: deviceName,
+		Enabled:    true,
+	}
+	if s.signingKey != nil {
+		device.SigningKey = e2e.PublicSigningKey(s.signingKey)
+	}
+	if err := s.hub.Register(&device); err != nil {
+		return err
 	}
 
-	log.Printf("Pushed event %s to hub", event.EventID)
+	s.registered.Store(true)
+	syncLog.Infof("Registered device %s with hub", s.deviceID)
 	return nil
 }
 
+// Registered reports whether Register has succeeded.
+func (s *Syncer) Registered() bool {
+	return s.registered.Load()
+}
+
 // ConnectWebSocket establishes a WebSocket connection to the hub for
 // real-time event delivery.
 //
@@ -191,37 +530,35 @@ func (s *Syncer) PushToHub(event *models.Event) error {
 //
 // A persistent WebSocket connection lets the hub push events the instant they
 // arrive, giving near-zero latency with zero wasted requests.
-//
-// WHY pass the token as a query parameter:
-// The WebSocket handshake is a standard HTTP GET request, and many client
-// libraries (including gorilla/websocket) don't support custom headers on the
-// upgrade request reliably across all platforms. Using ?token=<value> is the
-// widely accepted workaround for WebSocket authentication (see shared/auth/token.go).
-func (s *Syncer) ConnectWebSocket() (*websocket.Conn, error) {
-	// Build WebSocket URL by replacing http(s) with ws(s).
-	// WHY: The gorilla/websocket dialer expects a ws:// or wss:// scheme.
-	wsURL, err := url.Parse(s.hubURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse hub URL: %w", err)
+func (s *Syncer) ConnectWebSocket(channels []string) (*websocket.Conn, error) {
+	// WHY resume the previous session: The hub then replays whatever was
+	// broadcast while this machine was asleep or offline.
+	features := []string{models.WebSocketFeaturePresence,
+		models.WebSocketFeatureAlerts, models.WebSocketFeatureResume,
+		models.WebSocketFeatureChunks, models.WebSocketFeatureCompressed,
+		models.WebSocketFeatureDeletions}
+	if s.downloadDir != "" {
+		features = append(features, models.WebSocketFeatureFiles, models.WebSocketFeatureBlobs)
 	}
-
-	switch wsURL.Scheme {
-	case "https":
-		wsURL.Scheme = "wss"
-	default:
-		wsURL.Scheme = "ws"
+	if s.encryptionKey != nil {
+		features = append(features, models.WebSocketFeatureEncrypted)
 	}
-	wsURL.Path = "/api/v1/ws"
-	wsURL.RawQuery = fmt.Sprintf("token=%s&device_id=%s",
-		url.QueryEscape(s.authToken),
-		url.QueryEscape(s.deviceID))
-
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL.String(), nil)
+	if s.pins != nil {
+		features = append(features, models.WebSocketFeaturePins)
+	}
+	s.channels = channels
+	conn, err := s.hub.Subscribe(client.SubscribeOptions{
+		DeviceID:    s.deviceID,
+		Channels:    channels,
+		Features:    features,
+		ResumeToken: s.sessionToken,
+		LastSeq:     s.lastSeq,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("WebSocket dial failed: %w", err)
+		return nil, err
 	}
 
-	log.Printf("WebSocket connected to hub")
+	syncLog.Infof("WebSocket connected to hub")
 	return conn, nil
 }
 
@@ -234,69 +571,500 @@ func (s *Syncer) ConnectWebSocket() (*websocket.Conn, error) {
 // lets the main polling loop continue detecting local clipboard changes
 // independently. The two paths (local→hub, hub→local) run concurrently.
 //
-// WHY the notifyEnabled parameter:
-// Keeps notification policy at the caller level (main.go reads config).
-// This function shouldn't import or depend on config directly - it just
-// does what it's told.
-func (s *Syncer) ReceiveFromHub(conn *websocket.Conn, notifyEnabled bool) {
+// WHY notifications follow NotifyOnReceive: Keeps notification policy at the
+// caller level (main.go reads config), and a reloaded config applies to the
+// next clip rather than the next connection.
+func (s *Syncer) ReceiveFromHub(conn *websocket.Conn) {
 	defer conn.Close()
+	s.setConn(conn)
+	defer s.setConn(nil)
+	// WHY reset on exit: Presence is only known while connected. Falling
+	// back to "unknown" restores normal polling until the hub says otherwise.
+	defer s.setPeers(-1)
+	s.syncPins()
 
+	// WHY per connection: Parts of one message never span connections; a
+	// message cut off by a disconnect is replayed whole on resume.
+	var joiner wire.Joiner
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
 			// WHY log and return: A read error means the connection is dead
 			// (closed by hub, network failure, etc.). The main loop will
 			// detect the goroutine exit and attempt to reconnect.
-			log.Printf("WebSocket read error: %v", err)
+			syncLog.Infof("WebSocket read error: %v", err)
 			return
 		}
 
-		var event models.Event
-		if err := json.Unmarshal(message, &event); err != nil {
-			log.Printf("WARN: failed to unmarshal WebSocket event: %v", err)
+		msg, err := wire.Unmarshal(message)
+		if err == nil && msg.Chunk != nil {
+			joined, joinErr := joiner.Add(msg.Chunk)
+			if joinErr != nil {
+				syncLog.Warnf("dropping chunked message: %v", joinErr)
+				continue
+			}
+			if joined == nil {
+				continue
+			}
+			msg, err = wire.Unmarshal(joined)
+		}
+		if errors.Is(err, wire.ErrUnknownType) {
+			// WHY ignore: A newer hub may send types this agent predates.
 			continue
 		}
-
-		log.Printf("WebSocket received event: id=%s source=%s", event.EventID, event.SourceDeviceID)
-
-		// Skip events from ourselves - WHY: Even though the hub skips the
-		// source device in Broadcast, belt-and-suspenders defense prevents
-		// loops if the hub logic ever changes or has a bug.
-		if event.SourceDeviceID == s.deviceID {
-			log.Printf("Skipping own event %s", event.EventID)
+		if err != nil {
+			syncLog.Warnf("failed to unmarshal WebSocket message: %v", err)
 			continue
 		}
-
-		// Skip events we've already processed - WHY: Prevents duplicate
-		// clipboard writes if the same event arrives via both WebSocket
-		// and a history poll.
-		if s.cache.Contains(event.EventID) {
+		switch {
+		case msg.Presence != nil:
+			s.setPeers(msg.Presence.Peers)
+			continue
+		case msg.Session != nil:
+			s.startSession(*msg.Session)
+			// WHY only without a full replay: A resumed session already
+			// delivers what was missed, in order.
+			if !msg.Session.Resumed || msg.Session.Gap {
+				s.catchUpFromHistory(conn)
+			}
+			continue
+		case msg.Alert != nil && msg.Alert.Announcement:
+			syncLog.Infof("hub announcement: %s", msg.Alert.Message)
+			if s.notifyEnabled.Load() {
+				ShowAnnouncementNotification(msg.Alert.Message)
+			}
+			continue
+		case msg.Alert != nil:
+			syncLog.Warnf("hub alert: %s", msg.Alert.Message)
+			// WHY alerts ignore event.Silent-style hints: They concern
+			// this machine's setup, so only the local switch applies.
+			if s.notifyEnabled.Load() {
+				ShowHubAlertNotification(msg.Alert.Message)
+			}
+			continue
+		case msg.Deleted != nil:
+			s.history.Remove(msg.Deleted.EventID)
+			s.pins.Remove(msg.Deleted.EventID)
+			s.clearDeleted(msg.Deleted.EventID)
+			continue
+		case msg.Pin != nil:
+			s.applyPin(*msg.Pin)
+			continue
+		case msg.Event == nil:
+			// Agent-to-hub types (latency) have no business arriving here.
 			continue
 		}
 
-		// Cache before writing to clipboard - WHY: The clipboard write
-		// will trigger a change detection in the polling loop. If the
-		// event is already cached, the poll loop will skip it instead
-		// of pushing it back to the hub.
+		event := *msg.Event
+		// WHY before any skip: A skipped event was still delivered, and must
+		// not be replayed on the next resume.
+		s.lastSeq = max(s.lastSeq, event.Seq)
+
+		s.markSeen(&event)
+		s.receiveEvent(conn, event)
+	}
+}
+
+// receiveEvent checks an event from the hub and, unless it is skipped,
+// writes it to the clipboard (or saves it, for files) and notifies.
+// WHY separate from the read loop: Catch-up from history (see catchup.go)
+// applies the clip it finds through the same checks.
+func (s *Syncer) receiveEvent(conn *websocket.Conn, event models.Event) {
+	// WHY validate what the hub sends: The hub validates pushes, but an
+	// older or compromised hub must not be able to feed this machine's
+	// clipboard a malformed event.
+	// WHY decompress first: The text hash covers the original text.
+	// WHY download a blob before that: Same reason; the hub sent a link to
+	// the text instead (see models.Event.BlobURL).
+	var err error
+	if event.BlobURL != "" && event.Text == "" {
+		event.Text, err = s.hub.Blob(event.BlobURL, maxReceivedTextLength)
+		event.BlobURL = ""
+	}
+	if err == nil {
+		err = wire.Decompress(&event, maxReceivedTextLength)
+	}
+	if err == nil {
+		err = models.ValidateEvent(&event)
+	}
+	if err != nil {
+		syncLog.Warnf("ignoring invalid event from hub: %v", err)
+		s.journal.Record(JournalEntry{Action: journalSkipBad, Detail: err.Error()})
+		return
+	}
+
+	syncLog.Debugf("WebSocket received event: id=%s source=%s", event.EventID, event.SourceDeviceID)
+
+	// Skip events from ourselves - WHY: Even though the hub skips the
+	// source device in Broadcast, belt-and-suspenders defense prevents
+	// loops if the hub logic ever changes or has a bug.
+	if event.SourceDeviceID == s.deviceID {
+		syncLog.Debugf("Skipping own event %s", event.EventID)
+		s.journal.Record(JournalEntry{Action: journalSkipOwn, EventID: event.EventID,
+			Hash: event.TextHash, Detail: "event originated on this device"})
+		return
+	}
+
+	// Skip events from devices outside the allowlist - WHY here rather
+	// than on the hub: The point is to not trust the rest of the hub's
+	// devices, so the decision must be made on this machine.
+	if !s.accepts(event.SourceDeviceID) {
+		syncLog.Infof("Ignoring event %s from untrusted device %s", event.EventID, event.SourceDeviceID)
+		s.journal.Record(JournalEntry{Action: journalSkipDeny, EventID: event.EventID,
+			Device: event.SourceDeviceID, Hash: event.TextHash, Detail: "source not in accept_from_devices"})
+		return
+	}
+
+	// Skip events we've already processed - WHY: Prevents duplicate
+	// clipboard writes if the same event arrives via both WebSocket
+	// and a history poll.
+	if s.cache.Contains(event.EventID) {
+		s.journal.Record(JournalEntry{Action: journalSkipDup, EventID: event.EventID,
+			Device: event.SourceDeviceID, Hash: event.TextHash})
+		return
+	}
+
+	// Skip transient clips that already expired - WHY: Quiet hours can
+	// hold a clip for hours; a password meant to live for seconds must
+	// not show up the next morning.
+	if event.IsTransient() && !time.Now().Before(event.ExpiresAt) {
+		syncLog.Infof("Ignoring expired transient event %s", event.EventID)
+		s.journal.Record(JournalEntry{Action: journalSkipOld, EventID: event.EventID,
+			Device: event.SourceDeviceID, Hash: event.TextHash, Detail: "expired before delivery"})
+		return
+	}
+
+	// Skip everything while paused - WHY cache it: Resuming must not
+	// apply a clip that arrived during the pause; only newer ones.
+	if s.Paused() {
 		s.cache.Add(event.EventID)
+		s.journal.Record(JournalEntry{Action: journalPaused, EventID: event.EventID,
+			Device: event.SourceDeviceID, Hash: event.TextHash, Detail: "not applied: sync paused"})
+		return
+	}
 
-		if err := WriteClipboard(event.Text); err != nil {
-			log.Printf("ERROR: failed to write synced clipboard: %v", err)
-			continue
+	// Check the signature - WHY before decrypting: It covers the clip as
+	// pushed, ciphertext and all.
+	if err := s.signers.check(&event); err != nil {
+		syncLog.Warnf("ignoring event %s from %s: %v", event.EventID, event.SourceDeviceID, err)
+		s.journal.Record(JournalEntry{Action: journalSkipSign, EventID: event.EventID,
+			Device: event.SourceDeviceID, Hash: event.TextHash, Detail: err.Error()})
+		return
+	}
+
+	// Decrypt end-to-end encrypted clips - WHY after the skips above:
+	// They only need the routing metadata, which is never sealed.
+	if event.Encrypted {
+		if err := s.openEvent(&event); err != nil {
+			syncLog.Warnf("ignoring encrypted event %s from %s: %v", event.EventID, event.SourceDeviceID, err)
+			s.journal.Record(JournalEntry{Action: journalSkipBad, EventID: event.EventID,
+				Device: event.SourceDeviceID, Detail: err.Error()})
+			return
+		}
+	}
+
+	s.journal.Record(JournalEntry{Action: journalReceived, EventID: event.EventID,
+		Device: event.SourceDeviceID, Hash: event.TextHash, Size: len(event.Text)})
+
+	// WHY files stop here: They are saved to disk, not written
+	// to the clipboard, so none of the steps below apply.
+	if event.ContentType == models.ContentTypeFile {
+		s.receiveFile(&event)
+		return
+	}
+
+	// Cache before writing to clipboard - WHY: The clipboard write
+	// will trigger a change detection in the polling loop. If the
+	// event is already cached, the poll loop will skip it instead
+	// of pushing it back to the hub.
+	// WHY the content hash too: It is what the poll loop looks up; the ID
+	// alone only catches the same event arriving twice.
+	s.cache.Add(event.EventID)
+	s.cache.Add(hashText(event.Text))
+
+	// Snapshot the clipboard before a transient clip replaces it.
+	var previous string
+	if event.IsTransient() {
+		previous = s.snapshotForRestore()
+	}
+
+	if err := WriteClipboardFormats(event.Text, event.Formats); err != nil {
+		syncLog.Errorf("failed to write synced clipboard: %v", err)
+		s.journal.Record(JournalEntry{Action: journalApplyFail, EventID: event.EventID,
+			Device: event.SourceDeviceID, Hash: event.TextHash, Detail: err.Error()})
+		return
+	}
+
+	// Measure how long the clip took to get here and tell the hub.
+	// WHY report over the same socket: The hub aggregates percentiles
+	// across all receivers; a write error here just means the
+	// connection is dying, which the next read will notice.
+	// WHY skip delayed and replayed events: They were held back on
+	// purpose (quiet hours) or while this machine was unreachable, and
+	// say nothing about sync speed.
+	detail := "delivered after quiet hours"
+	if event.Replayed {
+		detail = "replayed after reconnect"
+	}
+	if !event.Delayed && !event.Replayed {
+		report := models.NewLatencyReport(&event, time.Now().UTC())
+		syncLog.Debugf("Sync latency for event %s: total=%dms (upload=%dms hub=%dms delivery=%dms)",
+			event.EventID, report.TotalMs, report.UploadMs, report.HubMs, report.DeliveryMs)
+		data, err := wire.Marshal(&wire.Message{Latency: &report})
+		if err == nil {
+			err = conn.WriteMessage(websocket.TextMessage, data)
+		}
+		if err != nil {
+			syncLog.Warnf("failed to send latency report: %v", err)
 		}
+		detail = fmt.Sprintf("latency %dms", report.TotalMs)
+	}
 
-		log.Printf("Synced clipboard from device %s (event %s)",
-			event.SourceDeviceID, event.EventID)
+	s.journal.Record(JournalEntry{Action: journalApplied, EventID: event.EventID,
+		Device: event.SourceDeviceID, Hash: event.TextHash, Detail: detail})
+	s.appliedID, s.appliedHash = event.EventID, hashText(event.Text)
+	s.keepInHistory(&event)
 
-		if notifyEnabled {
-			// Truncate text preview for notification readability.
-			preview := event.Text
-			if len(preview) > 80 {
-				preview = preview[:80] + "..."
-			}
-			ShowNotification(event.SourceDeviceID, preview)
+	if event.IsTransient() {
+		s.scheduleRestore(&event, previous)
+	}
+
+	syncLog.Infof("Synced clipboard from device %s (event %s)",
+		event.SourceDeviceID, event.EventID)
+
+	// WHY also check event.Silent: The hub marks events from devices
+	// whose owner asked for silent delivery. Local notify_enabled=false
+	// still wins - it silences everything on this machine.
+	if s.notifyEnabled.Load() && !event.Silent {
+		// Truncate text preview for notification readability.
+		preview := event.Text
+		if len(preview) > 80 {
+			preview = preview[:80] + "..."
+		}
+		// WHY name guests: A clip from a borrowed machine should be
+		// recognizable as one before it is pasted anywhere.
+		source := event.SourceDeviceID
+		if event.Guest {
+			source += " (guest)"
 		}
+		ShowNotification(source, event.ContentType, preview)
+	}
+}
+
+// clearDeleted empties the clipboard if it still holds the clip of eventID,
+// which was deleted from the hub's history.
+// WHY only the last applied clip, and only if unchanged: Anything else on
+// the clipboard was copied here since and is the user's, not the hub's.
+func (s *Syncer) clearDeleted(eventID string) {
+	if eventID != s.appliedID {
+		return
+	}
+	hash := s.appliedHash
+	s.appliedID, s.appliedHash = "", ""
+	if hashText(ReadClipboard()) != hash {
+		syncLog.Infof("Event %s was deleted from hub history; clipboard changed since, leaving it", eventID)
+		return
+	}
+	if err := WriteClipboard(""); err != nil {
+		syncLog.Errorf("failed to clear deleted event %s from the clipboard: %v", eventID, err)
+		return
+	}
+	syncLog.Infof("Cleared clipboard: event %s was deleted from hub history", eventID)
+	s.journal.Record(JournalEntry{Action: journalCleared, EventID: eventID, Hash: hash,
+		Detail: "deleted from hub history"})
+}
+
+// sealEvent returns an encrypted copy of event, sealed with today's data
+// key or, on a hub that doesn't store data keys, the shared key.
+func (s *Syncer) sealEvent(event *models.Event) (*models.Event, error) {
+	if !s.hubDataKeys.Load() {
+		return e2e.Seal(s.encryptionKey, event)
 	}
+	keyID, key, err := s.dataKeys.current(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := e2e.Seal(key, event)
+	if err != nil {
+		return nil, err
+	}
+	sealed.KeyID = keyID
+	return sealed, nil
+}
+
+// openEvent decrypts a sealed event in place and validates the plaintext.
+// WHY validate again: The hub could only check the ciphertext; the file
+// name and formats it couldn't see get the checks every other event got.
+func (s *Syncer) openEvent(event *models.Event) error {
+	if s.encryptionKey == nil {
+		return fmt.Errorf("clip is encrypted and no encryption_key is configured")
+	}
+	key := s.encryptionKey
+	if event.KeyID != "" {
+		var err error
+		if key, err = s.dataKeys.get(event.KeyID); err != nil {
+			return err
+		}
+	}
+	if err := e2e.Open(key, event); err != nil {
+		// WHY forget the key: If the day's key was shredded and recreated,
+		// the cached one is stale; the next clip fetches the current one.
+		if event.KeyID != "" {
+			s.dataKeys.forget(event.KeyID)
+		}
+		return err
+	}
+	return models.ValidateEvent(event)
+}
+
+// setConn records the connection ReceiveFromHub is reading.
+func (s *Syncer) setConn(conn *websocket.Conn) {
+	s.connMu.Lock()
+	s.conn = conn
+	s.connMu.Unlock()
+}
+
+// DropConnection closes the current WebSocket connection, which makes
+// ReceiveFromHub return. It reports whether there was one.
+// WHY: After sleep the connection may look open while being dead; closing
+// it is the only way to make the blocked read give up now.
+func (s *Syncer) DropConnection() bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if s.conn == nil {
+		return false
+	}
+	s.conn.Close()
+	return true
+}
+
+// startSession records the hub's Session message for the next reconnect.
+func (s *Syncer) startSession(session models.Session) {
+	s.sessionToken = session.Token
+	if !session.Resumed {
+		// WHY reset: Sequence numbers only mean something within a session,
+		// and a restarted hub counts from zero again.
+		s.lastSeq = 0
+		return
+	}
+	syncLog.Infof("Resumed hub session: %d missed event(s) to replay", session.Replayed)
+	if session.Gap {
+		syncLog.Warnf("missed more clips while disconnected than the hub keeps; older ones are only in hub history")
+	}
+}
+
+// setPeers records the hub's presence count and wakes the main loop if it
+// changed.
+func (s *Syncer) setPeers(peers int) {
+	if s.peers.Swap(int32(peers)) == int32(peers) {
+		return
+	}
+	syncLog.Debugf("Peers online: %d", peers)
+	select {
+	case s.presenceChanged <- struct{}{}:
+	default:
+	}
+}
+
+// PeersOnline returns how many other devices are connected to the hub, or
+// -1 if unknown.
+func (s *Syncer) PeersOnline() int {
+	return int(s.peers.Load())
+}
+
+// Connected reports whether the agent has a WebSocket connection to the hub.
+func (s *Syncer) Connected() bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	return s.conn != nil
+}
+
+// SetPaused pauses or resumes sync. While paused, copied clips are not sent
+// and clips from other devices are not applied. It cancels a pause's end
+// set with PauseFor.
+// WHY keep the connection: Presence and the tray's status stay current,
+// and resuming needs no reconnect.
+func (s *Syncer) SetPaused(paused bool) {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	s.stopResumeTimer()
+	s.setPaused(paused)
+}
+
+// PauseFor pauses sync and resumes it after d, returning when. Pausing
+// again, or resuming, in between replaces that.
+// WHY resume on its own: A pause for copying one password is easy to forget
+// about, and sync silently staying off is worse than resuming too soon.
+func (s *Syncer) PauseFor(d time.Duration) time.Time {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	s.stopResumeTimer()
+	at := time.Now().Add(d)
+	s.resumeAt = at
+	s.resumeTimer = time.AfterFunc(d, func() {
+		s.pauseMu.Lock()
+		defer s.pauseMu.Unlock()
+		// WHY compare: A timer stopped too late to keep it from firing must
+		// not end the pause that replaced its own.
+		if !s.resumeAt.Equal(at) {
+			return
+		}
+		s.resumeAt, s.resumeTimer = time.Time{}, nil
+		s.setPaused(false)
+	})
+	s.setPaused(true)
+	syncLog.Infof("Sync resumes at %s", at.Format(time.TimeOnly))
+	return at
+}
+
+// PausedUntil returns when a pause set with PauseFor ends, or the zero time
+// if sync isn't paused or is paused until resumed.
+func (s *Syncer) PausedUntil() time.Time {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	return s.resumeAt
+}
+
+// stopResumeTimer cancels the end of a pause. Caller must hold pauseMu.
+func (s *Syncer) stopResumeTimer() {
+	if s.resumeTimer != nil {
+		s.resumeTimer.Stop()
+	}
+	s.resumeAt, s.resumeTimer = time.Time{}, nil
+}
+
+// setPaused changes the paused flag, logging a change. Caller must hold
+// pauseMu.
+func (s *Syncer) setPaused(paused bool) {
+	if s.paused.Swap(paused) == paused {
+		return
+	}
+	if paused {
+		syncLog.Infof("Sync paused")
+	} else {
+		syncLog.Infof("Sync resumed")
+	}
+}
+
+// Paused reports whether sync is paused (see SetPaused).
+func (s *Syncer) Paused() bool {
+	return s.paused.Load()
+}
+
+// skipWhilePaused journals a copied clip that is not sent because sync is
+// paused, and reports whether it was.
+func (s *Syncer) skipWhilePaused(hash string, size int) bool {
+	if !s.Paused() {
+		return false
+	}
+	s.journal.Record(JournalEntry{Action: journalPaused, Hash: hash, Size: size,
+		Detail: "not sent: sync paused"})
+	return true
+}
+
+// PresenceChanged is signalled when PeersOnline changes.
+func (s *Syncer) PresenceChanged() <-chan struct{} {
+	return s.presenceChanged
 }
 
 // IsEventCached checks if an event ID has been recently seen.
@@ -0,0 +1,309 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the agent's tray (menu bar) icon: sync status, the
+// last few synced clips, and switches for pausing sync and notifications.
+//
+// WHY a helper process instead of a tray library:
+// Every tray library for Go needs cgo (AppKit, GTK/AppIndicator) or a
+// message loop on the main thread, which would break the CGO_ENABLED=0
+// cross-compiled builds and the agent's own main loop. Like notifications
+// and clipboard watching, the tray is driven through a tool the platform
+// already has or one package away: yad on Linux (tray_other.go), osascript
+// on macOS (tray_darwin.go), PowerShell on Windows (tray_windows.go).
+//
+// WHY the same two pipes everywhere:
+// The agent writes the whole menu to the helper's stdin whenever it changes;
+// the helper prints the ID of each item clicked. The helper never needs to
+// know what an item does, so the menu logic stays here, in one place.
+//
+// WHY opt-in (the tray config switch):
+// Servers and containers have no tray to show an icon in, and a missing
+// helper is only worth a warning for someone who asked for the icon.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tmair/tailclip/shared/i18n"
+)
+
+// trayRecentClips is how many synced clips the tray menu lists.
+const trayRecentClips = 5
+
+// trayRefreshInterval is how often the tray checks the sync status.
+// WHY poll: Status comes from several goroutines (connection, presence,
+// history); reading it now and then is simpler than wiring each one to the
+// tray, and an unchanged menu isn't sent again.
+const trayRefreshInterval = 2 * time.Second
+
+// trayPreviewLength is how many characters of a clip a menu item shows.
+const trayPreviewLength = 40
+
+// Tray menu item IDs. A recent clip's ID is trayClipPrefix plus its event ID.
+const (
+	trayPause         = "pause"
+	trayNotifications = "notifications"
+	trayQuit          = "quit"
+	trayClipPrefix    = "clip:"
+)
+
+// trayItem is one entry of the tray menu. An item without a label is a
+// separator.
+type trayItem struct {
+	ID       string `json:"id,omitempty"`
+	Label    string `json:"label,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// trayMenu is everything a tray helper shows.
+type trayMenu struct {
+	Tooltip string     `json:"tooltip"`
+	Items   []trayItem `json:"items"`
+}
+
+// recentClips keeps the last few clips sent or applied, newest first.
+// WHY a mutex: Clips are added from the main loop and the WebSocket
+// goroutine, and read by the tray's.
+type recentClips struct {
+	mu    sync.Mutex
+	clips []LocalClip
+}
+
+// add records a clip. A nil list ignores it.
+func (r *recentClips) add(clip LocalClip) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clips = append([]LocalClip{clip}, r.clips...)
+	if len(r.clips) > trayRecentClips {
+		r.clips = r.clips[:trayRecentClips]
+	}
+}
+
+// list returns the clips, newest first.
+func (r *recentClips) list() []LocalClip {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]LocalClip(nil), r.clips...)
+}
+
+// tray runs a tray helper process and acts on its clicks.
+type tray struct {
+	syncer *Syncer
+	recent *recentClips
+	// notify is notify_enabled; without it there is nothing to mute.
+	notify bool
+	stdin  io.WriteCloser
+	clicks chan string
+	quit   chan struct{}
+	// shown is the last menu sent, so an unchanged one isn't sent again.
+	shown string
+}
+
+// startTray shows the tray icon for syncer. It returns nil, after logging
+// why, when the platform's helper can't be started; the agent runs on
+// without an icon.
+func startTray(syncer *Syncer, notify bool) *tray {
+	cmd, err := trayCommand(iconPath(""))
+	if err != nil {
+		agentLog.Warnf("tray icon disabled: %v", err)
+		return nil
+	}
+	hideConsoleWindow(cmd)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		agentLog.Warnf("tray icon disabled: %v", err)
+		return nil
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		agentLog.Warnf("tray icon disabled: %v", err)
+		return nil
+	}
+	if err := cmd.Start(); err != nil {
+		agentLog.Warnf("tray icon disabled: failed to start %s: %v", cmd.Path, err)
+		return nil
+	}
+
+	t := &tray{
+		syncer: syncer,
+		recent: &recentClips{},
+		notify: notify,
+		stdin:  stdin,
+		clicks: make(chan string),
+		quit:   make(chan struct{}),
+	}
+	syncer.recent = t.recent
+	go func() {
+		defer close(t.clicks)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			t.clicks <- strings.TrimSpace(scanner.Text())
+		}
+		err := cmd.Wait()
+		if err == nil {
+			err = fmt.Errorf("exited")
+		}
+		agentLog.Warnf("tray icon helper stopped: %v %s", err, strings.TrimSpace(stderr.String()))
+	}()
+	go t.run()
+
+	agentLog.Infof("Tray icon started (%s)", cmd.Path)
+	return t
+}
+
+// Quit is closed when the user picks Quit from the tray menu. A nil tray's
+// never is.
+func (t *tray) Quit() <-chan struct{} {
+	if t == nil {
+		return nil
+	}
+	return t.quit
+}
+
+// run keeps the menu current and handles clicks until the helper stops.
+func (t *tray) run() {
+	ticker := time.NewTicker(trayRefreshInterval)
+	defer ticker.Stop()
+	t.refresh()
+	for {
+		select {
+		case <-ticker.C:
+		case id, ok := <-t.clicks:
+			if !ok {
+				return
+			}
+			t.handleClick(id)
+		}
+		t.refresh()
+	}
+}
+
+// refresh sends the menu to the helper if it changed.
+func (t *tray) refresh() {
+	lines := trayMenuLines(t.menu())
+	text := strings.Join(lines, "\n") + "\n"
+	if text == t.shown {
+		return
+	}
+	if _, err := io.WriteString(t.stdin, text); err != nil {
+		// WHY only debug: The helper has exited; the reader goroutine
+		// logs why.
+		agentLog.Debugf("failed to update tray menu: %v", err)
+		return
+	}
+	t.shown = text
+}
+
+// menu builds the tray menu from the current state.
+func (t *tray) menu() trayMenu {
+	status := t.status()
+	items := []trayItem{{Label: status, Disabled: true}, {}}
+
+	clips := t.recent.list()
+	if len(clips) == 0 {
+		items = append(items, trayItem{Label: i18n.T("tray.recent.none"), Disabled: true})
+	}
+	for _, clip := range clips {
+		items = append(items, trayItem{ID: trayClipPrefix + clip.EventID, Label: clipPreview(clip.Text, trayPreviewLength)})
+	}
+	items = append(items, trayItem{})
+
+	if t.syncer.Paused() {
+		items = append(items, trayItem{ID: trayPause, Label: i18n.T("tray.resume")})
+	} else {
+		items = append(items, trayItem{ID: trayPause, Label: i18n.T("tray.pause")})
+	}
+	// WHY only with notify_enabled: The tray mutes for this session; it
+	// doesn't turn on what the config turned off.
+	if t.notify {
+		if notificationsMuted.Load() {
+			items = append(items, trayItem{ID: trayNotifications, Label: i18n.T("tray.notifications.off")})
+		} else {
+			items = append(items, trayItem{ID: trayNotifications, Label: i18n.T("tray.notifications.on")})
+		}
+	}
+	items = append(items, trayItem{}, trayItem{ID: trayQuit, Label: i18n.T("tray.quit")})
+
+	return trayMenu{Tooltip: "TailClip - " + status, Items: items}
+}
+
+// status describes the sync status in a few words.
+func (t *tray) status() string {
+	switch {
+	case t.syncer.Paused():
+		return i18n.T("tray.status.paused")
+	case !t.syncer.Connected():
+		return i18n.T("tray.status.disconnected")
+	case t.syncer.PeersOnline() >= 0:
+		return i18n.T("tray.status.peers", t.syncer.PeersOnline())
+	default:
+		return i18n.T("tray.status.connected")
+	}
+}
+
+// handleClick acts on a clicked menu item.
+func (t *tray) handleClick(id string) {
+	switch {
+	case id == trayPause:
+		t.syncer.SetPaused(!t.syncer.Paused())
+	case id == trayNotifications:
+		muted := !notificationsMuted.Load()
+		notificationsMuted.Store(muted)
+		if muted {
+			notifyLog.Infof("Notifications muted from the tray")
+		} else {
+			notifyLog.Infof("Notifications unmuted from the tray")
+		}
+	case id == trayQuit:
+		select {
+		case <-t.quit:
+		default:
+			close(t.quit)
+		}
+	case strings.HasPrefix(id, trayClipPrefix):
+		t.copyClip(strings.TrimPrefix(id, trayClipPrefix))
+	}
+}
+
+// copyClip puts a recent clip back on the clipboard.
+func (t *tray) copyClip(eventID string) {
+	for _, clip := range t.recent.list() {
+		if clip.EventID != eventID {
+			continue
+		}
+		// WHY cache the hash: The clip is already on the hub; the poll
+		// loop must not send it again as a new copy.
+		t.syncer.CacheEvent(hashText(clip.Text))
+		if err := WriteClipboard(clip.Text); err != nil {
+			clipboardLog.Errorf("failed to copy event %s from the tray: %v", eventID, err)
+			return
+		}
+		clipboardLog.Infof("Copied event %s to the clipboard from the tray", eventID)
+		return
+	}
+}
+
+// clipPreview shortens a clip to one line of at most length characters, for
+// a menu item or a picker row.
+func clipPreview(text string, length int) string {
+	preview := strings.Join(strings.Fields(text), " ")
+	// WHY: An empty label would be a separator.
+	if preview == "" {
+		return "(" + formatBytes(len(text)) + ")"
+	}
+	if utf8.RuneCountInString(preview) > length {
+		preview = string([]rune(preview)[:length]) + "..."
+	}
+	return preview
+}
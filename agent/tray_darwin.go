@@ -0,0 +1,108 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the menu bar icon on macOS for the TailClip agent.
+//
+// WHY a JavaScript for Automation script:
+// As with the pasteboard watcher (clipwatch_darwin.go), AppKit is reached
+// through osascript instead of cgo, so the agent still cross-compiles with
+// CGO_ENABLED=0. The script puts an NSStatusItem in the menu bar, rebuilds
+// its menu from each JSON line on stdin, and prints the ID of each item
+// clicked. When the agent exits, stdin closes and the script quits with it.
+
+//go:build darwin
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+)
+
+// trayScript is the menu bar script. argv[0] is the icon path.
+// WHY -e instead of stdin: stdin carries the menu.
+const trayScript = `ObjC.import('AppKit');
+var ids = [];
+var buffered = '';
+var out = $.NSFileHandle.fileHandleWithStandardOutput;
+var input = $.NSFileHandle.fileHandleWithStandardInput;
+var app = $.NSApplication.sharedApplication;
+var item;
+ObjC.registerSubclass({
+	name: 'TailClipTray',
+	methods: {
+		'clicked:': {
+			types: ['void', ['id']],
+			implementation: function (sender) {
+				out.writeData($(ids[sender.tag] + '\n').dataUsingEncoding($.NSUTF8StringEncoding));
+			}
+		},
+		'read:': {
+			types: ['void', ['id']],
+			implementation: function (note) {
+				var data = note.userInfo.objectForKey($.NSFileHandleNotificationDataItem);
+				if (data.length == 0) {
+					app.terminate(null);
+					return;
+				}
+				buffered += ObjC.unwrap($.NSString.alloc.initWithDataEncoding(data, $.NSUTF8StringEncoding));
+				var lines = buffered.split('\n');
+				buffered = lines.pop();
+				lines.forEach(function (line) {
+					if (line) show(JSON.parse(line));
+				});
+				input.readInBackgroundAndNotify;
+			}
+		}
+	}
+});
+var target = $.TailClipTray.alloc.init;
+function show(menu) {
+	var m = $.NSMenu.alloc.init;
+	m.autoenablesItems = false;
+	ids = [];
+	(menu.items || []).forEach(function (entry) {
+		if (!entry.label) {
+			m.addItem($.NSMenuItem.separatorItem);
+			return;
+		}
+		var mi = $.NSMenuItem.alloc.initWithTitleActionKeyEquivalent(entry.label, 'clicked:', '');
+		mi.target = target;
+		mi.tag = ids.length;
+		mi.enabled = !entry.disabled;
+		ids.push(entry.id || '');
+		m.addItem(mi);
+	});
+	item.menu = m;
+	item.button.toolTip = menu.tooltip;
+}
+function run(argv) {
+	app.setActivationPolicy($.NSApplicationActivationPolicyAccessory);
+	item = $.NSStatusBar.systemStatusBar.statusItemWithLength($.NSVariableStatusItemLength);
+	var image = $.NSImage.alloc.initWithContentsOfFile(argv[0] || '');
+	if (image && !image.isNil()) {
+		image.size = $.NSMakeSize(18, 18);
+		item.button.image = image;
+	} else {
+		item.button.title = 'TailClip';
+	}
+	$.NSNotificationCenter.defaultCenter.addObserverSelectorNameObject(target, 'read:', $.NSFileHandleReadCompletionNotification, input);
+	input.readInBackgroundAndNotify;
+	app.run;
+}`
+
+// trayCommand returns the osascript command that shows the menu bar icon.
+func trayCommand(icon string) (*exec.Cmd, error) {
+	if _, err := exec.LookPath("osascript"); err != nil {
+		return nil, fmt.Errorf("osascript not found")
+	}
+	return exec.Command("osascript", "-l", "JavaScript", "-e", trayScript, icon), nil
+}
+
+// trayMenuLines encodes menu as one JSON line for trayScript.
+func trayMenuLines(menu trayMenu) []string {
+	data, err := json.Marshal(menu)
+	if err != nil {
+		return nil
+	}
+	return []string{string(data)}
+}
@@ -0,0 +1,60 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the tray icon on Linux and the BSDs for the TailClip
+// agent, through yad.
+//
+// WHY yad:
+// Its notification mode is a complete tray icon driven from stdin (icon,
+// tooltip, menu), packaged by every major distribution, and works with both
+// the X11 system tray and StatusNotifier desktops. Each menu item runs a
+// command; echo makes it print the item's ID on yad's stdout, which is the
+// agent's pipe.
+
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// trayCommand returns the yad command that shows the tray icon.
+func trayCommand(icon string) (*exec.Cmd, error) {
+	yad, err := exec.LookPath("yad")
+	if err != nil {
+		return nil, fmt.Errorf("yad not found; install it for the tray icon")
+	}
+	// WHY --no-middle: Middle-click would otherwise quit yad.
+	args := []string{"--notification", "--listen", "--no-middle", "--text=TailClip"}
+	if icon != "" {
+		args = append(args, "--image="+icon)
+	}
+	return exec.Command(yad, args...), nil
+}
+
+// trayMenuLines encodes menu as yad --listen commands.
+// WHY no separators or disabled items: yad's menu has neither, so those
+// items are left out or do nothing when clicked.
+func trayMenuLines(menu trayMenu) []string {
+	var items []string
+	for _, item := range menu.Items {
+		switch {
+		case item.Label == "":
+			continue
+		case item.Disabled || item.ID == "":
+			items = append(items, yadText(item.Label)+"!true")
+		default:
+			items = append(items, yadText(item.Label)+"!echo "+item.ID)
+		}
+	}
+	return []string{
+		"tooltip:" + yadText(menu.Tooltip),
+		"menu:" + strings.Join(items, "|"),
+	}
+}
+
+// yadText removes the characters yad treats as separators from a label.
+func yadText(text string) string {
+	return strings.NewReplacer("|", "/", "!", ".", "\n", " ").Replace(text)
+}
@@ -0,0 +1,89 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the notification area icon on Windows for the
+// TailClip agent.
+//
+// WHY PowerShell:
+// System.Windows.Forms.NotifyIcon is a complete tray icon with a context
+// menu, and Windows PowerShell ships with every supported Windows. Driving it
+// from a script keeps the agent free of cgo and of a second message loop. The
+// script rebuilds the menu from each JSON line on stdin and prints the ID of
+// each item clicked.
+
+//go:build windows
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+)
+
+// trayScript is the notification area script. The icon path is in
+// TAILCLIP_TRAY_ICON.
+// WHY a stream reader on stdin: [Console]::In reads synchronously even when
+// asked not to, which would freeze the menu; the timer picks up lines the
+// background read has finished.
+const trayScript = `Add-Type -AssemblyName System.Windows.Forms, System.Drawing
+$tray = New-Object System.Windows.Forms.NotifyIcon
+$tray.Icon = [System.Drawing.SystemIcons]::Application
+if ($env:TAILCLIP_TRAY_ICON) {
+	try {
+		$bitmap = [System.Drawing.Bitmap]::FromFile($env:TAILCLIP_TRAY_ICON)
+		$tray.Icon = [System.Drawing.Icon]::FromHandle($bitmap.GetHicon())
+	} catch {}
+}
+$tray.Text = 'TailClip'
+$tray.ContextMenuStrip = New-Object System.Windows.Forms.ContextMenuStrip
+$stdin = New-Object System.IO.StreamReader([Console]::OpenStandardInput())
+$script:pending = $stdin.ReadLineAsync()
+function Show-Menu($menu) {
+	$text = [string]$menu.tooltip
+	if ($text.Length -gt 63) { $text = $text.Substring(0, 63) }
+	$tray.Text = $text
+	$strip = $tray.ContextMenuStrip
+	$strip.Items.Clear()
+	foreach ($entry in $menu.items) {
+		if (-not $entry.label) {
+			[void]$strip.Items.Add((New-Object System.Windows.Forms.ToolStripSeparator))
+			continue
+		}
+		$item = $strip.Items.Add([string]$entry.label)
+		$item.Tag = [string]$entry.id
+		$item.Enabled = -not $entry.disabled
+		$item.add_Click({ param($source) [Console]::Out.WriteLine($source.Tag); [Console]::Out.Flush() })
+	}
+}
+$timer = New-Object System.Windows.Forms.Timer
+$timer.Interval = 200
+$timer.add_Tick({
+	while ($script:pending.IsCompleted) {
+		$line = $script:pending.Result
+		if ($null -eq $line) {
+			$tray.Visible = $false
+			[System.Windows.Forms.Application]::Exit()
+			return
+		}
+		if ($line) { Show-Menu ($line | ConvertFrom-Json) }
+		$script:pending = $stdin.ReadLineAsync()
+	}
+})
+$timer.Start()
+$tray.Visible = $true
+[System.Windows.Forms.Application]::Run()`
+
+// trayCommand returns the PowerShell command that shows the tray icon.
+func trayCommand(icon string) (*exec.Cmd, error) {
+	cmd := powerShell(trayScript)
+	cmd.Env = append(os.Environ(), "TAILCLIP_TRAY_ICON="+icon)
+	return cmd, nil
+}
+
+// trayMenuLines encodes menu as one JSON line for trayScript.
+func trayMenuLines(menu trayMenu) []string {
+	data, err := json.Marshal(menu)
+	if err != nil {
+		return nil
+	}
+	return []string{string(data)}
+}
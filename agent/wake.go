@@ -0,0 +1,57 @@
+// Author: Toluwalase Mebaanne
+// Package main provides sleep/wake detection for the TailClip agent.
+//
+// WHY the agent cares about sleep:
+// A laptop's WebSocket doesn't fail when the lid closes - it just stops. On
+// wake the socket still looks open, and it can take TCP minutes to notice the
+// hub is gone, during which nothing copied elsewhere arrives. Detecting the
+// wake lets the agent drop that connection and reconnect (resuming its hub
+// session, which replays the missed clips) right away.
+//
+// WHY a wall-clock gap instead of OS power notifications:
+// Suspend hooks differ on every platform (WM_POWERBROADCAST, IOKit, logind
+// over D-Bus) and would need cgo or extra dependencies. Every platform shares
+// one symptom, though: a ticker that should fire every few seconds fires once
+// after the machine wakes, and the wall clock shows the whole nap in between.
+
+package main
+
+import (
+	"time"
+)
+
+// wakeCheckInterval is how often the agent looks for a sleep gap.
+const wakeCheckInterval = 5 * time.Second
+
+// wakeGapThreshold is how late a check must run to count as a wake.
+// WHY generous: A heavily loaded machine can delay a tick by a few seconds;
+// that must not tear down a healthy connection.
+const wakeGapThreshold = 15 * time.Second
+
+// watchWake reports on the returned channel, with the approximate time
+// slept, whenever the machine resumes from sleep.
+// WHY buffered with size 1: The main loop only needs to know "we woke up";
+// several wakes before it looks collapse into one.
+func watchWake() <-chan time.Duration {
+	woke := make(chan time.Duration, 1)
+	go func() {
+		ticker := time.NewTicker(wakeCheckInterval)
+		defer ticker.Stop()
+
+		// WHY Round(0): It strips the monotonic reading, so Sub compares wall
+		// clocks. The monotonic clock stops during suspend on macOS and Linux
+		// and would hide the gap.
+		last := time.Now().Round(0)
+		for range ticker.C {
+			now := time.Now().Round(0)
+			if slept := now.Sub(last) - wakeCheckInterval; slept > wakeGapThreshold {
+				select {
+				case woke <- slept:
+				default:
+				}
+			}
+			last = now
+		}
+	}()
+	return woke
+}
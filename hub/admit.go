@@ -0,0 +1,50 @@
+// Author: Toluwalase Mebaanne
+// Package main provides `hub admit`: enabling and disabling devices.
+//
+// WHY a command rather than an API endpoint:
+// With require_registered_devices, new devices start disabled because every
+// agent holds the shared token and can register any ID it likes. Admitting
+// one over the API would need only that token again. Like `hub unbind`,
+// shell access to the hub is the stronger proof of being the operator.
+
+package main
+
+import (
+	"fmt"
+)
+
+// runAdmit implements `hub admit -device <id> [-disable] [config-path]`.
+func runAdmit(args []string) error {
+	fs := newCommandFlags("admit")
+	deviceID := fs.String("device", "", "device ID to enable (required)")
+	disable := fs.Bool("disable", false, "disable the device instead, refusing its connections")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *deviceID == "" {
+		fs.Usage()
+		return fmt.Errorf("-device is required")
+	}
+
+	_, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	found, err := storage.SetDeviceEnabled(*deviceID, !*disable)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("device %s is not registered; it registers when its agent starts", *deviceID)
+	}
+	if *disable {
+		// WHY say when it takes effect: A connected device keeps its
+		// WebSocket; the check runs when it next connects.
+		fmt.Printf("Device %s disabled; it can't connect from its next reconnect on.\n", *deviceID)
+		return nil
+	}
+	fmt.Printf("Device %s admitted; it connects on its next attempt.\n", *deviceID)
+	return nil
+}
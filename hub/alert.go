@@ -0,0 +1,66 @@
+// Author: Toluwalase Mebaanne
+// Package main provides admin alerts: notices about problems the hub
+// detected on its own, logged and sent to the alert_webhook.
+//
+// WHY a webhook instead of only a log line:
+// The hub runs unattended on a home server. Whoever looks after it reads
+// chat or email, not hub logs; a POST to a webhook reaches either through
+// services like ntfy, Slack, or Home Assistant.
+//
+// WHY fire and forget:
+// Alerts are raised on the push path. A slow or dead webhook must not delay
+// syncing, and a lost notice costs less than a stalled hub.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// alertWebhookTimeout bounds one webhook delivery.
+const alertWebhookTimeout = 10 * time.Second
+
+// AdminAlert is the JSON body POSTed to the alert_webhook.
+type AdminAlert struct {
+	// Kind names the problem, e.g. "push_flood".
+	Kind string `json:"kind"`
+	// Message describes it for a person, like the log line.
+	Message string `json:"message"`
+	// DeviceIDs are the devices involved, if any.
+	DeviceIDs []string `json:"device_ids,omitempty"`
+	// At is when the hub detected the problem (UTC).
+	At time.Time `json:"at"`
+}
+
+// alertAdmin logs alert and, if alert_webhook is set, delivers it there in
+// the background.
+func (s *Server) alertAdmin(alert AdminAlert) {
+	alert.At = time.Now().UTC()
+	alertLog.Warnf("%s", alert.Message)
+	if s.cfg.AlertWebhook == "" {
+		return
+	}
+	go s.postAlert(alert)
+}
+
+// postAlert POSTs alert to the alert_webhook.
+func (s *Server) postAlert(alert AdminAlert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		alertLog.Errorf("encoding alert: %v", err)
+		return
+	}
+	client := &http.Client{Timeout: alertWebhookTimeout}
+	resp, err := client.Post(s.cfg.AlertWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		alertLog.Errorf("delivering %s alert to webhook: %v", alert.Kind, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		alertLog.Errorf("delivering %s alert to webhook: status %d", alert.Kind, resp.StatusCode)
+	}
+}
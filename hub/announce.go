@@ -0,0 +1,82 @@
+// Author: Toluwalase Mebaanne
+// Package main provides `hub announce`: operator messages to the devices.
+//
+// WHY through the running hub:
+// Unlike the other commands, an announcement has no database side; it only
+// exists as a message on the connected agents' WebSockets, which the running
+// hub holds. The command asks it over HTTP, like any other API client.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/config"
+)
+
+// localHubURL returns the URL this machine reaches the hub from cfg at.
+// WHY loopback for a wildcard address: The hub listening on 0.0.0.0 or ::
+// answers on 127.0.0.1, which needs no tailnet.
+// WHY the MagicDNS name with tailscale_cert: The certificate is only valid
+// for that name, not for an address.
+func localHubURL(cfg *config.HubConfig) (string, error) {
+	host, port, err := net.SplitHostPort(cfg.ListenAddrs()[0])
+	if err != nil {
+		return "", err
+	}
+	if cfg.TailscaleCert {
+		domain, err := tailnetCertDomain(cfg.TailscaleCLI)
+		if err != nil {
+			return "", err
+		}
+		return "https://" + net.JoinHostPort(strings.TrimSuffix(domain, "."), port), nil
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
+
+// runAnnounce implements `hub announce -m TEXT [-device ID,...] [config-path]`.
+func runAnnounce(args []string) error {
+	fs := newCommandFlags("announce")
+	message := fs.String("m", "", "message to show on the devices (required)")
+	devices := fs.String("device", "", "comma-separated device IDs to send it to (default: all connected)")
+	hubURL := fs.String("hub", "", "URL of the running hub (default: from listen_ip and listen_port)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*message) == "" {
+		fs.Usage()
+		return fmt.Errorf("-m is required")
+	}
+	configPath := defaultConfigPath
+	if fs.NArg() > 0 {
+		configPath = fs.Arg(0)
+	}
+	cfg, err := config.LoadHubConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load hub config from %s: %w", configPath, err)
+	}
+	if *hubURL == "" {
+		if *hubURL, err = localHubURL(cfg); err != nil {
+			return fmt.Errorf("cannot tell where the hub is running, pass -hub: %w", err)
+		}
+	}
+
+	var deviceIDs []string
+	for _, id := range strings.Split(*devices, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			deviceIDs = append(deviceIDs, id)
+		}
+	}
+	delivered, err := client.New(*hubURL, cfg.AuthToken).Announce(*message, deviceIDs)
+	if err != nil {
+		return fmt.Errorf("announcement to the hub at %s failed: %w", *hubURL, err)
+	}
+	fmt.Printf("Announcement shown on %d connected device(s)\n", delivered)
+	return nil
+}
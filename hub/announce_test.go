@@ -0,0 +1,40 @@
+// Author: Toluwalase Mebaanne
+// Tests for how hub commands find the running hub from listen_ip.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/tmair/tailclip/shared/config"
+)
+
+func TestLocalHubURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		listenIP string
+		want     string
+	}{
+		{"ipv4", "100.64.0.1", "http://100.64.0.1:8080"},
+		{"all ipv4", "0.0.0.0", "http://127.0.0.1:8080"},
+		{"all ipv6", "::", "http://127.0.0.1:8080"},
+		{"bracketed all ipv6", "[::]", "http://127.0.0.1:8080"},
+		{"ipv6", "fd7a:115c:a1e0::1", "http://[fd7a:115c:a1e0::1]:8080"},
+		{"bracketed ipv6", "[fd7a:115c:a1e0::1]", "http://[fd7a:115c:a1e0::1]:8080"},
+		{"dual stack uses the first", "100.64.0.1,fd7a:115c:a1e0::1", "http://100.64.0.1:8080"},
+		{"dual stack ipv6 first", "fd7a:115c:a1e0::1, 100.64.0.1", "http://[fd7a:115c:a1e0::1]:8080"},
+		{"hostname", "hub.local", "http://127.0.0.1:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.HubConfig{ListenIP: tt.listenIP, ListenPort: 8080}
+			got, err := localHubURL(cfg)
+			if err != nil {
+				t.Fatalf("localHubURL for %q: %v", tt.listenIP, err)
+			}
+			if got != tt.want {
+				t.Errorf("localHubURL for %q = %q, want %q", tt.listenIP, got, tt.want)
+			}
+		})
+	}
+}
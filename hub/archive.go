@@ -0,0 +1,264 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the hub's archive of pruned events and the
+// `hub archive` command.
+//
+// WHY archive instead of only deleting:
+// A short retention keeps the hub's database small and limits what a stolen
+// disk gives away, but "the clip from March" is then gone for good. With an
+// archive configured, retention first writes each event it prunes to a cold
+// store - a directory (e.g. a NAS mount) or an S3-compatible bucket - and
+// only deletes the events that were written. GET /api/v1/events/{id} and
+// `hub archive -event ID` read an event back from there once it has left
+// history. DELETE /api/v1/events/{id} removes it from the archive too.
+//
+// WHY one object per event:
+// Retrieval is by event ID, so the ID names the object and no index has to
+// be kept in sync with the store.
+//
+// WHY sealed with a key of its own:
+// The archive lives outside the hub's machine. Each object is the event as
+// JSON, encrypted with archive.key and bound to its event ID, so the store
+// learns nothing but IDs and sizes, and can't pass one event off as another.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// archiveBatchSize is how many events retention archives before deleting
+// them.
+// WHY batches: Pruning a large history at once would hold every event in
+// memory, and a store failing halfway should still let the events written
+// so far go.
+const archiveBatchSize = 200
+
+// archiveExt ends every archived object's name.
+const archiveExt = ".sealed"
+
+// coldStore holds archived objects by name.
+type coldStore interface {
+	put(name string, data []byte) error
+	// get returns errObjectNotFound for a missing object.
+	get(name string) ([]byte, error)
+	// delete removes an object; a missing one is not an error.
+	delete(name string) error
+}
+
+// dirStore is a coldStore in a directory.
+type dirStore struct {
+	dir string
+}
+
+// put writes data with write-then-rename, so a crash never leaves half an
+// object behind.
+func (d dirStore) put(name string, data []byte) error {
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	path := filepath.Join(d.dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func (d dirStore) get(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(d.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errObjectNotFound
+	}
+	return data, err
+}
+
+func (d dirStore) delete(name string) error {
+	err := os.Remove(filepath.Join(d.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// s3Store is a coldStore under a prefix in a bucket.
+type s3Store struct {
+	client *s3Client
+	prefix string
+}
+
+func (s s3Store) put(name string, data []byte) error {
+	return s.client.put(s.prefix+name, data)
+}
+
+func (s s3Store) get(name string) ([]byte, error) {
+	return s.client.get(s.prefix + name)
+}
+
+func (s s3Store) delete(name string) error {
+	return s.client.delete(s.prefix + name)
+}
+
+// Archive keeps pruned events in a cold store.
+type Archive struct {
+	store coldStore
+	key   []byte
+	// location is where the archive is, for logs.
+	location string
+}
+
+// newArchive returns the archive cfg configures, or nil without one.
+func newArchive(cfg *config.ArchiveConfig) *Archive {
+	if cfg == nil {
+		return nil
+	}
+	archive := &Archive{key: cfg.GetKey(), location: cfg.Location}
+	if dir := cfg.Dir(); dir != "" {
+		archive.store = dirStore{dir: dir}
+		return archive
+	}
+	bucket, prefix := cfg.Bucket()
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	archive.store = s3Store{client: newS3Client(cfg.S3, bucket), prefix: prefix}
+	return archive
+}
+
+// archiveName returns the object name of eventID.
+func archiveName(eventID string) string {
+	return objectName(eventID, archiveExt)
+}
+
+// objectName returns the name of eventID's object in a store, ending in
+// ext.
+// WHY hash unusual IDs: Event IDs pushed before IDs were validated could
+// contain anything, including path separators; the name must stay one
+// plain file name.
+func objectName(eventID, ext string) string {
+	for _, ch := range eventID {
+		if !(ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '-' || ch == '_') {
+			sum := sha256.Sum256([]byte(eventID))
+			return "sha256-" + hex.EncodeToString(sum[:]) + ext
+		}
+	}
+	return eventID + ext
+}
+
+// archiveLabel binds a sealed event to its ID (see e2e.SealLocal).
+func archiveLabel(eventID string) string {
+	return "archived event\n" + eventID
+}
+
+// Put writes event to the archive.
+func (a *Archive) Put(event *models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %w", event.EventID, err)
+	}
+	sealed, err := e2e.SealLocal(a.key, archiveLabel(event.EventID), data)
+	if err != nil {
+		return err
+	}
+	if err := a.store.put(archiveName(event.EventID), []byte(sealed)); err != nil {
+		return fmt.Errorf("failed to archive event %s: %w", event.EventID, err)
+	}
+	return nil
+}
+
+// Get reads eventID back from the archive, or returns nil if it isn't
+// there. A nil archive has nothing.
+func (a *Archive) Get(eventID string) (*models.Event, error) {
+	if a == nil {
+		return nil, nil
+	}
+	sealed, err := a.store.get(archiveName(eventID))
+	if errors.Is(err, errObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archived event %s: %w", eventID, err)
+	}
+	data, err := e2e.OpenLocal(a.key, archiveLabel(eventID), string(sealed))
+	if err != nil {
+		return nil, fmt.Errorf("archived event %s can't be opened with archive.key: %w", eventID, err)
+	}
+	var event models.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode archived event %s: %w", eventID, err)
+	}
+	event.Archived = true
+	return &event, nil
+}
+
+// Delete removes eventID from the archive, and reports whether it was
+// there. A nil archive has nothing.
+// WHY look first: S3 answers a DELETE the same way whether the object
+// existed or not, and the caller needs to know to answer 404.
+func (a *Archive) Delete(eventID string) (bool, error) {
+	if a == nil {
+		return false, nil
+	}
+	name := archiveName(eventID)
+	if _, err := a.store.get(name); errors.Is(err, errObjectNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read archived event %s: %w", eventID, err)
+	}
+	if err := a.store.delete(name); err != nil {
+		return false, fmt.Errorf("failed to delete archived event %s: %w", eventID, err)
+	}
+	return true, nil
+}
+
+// runArchive implements `hub archive -event ID [-genkey] [config-path]`:
+// it prints an archived event, or a new archive key.
+func runArchive(args []string) error {
+	fs := newCommandFlags("archive")
+	eventID := fs.String("event", "", "print the archived event with this `ID`")
+	genkey := fs.Bool("genkey", false, "print a new archive key and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *genkey {
+		return printNewKey()
+	}
+	if *eventID == "" {
+		fs.Usage()
+		return fmt.Errorf("-event is required")
+	}
+
+	cfg, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+	archive := newArchive(cfg.Archive)
+	if archive == nil {
+		return fmt.Errorf("no archive is configured")
+	}
+
+	event, err := archive.Get(*eventID)
+	if err != nil {
+		return err
+	}
+	if event == nil {
+		if live, err := storage.GetEvent(*eventID); err == nil && live != nil {
+			return fmt.Errorf("event %s is still in history, not archived", *eventID)
+		}
+		return cli.Exit(cli.ExitEmpty, fmt.Errorf("event %s is not in the archive at %s", *eventID, archive.location))
+	}
+	return cli.PrintJSON(event)
+}
@@ -0,0 +1,285 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the hub's blob store for file clips and the
+// /api/v1/blobs/{id} download endpoint.
+//
+// WHY file clips leave the database:
+// A file clip is up to max_file_size of base64 in the events table. A few
+// hundred screenshots make a database of gigabytes that every backup copies
+// and every VACUUM rewrites, on whatever disk the hub has. With blobs
+// configured, a file clip's text goes to an S3-compatible bucket when it is
+// stored, and its row keeps only the metadata and the object's name.
+//
+// WHY download URLs instead of text:
+// History and event responses carry a blob_url for an offloaded clip, and
+// agents that ask for it (models.WebSocketFeatureBlobs) get file broadcasts
+// that way too. A presigned URL sends the download straight to the bucket;
+// otherwise the hub proxies it. Either way the URL itself is the permission
+// to download, for a limited time: an agent on a device token may fetch the
+// file it was sent without being allowed to read history.
+//
+// WHY not encrypted like the archive:
+// Agents download presigned objects from the bucket directly, so the hub
+// can't decrypt on the way. End-to-end encrypted clips are stored as the
+// ciphertext they arrived as.
+//
+// WHY deletions go through blob_trash:
+// Events leave the table by retention, `hub revalidate -delete`, the API,
+// guest passes, and more. A trigger notes the object of every deleted row,
+// and the retention job deletes the noted objects, retrying those the store
+// refused.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/tmair/tailclip/shared/auth"
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// blobExt ends every blob's object name.
+const blobExt = ".blob"
+
+// blobSweepBatch is how many trashed objects one sweep deletes at most.
+const blobSweepBatch = 500
+
+// blobSweepInterval is how often the hub deletes the objects of deleted
+// events.
+const blobSweepInterval = time.Hour
+
+// BlobStore keeps the text of file clips in a bucket.
+type BlobStore struct {
+	client  *s3Client
+	prefix  string
+	minSize int
+	presign bool
+	urlTTL  time.Duration
+	// location is where the store is, for logs.
+	location string
+
+	// urlKey signs proxied download URLs.
+	// WHY made at startup: The URLs only have to outlive urlTTL; a restart
+	// invalidating them costs a client one retry through the API.
+	urlKey []byte
+}
+
+// newBlobStore returns the blob store cfg configures, or nil without one.
+func newBlobStore(cfg *config.BlobConfig) *BlobStore {
+	if cfg == nil {
+		return nil
+	}
+	bucket, prefix := cfg.Bucket()
+	if prefix != "" && prefix[len(prefix)-1] != '/' {
+		prefix += "/"
+	}
+	urlKey := make([]byte, 32)
+	rand.Read(urlKey)
+	return &BlobStore{
+		client:   newS3Client(cfg.S3, bucket),
+		prefix:   prefix,
+		minSize:  cfg.MinSize,
+		presign:  cfg.Presign,
+		urlTTL:   cfg.GetURLTTL(),
+		location: cfg.Location,
+		urlKey:   urlKey,
+	}
+}
+
+// Offload writes the text of a file clip about to be stored to the bucket
+// and sets its BlobKey, which has InsertEvent store the row without it.
+// Text clips, small files, and a nil store leave the event alone.
+// WHY keep the text on the event: The broadcast that follows still needs
+// it for agents that can't fetch blobs.
+func (b *BlobStore) Offload(event *models.Event) error {
+	if b == nil || event.ContentType != models.ContentTypeFile || len(event.Text) < b.minSize || event.BlobKey != "" {
+		return nil
+	}
+	key := b.prefix + objectName(event.EventID, blobExt)
+	if err := b.client.put(key, []byte(event.Text)); err != nil {
+		return fmt.Errorf("failed to offload event %s: %w", event.EventID, err)
+	}
+	event.BlobKey = key
+	return nil
+}
+
+// Load reads the text of an offloaded event back from the bucket. Events
+// whose text is in the database are left alone.
+func (b *BlobStore) Load(event *models.Event) error {
+	if event.BlobKey == "" || event.Text != "" {
+		return nil
+	}
+	if b == nil {
+		return fmt.Errorf("event %s is in a blob store, but blobs are not configured", event.EventID)
+	}
+	data, err := b.client.get(event.BlobKey)
+	if errors.Is(err, errObjectNotFound) {
+		return fmt.Errorf("event %s: object %s is missing from the blob store", event.EventID, event.BlobKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the blob of event %s: %w", event.EventID, err)
+	}
+	event.Text = string(data)
+	return nil
+}
+
+// URL returns where to download an offloaded event's text until the URL
+// expires, or "" for an event whose text is in the database.
+func (b *BlobStore) URL(event *models.Event, now time.Time) string {
+	if event.BlobKey == "" || b == nil {
+		return ""
+	}
+	if b.presign {
+		if u, err := b.client.presign(event.BlobKey, b.urlTTL, now.UTC()); err == nil {
+			return u
+		}
+	}
+	expires := strconv.FormatInt(now.Add(b.urlTTL).Unix(), 10)
+	return "/api/v1/blobs/" + url.PathEscape(event.EventID) +
+		"?expires=" + expires + "&sig=" + b.urlSignature(event.EventID, expires)
+}
+
+// urlSignature signs a proxied download URL.
+func (b *BlobStore) urlSignature(eventID, expires string) string {
+	mac := hmac.New(sha256.New, b.urlKey)
+	mac.Write([]byte(eventID + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedURL reports whether r carries a valid, unexpired signature for
+// eventID.
+func (b *BlobStore) signedURL(r *http.Request, eventID string, now time.Time) bool {
+	expires, sig := r.URL.Query().Get("expires"), r.URL.Query().Get("sig")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > unix {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(b.urlSignature(eventID, expires)))
+}
+
+// withURLs returns events with BlobURL set on the offloaded ones.
+// WHY a copy: The slice may be the history cache's, shared with every
+// other reader; the URLs are only good for this response.
+func (b *BlobStore) withURLs(events []models.Event) []models.Event {
+	if b == nil || !slices.ContainsFunc(events, func(e models.Event) bool { return e.BlobKey != "" }) {
+		return events
+	}
+	now := time.Now()
+	linked := slices.Clone(events)
+	for i := range linked {
+		linked[i].BlobURL = b.URL(&linked[i], now)
+	}
+	return linked
+}
+
+// Sweep deletes the objects of deleted events noted in blob_trash and
+// returns how many it deleted. A nil store leaves them for when one is
+// configured again.
+func (b *BlobStore) Sweep(storage *Storage) (int, error) {
+	if b == nil {
+		return 0, nil
+	}
+	keys, err := storage.TrashedBlobs(blobSweepBatch)
+	if err != nil {
+		return 0, err
+	}
+	var deleted []string
+	var firstErr error
+	for _, key := range keys {
+		if err := b.client.delete(key); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		deleted = append(deleted, key)
+	}
+	if err := storage.ForgetTrashedBlobs(deleted); err != nil {
+		return 0, err
+	}
+	return len(deleted), firstErr
+}
+
+// RunBlobSweep deletes the objects of deleted events now and every
+// blobSweepInterval. It returns at once without a blob store.
+func (s *Server) RunBlobSweep() {
+	if s.blobs == nil {
+		return
+	}
+	serverLog.Infof("Keeping file clips in the blob store at %s", s.blobs.location)
+	ticker := time.NewTicker(blobSweepInterval)
+	defer ticker.Stop()
+	for {
+		deleted, err := s.blobs.Sweep(s.storage)
+		if err != nil {
+			serverLog.Errorf("deleting blobs of deleted events: %v", err)
+		}
+		if deleted > 0 {
+			serverLog.Infof("Deleted the blobs of %d deleted event(s)", deleted)
+		}
+		<-ticker.C
+	}
+}
+
+// sweepBlobs deletes, for a maintenance command, the objects of the events
+// it just deleted.
+func sweepBlobs(blobs *BlobStore, storage *Storage) error {
+	for {
+		deleted, err := blobs.Sweep(storage)
+		if err != nil {
+			return err
+		}
+		if deleted > 0 {
+			fmt.Printf("Deleted the blobs of %d event(s)\n", deleted)
+		}
+		if deleted < blobSweepBatch {
+			return nil
+		}
+	}
+}
+
+// handleBlob serves the text of an offloaded event to a signed URL (see
+// BlobStore.URL) or the hub's token.
+func (s *Server) handleBlob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	eventID := r.PathValue("id")
+	if s.blobs == nil {
+		http.Error(w, "blobs are not configured", http.StatusNotFound)
+		return
+	}
+	if !s.blobs.signedURL(r, eventID, time.Now()) && !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	event, err := s.storage.GetEvent(eventID)
+	if err != nil {
+		serverLog.Errorf("fetching event %s: %v", eventID, err)
+		http.Error(w, "failed to fetch event", http.StatusInternalServerError)
+		return
+	}
+	if event == nil || event.BlobKey == "" {
+		http.Error(w, "no blob for this event", http.StatusNotFound)
+		return
+	}
+	if err := s.blobs.Load(event); err != nil {
+		serverLog.Errorf("serving blob: %v", err)
+		http.Error(w, "failed to read blob", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write([]byte(event.Text))
+}
@@ -11,12 +11,19 @@
 package main
 
 import (
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/tmair/tailclip/shared/config"
 	"github.com/tmair/tailclip/shared/models"
+	"github.com/tmair/tailclip/shared/wire"
 )
 
 // Broadcaster manages a set of active WebSocket connections and fans out
@@ -34,44 +41,359 @@ type Broadcaster struct {
 	// access must be serialized to prevent data races and panics.
 	mu sync.Mutex
 
-	// connections maps a device ID to its active WebSocket connection.
-	// WHY map[string]*websocket.Conn:
+	// connections maps a device ID to its active WebSocket client.
+	// WHY map[string]*wsClient:
 	//   - Keyed by device ID so we can quickly look up, replace, or remove
 	//     a specific device's connection without iterating the whole set.
 	//   - One connection per device: if a device reconnects, the old
 	//     connection is replaced, preventing stale duplicate deliveries.
-	connections map[string]*websocket.Conn
+	connections map[string]*wsClient
+
+	// rules are the hub's routing rules, applied to every broadcast.
+	rules []config.RoutingRule
+
+	// duplicatePolicy is the hub's duplicate_device_policy.
+	duplicatePolicy string
+
+	// compressThreshold is the hub's compress_threshold.
+	compressThreshold int
+
+	// conflictsReported remembers when each device/address conflict was
+	// last reported, so agents retrying every few seconds yield one record
+	// (and one alert) per conflictReportInterval instead of thousands.
+	conflictsReported map[string]time.Time
+
+	// seq numbers broadcasts; recent holds the last replayBufferSize of
+	// them and sessions the resumable session of each device (see session.go).
+	seq      uint64
+	recent   []models.Event
+	sessions map[string]*wsSession
+
+	// metrics counts deliveries; nil outside a running server.
+	metrics *Metrics
+
+	// blobs makes download URLs for clients that take file events by
+	// reference; nil unless blobs are configured.
+	blobs *BlobStore
+}
+
+// conflictReportInterval is how often the same conflict is re-reported.
+const conflictReportInterval = 10 * time.Minute
+
+// ErrDeviceIDInUse is returned by AddClient when the reject-new policy
+// refuses a connection.
+var ErrDeviceIDInUse = errors.New("device_id is already connected from another machine")
+
+// wsClient is one agent's WebSocket connection and what it can receive.
+type wsClient struct {
+	conn *websocket.Conn
+
+	// channels the agent subscribed to when connecting.
+	channels []string
+
+	// presence and alerts are set when the agent asked for those messages.
+	// WHY opt-in: Older agents would decode them as empty clipboard events.
+	presence bool
+	alerts   bool
+
+	// files is set when the agent can receive file events.
+	files bool
+
+	// encrypted is set when the agent can decrypt encrypted events.
+	encrypted bool
+
+	// blobs is set when the agent can download file events by reference
+	// (see blobs.go).
+	blobs bool
+
+	// chunks is set when the agent can reassemble chunked events.
+	chunks bool
+
+	// compressed is set when the agent can decompress event text.
+	compressed bool
+
+	// deletions is set when the agent wants to hear about deleted events.
+	deletions bool
+
+	// pins is set when the agent keeps events pinned for it (see Pin).
+	pins bool
+
+	// resume is set when the agent asked for a resumable session;
+	// resumeToken and resumeSeq are what it presented from the last one.
+	resume      bool
+	resumeToken string
+	resumeSeq   uint64
+
+	// session is the client's resumable session, or nil.
+	session *wsSession
+
+	// guest is set when the client connected on a guest pass (see guest.go).
+	guest bool
+
+	// snapshot, when set, loads the latest stored events for the client's
+	// Snapshot message (see snapshot.go).
+	snapshot func() ([]models.Event, error)
+}
+
+// accepts reports whether the client can handle event's content type and
+// encryption.
+// WHY: An agent that predates file sync decodes a file event as text and
+// would paste its base64 content; the same goes for encrypted events and
+// their ciphertext. A stored event whose text is in the blob store only
+// reaches agents that can download it.
+func (c *wsClient) accepts(event *models.Event) bool {
+	if event.Encrypted && !c.encrypted {
+		return false
+	}
+	if event.BlobKey != "" && event.Text == "" && !c.blobs {
+		return false
+	}
+	return event.ContentType != models.ContentTypeFile || c.files
 }
 
 // NewBroadcaster creates a ready-to-use Broadcaster with an empty client map.
 // WHY a constructor: Ensures the map is always initialized. A zero-value
 // Broadcaster would have a nil map and panic on the first AddClient call.
-func NewBroadcaster() *Broadcaster {
+func NewBroadcaster(cfg *config.HubConfig) *Broadcaster {
 	return &Broadcaster{
-		connections: make(map[string]*websocket.Conn),
+		connections:       make(map[string]*wsClient),
+		rules:             cfg.RoutingRules,
+		duplicatePolicy:   cfg.DuplicateDevicePolicy,
+		compressThreshold: cfg.CompressThreshold,
+		conflictsReported: make(map[string]time.Time),
+		sessions:          make(map[string]*wsSession),
 	}
 }
 
-// AddClient registers (or replaces) a WebSocket connection for the given device.
+// AddClient registers (or replaces) a WebSocket client for the given device.
 //
 // WHY replace on duplicate: If an agent reconnects (e.g., after a network
 // blip), the hub should seamlessly accept the new connection. Closing the
 // old one prevents resource leaks and avoids sending events twice - once on
 // the dead connection (which would error) and once on the live one.
-func (b *Broadcaster) AddClient(deviceID string, conn *websocket.Conn) {
+//
+// WHY compare remote addresses: A reconnect comes from the same machine, so
+// the same address. A different address means two machines claim one device
+// ID - a conflict, handled per duplicatePolicy. The returned conflict is
+// non-nil when it should be recorded; ErrDeviceIDInUse means the new client
+// was refused and the caller must close it.
+func (b *Broadcaster) AddClient(deviceID string, client *wsClient) (*models.DeviceConflict, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	// Close any existing connection for this device before replacing it.
-	// WHY: Prevents goroutine leaks and ensures only one active connection
-	// per device at any time.
+	var conflict *models.DeviceConflict
 	if existing, ok := b.connections[deviceID]; ok {
-		log.Printf("Replacing existing WebSocket for device %s", deviceID)
-		existing.Close()
+		existingAddr, newAddr := remoteHost(existing.conn), remoteHost(client.conn)
+		if existingAddr != newAddr {
+			conflict = b.reportConflict(deviceID, existingAddr, newAddr)
+			broadcastLog.Warnf("device ID %s connected from %s while already connected from %s (policy: %s)",
+				deviceID, newAddr, existingAddr, b.duplicatePolicy)
+
+			if b.duplicatePolicy == config.DuplicatePolicyRejectNew {
+				return conflict, ErrDeviceIDInUse
+			}
+			// WHY only when reported: Two flapping machines reconnect every
+			// few seconds; one notification per report interval is enough.
+			if b.duplicatePolicy == config.DuplicatePolicyAlert && conflict != nil {
+				msg := fmt.Sprintf("Two machines (%s and %s) are using the device ID %q and keep disconnecting each other. Give each machine its own device_id.",
+					existingAddr, newAddr, deviceID)
+				sendAlert(existing, deviceID, msg)
+				defer sendAlert(client, deviceID, msg)
+			}
+		}
+
+		// Close any existing connection for this device before replacing it.
+		// WHY: Prevents goroutine leaks and ensures only one active connection
+		// per device at any time.
+		broadcastLog.Infof("Replacing existing WebSocket for device %s", deviceID)
+		existing.conn.Close()
+	}
+
+	b.connections[deviceID] = client
+	broadcastLog.Infof("WebSocket client added: %s (total: %d)", deviceID, len(b.connections))
+	// WHY under the same lock as the add: No broadcast can slip in between
+	// the snapshot or replay and the client going live, so nothing is lost.
+	if client.snapshot != nil {
+		b.sendSnapshot(deviceID, client)
+	}
+	if client.resume {
+		b.startSession(deviceID, client)
+	}
+	b.sendPresence()
+	return conflict, nil
+}
+
+// reportConflict returns a conflict record unless the same conflict was
+// reported recently. Caller must hold b.mu.
+func (b *Broadcaster) reportConflict(deviceID, existingAddr, newAddr string) *models.DeviceConflict {
+	// WHY order-independent: Flapping machines alternate which one is
+	// "existing"; both directions are the same conflict.
+	addrs := []string{existingAddr, newAddr}
+	sort.Strings(addrs)
+	key := deviceID + "|" + addrs[0] + "|" + addrs[1]
+	now := time.Now().UTC()
+	if last, ok := b.conflictsReported[key]; ok && now.Sub(last) < conflictReportInterval {
+		return nil
+	}
+	b.conflictsReported[key] = now
+	return &models.DeviceConflict{
+		DeviceID:     deviceID,
+		ExistingAddr: existingAddr,
+		NewAddr:      newAddr,
+		Action:       b.duplicatePolicy,
+		DetectedAt:   now,
+	}
+}
+
+// sendAlert delivers an alert to a client that opted in to alerts.
+func sendAlert(client *wsClient, deviceID, message string) {
+	if !client.alerts {
+		return
+	}
+	if err := writeMessage(client.conn, &wire.Message{Alert: &models.Alert{Message: message}}); err != nil {
+		broadcastLog.Errorf("sending alert to %s: %v", deviceID, err)
+	}
+}
+
+// Alert sends message to deviceID's client, if it is connected and opted
+// in to alerts.
+func (b *Broadcaster) Alert(deviceID, message string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if client, ok := b.connections[deviceID]; ok {
+		sendAlert(client, deviceID, message)
+	}
+}
+
+// Announce sends an operator's announcement to the connected clients that
+// opted in to alerts, or only to those of deviceIDs when given, and returns
+// how many it reached.
+func (b *Broadcaster) Announce(message string, deviceIDs []string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg := &wire.Message{Alert: &models.Alert{Message: message, Announcement: true}}
+	delivered := 0
+	for deviceID, client := range b.connections {
+		if !client.alerts || (len(deviceIDs) > 0 && !slices.Contains(deviceIDs, deviceID)) {
+			continue
+		}
+		if err := writeMessage(client.conn, msg); err != nil {
+			broadcastLog.Errorf("sending announcement to %s: %v", deviceID, err)
+			continue
+		}
+		delivered++
+	}
+	return delivered
+}
+
+// writeMessage encodes msg in the wire format and writes it to conn.
+func writeMessage(conn *websocket.Conn, msg *wire.Message) error {
+	data, err := wire.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// encodedEvent is an event encoded for writing to clients: as is, with
+// compressed text for clients that can decompress it, and, for an event in
+// the blob store, with a download URL instead of text for clients that can
+// fetch it.
+// WHY encode lazily, at most once each: Most fan-outs only need one of the
+// three, and compressing a multi-megabyte clip for every client would cost
+// more CPU than it saves bandwidth.
+type encodedEvent struct {
+	event     *models.Event
+	threshold int
+	blobs     *BlobStore
+
+	plain      []byte
+	compressed []byte // nil when compression doesn't pay off
+	triedGzip  bool
+	linked     []byte
+}
+
+// newEncodedEvent prepares event for writing, compressing text longer than
+// threshold bytes for clients that can take it, and linking to it in blobs
+// if it was offloaded there.
+func newEncodedEvent(event *models.Event, threshold int, blobs *BlobStore) *encodedEvent {
+	return &encodedEvent{event: event, threshold: threshold, blobs: blobs}
+}
+
+// forClient returns the encoding client should receive.
+func (e *encodedEvent) forClient(client *wsClient) ([]byte, error) {
+	if client.blobs && e.event.BlobKey != "" && e.blobs != nil {
+		if e.linked == nil {
+			linked := *e.event
+			linked.Text, linked.BlobURL = "", e.blobs.URL(e.event, time.Now())
+			data, err := wire.Marshal(&wire.Message{Event: &linked})
+			if err != nil {
+				return nil, err
+			}
+			e.linked = data
+		}
+		return e.linked, nil
+	}
+	if client.compressed && !e.triedGzip {
+		e.triedGzip = true
+		if compressed := wire.Compress(e.event, e.threshold); compressed != e.event {
+			data, err := wire.Marshal(&wire.Message{Event: compressed})
+			if err != nil {
+				return nil, err
+			}
+			e.compressed = data
+		}
+	}
+	if client.compressed && e.compressed != nil {
+		return e.compressed, nil
+	}
+	if e.plain == nil {
+		data, err := wire.Marshal(&wire.Message{Event: e.event})
+		if err != nil {
+			return nil, err
+		}
+		e.plain = data
+	}
+	return e.plain, nil
+}
+
+// writeEvent writes an event to client, compressed if the client can
+// decompress it, and split into Chunk messages if it is large and the
+// client can reassemble them.
+// WHY per client: Older agents only understand whole, uncompressed events,
+// and for them nothing changes.
+func writeEvent(client *wsClient, encoded *encodedEvent) error {
+	data, err := encoded.forClient(client)
+	if err != nil {
+		return err
 	}
+	return writeChunked(client, encoded.event.EventID, data)
+}
 
-	b.connections[deviceID] = conn
-	log.Printf("WebSocket client added: %s (total: %d)", deviceID, len(b.connections))
+// writeChunked writes an encoded message, in parts when it is large and the
+// client can reassemble them. id names the message in its Chunk parts.
+func writeChunked(client *wsClient, id string, data []byte) error {
+	if client.chunks {
+		if chunks := wire.Split(id, data, wire.ChunkSize); chunks != nil {
+			for i := range chunks {
+				if err := writeMessage(client.conn, &wire.Message{Chunk: &chunks[i]}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return client.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// remoteHost returns the IP part of a connection's remote address.
+// WHY drop the port: Every reconnect uses a new source port.
+func remoteHost(conn *websocket.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
 }
 
 // RemoveClient unregisters a device and closes its WebSocket connection.
@@ -80,19 +402,121 @@ func (b *Broadcaster) AddClient(deviceID string, conn *websocket.Conn) {
 // the hub must remove the stale entry so Broadcast doesn't waste time
 // writing to a dead socket. The Close call releases the underlying TCP
 // connection, freeing OS-level file descriptors.
-func (b *Broadcaster) RemoveClient(deviceID string) {
+//
+// WHY match on conn as well as device ID: When a device reconnects, the old
+// connection's read loop exits *after* AddClient installed the new one.
+// Removing by ID alone would drop the fresh connection.
+func (b *Broadcaster) RemoveClient(deviceID string, conn *websocket.Conn) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if conn, ok := b.connections[deviceID]; ok {
-		conn.Close()
+	if client, ok := b.connections[deviceID]; ok && client.conn == conn {
+		client.conn.Close()
 		delete(b.connections, deviceID)
-		log.Printf("WebSocket client removed: %s (total: %d)", deviceID, len(b.connections))
+		broadcastLog.Infof("WebSocket client removed: %s (total: %d)", deviceID, len(b.connections))
+		b.sendPresence()
+	}
+}
+
+// ConnectedDevices returns the IDs of the devices with a connection open.
+func (b *Broadcaster) ConnectedDevices() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return slices.Collect(maps.Keys(b.connections))
+}
+
+// GuestDevices returns the IDs of connected devices that are on a guest
+// pass.
+func (b *Broadcaster) GuestDevices() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var deviceIDs []string
+	for deviceID, client := range b.connections {
+		if client.guest {
+			deviceIDs = append(deviceIDs, deviceID)
+		}
+	}
+	return deviceIDs
+}
+
+// Disconnect closes a device's WebSocket connection, if it has one.
+// WHY only close: The connection's read loop then exits and removes the
+// client through RemoveClient, as for any other disconnect.
+func (b *Broadcaster) Disconnect(deviceID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if client, ok := b.connections[deviceID]; ok {
+		client.conn.Close()
+	}
+}
+
+// Forget drops a deleted event from the replay buffer and tells every
+// opted-in client it was deleted.
+// WHY every client rather than the ones it was routed to: Subscriptions and
+// rules may have changed since the broadcast. Agents ignore notices for
+// clips they never applied.
+func (b *Broadcaster) Forget(eventID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// WHY DeleteFunc: It zeroes the vacated slots, so the clip text doesn't
+	// stay reachable through the backing array.
+	b.recent = slices.DeleteFunc(b.recent, func(event models.Event) bool {
+		return event.EventID == eventID
+	})
+
+	msg := &wire.Message{Deleted: &models.Deleted{EventID: eventID}}
+	for deviceID, client := range b.connections {
+		if !client.deletions {
+			continue
+		}
+		if err := writeMessage(client.conn, msg); err != nil {
+			broadcastLog.Errorf("sending deletion of %s to %s: %v", eventID, deviceID, err)
+		}
+	}
+}
+
+// SendPin tells deviceID's client about a pin change, if it is connected
+// and opted in. An agent that isn't catches up when it next connects.
+func (b *Broadcaster) SendPin(deviceID string, pin *models.Pin) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	client, ok := b.connections[deviceID]
+	if !ok || !client.pins {
+		return
+	}
+	if pin.Event != nil && !client.accepts(pin.Event) {
+		return
+	}
+	if err := writeMessage(client.conn, &wire.Message{Pin: pin}); err != nil {
+		broadcastLog.Errorf("sending pin of %s to %s: %v", pin.EventID, deviceID, err)
+	}
+}
+
+// sendPresence tells every opted-in client how many other devices are online.
+// WHY on every add/remove instead of on a timer: Presence only changes at
+// those moments, and agents should speed polling back up immediately when a
+// peer appears. Caller must hold b.mu.
+func (b *Broadcaster) sendPresence() {
+	peers := len(b.connections) - 1
+	for deviceID, client := range b.connections {
+		if !client.presence {
+			continue
+		}
+		msg := &wire.Message{Presence: &models.Presence{Peers: peers}}
+		if err := writeMessage(client.conn, msg); err != nil {
+			broadcastLog.Errorf("sending presence to %s: %v", deviceID, err)
+		}
 	}
 }
 
 // Broadcast sends a clipboard event to every connected agent EXCEPT the one
-// that originated the event.
+// that originated the event, subject to channel subscriptions and routing
+// rules (see routing.go).
 //
 // WHY skip the source device:
 // If we sent the event back to the originator, the agent would see "new"
@@ -109,34 +533,49 @@ func (b *Broadcaster) Broadcast(event *models.Event, sourceDeviceID string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	// Pre-serialize the event once instead of marshaling per-client.
+	// WHY stamp under the lock, right before writing: It marks the moment
+	// fan-out starts, so time spent waiting for the lock counts as hub time.
+	event.HubBroadcastAt = time.Now().UTC()
+	b.seq++
+	event.Seq = b.seq
+	b.remember(event)
+
+	// Serialize the event once instead of marshaling per-client.
 	// WHY: Avoids redundant JSON encoding when there are many connected
 	// devices, reducing CPU usage proportional to client count.
-	data, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("ERROR marshaling event for broadcast: %v", err)
-		return
+	encoded := newEncodedEvent(event, b.compressThreshold, b.blobs)
+
+	rule := matchRoute(b.rules, event)
+	if rule != nil && rule.Name != "" {
+		broadcastLog.Debugf("Routing event %s by rule %q", event.EventID, rule.Name)
 	}
 
 	sent := 0
-	for deviceID, conn := range b.connections {
+	for deviceID, client := range b.connections {
 		// Skip the device that created this event to prevent sync loops.
 		if deviceID == sourceDeviceID {
 			continue
 		}
+		if !deliverTo(rule, event, deviceID, client.channels) || !client.accepts(event) {
+			continue
+		}
 
-		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-			log.Printf("ERROR broadcasting to %s: %v", deviceID, err)
+		if err := writeEvent(client, encoded); err != nil {
+			broadcastLog.Errorf("broadcasting to %s: %v", deviceID, err)
 			// Don't remove here - let the read-loop handle disconnection.
 			// WHY: The read goroutine has better context about whether the
 			// connection is truly dead or just temporarily congested.
 			continue
 		}
+		if client.session != nil {
+			client.session.lastSeq = event.Seq
+		}
 		sent++
 	}
 
+	b.metrics.broadcastsDelivered(sent)
 	if sent > 0 {
-		log.Printf("Broadcast event %s to %d client(s) (source: %s)",
+		broadcastLog.Infof("Broadcast event %s to %d client(s) (source: %s)",
 			event.EventID, sent, sourceDeviceID)
 	}
 }
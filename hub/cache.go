@@ -0,0 +1,103 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the hub's cache of hot history pages.
+//
+// WHY cache anything in front of SQLite:
+// A dashboard refreshing every second and a few agents asking for the
+// latest clip all ask for the same first page of history, which only
+// changes when a clip arrives. Answering them from memory keeps SQLite free
+// for the writes that matter.
+//
+// WHY only unfiltered first pages:
+// Those are the repeated ones - the default page and ?limit=1 (the latest
+// clip, see client.Latest). Searches and catch-up queries differ per caller
+// and would only fill the cache.
+//
+// WHY invalidate on every write instead of expiring:
+// A cached page must never hide a clip that was just pushed; agents and
+// dashboards rely on seeing it at once. historyCacheTTL only bounds how long
+// a change made by another process (e.g. `hub pin` on the same database)
+// can go unnoticed.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// historyCacheTTL is how long a cached page is served without a write
+// through this Storage.
+const historyCacheTTL = 5 * time.Second
+
+// historyCacheKey identifies a cacheable history page.
+type historyCacheKey struct {
+	limit    int
+	metaOnly bool
+}
+
+// historyCachePage is a cached page and when it was read.
+type historyCachePage struct {
+	events   []models.Event
+	cachedAt time.Time
+}
+
+// historyCache holds recently read first pages of history.
+type historyCache struct {
+	mu    sync.Mutex
+	pages map[historyCacheKey]historyCachePage
+	// generation counts invalidations.
+	// WHY: A read that started before a write must not store its (now
+	// stale) page after the write cleared the cache.
+	generation uint64
+}
+
+// newHistoryCache creates an empty cache.
+func newHistoryCache() *historyCache {
+	return &historyCache{pages: make(map[historyCacheKey]historyCachePage)}
+}
+
+// cacheKey returns the key for q, or false if q isn't cacheable.
+func (q HistoryQuery) cacheKey() (historyCacheKey, bool) {
+	if q.Text != "" || q.Pinned || q.PinnedFor != "" || !q.Since.IsZero() || q.SinceEvent != "" || q.Offset != 0 {
+		return historyCacheKey{}, false
+	}
+	return historyCacheKey{limit: q.Limit, metaOnly: q.MetaOnly}, true
+}
+
+// get returns a copy of the cached page for key, and the current
+// generation to pass to put on a miss.
+// WHY a copy: Callers may modify the events they get (e.g., to seal or
+// route them); the cached page must stay as stored.
+func (c *historyCache) get(key historyCacheKey, now time.Time) ([]models.Event, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	page, ok := c.pages[key]
+	if !ok || now.Sub(page.cachedAt) > historyCacheTTL {
+		return nil, false, c.generation
+	}
+	if page.events == nil {
+		return nil, true, c.generation
+	}
+	return append([]models.Event(nil), page.events...), true, c.generation
+}
+
+// put caches a page read at generation, unless the cache was invalidated
+// since.
+func (c *historyCache) put(key historyCacheKey, events []models.Event, generation uint64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.pages[key] = historyCachePage{events: append([]models.Event(nil), events...), cachedAt: now}
+}
+
+// invalidate drops every cached page. Called after any write to events.
+func (c *historyCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	clear(c.pages)
+}
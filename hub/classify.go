@@ -0,0 +1,157 @@
+// Author: Toluwalase Mebaanne
+// Package main provides clip class statistics: how many clips of each coarse
+// kind (URL, code, short or long text, image, other file) each device
+// pushes.
+//
+// WHY classes instead of anything finer:
+// "Most of what the phone syncs is links" is the insight people want, and
+// it's as much as can be said without keeping content. A class is decided
+// from the clip as it passes through and only a counter is incremented;
+// nothing about the text itself is remembered.
+//
+// WHY opt-in (clip_class_stats):
+// Even coarse classes say something about what people copy. A household
+// should decide to collect that, not find out it was collected.
+//
+// Like stats.go, counts live in memory and reset with the process.
+
+package main
+
+import (
+	"maps"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// Clip classes, as reported in /api/v1/stats and /metrics.
+const (
+	ClipClassURL       = "url"
+	ClipClassCode      = "code"
+	ClipClassShortText = "short_text"
+	ClipClassLongText  = "long_text"
+	ClipClassImage     = "image"
+	ClipClassFile      = "file"
+	// ClipClassEncrypted counts clips the hub can't look into.
+	ClipClassEncrypted = "encrypted"
+)
+
+// shortTextLength is the longest text, in characters, counted as short.
+// WHY 280: Roughly a sentence or two - a name, an address, a message -
+// as opposed to paragraphs and documents.
+const shortTextLength = 280
+
+// imageExtensions are file name extensions classified as images.
+var imageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".webp", ".heic", ".bmp", ".tiff", ".svg"}
+
+// codeMarkers are strings that rarely appear in prose but often in code.
+var codeMarkers = []string{"{", "}", ";", "=>", "->", "==", "!=", "&&", "||", "()", "</", "/>", "def ", "func ", "function ", "return ", "import ", "#include", "SELECT ", "$ "}
+
+// classifyClip returns the class of event, which must have passed content
+// validation.
+func classifyClip(event *models.Event) string {
+	if event.Encrypted {
+		return ClipClassEncrypted
+	}
+	if event.ContentType == models.ContentTypeFile {
+		if slices.Contains(imageExtensions, strings.ToLower(filepath.Ext(event.FileName))) {
+			return ClipClassImage
+		}
+		return ClipClassFile
+	}
+
+	text := strings.TrimSpace(event.Text)
+	if isURL(text) {
+		return ClipClassURL
+	}
+	if looksLikeCode(text) {
+		return ClipClassCode
+	}
+	if len([]rune(text)) <= shortTextLength {
+		return ClipClassShortText
+	}
+	return ClipClassLongText
+}
+
+// isURL reports whether text is a single http(s) URL.
+func isURL(text string) bool {
+	if strings.ContainsAny(text, " \t\n") {
+		return false
+	}
+	u, err := url.Parse(text)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// looksLikeCode guesses whether text is source code or a shell command.
+// WHY a rough guess: The class only feeds an overview; a paragraph that
+// happens to contain braces being counted as code doesn't matter.
+// WHY indentation counts double: Indented lines are the surest sign of
+// code, and prose pasted from a document rarely has them.
+func looksLikeCode(text string) bool {
+	lines := strings.Split(text, "\n")
+	score := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+			score += 2
+		}
+		for _, marker := range codeMarkers {
+			if strings.Contains(line, marker) {
+				score++
+				break
+			}
+		}
+	}
+	// WHY relative to the line count: A long text with a few semicolons is
+	// still prose; most lines of code carry a marker.
+	return score >= 2 && score*2 >= len(lines)
+}
+
+// ClipClassRecorder counts clips by source device and class.
+// A nil *ClipClassRecorder is valid and counts nothing, for when
+// clip_class_stats is off.
+type ClipClassRecorder struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int64 // device ID -> class -> clips
+}
+
+// NewClipClassRecorder creates a recorder if enabled, or returns nil.
+func NewClipClassRecorder(enabled bool) *ClipClassRecorder {
+	if !enabled {
+		return nil
+	}
+	return &ClipClassRecorder{counts: make(map[string]map[string]int64)}
+}
+
+// Add counts event under its source device and class.
+func (c *ClipClassRecorder) Add(event *models.Event) {
+	if c == nil {
+		return
+	}
+	class := classifyClip(event)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	byClass := c.counts[event.SourceDeviceID]
+	if byClass == nil {
+		byClass = make(map[string]int64)
+		c.counts[event.SourceDeviceID] = byClass
+	}
+	byClass[class]++
+}
+
+// Stats returns a copy of the counts, or nil if the recorder is off.
+func (c *ClipClassRecorder) Stats() map[string]map[string]int64 {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make(map[string]map[string]int64, len(c.counts))
+	for deviceID, byClass := range c.counts {
+		stats[deviceID] = maps.Clone(byClass)
+	}
+	return stats
+}
@@ -0,0 +1,225 @@
+// Author: Toluwalase Mebaanne
+// Package main provides maintenance subcommands for the TailClip hub binary.
+//
+// WHY subcommands on the hub binary instead of a separate tool:
+// Maintenance tasks need direct access to the same storage layer, handlers,
+// and config loading as the server. Shipping them inside the hub binary means
+// operators always have a tool that matches their database schema - there is
+// no second binary to install or keep in version lockstep.
+//
+// Usage: hub [--json] <command> [flags] [config-path]
+// Running the hub with no command (or just a config path) starts the server.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/e2e"
+)
+
+// hubCommand is a maintenance subcommand.
+type hubCommand struct {
+	// summary is the one-line description shown in usage output.
+	summary string
+	// run executes the command with the arguments after its name.
+	run func(args []string) error
+}
+
+// hubCommands maps subcommand names to their implementations.
+// WHY a map checked before treating os.Args[1] as a config path: Keeps the
+// existing `hub hub-config.json` invocation working unchanged while letting
+// new commands be added in one place.
+var hubCommands = map[string]hubCommand{
+	"admit": {
+		summary: "enable a device registered with require_registered_devices (-disable to refuse it again)",
+		run:     runAdmit,
+	},
+	"announce": {
+		summary: "show a message on the connected devices, e.g. before a restart (-m TEXT)",
+		run:     runAnnounce,
+	},
+	"guest": {
+		summary: "create, list, or revoke time-limited passes for guest devices",
+		run:     runGuest,
+	},
+	"archive": {
+		summary: "print an event retention moved to the archive (-event ID), or a new archive key (-genkey)",
+		run:     runArchive,
+	},
+	"import": {
+		summary: "load history exported from CopyQ, Ditto, or Clipy as one device's clips",
+		run:     runImport,
+	},
+	"integrity": {
+		summary: "check history for rows changed or deleted outside the hub (-rebase to accept them)",
+		run:     runIntegrity,
+	},
+	"merge-devices": {
+		summary: "reassign a duplicate device's records to another device and delete it",
+		run:     runMergeDevices,
+	},
+	"note": {
+		summary: "attach a note to a history event (empty -text removes it)",
+		run:     runNote,
+	},
+	"pin": {
+		summary: "keep a history event regardless of retention, or for one device (-device); -unpin to undo",
+		run:     runPin,
+	},
+	"report": {
+		summary: "write a diagnostic report for bug reports (no secrets or clip content)",
+		run:     runReport,
+	},
+	"retention": {
+		summary: "show what retention_days and history_limit would delete (-delete to prune)",
+		run:     runRetention,
+	},
+	"revalidate": {
+		summary: "re-run content validation over stored events",
+		run:     runRevalidate,
+	},
+	"search": {
+		summary: "find history events by clip text or note",
+		run:     runSearch,
+	},
+	"shred": {
+		summary: "destroy the data keys of encrypted history, making it unreadable (-delete to shred)",
+		run:     runShred,
+	},
+	"unbind": {
+		summary: "clear a device's Tailscale node binding (tailnet_identity)",
+		run:     runUnbind,
+	},
+}
+
+// WHY register completion in init: Its script lists hubCommands, which
+// can't refer to itself in its own initializer.
+func init() {
+	hubCommands["completion"] = hubCommand{
+		summary: "print a shell completion script (bash, zsh, or fish)",
+		run:     runCompletion,
+	}
+}
+
+// jsonOutput is set by --json, before the command name or as a command's
+// own -json flag (see addJSONFlag).
+var jsonOutput bool
+
+// addJSONFlag lets a command take -json after its name as well.
+func addJSONFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&jsonOutput, cli.JSONFlag, jsonOutput, "print machine-readable JSON")
+}
+
+// runHubCommand executes a subcommand if args[0] names one.
+// WHY return a handled flag: main falls through to starting the server when
+// the first argument isn't a known command (e.g., it's a config path).
+func runHubCommand(args []string) (bool, error) {
+	args, jsonOutput = cli.CutJSONFlag(args)
+	if jsonOutput && (len(args) == 0 || hubCommands[args[0]].run == nil) {
+		return true, fmt.Errorf("--json must be followed by a command, e.g. hub --json search -q TEXT")
+	}
+	if len(args) == 0 {
+		return false, nil
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printHubUsage()
+		return true, nil
+	}
+	cmd, ok := hubCommands[args[0]]
+	if !ok {
+		return false, nil
+	}
+	return true, cmd.run(args[1:])
+}
+
+// printHubUsage lists the available subcommands.
+func printHubUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n  hub %-36s %s\n", "[config-path]", "start the hub server")
+	fmt.Fprintf(os.Stderr, "  hub %-36s %s\n", "--json <command> ...", "print a command's output as JSON")
+	names := make([]string, 0, len(hubCommands))
+	for name := range hubCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  hub %-36s %s\n", name+" [flags] [config-path]", hubCommands[name].summary)
+	}
+}
+
+// runCompletion implements `hub completion <bash|zsh|fish>`.
+func runCompletion(args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: hub completion <%s>\n", strings.Join(cli.Shells, "|"))
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("a shell is required")
+	}
+	commands := make([]cli.Command, 0, len(hubCommands))
+	for name, cmd := range hubCommands {
+		commands = append(commands, cli.Command{Name: name, Summary: cmd.summary})
+	}
+	return cli.Completion(os.Stdout, fs.Arg(0), "hub", commands)
+}
+
+// newCommandFlags creates a FlagSet whose usage line matches the hub's
+// `hub <command> [flags] [config-path]` convention.
+func newCommandFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: hub %s [flags] [config-path]\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// openCommandStorage loads the hub config named by the first positional
+// argument (or the default path) and opens its database.
+// WHY shared: Every maintenance command starts the same way as the server
+// does, so they all honor the same config file and env var overrides.
+func openCommandStorage(fs *flag.FlagSet) (*config.HubConfig, *Storage, error) {
+	configPath := defaultConfigPath
+	if fs.NArg() > 0 {
+		configPath = fs.Arg(0)
+	}
+
+	cfg, err := config.LoadHubConfig(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load hub config from %s: %w", configPath, err)
+	}
+
+	storage, err := NewStorage(cfg.SQLitePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open storage at %s: %w", cfg.SQLitePath, err)
+	}
+	// WHY chain here too: Commands that delete history (retention, shred,
+	// merge-devices) would otherwise leave changes `hub integrity` reports.
+	if key := cfg.GetIntegrityKey(); key != nil {
+		storage.ChainWith(key)
+	}
+	return cfg, storage, nil
+}
+
+// printNewKey prints a new random 256-bit key in base64, for the config's
+// integrity_key and archive.key.
+func printNewKey() error {
+	key := make([]byte, e2e.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(key))
+	return nil
+}
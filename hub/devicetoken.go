@@ -0,0 +1,176 @@
+// Author: Toluwalase Mebaanne
+// Package main provides per-device auth tokens for the TailClip hub.
+//
+// WHY device tokens:
+// The shared auth_token is on every machine, so one lost laptop exposes
+// all of history and every device's identity, and recovering means
+// rotating the token everywhere. `agent enroll` trades the shared token in
+// a device's config for a token of its own, issued at registration. That
+// token is good for what a syncing agent does - push, upload, register,
+// receive over the WebSocket, and fetch data keys - and only as that
+// device. Revoking it locks out one machine and nothing else.
+//
+// The shared token keeps working for everything, including enrolling new
+// devices and revoking tokens, so it belongs on the hub machine (and in
+// scripts), not on every laptop.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tmair/tailclip/shared/auth"
+)
+
+// caller is who an authenticated request comes from.
+type caller struct {
+	// deviceID is the device whose own token the request carries; empty
+	// for the hub's token and guest passes
+	deviceID string
+	// guest is the pass a guest device's request carries, or nil
+	guest *GuestPass
+}
+
+// allows reports whether the caller may act as deviceID. The hub's token
+// may act as any device, a device token or guest pass only as its own.
+func (c caller) allows(deviceID string) bool {
+	if c.deviceID != "" {
+		return c.deviceID == deviceID
+	}
+	return c.guest.allows(deviceID)
+}
+
+// deviceMismatch describes why the caller may not act as another device.
+func (c caller) deviceMismatch() string {
+	if c.deviceID != "" {
+		return fmt.Sprintf("token is for device %s", c.deviceID)
+	}
+	return fmt.Sprintf("guest pass is for device %s", c.guest.DeviceID)
+}
+
+// isHubToken reports whether the request carries the hub's own token.
+func (c caller) isHubToken() bool {
+	return c.deviceID == "" && c.guest == nil
+}
+
+// authenticate checks r's token against the hub's auth token, the device
+// tokens, and the unexpired guest passes.
+// WHY only some handlers use it: Devices and guests get the endpoints a
+// syncing agent needs and nothing more (see the package comments); the
+// rest keep checking the hub's token alone.
+func (s *Server) authenticate(r *http.Request) (caller, bool) {
+	deviceID, ok, err := auth.AuthenticateDevice(r, s.authToken, s.storage.DeviceForToken)
+	if err != nil {
+		authLog.Errorf("checking device token: %v", err)
+		return caller{}, false
+	}
+	if ok {
+		return caller{deviceID: deviceID}, true
+	}
+
+	token := auth.ExtractToken(r)
+	if token == "" {
+		return caller{}, false
+	}
+	pass, err := s.storage.GuestPassByToken(auth.HashToken(token), time.Now())
+	if err != nil {
+		authLog.Errorf("checking guest pass: %v", err)
+		return caller{}, false
+	}
+	return caller{guest: pass}, pass != nil
+}
+
+// refuseOtherDevice answers a request made for a device other than the
+// caller's own, and reports whether it did.
+func refuseOtherDevice(w http.ResponseWriter, who caller, deviceID string) bool {
+	if who.allows(deviceID) {
+		return false
+	}
+	http.Error(w, who.deviceMismatch(), http.StatusForbidden)
+	return true
+}
+
+// issueDeviceToken creates a token for a registered device and returns it,
+// or "" if the device already has one.
+func (s *Server) issueDeviceToken(deviceID string) (string, error) {
+	token, err := auth.NewToken()
+	if err != nil {
+		return "", err
+	}
+	issued, err := s.storage.IssueDeviceToken(deviceID, auth.HashToken(token))
+	if err != nil || !issued {
+		return "", err
+	}
+	authLog.Infof("Issued a device token to %s", deviceID)
+	return token, nil
+}
+
+// handleDeviceToken revokes a device's token (DELETE) and disconnects the
+// device.
+// WHY the hub's token only: Revoking is for when a device is lost; the
+// lost device's own token must not be able to undo anything.
+// WHY disconnect: The WebSocket was authenticated when it opened; without
+// closing it, a revoked device would keep receiving clips.
+func (s *Server) handleDeviceToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	deviceID := r.PathValue("id")
+	hadToken, err := s.storage.RevokeDeviceToken(deviceID)
+	if errors.Is(err, ErrDeviceNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		authLog.Errorf("revoking token of %s: %v", deviceID, err)
+		http.Error(w, "failed to revoke device token", http.StatusInternalServerError)
+		return
+	}
+
+	if hadToken {
+		s.broadcaster.Disconnect(deviceID)
+		authLog.Infof("Revoked the device token of %s", deviceID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeviceSigningKey clears a device's registered signing key (DELETE),
+// so the next key it registers is stored (see Device.SigningKey).
+// WHY the hub's token only: The key stops anyone else with the shared
+// token from pushing signed clips in the device's name; a device token must
+// not be able to swap it.
+func (s *Server) handleDeviceSigningKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	deviceID := r.PathValue("id")
+	found, err := s.storage.ClearDeviceSigningKey(deviceID)
+	if err != nil {
+		authLog.Errorf("clearing signing key of %s: %v", deviceID, err)
+		http.Error(w, "failed to clear signing key", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, ErrDeviceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	authLog.Infof("Cleared the signing key of %s", deviceID)
+	w.WriteHeader(http.StatusNoContent)
+}
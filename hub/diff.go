@@ -0,0 +1,200 @@
+// Author: Toluwalase Mebaanne
+// Package main provides unified diffs between history events.
+//
+// WHY diff on the hub:
+// History often holds several versions of the same config snippet or
+// paragraph. The hub already has every version, so it can answer "what
+// changed?" directly instead of making the caller fetch both clips and
+// diff them locally.
+//
+// WHY a small LCS diff instead of a diff library: Clips are short, the
+// output only needs to be correct (not minimal in every edge case), and the
+// hub stays free of another dependency.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// diffContextLines is the number of unchanged lines shown around each change,
+// the same default as `diff -u`.
+const diffContextLines = 3
+
+// maxDiffCells caps the LCS table (changed lines in one text times changed
+// lines in the other).
+// WHY: The table is quadratic. Two unrelated 10,000-line clips would need
+// hundreds of megabytes; refusing is better than stalling the hub.
+const maxDiffCells = 4_000_000
+
+// errDiffTooLarge is returned when two texts differ in too many lines to diff.
+var errDiffTooLarge = errors.New("texts differ in too many lines to diff")
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added.
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// diffEvents returns a unified diff from one text event to another.
+// An empty string means the texts are identical.
+func diffEvents(from, to *models.Event) (string, error) {
+	ops, err := diffLines(splitLines(from.Text), splitLines(to.Text))
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(ops, diffLabel(from), diffLabel(to)), nil
+}
+
+// diffLabel names an event in the ---/+++ header lines.
+func diffLabel(event *models.Event) string {
+	return fmt.Sprintf("%s\t%s (%s)", event.EventID,
+		event.Timestamp.UTC().Format(time.RFC3339), event.SourceDeviceID)
+}
+
+// splitLines splits text into lines without their terminators.
+// WHY normalize CRLF: The same snippet copied on Windows and elsewhere would
+// otherwise differ on every line.
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes an edit script turning a into b.
+// WHY trim the common prefix and suffix first: Versions of a snippet usually
+// share most of their lines, and trimming shrinks the quadratic table to
+// just the region that changed.
+func diffLines(a, b []string) ([]diffOp, error) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(midA), len(midB)
+	if (n+1)*(m+1) > maxDiffCells {
+		return nil, errDiffTooLarge
+	}
+
+	// lcs[i*(m+1)+j] is the LCS length of midA[i:] and midB[j:].
+	lcs := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else {
+				lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case midA[i] == midB[j]:
+			ops = append(ops, diffOp{' ', midA[i]})
+			i++
+			j++
+		case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+			ops = append(ops, diffOp{'-', midA[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', midB[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', midA[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', midB[j]})
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops, nil
+}
+
+// unifiedDiff formats an edit script as a unified diff with
+// diffContextLines of context. It returns "" when nothing changed.
+func unifiedDiff(ops []diffOp, fromLabel, toLabel string) string {
+	var changes []int
+	for k, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, k)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	// lineA[k] and lineB[k] are the 0-based line numbers before ops[k].
+	lineA := make([]int, len(ops)+1)
+	lineB := make([]int, len(ops)+1)
+	for k, op := range ops {
+		lineA[k+1], lineB[k+1] = lineA[k], lineB[k]
+		if op.kind != '+' {
+			lineA[k+1]++
+		}
+		if op.kind != '-' {
+			lineB[k+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromLabel, toLabel)
+
+	for c := 0; c < len(changes); {
+		// Extend the hunk while the next change's context would overlap.
+		last := c
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*diffContextLines+1 {
+			last++
+		}
+		start := max(changes[c]-diffContextLines, 0)
+		end := min(changes[last]+diffContextLines+1, len(ops))
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(lineA[start], lineA[end]-lineA[start]),
+			hunkRange(lineB[start], lineB[end]-lineB[start]))
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.text)
+			out.WriteByte('\n')
+		}
+		c = last + 1
+	}
+	return out.String()
+}
+
+// hunkRange formats one side of a hunk header from a 0-based start line.
+// WHY the special cases: Unified diff omits a count of 1, and an empty range
+// names the line *before* it (so it starts at 0, not 1, at the top).
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
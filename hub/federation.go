@@ -0,0 +1,189 @@
+// Author: Toluwalase Mebaanne
+// Package main provides hub-to-hub federation: channels shared with a
+// friend's hub.
+//
+// WHY federation instead of one shared hub:
+// Sharing clips with another household today means joining their devices to
+// your hub - your tailnet, your auth token, your whole history. A federation
+// link instead connects one channel on each hub (typically over a node
+// shared between the two tailnets). Each hub relays clips pushed to its side
+// of the link to the other, which stores and broadcasts them like its own.
+//
+// WHAT IS RELAYED: Clips pushed to this hub by its own devices, on a linked
+// channel, that this hub stores. Clips relayed in from a peer are never
+// relayed on - that prevents loops, and keeps a friend's clips from reaching
+// people they didn't share them with. Encrypted clips (the peer's agents
+// have other keys), transient clips (secrets), and clips from devices that
+// opted out of history stay home too.
+//
+// Relays are queued in memory and retried for about two minutes. Clips that
+// can't be delivered in that time are dropped with a warning; they remain in
+// this hub's history.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/tmair/tailclip/shared/auth"
+	"github.com/tmair/tailclip/shared/client"
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// federationQueueSize is how many clips wait per link while the peer is
+// slow or down.
+const federationQueueSize = 64
+
+// federationRetries is how many times a relay is retried after a network
+// failure. With the doubling backoff below it covers about two minutes -
+// a peer restart or a short network change.
+const federationRetries = 7
+
+// federationLink is a configured link and its relay queue.
+type federationLink struct {
+	cfg   config.FederationLink
+	peer  *client.Client
+	queue chan *models.Event
+}
+
+// newFederationLinks creates the links of cfg.
+func newFederationLinks(cfg []config.FederationLink) []*federationLink {
+	links := make([]*federationLink, 0, len(cfg))
+	for _, linkCfg := range cfg {
+		links = append(links, &federationLink{
+			cfg:   linkCfg,
+			peer:  client.New(linkCfg.PeerURL, linkCfg.Token),
+			queue: make(chan *models.Event, federationQueueSize),
+		})
+	}
+	return links
+}
+
+// RunFederation relays queued clips to each linked hub until the process
+// exits.
+func (s *Server) RunFederation() {
+	for _, link := range s.federation {
+		federationLog.Infof("Federation: channel %q linked to %s (%s)", link.cfg.Channel, link.cfg.Name, link.cfg.PeerURL)
+		go link.run()
+	}
+}
+
+// run delivers the link's queued clips in order.
+// WHY one goroutine per link: A peer that is down must not hold up the
+// others.
+func (l *federationLink) run() {
+	for event := range l.queue {
+		backoff := time.Second
+		for attempt := 0; ; attempt++ {
+			err := l.peer.Relay(event)
+			if err == nil {
+				federationLog.Infof("Federation: relayed event %s to %s", event.EventID, l.cfg.Name)
+				break
+			}
+			// WHY give up on a status error: The peer answered and refused
+			// (too large, disabled link); sending it again won't change that.
+			var status *client.StatusError
+			if errors.As(err, &status) || attempt == federationRetries {
+				federationLog.Warnf("federation: dropping event %s for %s: %v", event.EventID, l.cfg.Name, err)
+				break
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+// relayToPeers queues event for every link sharing its channel.
+// WHY a copy without delivery fields: Seq, Silent, and the latency times
+// describe this hub's broadcast; the peer sets its own. The note is this
+// household's annotation.
+func (s *Server) relayToPeers(event *models.Event) {
+	if event.OriginHub != "" || event.Encrypted || event.IsTransient() {
+		return
+	}
+	for _, link := range s.federation {
+		if link.cfg.Channel != event.Channel {
+			continue
+		}
+		relayed := models.Event{
+			EventID:        event.EventID,
+			SourceDeviceID: event.SourceDeviceID,
+			Timestamp:      event.Timestamp,
+			ContentType:    event.ContentType,
+			Text:           event.Text,
+			Formats:        event.Formats,
+			FileName:       event.FileName,
+			TextHash:       event.TextHash,
+		}
+		select {
+		case link.queue <- &relayed:
+		default:
+			federationLog.Warnf("federation: queue for %s is full, dropping event %s", link.cfg.Name, event.EventID)
+		}
+	}
+}
+
+// handleFederationRelay accepts a clip relayed by a linked hub and stores
+// and broadcasts it in the link's channel.
+// WHY the link token in X-Auth-Token: The peer sends it with the same
+// client agents use. The token identifies the link, so a peer can only
+// ever reach the channel it is linked to.
+func (s *Server) handleFederationRelay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	link := s.federationLinkFor(r)
+	if link == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	receivedAt := time.Now().UTC()
+	r.Body = http.MaxBytesReader(w, r.Body, maxPushBodyBytes(s.textHandler.MaxLength(), s.fileHandler.MaxSize(), s.sealed.MaxEncodedLength()))
+
+	var event models.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		s.rejectPush(w, &models.RejectedEvent{Size: int(r.ContentLength)}, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if event.Encrypted {
+		s.rejectPush(w, rejectedFrom(&event), http.StatusBadRequest, "encrypted clips can't be relayed")
+		return
+	}
+	s.acceptEvent(w, r, &event, receivedAt, pushOrigin{link: &link.cfg})
+}
+
+// federationLinkFor returns the link whose token r carries, or nil.
+// WHY compare against every link: Stopping at the first match would let
+// response times hint at which links exist.
+func (s *Server) federationLinkFor(r *http.Request) *federationLink {
+	provided := auth.ExtractTokenFromHeader(r)
+	var found *federationLink
+	for _, link := range s.federation {
+		if auth.ValidateToken(link.cfg.Token, provided) {
+			found = link
+		}
+	}
+	return found
+}
+
+// markRelayed rewrites a clip relayed over link for this hub: its channel
+// becomes the link's, and its origin and source device name the peer.
+// WHY suffix the device: The peer's "laptop" is not this household's
+// "laptop" - device preferences, routing rules, and the broadcaster's
+// skip-the-sender check all key off the ID.
+func markRelayed(event *models.Event, link *config.FederationLink) {
+	event.OriginHub = link.Name
+	event.SourceDeviceID += "@" + link.Name
+	event.Channel = link.Channel
+	// WHY drop the signature: It names the device by its ID at the peer,
+	// and its key belongs to the peer's household, not this one.
+	event.Signature = ""
+	event.SigningKey = ""
+}
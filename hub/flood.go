@@ -0,0 +1,142 @@
+// Author: Toluwalase Mebaanne
+// Package main provides flood protection: throttling a device that suddenly
+// pushes far more clips than a person could copy.
+//
+// WHY at the hub:
+// A runaway script or two agents caught in a sync loop push hundreds of clips
+// a minute, and every one overwrites every other clipboard in the household.
+// The misbehaving device can't be trusted to notice; the hub sees every push
+// and can stop the flood for everyone at once.
+//
+// WHY throttle for a while instead of dropping the excess:
+// A flood rarely stops by itself. Refusing the device's pushes for
+// flood_throttle_minutes gives whoever looks after it (alerted through
+// alert_webhook) time to find the cause, instead of letting one clip in
+// per window forever.
+//
+// Like quiet hours, this state lives in memory and resets with the hub.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// floodWindow is the period flood_max_per_minute counts pushes over.
+const floodWindow = time.Minute
+
+// floodGuard tracks recent pushes per device and which devices are
+// throttled.
+type floodGuard struct {
+	mu sync.Mutex
+	// pushes holds each device's push times within the last floodWindow,
+	// oldest first; at most max of them.
+	pushes    map[string][]time.Time
+	throttled map[string]time.Time // device ID -> throttled until
+	max       int
+	throttle  time.Duration
+}
+
+// newFloodGuard creates a guard allowing max pushes per device per
+// floodWindow, or nil if max is 0 (flood protection off).
+func newFloodGuard(max int, throttle time.Duration) *floodGuard {
+	if max <= 0 {
+		return nil
+	}
+	return &floodGuard{
+		pushes:    make(map[string][]time.Time),
+		throttled: make(map[string]time.Time),
+		max:       max,
+		throttle:  throttle,
+	}
+}
+
+// check records a push from deviceID at now. It returns how long the device
+// remains throttled (0 if the push may go ahead) and whether this push is
+// the one that tripped the throttle.
+// WHY keep at most max times per device: Only whether the oldest of the last
+// max pushes is within the window matters, so memory stays bounded however
+// fast a device pushes.
+func (f *floodGuard) check(deviceID string, now time.Time) (time.Duration, bool) {
+	if f == nil {
+		return 0, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if until, ok := f.throttled[deviceID]; ok {
+		if now.Before(until) {
+			return until.Sub(now), false
+		}
+		delete(f.throttled, deviceID)
+		floodLog.Infof("Throttle of device %s lifted", deviceID)
+	}
+
+	times := f.pushes[deviceID]
+	if len(times) == f.max && now.Sub(times[0]) < floodWindow {
+		delete(f.pushes, deviceID)
+		f.throttled[deviceID] = now.Add(f.throttle)
+		return f.throttle, true
+	}
+	if len(times) == f.max {
+		times = times[1:]
+	}
+	f.pushes[deviceID] = append(times, now)
+	return 0, false
+}
+
+// prune forgets devices that haven't pushed within the window and expired
+// throttles.
+// WHY: Devices come and go (guests, renamed machines); their entries
+// shouldn't accumulate for the life of the hub.
+func (f *floodGuard) prune(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for deviceID, times := range f.pushes {
+		if now.Sub(times[len(times)-1]) >= floodWindow {
+			delete(f.pushes, deviceID)
+		}
+	}
+	for deviceID, until := range f.throttled {
+		if !now.Before(until) {
+			delete(f.throttled, deviceID)
+		}
+	}
+}
+
+// RunFloodPruning prunes the flood guard every floodWindow.
+func (s *Server) RunFloodPruning() {
+	if s.flood == nil {
+		return
+	}
+	ticker := time.NewTicker(floodWindow)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.flood.prune(now)
+	}
+}
+
+// floodWait records a push from deviceID and returns how long its pushes
+// are still refused, or 0. When this push starts the throttle, the admin
+// and the device itself are told.
+// WHY tell the device: Its user may not know a script or loop is running;
+// the alert shows up as a notification on that machine.
+func (s *Server) floodWait(deviceID string) time.Duration {
+	wait, tripped := s.flood.check(deviceID, time.Now())
+	if tripped {
+		msg := fmt.Sprintf("Device %s pushed more than %d clips within a minute; refusing its pushes for %s",
+			deviceID, s.cfg.FloodMaxPerMinute, wait)
+		s.alertAdmin(AdminAlert{Kind: "push_flood", Message: msg, DeviceIDs: []string{deviceID}})
+		s.broadcaster.Alert(deviceID, fmt.Sprintf(
+			"This device is pushing clips faster than anyone copies them, so the hub refuses its clips for %s. Check for a script or sync loop writing to the clipboard.", wait))
+	}
+	return wait
+}
+
+// retryAfter formats wait for a Retry-After header, in whole seconds.
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(wait.Round(time.Second).Seconds()))
+}
@@ -0,0 +1,251 @@
+// Author: Toluwalase Mebaanne
+// Package main provides time-limited guest passes for the TailClip hub.
+//
+// WHY guest passes instead of handing out the auth token:
+// A borrowed laptop in a conference room or at a friend's place is useful
+// for an afternoon, but the shared token it would need is forever - it
+// reaches all of history, every device's settings, and has to be rotated on
+// every machine once the laptop is returned. A guest pass is a separate
+// token for one device ID that expires on its own (24 hours by default).
+// When it does, the hub refuses the token, drops the device's registration,
+// and disconnects it; the clips it pushed stay in history, marked as guest
+// clips.
+//
+// WHAT A GUEST MAY DO: push clips as its own device (including chunked
+// uploads), register, read the hub's capabilities, and receive clips over
+// the WebSocket. Everything else - history, notes, device settings, data
+// keys - needs the hub's token.
+//
+// Passes are created, listed, and revoked with `hub guest` on the hub
+// machine. Only a hash of each token is stored (see auth.HashToken).
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/tmair/tailclip/shared/auth"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// guestSweepInterval is how often expired passes are removed and their
+// devices disconnected.
+// WHY a minute: Expired tokens are refused immediately regardless; the
+// sweep only ends connections that were opened before expiry.
+const guestSweepInterval = time.Minute
+
+// defaultGuestHours and maxGuestHours bound how long a pass lasts.
+// WHY a maximum: A pass that lasts for months is a second auth token that
+// nobody remembers to revoke.
+const (
+	defaultGuestHours = 24
+	maxGuestHours     = 30 * 24
+)
+
+// RunGuestExpiry removes expired guest passes and disconnects guest devices
+// whose pass is gone, every guestSweepInterval.
+// WHY check every connected guest, not just the expired passes: A pass
+// revoked with `hub guest revoke` is deleted by another process, which
+// can't reach this one's connections.
+func (s *Server) RunGuestExpiry() {
+	ticker := time.NewTicker(guestSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		expired, err := s.storage.DeleteGuestPasses("", now)
+		if err != nil {
+			authLog.Errorf("guest pass cleanup failed: %v", err)
+			continue
+		}
+		for _, deviceID := range expired {
+			authLog.Infof("Guest pass for device %s expired", deviceID)
+		}
+
+		for _, deviceID := range s.broadcaster.GuestDevices() {
+			pass, err := s.storage.GetGuestPass(deviceID, now)
+			if err != nil || pass != nil {
+				continue
+			}
+			s.broadcaster.Disconnect(deviceID)
+			authLog.Infof("Disconnected guest device %s: its pass expired or was revoked", deviceID)
+		}
+	}
+}
+
+// guestCommands are the `hub guest` subcommands.
+var guestCommands = map[string]hubCommand{
+	"add": {
+		summary: "create a pass for a guest device and print its token",
+		run:     runGuestAdd,
+	},
+	"list": {
+		summary: "list guest passes and when they expire",
+		run:     runGuestList,
+	},
+	"revoke": {
+		summary: "end a guest pass before it expires",
+		run:     runGuestRevoke,
+	},
+}
+
+// runGuest implements `hub guest add|list|revoke`.
+// WHY a command rather than an API endpoint: Same as `hub unbind` - handing
+// out access is the operator's decision, made on the hub machine.
+func runGuest(args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printGuestUsage()
+		return nil
+	}
+	cmd, ok := guestCommands[args[0]]
+	if !ok {
+		printGuestUsage()
+		return fmt.Errorf("unknown guest command %q", args[0])
+	}
+	return cmd.run(args[1:])
+}
+
+// printGuestUsage lists the `hub guest` subcommands.
+func printGuestUsage() {
+	names := slices.Sorted(maps.Keys(guestCommands))
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  hub guest %-31s %s\n", name+" [flags] [config-path]", guestCommands[name].summary)
+	}
+}
+
+// runGuestAdd creates a guest pass and prints its token.
+func runGuestAdd(args []string) error {
+	fs := newCommandFlags("guest add")
+	deviceID := fs.String("device", "", "device ID the guest machine will use (required)")
+	hours := fs.Int("hours", defaultGuestHours, fmt.Sprintf("hours until the pass expires (at most %d)", maxGuestHours))
+	name := fs.String("name", "", "who or what the pass is for, shown by `hub guest list`")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := models.ValidateDeviceID(*deviceID); err != nil {
+		fs.Usage()
+		return fmt.Errorf("-device: %w", err)
+	}
+	if *hours <= 0 || *hours > maxGuestHours {
+		return fmt.Errorf("-hours must be between 1 and %d, got %d", maxGuestHours, *hours)
+	}
+
+	_, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	// WHY refuse a device that registered or pushed without a pass: It
+	// belongs to the household. The guest could push clips in its name, and
+	// expiry would delete its registration.
+	passes, err := storage.ListGuestPasses()
+	if err != nil {
+		return err
+	}
+	isGuest := false
+	for _, pass := range passes {
+		isGuest = isGuest || pass.DeviceID == *deviceID
+	}
+	if !isGuest {
+		device, err := storage.GetDevice(*deviceID)
+		if err != nil {
+			return err
+		}
+		ownClips, err := storage.HasOwnClips(*deviceID)
+		if err != nil {
+			return err
+		}
+		if device != nil || ownClips {
+			return fmt.Errorf("device %s is a regular device; choose another device ID for the guest", *deviceID)
+		}
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	pass := &GuestPass{
+		DeviceID:  *deviceID,
+		Name:      *name,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(*hours) * time.Hour),
+	}
+	if err := storage.InsertGuestPass(pass, auth.HashToken(token)); err != nil {
+		return err
+	}
+
+	if isGuest {
+		fmt.Printf("Replaced the earlier pass for %s; its token no longer works.\n", *deviceID)
+	}
+	fmt.Printf("Guest pass for device %s, valid until %s.\n", *deviceID, pass.ExpiresAt.Local().Format(time.DateTime))
+	fmt.Printf("Put this in the guest machine's agent config (the token is shown only once):\n\n")
+	fmt.Printf("  \"device_id\": %q,\n  \"auth_token\": %q\n", *deviceID, token)
+	return nil
+}
+
+// runGuestList prints every guest pass.
+func runGuestList(args []string) error {
+	fs := newCommandFlags("guest list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	_, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	passes, err := storage.ListGuestPasses()
+	if err != nil {
+		return err
+	}
+	if len(passes) == 0 {
+		fmt.Println("No guest passes.")
+		return nil
+	}
+	now := time.Now()
+	for _, pass := range passes {
+		status := "expires " + pass.ExpiresAt.Local().Format(time.DateTime)
+		if !pass.ExpiresAt.After(now) {
+			status = "expired"
+		}
+		fmt.Printf("%-32s  %-20s  %s\n", pass.DeviceID, status, pass.Name)
+	}
+	return nil
+}
+
+// runGuestRevoke ends a guest pass before it expires.
+func runGuestRevoke(args []string) error {
+	fs := newCommandFlags("guest revoke")
+	deviceID := fs.String("device", "", "device ID whose pass to revoke (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *deviceID == "" {
+		fs.Usage()
+		return fmt.Errorf("-device is required")
+	}
+
+	_, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	revoked, err := storage.DeleteGuestPasses(*deviceID, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(revoked) == 0 {
+		return fmt.Errorf("no guest pass for device %s", *deviceID)
+	}
+	fmt.Printf("Guest pass for %s revoked; a running hub disconnects the device within %s.\n", *deviceID, guestSweepInterval)
+	return nil
+}
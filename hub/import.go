@@ -0,0 +1,338 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the `hub import` maintenance command: loading the
+// history of another clipboard manager into the hub.
+//
+// WHY import instead of starting empty:
+// People switching to TailClip usually have years of clips in the manager
+// they're leaving - snippets they paste every week, a command they copied
+// once and can't remember. Without an import, switching means giving that up
+// or running both. Imported clips land in history as if a device had pushed
+// them: searchable, noteable, and subject to retention like any other.
+//
+// SUPPORTED SOURCES:
+//   - copyq: CopyQ's own export (.cpq) is a Qt binary stream, so the import
+//     reads the JSON list printed by a one-line CopyQ script instead (see the
+//     README): each item's text and notes, newest first.
+//   - ditto: Ditto's database (Ditto.db), which holds its whole history with
+//     timestamps. Groups are skipped; clips without text (images, files) too.
+//   - clipy: Clipy's snippet export (XML). Clipy keeps its history in a Realm
+//     database only Clipy can read; the snippets are what people keep.
+//
+// Imports are idempotent: each clip gets an event ID derived from the source
+// and its ID there (or its text, where the source has no IDs), so importing
+// the same file twice adds nothing.
+
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+	"github.com/tmair/tailclip/shared/handlers"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// importedClip is one clip read from another clipboard manager.
+type importedClip struct {
+	// key identifies the clip within its source; with the source's name it
+	// determines the clip's event ID
+	key string
+	// text is the clip's plain text
+	text string
+	// copied is when the clip was copied; zero if the source doesn't
+	// record it
+	copied time.Time
+	// note becomes the event's note (CopyQ notes, Clipy snippet titles)
+	note string
+}
+
+// importSource reads the clips of one clipboard manager's export.
+type importSource struct {
+	// summary is the one-line description shown in usage output.
+	summary string
+	// read returns the clips of the file at path, newest first.
+	read func(path string) ([]importedClip, error)
+}
+
+// importSources maps -format names to their readers.
+var importSources = map[string]importSource{
+	"clipy": {
+		summary: "snippets exported from Clipy's snippet editor (XML)",
+		read:    readClipySnippets,
+	},
+	"copyq": {
+		summary: "JSON printed by the CopyQ export script in the README",
+		read:    readCopyQItems,
+	},
+	"ditto": {
+		summary: "Ditto's database file (Ditto.db)",
+		read:    readDittoDatabase,
+	},
+}
+
+// importNamespace is the UUID namespace of imported event IDs.
+// WHY a fixed namespace: Event IDs must come out the same on every run for
+// a re-import to be a no-op.
+var importNamespace = uuid.MustParse("6f0b6c52-2f1e-4a43-9a0c-3f7c8e1d5b21")
+
+// runImport implements `hub import -format NAME -file PATH -device ID
+// [-channel NAME] [config-path]`.
+// WHY a designated device: Imported clips need a source, and none of the
+// hub's devices produced them. Naming one (e.g., "copyq-import") keeps them
+// apart in history and stats, and `hub merge-devices` can fold them into a
+// real device later.
+func runImport(args []string) error {
+	fs := newCommandFlags("import")
+	format := fs.String("format", "", "export format: "+strings.Join(slices.Sorted(maps.Keys(importSources)), ", ")+" (required)")
+	path := fs.String("file", "", "export file to import (required)")
+	deviceID := fs.String("device", "", "source device ID to record the clips under (required)")
+	channel := fs.String("channel", models.DefaultChannel, "channel to put the clips in")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	source, ok := importSources[*format]
+	if !ok || *path == "" {
+		fs.Usage()
+		fmt.Fprintf(fs.Output(), "Formats:\n")
+		for _, name := range slices.Sorted(maps.Keys(importSources)) {
+			fmt.Fprintf(fs.Output(), "  %-8s %s\n", name, importSources[name].summary)
+		}
+		return fmt.Errorf("-format and -file are required")
+	}
+	if err := models.ValidateDeviceID(*deviceID); err != nil {
+		fs.Usage()
+		return fmt.Errorf("-device: %w", err)
+	}
+	if err := models.ValidateChannel(*channel); err != nil {
+		return fmt.Errorf("-channel: %w", err)
+	}
+
+	clips, err := source.read(*path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s export %s: %w", *format, *path, err)
+	}
+
+	cfg, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	// WHY the file's modification time for clips without one: It is the
+	// best guess at when they were last in use. Stepping back a second per
+	// clip keeps the source's order in history.
+	base := time.Now().UTC()
+	if info, err := os.Stat(*path); err == nil {
+		base = info.ModTime().UTC()
+	}
+
+	// WHY the push-time text rules: Imported clips are served to agents like
+	// any other; one the hub would have refused shouldn't slip in this way.
+	textHandler := handlers.NewTextHandler(cfg.MaxTextLength)
+
+	imported, present, skipped := 0, 0, 0
+	for i, clip := range clips {
+		event := &models.Event{
+			EventID:        uuid.NewSHA1(importNamespace, []byte(*format+"\x00"+clip.key)).String(),
+			SourceDeviceID: *deviceID,
+			Timestamp:      clip.copied,
+			ContentType:    models.ContentTypeText,
+			Text:           clip.text,
+			Channel:        *channel,
+		}
+		if event.Timestamp.IsZero() {
+			event.Timestamp = base.Add(-time.Duration(i) * time.Second)
+		}
+		event.TextHash = event.ComputeTextHash()
+
+		if err := textHandler.Process(event.Text); err != nil {
+			// WHY no content in the output: Same as `hub revalidate` - the
+			// output may end up in a log or an issue.
+			fmt.Printf("SKIPPED clip %d of %d (%s): %v\n", i+1, len(clips), event.Timestamp.Local().Format(time.DateTime), err)
+			skipped++
+			continue
+		}
+		note, err := normalizeNote(clip.note)
+		if err != nil {
+			// WHY truncate rather than skip: The clip is what matters; a
+			// long CopyQ note is still useful cut short.
+			note = string([]rune(strings.TrimSpace(clip.note))[:maxNoteLength])
+		}
+
+		existing, err := storage.GetEvent(event.EventID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			present++
+			continue
+		}
+		if err := storage.InsertEvent(event); err != nil {
+			return fmt.Errorf("imported %d of %d clips: %w", imported, len(clips), err)
+		}
+		if note != "" {
+			if _, err := storage.SetEventNote(event.EventID, note); err != nil {
+				return err
+			}
+		}
+		imported++
+	}
+
+	fmt.Printf("Imported %d clip(s) from %s as device %s: %d already present, %d skipped\n",
+		imported, *path, *deviceID, present, skipped)
+	return nil
+}
+
+// readCopyQItems reads the JSON array printed by the CopyQ export script:
+// objects with "text" and "notes", newest first. CopyQ items have no IDs,
+// so the text identifies them.
+func readCopyQItems(path string) ([]importedClip, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var items []struct {
+		Text  string `json:"text"`
+		Notes string `json:"notes"`
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	var clips []importedClip
+	for _, item := range items {
+		if item.Text == "" {
+			continue
+		}
+		clips = append(clips, importedClip{key: textKey(item.Text), text: item.Text, note: item.Notes})
+	}
+	return clips, nil
+}
+
+// readDittoDatabase reads the text clips of a Ditto database, newest first.
+// WHY CF_UNICODETEXT over Main.mText: mText is Ditto's description of a
+// clip, which it may shorten; the clipboard data is the clip itself.
+func readDittoDatabase(path string) ([]importedClip, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	// WHY read-only: The file is another program's database - a copy, with
+	// luck, but possibly the live one.
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+	SELECT m.lID, m.lDate, m.mText, d.ooData
+	FROM Main m
+	LEFT JOIN Data d ON d.lParentID = m.lID AND d.strClipBoardFormat = 'CF_UNICODETEXT'
+	WHERE m.bIsGroup = 0
+	ORDER BY m.lDate DESC, m.lID DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query clips (is this a Ditto database?): %w", err)
+	}
+	defer rows.Close()
+
+	var clips []importedClip
+	for rows.Next() {
+		var id, date int64
+		var description sql.NullString
+		var data []byte
+		if err := rows.Scan(&id, &date, &description, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan clip row: %w", err)
+		}
+		text := description.String
+		if len(data) > 0 {
+			text = decodeUTF16LE(data)
+		}
+		if text == "" {
+			continue
+		}
+		clips = append(clips, importedClip{key: fmt.Sprint(id), text: text, copied: time.Unix(date, 0).UTC()})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating clip rows: %w", err)
+	}
+	return clips, nil
+}
+
+// decodeUTF16LE decodes Windows clipboard text, which ends in a NUL.
+func decodeUTF16LE(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := binary.LittleEndian.Uint16(data[i:])
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
+
+// readClipySnippets reads a Clipy snippet export. Each snippet becomes a
+// clip noted with its folder and title.
+func readClipySnippets(path string) ([]importedClip, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var export struct {
+		Folders []struct {
+			Title    string `xml:"title"`
+			Snippets []struct {
+				Title   string `xml:"title"`
+				Content string `xml:"content"`
+			} `xml:"snippets>snippet"`
+		} `xml:"folder"`
+	}
+	if err := xml.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to parse XML: %w", err)
+	}
+
+	var clips []importedClip
+	for _, folder := range export.Folders {
+		for _, snippet := range folder.Snippets {
+			if snippet.Content == "" {
+				continue
+			}
+			clips = append(clips, importedClip{
+				key:  textKey(folder.Title + "\x00" + snippet.Title + "\x00" + snippet.Content),
+				text: snippet.Content,
+				note: snippetNote(folder.Title, snippet.Title),
+			})
+		}
+	}
+	return clips, nil
+}
+
+// snippetNote names a snippet by its folder and title, e.g. "Git / Undo
+// last commit".
+func snippetNote(folder, title string) string {
+	var parts []string
+	for _, part := range []string{folder, title} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " / ")
+}
+
+// textKey identifies a clip by its content, for sources without IDs.
+func textKey(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("%x", sum)
+}
@@ -0,0 +1,409 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the hub's integrity chain over history and the
+// `hub integrity` command that checks it.
+//
+// WHY a chain when the API already controls writes:
+// History is a SQLite file. Anyone who can open it - a backup restored with
+// edits, a shell on the hub machine, a compromised host - can change or
+// delete rows without the hub ever noticing, and agents would serve the
+// result as the household's history. With integrity_key set, every write
+// the hub makes to history appends an entry to integrity_chain in the same
+// transaction: an HMAC over the previous entry's HMAC and a digest of the
+// row as stored. `hub integrity` replays the chain and compares it with the
+// events table.
+//
+// WHAT IS COVERED: each event's content and provenance - ID, source device,
+// time, type, text, hash, channel, file name, formats, encryption, origin,
+// guest flag, signature. Notes and pins are not: they are annotations the
+// API changes freely.
+//
+// WHAT IT CAN'T CATCH: removing the newest entries together with their
+// events looks like history that ended earlier. The hub logs the chain's
+// head at startup and `hub integrity` prints it; compare it with one you
+// noted before to catch that too.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// Integrity chain actions.
+const (
+	chainInsert = "insert"
+	chainUpdate = "update"
+	chainDelete = "delete"
+)
+
+// integrityChain appends entries to integrity_chain.
+// WHY a mutex held for the whole transaction: Each entry's HMAC covers the
+// previous one, so two writers must not both extend the same head.
+type integrityChain struct {
+	mu  sync.Mutex
+	key []byte
+}
+
+// ChainWith turns on the integrity chain with key. Every later write to
+// history is chained.
+func (s *Storage) ChainWith(key []byte) {
+	s.chain = &integrityChain{key: key}
+}
+
+// lock and unlock guard a chained write. A nil chain doesn't lock.
+func (c *integrityChain) lock() {
+	if c != nil {
+		c.mu.Lock()
+	}
+}
+
+func (c *integrityChain) unlock() {
+	if c != nil {
+		c.mu.Unlock()
+	}
+}
+
+// record appends an entry with action for each of eventIDs, reading each
+// event's row back from tx for its digest. A nil chain records nothing.
+// WHY read the row back: The digest then covers exactly what was stored,
+// as `hub integrity` will read it.
+func (c *integrityChain) record(tx *sql.Tx, action string, eventIDs []string) error {
+	if c == nil || len(eventIDs) == 0 {
+		return nil
+	}
+	seq, mac, err := chainHead(tx)
+	if err != nil {
+		return err
+	}
+	for _, eventID := range eventIDs {
+		digest := ""
+		if action != chainDelete {
+			event, err := scanEvent(tx.QueryRow(`SELECT `+eventColumns+` FROM events WHERE event_id = ?`, eventID))
+			if err != nil {
+				return fmt.Errorf("failed to read event %s for the integrity chain: %w", eventID, err)
+			}
+			digest = eventDigest(&event)
+		}
+		seq++
+		mac = chainMAC(c.key, mac, seq, action, eventID, digest)
+		if _, err := tx.Exec(`INSERT INTO integrity_chain (seq, action, event_id, digest, mac) VALUES (?, ?, ?, ?, ?)`,
+			seq, action, eventID, digest, mac); err != nil {
+			return fmt.Errorf("failed to extend the integrity chain: %w", err)
+		}
+	}
+	return nil
+}
+
+// chainedIDs returns the IDs of the events matching where, for recording
+// them before they are changed or deleted. A nil chain needs none.
+func (c *integrityChain) chainedIDs(tx *sql.Tx, where string, args ...any) ([]string, error) {
+	if c == nil {
+		return nil, nil
+	}
+	rows, err := tx.Query(`SELECT event_id FROM events WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events for the integrity chain: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// chainHead returns the last entry's sequence number and HMAC, or 0 and ""
+// for an empty chain.
+func chainHead(q interface {
+	QueryRow(string, ...any) *sql.Row
+}) (int64, string, error) {
+	var seq int64
+	var mac string
+	err := q.QueryRow(`SELECT seq, mac FROM integrity_chain ORDER BY seq DESC LIMIT 1`).Scan(&seq, &mac)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read the integrity chain: %w", err)
+	}
+	return seq, mac, nil
+}
+
+// chainMAC computes an entry's HMAC from the previous entry's.
+func chainMAC(key []byte, prev string, seq int64, action, eventID, digest string) string {
+	h := hmac.New(sha256.New, key)
+	for _, field := range []string{prev, strconv.FormatInt(seq, 10), action, eventID, digest} {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(field))))
+		h.Write([]byte(field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// eventDigest hashes the covered fields of a stored event.
+func eventDigest(event *models.Event) string {
+	formats, _ := encodeFormats(event.Formats)
+	h := sha256.New()
+	for _, field := range []string{
+		event.EventID,
+		event.SourceDeviceID,
+		event.Timestamp.UTC().Format("2006-01-02T15:04:05Z07:00"),
+		event.ContentType,
+		event.Text,
+		event.TextHash,
+		event.Channel,
+		event.FileName,
+		formats,
+		strconv.FormatBool(event.Encrypted),
+		event.KeyID,
+		event.OriginHub,
+		strconv.FormatBool(event.Guest),
+		event.Signature,
+		event.SigningKey,
+	} {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(field))))
+		h.Write([]byte(field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// IntegrityReport is the result of checking history against the chain.
+type IntegrityReport struct {
+	// Entries is the length of the chain, Events the rows in history.
+	Entries int64 `json:"entries"`
+	Events  int   `json:"events"`
+
+	// HeadSeq and Head identify the chain's last entry; note them to catch
+	// the newest entries being cut off later.
+	HeadSeq int64  `json:"head_seq"`
+	Head    string `json:"head"`
+
+	// BrokenAt is the first entry whose HMAC doesn't match, or 0. After it
+	// the chain can't be trusted, so the lists below may be incomplete.
+	BrokenAt int64 `json:"broken_at,omitempty"`
+
+	// Modified, Deleted, and Added list events changed, removed, or put in
+	// history outside the hub.
+	Modified []string `json:"modified"`
+	Deleted  []string `json:"deleted"`
+	Added    []string `json:"added"`
+}
+
+// OK reports whether nothing was found.
+func (r *IntegrityReport) OK() bool {
+	return r.BrokenAt == 0 && len(r.Modified)+len(r.Deleted)+len(r.Added) == 0
+}
+
+// VerifyIntegrity replays the chain with key and compares the result with
+// the events table.
+func (s *Storage) VerifyIntegrity(key []byte) (*IntegrityReport, error) {
+	report := &IntegrityReport{Modified: []string{}, Deleted: []string{}, Added: []string{}}
+	// WHY one read transaction: A write in between would show up as a
+	// mismatch that isn't one.
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin integrity check: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT seq, action, event_id, digest, mac FROM integrity_chain ORDER BY seq`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the integrity chain: %w", err)
+	}
+	expected := map[string]string{}
+	prev := ""
+	for rows.Next() {
+		var seq int64
+		var action, eventID, digest, mac string
+		if err := rows.Scan(&seq, &action, &eventID, &digest, &mac); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read the integrity chain: %w", err)
+		}
+		report.Entries++
+		// WHY check the sequence too: A removed entry in the middle shows
+		// as a gap even before its successor's HMAC fails.
+		if report.BrokenAt == 0 && (seq != report.HeadSeq+1 || !hmac.Equal([]byte(mac), []byte(chainMAC(key, prev, seq, action, eventID, digest)))) {
+			report.BrokenAt = seq
+		}
+		report.HeadSeq, report.Head, prev = seq, mac, mac
+		if action == chainDelete {
+			delete(expected, eventID)
+		} else {
+			expected[eventID] = digest
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the integrity chain: %w", err)
+	}
+
+	events, err := tx.Query(`SELECT ` + eventColumns + ` FROM events ORDER BY timestamp, event_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	defer events.Close()
+	for events.Next() {
+		event, err := scanEvent(events)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan event row: %w", err)
+		}
+		report.Events++
+		digest, chained := expected[event.EventID]
+		switch {
+		case !chained:
+			report.Added = append(report.Added, event.EventID)
+		case digest != eventDigest(&event):
+			report.Modified = append(report.Modified, event.EventID)
+		}
+		delete(expected, event.EventID)
+	}
+	if err := events.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating event rows: %w", err)
+	}
+	for eventID := range expected {
+		report.Deleted = append(report.Deleted, eventID)
+	}
+	return report, nil
+}
+
+// RebaseIntegrity replaces the chain with one entry per event in history as
+// it is now, and returns the number of entries.
+// WHY: Turning the chain on for existing history, accepting changes after
+// investigating them, and shrinking a chain that has grown with every
+// clip ever deleted.
+func (s *Storage) RebaseIntegrity(key []byte) (int, error) {
+	chain := s.chain
+	if chain == nil {
+		chain = &integrityChain{key: key}
+	}
+	chain.lock()
+	defer chain.unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin rebase: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM integrity_chain`); err != nil {
+		return 0, fmt.Errorf("failed to clear the integrity chain: %w", err)
+	}
+	ids, err := chain.chainedIDs(tx, `1 ORDER BY timestamp, event_id`)
+	if err != nil {
+		return 0, err
+	}
+	if err := chain.record(tx, chainInsert, ids); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit rebase: %w", err)
+	}
+	return len(ids), nil
+}
+
+// IntegrityHead returns the chain's last sequence number and HMAC.
+func (s *Storage) IntegrityHead() (int64, string, error) {
+	return chainHead(s.db)
+}
+
+// runIntegrity implements `hub integrity [-genkey] [-rebase] [config-path]`.
+// WHY exit with cli.ExitTampered on findings: Scripts and cron jobs can alert
+// on the exit code without parsing the output.
+func runIntegrity(args []string) error {
+	fs := newCommandFlags("integrity")
+	genkey := fs.Bool("genkey", false, "print a new integrity_key and exit")
+	rebase := fs.Bool("rebase", false, "accept history as it is now and restart the chain from it")
+	addJSONFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *genkey {
+		return printNewKey()
+	}
+
+	cfg, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+	key := cfg.GetIntegrityKey()
+	if key == nil {
+		return fmt.Errorf("integrity_key is not set (generate one with `hub integrity -genkey`)")
+	}
+
+	if *rebase {
+		entries, err := storage.RebaseIntegrity(key)
+		if err != nil {
+			return err
+		}
+		seq, head, err := storage.IntegrityHead()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Restarted the integrity chain from %d event(s); head is now %d:%s\n", entries, seq, shortMAC(head))
+		return nil
+	}
+
+	report, err := storage.VerifyIntegrity(key)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		if err := cli.PrintJSON(report); err != nil {
+			return err
+		}
+	} else {
+		printIntegrityReport(report)
+	}
+	if !report.OK() {
+		return cli.Exit(cli.ExitTampered, nil)
+	}
+	return nil
+}
+
+// printIntegrityReport prints report for people.
+func printIntegrityReport(report *IntegrityReport) {
+	fmt.Printf("Checked %d event(s) against %d chain entries; head is %d:%s\n",
+		report.Events, report.Entries, report.HeadSeq, shortMAC(report.Head))
+	if report.BrokenAt != 0 {
+		fmt.Printf("The chain itself was altered at entry %d; what follows may be incomplete.\n", report.BrokenAt)
+	}
+	for _, group := range []struct {
+		label string
+		ids   []string
+	}{
+		{"MODIFIED outside the hub", report.Modified},
+		{"DELETED outside the hub", report.Deleted},
+		{"ADDED outside the hub (or while integrity_key was unset)", report.Added},
+	} {
+		for _, id := range group.ids {
+			fmt.Printf("%s: %s\n", group.label, id)
+		}
+	}
+	if report.OK() {
+		fmt.Println("OK: history matches the chain.")
+		return
+	}
+	fmt.Println("After investigating, `hub integrity -rebase` accepts history as it is now.")
+}
+
+// shortMAC shortens an HMAC for display.
+func shortMAC(mac string) string {
+	if len(mac) > 16 {
+		return mac[:16]
+	}
+	return mac
+}
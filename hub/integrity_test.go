@@ -0,0 +1,177 @@
+// Author: Toluwalase Mebaanne
+// Tests for the integrity chain: the hub's own writes keep it intact, and
+// writes to the database behind the hub's back are reported.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testIntegrityKey = bytes.Repeat([]byte{0x42}, 32)
+
+// newChainedStorage returns a database with the integrity chain on and
+// events e1 to e5 from device laptop, one minute apart.
+func newChainedStorage(t *testing.T) *Storage {
+	t.Helper()
+	s := newTestStorage(t)
+	s.ChainWith(testIntegrityKey)
+	insertTestDevice(t, s, "laptop")
+	for i := 1; i <= 5; i++ {
+		event := testEvent(fmt.Sprintf("e%d", i), "laptop")
+		event.Timestamp = event.Timestamp.Add(time.Duration(i) * time.Minute)
+		insertTestEvents(t, s, event)
+	}
+	return s
+}
+
+func verify(t *testing.T, s *Storage) *IntegrityReport {
+	t.Helper()
+	report, err := s.VerifyIntegrity(testIntegrityKey)
+	if err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+	return report
+}
+
+func execSQL(t *testing.T, s *Storage, query string, args ...any) {
+	t.Helper()
+	if _, err := s.db.Exec(query, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestIntegrityHubWrites checks that every way the hub changes history is
+// chained.
+func TestIntegrityHubWrites(t *testing.T) {
+	tests := []struct {
+		name   string
+		write  func(t *testing.T, s *Storage)
+		events int
+	}{
+		{"insert", func(t *testing.T, s *Storage) {
+			insertTestEvents(t, s, testEvent("e6", "laptop"))
+		}, 6},
+		{"insert of a retried event", func(t *testing.T, s *Storage) {
+			insertTestEvents(t, s, testEvent("e1", "laptop"))
+		}, 5},
+		{"prune", func(t *testing.T, s *Storage) {
+			if _, err := s.ApplyRetention(RetentionPolicy{HistoryLimit: 2}, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}, 2},
+		{"merge", func(t *testing.T, s *Storage) {
+			insertTestDevice(t, s, "desktop")
+			if _, err := s.MergeDevices("laptop", "desktop"); err != nil {
+				t.Fatal(err)
+			}
+		}, 5},
+		{"delete", func(t *testing.T, s *Storage) {
+			if deleted, err := s.DeleteEvent("e3"); err != nil || !deleted {
+				t.Fatalf("DeleteEvent = %v, %v", deleted, err)
+			}
+		}, 4},
+		{"note and pin, which aren't covered", func(t *testing.T, s *Storage) {
+			if _, err := s.SetEventNote("e2", "rotate Friday"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.SetEventPinned("e2", true); err != nil {
+				t.Fatal(err)
+			}
+		}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newChainedStorage(t)
+			tt.write(t, s)
+			report := verify(t, s)
+			if !report.OK() || report.Events != tt.events {
+				t.Errorf("VerifyIntegrity = %+v, want OK with %d events", report, tt.events)
+			}
+			seq, head, err := s.IntegrityHead()
+			if err != nil || seq != report.HeadSeq || head != report.Head {
+				t.Errorf("IntegrityHead = %d, %s, %v, want the report's head %d, %s", seq, head, err, report.HeadSeq, report.Head)
+			}
+		})
+	}
+}
+
+// TestIntegrityOutsideWrites checks what writes to the database behind the
+// hub's back are reported as.
+func TestIntegrityOutsideWrites(t *testing.T) {
+	tests := []struct {
+		name     string
+		write    string
+		modified []string
+		deleted  []string
+		added    []string
+		broken   int64
+	}{
+		{name: "text changed", write: `UPDATE events SET text = 'changed' WHERE event_id = 'e2'`, modified: []string{"e2"}},
+		{name: "source changed", write: `UPDATE events SET source_device_id = 'desktop' WHERE event_id = 'e4'`, modified: []string{"e4"}},
+		{name: "row deleted", write: `DELETE FROM events WHERE event_id = 'e3'`, deleted: []string{"e3"}},
+		{name: "row added", write: `INSERT INTO events (event_id, source_device_id, timestamp, content_type, text, text_hash)
+			VALUES ('forged', 'laptop', '2026-03-14T10:00:00Z', 'text', 'forged', 'x')`, added: []string{"forged"}},
+		{name: "middle chain entry deleted", write: `DELETE FROM integrity_chain WHERE seq = 3`, broken: 4, added: []string{"e3"}},
+		{name: "chain entry altered", write: `UPDATE integrity_chain SET digest = 'x' WHERE seq = 2`, broken: 2, modified: []string{"e2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newChainedStorage(t)
+			execSQL(t, s, tt.write)
+			report := verify(t, s)
+			if report.OK() {
+				t.Fatalf("VerifyIntegrity = %+v, want a finding", report)
+			}
+			if report.BrokenAt != tt.broken {
+				t.Errorf("BrokenAt = %d, want %d", report.BrokenAt, tt.broken)
+			}
+			for _, list := range []struct {
+				name      string
+				got, want []string
+			}{
+				{"Modified", report.Modified, tt.modified},
+				{"Deleted", report.Deleted, tt.deleted},
+				{"Added", report.Added, tt.added},
+			} {
+				if list.want == nil {
+					list.want = []string{}
+				}
+				if !reflect.DeepEqual(list.got, list.want) {
+					t.Errorf("%s = %v, want %v", list.name, list.got, list.want)
+				}
+			}
+		})
+	}
+}
+
+// TestIntegrityWrongKey checks that a chain made with another key doesn't
+// verify from its first entry.
+func TestIntegrityWrongKey(t *testing.T) {
+	s := newChainedStorage(t)
+	report, err := s.VerifyIntegrity(bytes.Repeat([]byte{0x43}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.BrokenAt != 1 {
+		t.Errorf("BrokenAt with another key = %d, want 1", report.BrokenAt)
+	}
+}
+
+// TestIntegrityRebase checks that a rebase accepts history as it is.
+func TestIntegrityRebase(t *testing.T) {
+	s := newChainedStorage(t)
+	execSQL(t, s, `UPDATE events SET text = 'changed' WHERE event_id = 'e2'`)
+	execSQL(t, s, `DELETE FROM integrity_chain WHERE seq = 3`)
+	entries, err := s.RebaseIntegrity(testIntegrityKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := verify(t, s); entries != 5 || !report.OK() || report.Entries != 5 {
+		t.Errorf("after RebaseIntegrity (%d entries), VerifyIntegrity = %+v, want OK with 5 entries", entries, report)
+	}
+}
@@ -0,0 +1,156 @@
+// Author: Toluwalase Mebaanne
+// Package main provides sync loop detection: noticing the same clip bouncing
+// back and forth between two devices and breaking the loop.
+//
+// WHY loops happen at all:
+// Agents skip clips they received themselves, but only while they recognize
+// them. A clipboard manager that re-copies what it sees, or an agent that
+// normalizes text on write, turns each delivery into a "new" copy, which is
+// pushed back, delivered, and copied again - every second, forever.
+//
+// WHY at the hub:
+// Neither device can tell its own loop from a person copying the same thing
+// twice. The hub sees both sides: the same text_hash arriving from device A,
+// then B, then A again within seconds is no person.
+//
+// WHY suppress the clip instead of throttling the devices:
+// Both devices are otherwise fine; only this one clip is stuck. Everything
+// else they copy keeps syncing while the clip cools down. flood.go catches
+// loops the hash can't (e.g., a counter appended on each round).
+//
+// WHY only from the two devices:
+// Someone on a third device copying the same text during the cooldown is
+// no part of the loop, and their copy syncs as usual.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// loopWindow is how far back pushes of a clip count toward a loop.
+const loopWindow = 10 * time.Second
+
+// loopBounces is how many alternating pushes between two devices, within
+// loopWindow, make a loop.
+// WHY 4: A-B-A-B is two full round trips. A person copying the same text on
+// two machines in turn, that quickly, is implausible.
+const loopBounces = 4
+
+// loopPush is one push of a clip.
+type loopPush struct {
+	deviceID string
+	at       time.Time
+}
+
+// loopDetector tracks recent pushes per text hash and the clips whose
+// pushes from the looping devices are suppressed.
+type loopDetector struct {
+	mu         sync.Mutex
+	recent     map[string][]loopPush // text hash -> pushes within loopWindow, oldest first
+	suppressed map[string]time.Time  // loopKey -> suppressed until
+	cooldown   time.Duration
+}
+
+// loopKey identifies a clip pushed by one device.
+func loopKey(textHash, deviceID string) string {
+	return textHash + "\x00" + deviceID
+}
+
+// newLoopDetector creates a detector suppressing looping clips for
+// cooldown, or nil if cooldown is 0 (detection off).
+func newLoopDetector(cooldown time.Duration) *loopDetector {
+	if cooldown <= 0 {
+		return nil
+	}
+	return &loopDetector{
+		recent:     make(map[string][]loopPush),
+		suppressed: make(map[string]time.Time),
+		cooldown:   cooldown,
+	}
+}
+
+// observe records a push of textHash from deviceID at now. It reports
+// whether the push is suppressed and, if this push revealed the loop, the
+// two devices bouncing it; from then on, only their pushes of the clip are.
+// WHY prune everything on each call: Only the last loopWindow of pushes is
+// kept, so the maps stay small, and no background goroutine is needed.
+func (l *loopDetector) observe(textHash, deviceID string, now time.Time) (bool, []string) {
+	if l == nil || textHash == "" {
+		return false, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, until := range l.suppressed {
+		if !now.Before(until) {
+			delete(l.suppressed, key)
+		}
+	}
+	for hash, pushes := range l.recent {
+		if now.Sub(pushes[len(pushes)-1].at) >= loopWindow {
+			delete(l.recent, hash)
+		}
+	}
+
+	if _, ok := l.suppressed[loopKey(textHash, deviceID)]; ok {
+		return true, nil
+	}
+
+	pushes := l.recent[textHash]
+	for len(pushes) > 0 && now.Sub(pushes[0].at) >= loopWindow {
+		pushes = pushes[1:]
+	}
+	pushes = append(pushes, loopPush{deviceID: deviceID, at: now})
+	if len(pushes) > loopBounces {
+		pushes = pushes[len(pushes)-loopBounces:]
+	}
+	l.recent[textHash] = pushes
+
+	devices := bouncingDevices(pushes)
+	if devices == nil {
+		return false, nil
+	}
+	delete(l.recent, textHash)
+	for _, device := range devices {
+		l.suppressed[loopKey(textHash, device)] = now.Add(l.cooldown)
+	}
+	return true, devices
+}
+
+// bouncingDevices returns the two devices if pushes are loopBounces pushes
+// alternating between exactly two devices, or nil.
+func bouncingDevices(pushes []loopPush) []string {
+	if len(pushes) < loopBounces {
+		return nil
+	}
+	a, b := pushes[0].deviceID, pushes[1].deviceID
+	if a == b {
+		return nil
+	}
+	for i, push := range pushes {
+		want := a
+		if i%2 == 1 {
+			want = b
+		}
+		if push.deviceID != want {
+			return nil
+		}
+	}
+	return []string{a, b}
+}
+
+// syncLoopSuppressed records a push of the event's clip and reports whether
+// it must not be stored or broadcast because the clip is looping. The push
+// that reveals a loop raises an admin alert naming the devices.
+func (s *Server) syncLoopSuppressed(textHash, deviceID string) bool {
+	suppressed, devices := s.loops.observe(textHash, deviceID, time.Now())
+	if devices != nil {
+		msg := fmt.Sprintf("Sync loop: devices %s and %s pushed the same clip (text_hash %.12s) back and forth %d times within %s; ignoring their pushes of it for %s",
+			devices[0], devices[1], textHash, loopBounces, loopWindow, s.loops.cooldown)
+		s.alertAdmin(AdminAlert{Kind: "sync_loop", Message: msg, DeviceIDs: devices})
+	}
+	return suppressed
+}
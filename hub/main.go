@@ -11,11 +11,13 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"net"
 	"os"
+	"strings"
 
+	"github.com/tmair/tailclip/shared/cli"
 	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/logging"
 )
 
 // defaultConfigPath is the file path checked when no explicit path is given.
@@ -23,7 +25,37 @@ import (
 // place if the project's layout conventions evolve.
 const defaultConfigPath = "hub-config.json"
 
+// Component loggers (see shared/logging).
+// WHY one per area rather than per file: Operators filter by what went
+// wrong ("broadcast", "auth"), not by where the code happens to live.
+var (
+	hubLog        = logging.For("hub")
+	serverLog     = logging.For("server")
+	authLog       = logging.For("auth")
+	broadcastLog  = logging.For("broadcast")
+	federationLog = logging.For("federation")
+	quietLog      = logging.For("quiet")
+	storageLog    = logging.For("storage")
+	retentionLog  = logging.For("retention")
+	floodLog      = logging.For("flood")
+	alertLog      = logging.For("alert")
+)
+
 func main() {
+	// --- Step 0: Maintenance subcommands ----------------------------------------
+	// WHY before config loading: Subcommands take their own flags and config
+	// path (see commands.go). Only fall through to server startup when the
+	// first argument isn't a known command.
+	if handled, err := runHubCommand(os.Args[1:]); handled {
+		if err != nil {
+			if !cli.Silent(err) {
+				hubLog.Errorf("%v", err)
+			}
+			os.Exit(cli.ExitCode(err))
+		}
+		return
+	}
+
 	// --- Step 1: Load configuration -------------------------------------------
 	// WHY load config first: Every other component depends on configuration
 	// values (database path, auth token, listen address). If the config is
@@ -39,46 +71,114 @@ func main() {
 
 	cfg, err := config.LoadHubConfig(configPath)
 	if err != nil {
-		log.Fatalf("FATAL: failed to load hub config from %s: %v", configPath, err)
+		hubLog.Fatalf("failed to load hub config from %s: %v", configPath, err)
 	}
-	log.Printf("Hub config loaded from %s", configPath)
+	// WHY right after loading: log_level and log_format come from the
+	// config, and everything from here on should honor them.
+	logging.Setup(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	hubLog.Infof("Hub config loaded from %s", configPath)
 
 	// --- Step 2: Initialize storage -------------------------------------------
 	// WHY storage before server: The server's request handlers need a working
 	// database to insert events and query history. Initializing storage first
 	// guarantees the schema exists and the database file is writable before
 	// we start accepting HTTP traffic.
-	storage, err := NewStorage(cfg.SQLitePath)
+	// WHY openHubStorage: It also checks integrity and, unless disabled,
+	// recovers from a corrupted file (see recovery.go).
+	storage, err := openHubStorage(cfg)
 	if err != nil {
-		log.Fatalf("FATAL: failed to initialize storage at %s: %v", cfg.SQLitePath, err)
+		hubLog.Fatalf("failed to initialize storage at %s: %v", cfg.SQLitePath, err)
 	}
 	// WHY defer Close: Ensures the SQLite WAL is checkpointed and all data is
 	// flushed to disk even if the hub exits unexpectedly (e.g., SIGTERM).
 	// Without this, the last few writes could be lost.
 	defer storage.Close()
-	log.Printf("Storage initialized at %s", cfg.SQLitePath)
+	hubLog.Infof("Storage initialized at %s", cfg.SQLitePath)
+
+	// WHY log the head: Cutting off the newest entries together with their
+	// events can't be told from history that ended there (see integrity.go);
+	// a head recorded in the logs elsewhere can.
+	if key := cfg.GetIntegrityKey(); key != nil {
+		storage.ChainWith(key)
+		seq, head, err := storage.IntegrityHead()
+		if err != nil {
+			hubLog.Fatalf("failed to read the integrity chain: %v", err)
+		}
+		if seq == 0 {
+			hubLog.Warnf("Integrity chain is empty; if history is not, run `hub integrity -rebase` to cover it")
+		}
+		hubLog.Infof("Integrity chain head is %d:%s", seq, shortMAC(head))
+	}
+
+	// WHY a background goroutine: Backups are what corruption recovery
+	// restores; they must keep happening for as long as the hub runs.
+	go RunBackups(storage, cfg)
 
 	// --- Step 3: Create broadcaster -------------------------------------------
 	// WHY create broadcaster before server: The server will need a reference
 	// to the broadcaster so it can push new clipboard events to connected
 	// WebSocket clients immediately after storing them.
-	broadcaster := NewBroadcaster()
-	log.Printf("Broadcaster initialized")
+	broadcaster := NewBroadcaster(cfg)
+	hubLog.Infof("Broadcaster initialized")
 
 	// --- Step 4: Create and start server --------------------------------------
-	// WHY pass both storage and auth token: Dependency injection keeps the
-	// server testable. In tests you can supply a mock storage and a known
-	// token without touching config files or environment variables.
-	server := NewServer(storage, broadcaster, cfg.AuthToken)
+	// WHY pass storage and config: Dependency injection keeps the server
+	// testable. In tests you can supply a mock storage and a hand-built
+	// config without touching config files or environment variables.
+	server := NewServer(storage, broadcaster, cfg)
+
+	// WHY a background goroutine: Held-back clips must go out when quiet
+	// hours end, whether or not any request arrives. No-op when disabled.
+	go server.RunQuietHours()
+
+	// WHY a background goroutine: retention_days and history_limit must hold
+	// whether or not anyone runs `hub retention`. No-op when disabled.
+	go server.RunRetention()
+
+	// WHY a background goroutine: Deleted events' files must leave the
+	// bucket too, however they were deleted. No-op without blobs.
+	go server.RunBlobSweep()
+
+	// WHY a background goroutine: Guest devices must be disconnected when
+	// their pass runs out, not when they next make a request.
+	go server.RunGuestExpiry()
+
+	// WHY a background goroutine: Devices that stop pushing would otherwise
+	// keep their flood-protection entries forever. No-op when disabled.
+	go server.RunFloodPruning()
+	server.RunFederation()
+
+	// WHY its own branch: An embedded Tailscale node replaces listen_ip
+	// entirely, and identity lookups go through it - the host may not run
+	// Tailscale at all (see tsnet.go).
+	if cfg.TailscaleHostname != "" {
+		ln, whois, err := listenTailnet(cfg)
+		if err != nil {
+			hubLog.Fatalf("%v", err)
+		}
+		server.useWhois(whois)
+		if err := server.Serve([]net.Listener{ln}); err != nil {
+			hubLog.Fatalf("hub server failed: %v", err)
+		}
+		return
+	}
+
+	// WHY before listening: Without a certificate there is nothing agents
+	// configured for https:// could connect to, so it stops startup.
+	if cfg.TailscaleCert {
+		if err := server.useTailnetCertificate(cfg); err != nil {
+			hubLog.Fatalf("%v", err)
+		}
+	}
 
-	addr := fmt.Sprintf("%s:%d", cfg.ListenIP, cfg.ListenPort)
-	log.Printf("Starting TailClip hub on %s", addr)
+	addrs := cfg.ListenAddrs()
+	hubLog.Infof("Starting TailClip hub on %s", strings.Join(addrs, ", "))
 
 	// ListenAndServe blocks until the server encounters a fatal error.
-	// WHY log.Fatalf on error: If the listener fails (e.g., port in use,
+	// WHY hubLog.Fatalf on error: If the listener fails (e.g., port in use,
 	// permission denied), there's nothing to recover - exit immediately
 	// with a clear message so operators can diagnose the issue.
-	if err := server.ListenAndServe(addr); err != nil {
-		log.Fatalf("FATAL: hub server failed: %v", err)
+	if err := server.ListenAndServe(addrs); err != nil {
+		hubLog.Fatalf("hub server failed: %v", err)
 	}
 }
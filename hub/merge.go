@@ -0,0 +1,49 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the `hub merge-devices` maintenance command.
+//
+// WHY a command as well as the API endpoint:
+// Merging is cleanup an operator usually does while looking at the database
+// on the hub itself, and it must work while the hub service is stopped.
+//
+// WHY end-to-end encrypted and signed clips stay behind: Sealing and signing
+// both bind the ID of the device that sent the clip, so reassigning those
+// clips would make them unreadable or refused on every agent. They keep the
+// old device ID, which still shows who sent them, and are reported as kept.
+
+package main
+
+import (
+	"fmt"
+)
+
+// runMergeDevices implements `hub merge-devices -from <id> -to <id> [config-path]`.
+func runMergeDevices(args []string) error {
+	fs := newCommandFlags("merge-devices")
+	from := fs.String("from", "", "duplicate device ID to merge and delete (required)")
+	to := fs.String("to", "", "device ID to keep (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		fs.Usage()
+		return fmt.Errorf("-from and -to are required")
+	}
+
+	_, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	result, err := storage.MergeDevices(*from, *to)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Merged %s into %s: %d event(s), %d rejected event(s), %d conflict record(s) reassigned\n",
+		*from, *to, result.Events, result.Rejected, result.Conflicts)
+	if result.Kept > 0 {
+		fmt.Printf("Kept %d end-to-end encrypted or signed event(s) under %s; they can't change device\n",
+			result.Kept, *from)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the hub's Prometheus metrics endpoint.
+//
+// WHY Prometheus text format next to /api/v1/stats:
+// /api/v1/stats answers "how is sync doing right now" for a person. Operators
+// who already run Prometheus or Grafana want counters they can graph and
+// alert on over weeks, scraped like every other service they run.
+//
+// WHY written by hand instead of the Prometheus client library:
+// The hub exposes a handful of counters and one histogram. The text format
+// is a few lines of Printf; the library would pull a large dependency tree
+// into a single-binary hub for it.
+//
+// Like stats.go, everything here lives in memory and resets with the
+// process, which Prometheus handles (counter resets are expected).
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmair/tailclip/shared/auth"
+)
+
+// dbLatencyBuckets are the upper bounds, in seconds, of the database
+// latency histogram.
+// WHY these: SQLite on a local disk answers most queries in well under a
+// millisecond; the upper buckets catch a slow disk or a long VACUUM.
+var dbLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// histogram counts observations per bucket.
+type histogram struct {
+	counts []uint64 // per bucket of dbLatencyBuckets, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Metrics counts what the hub does for the /metrics endpoint.
+// A nil *Metrics is valid and counts nothing, so storage opened by hub
+// subcommands needs no metrics.
+type Metrics struct {
+	mu             sync.Mutex
+	eventsPushed   map[string]uint64 // by content type
+	broadcastsSent uint64
+	authFailures   uint64
+	dbLatency      map[string]*histogram // by operation
+}
+
+// NewMetrics creates an empty set of metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		eventsPushed: make(map[string]uint64),
+		dbLatency:    make(map[string]*histogram),
+	}
+}
+
+// eventPushed counts an accepted push.
+func (m *Metrics) eventPushed(contentType string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.eventsPushed[contentType]++
+}
+
+// broadcastsDelivered counts events written to WebSocket clients.
+func (m *Metrics) broadcastsDelivered(n int) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.broadcastsSent += uint64(n)
+}
+
+// authFailed counts a request refused for a missing or wrong token.
+func (m *Metrics) authFailed() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.authFailures++
+}
+
+// observeDB records how long the database operation op took since start.
+// Use as `defer s.metrics.observeDB("op", time.Now())`.
+func (m *Metrics) observeDB(op string, start time.Time) {
+	if m == nil {
+		return
+	}
+	seconds := time.Since(start).Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.dbLatency[op]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(dbLatencyBuckets))}
+		m.dbLatency[op] = h
+	}
+	for i, bound := range dbLatencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// write renders the metrics in the Prometheus text exposition format.
+// clipClasses are the clip class counts, nil when clip_class_stats is off.
+func (m *Metrics) write(w io.Writer, wsClients int, clipClasses map[string]map[string]int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP tailclip_events_pushed_total Clipboard events accepted by the hub.")
+	fmt.Fprintln(w, "# TYPE tailclip_events_pushed_total counter")
+	for _, contentType := range sortedKeys(m.eventsPushed) {
+		fmt.Fprintf(w, "tailclip_events_pushed_total{content_type=%q} %d\n", contentType, m.eventsPushed[contentType])
+	}
+
+	fmt.Fprintln(w, "# HELP tailclip_broadcasts_sent_total Events written to WebSocket clients.")
+	fmt.Fprintln(w, "# TYPE tailclip_broadcasts_sent_total counter")
+	fmt.Fprintf(w, "tailclip_broadcasts_sent_total %d\n", m.broadcastsSent)
+
+	fmt.Fprintln(w, "# HELP tailclip_websocket_clients Connected WebSocket clients.")
+	fmt.Fprintln(w, "# TYPE tailclip_websocket_clients gauge")
+	fmt.Fprintf(w, "tailclip_websocket_clients %d\n", wsClients)
+
+	fmt.Fprintln(w, "# HELP tailclip_auth_failures_total Requests refused with 401 Unauthorized.")
+	fmt.Fprintln(w, "# TYPE tailclip_auth_failures_total counter")
+	fmt.Fprintf(w, "tailclip_auth_failures_total %d\n", m.authFailures)
+
+	if clipClasses != nil {
+		fmt.Fprintln(w, "# HELP tailclip_clips_by_class_total Clips accepted, by source device and coarse class.")
+		fmt.Fprintln(w, "# TYPE tailclip_clips_by_class_total counter")
+		for _, deviceID := range sortedKeys(clipClasses) {
+			for _, class := range sortedKeys(clipClasses[deviceID]) {
+				fmt.Fprintf(w, "tailclip_clips_by_class_total{device=%q,class=%q} %d\n", deviceID, class, clipClasses[deviceID][class])
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP tailclip_db_duration_seconds Time spent in database operations.")
+	fmt.Fprintln(w, "# TYPE tailclip_db_duration_seconds histogram")
+	for _, op := range sortedKeys(m.dbLatency) {
+		h := m.dbLatency[op]
+		var cumulative uint64
+		for i, bound := range dbLatencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "tailclip_db_duration_seconds_bucket{op=%q,le=\"%g\"} %d\n", op, bound, cumulative)
+		}
+		fmt.Fprintf(w, "tailclip_db_duration_seconds_bucket{op=%q,le=\"+Inf\"} %d\n", op, h.count)
+		fmt.Fprintf(w, "tailclip_db_duration_seconds_sum{op=%q} %g\n", op, h.sum)
+		fmt.Fprintf(w, "tailclip_db_duration_seconds_count{op=%q} %d\n", op, h.count)
+	}
+}
+
+// sortedKeys returns a map's keys in order, so scrapes list series stably.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// statusRecorder remembers the status a handler answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+// WHY: The WebSocket upgrade hijacks the connection through it.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// countAuthFailures wraps next to count the 401s it answers with.
+// WHY in one place: Every handler checks the token itself; counting at each
+// of them would miss the next endpoint someone adds.
+func countAuthFailures(metrics *Metrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == http.StatusUnauthorized {
+			metrics.authFailed()
+		}
+	})
+}
+
+// handleMetrics serves the metrics to a scraper holding the hub's shared
+// auth token.
+// WHY also accept "Authorization: Bearer": It is what Prometheus sends for
+// a scrape job's authorization setting; X-Auth-Token needs custom headers.
+// WHY not device tokens: Metrics are for the operator, not for agents.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := auth.ExtractTokenFromHeader(r)
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token == "" {
+		token = bearer
+	}
+	if !auth.ValidateToken(s.authToken, token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.write(w, s.broadcaster.ClientCount(), s.classes.Stats())
+}
@@ -0,0 +1,188 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the `hub note`, `hub pin`, and `hub search`
+// maintenance commands.
+//
+// WHY annotate history:
+// Some clips matter beyond the moment they were copied ("staging DB
+// password - rotate Friday"). A note next to the event, searchable along
+// with the clip text, turns history into a lightweight shared scratchpad
+// without adding a separate notes store. Pinning keeps such a clip past
+// retention, so a snippet pasted every month doesn't age out.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/cli"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// searchPreviewLength is how much clip text `hub search` prints per event.
+const searchPreviewLength = 60
+
+// runNote implements `hub note -event <id> [-text <note>] [config-path]`.
+// WHY an empty -text clears the note: Matches the API, where an empty note
+// removes it, so there is one rule to remember.
+func runNote(args []string) error {
+	fs := newCommandFlags("note")
+	eventID := fs.String("event", "", "event ID to annotate (required)")
+	text := fs.String("text", "", "note to attach; empty removes the existing note")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *eventID == "" {
+		fs.Usage()
+		return fmt.Errorf("-event is required")
+	}
+
+	note, err := normalizeNote(*text)
+	if err != nil {
+		return err
+	}
+
+	_, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	found, err := storage.SetEventNote(*eventID, note)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("event %s not found", *eventID)
+	}
+	if note == "" {
+		fmt.Printf("Removed note from event %s\n", *eventID)
+	} else {
+		fmt.Printf("Noted event %s: %s\n", *eventID, note)
+	}
+	return nil
+}
+
+// runPin implements `hub pin -event <id> [-unpin] [-device <id>] [config-path]`.
+func runPin(args []string) error {
+	fs := newCommandFlags("pin")
+	eventID := fs.String("event", "", "event ID to pin (required)")
+	unpin := fs.Bool("unpin", false, "unpin the event, returning it to the retention policy")
+	deviceID := fs.String("device", "", "pin the event for this device's quick-access list (`agent pins`) instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *eventID == "" {
+		fs.Usage()
+		return fmt.Errorf("-event is required")
+	}
+
+	_, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	// WHY the device only learns of it on its next connect: This command
+	// works on the database, not through the running hub.
+	if *deviceID != "" {
+		event, err := storage.SetEventPinnedFor(*eventID, *deviceID, !*unpin)
+		if err != nil {
+			return err
+		}
+		if event == nil {
+			return fmt.Errorf("event %s not found", *eventID)
+		}
+		if *unpin {
+			fmt.Printf("Unpinned event %s for %s\n", *eventID, *deviceID)
+		} else {
+			fmt.Printf("Pinned event %s for %s; it reaches the device when it next connects\n", *eventID, *deviceID)
+		}
+		return nil
+	}
+
+	found, err := storage.SetEventPinned(*eventID, !*unpin)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("event %s not found", *eventID)
+	}
+	if *unpin {
+		fmt.Printf("Unpinned event %s\n", *eventID)
+	} else {
+		fmt.Printf("Pinned event %s; retention will keep it\n", *eventID)
+	}
+	return nil
+}
+
+// runSearch implements `hub search -q <text> [-n N] [config-path]`.
+func runSearch(args []string) error {
+	fs := newCommandFlags("search")
+	query := fs.String("q", "", "text to find in clip content or notes (required)")
+	limit := fs.Int("n", 20, "maximum number of events to show")
+	addJSONFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *query == "" {
+		fs.Usage()
+		return fmt.Errorf("-q is required")
+	}
+
+	_, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	events, err := storage.SearchEvents(*query, *limit)
+	if err != nil {
+		return err
+	}
+	// WHY whole events: Scripts get the same shape as /api/v1/history.
+	if jsonOutput {
+		if events == nil {
+			events = []models.Event{}
+		}
+		if err := cli.PrintJSON(events); err != nil || len(events) > 0 {
+			return err
+		}
+		return cli.Exit(cli.ExitEmpty, nil)
+	}
+
+	for _, event := range events {
+		// WHY the name for files: Their text is base64, not something to read.
+		summary := preview(event.Text)
+		switch {
+		case event.Encrypted:
+			summary = "[encrypted]"
+		case event.ContentType == models.ContentTypeFile:
+			summary = "[file] " + event.FileName
+		}
+		pin := ""
+		if event.Pinned {
+			pin = " [pinned]"
+		}
+		fmt.Printf("%s %s source=%s%s: %s\n",
+			event.EventID, event.Timestamp.Local().Format("2006-01-02 15:04:05"),
+			event.SourceDeviceID, pin, summary)
+		if event.Note != "" {
+			fmt.Printf("    note: %s\n", event.Note)
+		}
+	}
+	fmt.Printf("%d matching event(s)\n", len(events))
+	if len(events) == 0 {
+		return cli.Exit(cli.ExitEmpty, nil)
+	}
+	return nil
+}
+
+// preview flattens text to one line and truncates it for terminal output.
+func preview(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > searchPreviewLength {
+		return string(runes[:searchPreviewLength]) + "..."
+	}
+	return text
+}
@@ -0,0 +1,95 @@
+// Author: Toluwalase Mebaanne
+// Package main provides quiet-hours delivery for the TailClip hub.
+//
+// WHY hold back broadcasts instead of rejecting pushes:
+// The copy still happened and belongs in history. Quiet hours are about *when*
+// other devices hear about it, so events are stored as usual and only the
+// live broadcast waits until the window ends.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// quietCheckInterval is how often the hub checks whether quiet hours ended.
+// WHY 30 seconds: Quiet hours have minute resolution; this delivers the
+// catch-up within a minute of the window closing.
+const quietCheckInterval = 30 * time.Second
+
+// quietQueue holds the clip withheld during quiet hours.
+//
+// WHY only the latest event: A clipboard holds one value. Replaying every
+// held-back clip would overwrite each receiver's clipboard several times in
+// a row and fire one notification per clip - exactly the noise quiet hours
+// exist to avoid. The rest remain available in history.
+type quietQueue struct {
+	mu      sync.Mutex
+	pending *models.Event
+	held    int // clips withheld since the last catch-up
+}
+
+// broadcastOrHold broadcasts event now, or holds it if quiet hours are active.
+func (s *Server) broadcastOrHold(event *models.Event) {
+	if s.cfg.QuietHours == nil || !s.cfg.QuietHours.Contains(time.Now()) {
+		s.broadcaster.Broadcast(event, event.SourceDeviceID)
+		return
+	}
+
+	s.quiet.mu.Lock()
+	defer s.quiet.mu.Unlock()
+	s.quiet.pending = event
+	s.quiet.held++
+	quietLog.Infof("Quiet hours: holding broadcast of event %s", event.EventID)
+}
+
+// RunQuietHours delivers the held-back clip once quiet hours end.
+// WHY a loop instead of a timer for the end time: Clock changes (DST,
+// NTP corrections, a laptop hub waking from sleep) would make a precomputed
+// timer fire at the wrong moment; re-checking the window can't drift.
+//
+// Held clips live in memory only. If the hub restarts during quiet hours the
+// catch-up is lost, but the clips are still in history.
+func (s *Server) RunQuietHours() {
+	if s.cfg.QuietHours == nil {
+		return
+	}
+	quietLog.Infof("Quiet hours enabled: %s-%s", s.cfg.QuietHours.Start, s.cfg.QuietHours.End)
+
+	ticker := time.NewTicker(quietCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if s.cfg.QuietHours.Contains(time.Now()) {
+			continue
+		}
+
+		s.quiet.mu.Lock()
+		event, held := s.quiet.pending, s.quiet.held
+		s.quiet.pending, s.quiet.held = nil, 0
+		s.quiet.mu.Unlock()
+
+		if event == nil {
+			continue
+		}
+		quietLog.Infof("Quiet hours over: delivering latest of %d held clip(s) (event %s)", held, event.EventID)
+		event.Delayed = true
+		// WHY: Hours later, a clip broadcast_before_store marked is long stored.
+		event.Provisional = false
+		s.broadcaster.Broadcast(event, event.SourceDeviceID)
+	}
+}
+
+// dropHeld discards the held-back clip if it is eventID.
+// WHY: A clip deleted from history during quiet hours must not be delivered
+// when they end.
+func (s *Server) dropHeld(eventID string) {
+	s.quiet.mu.Lock()
+	defer s.quiet.mu.Unlock()
+	if s.quiet.pending != nil && s.quiet.pending.EventID == eventID {
+		s.quiet.pending = nil
+	}
+}
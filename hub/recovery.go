@@ -0,0 +1,172 @@
+// Author: Toluwalase Mebaanne
+// Package main provides database backups and corruption recovery for the hub.
+//
+// WHY recover instead of exiting:
+// SQLite files do get damaged - a power cut on a Raspberry Pi's SD card, a
+// full disk, a sync tool touching the file. Before this, a damaged
+// tailclip.db meant the hub exited at every start until someone noticed.
+// Clipboard history is useful but replaceable; sync itself is the product.
+// So the hub keeps the damaged file for inspection, restores the latest
+// backup (or starts empty), logs loudly, and keeps serving.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tmair/tailclip/shared/config"
+)
+
+// backupSuffix is appended to sqlite_path to name the backup file.
+const backupSuffix = ".bak"
+
+// openHubStorage opens the hub database, recovering from corruption when
+// cfg.RecoverCorruptDB is set.
+// WHY only on corruption: Errors like a missing directory or a permission
+// problem would recur with any database file; moving the real one aside
+// would only hide the history.
+func openHubStorage(cfg *config.HubConfig) (*Storage, error) {
+	storage, err := NewStorage(cfg.SQLitePath)
+	if err == nil {
+		err = storage.CheckIntegrity()
+		if err != nil {
+			storage.Close()
+		}
+	}
+	if err == nil {
+		return storage, nil
+	}
+	if !cfg.RecoverCorruptDB || !isCorruption(err) {
+		return nil, err
+	}
+
+	storageLog.Errorf("************************************************************")
+	storageLog.Errorf("database %s is corrupted: %v", cfg.SQLitePath, err)
+	storageLog.Errorf("************************************************************")
+	return recoverDatabase(cfg.SQLitePath)
+}
+
+// isCorruption reports whether err means the database file is damaged.
+func isCorruption(err error) bool {
+	if errors.Is(err, ErrCorruptDatabase) {
+		return true
+	}
+	// WHY match the message: These are SQLite's texts for SQLITE_CORRUPT and
+	// SQLITE_NOTADB. Matching sqlite3.Error codes instead would tie this file
+	// to the cgo build of the driver.
+	msg := err.Error()
+	return strings.Contains(msg, "database disk image is malformed") ||
+		strings.Contains(msg, "file is not a database")
+}
+
+// recoverDatabase moves the corrupted database aside, then restores the
+// backup or, failing that, creates an empty database.
+func recoverDatabase(path string) (*Storage, error) {
+	aside, err := moveAside(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move corrupted database aside: %w", err)
+	}
+	storageLog.Errorf("corrupted database moved to %s", aside)
+
+	backup := path + backupSuffix
+	if _, err := os.Stat(backup); err == nil {
+		storage, err := restoreBackup(backup, path)
+		if err == nil {
+			info, _ := os.Stat(backup)
+			storageLog.Errorf("restored %s from backup taken %s - history since then is lost",
+				path, info.ModTime().Format(time.RFC3339))
+			return storage, nil
+		}
+		storageLog.Errorf("backup %s is unusable: %v", backup, err)
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(path + suffix)
+		}
+	}
+
+	storage, err := NewStorage(path)
+	if err != nil {
+		return nil, err
+	}
+	storageLog.Errorf("started with an EMPTY database at %s - clipboard history and device preferences were lost", path)
+	return storage, nil
+}
+
+// restoreBackup copies backup to path and opens it.
+// WHY copy instead of rename: If the restored copy turns out to be damaged
+// too, the backup itself must survive for manual recovery.
+func restoreBackup(backup, path string) (*Storage, error) {
+	if err := copyFile(backup, path); err != nil {
+		return nil, err
+	}
+	storage, err := NewStorage(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		storage.Close()
+		return nil, err
+	}
+	return storage, nil
+}
+
+// moveAside renames the database at path, with its WAL and shared-memory
+// files, to a timestamped name and returns the new database name.
+// WHY keep the WAL files with it: They may hold the last committed clips,
+// and without them the moved file is even less recoverable.
+func moveAside(path string) (string, error) {
+	aside := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		err := os.Rename(path+suffix, aside+suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return aside, nil
+}
+
+// copyFile copies src to dst, replacing dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return out.Close()
+}
+
+// RunBackups snapshots the database to sqlite_path + backupSuffix now and
+// every backup_interval_hours.
+// WHY right away: The database just passed its integrity check, so this is
+// a known-good copy. Without it, a hub restarted often would rarely have a
+// backup as young as the interval.
+func RunBackups(storage *Storage, cfg *config.HubConfig) {
+	if cfg.BackupIntervalHours <= 0 {
+		return
+	}
+	path := cfg.SQLitePath + backupSuffix
+
+	ticker := time.NewTicker(time.Duration(cfg.BackupIntervalHours) * time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := storage.Backup(path); err != nil {
+			storageLog.Errorf("database backup failed: %v", err)
+		} else {
+			storageLog.Infof("Database backed up to %s", path)
+		}
+		<-ticker.C
+	}
+}
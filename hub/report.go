@@ -0,0 +1,211 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the `hub report` diagnostic command.
+//
+// WHY a built-in report:
+// Bug reports usually arrive without the context needed to act on them
+// (which settings, how much history, which schema), and asking users to
+// paste their config or database risks leaking the auth token or clipboard
+// contents. The report collects that context in one JSON document with
+// secrets stripped and no clip content, so it is safe to attach to an issue.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/tmair/tailclip/shared/config"
+)
+
+// redacted replaces secret values in the report.
+const redacted = "[redacted]"
+
+// maxLogTailBytes bounds how much of a log file the report reads.
+// WHY: Hub logs are never rotated by the hub itself; only the end matters.
+const maxLogTailBytes = 1 << 20
+
+// diagnosticReport is the document written by `hub report`.
+type diagnosticReport struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	GoVersion   string          `json:"go_version"`
+	Platform    string          `json:"platform"`
+	Config      map[string]any  `json:"config"`
+	Database    databaseReport  `json:"database"`
+	Storage     *StorageSummary `json:"storage"`
+	Log         []string        `json:"log,omitempty"`
+}
+
+// databaseReport describes the database files on disk.
+type databaseReport struct {
+	SizeBytes    int64 `json:"size_bytes"`
+	WALSizeBytes int64 `json:"wal_size_bytes"`
+}
+
+// runReport implements `hub report [-log FILE] [-lines N] [-o FILE] [config-path]`.
+// WHY logs are opt-in via -log: The hub writes its log to stderr, wherever
+// the service manager sends it. Only the operator knows where that is.
+func runReport(args []string) error {
+	fs := newCommandFlags("report")
+	logPath := fs.String("log", "", "hub log file to include the end of (IP addresses and the auth token are redacted)")
+	lines := fs.Int("lines", 200, "number of log lines to include")
+	output := fs.String("o", "", "write the report to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	report := diagnosticReport{
+		GeneratedAt: time.Now().UTC(),
+		GoVersion:   runtime.Version(),
+		Platform:    runtime.GOOS + "/" + runtime.GOARCH,
+		Database: databaseReport{
+			SizeBytes:    fileSize(cfg.SQLitePath),
+			WALSizeBytes: fileSize(cfg.SQLitePath + "-wal"),
+		},
+	}
+
+	if report.Config, err = redactedConfig(cfg); err != nil {
+		return err
+	}
+	if report.Storage, err = storage.Summary(); err != nil {
+		return err
+	}
+	if *logPath != "" {
+		tail, err := tailLines(*logPath, *lines)
+		if err != nil {
+			return err
+		}
+		for _, line := range tail {
+			report.Log = append(report.Log, redactLogLine(line, cfg.AuthToken))
+		}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	data = append(data, '\n')
+
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0600); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Report written to %s - review it before attaching it to an issue.\n", *output)
+	return nil
+}
+
+// redactedConfig returns the effective hub config with secrets replaced.
+// WHY go through JSON: The report then shows exactly the keys a user would
+// write in hub-config.json, including defaults and env var overrides.
+func redactedConfig(cfg *config.HubConfig) (map[string]any, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	if cfg.AuthToken != "" {
+		fields["auth_token"] = redacted
+	}
+	if cfg.IntegrityKey != "" {
+		fields["integrity_key"] = redacted
+	}
+	if archive, ok := fields["archive"].(map[string]any); ok {
+		archive["key"] = redacted
+		if s3, ok := archive["s3"].(map[string]any); ok {
+			s3["secret_key"] = redacted
+		}
+	}
+	if blobs, ok := fields["blobs"].(map[string]any); ok {
+		if s3, ok := blobs["s3"].(map[string]any); ok {
+			s3["secret_key"] = redacted
+		}
+	}
+	return fields, nil
+}
+
+// fileSize returns the size of path, or 0 if it doesn't exist.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// tailLines returns up to n lines from the end of the file at path.
+func tailLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat log: %w", err)
+	}
+	offset := max(info.Size()-maxLogTailBytes, 0)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek log: %w", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+
+	// WHY drop the first line after seeking: It is almost always cut in half.
+	if offset > 0 {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// ipPattern matches IPv4 addresses and IPv6 addresses that contain "::" or
+// at least five groups.
+// WHY not shorter IPv6 forms: They are indistinguishable from the
+// hh:mm:ss timestamps on every log line.
+var ipPattern = regexp.MustCompile(
+	`\b\d{1,3}(?:\.\d{1,3}){3}\b|` +
+		`\b(?:[0-9A-Fa-f]{1,4}:){1,7}:(?:[0-9A-Fa-f]{1,4}(?::[0-9A-Fa-f]{1,4})*)?|` +
+		`\b(?:[0-9A-Fa-f]{1,4}:){4,7}[0-9A-Fa-f]{1,4}\b`)
+
+// minRedactTokenLength is the shortest auth token redactLogLine searches for.
+// WHY: The hub never logs the token; this is a safety net for lines from
+// proxies or scripts. A token of a few characters would match inside
+// ordinary words and garble every line instead.
+const minRedactTokenLength = 8
+
+// redactLogLine removes the auth token and IP addresses from a log line.
+// WHY IPs: Tailnet addresses identify machines on someone's network; they
+// are never needed to diagnose a hub problem.
+func redactLogLine(line, authToken string) string {
+	if len(authToken) >= minRedactTokenLength {
+		line = strings.ReplaceAll(line, authToken, redacted)
+	}
+	return ipPattern.ReplaceAllString(line, "[ip]")
+}
@@ -0,0 +1,235 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the retention job and the `hub retention`
+// maintenance command.
+//
+// WHY a background job:
+// retention_days and history_limit are promises to the people whose clips
+// the hub stores - passwords copied by mistake, private messages. A policy
+// that only applies when an operator remembers to run a command isn't one.
+//
+// WHY a retention preview:
+// retention_days and history_limit delete history for good, and nobody wants
+// to find out what "history_limit: 200" means for their data after the fact.
+// The preview shows exactly what a policy would remove - by device, content
+// type, channel, and age - using the same query that deletes, so operators
+// can try aggressive settings before committing to them.
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/tmair/tailclip/shared/config"
+)
+
+// configRetentionPolicy returns the retention policy configured for the hub,
+// with channel_policies' zero values filled in from the hub-wide ones.
+func configRetentionPolicy(cfg *config.HubConfig) RetentionPolicy {
+	policy := RetentionPolicy{RetentionDays: cfg.RetentionDays, HistoryLimit: cfg.HistoryLimit}
+	for _, channel := range cfg.ChannelPolicies {
+		if channel.RetentionDays == 0 && channel.HistoryLimit == 0 {
+			continue
+		}
+		retention := ChannelRetention{Channel: channel.Channel,
+			RetentionDays: channel.RetentionDays, HistoryLimit: channel.HistoryLimit}
+		if retention.RetentionDays == 0 {
+			retention.RetentionDays = cfg.RetentionDays
+		}
+		if retention.HistoryLimit == 0 {
+			retention.HistoryLimit = cfg.HistoryLimit
+		}
+		policy.Channels = append(policy.Channels, retention)
+	}
+	return policy
+}
+
+// RunRetention applies the configured retention policy now and every
+// retention_interval_hours, recording what it deleted for the stats endpoint.
+// WHY right away: A hub that was down for a week, or just had its limits
+// lowered, shouldn't keep serving what the policy says is gone for another
+// interval.
+func (s *Server) RunRetention() {
+	policy := configRetentionPolicy(s.cfg)
+	if s.cfg.RetentionIntervalHours <= 0 || policy.empty() {
+		return
+	}
+	retentionLog.Infof("Retention: %s, %s, applied every %d hour(s)",
+		limitText(policy.RetentionDays, "no age limit", "keep %d day(s)"),
+		limitText(policy.HistoryLimit, "no count limit", "keep newest %d event(s)"),
+		s.cfg.RetentionIntervalHours)
+	for _, channel := range policy.Channels {
+		retentionLog.Infof("Retention in channel %q: %s, %s", channel.Channel,
+			limitText(channel.RetentionDays, "no age limit", "keep %d day(s)"),
+			limitText(channel.HistoryLimit, "no count limit", "keep newest %d event(s)"))
+	}
+
+	if s.archive != nil {
+		retentionLog.Infof("Archiving pruned events to %s", s.archive.location)
+	}
+
+	ticker := time.NewTicker(time.Duration(s.cfg.RetentionIntervalHours) * time.Hour)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		pruned, err := applyRetention(s.storage, s.archive, s.blobs, policy, now)
+		s.retention.Add(now, pruned, err)
+		switch {
+		case err != nil:
+			retentionLog.Errorf("retention failed: %v", err)
+		case pruned > 0:
+			retentionLog.Infof("Retention pruned %d event(s)", pruned)
+		}
+		<-ticker.C
+	}
+}
+
+// applyRetention applies policy to storage, first writing the events it
+// prunes to archive when there is one, and returns how many were pruned.
+// WHY delete only what was written: If the store fails, the rest of the
+// events stay in history until the next run, rather than being lost.
+// WHY archive offloaded files whole, read back from blobs: Once pruned,
+// their objects are deleted from the blob store.
+func applyRetention(storage *Storage, archive *Archive, blobs *BlobStore, policy RetentionPolicy, now time.Time) (int64, error) {
+	if archive == nil {
+		return storage.ApplyRetention(policy, now)
+	}
+	var pruned int64
+	for {
+		events, err := storage.RetentionCandidates(policy, now, archiveBatchSize)
+		if err != nil || len(events) == 0 {
+			return pruned, err
+		}
+		archived := make([]string, 0, len(events))
+		var archiveErr error
+		for i := range events {
+			if archiveErr = blobs.Load(&events[i]); archiveErr != nil {
+				break
+			}
+			if archiveErr = archive.Put(&events[i]); archiveErr != nil {
+				break
+			}
+			archived = append(archived, events[i].EventID)
+		}
+		deleted, err := storage.PruneEvents(policy, now, archived)
+		pruned += deleted
+		switch {
+		case err != nil:
+			return pruned, err
+		case archiveErr != nil:
+			return pruned, archiveErr
+		// WHY stop when nothing was deleted: Every candidate was pinned in
+		// between; listing them again would loop forever.
+		case len(events) < archiveBatchSize || deleted == 0:
+			return pruned, nil
+		}
+	}
+}
+
+// runRetention implements `hub retention [-days N] [-limit N] [-delete] [config-path]`.
+// -days and -limit replace the hub-wide values; channel_policies still apply.
+// WHY report-only by default: Same as `hub revalidate` - deleting history is
+// irreversible, so the dry run is what you get unless you ask for -delete.
+func runRetention(args []string) error {
+	fs := newCommandFlags("retention")
+	days := fs.Int("days", -1, "retention_days to evaluate instead of the configured value (0 = no age limit)")
+	limit := fs.Int("limit", -1, "history_limit to evaluate instead of the configured value (0 = no limit)")
+	deleteEvents := fs.Bool("delete", false, "permanently delete the events the policy doesn't keep")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	policy := configRetentionPolicy(cfg)
+	if *days >= 0 {
+		policy.RetentionDays = *days
+	}
+	if *limit >= 0 {
+		policy.HistoryLimit = *limit
+	}
+
+	now := time.Now()
+	report, err := storage.PlanRetention(policy, now)
+	if err != nil {
+		return err
+	}
+	printRetentionReport(report)
+
+	if !*deleteEvents || report.Delete == 0 {
+		if report.Delete > 0 {
+			fmt.Printf("Re-run with -delete to remove them.\n")
+		}
+		return nil
+	}
+
+	archive, blobs := newArchive(cfg.Archive), newBlobStore(cfg.Blobs)
+	deleted, err := applyRetention(storage, archive, blobs, policy, now)
+	if archive != nil {
+		fmt.Printf("Archived %d event(s) to %s and deleted them from history\n", deleted, archive.location)
+	} else {
+		fmt.Printf("Deleted %d event(s)\n", deleted)
+	}
+	if err != nil {
+		return err
+	}
+	return sweepBlobs(blobs, storage)
+}
+
+// printRetentionReport writes a retention report for the terminal.
+func printRetentionReport(report *RetentionReport) {
+	fmt.Printf("Policy: %s, %s\n",
+		limitText(report.Policy.RetentionDays, "no age limit", "keep %d day(s)"),
+		limitText(report.Policy.HistoryLimit, "no count limit", "keep newest %d event(s)"))
+	for _, channel := range report.Policy.Channels {
+		fmt.Printf("  in channel %s: %s, %s\n", channel.Channel,
+			limitText(channel.RetentionDays, "no age limit", "keep %d day(s)"),
+			limitText(channel.HistoryLimit, "no count limit", "keep newest %d event(s)"))
+	}
+	fmt.Printf("Would delete %d of %d event(s): %d older than the cutoff, %d over the history limit\n",
+		report.Delete, report.Events, report.TooOld, report.OverLimit)
+	if report.Pinned > 0 {
+		fmt.Printf("Keeping %d pinned event(s) regardless\n", report.Pinned)
+	}
+	if report.Delete == 0 {
+		return
+	}
+
+	printCounts("By device", report.ByDevice, nil)
+	printCounts("By type", report.ByType, nil)
+	printCounts("By channel", report.ByChannel, nil)
+
+	var ages []string
+	for _, bucket := range retentionAgeBuckets {
+		ages = append(ages, bucket.label)
+	}
+	printCounts("By age", report.ByAge, ages)
+}
+
+// limitText describes one limit of a policy, where 0 means none.
+func limitText(value int, none, format string) string {
+	if value <= 0 {
+		return none
+	}
+	return fmt.Sprintf(format, value)
+}
+
+// printCounts prints a labeled group of counts in the given key order, or
+// sorted by key when order is nil. Keys with no count are skipped.
+func printCounts(label string, counts map[string]int, order []string) {
+	if order == nil {
+		order = slices.Sorted(maps.Keys(counts))
+	}
+	fmt.Printf("%s:\n", label)
+	for _, key := range order {
+		if counts[key] > 0 {
+			fmt.Printf("  %6d  %s\n", counts[key], key)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the `hub revalidate` maintenance command.
+//
+// WHY re-validate stored history:
+// Validation rules only run when an event is pushed. When rules get stricter
+// (a smaller maximum text length, a new content policy), events stored under
+// the old rules stay in history and keep being served to agents. This command
+// applies the *current* rules to everything already stored so operators can
+// see - and optionally remove - what no longer passes.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/handlers"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// revalidationFinding describes one stored event that fails current rules.
+type revalidationFinding struct {
+	Event  models.Event
+	Reason string
+}
+
+// runRevalidate implements `hub revalidate [-delete] [config-path]`.
+// WHY report-only by default: Deleting history is irreversible. Operators
+// should see exactly what would go before opting in with -delete.
+func runRevalidate(args []string) error {
+	fs := newCommandFlags("revalidate")
+	deleteInvalid := fs.Bool("delete", false, "permanently delete events that fail validation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	registry := handlers.NewHandlerRegistry(
+		handlers.NewTextHandler(cfg.MaxTextLength),
+		handlers.NewFileHandler(cfg.MaxFileSize),
+	)
+
+	richText := handlers.NewRichTextHandler(cfg.MaxTextLength)
+	sealed := handlers.NewSealedHandler(cfg.MaxTextLength, cfg.MaxFileSize)
+
+	blobs := newBlobStore(cfg.Blobs)
+
+	var findings []revalidationFinding
+	total := 0
+	err = storage.EachEvent(func(event *models.Event) error {
+		total++
+		// WHY an unreadable blob is a finding: The event can't be served
+		// either.
+		if err := blobs.Load(event); err != nil {
+			findings = append(findings, revalidationFinding{Event: *event, Reason: err.Error()})
+			return nil
+		}
+		if reason := validateStoredEvent(event, registry, richText, sealed); reason != "" {
+			findings = append(findings, revalidationFinding{Event: *event, Reason: reason})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, f := range findings {
+		// WHY no content in the output: The report is likely to be pasted
+		// into a terminal log or issue - it must not leak clipboard data.
+		fmt.Printf("INVALID %s source=%s time=%s type=%s: %s\n",
+			f.Event.EventID, f.Event.SourceDeviceID,
+			f.Event.Timestamp.Format("2006-01-02 15:04:05"), f.Event.ContentType, f.Reason)
+	}
+	fmt.Printf("Checked %d event(s): %d invalid\n", total, len(findings))
+
+	if !*deleteInvalid || len(findings) == 0 {
+		if len(findings) > 0 {
+			fmt.Printf("Re-run with -delete to remove them.\n")
+		}
+		return nil
+	}
+
+	deleted := 0
+	for _, f := range findings {
+		found, err := storage.DeleteEvent(f.Event.EventID)
+		if err != nil {
+			return fmt.Errorf("deleted %d of %d invalid events: %w", deleted, len(findings), err)
+		}
+		if found {
+			deleted++
+		}
+	}
+	fmt.Printf("Deleted %d invalid event(s)\n", deleted)
+	return sweepBlobs(blobs, storage)
+}
+
+// validateStoredEvent applies the current push-time content rules to a
+// stored event and returns why it fails, or "" if it passes.
+// WHY reuse the content handlers: The point is to enforce exactly the rules
+// new pushes face. Duplicating them here would drift over time.
+// WHY encrypted events only get the sealed checks: Their content can't be
+// read here; the receiving agents validate it after decrypting.
+func validateStoredEvent(event *models.Event, registry *handlers.HandlerRegistry, richText *handlers.RichTextHandler, sealed *handlers.SealedHandler) string {
+	var handler handlers.ContentHandler = sealed
+	if !event.Encrypted {
+		var err error
+		if handler, err = registry.Lookup(event.ContentType); err != nil {
+			return err.Error()
+		}
+	}
+	if err := handler.Process(event.Text); err != nil {
+		return err.Error()
+	}
+	if len(event.Formats) > 0 {
+		if err := richText.ProcessFormats(event.Formats, len(event.Text)); err != nil {
+			return err.Error()
+		}
+	}
+	if event.TextHash != "" && !strings.EqualFold(event.TextHash, event.ComputeTextHash()) {
+		return "text_hash does not match content"
+	}
+	return ""
+}
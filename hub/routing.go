@@ -0,0 +1,66 @@
+// Author: Toluwalase Mebaanne
+// Package main provides broadcast routing for the TailClip hub.
+//
+// WHY route at broadcast time instead of at push time:
+// Routing decides who *hears about* an event, not whether it exists. The
+// event is stored unchanged either way, so editing the rules changes future
+// deliveries without rewriting history.
+
+package main
+
+import (
+	"slices"
+
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// matchRoute returns the first rule that applies to event, or nil.
+// WHY first match wins: Like firewall rules, an ordered list is easy to
+// reason about - specific rules go first, broad ones last.
+func matchRoute(rules []config.RoutingRule, event *models.Event) *config.RoutingRule {
+	for i := range rules {
+		rule := &rules[i]
+		if matchesAny(rule.ContentTypes, event.ContentType) &&
+			matchesAny(rule.SourceDevices, event.SourceDeviceID) &&
+			matchesAny(rule.Channels, event.Channel) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// deliverTo reports whether a client should receive event under rule
+// (which may be nil when no rule matched).
+//
+// The client must subscribe to the event's channel - or, when the rule names
+// to_channels, to one of those - and pass the rule's device restrictions.
+func deliverTo(rule *config.RoutingRule, event *models.Event, deviceID string, subscriptions []string) bool {
+	channels := []string{event.Channel}
+	if rule != nil && len(rule.ToChannels) > 0 {
+		channels = rule.ToChannels
+	}
+	subscribed := false
+	for _, channel := range channels {
+		if slices.Contains(subscriptions, channel) {
+			subscribed = true
+			break
+		}
+	}
+	if !subscribed {
+		return false
+	}
+
+	if rule == nil {
+		return true
+	}
+	if slices.Contains(rule.ExcludeDevices, deviceID) {
+		return false
+	}
+	return matchesAny(rule.ToDevices, deviceID)
+}
+
+// matchesAny reports whether value is in list; an empty list matches all.
+func matchesAny(list []string, value string) bool {
+	return len(list) == 0 || slices.Contains(list, value)
+}
@@ -0,0 +1,281 @@
+// Author: Toluwalase Mebaanne
+// Package main provides a minimal client for S3-compatible object stores.
+//
+// WHY not the AWS SDK:
+// The hub needs to put, get, and delete whole objects by name, and hand out
+// presigned download links - nothing else. The SDK is dozens of modules for
+// that, and MinIO, Garage, B2, and R2 all speak the same few signed
+// requests. Signature Version 4 is a page of standard library code.
+//
+// WHY path-style addressing (ENDPOINT/BUCKET/KEY):
+// Every S3-compatible store supports it, while virtual-hosted buckets
+// (BUCKET.ENDPOINT) need DNS that self-hosted stores rarely have.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmair/tailclip/shared/config"
+)
+
+// s3Timeout bounds one request to the object store.
+const s3Timeout = 60 * time.Second
+
+// errObjectNotFound is returned by s3Client.get for a missing object.
+var errObjectNotFound = errors.New("object not found")
+
+// s3Client puts and gets objects in one bucket.
+type s3Client struct {
+	cfg    *config.S3Config
+	bucket string
+	http   *http.Client
+}
+
+// newS3Client returns a client for bucket in the store cfg describes.
+func newS3Client(cfg *config.S3Config, bucket string) *s3Client {
+	return &s3Client{cfg: cfg, bucket: bucket, http: &http.Client{Timeout: s3Timeout}}
+}
+
+// put stores data as the object key, replacing any existing one.
+func (c *s3Client) put(key string, data []byte) error {
+	resp, err := c.do(http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// get returns the object key, or errObjectNotFound.
+func (c *s3Client) get(key string) ([]byte, error) {
+	resp, err := c.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, errObjectNotFound
+	default:
+		return nil, s3Error(resp)
+	}
+}
+
+// delete removes the object key; a missing object is not an error.
+func (c *s3Client) delete(key string) error {
+	resp, err := c.do(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// presign returns a URL anyone can GET the object key from until ttl has
+// passed.
+func (c *s3Client) presign(key string, ttl time.Duration, now time.Time) (string, error) {
+	u, err := c.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	return c.presignURL(u, ttl, now), nil
+}
+
+// presignURL signs u, whose RawPath is set, for GET until ttl has passed.
+func (c *s3Client) presignURL(u *url.URL, ttl time.Duration, now time.Time) string {
+	amzDate := now.Format("20060102T150405Z")
+	scope := c.scope(now)
+	// WHY built by hand: The query must be signed exactly as sent, sorted by
+	// name and escaped like the path (url.Values escapes differently).
+	query := strings.Join([]string{
+		"X-Amz-Algorithm=AWS4-HMAC-SHA256",
+		"X-Amz-Credential=" + s3EscapeQuery(c.cfg.AccessKey+"/"+scope),
+		"X-Amz-Date=" + amzDate,
+		"X-Amz-Expires=" + strconv.Itoa(int(ttl.Seconds())),
+		"X-Amz-SignedHeaders=host",
+	}, "&")
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.RawPath,
+		query,
+		"host:" + u.Host,
+		"",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	u.RawQuery = query + "&X-Amz-Signature=" + c.signature(canonicalRequest, now)
+	return u.String()
+}
+
+// objectURL returns the path-style URL of the object key.
+func (c *s3Client) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(c.cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	path := u.Path + "/" + c.bucket + "/" + key
+	u.Path, u.RawPath = path, s3EscapePath(path)
+	return u, nil
+}
+
+// do sends a signed request for the object key.
+func (c *s3Client) do(method, key string, body []byte) (*http.Response, error) {
+	endpoint, err := c.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	c.sign(req, endpoint.RawPath, body, time.Now().UTC())
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", method, key, err)
+	}
+	return resp, nil
+}
+
+// sign adds AWS Signature Version 4 headers to req, whose escaped path is
+// escapedPath.
+func (c *s3Client) sign(req *http.Request, escapedPath string, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapedPath,
+		s3CanonicalQuery(req.URL.Query()),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKey, c.scope(now), signedHeaders, c.signature(canonicalRequest, now)))
+}
+
+// s3CanonicalQuery formats query as Signature Version 4 signs it: sorted by
+// name, then value, every part escaped.
+// WHY even though the hub's requests have no query: A parameter added
+// later would otherwise be sent unsigned, and every request refused.
+func s3CanonicalQuery(query url.Values) string {
+	var pairs [][2]string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, [2]string{s3EscapeQuery(name), s3EscapeQuery(value)})
+		}
+	}
+	// WHY not sort the joined "name=value" strings: "a-b=1" would sort
+	// before "a=1", since "-" comes before "=".
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	joined := make([]string, len(pairs))
+	for i, pair := range pairs {
+		joined[i] = pair[0] + "=" + pair[1]
+	}
+	return strings.Join(joined, "&")
+}
+
+// scope returns the credential scope of a signature made at now.
+func (c *s3Client) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + c.cfg.Region + "/s3/aws4_request"
+}
+
+// signature signs canonicalRequest with the key for now's day.
+func (c *s3Client) signature(canonicalRequest string, now time.Time) string {
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + c.scope(now) + "\n" +
+		sha256Hex([]byte(canonicalRequest))
+	return hex.EncodeToString(hmacSHA256(c.signingKey(now.Format("20060102")), stringToSign))
+}
+
+// signingKey derives the Signature Version 4 key for day (YYYYMMDD).
+func (c *s3Client) signingKey(day string) []byte {
+	key := []byte("AWS4" + c.cfg.SecretKey)
+	for _, part := range []string{day, c.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return key
+}
+
+// s3EscapePath escapes path the way Signature Version 4 expects: every byte
+// except unreserved characters and slashes.
+func s3EscapePath(path string) string {
+	return s3Escape(path, true)
+}
+
+// s3EscapeQuery escapes a query value the same way, slashes included.
+func s3EscapeQuery(value string) string {
+	return s3Escape(value, false)
+}
+
+// s3Escape escapes every byte of s except unreserved characters and, if
+// keepSlash, slashes.
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' && keepSlash {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// s3Error turns a failed response into an error, with the store's own
+// error code when it sent one.
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if _, rest, ok := strings.Cut(string(body), "<Code>"); ok {
+		if code, _, ok := strings.Cut(rest, "</Code>"); ok {
+			return fmt.Errorf("s3 request failed: %s (%s)", resp.Status, code)
+		}
+	}
+	return fmt.Errorf("s3 request failed: %s", resp.Status)
+}
+
+// sha256Hex returns the hex SHA-256 of data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -9,15 +9,25 @@
 package main
 
 import (
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
 	"github.com/tmair/tailclip/shared/auth"
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/e2e"
+	"github.com/tmair/tailclip/shared/handlers"
 	"github.com/tmair/tailclip/shared/models"
+	"github.com/tmair/tailclip/shared/wire"
 )
 
 // Server is the HTTP frontend for the TailClip hub.
@@ -27,20 +37,73 @@ import (
 type Server struct {
 	storage     *Storage
 	broadcaster *Broadcaster
+	cfg         *config.HubConfig
 	authToken   string
+	textHandler *handlers.TextHandler
+	fileHandler *handlers.FileHandler
+	richText    *handlers.RichTextHandler
+	sealed      *handlers.SealedHandler
+	registry    *handlers.HandlerRegistry
+	urlCleaner  *handlers.URLCleaner // nil unless strip_tracking_params is on
+	latency     *LatencyRecorder
+	classes     *ClipClassRecorder // nil unless clip_class_stats is on
+	retention   RetentionRecorder
+	quiet       quietQueue
+	uploads     *uploadStore
+	federation  []*federationLink
+	identity    *tailnetIdentity // nil unless tailnet_identity is on
+	tlsConfig   *tls.Config      // nil unless tailscale_cert is on (see tlscert.go)
+	archive     *Archive         // nil unless archive is configured
+	blobs       *BlobStore       // nil unless blobs are configured
+	metrics     *Metrics
+	flood       *floodGuard   // nil unless flood_max_per_minute is set
+	loops       *loopDetector // nil if sync_loop_cooldown_seconds is 0
 	mux         *http.ServeMux
+	handler     http.Handler // mux, counting auth failures
 }
 
-// NewServer creates a Server wired to the given storage and auth token.
+// NewServer creates a Server wired to the given storage, broadcaster, and config.
 // WHY accept dependencies: Follows dependency injection so callers (main, tests)
-// control which storage backend and credentials the server uses.
-func NewServer(storage *Storage, broadcaster *Broadcaster, authToken string) *Server {
+// control which storage backend and settings the server uses.
+// WHY the whole config instead of individual values: Handlers need a growing
+// set of limits and policies; passing the config avoids an ever-longer
+// parameter list.
+func NewServer(storage *Storage, broadcaster *Broadcaster, cfg *config.HubConfig) *Server {
 	s := &Server{
 		storage:     storage,
 		broadcaster: broadcaster,
-		authToken:   authToken,
+		cfg:         cfg,
+		authToken:   cfg.AuthToken,
+		textHandler: handlers.NewTextHandler(cfg.MaxTextLength),
+		fileHandler: handlers.NewFileHandler(cfg.MaxFileSize),
+		richText:    handlers.NewRichTextHandler(cfg.MaxTextLength),
+		sealed:      handlers.NewSealedHandler(cfg.MaxTextLength, cfg.MaxFileSize),
+		latency:     NewLatencyRecorder(),
+		classes:     NewClipClassRecorder(cfg.ClipClassStats),
+		uploads:     newUploadStore(),
+		federation:  newFederationLinks(cfg.Federation),
+		archive:     newArchive(cfg.Archive),
+		blobs:       newBlobStore(cfg.Blobs),
+		metrics:     NewMetrics(),
+		flood:       newFloodGuard(cfg.FloodMaxPerMinute, time.Duration(cfg.FloodThrottleMinutes)*time.Minute),
+		loops:       newLoopDetector(time.Duration(cfg.SyncLoopCooldownSeconds) * time.Second),
 		mux:         http.NewServeMux(),
 	}
+	// WHY hand the metrics to storage and the broadcaster: They time the
+	// queries and count the deliveries the server never sees.
+	storage.metrics = s.metrics
+	broadcaster.metrics = s.metrics
+	broadcaster.blobs = s.blobs
+	s.handler = countAuthFailures(s.metrics, s.mux)
+	// WHY keep the typed handlers as well: Capabilities advertise their
+	// limits, which the ContentHandler interface doesn't expose.
+	s.registry = handlers.NewHandlerRegistry(s.textHandler, s.fileHandler)
+	if cfg.StripTrackingParams {
+		s.urlCleaner = handlers.NewURLCleaner()
+	}
+	if cfg.TailnetIdentity {
+		s.identity = newTailnetIdentity(cfg.TailscaleCLI)
+	}
 	s.setupRoutes()
 	return s
 }
@@ -51,42 +114,992 @@ func NewServer(storage *Storage, broadcaster *Broadcaster, authToken string) *Se
 func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("/api/v1/clipboard/push", s.handlePush)
 	s.mux.HandleFunc("/api/v1/history", s.handleHistory)
+	s.mux.HandleFunc("/api/v1/history/note", s.handleEventNote)
+	s.mux.HandleFunc("/api/v1/history/diff", s.handleEventDiff)
+	s.mux.HandleFunc("/api/v1/history/retention", s.handleRetention)
+	s.mux.HandleFunc("/api/v1/events/{id}", s.handleEvent)
+	s.mux.HandleFunc("/api/v1/events/{id}/pin", s.handleEventPin)
+	s.mux.HandleFunc("/api/v1/blobs/{id}", s.handleBlob)
+	s.mux.HandleFunc("/api/v1/rejected", s.handleRejected)
+	s.mux.HandleFunc("/api/v1/conflicts", s.handleConflicts)
 	s.mux.HandleFunc("/api/v1/health", s.handleHealth)
+	s.mux.HandleFunc("/api/v1/capabilities", s.handleCapabilities)
+	s.mux.HandleFunc("/api/v1/keys", s.handleDataKeys)
+	s.mux.HandleFunc("/api/v1/uploads", s.handleUploads)
+	s.mux.HandleFunc("/api/v1/uploads/chunk", s.handleUploadChunk)
+	s.mux.HandleFunc("/api/v1/federation/relay", s.handleFederationRelay)
+	s.mux.HandleFunc("/api/v1/stats", s.handleStats)
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	s.mux.HandleFunc("/api/v1/admin/storage", s.handleAdminStorage)
+	s.mux.HandleFunc("/api/v1/admin/announce", s.handleAdminAnnounce)
+	s.mux.HandleFunc("/api/v1/devices", s.handleDevices)
+	s.mux.HandleFunc("/api/v1/devices/{id}/token", s.handleDeviceToken)
+	s.mux.HandleFunc("/api/v1/devices/{id}/signing-key", s.handleDeviceSigningKey)
 	s.mux.HandleFunc("/api/v1/device/register", s.handleRegister)
+	s.mux.HandleFunc("/api/v1/device/preferences", s.handleDevicePreferences)
+	s.mux.HandleFunc("/api/v1/device/merge", s.handleDeviceMerge)
 	s.mux.HandleFunc("/api/v1/ws", s.handleWebSocket)
+	s.mux.Handle("/ui/", uiHandler())
+	s.mux.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently))
 }
 
 // ServeHTTP delegates to the internal mux so Server satisfies http.Handler.
 // WHY implement http.Handler: Lets the server be used directly with
 // http.ListenAndServe or wrapped in middleware (logging, CORS, etc.) later.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.mux.ServeHTTP(w, r)
+	s.handler.ServeHTTP(w, r)
 }
 
-// ListenAndServe starts the HTTP server on the given address.
+// ListenAndServe starts the HTTP server on the given addresses.
 // WHY a convenience method: Encapsulates the standard http.Server setup with
-// sensible timeouts so callers only need to provide an address string.
-func (s *Server) ListenAndServe(addr string) error {
+// sensible timeouts so callers only need to provide address strings.
+// WHY several addresses: A Tailscale node has an IPv4 and an IPv6 address;
+// binding both (and nothing else) keeps the hub tailnet-only on both families.
+func (s *Server) ListenAndServe(addrs []string) error {
+	// WHY bind every address before serving any: A typo in the second
+	// address should stop startup, not leave a half-reachable hub.
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		listeners = append(listeners, ln)
+		serverLog.Infof("Hub listening on %s", ln.Addr())
+	}
+	return s.Serve(listeners)
+}
+
+// Serve serves the hub on listeners that are already bound, such as the
+// embedded Tailscale node's (see tsnet.go).
+func (s *Server) Serve(listeners []net.Listener) error {
 	srv := &http.Server{
-		Addr:         addr,
 		Handler:      s,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
-	log.Printf("Hub listening on %s", addr)
-	return srv.ListenAndServe()
-}
 
-// --- Handlers ----------------------------------------------------------------
+	errs := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		if s.tlsConfig != nil {
+			ln = tls.NewListener(ln, s.tlsConfig)
+		}
+		go func() { errs <- srv.Serve(ln) }()
+	}
+	return <-errs
+}
+
+// --- Handlers ----------------------------------------------------------------
+
+// handlePush receives clipboard events from agents and stores them.
+// WHY POST-only: Pushing a clipboard event is a write operation that
+// creates a new resource. GET would be semantically wrong and breaks caching.
+func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
+	// WHY capture first: The latency "hub" leg should include everything the
+	// hub does with the event, including decoding and storage.
+	receivedAt := time.Now().UTC()
+	serverLog.Debugf("Push request received from %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	who, ok := s.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Cap the request body before decoding.
+	// WHY: Without a bound, a single request could make the hub buffer an
+	// arbitrarily large body in memory before the length check ever runs.
+	r.Body = http.MaxBytesReader(w, r.Body, maxPushBodyBytes(s.textHandler.MaxLength(), s.fileHandler.MaxSize(), s.sealed.MaxEncodedLength()))
+
+	var event models.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.rejectPush(w, &models.RejectedEvent{Size: int(r.ContentLength)},
+				http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		s.rejectPush(w, &models.RejectedEvent{Size: int(r.ContentLength)},
+			http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	s.acceptEvent(w, r, &event, receivedAt, pushOrigin{caller: who})
+}
+
+// pushOrigin is who a push came from, beyond its source device.
+type pushOrigin struct {
+	// link is the federation link a relayed clip arrived over, or nil.
+	link *config.FederationLink
+	// caller is who pushed the clip; the zero value for relayed clips.
+	caller caller
+}
+
+// acceptEvent runs a pushed event through validation, transforms, storage,
+// and broadcast, and answers the request.
+// WHY separate from decoding: Chunked uploads (see upload.go) arrive in
+// parts but must face exactly the same pipeline once reassembled.
+func (s *Server) acceptEvent(w http.ResponseWriter, r *http.Request, event *models.Event, receivedAt time.Time, origin pushOrigin) {
+	// WHY the hub sets the origin: Only a federation link may mark a clip as
+	// relayed; an agent claiming an origin would skip the device checks below.
+	// Likewise only the hub knows which clips came in on a guest pass.
+	event.OriginHub = ""
+	event.Guest = origin.caller.guest != nil
+	event.Provisional = false
+	if origin.link != nil {
+		markRelayed(event, origin.link)
+	}
+
+	// WHY decompress first: Everything below - validation, transforms,
+	// storage, relaying - works on the original text, and broadcast
+	// compresses it again per client.
+	// WHY the push body limit: The text can't legitimately be larger than
+	// an uncompressed push of it could have been.
+	maxSize := maxPushBodyBytes(s.textHandler.MaxLength(), s.fileHandler.MaxSize(), s.sealed.MaxEncodedLength())
+	if err := wire.Decompress(event, int(maxSize)); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, wire.ErrTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		s.rejectPush(w, rejectedFrom(event), status, err.Error())
+		return
+	}
+
+	// Validate the event's shape before anything else touches it.
+	// WHY first: Device lookup, node binding, and storage all key off these
+	// fields; a malformed ID must not reach any of them.
+	var invalid *models.ValidationError
+	if err := models.ValidateEvent(event); errors.As(err, &invalid) {
+		s.rejectInvalid(w, rejectedFrom(event), invalid)
+		return
+	}
+
+	if !origin.caller.allows(event.SourceDeviceID) {
+		s.rejectPush(w, rejectedFrom(event), http.StatusForbidden, origin.caller.deviceMismatch())
+		return
+	}
+
+	// Look up the source device once - it drives both the enabled check
+	// and the notification hint below.
+	// WHY tolerate lookup errors and unknown devices: Registration is
+	// best-effort on the agent side, so an unregistered source is normal.
+	// WHY relayed clips skip both: Their devices belong to the peer's
+	// household and never register or connect here.
+	var device *models.Device
+	if origin.link == nil {
+		var err error
+		device, err = s.storage.GetDevice(event.SourceDeviceID)
+		if err != nil {
+			serverLog.Warnf("failed to load device %s: %v", event.SourceDeviceID, err)
+		}
+
+		if status, msg := s.checkNodeBinding(r, event.SourceDeviceID); status != 0 {
+			s.rejectPush(w, rejectedFrom(event), status, msg)
+			return
+		}
+	}
+
+	// WHY enforce here: Enabled is the administrative kill switch for a
+	// misbehaving or lost device - its pushes must not reach anyone.
+	if device != nil && !device.Enabled {
+		s.rejectPush(w, rejectedFrom(event), http.StatusForbidden, "device disabled")
+		return
+	}
+
+	if status, msg := checkSignature(device, event); status != 0 {
+		s.rejectPush(w, rejectedFrom(event), status, msg)
+		return
+	}
+
+	// WHY after the device checks: Pushes refused anyway don't count toward
+	// a flood. WHY before content validation: A flooding device's clips
+	// aren't worth the work.
+	if wait := s.floodWait(event.SourceDeviceID); wait > 0 {
+		w.Header().Set("Retry-After", retryAfter(wait))
+		s.rejectPush(w, rejectedFrom(event), http.StatusTooManyRequests,
+			fmt.Sprintf("device is throttled for pushing too many clips; retry in %s", wait.Round(time.Second)))
+		return
+	}
+
+	// Give HTML-only clips a plain-text version.
+	// WHY on the hub: Agents that only write plain text (older versions,
+	// Linux, scripts reading history) would otherwise receive an empty clip.
+	// WHY before content validation: The generated text is what gets checked
+	// against the size limit and stored.
+	// WHY not signed clips: Changing the text would break the signature.
+	if !event.Encrypted && !event.IsSigned() && event.ContentType == models.ContentTypeText && strings.TrimSpace(event.Text) == "" && event.Formats[models.FormatHTML] != "" {
+		event.Text = handlers.HTMLToText(event.Formats[models.FormatHTML])
+		event.SetTextHash()
+		serverLog.Infof("Generated plain text for HTML-only event %s", event.EventID)
+	}
+
+	// Validate content with its registered content handler before storing.
+	// WHY 413 vs 400: Oversized content is a policy limit the agent can act
+	// on (skip and tell the user); anything else, including a content type
+	// no handler accepts, is a malformed request.
+	// WHY refuse types without a handler even though ValidateEvent checks
+	// the type: The registry is what this hub can actually process; an
+	// event no handler has checked must not be stored.
+	handler, err := s.contentHandler(event)
+	if err == nil {
+		err = handler.Process(event.Text)
+	}
+	if err == nil && len(event.Formats) > 0 {
+		err = s.richText.ProcessFormats(event.Formats, len(event.Text))
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, handlers.ErrContentTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		s.rejectPush(w, rejectedFrom(event), status, err.Error())
+		return
+	}
+	if err := checkSizeLimits(s.cfg.AllSizeLimits(), event, clipSize(event, len(event.Text))); err != nil {
+		s.rejectPush(w, rejectedFrom(event), http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	// WHY refuse an unknown data key: The key was never uploaded or has been
+	// shredded, so nobody could ever read the clip.
+	if event.KeyID != "" {
+		key, err := s.storage.GetDataKey(event.KeyID)
+		if err != nil {
+			serverLog.Errorf("fetching data key %s: %v", event.KeyID, err)
+			http.Error(w, "failed to check data key", http.StatusInternalServerError)
+			return
+		}
+		if key == nil {
+			s.rejectPush(w, rejectedFrom(event), http.StatusBadRequest, "unknown data key "+event.KeyID)
+			return
+		}
+	}
+
+	// WHY after validation: Rules rewrite content that is known to be
+	// well-formed, and a refused push isn't worth transforming.
+	s.applyTransforms(event)
+
+	// Ensure timestamp is set - WHY: Agents might have clock skew, but we
+	// still accept their timestamp if present. Only default if missing.
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	// WHY normalize here: Agents from before channels existed send none.
+	if event.Channel == "" {
+		event.Channel = models.DefaultChannel
+	}
+
+	// Compute hash if not provided - WHY: Guarantees deduplication works
+	// even if the agent forgot to set the hash before sending.
+	if event.TextHash == "" {
+		event.SetTextHash()
+	}
+
+	// WHY answer 201: The clip was handled - a refusal would make the agent
+	// retry it, feeding the very loop being broken.
+	if s.syncLoopSuppressed(event.TextHash, event.SourceDeviceID) {
+		serverLog.Infof("Event not stored or broadcast (sync loop): id=%s source=%s", event.EventID, event.SourceDeviceID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"status": "suppressed"})
+		return
+	}
+
+	// WHY still broadcast when not storing: The opt-out is about what the
+	// hub keeps, not about syncing - the device's owner still wants to paste
+	// elsewhere. Agents that are offline simply miss the clip.
+	// WHY transient clips aren't stored either: They are flagged because
+	// they are secrets; a history row would outlive the expiry by weeks.
+	stored := true
+	switch {
+	case device != nil && !device.StoreHistory:
+		serverLog.Infof("Event not stored (device opted out of history): id=%s source=%s", event.EventID, event.SourceDeviceID)
+		stored = false
+	case event.IsTransient():
+		serverLog.Infof("Event not stored (transient): id=%s source=%s", event.EventID, event.SourceDeviceID)
+		stored = false
+	}
+
+	// Attach the source device's notification preference as a hint.
+	// WHY the hub overwrites whatever the agent sent: The preference is
+	// configured centrally, so the stored value is authoritative. A lookup
+	// failure only costs a notification, never the sync.
+	event.Silent = device != nil && !device.Notify
+	event.HubReceivedAt = receivedAt
+
+	// WHY before storing, and before broadcasting even with
+	// broadcast_before_store: The row must never point at an object that
+	// isn't there, and agents are sent the clip by reference.
+	if stored {
+		if err := s.blobs.Offload(event); err != nil {
+			serverLog.Errorf("storing event %s: %v", event.EventID, err)
+			http.Error(w, "failed to store event", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if stored && s.cfg.BroadcastBeforeStore {
+		if err := s.broadcastWhileStoring(event); err != nil {
+			serverLog.Errorf("inserting event %s, already broadcast as provisional: %v", event.EventID, err)
+			http.Error(w, "failed to store event", http.StatusInternalServerError)
+			return
+		}
+		serverLog.Infof("Event stored: id=%s source=%s type=%s", event.EventID, event.SourceDeviceID, event.ContentType)
+	} else {
+		if stored {
+			if err := s.storage.InsertEvent(event); err != nil {
+				serverLog.Errorf("inserting event: %v", err)
+				http.Error(w, "failed to store event", http.StatusInternalServerError)
+				return
+			}
+			serverLog.Infof("Event stored: id=%s source=%s type=%s", event.EventID, event.SourceDeviceID, event.ContentType)
+		}
+
+		// Broadcast to all connected WebSocket clients AFTER successful storage.
+		// WHY after storage: If storage fails, we don't want to broadcast an event
+		// that isn't persisted - agents would receive it but it wouldn't appear in
+		// history, causing inconsistency. Clips from devices opted out of
+		// history are the deliberate exception, and broadcast_before_store
+		// trades the guarantee away on purpose.
+		s.broadcastOrHold(event)
+	}
+
+	// WHY only stored clips: A device that keeps its clips out of this hub's
+	// history doesn't want them in a friend's either.
+	if stored {
+		s.relayToPeers(event)
+	}
+
+	s.metrics.eventPushed(event.ContentType)
+	s.classes.Add(event)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// broadcastWhileStoring inserts event and, at the same time, broadcasts it
+// marked provisional. It returns once both are done, with the insert's error.
+// WHY insert a copy: Broadcast stamps the sequence number and broadcast time
+// on the event it is given while InsertEvent may still be reading it.
+// WHY broadcast on this goroutine: Fan-out starts at once instead of waiting
+// for the scheduler; the insert is the part allowed to take its time.
+func (s *Server) broadcastWhileStoring(event *models.Event) error {
+	toStore := *event
+	done := make(chan error, 1)
+	go func() {
+		done <- s.storage.InsertEvent(&toStore)
+	}()
+
+	event.Provisional = true
+	s.broadcastOrHold(event)
+	return <-done
+}
+
+// rejectPush answers a refused push and, if enabled, records a metadata-only
+// stub in the rejected_events table.
+// WHY store a stub when the agent already gets the reason: The HTTP response
+// only reaches the agent's log. The stub is for the *user*, who later asks
+// "why didn't my clip arrive?".
+func (s *Server) rejectPush(w http.ResponseWriter, rejected *models.RejectedEvent, status int, reason string) {
+	s.recordRejection(rejected, status, reason)
+	http.Error(w, reason, status)
+}
+
+// rejectInvalid answers a push that failed schema validation with a JSON
+// body naming the offending field.
+// WHY JSON here when other refusals are plain text: Clients can point at
+// the exact field; older agents still just log the body as text.
+func (s *Server) rejectInvalid(w http.ResponseWriter, rejected *models.RejectedEvent, invalid *models.ValidationError) {
+	// WHY truncate: The rejected fields may be the oversized input itself;
+	// the stub only needs enough to recognize it.
+	rejected.EventID = truncateField(rejected.EventID)
+	rejected.SourceDeviceID = truncateField(rejected.SourceDeviceID)
+	s.recordRejection(rejected, http.StatusBadRequest, invalid.Error())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(wire.InvalidEvent(invalid))
+}
+
+// truncateField shortens an untrusted identifier to MaxDeviceIDLength bytes.
+func truncateField(value string) string {
+	if len(value) > models.MaxDeviceIDLength {
+		return strings.ToValidUTF8(value[:models.MaxDeviceIDLength], "")
+	}
+	return value
+}
+
+// recordRejection logs a refused push and, if enabled, stores its stub.
+func (s *Server) recordRejection(rejected *models.RejectedEvent, status int, reason string) {
+	// WHY %q: The IDs may be exactly the malformed input being rejected;
+	// quoting keeps control characters from forging log lines.
+	serverLog.Infof("Push rejected (%d): id=%q source=%q reason=%s",
+		status, rejected.EventID, rejected.SourceDeviceID, reason)
+
+	if s.cfg.StoreRejectedEvents {
+		rejected.Reason = reason
+		rejected.RejectedAt = time.Now().UTC()
+		if err := s.storage.InsertRejectedEvent(rejected); err != nil {
+			serverLog.Errorf("recording rejected event: %v", err)
+		}
+	}
+}
+
+// rejectedFrom builds a rejection stub from a decoded event, without content.
+func rejectedFrom(event *models.Event) *models.RejectedEvent {
+	return &models.RejectedEvent{
+		EventID:        event.EventID,
+		SourceDeviceID: event.SourceDeviceID,
+		ContentType:    event.ContentType,
+		Size:           len(event.Text),
+	}
+}
+
+// handleRejected lists recently rejected events (metadata only).
+// WHY this endpoint exists: It's the "lost+found" view - users can see which
+// clips never arrived and why, instead of guessing.
+func (s *Server) handleRejected(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rejected, err := s.storage.GetRejectedEvents(50)
+	if err != nil {
+		serverLog.Errorf("fetching rejected events: %v", err)
+		http.Error(w, "failed to fetch rejected events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rejected)
+}
+
+// handleConflicts lists recent duplicate device ID connections.
+// WHY: Two machines sharing a device_id look like random disconnects from
+// either side; this shows the operator what actually happened.
+func (s *Server) handleConflicts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conflicts, err := s.storage.GetDeviceConflicts(50)
+	if err != nil {
+		serverLog.Errorf("fetching device conflicts: %v", err)
+		http.Error(w, "failed to fetch device conflicts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conflicts)
+}
+
+// handleDevices lists the registered devices with their status.
+// WHY: The devices table is otherwise only visible with sqlite3; a
+// dashboard or someone debugging "why doesn't my laptop get clips" needs to
+// see which devices the hub knows, whether they're connected, and when they
+// last checked in.
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	devices, err := s.storage.ListDevices()
+	if err != nil {
+		serverLog.Errorf("listing devices: %v", err)
+		http.Error(w, "failed to list devices", http.StatusInternalServerError)
+		return
+	}
+
+	connected := make(map[string]bool)
+	for _, deviceID := range s.broadcaster.ConnectedDevices() {
+		connected[deviceID] = true
+	}
+	statuses := make([]models.DeviceStatus, 0, len(devices))
+	for _, device := range devices {
+		statuses = append(statuses, models.DeviceStatus{
+			Device:    device,
+			Online:    connected[device.DeviceID] || device.IsOnline(),
+			Connected: connected[device.DeviceID],
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// handleHistory returns clipboard events for agent sync: by default the
+// history_page_size newest. ?limit= (clamped to history_max_page_size) and
+// ?offset= select another page, ?q= searches, and
+// ?since= (RFC 3339) or ?since_event_id= return only what came after, oldest
+// first (for since_event_id, in the order the hub stored them). ?fields=meta
+// leaves out clip content.
+// WHY this endpoint exists: Agents poll the hub to discover clipboard events
+// from other devices. Without history, a newly started agent would have no
+// way to catch up on events it missed while offline.
+// WHY since_event_id next to since: The last event an agent saw is exact,
+// while its clock and the hub's may disagree; since suits a person asking
+// for "today".
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	// WHY search on the same endpoint: A filtered history is still history,
+	// and callers get the same event shape (including notes) either way.
+	q := HistoryQuery{
+		Text:       params.Get("q"),
+		Pinned:     params.Get("pinned") == "true",
+		PinnedFor:  params.Get("pinned_for"),
+		SinceEvent: params.Get("since_event_id"),
+		Limit:      s.cfg.HistoryPageSize,
+	}
+	pages := []struct {
+		param string
+		value *int
+	}{
+		{"limit", &q.Limit},
+		{"offset", &q.Offset},
+	}
+	for _, p := range pages {
+		raw := params.Get(p.param)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, p.param+" must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		*p.value = n
+	}
+	// WHY clamp instead of refusing: A client asking for more than the hub
+	// allows still gets a useful page, and can read the policy from
+	// /api/v1/stats to page through the rest.
+	q.Limit = min(max(q.Limit, 1), s.cfg.HistoryMaxPageSize)
+	// WHY meta without text: A list of a hundred large clips is megabytes a
+	// dashboard or phone never shows; it fetches the one picked from
+	// /api/v1/events/{id}.
+	switch params.Get("fields") {
+	case "":
+	case "meta":
+		q.MetaOnly = true
+	default:
+		http.Error(w, "fields must be meta", http.StatusBadRequest)
+		return
+	}
+	if raw := params.Get("since"); raw != "" {
+		since, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		q.Since = since
+	}
+
+	// WHY 404 for an unknown since_event_id: Otherwise the answer would be
+	// an empty page, telling an agent whose last event was pruned that it
+	// missed nothing. It should fall back to since or the newest page.
+	if q.SinceEvent != "" {
+		known, err := s.storage.GetEvent(q.SinceEvent)
+		if err != nil {
+			serverLog.Errorf("fetching history: %v", err)
+			http.Error(w, "failed to fetch history", http.StatusInternalServerError)
+			return
+		}
+		if known == nil {
+			http.Error(w, fmt.Sprintf("event %s not found (never stored or pruned)", q.SinceEvent), http.StatusNotFound)
+			return
+		}
+	}
+
+	events, err := s.storage.GetHistory(q)
+	if err != nil {
+		serverLog.Errorf("fetching history: %v", err)
+		http.Error(w, "failed to fetch history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.blobs.withURLs(events))
+}
+
+// handleRetention reports what the retention policy would delete. The
+// configured policy is used unless overridden with ?days= and ?limit=
+// (0 disables a limit).
+// WHY read-only: Pruning follows the configured policy (see RunRetention) or
+// an operator's `hub retention -delete` on the hub machine, not something any
+// token holder should trigger.
+func (s *Server) handleRetention(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	policy := configRetentionPolicy(s.cfg)
+	overrides := []struct {
+		param string
+		value *int
+	}{
+		{"days", &policy.RetentionDays},
+		{"limit", &policy.HistoryLimit},
+	}
+	for _, o := range overrides {
+		raw := r.URL.Query().Get(o.param)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, o.param+" must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		*o.value = n
+	}
+
+	report, err := s.storage.PlanRetention(policy, time.Now())
+	if err != nil {
+		serverLog.Errorf("planning retention: %v", err)
+		http.Error(w, "failed to plan retention", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// maxNoteLength caps an event note, in characters.
+// WHY: Notes are one-line reminders next to a clip, not a second clipboard.
+const maxNoteLength = 280
+
+// eventNoteRequest is the body accepted by handleEventNote.
+type eventNoteRequest struct {
+	EventID string `json:"event_id"`
+	Note    string `json:"note"`
+}
+
+// handleEvent returns one event from history with its content (GET), or
+// permanently deletes it (DELETE) and tells agents so they can clear it too.
+// WHY a path parameter: It names the one resource the request acts on;
+// the other endpoints take IDs in the query because they predate Go's
+// pattern routing.
+// WHY also purge the replay buffer and quiet-hours hold: Otherwise a
+// resuming agent, or the end of quiet hours, would deliver the deleted clip
+// after all.
+// WHY also delete from the archive: GET reads archived events back, so a
+// secret that retention already archived must be removable there as well.
+func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	eventID := r.PathValue("id")
+	if r.Method == http.MethodGet {
+		event, err := s.storage.GetEvent(eventID)
+		if err != nil {
+			serverLog.Errorf("fetching event %s: %v", eventID, err)
+			http.Error(w, "failed to fetch event", http.StatusInternalServerError)
+			return
+		}
+		// WHY read through: An event retention moved to the archive is
+		// still there for whoever asks for it by ID (see archive.go).
+		if event == nil {
+			if event, err = s.archive.Get(eventID); err != nil {
+				serverLog.Errorf("fetching archived event %s: %v", eventID, err)
+				http.Error(w, "failed to fetch archived event", http.StatusBadGateway)
+				return
+			}
+		}
+		if event == nil {
+			http.Error(w, "event not found", http.StatusNotFound)
+			return
+		}
+		event.BlobURL = s.blobs.URL(event, time.Now())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(event)
+		return
+	}
+
+	found, err := s.storage.DeleteEvent(eventID)
+	if err != nil {
+		serverLog.Errorf("deleting event %s: %v", eventID, err)
+		http.Error(w, "failed to delete event", http.StatusInternalServerError)
+		return
+	}
+	// WHY both, not either: Retention writes to the archive before it
+	// deletes from history, so a crash in between leaves the event in both.
+	archived, err := s.archive.Delete(eventID)
+	if err != nil {
+		serverLog.Errorf("deleting archived event %s: %v", eventID, err)
+		http.Error(w, "failed to delete archived event", http.StatusBadGateway)
+		return
+	}
+	if archived {
+		serverLog.Infof("Deleted archived event %s", eventID)
+	}
+	if !found && !archived {
+		http.Error(w, "event not found", http.StatusNotFound)
+		return
+	}
+
+	s.dropHeld(eventID)
+	s.broadcaster.Forget(eventID)
+	serverLog.Infof("Deleted event %s", eventID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEventPin pins (PUT) or unpins (DELETE) an event, exempting it from
+// retention or returning it to the normal policy.
+// WHY PUT and DELETE on one path: Pinning is setting a flag, not creating
+// anything, so both are idempotent - pinning twice is the same as once.
+// WHY not broadcast the change: Same as notes; a pin only affects history.
+// With ?device=ID the event is pinned for that device instead (see
+// handleDevicePin).
+func (s *Server) handleEventPin(w http.ResponseWriter, r *http.Request) {
+	var pinned bool
+	switch r.Method {
+	case http.MethodPut:
+		pinned = true
+	case http.MethodDelete:
+		pinned = false
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if deviceID := r.URL.Query().Get("device"); deviceID != "" {
+		s.handleDevicePin(w, r, deviceID, pinned)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	eventID := r.PathValue("id")
+	found, err := s.storage.SetEventPinned(eventID, pinned)
+	if err != nil {
+		serverLog.Errorf("pinning event %s: %v", eventID, err)
+		http.Error(w, "failed to pin event", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "event not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDevicePin pins or unpins an event for one device and tells that
+// device, if it is connected.
+// WHY device tokens may pin for their own device: Pinning a clip to keep it
+// at hand is something done from the device itself (`agent pins -add`).
+func (s *Server) handleDevicePin(w http.ResponseWriter, r *http.Request, deviceID string, pinned bool) {
+	caller, ok := s.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !caller.allows(deviceID) {
+		http.Error(w, caller.deviceMismatch(), http.StatusForbidden)
+		return
+	}
+	if err := models.ValidateDeviceID(deviceID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	eventID := r.PathValue("id")
+	event, err := s.storage.SetEventPinnedFor(eventID, deviceID, pinned)
+	if err != nil {
+		serverLog.Errorf("pinning event %s for %s: %v", eventID, deviceID, err)
+		http.Error(w, "failed to pin event", http.StatusInternalServerError)
+		return
+	}
+	if event == nil {
+		http.Error(w, "event not found", http.StatusNotFound)
+		return
+	}
+
+	pin := &models.Pin{EventID: eventID, Pinned: pinned}
+	if pinned {
+		pin.Event = event
+	}
+	s.broadcaster.SendPin(deviceID, pin)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEventNote sets or clears (empty note) the note on a history event.
+// WHY not broadcast the change: Notes annotate history for whoever looks it
+// up later; pushing them to agents would rewrite nobody's clipboard.
+func (s *Server) handleEventNote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req eventNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if req.EventID == "" {
+		http.Error(w, "event_id is required", http.StatusBadRequest)
+		return
+	}
+	note, err := normalizeNote(req.Note)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.storage.SetEventNote(req.EventID, note)
+	if err != nil {
+		serverLog.Errorf("setting note on event %s: %v", req.EventID, err)
+		http.Error(w, "failed to set note", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "event not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":   "ok",
+		"event_id": req.EventID,
+		"note":     note,
+	})
+}
+
+// normalizeNote trims a note and enforces maxNoteLength.
+func normalizeNote(note string) (string, error) {
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > maxNoteLength {
+		return "", fmt.Errorf("note exceeds %d characters", maxNoteLength)
+	}
+	return note, nil
+}
+
+// handleEventDiff returns a unified diff between two text events, given as
+// the `from` and `to` query parameters.
+// WHY text/plain instead of JSON: A unified diff is already a standard
+// format - it can be piped straight into a pager, `patch`, or a diff viewer.
+// Identical texts return 200 with an empty body, like `diff -u`.
+func (s *Server) handleEventDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fromID, toID := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if fromID == "" || toID == "" {
+		http.Error(w, "from and to event IDs are required", http.StatusBadRequest)
+		return
+	}
+
+	var events [2]*models.Event
+	for i, id := range []string{fromID, toID} {
+		event, err := s.storage.GetEvent(id)
+		if err != nil {
+			serverLog.Errorf("fetching event %s: %v", id, err)
+			http.Error(w, "failed to fetch event", http.StatusInternalServerError)
+			return
+		}
+		if event == nil {
+			http.Error(w, "event not found: "+id, http.StatusNotFound)
+			return
+		}
+		if !s.textHandler.CanHandle(event.ContentType) {
+			http.Error(w, "only text events can be diffed: "+id, http.StatusBadRequest)
+			return
+		}
+		if event.Encrypted {
+			http.Error(w, "encrypted events can't be diffed on the hub: "+id, http.StatusBadRequest)
+			return
+		}
+		events[i] = event
+	}
+
+	diff, err := diffEvents(events[0], events[1])
+	if errors.Is(err, errDiffTooLarge) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		serverLog.Errorf("diffing events %s and %s: %v", fromID, toID, err)
+		http.Error(w, "failed to diff events", http.StatusInternalServerError)
+		return
+	}
 
-// handlePush receives clipboard events from agents and stores them.
-// WHY POST-only: Pushing a clipboard event is a write operation that
-// creates a new resource. GET would be semantically wrong and breaks caching.
-func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Push request received from %s", r.RemoteAddr)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(diff))
+}
 
-	if r.Method != http.MethodPost {
+// handleStats reports connected clients, recent end-to-end sync latency,
+// and what the retention job has pruned.
+// WHY authenticated unlike /health: Latency samples are derived from
+// device activity, which is private to the tailnet's owner.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -96,49 +1109,85 @@ func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var event models.Event
-	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
-		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.HubStats{
+		ConnectedClients: s.broadcaster.ClientCount(),
+		Latency:          s.latency.Stats(),
+		Retention:        s.retention.Stats(),
+		ClipClasses:      s.classes.Stats(),
+		History: models.HistoryPolicy{
+			DefaultLimit: s.cfg.HistoryPageSize,
+			MaxLimit:     s.cfg.HistoryMaxPageSize,
+		},
+	})
+}
+
+// vacuumResult is the answer to POST /api/v1/admin/storage.
+type vacuumResult struct {
+	// ReclaimedBytes is how much smaller the database file and WAL got
+	ReclaimedBytes int64        `json:"reclaimed_bytes"`
+	Storage        *SpaceReport `json:"storage"`
+}
+
+// handleAdminStorage reports the database's disk usage (GET) or runs
+// VACUUM to give free pages back to the file system (POST).
+// WHY an endpoint: Long-lived hubs grow and shrink with retention, and
+// operators shouldn't need the sqlite3 shell (often not installed next to
+// the hub) to see where the space went or to reclaim it.
+// WHY POST for VACUUM: It rewrites the whole database and blocks writes
+// while it runs - nothing a GET should ever trigger.
+func (s *Server) handleAdminStorage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Ensure timestamp is set - WHY: Agents might have clock skew, but we
-	// still accept their timestamp if present. Only default if missing.
-	if event.Timestamp.IsZero() {
-		event.Timestamp = time.Now().UTC()
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
 	}
 
-	// Compute hash if not provided - WHY: Guarantees deduplication works
-	// even if the agent forgot to set the hash before sending.
-	if event.TextHash == "" {
-		event.SetTextHash()
+	before, err := s.storage.Space()
+	if err != nil {
+		serverLog.Errorf("reading storage space: %v", err)
+		http.Error(w, "failed to read storage space", http.StatusInternalServerError)
+		return
 	}
-
-	if err := s.storage.InsertEvent(&event); err != nil {
-		log.Printf("ERROR inserting event: %v", err)
-		http.Error(w, "failed to store event", http.StatusInternalServerError)
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(before)
 		return
 	}
 
-	log.Printf("Event stored: id=%s source=%s type=%s", event.EventID, event.SourceDeviceID, event.ContentType)
-
-	// Broadcast to all connected WebSocket clients AFTER successful storage.
-	// WHY after storage: If storage fails, we don't want to broadcast an event
-	// that isn't persisted - agents would receive it but it wouldn't appear in
-	// history, causing inconsistency.
-	s.broadcaster.Broadcast(&event, event.SourceDeviceID)
+	// WHY lift the write deadline: VACUUM on a large database can take
+	// longer than the server's WriteTimeout, and the caller should still
+	// learn how it went.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	start := time.Now()
+	if err := s.storage.Vacuum(); err != nil {
+		serverLog.Errorf("vacuuming database: %v", err)
+		http.Error(w, "failed to vacuum database", http.StatusInternalServerError)
+		return
+	}
+	after, err := s.storage.Space()
+	if err != nil {
+		serverLog.Errorf("reading storage space: %v", err)
+		http.Error(w, "failed to read storage space", http.StatusInternalServerError)
+		return
+	}
 
+	reclaimed := before.FileBytes + before.WALBytes - after.FileBytes - after.WALBytes
+	serverLog.Infof("Vacuumed database in %s, reclaiming %d bytes", time.Since(start).Round(time.Millisecond), reclaimed)
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	json.NewEncoder(w).Encode(vacuumResult{ReclaimedBytes: reclaimed, Storage: after})
 }
 
-// handleHistory returns recent clipboard events for agent sync.
-// WHY this endpoint exists: Agents poll the hub to discover clipboard events
-// from other devices. Without history, a newly started agent would have no
-// way to catch up on events it missed while offline.
-func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// handleAdminAnnounce sends an operator's message to the connected agents,
+// which show it as a notification (see models.Alert).
+// WHY the shared token only: An announcement speaks for the hub to every
+// device; a device token speaks for one device.
+func (s *Server) handleAdminAnnounce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -148,18 +1197,26 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Default to 50 events - WHY: Keeps response size reasonable for routine
-	// polling while giving enough history for agents reconnecting after a brief gap.
-	limit := 50
-	events, err := s.storage.GetRecentEvents(limit)
-	if err != nil {
-		log.Printf("ERROR fetching history: %v", err)
-		http.Error(w, "failed to fetch history", http.StatusInternalServerError)
+	var req models.Announce
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		http.Error(w, "message is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(message) > models.MaxAnnouncementLength {
+		http.Error(w, fmt.Sprintf("message is longer than %d characters", models.MaxAnnouncementLength),
+			http.StatusBadRequest)
 		return
 	}
 
+	delivered := s.broadcaster.Announce(message, req.DeviceIDs)
+	serverLog.Infof("Announcement sent to %d device(s): %s", delivered, message)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(events)
+	json.NewEncoder(w).Encode(models.AnnounceResult{Delivered: delivered})
 }
 
 // handleHealth is a lightweight liveness check.
@@ -176,6 +1233,195 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// handleCapabilities reports the hub's limits so agents can match them.
+// WHY authenticated: Limits aren't secret, but every other API call needs
+// the token anyway, and an unauthenticated endpoint invites probing.
+func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := s.authenticate(r); !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.Capabilities{
+		MaxTextLength: s.textHandler.MaxLength(),
+		MaxFileSize:   s.fileHandler.MaxSize(),
+		WireVersion:   wire.Version,
+		DataKeys:      true,
+		ChunkSize:     wire.ChunkSize,
+		Compression:   wire.Compressions,
+	})
+}
+
+// contentHandler returns the handler that validates event's content: the
+// sealed handler for encrypted events, the registered one otherwise.
+func (s *Server) contentHandler(event *models.Event) (handlers.ContentHandler, error) {
+	if event.Encrypted {
+		if !s.sealed.CanHandle(event.ContentType) {
+			return nil, fmt.Errorf("%w %q for an encrypted event", handlers.ErrUnsupportedType, event.ContentType)
+		}
+		return s.sealed, nil
+	}
+	return s.registry.Lookup(event.ContentType)
+}
+
+// handleDataKeys serves the wrapped per-day keys of encrypted clips:
+// GET ?key_id=ID returns one (404 if it doesn't exist or was shredded), with
+// &latest=true the newest key of ID's day, GET without key_id lists them all, POST stores one unless its day already has
+// a key, returning the stored key either way, and PUT rewraps one after the
+// shared key was rotated (see models.DataKeyRewrap), with the hub token only.
+// WHY the hub holds them: Every agent needs the same key for a day, and the
+// hub is the one place they all reach. Wrapped keys are useless without the
+// agents' shared key, which the hub never sees.
+func (s *Server) handleDataKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// WHY device tokens but not guests: Enrolled agents seal and open clips
+	// with these keys; guests never get end-to-end encrypted clips.
+	// WHY the hub token to rewrap: A replaced key makes its day unreadable
+	// for good. A lost device's token could otherwise read every wrapped
+	// key and overwrite them all, destroying more history than deleting
+	// events, which needs the hub token too.
+	who, ok := s.authenticate(r)
+	if !ok || who.guest != nil || r.Method == http.MethodPut && !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodGet && !r.URL.Query().Has("key_id") {
+		keys, err := s.storage.ListDataKeys()
+		if err != nil {
+			serverLog.Errorf("listing data keys: %v", err)
+			http.Error(w, "failed to list data keys", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+		return
+	}
+
+	var key *models.DataKey
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		keyID := r.URL.Query().Get("key_id")
+		if err := models.ValidateKeyID(keyID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("latest") == "true" {
+			key, err = s.storage.LatestDataKey(keyID)
+		} else {
+			key, err = s.storage.GetDataKey(keyID)
+		}
+	case http.MethodPost:
+		var req models.DataKey
+		if !decodeDataKeyBody(w, r, &req) || !checkWrappedKey(w, req.KeyID, req.Wrapped) {
+			return
+		}
+		key, err = s.storage.AddDataKey(&req)
+	case http.MethodPut:
+		var req models.DataKeyRewrap
+		if !decodeDataKeyBody(w, r, &req) || !checkWrappedKey(w, req.KeyID, req.Wrapped) {
+			return
+		}
+		var replaced bool
+		if replaced, err = s.storage.RewrapDataKey(req.KeyID, req.Previous, req.Wrapped); err == nil {
+			key, err = s.storage.GetDataKey(req.KeyID)
+		}
+		if err == nil && key != nil && !replaced {
+			http.Error(w, "data key was changed or rewrapped since it was read", http.StatusConflict)
+			return
+		}
+		if err == nil && key != nil {
+			serverLog.Infof("Data key %s rewrapped", req.KeyID)
+		}
+	}
+	if err != nil {
+		serverLog.Errorf("handling data key: %v", err)
+		http.Error(w, "failed to handle data key", http.StatusInternalServerError)
+		return
+	}
+	if key == nil {
+		http.Error(w, "data key not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+// decodeDataKeyBody decodes a data key request into req, answering the
+// request itself if that fails.
+func decodeDataKeyBody(w http.ResponseWriter, r *http.Request, req any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// checkWrappedKey validates an uploaded wrapped key, answering the request
+// itself if it is invalid.
+// WHY only check the length: The hub can't unwrap the key, but a wrong
+// length means it was never produced by e2e.WrapKey - for instance a raw
+// key sent by mistake, which the hub must not store.
+func checkWrappedKey(w http.ResponseWriter, keyID, wrapped string) bool {
+	if err := models.ValidateKeyID(keyID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if len(wrapped) != e2e.WrappedKeyLength {
+		http.Error(w, "wrapped key has the wrong length", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// maxPushBodyBytes returns the request body limit for the given text,
+// file, and sealed content limits.
+// WHY 6x plus slack: JSON escaping can expand text up to six bytes per input
+// byte (\uXXXX), and the envelope adds IDs, hashes, and timestamps. Files
+// are base64, which JSON never escapes, and so is sealed content. The
+// precise limits are enforced on the decoded content by the handlers.
+func maxPushBodyBytes(maxTextLength, maxFileSize, maxSealedLength int) int64 {
+	body := max(int64(maxTextLength)*6, int64(base64.StdEncoding.EncodedLen(maxFileSize)), int64(maxSealedLength))
+	return body + 64*1024
+}
+
+// checkSignature refuses a clip not signed with the key its source device
+// registered, and any signature that doesn't verify.
+// WHY on the hub as well as on receivers: Receivers pin the first key they
+// see for a device. Checking the registered key here keeps anyone else
+// holding the shared token from getting in first with a key of their own.
+// WHY unsigned clips from devices without a key pass: Signing is opt-in, and
+// whether to accept unsigned clips is each receiver's call.
+func checkSignature(device *models.Device, event *models.Event) (int, string) {
+	if device != nil && device.SigningKey != "" {
+		if !event.IsSigned() {
+			return http.StatusForbidden, "device signs its clips; refusing an unsigned one"
+		}
+		if event.SigningKey != device.SigningKey {
+			return http.StatusForbidden, "clip is signed with a key the device did not register"
+		}
+	}
+	if event.IsSigned() {
+		if err := e2e.VerifyEvent(event); err != nil {
+			return http.StatusForbidden, err.Error()
+		}
+	}
+	return 0, ""
+}
+
 // handleRegister allows agents to announce themselves to the hub.
 // WHY this endpoint exists: The hub needs to know which devices are in the
 // network for health monitoring, event routing, and admin visibility.
@@ -186,7 +1432,8 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !auth.Authenticate(r, s.authToken) {
+	who, ok := s.authenticate(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -197,26 +1444,227 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := models.ValidateDeviceID(device.DeviceID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if device.SigningKey != "" {
+		if err := models.ValidateSigningKey(device.SigningKey); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if refuseOtherDevice(w, who, device.DeviceID) {
+		return
+	}
+
+	if status, msg := s.checkNodeBinding(r, device.DeviceID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
 	// Always update last-seen on registration - WHY: Registration doubles as
 	// a heartbeat so the hub knows this device is alive right now.
 	device.UpdateLastSeen()
 
-	if err := s.storage.InsertDevice(&device); err != nil {
-		log.Printf("ERROR registering device: %v", err)
+	// Fill in the address from the connection if the agent didn't report one.
+	// WHY: Agents reach the hub over the Tailnet, so the remote address is
+	// the device's Tailscale IP - no need to make every agent look it up.
+	if device.TailscaleIP == "" {
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			device.TailscaleIP = host
+		}
+	}
+
+	// WHY new devices start disabled with require_registered_devices:
+	// Every agent holds the shared token, so registering proves nothing
+	// about a device; the operator admits each new one with `hub admit`.
+	if err := s.storage.InsertDevice(&device, !s.cfg.RequireRegisteredDevices); err != nil {
+		serverLog.Errorf("registering device: %v", err)
 		http.Error(w, "failed to register device", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
+	response := map[string]string{
 		"status":  "registered",
 		"message": fmt.Sprintf("device %s registered", device.DeviceID),
-	})
+	}
+	if s.cfg.RequireRegisteredDevices {
+		if stored, err := s.storage.GetDevice(device.DeviceID); err == nil && stored != nil && !stored.Enabled {
+			serverLog.Warnf("Device %s is registered but disabled; admit it with `hub admit -device %s`", device.DeviceID, device.DeviceID)
+			response["message"] += "; it can't connect until the hub's operator admits it"
+		}
+	}
+	// WHY only on request, and only with the hub's token: An agent that
+	// doesn't save the token would leave its device with one nobody holds.
+	// A device token or guest pass must not mint more tokens.
+	if r.URL.Query().Get("issue_token") == "true" {
+		if !who.isHubToken() {
+			http.Error(w, "device tokens are issued only to requests with the hub's token", http.StatusForbidden)
+			return
+		}
+		token, err := s.issueDeviceToken(device.DeviceID)
+		if err != nil {
+			serverLog.Errorf("issuing device token: %v", err)
+			http.Error(w, "failed to issue device token", http.StatusInternalServerError)
+			return
+		}
+		if token == "" {
+			response["message"] += "; it already has a device token (revoke it to issue a new one)"
+		} else {
+			response["device_token"] = token
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// devicePreferencesRequest is the body accepted by handleDevicePreferences.
+// WHY pointer fields: Distinguishes "leave unchanged" (omitted) from an
+// explicit false, so new preferences can be added without clobbering others.
+type devicePreferencesRequest struct {
+	DeviceID     string `json:"device_id"`
+	Notify       *bool  `json:"notify"`
+	StoreHistory *bool  `json:"store_history"`
+}
+
+// handleDevicePreferences updates hub-side preferences for a registered device.
+// WHY this endpoint exists: Whether a clip should trigger a notification
+// depends on where it came from (your own laptop vs. a shared family PC).
+// Storing that per source device on the hub lets every receiving agent honor
+// it without each one carrying its own copy of the rules.
+func (s *Server) handleDevicePreferences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req devicePreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if req.DeviceID == "" {
+		http.Error(w, "device_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Notify != nil {
+		found, err := s.storage.SetDeviceNotify(req.DeviceID, *req.Notify)
+		if err != nil {
+			serverLog.Errorf("updating device preferences: %v", err)
+			http.Error(w, "failed to update preferences", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "device not registered", http.StatusNotFound)
+			return
+		}
+		serverLog.Infof("Device %s notify preference set to %t", req.DeviceID, *req.Notify)
+	}
+
+	if req.StoreHistory != nil {
+		found, err := s.storage.SetDeviceStoreHistory(req.DeviceID, *req.StoreHistory)
+		if err != nil {
+			serverLog.Errorf("updating device preferences: %v", err)
+			http.Error(w, "failed to update preferences", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "device not registered", http.StatusNotFound)
+			return
+		}
+		serverLog.Infof("Device %s store_history preference set to %t", req.DeviceID, *req.StoreHistory)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// deviceMergeRequest is the body accepted by handleDeviceMerge.
+type deviceMergeRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// handleDeviceMerge folds a duplicate device record into another one.
+// WHY an endpoint: Lets a dashboard or script clean up after an agent
+// reinstall without shell access to the hub (see `hub merge-devices`).
+func (s *Server) handleDeviceMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !auth.Authenticate(r, s.authToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req deviceMergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if req.From == "" || req.To == "" || req.From == req.To {
+		http.Error(w, "from and to must be two different device IDs", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.storage.MergeDevices(req.From, req.To)
+	if errors.Is(err, ErrDeviceNotFound) {
+		http.Error(w, "device not registered", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverLog.Errorf("merging device %s into %s: %v", req.From, req.To, err)
+		http.Error(w, "failed to merge devices", http.StatusInternalServerError)
+		return
+	}
+	serverLog.Infof("Merged device %s into %s (%d events, %d sealed or signed kept)", req.From, req.To, result.Events, result.Kept)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
 
 // --- WebSocket ---------------------------------------------------------------
 
+// checkRegistered verifies, when require_registered_devices is on, that
+// deviceID is registered and enabled. It returns 0 when the connection may
+// proceed, or an HTTP status and message.
+// WHY 403 rather than 401: The token was fine; the device is what's
+// refused, and the message says how to fix it.
+func (s *Server) checkRegistered(deviceID string) (int, string) {
+	if !s.cfg.RequireRegisteredDevices {
+		return 0, ""
+	}
+	device, err := s.storage.GetDevice(deviceID)
+	if err != nil {
+		serverLog.Errorf("looking up device %s: %v", deviceID, err)
+		return http.StatusInternalServerError, "failed to look up device"
+	}
+	if device == nil {
+		serverLog.Warnf("refused WebSocket for unregistered device %s", deviceID)
+		return http.StatusForbidden, fmt.Sprintf("device %s is not registered; register it before connecting", deviceID)
+	}
+	if !device.Enabled {
+		serverLog.Warnf("refused WebSocket for disabled device %s", deviceID)
+		return http.StatusForbidden, fmt.Sprintf("device %s is disabled; the hub's operator admits it with `hub admit -device %s`", deviceID, deviceID)
+	}
+	return 0, ""
+}
+
 // upgrader configures the WebSocket upgrade handshake.
 // WHY CheckOrigin returns true: TailClip runs on a private Tailscale network,
 // not the public internet. Strict origin checking would block legitimate agent
@@ -227,6 +1675,34 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// subscribedChannels returns the comma-separated `channels` query parameter
+// of a WebSocket upgrade request.
+// WHY default to the default channel: Agents from before channels existed
+// send no list and keep receiving exactly what they did before.
+func subscribedChannels(r *http.Request) []string {
+	var channels []string
+	for _, channel := range strings.Split(r.URL.Query().Get("channels"), ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			channels = append(channels, channel)
+		}
+	}
+	if len(channels) == 0 {
+		return []string{models.DefaultChannel}
+	}
+	return channels
+}
+
+// hasFeature reports whether the comma-separated `features` query parameter
+// of a WebSocket upgrade request includes name.
+func hasFeature(r *http.Request, name string) bool {
+	for _, feature := range strings.Split(r.URL.Query().Get("features"), ",") {
+		if strings.TrimSpace(feature) == name {
+			return true
+		}
+	}
+	return false
+}
+
 // handleWebSocket upgrades an HTTP connection to WebSocket for real-time
 // clipboard event delivery.
 //
@@ -242,7 +1718,8 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Authenticate using query parameter.
 	// WHY query param here: WebSocket clients can't set custom headers during
 	// the upgrade handshake, so we fall back to ?token= for auth.
-	if !auth.Authenticate(r, s.authToken) {
+	who, ok := s.authenticate(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -251,39 +1728,120 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// WHY required: The broadcaster needs the device ID to register the
 	// connection and skip the source device during broadcast.
 	deviceID := r.URL.Query().Get("device_id")
-	if deviceID == "" {
-		http.Error(w, "device_id query parameter required", http.StatusBadRequest)
+	if err := models.ValidateDeviceID(deviceID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if refuseOtherDevice(w, who, deviceID) {
+		return
+	}
+
+	// WHY refuse incompatible agents outright: A half-understood stream
+	// (e.g., events whose fields changed meaning) fails in confusing ways
+	// later. A clear refusal at connect time names the actual problem.
+	// Agents that predate versioning send no `wire` and speak version 1.
+	if raw := r.URL.Query().Get("wire"); raw != "" {
+		version, err := strconv.Atoi(raw)
+		if err != nil || !wire.Compatible(version) {
+			http.Error(w, fmt.Sprintf("unsupported wire version %q (hub supports %d-%d)",
+				raw, wire.MinVersion, wire.Version), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// WHY before upgrading: A refused device gets a plain HTTP error the
+	// agent can log, rather than a socket that closes immediately.
+	if status, msg := s.checkRegistered(deviceID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	if status, msg := s.checkNodeBinding(r, deviceID); status != 0 {
+		http.Error(w, msg, status)
 		return
 	}
 
 	// Upgrade HTTP connection to WebSocket.
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("ERROR: WebSocket upgrade failed for device %s: %v", deviceID, err)
+		serverLog.Errorf("WebSocket upgrade failed for device %s: %v", deviceID, err)
 		return
 	}
 
 	// Register the WebSocket connection with the broadcaster.
-	s.broadcaster.AddClient(deviceID, conn)
-	log.Printf("WebSocket connected: device=%s", deviceID)
+	// WHY read features from the query: Like device_id, it's the only way to
+	// pass options on the upgrade request (see the auth note above).
+	client := &wsClient{
+		conn:       conn,
+		channels:   subscribedChannels(r),
+		presence:   hasFeature(r, models.WebSocketFeaturePresence),
+		alerts:     hasFeature(r, models.WebSocketFeatureAlerts),
+		files:      hasFeature(r, models.WebSocketFeatureFiles),
+		encrypted:  hasFeature(r, models.WebSocketFeatureEncrypted),
+		blobs:      hasFeature(r, models.WebSocketFeatureBlobs),
+		chunks:     hasFeature(r, models.WebSocketFeatureChunks),
+		compressed: hasFeature(r, models.WebSocketFeatureCompressed),
+		deletions:  hasFeature(r, models.WebSocketFeatureDeletions),
+		pins:       hasFeature(r, models.WebSocketFeaturePins),
+		resume:     hasFeature(r, models.WebSocketFeatureResume),
+		guest:      who.guest != nil,
+	}
+	// WHY only with the hub's token: A snapshot is a piece of history, which
+	// device tokens and guests may not read.
+	if hasFeature(r, models.WebSocketFeatureSnapshot) && who.isHubToken() {
+		limit := snapshotLimit(r)
+		client.snapshot = func() ([]models.Event, error) {
+			events, err := s.storage.GetRecentEvents(limit)
+			return s.blobs.withURLs(events), err
+		}
+	}
+	if client.resume {
+		client.resumeToken = r.URL.Query().Get("resume")
+		// WHY ignore a malformed last_seq: It only narrows the replay; the
+		// session's own record is used instead.
+		client.resumeSeq, _ = strconv.ParseUint(r.URL.Query().Get("last_seq"), 10, 64)
+	}
+	conflict, err := s.broadcaster.AddClient(deviceID, client)
+	if conflict != nil {
+		if err := s.storage.InsertDeviceConflict(conflict); err != nil {
+			serverLog.Errorf("recording device conflict: %v", err)
+		}
+	}
+	if err != nil {
+		// WHY a close frame with a reason: The agent logs it, so the user
+		// sees why this machine can't connect instead of a bare disconnect.
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()))
+		conn.Close()
+		return
+	}
+	serverLog.Infof("WebSocket connected: device=%s", deviceID)
 
 	// Read loop - keeps the connection alive and detects disconnection.
 	// WHY a read loop: WebSocket connections require active reading to detect
 	// when the remote end disconnects. Without this, the broadcaster would
-	// keep trying to write to a dead connection. We don't expect meaningful
-	// messages from agents (they push via HTTP), so we just discard reads.
+	// keep trying to write to a dead connection. Agents push clips via HTTP;
+	// the only messages they send here are latency reports.
 	defer func() {
-		s.broadcaster.RemoveClient(deviceID)
-		log.Printf("WebSocket disconnected: device=%s", deviceID)
+		s.broadcaster.RemoveClient(deviceID, conn)
+		serverLog.Infof("WebSocket disconnected: device=%s", deviceID)
 	}()
 
 	for {
-		_, _, err := conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
 			// WHY break on error: Any read error (clean close, network drop,
 			// etc.) means the connection is done. The deferred RemoveClient
 			// will clean up.
 			break
 		}
+
+		// WHY ignore unknown or malformed messages: Newer agents may send
+		// message types this hub doesn't know; that must not drop them.
+		msg, err := wire.Unmarshal(message)
+		if err != nil || msg.Latency == nil {
+			continue
+		}
+		s.latency.Add(*msg.Latency)
 	}
 }
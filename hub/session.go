@@ -0,0 +1,129 @@
+// Author: Toluwalase Mebaanne
+// Package main provides resumable WebSocket sessions for the TailClip hub.
+//
+// WHY resume instead of re-reading history:
+// A laptop that sleeps keeps its WebSocket "open" until TCP notices, and every
+// broadcast in between goes nowhere. On reconnect the agent presents the
+// token of its last session, and the hub replays just the broadcasts that
+// session missed - including ones that were never stored (transient clips,
+// devices opted out of history) and with the same routing as the original
+// delivery, neither of which a history query could reproduce.
+//
+// Sessions and the replay buffer live in memory. After a hub restart every
+// token is unknown, agents start new sessions, and missed clips are only in
+// history - the same as before sessions existed.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/tmair/tailclip/shared/models"
+	"github.com/tmair/tailclip/shared/wire"
+)
+
+// replayBufferSize is how many recent broadcasts the hub keeps for replay.
+// WHY 100: Far more than anyone copies during a laptop nap, and small
+// enough (at most 100 clips) to never matter for memory.
+const replayBufferSize = 100
+
+// wsSession is a device's resumable WebSocket session.
+// WHY one per device: A device only ever resumes its latest connection, so
+// older sessions are replaced instead of accumulating.
+type wsSession struct {
+	token string
+	// lastSeq is the sequence number of the last broadcast written to the
+	// session's connection.
+	lastSeq uint64
+}
+
+// remember adds a broadcast to the replay buffer. Caller must hold b.mu.
+func (b *Broadcaster) remember(event *models.Event) {
+	b.recent = append(b.recent, *event)
+	if len(b.recent) > replayBufferSize {
+		// WHY copy instead of reslicing: Reslicing keeps the dropped events'
+		// clip text reachable through the backing array.
+		b.recent = append(b.recent[:0], b.recent[len(b.recent)-replayBufferSize:]...)
+	}
+}
+
+// startSession resumes the session the client presented or starts a new one,
+// and sends the client a Session message followed by any replayed events.
+// Caller must hold b.mu.
+func (b *Broadcaster) startSession(deviceID string, client *wsClient) {
+	session, ok := b.sessions[deviceID]
+	resumed := ok && client.resumeToken != "" && client.resumeToken == session.token
+	if !resumed {
+		session = &wsSession{token: newSessionToken(), lastSeq: b.seq}
+		b.sessions[deviceID] = session
+	}
+	client.session = session
+
+	var missed []models.Event
+	gap := false
+	if resumed {
+		// WHY prefer the agent's sequence when it is lower: A write to a
+		// sleeping laptop's socket can "succeed" into a buffer that is
+		// never read. The agent knows what actually arrived.
+		since := session.lastSeq
+		if client.resumeSeq > 0 && client.resumeSeq < since {
+			since = client.resumeSeq
+		}
+		missed, gap = b.missedEvents(deviceID, client, since)
+	}
+
+	msg := &models.Session{Token: session.token, Resumed: resumed, Replayed: len(missed), Gap: gap}
+	if err := writeMessage(client.conn, &wire.Message{Session: msg}); err != nil {
+		broadcastLog.Errorf("sending session to %s: %v", deviceID, err)
+		return
+	}
+	if !resumed {
+		return
+	}
+	broadcastLog.Infof("Resumed session for device %s: replaying %d event(s)", deviceID, len(missed))
+	if gap {
+		broadcastLog.Warnf("device %s missed more events than the hub buffers; the rest are only in history", deviceID)
+	}
+
+	for i := range missed {
+		event := &missed[i]
+		event.Replayed = true
+		// WHY only the last one may notify: Every missed clip is written so
+		// clipboard managers see them all, but one notification per replayed
+		// clip after waking would be a burst of noise.
+		event.Silent = event.Silent || i < len(missed)-1
+		if err := writeEvent(client, newEncodedEvent(event, b.compressThreshold, b.blobs)); err != nil {
+			broadcastLog.Errorf("replaying to %s: %v", deviceID, err)
+			return
+		}
+		session.lastSeq = event.Seq
+	}
+}
+
+// missedEvents returns the buffered broadcasts after since that would have
+// been delivered to the client, oldest first. gap reports that broadcasts
+// after since were already dropped from the buffer. Caller must hold b.mu.
+func (b *Broadcaster) missedEvents(deviceID string, client *wsClient, since uint64) ([]models.Event, bool) {
+	gap := len(b.recent) > 0 && b.recent[0].Seq > since+1
+	var missed []models.Event
+	for _, event := range b.recent {
+		if event.Seq <= since || event.SourceDeviceID == deviceID {
+			continue
+		}
+		if !deliverTo(matchRoute(b.rules, &event), &event, deviceID, client.channels) || !client.accepts(&event) {
+			continue
+		}
+		missed = append(missed, event)
+	}
+	return missed, gap
+}
+
+// newSessionToken returns a random, unguessable session token.
+// WHY unguessable: The token is what lets a connection claim a device's
+// missed clips, so it must not be derivable from the device ID.
+func newSessionToken() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,68 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the `hub shred` maintenance command.
+//
+// WHY shred keys instead of deleting rows:
+// Deleted SQLite rows linger in free pages, the WAL, SSD blocks the
+// filesystem no longer points at, and backups. End-to-end encrypted clips
+// are sealed with per-day data keys (see models.DataKey), so destroying a
+// few dozen bytes of key makes a whole day of history unreadable wherever
+// copies of it survive - even to someone who holds the shared key.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// runShred implements `hub shred [-before YYYY-MM-DD] [-delete] [config-path]`.
+// WHY report-only by default: Same as `hub retention` - shredding can't be
+// undone, which is the whole point.
+func runShred(args []string) error {
+	fs := newCommandFlags("shred")
+	before := fs.String("before", "", "shred the keys of days before this date, YYYY-MM-DD in UTC (default: all days, including today)")
+	shred := fs.Bool("delete", false, "permanently destroy the keys and delete the events sealed with them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	beforeID := models.DataKeyID(time.Now().AddDate(0, 0, 1))
+	if *before != "" {
+		if err := models.ValidateKeyDay(*before); err != nil {
+			return fmt.Errorf("-before: %w", err)
+		}
+		beforeID = *before
+	}
+
+	_, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	plan, err := storage.PlanShred(beforeID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Would shred %d data key(s) for days before %s, making %d encrypted event(s) unreadable\n",
+		plan.Keys, beforeID, plan.Events)
+
+	if !*shred || plan.Keys+plan.Events == 0 {
+		if plan.Keys+plan.Events > 0 {
+			fmt.Printf("Re-run with -delete to shred them.\n")
+		}
+		return nil
+	}
+
+	result, err := storage.ShredDataKeys(beforeID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Shredded %d data key(s) and deleted %d event(s)\n", result.Keys, result.Events)
+	// WHY say so: Agents keep keys they fetched in memory for a while (see
+	// dataKeyCacheTTL in the agent).
+	fmt.Printf("Running agents forget cached keys within 10 minutes.\n")
+	return nil
+}
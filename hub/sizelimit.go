@@ -0,0 +1,60 @@
+// Author: Toluwalase Mebaanne
+// Package main provides per-device and per-channel clip size limits for the
+// TailClip hub.
+//
+// WHY limits below max_text_length and max_file_size:
+// The global limits protect the hub. A deployment mixing a phone on a
+// metered link with desktops needs more: the channel the phone subscribes
+// to capped at 64 KB while desktops still trade 5 MB screenshots. Without
+// it, one large clip pushed to the wrong channel costs every small device
+// the transfer.
+//
+// WHY at push time instead of skipping large clips per receiver:
+// Refusing the push tells the sender why (a 413 naming the limit) and keeps
+// history consistent with what was delivered. A clip silently withheld from
+// some subscribers looks like a sync bug.
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/tmair/tailclip/shared/config"
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// clipSize returns the size size_limits measure for event, given the length
+// of its text: a file's size, or text plus rich text formats.
+// WHY a separate text length: Chunked uploads are checked against their
+// announced size, before the text arrives.
+// WHY a file's decoded size: Limits are written as file sizes ("5 MB"),
+// not as the base64 the file travels in.
+func clipSize(event *models.Event, textLength int) int {
+	if event.ContentType == models.ContentTypeFile && !event.Encrypted {
+		return base64.StdEncoding.DecodedLen(textLength)
+	}
+	size := textLength
+	for _, content := range event.Formats {
+		size += len(content)
+	}
+	return size
+}
+
+// checkSizeLimits returns an error naming the first limit in limits that
+// applies to event and that a clip of size bytes exceeds, or nil.
+func checkSizeLimits(limits []config.SizeLimit, event *models.Event, size int) error {
+	channel := event.Channel
+	if channel == "" {
+		channel = models.DefaultChannel
+	}
+	for _, limit := range limits {
+		if !matchesAny(limit.SourceDevices, event.SourceDeviceID) || !matchesAny(limit.Channels, channel) {
+			continue
+		}
+		if size > limit.MaxBytes {
+			return fmt.Errorf("clip of %d bytes exceeds size limit %q of %d bytes", size, limit.Name, limit.MaxBytes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the initial snapshot for WebSocket observers.
+//
+// WHY a snapshot on the socket instead of a history request first:
+// A dashboard could fetch /api/v1/history and then connect, but a clip
+// copied between the two is in neither. Sent as the first message, under
+// the same lock that puts the client live, the snapshot is followed by
+// exactly the broadcasts after it. A clip being stored at that moment may
+// appear in both; observers key events by ID.
+
+package main
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/tmair/tailclip/shared/models"
+	"github.com/tmair/tailclip/shared/wire"
+)
+
+// Sizes of a snapshot.
+// WHY a smaller maximum than history pages: The snapshot holds the
+// broadcaster's lock while it is read and written, which delays every
+// other client's clips.
+const (
+	defaultSnapshotLimit = 20
+	maxSnapshotLimit     = 100
+)
+
+// snapshotLimit returns the `snapshot_limit` query parameter of a WebSocket
+// upgrade request, clamped to maxSnapshotLimit, or the default.
+func snapshotLimit(r *http.Request) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("snapshot_limit"))
+	if err != nil || limit <= 0 {
+		return defaultSnapshotLimit
+	}
+	return min(limit, maxSnapshotLimit)
+}
+
+// sendSnapshot writes the client's Snapshot: the latest stored events it
+// would have been sent, and the connected devices. Caller must hold b.mu.
+// WHY filter like a broadcast: A client subscribed to "work" must not see
+// "personal" clips just because they are recent, nor an old agent a file.
+func (b *Broadcaster) sendSnapshot(deviceID string, client *wsClient) {
+	stored, err := client.snapshot()
+	if err != nil {
+		broadcastLog.Errorf("loading snapshot for %s: %v", deviceID, err)
+	}
+
+	snapshot := &models.Snapshot{
+		Events:  []models.Event{},
+		Devices: slices.Sorted(maps.Keys(b.connections)),
+	}
+	for i := range stored {
+		event := &stored[i]
+		if deliverTo(matchRoute(b.rules, event), event, deviceID, client.channels) && client.accepts(event) {
+			snapshot.Events = append(snapshot.Events, *event)
+		}
+	}
+
+	data, err := wire.Marshal(&wire.Message{Snapshot: snapshot})
+	if err == nil {
+		err = writeChunked(client, models.MessageTypeSnapshot, data)
+	}
+	if err != nil {
+		broadcastLog.Errorf("sending snapshot to %s: %v", deviceID, err)
+	}
+}
@@ -0,0 +1,98 @@
+// Author: Toluwalase Mebaanne
+// Package main provides in-memory sync and retention statistics for the
+// TailClip hub.
+//
+// WHY in memory instead of SQLite:
+// Latency is an operational signal ("is sync sub-second right now?"), not
+// history. A bounded window of recent samples answers that question, costs
+// nothing on the push path, and resets cleanly with the process.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// latencyWindow is how many recent reports percentiles are computed over.
+// WHY 1000: Enough for stable p99 values; small enough to sort on request.
+const latencyWindow = 1000
+
+// LatencyRecorder keeps the most recent latency reports in a ring buffer.
+type LatencyRecorder struct {
+	mu      sync.Mutex
+	reports []models.LatencyReport
+	next    int // ring position of the next write once full
+}
+
+// NewLatencyRecorder creates an empty recorder.
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{
+		reports: make([]models.LatencyReport, 0, latencyWindow),
+	}
+}
+
+// Add records one report, overwriting the oldest once the window is full.
+func (l *LatencyRecorder) Add(report models.LatencyReport) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.reports) < latencyWindow {
+		l.reports = append(l.reports, report)
+		return
+	}
+	l.reports[l.next] = report
+	l.next = (l.next + 1) % latencyWindow
+}
+
+// Stats computes percentiles over the current window.
+func (l *LatencyRecorder) Stats() models.LatencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	leg := func(value func(models.LatencyReport) int64) models.Percentiles {
+		values := make([]int64, len(l.reports))
+		for i, r := range l.reports {
+			values[i] = value(r)
+		}
+		return models.NewPercentiles(values)
+	}
+
+	return models.LatencyStats{
+		Samples:    len(l.reports),
+		UploadMs:   leg(func(r models.LatencyReport) int64 { return r.UploadMs }),
+		HubMs:      leg(func(r models.LatencyReport) int64 { return r.HubMs }),
+		DeliveryMs: leg(func(r models.LatencyReport) int64 { return r.DeliveryMs }),
+		TotalMs:    leg(func(r models.LatencyReport) int64 { return r.TotalMs }),
+	}
+}
+
+// RetentionRecorder counts what the retention job deleted.
+type RetentionRecorder struct {
+	mu    sync.Mutex
+	stats models.RetentionStats
+}
+
+// Add records one run of the retention job.
+func (r *RetentionRecorder) Add(at time.Time, pruned int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stats.Runs++
+	r.stats.LastRunAt = at.UTC()
+	r.stats.LastPruned = pruned
+	r.stats.Pruned += pruned
+	r.stats.LastError = ""
+	if err != nil {
+		r.stats.LastError = err.Error()
+	}
+}
+
+// Stats returns the counts so far.
+func (r *RetentionRecorder) Stats() models.RetentionStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
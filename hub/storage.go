@@ -17,8 +17,14 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	// WHY blank import: go-sqlite3 registers itself as a database/sql driver
@@ -35,6 +41,17 @@ import (
 // API for the rest of the hub. Makes testing easier (can mock or use in-memory DB).
 type Storage struct {
 	db *sql.DB
+
+	// history caches hot history pages (see cache.go). Every method that
+	// writes to events invalidates it.
+	history *historyCache
+
+	// metrics times queries for /metrics; nil outside a running server.
+	metrics *Metrics
+
+	// chain records writes to events in integrity_chain (see integrity.go);
+	// nil without integrity_key.
+	chain *integrityChain
 }
 
 // NewStorage initializes the SQLite database and creates tables if they don't exist.
@@ -57,9 +74,12 @@ func NewStorage(dbPath string) (*Storage, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	s := &Storage{db: db}
+	s := &Storage{db: db, history: newHistoryCache()}
 
 	if err := s.CreateTables(); err != nil {
+		// WHY close: The caller may move a corrupted file aside next, which
+		// fails on Windows while it is still open.
+		db.Close()
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
@@ -118,6 +138,132 @@ func (s *Storage) CreateTables() error {
 		return fmt.Errorf("failed to create devices table: %w", err)
 	}
 
+	return s.migrate()
+}
+
+// schemaMigrations lists incremental schema changes applied on top of the
+// base tables, in order. The database's PRAGMA user_version records how many
+// have already run.
+// WHY append-only migrations instead of editing CREATE TABLE:
+// CREATE TABLE IF NOT EXISTS never alters a table that already exists, so
+// hubs upgraded in place would silently miss new columns. Each entry here
+// runs exactly once per database. NEVER reorder or edit existing entries -
+// only append new ones.
+var schemaMigrations = []string{
+	// 1: per-device notification preference carried as a broadcast hint
+	`ALTER TABLE devices ADD COLUMN notify BOOLEAN NOT NULL DEFAULT 1`,
+	// 2: metadata-only "lost+found" for events the hub refused
+	`CREATE TABLE rejected_events (
+		id               INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id         TEXT NOT NULL DEFAULT '',
+		source_device_id TEXT NOT NULL DEFAULT '',
+		content_type     TEXT NOT NULL DEFAULT '',
+		size             INTEGER NOT NULL DEFAULT 0,
+		reason           TEXT NOT NULL,
+		rejected_at      DATETIME NOT NULL
+	);
+	CREATE INDEX idx_rejected_at ON rejected_events(rejected_at);`,
+	// 3: channel each event was pushed to; existing history is "default"
+	`ALTER TABLE events ADD COLUMN channel TEXT NOT NULL DEFAULT 'default'`,
+	// 4: two machines connecting with the same device ID
+	`CREATE TABLE device_conflicts (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id     TEXT NOT NULL,
+		existing_addr TEXT NOT NULL DEFAULT '',
+		new_addr      TEXT NOT NULL DEFAULT '',
+		action        TEXT NOT NULL,
+		detected_at   DATETIME NOT NULL
+	);`,
+	// 5: Tailscale node a device is bound to (tailnet_identity mode)
+	`ALTER TABLE devices ADD COLUMN node_id TEXT NOT NULL DEFAULT ''`,
+	// 6: user annotation on a history event
+	`ALTER TABLE events ADD COLUMN note TEXT NOT NULL DEFAULT ''`,
+	// 7: per-device opt-out of hub history (clips broadcast but not stored)
+	`ALTER TABLE devices ADD COLUMN store_history BOOLEAN NOT NULL DEFAULT 1`,
+	// 8: name of the file carried by a file event
+	`ALTER TABLE events ADD COLUMN file_name TEXT NOT NULL DEFAULT ''`,
+	// 9: rich text formats of a text event, as a JSON object
+	`ALTER TABLE events ADD COLUMN formats TEXT NOT NULL DEFAULT ''`,
+	// 10: end-to-end encrypted events, whose text is ciphertext
+	`ALTER TABLE events ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT 0`,
+	// 11: per-day data keys of encrypted events, wrapped by the agents
+	`CREATE TABLE data_keys (
+		key_id     TEXT PRIMARY KEY,
+		wrapped    TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);`,
+	// 12: data key an encrypted event is sealed with
+	`ALTER TABLE events ADD COLUMN key_id TEXT NOT NULL DEFAULT ''`,
+	// 13: federated hub an event was relayed from
+	`ALTER TABLE events ADD COLUMN origin_hub TEXT NOT NULL DEFAULT ''`,
+	// 14: time-limited passes for guest devices
+	`CREATE TABLE guest_passes (
+		device_id  TEXT PRIMARY KEY,
+		name       TEXT NOT NULL DEFAULT '',
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);`,
+	// 15: events pushed on a guest pass
+	`ALTER TABLE events ADD COLUMN guest BOOLEAN NOT NULL DEFAULT 0`,
+	// 16: events kept regardless of the retention policy
+	`ALTER TABLE events ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT 0`,
+	// 17: hash of the device's own auth token; empty until one is issued
+	`ALTER TABLE devices ADD COLUMN token_hash TEXT NOT NULL DEFAULT '';
+	CREATE UNIQUE INDEX idx_devices_token_hash ON devices(token_hash) WHERE token_hash != '';`,
+	// 18: devices an event is pinned for, as a JSON array; empty for none
+	`ALTER TABLE events ADD COLUMN pinned_for TEXT NOT NULL DEFAULT ''`,
+	// 19: the source device's signature over an event, and its key
+	`ALTER TABLE events ADD COLUMN signature TEXT NOT NULL DEFAULT '';
+	ALTER TABLE events ADD COLUMN signing_key TEXT NOT NULL DEFAULT '';`,
+	// 20: the key a device signs its events with; empty if it doesn't
+	`ALTER TABLE devices ADD COLUMN signing_key TEXT NOT NULL DEFAULT ''`,
+	// 21: HMAC chain over writes to events (see integrity.go)
+	`CREATE TABLE integrity_chain (
+		seq      INTEGER PRIMARY KEY,
+		action   TEXT NOT NULL,
+		event_id TEXT NOT NULL,
+		digest   TEXT NOT NULL,
+		mac      TEXT NOT NULL
+	);`,
+	// 22: object holding a file event's text in the blob store (see
+	// blobs.go), and the objects of deleted events, for the store to delete
+	`ALTER TABLE events ADD COLUMN blob TEXT NOT NULL DEFAULT '';
+	CREATE TABLE blob_trash (name TEXT PRIMARY KEY);
+	CREATE TRIGGER events_blob_trash AFTER DELETE ON events WHEN old.blob != ''
+	BEGIN
+		INSERT OR IGNORE INTO blob_trash (name) VALUES (old.blob);
+	END;`,
+}
+
+// migrate applies any schemaMigrations the database hasn't seen yet.
+// WHY one transaction per migration: A failure midway leaves the database
+// at the last fully applied version, so the next startup resumes cleanly.
+func (s *Storage) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := version; i < len(schemaMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(schemaMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+		// WHY Sprintf: PRAGMA statements don't accept bound parameters.
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+	}
+
 	return nil
 }
 
@@ -126,34 +272,93 @@ func (s *Storage) CreateTables() error {
 // (e.g., due to agent retry after a network timeout), silently skip it.
 // This makes event submission idempotent and safe for unreliable networks.
 func (s *Storage) InsertEvent(event *models.Event) error {
+	defer s.metrics.observeDB("insert_event", time.Now())
 	query := `
-	INSERT OR IGNORE INTO events (event_id, source_device_id, timestamp, content_type, text, text_hash)
-	VALUES (?, ?, ?, ?, ?, ?)
+	INSERT OR IGNORE INTO events (event_id, source_device_id, timestamp, content_type, text, text_hash, channel, file_name, formats, encrypted, key_id, origin_hub, guest, signature, signing_key, blob)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
+	// WHY not the text of an offloaded event: It is in the blob store (see
+	// BlobStore.Offload); the event only still carries it for the broadcast.
+	text := event.Text
+	if event.BlobKey != "" {
+		text = ""
+	}
 
-	_, err := s.db.Exec(query,
+	formats, err := encodeFormats(event.Formats)
+	if err != nil {
+		return err
+	}
+
+	// WHY a transaction: The chain entry must commit with the row or not at
+	// all.
+	s.chain.lock()
+	defer s.chain.unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin insert: %w", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(query,
 		event.EventID,
 		event.SourceDeviceID,
 		event.Timestamp.UTC().Format(time.RFC3339),
 		event.ContentType,
-		event.Text,
+		text,
 		event.TextHash,
+		event.Channel,
+		event.FileName,
+		formats,
+		event.Encrypted,
+		event.KeyID,
+		event.OriginHub,
+		event.Guest,
+		event.Signature,
+		event.SigningKey,
+		event.BlobKey,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert event: %w", err)
 	}
+	// WHY only when a row was added: An ignored retry changed nothing.
+	if inserted, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to read affected rows: %w", err)
+	} else if inserted > 0 {
+		if err := s.chain.record(tx, chainInsert, []string{event.EventID}); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit event: %w", err)
+	}
+	s.history.invalidate()
 
 	return nil
 }
 
 // InsertDevice registers a new device or updates an existing one.
-// WHY UPSERT (INSERT OR REPLACE): Devices re-register on startup, and their
+// WHY UPSERT (ON CONFLICT DO UPDATE): Devices re-register on startup, and their
 // Tailscale IP or name may change. Upsert handles both first registration
 // and subsequent updates cleanly without requiring separate insert/update logic.
-func (s *Storage) InsertDevice(device *models.Device) error {
+// WHY not INSERT OR REPLACE: REPLACE deletes the old row first, which would
+// reset hub-side preferences (e.g., notify) every time the agent restarts.
+// Only the fields the agent actually reports are overwritten here.
+// WHY enabled is never taken from the request: It's an administrative switch.
+// New devices start enabled unless the caller says otherwise (see
+// require_registered_devices), and a disabled device must not be able to
+// re-enable itself by re-registering.
+// WHY the signing key only fills an empty one: Like a device token, the
+// first key sticks, so re-registering can't swap in someone else's (see
+// ClearDeviceSigningKey).
+func (s *Storage) InsertDevice(device *models.Device, enabled bool) error {
+	defer s.metrics.observeDB("insert_device", time.Now())
 	query := `
-	INSERT OR REPLACE INTO devices (device_id, device_name, tailscale_ip, last_seen_utc, enabled)
-	VALUES (?, ?, ?, ?, ?)
+	INSERT INTO devices (device_id, device_name, tailscale_ip, last_seen_utc, signing_key, enabled)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(device_id) DO UPDATE SET
+		device_name   = excluded.device_name,
+		tailscale_ip  = excluded.tailscale_ip,
+		last_seen_utc = excluded.last_seen_utc,
+		signing_key   = CASE WHEN signing_key = '' THEN excluded.signing_key ELSE signing_key END
 	`
 
 	_, err := s.db.Exec(query,
@@ -161,7 +366,8 @@ func (s *Storage) InsertDevice(device *models.Device) error {
 		device.DeviceName,
 		device.TailscaleIP,
 		device.LastSeenUTC.UTC().Format(time.RFC3339),
-		device.Enabled,
+		device.SigningKey,
+		enabled,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert device: %w", err)
@@ -170,49 +376,565 @@ func (s *Storage) InsertDevice(device *models.Device) error {
 	return nil
 }
 
-// GetRecentEvents retrieves the most recent clipboard events, ordered newest first.
-// WHY limit parameter: Callers control how much history they need. Agents syncing
-// for the first time may want more history, while routine polls only need the latest.
-// WHY ORDER BY timestamp DESC: Most recent events are most relevant for clipboard sync.
-// Agents typically only care about what happened since their last poll.
-func (s *Storage) GetRecentEvents(limit int) ([]models.Event, error) {
+// deviceColumns is the column list shared by every device query.
+// WHY: Same as eventColumns - keeps SELECT statements and scanDevice in
+// lockstep.
+const deviceColumns = `device_id, device_name, tailscale_ip, last_seen_utc, enabled, notify, store_history, node_id, signing_key, token_hash != ''`
+
+// scanDevice reads one device row selected with deviceColumns.
+func scanDevice(row rowScanner) (models.Device, error) {
+	var device models.Device
+	var lastSeen string
+
+	if err := row.Scan(
+		&device.DeviceID,
+		&device.DeviceName,
+		&device.TailscaleIP,
+		&lastSeen,
+		&device.Enabled,
+		&device.Notify,
+		&device.StoreHistory,
+		&device.NodeID,
+		&device.SigningKey,
+		&device.HasToken,
+	); err != nil {
+		return device, err
+	}
+
+	var err error
+	device.LastSeenUTC, err = time.Parse(time.RFC3339, lastSeen)
+	if err != nil {
+		return device, fmt.Errorf("failed to parse device last_seen_utc: %w", err)
+	}
+	return device, nil
+}
+
+// GetDevice looks up a single registered device by ID.
+// WHY return (nil, nil) when missing: An unknown device is a normal condition
+// (e.g., an agent that pushes before registering), not a storage failure.
+// Callers decide whether absence matters for their use case.
+func (s *Storage) GetDevice(deviceID string) (*models.Device, error) {
+	defer s.metrics.observeDB("get_device", time.Now())
+	row := s.db.QueryRow(`SELECT `+deviceColumns+` FROM devices WHERE device_id = ?`, deviceID)
+	device, err := scanDevice(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device: %w", err)
+	}
+
+	return &device, nil
+}
+
+// ListDevices returns every registered device, ordered by name.
+func (s *Storage) ListDevices() ([]models.Device, error) {
+	defer s.metrics.observeDB("list_devices", time.Now())
+	rows, err := s.db.Query(`SELECT ` + deviceColumns + ` FROM devices ORDER BY device_name, device_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []models.Device{}
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device row: %w", err)
+		}
+		devices = append(devices, device)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating device rows: %w", err)
+	}
+	return devices, nil
+}
+
+// DeviceForToken returns the device whose token hashes to tokenHash, or ""
+// if there is none. It satisfies auth.DeviceTokenLookup.
+func (s *Storage) DeviceForToken(tokenHash string) (string, error) {
+	defer s.metrics.observeDB("device_for_token", time.Now())
+	var deviceID string
+	err := s.db.QueryRow(`SELECT device_id FROM devices WHERE token_hash = ? AND token_hash != ''`, tokenHash).Scan(&deviceID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up device token: %w", err)
+	}
+	return deviceID, nil
+}
+
+// IssueDeviceToken stores the hash of a device's new token, unless the
+// device already has one. It reports whether the token was stored.
+// WHY never replace an existing token: Anyone with the shared token could
+// otherwise take over a device's identity by re-enrolling it. Replacing a
+// token takes revoking the old one first.
+func (s *Storage) IssueDeviceToken(deviceID, tokenHash string) (bool, error) {
+	result, err := s.db.Exec(`UPDATE devices SET token_hash = ? WHERE device_id = ? AND token_hash = ''`, tokenHash, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to issue device token: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// RevokeDeviceToken removes a device's token. It returns ErrDeviceNotFound
+// for an unknown device and reports whether the device had a token.
+func (s *Storage) RevokeDeviceToken(deviceID string) (bool, error) {
+	device, err := s.GetDevice(deviceID)
+	if err != nil {
+		return false, err
+	}
+	if device == nil {
+		return false, ErrDeviceNotFound
+	}
+	if _, err := s.db.Exec(`UPDATE devices SET token_hash = '' WHERE device_id = ?`, deviceID); err != nil {
+		return false, fmt.Errorf("failed to revoke device token: %w", err)
+	}
+	return device.HasToken, nil
+}
+
+// ClearDeviceSigningKey removes a device's signing key, so the next key it
+// registers is stored. It reports whether the device exists.
+// WHY: A reinstalled device has a new key, which the old one would keep out.
+func (s *Storage) ClearDeviceSigningKey(deviceID string) (bool, error) {
+	result, err := s.db.Exec(`UPDATE devices SET signing_key = '' WHERE device_id = ?`, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to clear device signing key: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// SetDeviceNotify stores whether receiving agents should notify for clips
+// originating from the given device.
+// WHY return a found flag: Lets the API answer 404 for unknown devices
+// instead of silently accepting a preference that will never apply.
+func (s *Storage) SetDeviceNotify(deviceID string, notify bool) (bool, error) {
+	result, err := s.db.Exec(`UPDATE devices SET notify = ? WHERE device_id = ?`, notify, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update device notify preference: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// SetDeviceStoreHistory stores whether clips from the given device are
+// written to history.
+// WHY return a found flag: Same as SetDeviceNotify - an opt-out for an
+// unknown device would silently never apply.
+func (s *Storage) SetDeviceStoreHistory(deviceID string, store bool) (bool, error) {
+	result, err := s.db.Exec(`UPDATE devices SET store_history = ? WHERE device_id = ?`, store, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update device history preference: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// BindDeviceNode binds a device to a Tailscale node if it isn't bound yet,
+// and returns the node the device is bound to afterwards.
+// WHY trust on first use: The first node to use a device_id is almost always
+// the machine it was configured on. Creating the row here (when the device
+// hasn't registered yet) closes the window where another node could claim
+// an unregistered ID first.
+// WHY a single upsert: Two requests racing to bind the same device can't
+// both win - the CASE only fills an empty node_id.
+func (s *Storage) BindDeviceNode(deviceID, nodeID string) (string, error) {
 	query := `
-	SELECT event_id, source_device_id, timestamp, content_type, text, text_hash
-	FROM events
-	ORDER BY timestamp DESC
+	INSERT INTO devices (device_id, device_name, tailscale_ip, last_seen_utc, node_id)
+	VALUES (?, ?, '', ?, ?)
+	ON CONFLICT(device_id) DO UPDATE SET
+		node_id = CASE WHEN node_id = '' THEN excluded.node_id ELSE node_id END
+	`
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := s.db.Exec(query, deviceID, deviceID, now, nodeID); err != nil {
+		return "", fmt.Errorf("failed to bind device node: %w", err)
+	}
+
+	var bound string
+	if err := s.db.QueryRow(`SELECT node_id FROM devices WHERE device_id = ?`, deviceID).Scan(&bound); err != nil {
+		return "", fmt.Errorf("failed to read device node: %w", err)
+	}
+	return bound, nil
+}
+
+// UnbindDeviceNode clears a device's node binding so the next node to use
+// it is bound instead.
+// WHY: Reinstalling a machine or replacing it gives it a new Tailscale node,
+// which the old binding would lock out.
+func (s *Storage) UnbindDeviceNode(deviceID string) (bool, error) {
+	result, err := s.db.Exec(`UPDATE devices SET node_id = '' WHERE device_id = ?`, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unbind device node: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// SetDeviceEnabled enables or disables a device.
+// WHY return a found flag: Callers distinguish an unknown device from a
+// storage failure.
+func (s *Storage) SetDeviceEnabled(deviceID string, enabled bool) (bool, error) {
+	result, err := s.db.Exec(`UPDATE devices SET enabled = ? WHERE device_id = ?`, enabled, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to set device enabled: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// InsertRejectedEvent records metadata about an event the hub refused.
+func (s *Storage) InsertRejectedEvent(rejected *models.RejectedEvent) error {
+	query := `
+	INSERT INTO rejected_events (event_id, source_device_id, content_type, size, reason, rejected_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query,
+		rejected.EventID,
+		rejected.SourceDeviceID,
+		rejected.ContentType,
+		rejected.Size,
+		rejected.Reason,
+		rejected.RejectedAt.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert rejected event: %w", err)
+	}
+	return nil
+}
+
+// GetRejectedEvents returns the most recent rejection records, newest first.
+func (s *Storage) GetRejectedEvents(limit int) ([]models.RejectedEvent, error) {
+	query := `
+	SELECT event_id, source_device_id, content_type, size, reason, rejected_at
+	FROM rejected_events
+	ORDER BY id DESC
 	LIMIT ?
 	`
 
 	rows, err := s.db.Query(query, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query events: %w", err)
+		return nil, fmt.Errorf("failed to query rejected events: %w", err)
 	}
 	defer rows.Close()
 
-	var events []models.Event
+	var rejected []models.RejectedEvent
 	for rows.Next() {
-		var event models.Event
+		var r models.RejectedEvent
 		var ts string
+		if err := rows.Scan(&r.EventID, &r.SourceDeviceID, &r.ContentType, &r.Size, &r.Reason, &ts); err != nil {
+			return nil, fmt.Errorf("failed to scan rejected event row: %w", err)
+		}
+		if r.RejectedAt, err = time.Parse(time.RFC3339, ts); err != nil {
+			return nil, fmt.Errorf("failed to parse rejected_at: %w", err)
+		}
+		rejected = append(rejected, r)
+	}
 
-		if err := rows.Scan(
-			&event.EventID,
-			&event.SourceDeviceID,
-			&ts,
-			&event.ContentType,
-			&event.Text,
-			&event.TextHash,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan event row: %w", err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rejected event rows: %w", err)
+	}
+	return rejected, nil
+}
+
+// InsertDeviceConflict records a duplicate device ID connection.
+func (s *Storage) InsertDeviceConflict(conflict *models.DeviceConflict) error {
+	query := `
+	INSERT INTO device_conflicts (device_id, existing_addr, new_addr, action, detected_at)
+	VALUES (?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query,
+		conflict.DeviceID,
+		conflict.ExistingAddr,
+		conflict.NewAddr,
+		conflict.Action,
+		conflict.DetectedAt.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert device conflict: %w", err)
+	}
+	return nil
+}
+
+// GetDeviceConflicts returns the most recent conflict records, newest first.
+func (s *Storage) GetDeviceConflicts(limit int) ([]models.DeviceConflict, error) {
+	query := `
+	SELECT device_id, existing_addr, new_addr, action, detected_at
+	FROM device_conflicts
+	ORDER BY id DESC
+	LIMIT ?
+	`
+
+	rows, err := s.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device conflicts: %w", err)
+	}
+	defer rows.Close()
+
+	var conflicts []models.DeviceConflict
+	for rows.Next() {
+		var c models.DeviceConflict
+		var ts string
+		if err := rows.Scan(&c.DeviceID, &c.ExistingAddr, &c.NewAddr, &c.Action, &ts); err != nil {
+			return nil, fmt.Errorf("failed to scan device conflict row: %w", err)
+		}
+		if c.DetectedAt, err = time.Parse(time.RFC3339, ts); err != nil {
+			return nil, fmt.Errorf("failed to parse detected_at: %w", err)
 		}
+		conflicts = append(conflicts, c)
+	}
 
-		// Parse the stored RFC3339 timestamp back into time.Time
-		// WHY: SQLite stores timestamps as text strings. We parse them back
-		// to time.Time for consistent handling throughout the application.
-		event.Timestamp, err = time.Parse(time.RFC3339, ts)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse event timestamp: %w", err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating device conflict rows: %w", err)
+	}
+	return conflicts, nil
+}
+
+// eventColumns is the column list shared by every event query.
+// WHY a constant: Keeps SELECT statements and scanEvent in lockstep - adding
+// a column means updating exactly these two places.
+const eventColumns = `event_id, source_device_id, timestamp, content_type, text, text_hash, channel, note, file_name, formats, encrypted, key_id, origin_hub, guest, pinned, pinned_for, signature, signing_key, blob`
+
+// eventMetaColumns is eventColumns with the content columns (text and
+// formats) read as empty strings.
+// WHY derived from eventColumns: scanEvent reads both, so they must list
+// the same columns in the same order.
+var eventMetaColumns = strings.NewReplacer(" text,", " '' AS text,", " formats,", " '' AS formats,").Replace(eventColumns)
+
+// encodeFormats returns an event's rich text formats as stored in the
+// formats column: a JSON object, or "" for a plain clip.
+// WHY JSON in one column: Formats are only ever read back whole, with the
+// event, so a separate table would add joins for nothing.
+func encodeFormats(formats map[string]string) (string, error) {
+	if len(formats) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(formats)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode event formats: %w", err)
+	}
+	return string(data), nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanEvent reads one event row selected with eventColumns.
+func scanEvent(row rowScanner) (models.Event, error) {
+	var event models.Event
+	var ts, formats, pinnedFor string
+
+	if err := row.Scan(
+		&event.EventID,
+		&event.SourceDeviceID,
+		&ts,
+		&event.ContentType,
+		&event.Text,
+		&event.TextHash,
+		&event.Channel,
+		&event.Note,
+		&event.FileName,
+		&formats,
+		&event.Encrypted,
+		&event.KeyID,
+		&event.OriginHub,
+		&event.Guest,
+		&event.Pinned,
+		&pinnedFor,
+		&event.Signature,
+		&event.SigningKey,
+		&event.BlobKey,
+	); err != nil {
+		return event, err
+	}
+	if pinnedFor != "" {
+		if err := json.Unmarshal([]byte(pinnedFor), &event.PinnedFor); err != nil {
+			return event, fmt.Errorf("failed to decode event pinned_for: %w", err)
+		}
+	}
+	if formats != "" {
+		if err := json.Unmarshal([]byte(formats), &event.Formats); err != nil {
+			return event, fmt.Errorf("failed to decode event formats: %w", err)
 		}
+	}
+
+	// Parse the stored RFC3339 timestamp back into time.Time
+	// WHY: SQLite stores timestamps as text strings. We parse them back
+	// to time.Time for consistent handling throughout the application.
+	var err error
+	event.Timestamp, err = time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return event, fmt.Errorf("failed to parse event timestamp: %w", err)
+	}
+
+	return event, nil
+}
+
+// GetEvent looks up a single event by ID.
+// WHY return (nil, nil) when missing: Same as GetDevice - an unknown ID is
+// usually a caller mistake, not a storage failure.
+func (s *Storage) GetEvent(eventID string) (*models.Event, error) {
+	defer s.metrics.observeDB("get_event", time.Now())
+	row := s.db.QueryRow(`SELECT `+eventColumns+` FROM events WHERE event_id = ?`, eventID)
+	event, err := scanEvent(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event: %w", err)
+	}
+	return &event, nil
+}
+
+// HistoryQuery selects a page of history for GetHistory.
+type HistoryQuery struct {
+	// Text, when set, keeps only events whose text, file name, or note
+	// contains it (see SearchEvents).
+	Text string
+	// Pinned, when set, keeps only pinned events.
+	Pinned bool
+	// PinnedFor, when set, keeps only events pinned for this device.
+	PinnedFor string
+	// Since keeps events at or after this time; SinceEvent keeps events
+	// stored after the event with this ID, which must exist. Either one
+	// switches the order to oldest first (for SinceEvent, first stored).
+	Since      time.Time
+	SinceEvent string
+	// Limit and Offset select the page.
+	Limit  int
+	Offset int
+	// MetaOnly leaves Text and Formats empty.
+	MetaOnly bool
+}
+
+// GetHistory returns a page of history: the newest events first, or, for
+// an incremental query (Since or SinceEvent), the oldest after that point
+// first. Unfiltered first pages come from the cache while it is current
+// (see cache.go).
+// WHY oldest first for incremental queries: A client catching up pages
+// forward, passing the last event it got as the next SinceEvent. Newest
+// first, a catch-up larger than one page would skip the events in between.
+// WHY rowid as a tie-breaker: Timestamps have second precision, so events
+// of the same second need a stable order for paging to neither repeat nor
+// skip them.
+// WHY SinceEvent goes by rowid alone: Timestamps come from the agents. A
+// clip flushed from an agent's outbox keeps the time it was copied, and a
+// device with a slow clock stamps clips early; either sorts before the
+// marker of a device that already caught up past it and would never reach
+// it. The order events were stored in has no such gaps.
+func (s *Storage) GetHistory(q HistoryQuery) ([]models.Event, error) {
+	key, cacheable := q.cacheKey()
+	if !cacheable {
+		return s.queryHistory(q)
+	}
+	now := time.Now()
+	events, ok, generation := s.history.get(key, now)
+	if ok {
+		return events, nil
+	}
+	events, err := s.queryHistory(q)
+	if err != nil {
+		return nil, err
+	}
+	s.history.put(key, events, generation, now)
+	return events, nil
+}
+
+// queryHistory runs q against the database, bypassing the cache.
+// WHY time only real queries: Cache hits say nothing about the database.
+func (s *Storage) queryHistory(q HistoryQuery) ([]models.Event, error) {
+	defer s.metrics.observeDB("get_history", time.Now())
+	var where []string
+	var args []any
+	if q.Text != "" {
+		// WHY escape: A search for "50%" or "file_name" should match
+		// literally, not treat % and _ as wildcards.
+		pattern := "%" + likeEscaper.Replace(q.Text) + "%"
+		where = append(where, `((content_type != 'file' AND NOT encrypted AND text LIKE ? ESCAPE '\')
+		OR file_name LIKE ? ESCAPE '\' OR note LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern)
+	}
+	if q.Pinned {
+		where = append(where, `pinned`)
+	}
+	if q.PinnedFor != "" {
+		// WHY NULLIF: json_each rejects the empty string most events hold.
+		where = append(where, `EXISTS (SELECT 1 FROM json_each(NULLIF(pinned_for, '')) WHERE value = ?)`)
+		args = append(args, q.PinnedFor)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, `timestamp >= ?`)
+		args = append(args, q.Since.UTC().Format(time.RFC3339))
+	}
+	if q.SinceEvent != "" {
+		where = append(where, `rowid > (SELECT rowid FROM events WHERE event_id = ?)`)
+		args = append(args, q.SinceEvent)
+	}
+
+	columns := eventColumns
+	if q.MetaOnly {
+		columns = eventMetaColumns
+	}
+	query := `SELECT ` + columns + ` FROM events`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	switch {
+	case q.SinceEvent != "":
+		query += ` ORDER BY rowid ASC`
+	case !q.Since.IsZero():
+		query += ` ORDER BY timestamp ASC, rowid ASC`
+	default:
+		query += ` ORDER BY timestamp DESC, rowid DESC`
+	}
+	query += ` LIMIT ? OFFSET ?`
+	args = append(args, q.Limit, q.Offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
 
+	var events []models.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan event row: %w", err)
+		}
 		events = append(events, event)
 	}
 
@@ -225,6 +947,1252 @@ func (s *Storage) GetRecentEvents(limit int) ([]models.Event, error) {
 	return events, nil
 }
 
+// GetRecentEvents retrieves the most recent clipboard events, ordered newest first.
+// WHY limit parameter: Callers control how much history they need. Agents syncing
+// for the first time may want more history, while routine polls only need the latest.
+// WHY ORDER BY timestamp DESC: Most recent events are most relevant for clipboard sync.
+// Agents typically only care about what happened since their last poll.
+func (s *Storage) GetRecentEvents(limit int) ([]models.Event, error) {
+	return s.GetHistory(HistoryQuery{Limit: limit})
+}
+
+// SearchEvents returns the most recent events whose text, file name, or note
+// contains query (case-insensitive for ASCII), newest first.
+// WHY not the text of file or encrypted events: It is base64, where any
+// short query matches by accident.
+// WHY LIKE instead of a full-text index: History is capped in practice by
+// how much people copy, and a substring scan over it is instant. FTS would
+// add a shadow table to keep in sync for no visible gain.
+func (s *Storage) SearchEvents(query string, limit int) ([]models.Event, error) {
+	return s.GetHistory(HistoryQuery{Text: query, Limit: limit})
+}
+
+// likeEscaper escapes LIKE wildcards using backslash as the escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SetEventNote attaches a note to an event, replacing any existing one.
+// An empty note removes it.
+// WHY return a found flag: Callers distinguish an unknown event (404) from
+// a storage failure.
+func (s *Storage) SetEventNote(eventID, note string) (bool, error) {
+	result, err := s.db.Exec(`UPDATE events SET note = ? WHERE event_id = ?`, note, eventID)
+	if err != nil {
+		return false, fmt.Errorf("failed to set event note: %w", err)
+	}
+	s.history.invalidate()
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// SetEventPinned pins or unpins an event.
+// WHY return a found flag: Same as SetEventNote.
+func (s *Storage) SetEventPinned(eventID string, pinned bool) (bool, error) {
+	result, err := s.db.Exec(`UPDATE events SET pinned = ? WHERE event_id = ?`, pinned, eventID)
+	if err != nil {
+		return false, fmt.Errorf("failed to set event pinned: %w", err)
+	}
+	s.history.invalidate()
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// SetEventPinnedFor pins or unpins an event for one device (see
+// models.Event.PinnedFor) and returns the event as updated, or nil if there
+// is no such event.
+// WHY a transaction: The list is read, changed, and written back; two pins
+// for different devices at once must not lose one.
+func (s *Storage) SetEventPinnedFor(eventID, deviceID string, pinned bool) (*models.Event, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	event, err := scanEvent(tx.QueryRow(`SELECT `+eventColumns+` FROM events WHERE event_id = ?`, eventID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event: %w", err)
+	}
+
+	devices := slices.DeleteFunc(event.PinnedFor, func(d string) bool { return d == deviceID })
+	if pinned {
+		devices = append(devices, deviceID)
+	}
+	var encoded string
+	if len(devices) > 0 {
+		data, err := json.Marshal(devices)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode pinned_for: %w", err)
+		}
+		encoded = string(data)
+	}
+	if _, err := tx.Exec(`UPDATE events SET pinned_for = ? WHERE event_id = ?`, encoded, eventID); err != nil {
+		return nil, fmt.Errorf("failed to set event pinned_for: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit pinned_for: %w", err)
+	}
+	s.history.invalidate()
+
+	event.PinnedFor = devices
+	return &event, nil
+}
+
+// EachEvent calls fn for every stored event, oldest first.
+// WHY a callback instead of returning a slice: Maintenance commands walk the
+// entire history, which can be far larger than anything the API returns.
+// Streaming keeps memory flat. fn must not write to the database - collect
+// IDs and act after EachEvent returns.
+func (s *Storage) EachEvent(fn func(event *models.Event) error) error {
+	rows, err := s.db.Query(`SELECT ` + eventColumns + ` FROM events ORDER BY timestamp ASC`)
+	if err != nil {
+		return fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan event row: %w", err)
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating event rows: %w", err)
+	}
+	return nil
+}
+
+// DeleteEvent permanently removes a single event.
+// WHY return a found flag: Callers distinguish "already gone" (404 / no-op)
+// from a storage failure.
+func (s *Storage) DeleteEvent(eventID string) (bool, error) {
+	defer s.metrics.observeDB("delete_event", time.Now())
+	s.chain.lock()
+	defer s.chain.unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin delete: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM events WHERE event_id = ?`, eventID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete event: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	if affected > 0 {
+		if err := s.chain.record(tx, chainDelete, []string{eventID}); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit delete: %w", err)
+	}
+	s.history.invalidate()
+
+	return affected > 0, nil
+}
+
+// StorageSummary is an aggregate, content-free view of the database used in
+// diagnostic reports.
+type StorageSummary struct {
+	SchemaVersion   int            `json:"schema_version"`
+	Events          int            `json:"events"`
+	EventsByType    map[string]int `json:"events_by_type"`
+	EventsByChannel map[string]int `json:"events_by_channel"`
+	EventsWithNote  int            `json:"events_with_note"`
+	EventsPinned    int            `json:"events_pinned"`
+	OldestEvent     string         `json:"oldest_event,omitempty"`
+	NewestEvent     string         `json:"newest_event,omitempty"`
+	Devices         int            `json:"devices"`
+	DisabledDevices int            `json:"disabled_devices"`
+	BoundDevices    int            `json:"bound_devices"`
+	RejectedEvents  map[string]int `json:"rejected_events_by_reason"`
+	DeviceConflicts int            `json:"device_conflicts"`
+}
+
+// Summary counts what the database holds without reading any clip content.
+// WHY: Bug reports need the shape of a hub's data (how much, what kinds,
+// which schema), never the data itself.
+func (s *Storage) Summary() (*StorageSummary, error) {
+	summary := &StorageSummary{}
+
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&summary.SchemaVersion); err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	var oldest, newest sql.NullString
+	err := s.db.QueryRow(`
+	SELECT COUNT(*), COUNT(NULLIF(note, '')), COALESCE(SUM(pinned), 0), MIN(timestamp), MAX(timestamp)
+	FROM events
+	`).Scan(&summary.Events, &summary.EventsWithNote, &summary.EventsPinned, &oldest, &newest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count events: %w", err)
+	}
+	summary.OldestEvent, summary.NewestEvent = oldest.String, newest.String
+
+	err = s.db.QueryRow(`
+	SELECT COUNT(*), COUNT(*) - COALESCE(SUM(enabled), 0), COUNT(NULLIF(node_id, ''))
+	FROM devices
+	`).Scan(&summary.Devices, &summary.DisabledDevices, &summary.BoundDevices)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count devices: %w", err)
+	}
+
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM device_conflicts`).Scan(&summary.DeviceConflicts); err != nil {
+		return nil, fmt.Errorf("failed to count device conflicts: %w", err)
+	}
+
+	if summary.EventsByType, err = s.countGroups(`SELECT content_type, COUNT(*) FROM events GROUP BY content_type`); err != nil {
+		return nil, err
+	}
+	if summary.EventsByChannel, err = s.countGroups(`SELECT channel, COUNT(*) FROM events GROUP BY channel`); err != nil {
+		return nil, err
+	}
+	if summary.RejectedEvents, err = s.countGroups(`SELECT reason, COUNT(*) FROM rejected_events GROUP BY reason`); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// countGroups runs a `SELECT key, COUNT(*) ... GROUP BY key` query.
+func (s *Storage) countGroups(query string, args ...any) (map[string]int, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var key string
+		var count int
+		if err := rows.Scan(&key, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan count row: %w", err)
+		}
+		counts[key] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating count rows: %w", err)
+	}
+	return counts, nil
+}
+
+// CheckIntegrity runs SQLite's full integrity check.
+// WHY integrity_check rather than quick_check: It also verifies indexes
+// against their tables, and a hub database is small enough that the extra
+// seconds at startup don't matter.
+func (s *Storage) CheckIntegrity() error {
+	rows, err := s.db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return fmt.Errorf("failed to scan integrity check row: %w", err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to run integrity check: %w", err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrCorruptDatabase, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ErrCorruptDatabase is returned by CheckIntegrity when SQLite reports damage.
+var ErrCorruptDatabase = errors.New("database integrity check failed")
+
+// Backup writes a consistent copy of the database to path, replacing any
+// existing file only once the copy is complete.
+// WHY VACUUM INTO instead of copying the file: A plain copy of a database in
+// WAL mode can miss committed pages still in the -wal file, or catch a
+// write halfway. VACUUM INTO produces a self-contained snapshot.
+func (s *Storage) Backup(path string) error {
+	tmp := path + ".tmp"
+	os.Remove(tmp) // VACUUM INTO refuses to overwrite
+	if _, err := s.db.Exec(`VACUUM INTO ?`, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace backup: %w", err)
+	}
+	return nil
+}
+
+// SpaceReport shows where the database's disk space goes.
+type SpaceReport struct {
+	// FileBytes and WALBytes are the sizes of the database file and its
+	// write-ahead log
+	FileBytes int64 `json:"file_bytes"`
+	WALBytes  int64 `json:"wal_bytes"`
+	PageSize  int   `json:"page_size"`
+	Pages     int   `json:"pages"`
+	// FreePages are pages left empty by deletes; SQLite reuses them, but
+	// only VACUUM gives them back to the file system
+	FreePages int   `json:"free_pages"`
+	FreeBytes int64 `json:"free_bytes"`
+	// ObjectSizes reports whether Tables and their Indexes include Bytes.
+	// WHY optional: Object sizes come from SQLite's dbstat table, which the
+	// go-sqlite3 build leaves out unless CGO_CFLAGS adds
+	// -DSQLITE_ENABLE_DBSTAT_VTAB; row counts are always there
+	ObjectSizes bool         `json:"object_sizes"`
+	Tables      []TableSpace `json:"tables"`
+}
+
+// TableSpace is one table's share of a SpaceReport.
+type TableSpace struct {
+	Name    string       `json:"name"`
+	Rows    int          `json:"rows"`
+	Bytes   int64        `json:"bytes,omitempty"`
+	Indexes []IndexSpace `json:"indexes,omitempty"`
+}
+
+// IndexSpace is one index's share of a SpaceReport.
+type IndexSpace struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes,omitempty"`
+}
+
+// Space reports the database's size, free pages, and what each table and
+// index holds.
+func (s *Storage) Space() (*SpaceReport, error) {
+	report := &SpaceReport{}
+
+	var seq int
+	var name, file string
+	if err := s.db.QueryRow(`PRAGMA database_list`).Scan(&seq, &name, &file); err != nil {
+		return nil, fmt.Errorf("failed to find database file: %w", err)
+	}
+	if info, err := os.Stat(file); err == nil {
+		report.FileBytes = info.Size()
+	}
+	// WHY ignore a missing -wal file: It only exists while the database is
+	// open in WAL mode and may have been checkpointed away.
+	if info, err := os.Stat(file + "-wal"); err == nil {
+		report.WALBytes = info.Size()
+	}
+
+	for pragma, dest := range map[string]*int{
+		"page_size":      &report.PageSize,
+		"page_count":     &report.Pages,
+		"freelist_count": &report.FreePages,
+	} {
+		if err := s.db.QueryRow(`PRAGMA ` + pragma).Scan(dest); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", pragma, err)
+		}
+	}
+	report.FreeBytes = int64(report.FreePages) * int64(report.PageSize)
+
+	sizes, err := s.objectSizes()
+	if err != nil {
+		return nil, err
+	}
+	report.ObjectSizes = sizes != nil
+
+	rows, err := s.db.Query(`
+	SELECT type, name, tbl_name FROM sqlite_master
+	WHERE type IN ('table', 'index')
+	ORDER BY type DESC, name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	// WHY tables first (type DESC): Indexes are attached to their table,
+	// which must already be in the report.
+	tables := make(map[string]int)
+	for rows.Next() {
+		var kind, object, table string
+		if err := rows.Scan(&kind, &object, &table); err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		if kind == "table" {
+			tables[object] = len(report.Tables)
+			report.Tables = append(report.Tables, TableSpace{Name: object, Bytes: sizes[object]})
+			continue
+		}
+		if i, ok := tables[table]; ok {
+			report.Tables[i].Indexes = append(report.Tables[i].Indexes, IndexSpace{Name: object, Bytes: sizes[object]})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	for i := range report.Tables {
+		table := &report.Tables[i]
+		quoted := `"` + strings.ReplaceAll(table.Name, `"`, `""`) + `"`
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM ` + quoted).Scan(&table.Rows); err != nil {
+			return nil, fmt.Errorf("failed to count rows of %s: %w", table.Name, err)
+		}
+	}
+	return report, nil
+}
+
+// objectSizes returns the bytes each table and index occupies, or nil if
+// SQLite was built without dbstat.
+func (s *Storage) objectSizes() (map[string]int64, error) {
+	rows, err := s.db.Query(`SELECT name, SUM(pgsize) FROM dbstat GROUP BY name`)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table: dbstat") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read object sizes: %w", err)
+	}
+	defer rows.Close()
+
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var size int64
+		if err := rows.Scan(&name, &size); err != nil {
+			return nil, fmt.Errorf("failed to scan object size: %w", err)
+		}
+		sizes[name] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read object sizes: %w", err)
+	}
+	return sizes, nil
+}
+
+// Vacuum rebuilds the database without its free pages and truncates the
+// write-ahead log, returning the space to the file system.
+// WHY checkpoint afterwards: In WAL mode VACUUM writes the rebuilt database
+// through the -wal file, which would otherwise stay as large as the whole
+// database until the next checkpoint.
+func (s *Storage) Vacuum() error {
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	if _, err := s.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
+}
+
+// RetentionPolicy decides which events the retention job keeps: events newer
+// than RetentionDays and, of those, only the newest HistoryLimit. Pinned
+// events, and events pinned for a device, are always kept, and don't count
+// toward HistoryLimit.
+// Zero disables the respective limit.
+type RetentionPolicy struct {
+	RetentionDays int `json:"retention_days"`
+	HistoryLimit  int `json:"history_limit"`
+
+	// Channels apply their own limits to their channel's events, which then
+	// don't count toward HistoryLimit.
+	Channels []ChannelRetention `json:"channels,omitempty"`
+}
+
+// ChannelRetention is the retention policy of one channel; zero disables a
+// limit, as in RetentionPolicy.
+type ChannelRetention struct {
+	Channel       string `json:"channel"`
+	RetentionDays int    `json:"retention_days"`
+	HistoryLimit  int    `json:"history_limit"`
+}
+
+// empty reports whether the policy deletes nothing.
+func (p RetentionPolicy) empty() bool {
+	if p.RetentionDays > 0 || p.HistoryLimit > 0 {
+		return false
+	}
+	for _, channel := range p.Channels {
+		if channel.RetentionDays > 0 || channel.HistoryLimit > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// cutoff returns the timestamp before which events are too old, or "" when
+// there is no age limit.
+// WHY a string: Timestamps are stored as RFC 3339 UTC text, which sorts
+// chronologically, so SQLite can compare them directly.
+func cutoff(retentionDays int, now time.Time) string {
+	if retentionDays <= 0 {
+		return ""
+	}
+	return now.UTC().AddDate(0, 0, -retentionDays).Format(time.RFC3339)
+}
+
+// retentionQuery holds the SQL conditions selecting the events a policy
+// deletes, and their numbered arguments (?1 onward).
+type retentionQuery struct {
+	// where selects every event to delete; tooOld the ones among them that
+	// are past their age limit.
+	where  string
+	tooOld string
+	args   []any
+}
+
+// query builds the conditions selecting the events p deletes.
+// WHY one scope per channel policy, and one for the rest: Each has its own
+// cutoff and its own newest-N, so a busy channel can't push a quiet one's
+// events over the limit.
+// WHY rowid as a tie-breaker: Events with equal timestamps must fall on the
+// same side of the limit in the report and in the delete.
+// WHY pinned events don't count toward the limit: Otherwise every pin would
+// shrink the history of everything else, and pinning history_limit snippets
+// would leave no room for new clips at all.
+func (p RetentionPolicy) query(now time.Time) retentionQuery {
+	var q retentionQuery
+	arg := func(v any) string {
+		q.args = append(q.args, v)
+		return fmt.Sprintf("?%d", len(q.args))
+	}
+
+	var tooOld, overLimit, overridden []string
+	addScope := func(scope string, retentionDays, historyLimit int) {
+		if c := cutoff(retentionDays, now); c != "" {
+			tooOld = append(tooOld, "("+scope+" AND timestamp < "+arg(c)+")")
+		}
+		if historyLimit > 0 {
+			overLimit = append(overLimit, "("+scope+" AND rowid NOT IN (SELECT rowid FROM events WHERE NOT pinned AND pinned_for = '' AND "+
+				scope+" ORDER BY timestamp DESC, rowid DESC LIMIT "+arg(historyLimit)+"))")
+		}
+	}
+	for _, channel := range p.Channels {
+		placeholder := arg(channel.Channel)
+		overridden = append(overridden, placeholder)
+		addScope("channel = "+placeholder, channel.RetentionDays, channel.HistoryLimit)
+	}
+	rest := "1"
+	if len(overridden) > 0 {
+		rest = "channel NOT IN (" + strings.Join(overridden, ", ") + ")"
+	}
+	addScope(rest, p.RetentionDays, p.HistoryLimit)
+
+	q.tooOld = "(" + orSQL(tooOld) + ")"
+	q.where = "(NOT pinned AND pinned_for = '' AND (" + orSQL(append(tooOld, overLimit...)) + "))"
+	return q
+}
+
+// orSQL joins SQL conditions with OR; no conditions is false.
+func orSQL(conditions []string) string {
+	if len(conditions) == 0 {
+		return "0"
+	}
+	return strings.Join(conditions, " OR ")
+}
+
+// retentionAgeBuckets are the age ranges RetentionReport.ByAge groups by,
+// youngest first. Each bucket holds events younger than days; the last one
+// (days 0) holds everything older.
+var retentionAgeBuckets = []struct {
+	label string
+	days  int
+}{
+	{"<1d", 1},
+	{"1-7d", 7},
+	{"7-30d", 30},
+	{"30-90d", 90},
+	{">90d", 0},
+}
+
+// RetentionReport describes what applying a RetentionPolicy would delete.
+// Like StorageSummary, it never includes clip content.
+type RetentionReport struct {
+	Policy    RetentionPolicy `json:"policy"`
+	Cutoff    string          `json:"cutoff,omitempty"`
+	Events    int             `json:"events"`
+	Pinned    int             `json:"pinned"`
+	Delete    int             `json:"delete"`
+	TooOld    int             `json:"too_old"`
+	OverLimit int             `json:"over_limit"`
+	ByDevice  map[string]int  `json:"by_device"`
+	ByType    map[string]int  `json:"by_type"`
+	ByChannel map[string]int  `json:"by_channel"`
+	ByAge     map[string]int  `json:"by_age"`
+}
+
+// PlanRetention reports what ApplyRetention would delete, without deleting.
+// WHY the same WHERE clause as ApplyRetention: A dry run is only worth
+// trusting if it can't disagree with the real thing.
+func (s *Storage) PlanRetention(policy RetentionPolicy, now time.Time) (*RetentionReport, error) {
+	q := policy.query(now)
+	report := &RetentionReport{Policy: policy, Cutoff: cutoff(policy.RetentionDays, now)}
+
+	err := s.db.QueryRow(`
+	SELECT (SELECT COUNT(*) FROM events),
+		(SELECT COUNT(*) FROM events WHERE pinned OR pinned_for != ''),
+		COUNT(*),
+		COUNT(CASE WHEN `+q.tooOld+` THEN 1 END)
+	FROM events WHERE `+q.where, q.args...,
+	).Scan(&report.Events, &report.Pinned, &report.Delete, &report.TooOld)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count events to prune: %w", err)
+	}
+	report.OverLimit = report.Delete - report.TooOld
+
+	groups := []struct {
+		column string
+		counts *map[string]int
+	}{
+		{"source_device_id", &report.ByDevice},
+		{"content_type", &report.ByType},
+		{"channel", &report.ByChannel},
+	}
+	for _, g := range groups {
+		*g.counts, err = s.countGroups(`SELECT `+g.column+`, COUNT(*) FROM events WHERE `+q.where+
+			` GROUP BY `+g.column, q.args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Ages are bucketed by comparing against precomputed bucket boundaries,
+	// numbered after the policy's arguments, for the same reason cutoff is
+	// a string.
+	ageCase := `CASE`
+	args := slices.Clone(q.args)
+	for _, bucket := range retentionAgeBuckets {
+		if bucket.days == 0 {
+			ageCase += fmt.Sprintf(` ELSE '%s' END`, bucket.label)
+			break
+		}
+		args = append(args, now.UTC().AddDate(0, 0, -bucket.days).Format(time.RFC3339))
+		ageCase += fmt.Sprintf(` WHEN timestamp >= ?%d THEN '%s'`, len(args), bucket.label)
+	}
+	report.ByAge, err = s.countGroups(`SELECT `+ageCase+`, COUNT(*) FROM events WHERE `+q.where+
+		` GROUP BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ApplyRetention deletes the events policy doesn't keep and returns how
+// many were deleted.
+func (s *Storage) ApplyRetention(policy RetentionPolicy, now time.Time) (int64, error) {
+	defer s.metrics.observeDB("apply_retention", time.Now())
+	q := policy.query(now)
+	return s.prune(q.where, q.args)
+}
+
+// RetentionCandidates returns up to limit of the events policy doesn't
+// keep, oldest first, for archiving before PruneEvents deletes them.
+func (s *Storage) RetentionCandidates(policy RetentionPolicy, now time.Time, limit int) ([]models.Event, error) {
+	q := policy.query(now)
+	rows, err := s.db.Query(`SELECT `+eventColumns+` FROM events WHERE `+q.where+
+		fmt.Sprintf(` ORDER BY timestamp, rowid LIMIT %d`, limit), q.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query retention candidates: %w", err)
+	}
+	defer rows.Close()
+	var events []models.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan event row: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// PruneEvents deletes those of eventIDs that policy still doesn't keep and
+// returns how many were deleted.
+// WHY check the policy again: An event pinned since RetentionCandidates
+// listed it must stay.
+func (s *Storage) PruneEvents(policy RetentionPolicy, now time.Time, eventIDs []string) (int64, error) {
+	if len(eventIDs) == 0 {
+		return 0, nil
+	}
+	defer s.metrics.observeDB("apply_retention", time.Now())
+	q := policy.query(now)
+	args := q.args
+	placeholders := make([]string, len(eventIDs))
+	for i, id := range eventIDs {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("?%d", len(args))
+	}
+	return s.prune(q.where+` AND event_id IN (`+strings.Join(placeholders, ", ")+`)`, args)
+}
+
+// prune deletes the events matching where and returns how many were
+// deleted.
+func (s *Storage) prune(where string, args []any) (int64, error) {
+	s.chain.lock()
+	defer s.chain.unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin pruning: %w", err)
+	}
+	defer tx.Rollback()
+
+	pruned, err := s.chain.chainedIDs(tx, where, args...)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`DELETE FROM events WHERE `+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune events: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	if err := s.chain.record(tx, chainDelete, pruned); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit pruning: %w", err)
+	}
+	s.history.invalidate()
+	return affected, nil
+}
+
+// TrashedBlobs returns up to limit of the objects deleted events left in
+// the blob store.
+func (s *Storage) TrashedBlobs(limit int) ([]string, error) {
+	rows, err := s.db.Query(`SELECT name FROM blob_trash LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blob_trash: %w", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan blob_trash row: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// ForgetTrashedBlobs removes names, deleted from the blob store, from
+// blob_trash.
+func (s *Storage) ForgetTrashedBlobs(names []string) error {
+	for _, name := range names {
+		if _, err := s.db.Exec(`DELETE FROM blob_trash WHERE name = ?`, name); err != nil {
+			return fmt.Errorf("failed to update blob_trash: %w", err)
+		}
+	}
+	return nil
+}
+
+// ErrDeviceNotFound is returned when an operation names an unknown device.
+var ErrDeviceNotFound = errors.New("device not found")
+
+// MergeResult reports how many records MergeDevices reassigned, and how
+// many sealed or signed events it left under the merged device's ID.
+type MergeResult struct {
+	Events    int64 `json:"events"`
+	Rejected  int64 `json:"rejected_events"`
+	Conflicts int64 `json:"conflicts"`
+	Kept      int64 `json:"kept_events"`
+}
+
+// mergeableEvents matches the events MergeDevices may reassign.
+// WHY not sealed or signed events: Both bind the source device ID - as
+// AES-GCM associated data, and in the signed fields a recipient checks
+// against the signing key pinned for that ID. Under another ID a sealed
+// clip no longer opens and a signed one is refused, on every agent.
+const mergeableEvents = `source_device_id = ? AND NOT encrypted AND signature = ''`
+
+// MergeDevices reassigns everything recorded for device `from` to device
+// `to` and deletes `from`.
+//
+// WHY: Reinstalling an agent often generates a new device_id, leaving the
+// same machine split across two rows with history attributed to a device
+// that no longer exists.
+//
+// WHY the target's settings win: `to` is the identity the machine uses now,
+// so its name, preferences, and node binding are the current ones. Only gaps
+// are filled from `from` (a missing node binding, a later last-seen time).
+// If `to` has no row yet, `from` is simply renamed.
+//
+// End-to-end encrypted and signed events keep `from` as their source (see
+// mergeableEvents) and are counted in Kept.
+//
+// WHY one transaction: A half-applied merge would leave history split in a
+// way that's hard to notice and harder to undo.
+func (s *Storage) MergeDevices(from, to string) (*MergeResult, error) {
+	if from == to {
+		return nil, fmt.Errorf("cannot merge device %s into itself", from)
+	}
+
+	s.chain.lock()
+	defer s.chain.unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin merge: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM devices WHERE device_id = ?`, from).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up device %s: %w", from, err)
+	}
+	if exists == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, from)
+	}
+
+	reassigned, err := s.chain.chainedIDs(tx, mergeableEvents, from)
+	if err != nil {
+		return nil, err
+	}
+	result := &MergeResult{}
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM events WHERE source_device_id = ? AND (encrypted OR signature != '')`,
+		from).Scan(&result.Kept); err != nil {
+		return nil, fmt.Errorf("failed to count sealed and signed events: %w", err)
+	}
+	updates := []struct {
+		query string
+		count *int64
+	}{
+		{`UPDATE events SET source_device_id = ? WHERE ` + mergeableEvents, &result.Events},
+		{`UPDATE rejected_events SET source_device_id = ? WHERE source_device_id = ?`, &result.Rejected},
+		{`UPDATE device_conflicts SET device_id = ? WHERE device_id = ?`, &result.Conflicts},
+	}
+	for _, u := range updates {
+		res, err := tx.Exec(u.query, to, from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reassign records: %w", err)
+		}
+		if *u.count, err = res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("failed to read affected rows: %w", err)
+		}
+	}
+	if err := s.chain.record(tx, chainUpdate, reassigned); err != nil {
+		return nil, err
+	}
+
+	// WHY RFC3339 text compares correctly with MAX: All timestamps are
+	// stored in UTC with the same layout, so lexical order is time order.
+	res, err := tx.Exec(`
+	UPDATE devices SET
+		last_seen_utc = MAX(last_seen_utc, (SELECT last_seen_utc FROM devices WHERE device_id = ?1)),
+		node_id = CASE WHEN node_id = '' THEN (SELECT node_id FROM devices WHERE device_id = ?1) ELSE node_id END
+	WHERE device_id = ?2
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update device %s: %w", to, err)
+	}
+	merged, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+
+	finalize := `DELETE FROM devices WHERE device_id = ?2`
+	if merged == 0 {
+		finalize = `UPDATE devices SET device_id = ?1 WHERE device_id = ?2`
+	}
+	if _, err := tx.Exec(finalize, to, from); err != nil {
+		return nil, fmt.Errorf("failed to retire device %s: %w", from, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit merge: %w", err)
+	}
+	s.history.invalidate()
+	return result, nil
+}
+
+// GetDataKey returns the wrapped data key keyID, or nil if there is none
+// (never created, or shredded).
+func (s *Storage) GetDataKey(keyID string) (*models.DataKey, error) {
+	var key models.DataKey
+	var createdAt string
+	err := s.db.QueryRow(`SELECT key_id, wrapped, created_at FROM data_keys WHERE key_id = ?`, keyID).
+		Scan(&key.KeyID, &key.Wrapped, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data key: %w", err)
+	}
+	key.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse data key timestamp: %w", err)
+	}
+	return &key, nil
+}
+
+// LatestDataKey returns the newest wrapped data key of keyID's day - the
+// one with the highest generation (see models.NextDataKeyID) - or nil if
+// the day has none.
+// WHY order by length first: Generations are numbers; as text, ".10"
+// would sort before ".9".
+func (s *Storage) LatestDataKey(keyID string) (*models.DataKey, error) {
+	day := models.DataKeyDay(keyID)
+	var latest string
+	err := s.db.QueryRow(`SELECT key_id FROM data_keys WHERE key_id = ?1 OR key_id LIKE ?1 || '.%'
+		ORDER BY length(key_id) DESC, key_id DESC LIMIT 1`, day).Scan(&latest)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data key: %w", err)
+	}
+	return s.GetDataKey(latest)
+}
+
+// AddDataKey stores a wrapped data key unless one with its ID exists, and
+// returns the stored key.
+// WHY first upload wins: Two agents may each create the day's key before
+// seeing the other's. Both then use the stored one, so every clip of the day
+// is readable with it.
+func (s *Storage) AddDataKey(key *models.DataKey) (*models.DataKey, error) {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO data_keys (key_id, wrapped, created_at) VALUES (?, ?, ?)`,
+		key.KeyID, key.Wrapped, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert data key: %w", err)
+	}
+	stored, err := s.GetDataKey(key.KeyID)
+	if err == nil && stored == nil {
+		err = fmt.Errorf("data key %s vanished after insert", key.KeyID)
+	}
+	return stored, err
+}
+
+// ListDataKeys returns every wrapped data key, oldest day first.
+func (s *Storage) ListDataKeys() ([]models.DataKey, error) {
+	rows, err := s.db.Query(`SELECT key_id, wrapped, created_at FROM data_keys ORDER BY key_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.DataKey{}
+	for rows.Next() {
+		var key models.DataKey
+		var createdAt string
+		if err := rows.Scan(&key.KeyID, &key.Wrapped, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan data key: %w", err)
+		}
+		if key.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, fmt.Errorf("failed to parse data key timestamp: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RewrapDataKey replaces the wrapped form of data key keyID, if it is still
+// previous, and reports whether it did.
+// WHY compare with previous: Two agents rotating at once would otherwise
+// leave each key wrapped with whichever shared key came last - possibly a
+// different one for each day.
+// WHY secure_delete: Rotation usually follows a leaked shared key; the old
+// wrapped form must not linger in free pages where that key could open it.
+func (s *Storage) RewrapDataKey(keyID, previous, wrapped string) (bool, error) {
+	ctx := context.Background()
+	conn, err := s.secureConn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	defer conn.ExecContext(ctx, `PRAGMA secure_delete = OFF`)
+
+	res, err := conn.ExecContext(ctx, `UPDATE data_keys SET wrapped = ? WHERE key_id = ? AND wrapped = ?`,
+		wrapped, keyID, previous)
+	if err != nil {
+		return false, fmt.Errorf("failed to rewrap data key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return false, fmt.Errorf("failed to checkpoint after rewrap: %w", err)
+	}
+	return n == 1, nil
+}
+
+// secureConn returns a connection with secure_delete on, so deleted and
+// overwritten content is zeroed on disk. The caller closes it after turning
+// secure_delete off again.
+// WHY a dedicated connection: secure_delete is a per-connection setting,
+// and the pool would otherwise run the statements on any connection.
+func (s *Storage) secureConn(ctx context.Context) (*sql.Conn, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `PRAGMA secure_delete = ON`); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to enable secure_delete: %w", err)
+	}
+	return conn, nil
+}
+
+// ShredResult counts what ShredDataKeys removed (or would remove).
+type ShredResult struct {
+	Keys   int64 `json:"keys"`
+	Events int64 `json:"events"`
+}
+
+// shredWhere selects data keys (and, with key_id, events) for days before ?1.
+// WHY compare strings: Key IDs are YYYY-MM-DD, which sort by date, and a
+// generation suffix keeps a key between its day and the next.
+const shredWhere = `key_id != '' AND key_id < ?1`
+
+// PlanShred counts the data keys for days before beforeID and the events
+// sealed with them, without changing anything.
+func (s *Storage) PlanShred(beforeID string) (*ShredResult, error) {
+	var result ShredResult
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM data_keys WHERE `+shredWhere, beforeID).Scan(&result.Keys); err != nil {
+		return nil, fmt.Errorf("failed to count data keys: %w", err)
+	}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM events WHERE `+shredWhere, beforeID).Scan(&result.Events); err != nil {
+		return nil, fmt.Errorf("failed to count encrypted events: %w", err)
+	}
+	return &result, nil
+}
+
+// ShredDataKeys deletes the data keys for days before beforeID, making the
+// events sealed with them unreadable, and deletes those events as well.
+//
+// WHY secure_delete and a checkpoint: The point is that the keys are gone
+// from disk, not merely unlinked. secure_delete overwrites the freed pages,
+// and truncating the WAL removes the copies written there.
+// WHY delete the events too: Without their key they are noise that still
+// counts against history_limit.
+func (s *Storage) ShredDataKeys(beforeID string) (*ShredResult, error) {
+	ctx := context.Background()
+	conn, err := s.secureConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer conn.ExecContext(ctx, `PRAGMA secure_delete = OFF`)
+
+	s.chain.lock()
+	defer s.chain.unlock()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin shred: %w", err)
+	}
+	defer tx.Rollback()
+
+	shredded, err := s.chain.chainedIDs(tx, shredWhere, beforeID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result ShredResult
+	for _, step := range []struct {
+		table string
+		count *int64
+	}{{"data_keys", &result.Keys}, {"events", &result.Events}} {
+		res, err := tx.Exec(`DELETE FROM `+step.table+` WHERE `+shredWhere, beforeID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to shred %s: %w", step.table, err)
+		}
+		if *step.count, err = res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("failed to read affected rows: %w", err)
+		}
+	}
+	if err := s.chain.record(tx, chainDelete, shredded); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit shred: %w", err)
+	}
+	s.history.invalidate()
+
+	if _, err := conn.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint after shred: %w", err)
+	}
+	return &result, nil
+}
+
+// GuestPass lets one guest device use the hub until ExpiresAt (see
+// guest.go). Only a hash of its token is stored.
+type GuestPass struct {
+	DeviceID  string    `json:"device_id"`
+	Name      string    `json:"name,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// allows reports whether a request on pass may act as deviceID. A nil pass
+// - a request with the hub's own token - may act as any device.
+func (g *GuestPass) allows(deviceID string) bool {
+	return g == nil || g.DeviceID == deviceID
+}
+
+// guestPassColumns is the column list shared by guest pass queries.
+const guestPassColumns = `device_id, name, created_at, expires_at`
+
+// scanGuestPass reads one guest pass row selected with guestPassColumns.
+func scanGuestPass(row rowScanner) (*GuestPass, error) {
+	var pass GuestPass
+	var createdAt, expiresAt string
+	if err := row.Scan(&pass.DeviceID, &pass.Name, &createdAt, &expiresAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if pass.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return nil, fmt.Errorf("failed to parse guest pass created_at: %w", err)
+	}
+	if pass.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to parse guest pass expires_at: %w", err)
+	}
+	return &pass, nil
+}
+
+// InsertGuestPass stores a pass with the hash of its token, replacing an
+// earlier pass for the same device.
+// WHY replace: Extending a guest's stay is issuing a new pass; the old token
+// stops working at once.
+func (s *Storage) InsertGuestPass(pass *GuestPass, tokenHash string) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO guest_passes (device_id, name, token_hash, created_at, expires_at)
+	VALUES (?, ?, ?, ?, ?)`,
+		pass.DeviceID, pass.Name, tokenHash,
+		pass.CreatedAt.UTC().Format(time.RFC3339), pass.ExpiresAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to insert guest pass: %w", err)
+	}
+	return nil
+}
+
+// GetGuestPass returns the unexpired pass of deviceID, or nil.
+func (s *Storage) GetGuestPass(deviceID string, now time.Time) (*GuestPass, error) {
+	return s.queryGuestPass(`device_id = ?`, deviceID, now)
+}
+
+// GuestPassByToken returns the unexpired pass whose token hashes to
+// tokenHash, or nil.
+func (s *Storage) GuestPassByToken(tokenHash string, now time.Time) (*GuestPass, error) {
+	return s.queryGuestPass(`token_hash = ?`, tokenHash, now)
+}
+
+// queryGuestPass returns the unexpired pass matching where, or nil.
+// WHY check expiry here instead of relying on the sweep: A pass must stop
+// working the moment it expires, not whenever the next sweep runs.
+func (s *Storage) queryGuestPass(where, arg string, now time.Time) (*GuestPass, error) {
+	row := s.db.QueryRow(`SELECT `+guestPassColumns+` FROM guest_passes WHERE `+where+` AND expires_at > ?`,
+		arg, now.UTC().Format(time.RFC3339))
+	pass, err := scanGuestPass(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query guest pass: %w", err)
+	}
+	return pass, nil
+}
+
+// HasOwnClips reports whether deviceID has pushed clips that didn't come in
+// on a guest pass.
+func (s *Storage) HasOwnClips(deviceID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM events WHERE source_device_id = ? AND NOT guest)`, deviceID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to query events of device %s: %w", deviceID, err)
+	}
+	return exists, nil
+}
+
+// ListGuestPasses returns every pass, including expired ones the sweep
+// hasn't removed yet, soonest to expire first.
+func (s *Storage) ListGuestPasses() ([]GuestPass, error) {
+	rows, err := s.db.Query(`SELECT ` + guestPassColumns + ` FROM guest_passes ORDER BY expires_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query guest passes: %w", err)
+	}
+	defer rows.Close()
+
+	passes := []GuestPass{}
+	for rows.Next() {
+		pass, err := scanGuestPass(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan guest pass: %w", err)
+		}
+		passes = append(passes, *pass)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating guest pass rows: %w", err)
+	}
+	return passes, nil
+}
+
+// DeleteGuestPasses removes the passes expired at now - or, with a
+// deviceID, that device's pass whether expired or not - together with
+// their devices' registrations. It returns the affected device IDs.
+// WHY drop the registration too: A guest device should leave nothing
+// behind to clean up; its clips stay in history, marked as guest clips.
+func (s *Storage) DeleteGuestPasses(deviceID string, now time.Time) ([]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin guest pass cleanup: %w", err)
+	}
+	defer tx.Rollback()
+
+	where, arg := `expires_at <= ?`, now.UTC().Format(time.RFC3339)
+	if deviceID != "" {
+		where, arg = `device_id = ?`, deviceID
+	}
+	rows, err := tx.Query(`SELECT device_id FROM guest_passes WHERE `+where, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query guest passes: %w", err)
+	}
+	var deviceIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan guest pass: %w", err)
+		}
+		deviceIDs = append(deviceIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating guest pass rows: %w", err)
+	}
+
+	for _, id := range deviceIDs {
+		if _, err := tx.Exec(`DELETE FROM devices WHERE device_id = ?`, id); err != nil {
+			return nil, fmt.Errorf("failed to delete guest device %s: %w", id, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM guest_passes WHERE device_id = ?`, id); err != nil {
+			return nil, fmt.Errorf("failed to delete guest pass %s: %w", id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit guest pass cleanup: %w", err)
+	}
+	return deviceIDs, nil
+}
+
 // Close cleanly shuts down the database connection.
 // WHY: Ensures WAL checkpoint completes and all data is flushed to disk.
 // Should be called via defer in main() to prevent data loss on shutdown.
@@ -0,0 +1,115 @@
+// Author: Toluwalase Mebaanne
+// Storage tests on a temporary SQLite database.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// newTestStorage opens a fresh database in a temporary directory.
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	s, err := NewStorage(filepath.Join(t.TempDir(), "hub.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// testEvent returns a plain text event from device.
+func testEvent(id, device string) *models.Event {
+	return &models.Event{
+		EventID:        id,
+		SourceDeviceID: device,
+		Timestamp:      time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC),
+		ContentType:    models.ContentTypeText,
+		Text:           "clip " + id,
+		TextHash:       "hash-" + id,
+	}
+}
+
+func insertTestEvents(t *testing.T, s *Storage, events ...*models.Event) {
+	t.Helper()
+	for _, event := range events {
+		if err := s.InsertEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func insertTestDevice(t *testing.T, s *Storage, deviceID string) {
+	t.Helper()
+	if err := s.InsertDevice(&models.Device{DeviceID: deviceID, DeviceName: deviceID, LastSeenUTC: time.Now()}, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMergeDevicesKeepsSealedAndSigned checks that merge leaves end-to-end
+// encrypted and signed events under the old ID they are bound to.
+func TestMergeDevicesKeepsSealedAndSigned(t *testing.T) {
+	s := newTestStorage(t)
+	insertTestDevice(t, s, "old")
+	insertTestDevice(t, s, "new")
+
+	sealed := testEvent("sealed", "old")
+	sealed.Encrypted, sealed.KeyID = true, "2026-03-14"
+	signed := testEvent("signed", "old")
+	signed.Signature, signed.SigningKey = "c2lnbmF0dXJl", "a2V5"
+	insertTestEvents(t, s, testEvent("plain", "old"), sealed, signed)
+
+	result, err := s.MergeDevices("old", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Events != 1 || result.Kept != 2 {
+		t.Errorf("MergeDevices = %+v, want 1 event reassigned and 2 kept", result)
+	}
+	for id, want := range map[string]string{"plain": "new", "sealed": "old", "signed": "old"} {
+		event, err := s.GetEvent(id)
+		if err != nil || event == nil {
+			t.Fatalf("GetEvent(%s) = %v, %v", id, event, err)
+		}
+		if event.SourceDeviceID != want {
+			t.Errorf("event %s is from %s after the merge, want %s", id, event.SourceDeviceID, want)
+		}
+	}
+	if device, err := s.GetDevice("old"); err != nil || device != nil {
+		t.Errorf("GetDevice(old) = %v, %v after the merge, want no device", device, err)
+	}
+}
+
+func TestLatestDataKey(t *testing.T) {
+	s := newTestStorage(t)
+	if key, err := s.LatestDataKey("2026-03-14"); err != nil || key != nil {
+		t.Fatalf("LatestDataKey on an empty database = %v, %v, want nil", key, err)
+	}
+	for _, id := range []string{"2026-03-13", "2026-03-14", "2026-03-14.1", "2026-03-14.9", "2026-03-14.10", "2026-03-15"} {
+		if _, err := s.AddDataKey(&models.DataKey{KeyID: id, Wrapped: "wrapped " + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct{ keyID, want string }{
+		{"2026-03-13", "2026-03-13"},
+		{"2026-03-14", "2026-03-14.10"},
+		{"2026-03-14.1", "2026-03-14.10"},
+		{"2026-03-15", "2026-03-15"},
+	}
+	for _, tt := range tests {
+		key, err := s.LatestDataKey(tt.keyID)
+		if err != nil || key == nil || key.KeyID != tt.want || key.Wrapped != "wrapped "+tt.want {
+			t.Errorf("LatestDataKey(%s) = %+v, %v, want %s", tt.keyID, key, err, tt.want)
+		}
+	}
+
+	// A generation stays within its day when shredding by date.
+	plan, err := s.PlanShred("2026-03-15")
+	if err != nil || plan.Keys != 5 {
+		t.Errorf("PlanShred(2026-03-15) = %+v, %v, want 5 keys", plan, err)
+	}
+}
@@ -0,0 +1,193 @@
+// Author: Toluwalase Mebaanne
+// Package main provides Tailscale node identity checks for the TailClip hub.
+//
+// WHY bind devices to Tailscale nodes:
+// The shared auth token proves a request comes from *some* TailClip install,
+// but any holder of the token can claim any device_id. Tailscale already
+// knows which machine every tailnet connection comes from. Binding each
+// device_id to that machine on first use means a leaked token alone can't
+// impersonate an existing device from a different node.
+//
+// WHY shell out to `tailscale whois` instead of linking tailscale's client
+// library: The CLI is installed wherever tailscaled runs, speaks to the
+// local daemon with the right permissions on every OS, and keeps the hub
+// free of a large dependency tree for one lookup. A hub embedded in the
+// tailnet (see tsnet.go) asks its own node instead.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// whoisCacheTTL is how long a successful whois lookup is reused.
+// WHY cache: Every push would otherwise spawn a process. Node identity for
+// a tailnet IP only changes if the node is removed and the IP reassigned.
+const whoisCacheTTL = 5 * time.Minute
+
+// whoisTimeout bounds a single `tailscale whois` invocation.
+const whoisTimeout = 5 * time.Second
+
+// tailnetNode is the part of `tailscale whois --json` output the hub uses.
+type tailnetNode struct {
+	// StableID identifies the node across key rotations.
+	// WHY StableID instead of the node key: Node keys rotate on key expiry
+	// and re-login; binding to them would lock devices out periodically.
+	StableID string `json:"StableID"`
+	Name     string `json:"Name"`
+}
+
+// whoisFunc looks up the Tailscale node behind a tailnet IP address.
+type whoisFunc func(ctx context.Context, ip string) (tailnetNode, error)
+
+// tailnetIdentity resolves connection addresses to Tailscale nodes.
+type tailnetIdentity struct {
+	whois whoisFunc
+
+	mu    sync.Mutex
+	cache map[string]cachedNode
+}
+
+// cachedNode is a whois result with its lookup time.
+type cachedNode struct {
+	node     tailnetNode
+	lookedUp time.Time
+}
+
+// newTailnetIdentity creates a resolver using the given tailscale CLI path.
+func newTailnetIdentity(cli string) *tailnetIdentity {
+	return &tailnetIdentity{
+		whois: cliWhois(cli),
+		cache: make(map[string]cachedNode),
+	}
+}
+
+// cliWhois returns a whoisFunc that runs `tailscale whois`.
+func cliWhois(cli string) whoisFunc {
+	return func(ctx context.Context, ip string) (tailnetNode, error) {
+		out, err := exec.CommandContext(ctx, cli, "whois", "--json", ip).Output()
+		if err != nil {
+			return tailnetNode{}, fmt.Errorf("tailscale whois %s failed: %w", ip, err)
+		}
+
+		var result struct {
+			Node tailnetNode `json:"Node"`
+		}
+		if err := json.Unmarshal(out, &result); err != nil {
+			return tailnetNode{}, fmt.Errorf("failed to parse tailscale whois output: %w", err)
+		}
+		return result.Node, nil
+	}
+}
+
+// Lookup returns the Tailscale node behind a tailnet IP address.
+func (t *tailnetIdentity) Lookup(ip string) (tailnetNode, error) {
+	t.mu.Lock()
+	if cached, ok := t.cache[ip]; ok && time.Since(cached.lookedUp) < whoisCacheTTL {
+		t.mu.Unlock()
+		return cached.node, nil
+	}
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), whoisTimeout)
+	defer cancel()
+
+	node, err := t.whois(ctx, ip)
+	if err != nil {
+		return tailnetNode{}, err
+	}
+	if node.StableID == "" {
+		return tailnetNode{}, fmt.Errorf("tailscale whois %s returned no node", ip)
+	}
+
+	t.mu.Lock()
+	t.cache[ip] = cachedNode{node: node, lookedUp: time.Now()}
+	t.mu.Unlock()
+	return node, nil
+}
+
+// useWhois makes node identity lookups go through whois instead of the
+// tailscale CLI. A no-op unless tailnet_identity is on.
+func (s *Server) useWhois(whois whoisFunc) {
+	if s.identity != nil {
+		s.identity.whois = whois
+	}
+}
+
+// checkNodeBinding verifies that a request for deviceID comes from the
+// Tailscale node the device is bound to, binding it on first use.
+// It returns 0 when the request may proceed, or an HTTP status and message.
+//
+// WHY refuse when the node can't be identified: In this mode identity is the
+// point. A request that didn't arrive over the tailnet (or a whois failure)
+// can't be attributed to a node, so it can't be trusted with a device_id.
+func (s *Server) checkNodeBinding(r *http.Request, deviceID string) (int, string) {
+	if s.identity == nil {
+		return 0, ""
+	}
+	if deviceID == "" {
+		return http.StatusBadRequest, "device_id is required"
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	node, err := s.identity.Lookup(host)
+	if err != nil {
+		authLog.Warnf("cannot identify Tailscale node for %s (device %s): %v", host, deviceID, err)
+		return http.StatusForbidden, "cannot verify Tailscale node identity"
+	}
+
+	bound, err := s.storage.BindDeviceNode(deviceID, node.StableID)
+	if err != nil {
+		authLog.Errorf("binding device %s to node %s: %v", deviceID, node.StableID, err)
+		return http.StatusInternalServerError, "failed to verify device identity"
+	}
+	if bound != node.StableID {
+		authLog.Warnf("device %s is bound to node %s but request came from node %s (%s)",
+			deviceID, bound, node.StableID, node.Name)
+		return http.StatusForbidden, "device_id is bound to a different Tailscale node"
+	}
+	return 0, ""
+}
+
+// runUnbind implements `hub unbind -device <id> [config-path]`.
+// WHY a command rather than an API endpoint: Rebinding is the escape hatch
+// for exactly the case where a device can no longer authenticate, and every
+// token holder can reach the API. Shell access to the hub is the stronger
+// proof of being the operator.
+func runUnbind(args []string) error {
+	fs := newCommandFlags("unbind")
+	deviceID := fs.String("device", "", "device ID to unbind from its Tailscale node (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *deviceID == "" {
+		fs.Usage()
+		return fmt.Errorf("-device is required")
+	}
+
+	_, storage, err := openCommandStorage(fs)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	found, err := storage.UnbindDeviceNode(*deviceID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("device %s not found", *deviceID)
+	}
+	fmt.Printf("Device %s unbound; the next Tailscale node to use it will be bound.\n", *deviceID)
+	return nil
+}
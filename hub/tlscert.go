@@ -0,0 +1,145 @@
+// Author: Toluwalase Mebaanne
+// Package main provides HTTPS for the TailClip hub with the certificate
+// Tailscale issues for the host, when tailscale_cert is set.
+//
+// WHY Tailscale's certificate:
+// With HTTPS enabled for a tailnet, Tailscale gets every node a Let's
+// Encrypt certificate for its MagicDNS name, which browsers and agents trust
+// as is. The hub asks for it at startup and again every few hours, and
+// serves whatever it has; nobody copies, converts, or renews files, and a
+// renewed certificate is picked up without a restart.
+//
+// WHY `tailscale cert` instead of the LocalAPI:
+// As with whois (see tailnet.go), the CLI already talks to tailscaled with
+// the right permissions on every OS. tailscaled caches the certificate and
+// renews it well before it expires, so asking again is cheap. A hub
+// embedded in the tailnet (see tsnet.go) asks its own node instead.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmair/tailclip/shared/config"
+)
+
+// certRefreshInterval is how often the hub asks tailscaled for its
+// certificate again.
+// WHY not more often: Certificates last 90 days and tailscaled renews them
+// with about a month left, so a renewal is served within hours of it.
+const certRefreshInterval = 12 * time.Hour
+
+// certTimeout bounds a single `tailscale cert` or `tailscale status` run.
+// WHY a minute: Issuing a new certificate goes through Let's Encrypt.
+const certTimeout = time.Minute
+
+// tailnetCertificate is the certificate tailscaled issued for this host.
+type tailnetCertificate struct {
+	cli    string
+	domain string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newTailnetCertificate finds this host's MagicDNS name with the tailscale
+// command cli and obtains its certificate.
+func newTailnetCertificate(cli string) (*tailnetCertificate, error) {
+	domain, err := tailnetCertDomain(cli)
+	if err != nil {
+		return nil, err
+	}
+	c := &tailnetCertificate{cli: cli, domain: domain}
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// tailnetCertDomain returns the name tailscaled can get a certificate for.
+func tailnetCertDomain(cli string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), certTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, cli, "status", "--json").Output()
+	if err != nil {
+		return "", fmt.Errorf("tailscale status failed: %w", err)
+	}
+	var status struct {
+		CertDomains []string `json:"CertDomains"`
+	}
+	if err := json.Unmarshal(out, &status); err != nil {
+		return "", fmt.Errorf("failed to parse tailscale status output: %w", err)
+	}
+	if len(status.CertDomains) == 0 {
+		return "", fmt.Errorf("tailscale_cert is set, but this tailnet has no HTTPS certificates; enable MagicDNS and HTTPS in the Tailscale admin console (https://tailscale.com/s/https)")
+	}
+	return status.CertDomains[0], nil
+}
+
+// refresh asks tailscaled for the certificate and keeps it if it's new.
+func (c *tailnetCertificate) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), certTimeout)
+	defer cancel()
+	// WHY to stdout: The key never touches the disk outside tailscaled's
+	// own state, and there are no files to keep private.
+	out, err := exec.CommandContext(ctx, c.cli, "cert", "--cert-file", "-", "--key-file", "-", c.domain).Output()
+	if err != nil {
+		return fmt.Errorf("tailscale cert %s failed: %w", c.domain, err)
+	}
+	cert, err := tls.X509KeyPair(out, out)
+	if err != nil {
+		return fmt.Errorf("failed to parse the certificate for %s: %w", c.domain, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil && c.cert.Leaf.NotAfter.Equal(cert.Leaf.NotAfter) {
+		return nil
+	}
+	c.cert = &cert
+	hubLog.Infof("Serving the Tailscale certificate for %s, valid until %s", c.domain, cert.Leaf.NotAfter.Format(time.DateOnly))
+	return nil
+}
+
+// run refreshes the certificate every certRefreshInterval.
+// WHY keep serving on failure: The current certificate is still good for
+// weeks when a refresh fails (tailscaled restarting, no internet for a
+// while); the next attempt will pick up the renewal.
+func (c *tailnetCertificate) run() {
+	ticker := time.NewTicker(certRefreshInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := c.refresh(); err != nil {
+			hubLog.Warnf("Could not refresh the Tailscale certificate, serving the current one: %v", err)
+		}
+	}
+}
+
+// getCertificate serves as tls.Config.GetCertificate.
+func (c *tailnetCertificate) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// useTailnetCertificate makes the server serve HTTPS with this host's
+// Tailscale certificate, kept up to date in the background.
+func (s *Server) useTailnetCertificate(cfg *config.HubConfig) error {
+	cert, err := newTailnetCertificate(cfg.TailscaleCLI)
+	if err != nil {
+		return err
+	}
+	go cert.run()
+	s.tlsConfig = &tls.Config{GetCertificate: cert.getCertificate, MinVersion: tls.VersionTLS12}
+	hubLog.Infof("Agents reach this hub at https://%s", net.JoinHostPort(strings.TrimSuffix(cert.domain, "."), strconv.Itoa(cfg.ListenPort)))
+	return nil
+}
@@ -0,0 +1,66 @@
+// Author: Toluwalase Mebaanne
+// Package main provides content transformation rules for the TailClip hub.
+//
+// WHY transform at push time, unlike routing:
+// Routing decides who hears about a clip; transforms decide what the clip
+// *is* once it has been shared. A URL stripped of tracking parameters for
+// other devices shouldn't reappear with them when someone pastes from
+// history, so the rewritten text is what gets stored as well as broadcast.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// applyTransforms rewrites event's text with the tracking-parameter cleaner
+// (if enabled) and every matching transform rule, and recomputes its hash.
+// WHY keep the original when the result is invalid: A rule that empties a
+// clip or pushes it over the size limit is a configuration mistake; the
+// clip the user copied should still arrive.
+// WHY encrypted and signed events are left alone: The hub can't read the
+// former, and any rewrite would break their authentication or signature.
+func (s *Server) applyTransforms(event *models.Event) {
+	if event.Encrypted || event.IsSigned() {
+		return
+	}
+	text := event.Text
+	var applied []string
+	if s.urlCleaner != nil && event.ContentType == models.ContentTypeText {
+		if cleaned := s.urlCleaner.Clean(text); cleaned != text {
+			text = cleaned
+			applied = append(applied, "strip_tracking_params")
+		}
+	}
+	for i := range s.cfg.TransformRules {
+		rule := &s.cfg.TransformRules[i]
+		if !rule.AppliesTo(event.ContentType) {
+			continue
+		}
+		if rewritten := rule.Apply(text); rewritten != text {
+			text = rewritten
+			applied = append(applied, rule.Name)
+		}
+	}
+	if len(applied) == 0 {
+		return
+	}
+
+	if handler, err := s.registry.Lookup(event.ContentType); err == nil {
+		if err := handler.Process(text); err != nil {
+			serverLog.Warnf("transform rule(s) %s made event %s invalid, sending it unchanged: %v",
+				strings.Join(applied, ", "), event.EventID, err)
+			return
+		}
+	}
+
+	event.Text = text
+	event.SetTextHash()
+	// WHY drop rich formats: They still hold the original content, and
+	// receivers that paste them would undo the rewrite. Regex rules can't be
+	// trusted to edit HTML or RTF markup safely.
+	event.Formats = nil
+	serverLog.Infof("Event %s transformed by rule(s) %s", event.EventID, strings.Join(applied, ", "))
+}
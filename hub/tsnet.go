@@ -0,0 +1,91 @@
+// Author: Toluwalase Mebaanne
+// Package main embeds the TailClip hub in the tailnet as its own Tailscale
+// node, when tailscale_hostname is set.
+//
+// WHY tsnet:
+// A hub listening on the host's addresses depends on the host running
+// Tailscale, on listen_ip matching whatever addresses it got, and on the
+// host firewall. As its own node the hub has a stable MagicDNS name that
+// agents put in hub_url, and nothing is listening on the host at all.
+//
+// WHY behind a build tag:
+// tsnet links a complete Tailscale client, several times the size of the
+// rest of the hub. Most hubs run next to tailscaled and don't need it, so
+// only `go build -tags tsnet ./hub` includes it.
+
+//go:build tsnet
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/config"
+	"tailscale.com/tsnet"
+)
+
+// listenTailnet joins the tailnet as cfg.TailscaleHostname and listens on
+// cfg.ListenPort on the node's addresses. The returned whoisFunc resolves
+// peers through the embedded node.
+// WHY wait for Up: Without an auth key, the node only comes up once someone
+// opens the login URL it logs; serving before that would accept nothing.
+func listenTailnet(cfg *config.HubConfig) (net.Listener, whoisFunc, error) {
+	node := &tsnet.Server{
+		Hostname: cfg.TailscaleHostname,
+		AuthKey:  cfg.TailscaleAuthKey,
+		Dir:      cfg.TailscaleStateDir,
+		// WHY silence Logf: tsnet's internal logging is meant for Tailscale
+		// developers; UserLogf still carries the login URL and such.
+		Logf:     func(string, ...any) {},
+		UserLogf: log.Printf,
+	}
+
+	hubLog.Infof("Joining the tailnet as %s (state in %s)", cfg.TailscaleHostname, cfg.TailscaleStateDir)
+	status, err := node.Up(context.Background())
+	if err != nil {
+		node.Close()
+		return nil, nil, fmt.Errorf("failed to join the tailnet as %s: %w", cfg.TailscaleHostname, err)
+	}
+
+	// WHY ListenTLS for tailscale_cert: The node gets and renews the
+	// certificate for its own name through its LocalAPI, the first time a
+	// client connects and before it expires.
+	listen := node.Listen
+	if cfg.TailscaleCert {
+		listen = node.ListenTLS
+	}
+	ln, err := listen("tcp", ":"+strconv.Itoa(cfg.ListenPort))
+	if err != nil {
+		node.Close()
+		return nil, nil, fmt.Errorf("failed to listen on port %d of the tailnet node: %w", cfg.ListenPort, err)
+	}
+	client, err := node.LocalClient()
+	if err != nil {
+		node.Close()
+		return nil, nil, fmt.Errorf("failed to get the tailnet node's client: %w", err)
+	}
+
+	ips := make([]string, 0, len(status.TailscaleIPs))
+	for _, ip := range status.TailscaleIPs {
+		ips = append(ips, ip.String())
+	}
+	scheme := "http"
+	if cfg.TailscaleCert {
+		scheme = "https"
+	}
+	hubLog.Infof("Hub listening on %s://%s:%d (%s)", scheme, strings.TrimSuffix(status.Self.DNSName, "."), cfg.ListenPort, strings.Join(ips, ", "))
+
+	whois := func(ctx context.Context, ip string) (tailnetNode, error) {
+		who, err := client.WhoIs(ctx, ip)
+		if err != nil {
+			return tailnetNode{}, fmt.Errorf("whois %s failed: %w", ip, err)
+		}
+		return tailnetNode{StableID: string(who.Node.StableID), Name: who.Node.Name}, nil
+	}
+	return ln, whois, nil
+}
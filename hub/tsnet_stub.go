@@ -0,0 +1,19 @@
+// Author: Toluwalase Mebaanne
+// Package main provides the stand-in for tsnet.go in hubs built without the
+// tsnet tag.
+
+//go:build !tsnet
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/tmair/tailclip/shared/config"
+)
+
+// listenTailnet refuses to start: this hub can't embed a Tailscale node.
+func listenTailnet(cfg *config.HubConfig) (net.Listener, whoisFunc, error) {
+	return nil, nil, fmt.Errorf("tailscale_hostname is set, but this hub was built without tsnet support; rebuild it with `go build -tags tsnet ./hub`")
+}
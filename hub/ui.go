@@ -0,0 +1,48 @@
+// Author: Toluwalase Mebaanne
+// Package main serves the TailClip hub's built-in web dashboard at /ui/.
+//
+// WHY a dashboard in the hub:
+// Checking what synced, which devices are connected, or getting an old clip
+// back onto every clipboard otherwise needs curl or an agent command on a
+// machine with the config. A browser on any tailnet machine is enough.
+//
+// WHY only static files:
+// The page talks to the same API as every other client, with the same
+// token (entered once and kept in the browser). Serving the files needs no
+// authentication because they contain no data, and the hub gains no
+// second, session-based way in.
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the embedded dashboard files under /ui/.
+func uiHandler() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err) // the embedded directory always exists
+	}
+	fileServer := http.StripPrefix("/ui/", http.FileServerFS(files))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// WHY a strict CSP: The page shows clip text from every device; if
+		// anything ever rendered it as markup, no script could run or send
+		// it elsewhere. frame-ancestors keeps other sites from framing the
+		// token prompt.
+		w.Header().Set("Content-Security-Policy",
+			"default-src 'self'; connect-src 'self'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		fileServer.ServeHTTP(w, r)
+	})
+}
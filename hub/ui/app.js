@@ -0,0 +1,290 @@
+// Author: Toluwalase Mebaanne
+// TailClip hub dashboard: recent history, devices, what kinds of clips get
+// synced, and re-sending a clip.
+//
+// WHY plain JavaScript without a build step: The page is embedded in the hub
+// binary (see hub/ui.go) and should stay readable and auditable as shipped.
+//
+// WHY textContent everywhere: Clip text comes from any device on the
+// tailnet; it must never be interpreted as HTML.
+
+"use strict";
+
+const tokenKey = "tailclip-token";
+const refreshMs = 10000;
+const historyLimit = 25;
+const previewLength = 300;
+
+// dashboardDevice is the source_device_id of clips sent from this page.
+const dashboardDevice = "dashboard";
+
+// contents caches full events by ID. WHY: History is listed with
+// fields=meta; an event's content never changes, so each is fetched once.
+const contents = new Map();
+
+let refreshTimer = null;
+
+function $(id) {
+  return document.getElementById(id);
+}
+
+function setStatus(message, isError) {
+  const status = $("status");
+  status.textContent = message;
+  status.className = isError ? "error" : "";
+}
+
+async function api(path, options = {}) {
+  const headers = { "X-Auth-Token": localStorage.getItem(tokenKey) || "" };
+  if (options.body) {
+    headers["Content-Type"] = "application/json";
+  }
+  const response = await fetch(path, { ...options, headers });
+  if (response.status === 401) {
+    localStorage.removeItem(tokenKey);
+    showLogin("The hub didn't accept the token.");
+    throw new Error("unauthorized");
+  }
+  if (!response.ok) {
+    throw new Error((await response.text()).trim() || response.statusText);
+  }
+  return response.status === 204 ? null : response.json();
+}
+
+function cell(row, text, className) {
+  const td = row.insertCell();
+  td.textContent = text;
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function formatTime(value) {
+  const time = new Date(value);
+  return isNaN(time) || time.getFullYear() < 2000 ? "-" : time.toLocaleString();
+}
+
+async function loadDevices() {
+  const devices = await api("/api/v1/devices");
+  const body = $("devices");
+  body.replaceChildren();
+  for (const device of devices) {
+    const row = body.insertRow();
+    cell(row, device.device_id);
+    cell(row, device.device_name || "-");
+    const state = device.connected ? "connected" : device.online ? "online" : "offline";
+    cell(row, state, device.online ? "online" : "muted");
+    cell(row, formatTime(device.last_seen_utc));
+  }
+}
+
+// classNames are how clip classes (clip_class_stats) read in a sentence.
+const classNames = {
+  url: "links",
+  code: "code",
+  short_text: "short text",
+  long_text: "long text",
+  image: "images",
+  file: "files",
+  encrypted: "encrypted clips",
+};
+
+function percent(n, total) {
+  return Math.round((100 * n) / total) + "%";
+}
+
+// loadClasses shows clip counts by device and class, when the hub keeps
+// them. WHY an insight sentence: The table answers "what", the sentence
+// says what stands out.
+async function loadClasses() {
+  const stats = await api("/api/v1/stats");
+  const byDevice = stats.clip_classes;
+  $("classes").hidden = !byDevice;
+  if (!byDevice) {
+    return;
+  }
+
+  let total = 0;
+  let top = null;
+  const rows = [];
+  for (const [device, counts] of Object.entries(byDevice)) {
+    const entries = Object.entries(counts).sort((a, b) => b[1] - a[1]);
+    const deviceTotal = entries.reduce((sum, [, n]) => sum + n, 0);
+    total += deviceTotal;
+    for (const [cls, n] of entries) {
+      if (!top || n > top.n) {
+        top = { device, cls, n };
+      }
+    }
+    rows.push({ device, deviceTotal, entries });
+  }
+  rows.sort((a, b) => b.deviceTotal - a.deviceTotal);
+
+  $("insight").textContent = top
+    ? percent(top.n, total) + " of synced clips are " + (classNames[top.cls] || top.cls) + " from " + top.device + "."
+    : "No clips since the hub started.";
+
+  const body = $("class-counts");
+  body.replaceChildren();
+  for (const { device, deviceTotal, entries } of rows) {
+    const row = body.insertRow();
+    cell(row, device);
+    cell(row, String(deviceTotal));
+    cell(row, entries.map(([cls, n]) => (classNames[cls] || cls) + " " + percent(n, deviceTotal)).join(", "));
+  }
+}
+
+// eventContent returns an event with its text, from the cache or the hub.
+async function eventContent(id) {
+  if (!contents.has(id)) {
+    contents.set(id, await api("/api/v1/events/" + encodeURIComponent(id)));
+  }
+  return contents.get(id);
+}
+
+// describe returns what the clip column shows for an event without content.
+function describe(event) {
+  if (event.encrypted) {
+    return "(encrypted)";
+  }
+  if (event.content_type === "file") {
+    return "(file) " + (event.file_name || "");
+  }
+  return null;
+}
+
+async function loadHistory() {
+  const events = await api("/api/v1/history?fields=meta&limit=" + historyLimit);
+  const rows = await Promise.all(events.map(async (event) => {
+    const description = describe(event);
+    if (description !== null) {
+      return { event, text: description, copyable: false };
+    }
+    const full = await eventContent(event.event_id);
+    let text = full.text;
+    if (text.length > previewLength) {
+      text = text.slice(0, previewLength) + "…";
+    }
+    return { event, text, copyable: true };
+  }));
+
+  const body = $("history");
+  body.replaceChildren();
+  for (const { event, text, copyable } of rows) {
+    const row = body.insertRow();
+    cell(row, formatTime(event.timestamp));
+    cell(row, event.source_device_id + (event.guest ? " (guest)" : ""));
+    cell(row, event.channel || "default");
+    cell(row, text, copyable ? "clip" : "clip muted");
+    const actions = row.insertCell();
+    if (copyable) {
+      const button = document.createElement("button");
+      button.textContent = "Copy to my clipboard";
+      button.addEventListener("click", () => resend(event.event_id));
+      actions.append(button);
+    }
+  }
+}
+
+// uuid returns a random (version 4) UUID.
+// WHY not crypto.randomUUID: It only exists in secure contexts, and the
+// hub is usually reached over plain http on the tailnet.
+function uuid() {
+  const bytes = crypto.getRandomValues(new Uint8Array(16));
+  bytes[6] = (bytes[6] & 0x0f) | 0x40;
+  bytes[8] = (bytes[8] & 0x3f) | 0x80;
+  const hex = Array.from(bytes, (b) => b.toString(16).padStart(2, "0")).join("");
+  return [hex.slice(0, 8), hex.slice(8, 12), hex.slice(12, 16), hex.slice(16, 20), hex.slice(20)].join("-");
+}
+
+// copyLocally puts text on this browser's clipboard, if the browser lets it.
+async function copyLocally(text) {
+  if (navigator.clipboard && window.isSecureContext) {
+    await navigator.clipboard.writeText(text);
+    return;
+  }
+  // WHY the textarea fallback: navigator.clipboard needs a secure context.
+  const area = document.createElement("textarea");
+  area.value = text;
+  document.body.append(area);
+  area.select();
+  document.execCommand("copy");
+  area.remove();
+}
+
+// resend pushes a clip again as a new event, so every agent puts it on its
+// clipboard, and copies it on this machine too.
+async function resend(id) {
+  try {
+    const event = await eventContent(id);
+    await copyLocally(event.text).catch(() => {});
+    await api("/api/v1/clipboard/push", {
+      method: "POST",
+      body: JSON.stringify({
+        event_id: uuid(),
+        source_device_id: dashboardDevice,
+        timestamp: new Date().toISOString(),
+        content_type: "text",
+        text: event.text,
+        formats: event.formats,
+        channel: event.channel,
+      }),
+    });
+    await refresh();
+    setStatus("Sent to your devices");
+  } catch (err) {
+    if (err.message !== "unauthorized") {
+      setStatus("Failed to send: " + err.message, true);
+    }
+  }
+}
+
+async function refresh() {
+  clearTimeout(refreshTimer);
+  try {
+    await Promise.all([loadDevices(), loadHistory(), loadClasses()]);
+    setStatus("Updated " + new Date().toLocaleTimeString());
+  } catch (err) {
+    if (err.message === "unauthorized") {
+      return;
+    }
+    setStatus("Failed to load: " + err.message, true);
+  }
+  refreshTimer = setTimeout(refresh, refreshMs);
+}
+
+function showLogin(message) {
+  clearTimeout(refreshTimer);
+  $("dashboard").hidden = true;
+  $("forget").hidden = true;
+  $("login").hidden = false;
+  setStatus(message || "", Boolean(message));
+}
+
+function showDashboard() {
+  $("login").hidden = true;
+  $("dashboard").hidden = false;
+  $("forget").hidden = false;
+  setStatus("");
+  refresh();
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  $("login").addEventListener("submit", (e) => {
+    e.preventDefault();
+    localStorage.setItem(tokenKey, $("token").value);
+    $("token").value = "";
+    showDashboard();
+  });
+  $("forget").addEventListener("click", () => {
+    localStorage.removeItem(tokenKey);
+    contents.clear();
+    showLogin();
+  });
+  if (localStorage.getItem(tokenKey)) {
+    showDashboard();
+  } else {
+    showLogin();
+  }
+});
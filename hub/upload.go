@@ -0,0 +1,336 @@
+// Author: Toluwalase Mebaanne
+// Package main provides chunked, resumable pushes for the TailClip hub.
+//
+// WHY chunked uploads next to the single-request push:
+// A 5 MB file is almost 7 MB of JSON. Sent in one request, every dropped
+// connection (a laptop changing networks, a flaky Wi-Fi) means starting
+// over, and some proxies refuse bodies that large outright. An upload
+// announces the event, then sends its text in parts; after a failure the
+// agent asks how much arrived and continues from there.
+//
+// Unfinished uploads live in memory. After a hub restart they are gone and
+// agents start over - the same as a push that failed before uploads existed.
+//
+// Endpoints:
+//   - POST /api/v1/uploads: start (or look up) an upload from a models.Upload
+//   - GET  /api/v1/uploads?event_id=ID: how much of an upload has arrived
+//   - POST /api/v1/uploads/chunk?event_id=ID&offset=N: the next part, as the
+//     raw request body. The last part answers like a push.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+	"github.com/tmair/tailclip/shared/wire"
+)
+
+// uploadIdleTimeout is how long an unfinished upload is kept without a new
+// part.
+// WHY 10 minutes: Long enough to ride out a network change or a short
+// sleep, short enough that abandoned uploads don't pile up in memory.
+const uploadIdleTimeout = 10 * time.Minute
+
+// maxPendingUploads caps how many unfinished uploads the hub holds, and
+// maxDeviceUploads how many of them one device may have.
+// WHY both: Each can grow to a maximum-size clip in memory. Without a cap
+// per device, one device (or a guest) starting uploads it never finishes
+// would lock every other device out of uploads until they expire.
+const (
+	maxPendingUploads = 8
+	maxDeviceUploads  = 2
+)
+
+// maxGuestUploadSize is the largest upload a guest may announce.
+// WHY a small limit for guests: A guest pass is handed to a machine the
+// owner doesn't control, for an afternoon of copying text and the odd
+// screenshot - not for filling the hub's memory with large files.
+const maxGuestUploadSize = 1 << 20
+
+// Errors returned by uploadStore.
+var (
+	errUploadNotFound = errors.New("upload not found (finished, expired, or never started)")
+	errUploadConflict = errors.New("upload with this event_id has a different size or hash")
+	errUploadsFull    = errors.New("too many uploads in progress")
+	errDeviceUploads  = errors.New("too many uploads in progress from this device")
+	errUploadOffset   = errors.New("part does not start where the upload left off")
+	errUploadOverflow = errors.New("part extends past the announced size")
+	errUploadNotYours = errors.New("upload belongs to another device")
+)
+
+// pendingUpload is an upload whose text hasn't fully arrived.
+type pendingUpload struct {
+	event   models.Event
+	size    int
+	data    []byte
+	updated time.Time
+}
+
+// status reports the upload's progress.
+func (p *pendingUpload) status() *models.UploadStatus {
+	return &models.UploadStatus{EventID: p.event.EventID, Received: len(p.data), Size: p.size, ChunkSize: wire.ChunkSize}
+}
+
+// uploadStore holds unfinished uploads by event ID.
+// WHY a mutex: Parts of different uploads arrive on concurrent requests.
+type uploadStore struct {
+	mu      sync.Mutex
+	uploads map[string]*pendingUpload
+}
+
+// newUploadStore creates an empty store.
+func newUploadStore() *uploadStore {
+	return &uploadStore{uploads: make(map[string]*pendingUpload)}
+}
+
+// start begins an upload, or returns the existing one for the same event.
+// WHY return the existing upload: An agent whose start request timed out
+// can't tell whether it arrived; asking again must not reset progress.
+func (u *uploadStore) start(event *models.Event, size int) (*models.UploadStatus, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for id, p := range u.uploads {
+		if time.Since(p.updated) > uploadIdleTimeout {
+			delete(u.uploads, id)
+		}
+	}
+
+	if p, ok := u.uploads[event.EventID]; ok {
+		if p.size != size || p.event.TextHash != event.TextHash {
+			return nil, errUploadConflict
+		}
+		return p.status(), nil
+	}
+	if len(u.uploads) >= maxPendingUploads {
+		return nil, errUploadsFull
+	}
+	fromDevice := 0
+	for _, p := range u.uploads {
+		if p.event.SourceDeviceID == event.SourceDeviceID {
+			fromDevice++
+		}
+	}
+	if fromDevice >= maxDeviceUploads {
+		return nil, errDeviceUploads
+	}
+	// WHY no room reserved for the announced size: Memory is only taken as
+	// parts arrive, so an upload that is announced and abandoned costs
+	// nothing.
+	p := &pendingUpload{event: *event, size: size, updated: time.Now()}
+	u.uploads[event.EventID] = p
+	return p.status(), nil
+}
+
+// status returns an upload's progress.
+func (u *uploadStore) status(eventID string) (*models.UploadStatus, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	p, ok := u.uploads[eventID]
+	if !ok {
+		return nil, errUploadNotFound
+	}
+	return p.status(), nil
+}
+
+// append adds a part starting at offset, sent by who. Once the text is
+// complete the upload is removed and returned with its event's text filled
+// in.
+func (u *uploadStore) append(eventID string, offset int, part []byte, who caller) (*models.UploadStatus, *models.Event, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	p, ok := u.uploads[eventID]
+	if !ok {
+		return nil, nil, errUploadNotFound
+	}
+	if !who.allows(p.event.SourceDeviceID) {
+		return nil, nil, errUploadNotYours
+	}
+	if offset != len(p.data) {
+		return p.status(), nil, errUploadOffset
+	}
+	if len(p.data)+len(part) > p.size {
+		return p.status(), nil, errUploadOverflow
+	}
+	p.data = append(p.data, part...)
+	p.updated = time.Now()
+	if len(p.data) < p.size {
+		return p.status(), nil, nil
+	}
+
+	delete(u.uploads, eventID)
+	event := p.event
+	event.Text = string(p.data)
+	return p.status(), &event, nil
+}
+
+// handleUploads starts an upload (POST) or reports its progress (GET).
+func (s *Server) handleUploads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	who, ok := s.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var status *models.UploadStatus
+	var err error
+	if r.Method == http.MethodGet {
+		status, err = s.uploads.status(r.URL.Query().Get("event_id"))
+	} else if status, ok = s.startUpload(w, r, who); !ok {
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// startUpload validates an upload request and starts the upload. It
+// answers the request itself when it fails, and reports whether it worked.
+// WHY validate before any part arrives: An event the hub would refuse
+// shouldn't cost the agent megabytes of upload first.
+func (s *Server) startUpload(w http.ResponseWriter, r *http.Request, who caller) (*models.UploadStatus, bool) {
+	maxSize := maxPushBodyBytes(s.textHandler.MaxLength(), s.fileHandler.MaxSize(), s.sealed.MaxEncodedLength())
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+
+	var upload models.Upload
+	if err := json.NewDecoder(r.Body).Decode(&upload); err != nil {
+		s.rejectPush(w, &models.RejectedEvent{Size: int(r.ContentLength)}, http.StatusBadRequest, "invalid JSON body")
+		return nil, false
+	}
+	event := &upload.Event
+	rejected := rejectedFrom(event)
+	rejected.Size = upload.Size
+
+	// WHY clear the hash for this check: It covers the text, which hasn't
+	// arrived yet; it is verified with the rest once the last part has.
+	shape := *event
+	shape.TextHash = ""
+	var invalid *models.ValidationError
+	if err := models.ValidateEvent(&shape); errors.As(err, &invalid) {
+		s.rejectInvalid(w, rejected, invalid)
+		return nil, false
+	}
+
+	switch {
+	case !who.allows(event.SourceDeviceID):
+		s.rejectPush(w, rejected, http.StatusForbidden, who.deviceMismatch())
+		return nil, false
+	case event.Text != "":
+		s.rejectPush(w, rejected, http.StatusBadRequest, "text must be sent in parts, not with the upload")
+		return nil, false
+	case event.TextHash == "":
+		s.rejectPush(w, rejected, http.StatusBadRequest, "text_hash is required for uploads")
+		return nil, false
+	case upload.Size <= 0:
+		s.rejectPush(w, rejected, http.StatusBadRequest, "size must be positive")
+		return nil, false
+	case int64(upload.Size) > maxSize:
+		s.rejectPush(w, rejected, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("size %d exceeds the hub's limit of %d bytes", upload.Size, maxSize))
+		return nil, false
+	case who.guest != nil && upload.Size > maxGuestUploadSize:
+		s.rejectPush(w, rejected, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("size %d exceeds the limit of %d bytes for guests", upload.Size, maxGuestUploadSize))
+		return nil, false
+	}
+	if err := checkSizeLimits(s.cfg.AllSizeLimits(), event, clipSize(event, upload.Size)); err != nil {
+		s.rejectPush(w, rejected, http.StatusRequestEntityTooLarge, err.Error())
+		return nil, false
+	}
+
+	status, err := s.uploads.start(event, upload.Size)
+	switch {
+	case errors.Is(err, errUploadsFull):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return nil, false
+	case errors.Is(err, errDeviceUploads):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return nil, false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return nil, false
+	}
+	if status.Received == 0 {
+		serverLog.Infof("Upload started: id=%s source=%s size=%d", event.EventID, event.SourceDeviceID, upload.Size)
+	}
+	return status, true
+}
+
+// handleUploadChunk appends one part to an upload. The part that completes
+// it is answered like a push (201, or the reason the event was refused);
+// earlier parts get the upload's progress.
+// WHY 409 with the progress for a misplaced part: It is what the agent
+// needs to continue - typically a part sent twice after a lost response.
+func (s *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	who, ok := s.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	eventID := r.URL.Query().Get("event_id")
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if eventID == "" || err != nil || offset < 0 {
+		http.Error(w, "event_id and a non-negative offset are required", http.StatusBadRequest)
+		return
+	}
+
+	part, err := io.ReadAll(http.MaxBytesReader(w, r.Body, wire.ChunkSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("part exceeds %d bytes or was cut off", wire.ChunkSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// WHY capture now: For latency, the hub leg of a chunked push starts
+	// when its last part arrives, like a push's starts with its request.
+	receivedAt := time.Now().UTC()
+	status, event, err := s.uploads.append(eventID, offset, part, who)
+	switch {
+	case errors.Is(err, errUploadNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errUploadNotYours):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, errUploadOffset):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(status)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if event == nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+	serverLog.Infof("Upload complete: id=%s size=%d", event.EventID, status.Size)
+	s.acceptEvent(w, r, event, receivedAt, pushOrigin{caller: who})
+}
@@ -0,0 +1,89 @@
+// Author: Toluwalase Mebaanne
+// Tests for the limits on unfinished uploads.
+//
+// WHY test the store and not the handlers: The caps are what keep one
+// device from taking the hub's memory or every other device's uploads, and
+// they live in uploadStore.start; the handlers only map its errors.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestUploadStoreLimits(t *testing.T) {
+	u := newUploadStore()
+	start := func(id, device string) error {
+		event := testEvent(id, device)
+		event.TextHash = "hash-" + id
+		_, err := u.start(event, 1<<30)
+		return err
+	}
+
+	for i := range maxDeviceUploads {
+		if err := start(fmt.Sprintf("a%d", i), "device-a"); err != nil {
+			t.Fatalf("upload %d of device-a: %v", i, err)
+		}
+	}
+	if err := start("a-extra", "device-a"); !errors.Is(err, errDeviceUploads) {
+		t.Errorf("upload past the per-device cap: err = %v, want errDeviceUploads", err)
+	}
+	// Asking again for an upload in progress is not a new one.
+	if err := start("a0", "device-a"); err != nil {
+		t.Errorf("restarting an existing upload at the cap: %v", err)
+	}
+
+	for i := 0; len(u.uploads) < maxPendingUploads; i++ {
+		if err := start(fmt.Sprintf("o%d", i), fmt.Sprintf("device-%d", i)); err != nil {
+			t.Fatalf("upload of device-%d: %v", i, err)
+		}
+	}
+	if err := start("late", "device-late"); !errors.Is(err, errUploadsFull) {
+		t.Errorf("upload past the hub's cap: err = %v, want errUploadsFull", err)
+	}
+
+	// The announced gigabyte must not be reserved up front.
+	for id, p := range u.uploads {
+		if cap(p.data) != 0 {
+			t.Errorf("upload %s reserved %d bytes before any part arrived", id, cap(p.data))
+		}
+	}
+}
+
+func TestUploadStoreAppend(t *testing.T) {
+	u := newUploadStore()
+	event := testEvent("e1", "device-a")
+	event.TextHash = "hash"
+	if _, err := u.start(event, 6); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		offset   int
+		part     string
+		wantErr  error
+		received int
+	}{
+		{0, "abc", nil, 3},
+		{0, "abc", errUploadOffset, 3},
+		{3, "defg", errUploadOverflow, 3},
+		{3, "def", nil, 6},
+	}
+	for _, tt := range tests {
+		status, done, err := u.append("e1", tt.offset, []byte(tt.part), caller{})
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("append(%d, %q): err = %v, want %v", tt.offset, tt.part, err, tt.wantErr)
+		}
+		if status.Received != tt.received {
+			t.Errorf("append(%d, %q): received %d, want %d", tt.offset, tt.part, status.Received, tt.received)
+		}
+		if done != nil && done.Text != "abcdef" {
+			t.Errorf("finished upload has text %q, want abcdef", done.Text)
+		}
+	}
+	if _, err := u.status("e1"); !errors.Is(err, errUploadNotFound) {
+		t.Errorf("finished upload still pending: err = %v", err)
+	}
+}
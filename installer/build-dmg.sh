@@ -81,8 +81,40 @@ EOF
 create_app_bundle "$INSTALLER_DIR/Install TailClip.command" "$STAGING_DIR" "Install TailClip"
 create_app_bundle "$INSTALLER_DIR/Uninstall TailClip.command" "$RESOURCES_DIR" "Uninstall TailClip"
 
+# Identity bundle for Notification Center
+# WHY: The agent is a bare binary launched by launchd, so macOS has no app to
+# attribute its notifications to. terminal-notifier posts them with
+# -sender com.tailclip.agent, which needs an installed bundle carrying that
+# identifier. The bundle never runs anything itself.
+IDENTITY_APP="$RESOURCES_DIR/TailClip.app"
+mkdir -p "$IDENTITY_APP/Contents/MacOS" "$IDENTITY_APP/Contents/Resources"
+printf '#!/bin/sh\nexit 0\n' > "$IDENTITY_APP/Contents/MacOS/TailClip"
+chmod +x "$IDENTITY_APP/Contents/MacOS/TailClip"
+cp "$PROJECT_ROOT/agent/icons/tailclip.png" "$IDENTITY_APP/Contents/Resources/tailclip.png"
+cat > "$IDENTITY_APP/Contents/Info.plist" << EOF
+<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+    <key>CFBundleExecutable</key>
+    <string>TailClip</string>
+    <key>CFBundleIdentifier</key>
+    <string>com.tailclip.agent</string>
+    <key>CFBundleName</key>
+    <string>TailClip</string>
+    <key>CFBundlePackageType</key>
+    <string>APPL</string>
+    <key>CFBundleShortVersionString</key>
+    <string>1.0</string>
+    <key>LSUIElement</key>
+    <true/>
+</dict>
+</plist>
+EOF
+
 echo "  Created Install TailClip.app (visible)"
 echo "  Created Uninstall TailClip.app (in .resources)"
+echo "  Created TailClip.app notification identity (in .resources)"
 
 # --- Step 4: Set Finder metadata ---
 echo "[4/5] Configuring DMG appearance..."
@@ -78,6 +78,17 @@ func ExtractTokenFromQuery(r *http.Request) string {
 	return r.URL.Query().Get("token")
 }
 
+// ExtractToken returns the token a request carries, preferring the header
+// over the query parameter the same way Authenticate does.
+// WHY: Callers that look a token up (rather than compare it against one
+// expected value) need the same precedence.
+func ExtractToken(r *http.Request) string {
+	if token := ExtractTokenFromHeader(r); token != "" {
+		return token
+	}
+	return ExtractTokenFromQuery(r)
+}
+
 // Authenticate checks both header and query parameter for a valid token.
 // WHY: Provides a single entry point for request authentication, checking
 // the preferred header method first, then falling back to query parameter.
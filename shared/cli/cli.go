@@ -0,0 +1,207 @@
+// Author: Toluwalase Mebaanne
+// Package cli provides what the hub and agent subcommands share: shell
+// completion scripts, machine-readable output, and exit codes.
+//
+// WHY generated completions:
+// Both binaries keep their subcommands in one map (see hub/commands.go and
+// agent/commands.go). Generating the scripts from it means a new command
+// completes as soon as it is added, with no script to keep in sync.
+//
+// WHY --json:
+// The tables the commands print are for people; column widths and previews
+// change. Scripts get the same data as JSON, whose fields only grow.
+//
+// WHY exit codes:
+// A script can't tell "the hub is down" from "wrong token" from "nothing
+// matched" by parsing messages meant for people. Each of those gets its own
+// code, the same in both binaries, so a script can retry, alert, or move on.
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/client"
+)
+
+// JSONFlag is the global flag that switches command output to JSON.
+const JSONFlag = "json"
+
+// Shells lists the shells Completion writes scripts for.
+var Shells = []string{"bash", "zsh", "fish"}
+
+// Exit codes of the hub and agent subcommands.
+const (
+	ExitOK = 0
+	// ExitFailure is any error without a more specific code.
+	ExitFailure = 1
+	// ExitAuth means the hub refused the token (401 or 403).
+	ExitAuth = 3
+	// ExitUnreachable means the hub couldn't be reached or failed (5xx).
+	ExitUnreachable = 4
+	// ExitEmpty means the command worked but found nothing, e.g. a search
+	// without matches.
+	ExitEmpty = 5
+	// ExitFiltered means the content was refused by a content rule: too
+	// large for the hub, or binary or empty locally.
+	ExitFiltered = 6
+	// ExitTampered means `hub integrity` found history changed outside the
+	// hub.
+	ExitTampered = 7
+)
+
+// ExitError makes a command exit with Code.
+// WHY a nil Err: A command that found nothing has already said so (or, in
+// JSON mode, printed an empty list); there is no error to print.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Exit returns an error that makes the command exit with code.
+func Exit(code int, err error) error {
+	return &ExitError{Code: code, Err: err}
+}
+
+// ExitCode returns the exit code for the error a command returned.
+// WHY look at hub errors here: Every command talking to the hub would
+// otherwise have to classify them itself, and some would forget.
+func ExitCode(err error) int {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	var exit *ExitError
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+	var status *client.StatusError
+	if errors.As(err, &status) {
+		switch {
+		case status.StatusCode == http.StatusUnauthorized || status.StatusCode == http.StatusForbidden:
+			return ExitAuth
+		case status.StatusCode == http.StatusRequestEntityTooLarge:
+			return ExitFiltered
+		case status.StatusCode >= 500:
+			return ExitUnreachable
+		}
+		return ExitFailure
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return ExitUnreachable
+	}
+	return ExitFailure
+}
+
+// Silent reports whether err has nothing to print: -h (the flag package
+// printed the usage) or an ExitError without an error.
+func Silent(err error) bool {
+	var exit *ExitError
+	return errors.Is(err, flag.ErrHelp) || (errors.As(err, &exit) && exit.Err == nil)
+}
+
+// Command is a subcommand as completion scripts offer it.
+type Command struct {
+	Name    string
+	Summary string
+}
+
+// CutJSONFlag reports whether args start with --json (or -json) and
+// returns them without it.
+// WHY only in front: After the command name, flags belong to the command,
+// which may define -json itself (see FlagSet.BoolVar on the same variable).
+func CutJSONFlag(args []string) ([]string, bool) {
+	if len(args) > 0 && (args[0] == "--"+JSONFlag || args[0] == "-"+JSONFlag) {
+		return args[1:], true
+	}
+	return args, false
+}
+
+// PrintJSON writes v to stdout as indented JSON.
+func PrintJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Completion writes the completion script for program to w. Commands are
+// completed as the first word, then file names (for the config path).
+func Completion(w io.Writer, shell, program string, commands []Command) error {
+	slices.SortFunc(commands, func(a, b Command) int { return strings.Compare(a.Name, b.Name) })
+	// WHY a prefix: A function named after the binary alone ("_agent",
+	// "_hub") could collide with other tools' completions.
+	fn := "_tailclip_" + strings.NewReplacer("-", "_", ".", "_").Replace(program)
+	switch shell {
+	case "bash":
+		names := make([]string, 0, len(commands)+1)
+		for _, cmd := range commands {
+			names = append(names, cmd.Name)
+		}
+		names = append(names, "--"+JSONFlag)
+		fmt.Fprintf(w, "# bash completion for %s (generated by `%s completion bash`)\n", program, program)
+		fmt.Fprintf(w, "%s() {\n", fn)
+		fmt.Fprintf(w, "    local cur=${COMP_WORDS[COMP_CWORD]} i\n")
+		fmt.Fprintf(w, "    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+		fmt.Fprintf(w, "        case ${COMP_WORDS[i]} in\n")
+		fmt.Fprintf(w, "        -*) ;;\n")
+		fmt.Fprintf(w, "        *) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n")
+		fmt.Fprintf(w, "        esac\n")
+		fmt.Fprintf(w, "    done\n")
+		fmt.Fprintf(w, "    COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+		fmt.Fprintf(w, "}\n")
+		fmt.Fprintf(w, "complete -o filenames -F %s %s\n", fn, program)
+
+	case "zsh":
+		quote := strings.NewReplacer("'", `'\''`, ":", `\:`)
+		fmt.Fprintf(w, "#compdef %s\n", program)
+		fmt.Fprintf(w, "# zsh completion for %s (generated by `%s completion zsh`)\n", program, program)
+		fmt.Fprintf(w, "%s() {\n", fn)
+		fmt.Fprintf(w, "    local state\n")
+		fmt.Fprintf(w, "    local -a commands\n")
+		fmt.Fprintf(w, "    commands=(\n")
+		for _, cmd := range commands {
+			fmt.Fprintf(w, "        '%s:%s'\n", quote.Replace(cmd.Name), quote.Replace(cmd.Summary))
+		}
+		fmt.Fprintf(w, "    )\n")
+		fmt.Fprintf(w, "    _arguments -C '--%s[print machine-readable JSON]' '1: :->command' '*:config file:_files'\n", JSONFlag)
+		fmt.Fprintf(w, "    case $state in\n")
+		fmt.Fprintf(w, "    command) _describe 'command' commands ;;\n")
+		fmt.Fprintf(w, "    esac\n")
+		fmt.Fprintf(w, "}\n")
+		fmt.Fprintf(w, "compdef %s %s\n", fn, program)
+
+	case "fish":
+		quote := strings.NewReplacer(`\`, `\\`, "'", `\'`)
+		fmt.Fprintf(w, "# fish completion for %s (generated by `%s completion fish`)\n", program, program)
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -f -l %s -d 'print machine-readable JSON'\n", program, JSONFlag)
+		for _, cmd := range commands {
+			fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -f -a '%s' -d '%s'\n",
+				program, quote.Replace(cmd.Name), quote.Replace(cmd.Summary))
+		}
+		fmt.Fprintf(w, "complete -c %s -n 'not __fish_use_subcommand' -F\n", program)
+
+	default:
+		return fmt.Errorf("unknown shell %q (supported: %s)", shell, strings.Join(Shells, ", "))
+	}
+	return nil
+}
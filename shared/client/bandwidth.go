@@ -0,0 +1,172 @@
+// Author: Toluwalase Mebaanne
+// Package client provides bandwidth limits and traffic counters for a
+// client's connections to the hub.
+//
+// WHY at the connection:
+// Pushes, chunked uploads, blob downloads, and the WebSocket all share the
+// link, and a limit on some of them would let the others saturate it. Every
+// connection the client dials, HTTP or WebSocket, goes through one pair of
+// limiters and counters, so what they report is what crossed the network,
+// headers and TLS included.
+//
+// WHY a token bucket of one second:
+// It lets small messages (pings, a short clip) through at once while a
+// large image is spread out at the configured rate, instead of delaying
+// everything behind it equally.
+
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// throttleChunk is the most one write passes to the network at a time
+// under a limit.
+// WHY: A single write of a whole file would be charged up front and then
+// sent at full speed; small pieces keep the rate even.
+const throttleChunk = 16 * 1024
+
+// Traffic is what a client has sent to and received from the hub.
+type Traffic struct {
+	SentBytes     int64 `json:"sent_bytes"`
+	ReceivedBytes int64 `json:"received_bytes"`
+}
+
+// meter limits and counts the traffic of a client's connections.
+type meter struct {
+	up, down       *rateLimiter
+	sent, received atomic.Int64
+}
+
+// LimitBandwidth caps the client's upload and download rates, in bytes per
+// second (0 leaves a direction unlimited), and starts counting its traffic
+// (see Traffic). Like UseProxy, it must be called before any request;
+// connections opened earlier are neither limited nor counted.
+func (c *Client) LimitBandwidth(upload, download int) {
+	c.meter = &meter{up: newRateLimiter(upload), down: newRateLimiter(download)}
+	transport := c.transport()
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = c.meter.wrap(dial)
+	// WHY the WebSocket dialer too: It dials its own connections, also
+	// through a proxy, and a clip's broadcast is most of what a device
+	// downloads.
+	wsDial := c.dialer.NetDialContext
+	if wsDial == nil {
+		wsDial = (&net.Dialer{}).DialContext
+	}
+	c.dialer.NetDialContext = c.meter.wrap(wsDial)
+}
+
+// Traffic returns what the client has sent and received since
+// LimitBandwidth; zero without it.
+func (c *Client) Traffic() Traffic {
+	if c.meter == nil {
+		return Traffic{}
+	}
+	return Traffic{SentBytes: c.meter.sent.Load(), ReceivedBytes: c.meter.received.Load()}
+}
+
+// transport returns the client's HTTP transport, setting up a copy of the
+// default one the first time.
+func (c *Client) transport() *http.Transport {
+	if transport, ok := c.http.Transport.(*http.Transport); ok {
+		return transport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	c.http.Transport = transport
+	return transport
+}
+
+// wrap returns dial with its connections limited and counted by m.
+func (m *meter) wrap(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &meteredConn{Conn: conn, meter: m}, nil
+	}
+}
+
+// meteredConn is a connection whose reads and writes go through a meter.
+type meteredConn struct {
+	net.Conn
+	meter *meter
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	if c.meter.down != nil && len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := c.Conn.Read(p)
+	c.meter.received.Add(int64(n))
+	// WHY wait after reading: How much will arrive isn't known before, so
+	// the wait is for what did; the next read starts that much later.
+	c.meter.down.wait(n)
+	return n, err
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		part := p
+		if c.meter.up != nil && len(part) > throttleChunk {
+			part = part[:throttleChunk]
+		}
+		c.meter.up.wait(len(part))
+		n, err := c.Conn.Write(part)
+		written += n
+		c.meter.sent.Add(int64(n))
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// rateLimiter is a token bucket holding one second of its rate.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter for bytesPerSecond, or nil (unlimited)
+// for 0 or less.
+func newRateLimiter(bytesPerSecond int) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond), last: time.Now()}
+}
+
+// wait takes n bytes from the bucket, sleeping until they are covered when
+// it runs short. A nil limiter returns at once.
+// WHY let the bucket go negative: Concurrent connections then queue up
+// behind each other's debt instead of all waking at once.
+func (l *rateLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
@@ -0,0 +1,482 @@
+// Author: Toluwalase Mebaanne
+// Package client is a typed Go client for the TailClip hub API.
+//
+// WHY a shared client package:
+// The agent, scripts, and any dashboard backend all talk to the same
+// handful of endpoints. Each reimplementing the requests means each gets
+// the auth header, status codes, and WebSocket URL slightly differently
+// wrong. One client keeps the wire details in one place; callers decide
+// what to log and how to retry.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tmair/tailclip/shared/models"
+	"github.com/tmair/tailclip/shared/wire"
+)
+
+// Client talks to one hub with one auth token. It is safe for concurrent
+// use, except for UseProxy, which must be called before any request.
+type Client struct {
+	hubURL    string
+	authToken string
+	http      *http.Client
+	dialer    *websocket.Dialer
+	// meter limits and counts traffic after LimitBandwidth; nil before.
+	meter *meter
+}
+
+// StatusError is returned when the hub answers with an unexpected status.
+// WHY a type: Callers react to specific statuses (e.g., 413 means the
+// hub's text limit changed) without parsing error strings.
+type StatusError struct {
+	// Op names the request, e.g. "push".
+	Op         string
+	StatusCode int
+	// Body is the start of the hub's response; the hub explains refusals
+	// (e.g., "device disabled") in plain text.
+	Body string
+	// Problem is Body decoded, when the hub sent a structured error (e.g.,
+	// which field of a pushed event was invalid); nil otherwise.
+	Problem *wire.ErrorResponse
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("hub returned status %d on %s", e.StatusCode, e.Op)
+	}
+	return fmt.Sprintf("hub returned status %d on %s: %s", e.StatusCode, e.Op, e.Body)
+}
+
+// SubscribeOptions configures the WebSocket connection opened by Subscribe.
+type SubscribeOptions struct {
+	// DeviceID identifies the subscriber; the hub never sends a device its
+	// own clips.
+	DeviceID string
+
+	// Channels limits delivery to clips on these channels. Empty means the
+	// default channel.
+	Channels []string
+
+	// Features lists the models.WebSocketFeature* values to request.
+	// Without them the hub sends only bare events.
+	Features []string
+
+	// ResumeToken and LastSeq resume a previous session (see
+	// models.Session) so the hub replays what it missed. Empty starts a
+	// new session.
+	ResumeToken string
+	LastSeq     uint64
+
+	// SnapshotLimit is how many events the Snapshot message holds when
+	// models.WebSocketFeatureSnapshot is requested; 0 means the hub's
+	// default (20).
+	SnapshotLimit int
+}
+
+// New creates a Client for the hub at hubURL (e.g. "http://100.64.0.1:8080").
+//
+// WHY a 10 second timeout:
+// Without a timeout, a hung hub would block the caller forever. 10 seconds
+// is generous for a LAN/Tailnet round trip.
+func New(hubURL, authToken string) *Client {
+	// WHY a copy of the default dialer: UseProxy changes it, and the
+	// default is shared package state.
+	dialer := *websocket.DefaultDialer
+	return &Client{
+		hubURL:    strings.TrimRight(hubURL, "/"),
+		authToken: authToken,
+		http:      &http.Client{Timeout: 10 * time.Second},
+		dialer:    &dialer,
+	}
+}
+
+// UseProxy routes requests and WebSocket connections through proxyURL
+// instead of the proxy environment variables.
+// WHY both transports: The WebSocket dialer doesn't use the HTTP client, and
+// a proxy that only covered pushes would leave the caller unable to receive.
+func (c *Client) UseProxy(proxyURL *url.URL) {
+	c.transport().Proxy = http.ProxyURL(proxyURL)
+	c.dialer.Proxy = http.ProxyURL(proxyURL)
+}
+
+// Capabilities asks the hub which limits it enforces.
+func (c *Client) Capabilities() (*models.Capabilities, error) {
+	var caps models.Capabilities
+	if err := c.do(http.MethodGet, "/api/v1/capabilities", nil, http.StatusOK, "capabilities", &caps); err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+// Push sends a clipboard event to the hub, which stores and broadcasts it.
+func (c *Client) Push(event *models.Event) error {
+	return c.do(http.MethodPost, "/api/v1/clipboard/push", event, http.StatusCreated, "push", nil)
+}
+
+// Relay forwards a clip to a federated hub, which stores and broadcasts it
+// in the channel linked to this one. The client's token must be the link's
+// token (see config.FederationLink), not an auth_token.
+func (c *Client) Relay(event *models.Event) error {
+	return c.do(http.MethodPost, "/api/v1/federation/relay", event, http.StatusCreated, "relay", nil)
+}
+
+// Register announces a device to the hub, creating or refreshing its row.
+func (c *Client) Register(device *models.Device) error {
+	return c.do(http.MethodPost, "/api/v1/device/register", device, http.StatusCreated, "register", nil)
+}
+
+// Enroll registers device and asks the hub to issue it a device token,
+// which the client must be using the hub's shared token to do. The token
+// is returned only this once; it is "" if the device already has one.
+func (c *Client) Enroll(device *models.Device) (string, error) {
+	var response struct {
+		Message     string `json:"message"`
+		DeviceToken string `json:"device_token"`
+	}
+	if err := c.do(http.MethodPost, "/api/v1/device/register?issue_token=true", device, http.StatusCreated, "enroll", &response); err != nil {
+		return "", err
+	}
+	return response.DeviceToken, nil
+}
+
+// RevokeDeviceToken revokes a device's token and disconnects the device.
+// It needs the hub's shared token.
+func (c *Client) RevokeDeviceToken(deviceID string) error {
+	return c.do(http.MethodDelete, "/api/v1/devices/"+url.PathEscape(deviceID)+"/token", nil, http.StatusNoContent, "revoke device token", nil)
+}
+
+// HistoryOptions selects the events History returns. The zero value asks
+// for the hub's default page of newest events.
+type HistoryOptions struct {
+	// Query keeps only events whose text, file name, or note matches it.
+	Query string
+	// Pinned keeps only pinned events.
+	Pinned bool
+	// PinnedFor keeps only events pinned for this device (see PinEventFor).
+	PinnedFor string
+	// MetaOnly leaves out the events' text and formats; fetch the content
+	// of the ones needed with Event.
+	MetaOnly bool
+	// Limit and Offset select the page; a zero Limit means the hub's
+	// default (history_page_size).
+	Limit  int
+	Offset int
+	// Since and SinceEventID return only events at or after a time, or
+	// after an event, oldest first. An unknown SinceEventID is a 404
+	// StatusError.
+	Since        time.Time
+	SinceEventID string
+}
+
+// Devices returns the devices registered with the hub and their status.
+func (c *Client) Devices() ([]models.DeviceStatus, error) {
+	var devices []models.DeviceStatus
+	if err := c.do(http.MethodGet, "/api/v1/devices", nil, http.StatusOK, "devices", &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// History returns events from the hub's history, newest first unless opts
+// asks for events since a point.
+func (c *Client) History(opts HistoryOptions) ([]models.Event, error) {
+	params := url.Values{}
+	if opts.Query != "" {
+		params.Set("q", opts.Query)
+	}
+	if opts.Pinned {
+		params.Set("pinned", "true")
+	}
+	if opts.PinnedFor != "" {
+		params.Set("pinned_for", opts.PinnedFor)
+	}
+	if opts.MetaOnly {
+		params.Set("fields", "meta")
+	}
+	if opts.Limit > 0 {
+		params.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		params.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	if !opts.Since.IsZero() {
+		params.Set("since", opts.Since.UTC().Format(time.RFC3339))
+	}
+	if opts.SinceEventID != "" {
+		params.Set("since_event_id", opts.SinceEventID)
+	}
+	path := "/api/v1/history"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	var events []models.Event
+	if err := c.do(http.MethodGet, path, nil, http.StatusOK, "history", &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Event returns one event from the hub's history, or nil if there is no
+// such event (never stored, deleted, or pruned).
+func (c *Client) Event(eventID string) (*models.Event, error) {
+	var event models.Event
+	err := c.do(http.MethodGet, "/api/v1/events/"+url.PathEscape(eventID), nil, http.StatusOK, "event", &event)
+	var status *StatusError
+	if errors.As(err, &status) && status.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Blob downloads the text of a file clip the hub keeps in its blob store
+// from its models.Event.BlobURL, refusing more than limit bytes.
+// WHY the token only on the hub's own paths: A full URL is presigned for
+// the bucket, which has no business seeing the hub's token.
+func (c *Client) Blob(blobURL string, limit int64) (string, error) {
+	target := blobURL
+	if strings.HasPrefix(blobURL, "/") {
+		target = c.hubURL + blobURL
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob request: %w", err)
+	}
+	if target != blobURL {
+		req.Header.Set("X-Auth-Token", c.authToken)
+	}
+	// WHY no client timeout: A file of max_file_size over a slow link takes
+	// longer than any request to the hub should.
+	httpClient := *c.http
+	httpClient.Timeout = 0
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("blob request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return "", &StatusError{Op: "blob", StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(reason))}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read blob: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return "", fmt.Errorf("blob exceeds %d bytes", limit)
+	}
+	return string(data), nil
+}
+
+// DeleteEvent permanently removes an event from the hub's history. The hub
+// tells connected agents, which clear the clip from their clipboards if it
+// is still there.
+func (c *Client) DeleteEvent(eventID string) error {
+	return c.do(http.MethodDelete, "/api/v1/events/"+url.PathEscape(eventID), nil, http.StatusNoContent, "delete event", nil)
+}
+
+// PinEvent pins an event, keeping it in the hub's history regardless of
+// retention, or unpins it.
+func (c *Client) PinEvent(eventID string, pinned bool) error {
+	method := http.MethodPut
+	if !pinned {
+		method = http.MethodDelete
+	}
+	return c.do(method, "/api/v1/events/"+url.PathEscape(eventID)+"/pin", nil, http.StatusNoContent, "pin event", nil)
+}
+
+// PinEventFor pins an event for deviceID, which keeps it in its quick-access
+// list, or unpins it. A device token may only pin for its own device.
+func (c *Client) PinEventFor(eventID, deviceID string, pinned bool) error {
+	method := http.MethodPut
+	if !pinned {
+		method = http.MethodDelete
+	}
+	path := "/api/v1/events/" + url.PathEscape(eventID) + "/pin?device=" + url.QueryEscape(deviceID)
+	return c.do(method, path, nil, http.StatusNoContent, "pin event", nil)
+}
+
+// Latest returns the newest event in the hub's history, or nil if the
+// history is empty.
+func (c *Client) Latest() (*models.Event, error) {
+	events, err := c.History(HistoryOptions{Limit: 1})
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return &events[0], nil
+}
+
+// DataKey returns the wrapped data key keyID, or nil if the hub has none
+// (never created, or shredded).
+func (c *Client) DataKey(keyID string) (*models.DataKey, error) {
+	return c.dataKey(url.Values{"key_id": {keyID}})
+}
+
+// LatestDataKey returns the newest data key of keyID's day, or nil if the
+// day has none. A hub from before key generations returns keyID itself.
+func (c *Client) LatestDataKey(keyID string) (*models.DataKey, error) {
+	return c.dataKey(url.Values{"key_id": {keyID}, "latest": {"true"}})
+}
+
+// dataKey fetches the data key selected by query, or nil on 404.
+func (c *Client) dataKey(query url.Values) (*models.DataKey, error) {
+	var key models.DataKey
+	err := c.do(http.MethodGet, "/api/v1/keys?"+query.Encode(), nil, http.StatusOK, "data key", &key)
+	var status *StatusError
+	if errors.As(err, &status) && status.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// AddDataKey uploads a wrapped data key and returns the one the hub stores
+// for that day, which is another agent's if it was first.
+func (c *Client) AddDataKey(key *models.DataKey) (*models.DataKey, error) {
+	var stored models.DataKey
+	if err := c.do(http.MethodPost, "/api/v1/keys", key, http.StatusOK, "data key upload", &stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// Announce sends an operator's message to the connected devices, or only
+// deviceIDs when given, and returns how many it reached. Needs the hub's
+// shared token.
+func (c *Client) Announce(message string, deviceIDs []string) (int, error) {
+	var result models.AnnounceResult
+	req := &models.Announce{Message: message, DeviceIDs: deviceIDs}
+	if err := c.do(http.MethodPost, "/api/v1/admin/announce", req, http.StatusOK, "announce", &result); err != nil {
+		return 0, err
+	}
+	return result.Delivered, nil
+}
+
+// DataKeys returns every wrapped data key on the hub, oldest day first.
+func (c *Client) DataKeys() ([]models.DataKey, error) {
+	var keys []models.DataKey
+	if err := c.do(http.MethodGet, "/api/v1/keys", nil, http.StatusOK, "data keys", &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RewrapDataKey replaces a data key's wrapped form after the shared key was
+// rotated. The hub answers 409 if the key is no longer stored as
+// rewrap.Previous.
+func (c *Client) RewrapDataKey(rewrap *models.DataKeyRewrap) (*models.DataKey, error) {
+	var stored models.DataKey
+	if err := c.do(http.MethodPut, "/api/v1/keys", rewrap, http.StatusOK, "data key rewrap", &stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// Subscribe opens the hub WebSocket for real-time delivery. The caller
+// reads messages from the returned connection and closes it when done.
+// WHY hand back the connection: Subscribers differ in which message types
+// they handle and what they send back (e.g., latency reports), so decoding
+// stays with them.
+//
+// WHY the token goes in the query string:
+// Many WebSocket clients can't set custom headers on the upgrade request
+// reliably across platforms, so the hub accepts ?token= (see
+// shared/auth/token.go).
+func (c *Client) Subscribe(opts SubscribeOptions) (*websocket.Conn, error) {
+	// WHY replace the scheme: The gorilla/websocket dialer expects ws:// or
+	// wss://.
+	wsURL, err := url.Parse(c.hubURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse hub URL: %w", err)
+	}
+	switch wsURL.Scheme {
+	case "https":
+		wsURL.Scheme = "wss"
+	default:
+		wsURL.Scheme = "ws"
+	}
+	wsURL.Path = "/api/v1/ws"
+
+	query := url.Values{}
+	query.Set("token", c.authToken)
+	query.Set("device_id", opts.DeviceID)
+	query.Set("channels", strings.Join(opts.Channels, ","))
+	query.Set("features", strings.Join(opts.Features, ","))
+	query.Set("wire", strconv.Itoa(wire.Version))
+	if opts.ResumeToken != "" {
+		query.Set("resume", opts.ResumeToken)
+		query.Set("last_seq", fmt.Sprint(opts.LastSeq))
+	}
+	if opts.SnapshotLimit > 0 {
+		query.Set("snapshot_limit", strconv.Itoa(opts.SnapshotLimit))
+	}
+	wsURL.RawQuery = query.Encode()
+
+	conn, _, err := c.dialer.Dial(wsURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("WebSocket dial failed: %w", err)
+	}
+	return conn, nil
+}
+
+// do sends an authenticated request with body (if non-nil) encoded as JSON,
+// or as is when it is a []byte, checks for the wanted status, and decodes the response into out (if
+// non-nil). op names the request in errors.
+func (c *Client) do(method, path string, body any, want int, op string, out any) error {
+	var reader io.Reader
+	contentType := "application/json"
+	if raw, ok := body.([]byte); ok {
+		reader = bytes.NewReader(raw)
+		contentType = "application/octet-stream"
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s request: %w", op, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.hubURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", op, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-Auth-Token", c.authToken)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return &StatusError{Op: op, StatusCode: resp.StatusCode,
+			Body: strings.TrimSpace(string(reason)), Problem: wire.DecodeError(reason)}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", op, err)
+		}
+	}
+	return nil
+}
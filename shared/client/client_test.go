@@ -0,0 +1,303 @@
+// Author: Toluwalase Mebaanne
+// Tests for the hub client against a fake hub.
+//
+// WHY httptest instead of the real hub: These tests pin down the HTTP
+// contract - paths, headers, query parameters, status handling - from the
+// client's side. The hub's own behavior is not what's under test, and an
+// httptest server shows exactly what the client sent.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+	"github.com/tmair/tailclip/shared/wire"
+)
+
+const testToken = "secret-token-abcdefgh"
+
+// fakeHub answers every request with status and body, and keeps the last
+// request and its body for the test to inspect.
+type fakeHub struct {
+	status int
+	body   string
+
+	request     *http.Request
+	requestBody []byte
+}
+
+func (f *fakeHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.request = r
+	f.requestBody, _ = io.ReadAll(r.Body)
+	w.WriteHeader(f.status)
+	io.WriteString(w, f.body)
+}
+
+// newFakeHub starts a fake hub and returns a client for it.
+// WHY a trailing slash on the URL: Configs often have one, and New must
+// not turn it into "//api/v1/..." paths.
+func newFakeHub(t *testing.T, status int, body string) (*fakeHub, *Client) {
+	t.Helper()
+	hub := &fakeHub{status: status, body: body}
+	srv := httptest.NewServer(hub)
+	t.Cleanup(srv.Close)
+	return hub, New(srv.URL+"/", testToken)
+}
+
+// checkRequest verifies the method, path, and auth header of the last
+// request.
+func checkRequest(t *testing.T, hub *fakeHub, method, path string) {
+	t.Helper()
+	if hub.request == nil {
+		t.Fatal("no request reached the hub")
+	}
+	if hub.request.Method != method || hub.request.URL.Path != path {
+		t.Errorf("request = %s %s, want %s %s", hub.request.Method, hub.request.URL.Path, method, path)
+	}
+	if got := hub.request.Header.Get("X-Auth-Token"); got != testToken {
+		t.Errorf("X-Auth-Token = %q, want %q", got, testToken)
+	}
+}
+
+func testEvent() *models.Event {
+	return &models.Event{
+		EventID:        "evt-1",
+		SourceDeviceID: "laptop",
+		Timestamp:      time.Date(2026, 3, 14, 9, 26, 53, 0, time.UTC),
+		ContentType:    models.ContentTypeText,
+		Text:           "hello",
+		TextHash:       "2cf2",
+	}
+}
+
+func TestPush(t *testing.T) {
+	hub, c := newFakeHub(t, http.StatusCreated, `{"message":"stored"}`)
+	if err := c.Push(testEvent()); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	checkRequest(t, hub, http.MethodPost, "/api/v1/clipboard/push")
+	if got := hub.request.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var sent models.Event
+	if err := json.Unmarshal(hub.requestBody, &sent); err != nil {
+		t.Fatalf("request body %q: %v", hub.requestBody, err)
+	}
+	if sent.EventID != "evt-1" || sent.Text != "hello" || sent.SourceDeviceID != "laptop" {
+		t.Errorf("hub received %+v, want the pushed event", sent)
+	}
+}
+
+// TestStatusError checks how refusals are decoded: plain text bodies, the
+// structured invalid-event body, empty bodies, and long bodies.
+func TestStatusError(t *testing.T) {
+	long := strings.Repeat("x", 1000)
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    StatusError
+		wantMsg string
+	}{
+		{
+			name:    "plain text",
+			status:  http.StatusForbidden,
+			body:    "device disabled\n",
+			want:    StatusError{Op: "push", StatusCode: http.StatusForbidden, Body: "device disabled"},
+			wantMsg: "hub returned status 403 on push: device disabled",
+		},
+		{
+			name:   "structured",
+			status: http.StatusBadRequest,
+			body:   `{"error":"invalid event","field":"text","reason":"exceeds 1048576 bytes"}`,
+			want: StatusError{Op: "push", StatusCode: http.StatusBadRequest,
+				Body:    `{"error":"invalid event","field":"text","reason":"exceeds 1048576 bytes"}`,
+				Problem: &wire.ErrorResponse{Error: "invalid event", Field: "text", Reason: "exceeds 1048576 bytes"}},
+			wantMsg: `hub returned status 400 on push: {"error":"invalid event","field":"text","reason":"exceeds 1048576 bytes"}`,
+		},
+		{
+			name:    "empty",
+			status:  http.StatusUnauthorized,
+			body:    "",
+			want:    StatusError{Op: "push", StatusCode: http.StatusUnauthorized},
+			wantMsg: "hub returned status 401 on push",
+		},
+		{
+			name:    "truncated",
+			status:  http.StatusInternalServerError,
+			body:    long,
+			want:    StatusError{Op: "push", StatusCode: http.StatusInternalServerError, Body: long[:256]},
+			wantMsg: "hub returned status 500 on push: " + long[:256],
+		},
+		{
+			name:    "unexpected success",
+			status:  http.StatusOK,
+			body:    "ok",
+			want:    StatusError{Op: "push", StatusCode: http.StatusOK, Body: "ok"},
+			wantMsg: "hub returned status 200 on push: ok",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, c := newFakeHub(t, tt.status, tt.body)
+			err := c.Push(testEvent())
+			var status *StatusError
+			if !errors.As(err, &status) {
+				t.Fatalf("Push = %v, want a *StatusError", err)
+			}
+			if status.Op != tt.want.Op || status.StatusCode != tt.want.StatusCode || status.Body != tt.want.Body {
+				t.Errorf("StatusError = {%q %d %q}, want {%q %d %q}",
+					status.Op, status.StatusCode, status.Body, tt.want.Op, tt.want.StatusCode, tt.want.Body)
+			}
+			switch {
+			case tt.want.Problem == nil && status.Problem != nil:
+				t.Errorf("Problem = %+v, want nil", status.Problem)
+			case tt.want.Problem != nil && (status.Problem == nil || *status.Problem != *tt.want.Problem):
+				t.Errorf("Problem = %+v, want %+v", status.Problem, tt.want.Problem)
+			}
+			if err.Error() != tt.wantMsg {
+				t.Errorf("Error() = %q, want %q", err.Error(), tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestPushUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	hubURL := srv.URL
+	srv.Close()
+
+	err := New(hubURL, testToken).Push(testEvent())
+	var status *StatusError
+	if err == nil || errors.As(err, &status) {
+		t.Errorf("Push to a closed port = %v, want a connection error", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	since := time.Date(2026, 3, 14, 10, 0, 0, 0, time.FixedZone("CET", 3600))
+	tests := []struct {
+		name string
+		opts HistoryOptions
+		want url.Values
+	}{
+		{"default", HistoryOptions{}, url.Values{}},
+		{"search", HistoryOptions{Query: "api key", Limit: 5}, url.Values{"q": {"api key"}, "limit": {"5"}}},
+		{"page", HistoryOptions{Limit: 20, Offset: 40}, url.Values{"limit": {"20"}, "offset": {"40"}}},
+		{"pinned", HistoryOptions{Pinned: true, PinnedFor: "phone"}, url.Values{"pinned": {"true"}, "pinned_for": {"phone"}}},
+		{"meta only", HistoryOptions{MetaOnly: true}, url.Values{"fields": {"meta"}}},
+		{"since time in UTC", HistoryOptions{Since: since}, url.Values{"since": {"2026-03-14T09:00:00Z"}}},
+		{"since event", HistoryOptions{SinceEventID: "evt-0"}, url.Values{"since_event_id": {"evt-0"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal([]models.Event{*testEvent()})
+			hub, c := newFakeHub(t, http.StatusOK, string(body))
+			events, err := c.History(tt.opts)
+			if err != nil {
+				t.Fatalf("History: %v", err)
+			}
+			checkRequest(t, hub, http.MethodGet, "/api/v1/history")
+			if got := hub.request.URL.Query(); got.Encode() != tt.want.Encode() {
+				t.Errorf("query = %q, want %q", got.Encode(), tt.want.Encode())
+			}
+			if len(events) != 1 || events[0].EventID != "evt-1" || events[0].Text != "hello" {
+				t.Errorf("History = %+v, want evt-1", events)
+			}
+		})
+	}
+}
+
+func TestHistoryErrors(t *testing.T) {
+	_, c := newFakeHub(t, http.StatusNotFound, "unknown since_event_id\n")
+	_, err := c.History(HistoryOptions{SinceEventID: "gone"})
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusNotFound || status.Op != "history" {
+		t.Errorf("History with an unknown event = %v, want a 404 StatusError", err)
+	}
+
+	_, c = newFakeHub(t, http.StatusOK, "[{")
+	if _, err := c.History(HistoryOptions{}); err == nil || !strings.Contains(err.Error(), "failed to decode history response") {
+		t.Errorf("History with a malformed body = %v, want a decode error", err)
+	}
+}
+
+func TestLatest(t *testing.T) {
+	body, _ := json.Marshal([]models.Event{*testEvent()})
+	hub, c := newFakeHub(t, http.StatusOK, string(body))
+	event, err := c.Latest()
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	checkRequest(t, hub, http.MethodGet, "/api/v1/history")
+	if got := hub.request.URL.Query().Get("limit"); got != "1" {
+		t.Errorf("limit = %q, want 1", got)
+	}
+	if event == nil || event.EventID != "evt-1" {
+		t.Errorf("Latest = %+v, want evt-1", event)
+	}
+
+	_, c = newFakeHub(t, http.StatusOK, "[]")
+	if event, err := c.Latest(); event != nil || err != nil {
+		t.Errorf("Latest with an empty history = %+v, %v, want nil, nil", event, err)
+	}
+
+	_, c = newFakeHub(t, http.StatusUnauthorized, "unauthorized")
+	var status *StatusError
+	if _, err := c.Latest(); !errors.As(err, &status) || status.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Latest refused = %v, want a 401 StatusError", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	hub, c := newFakeHub(t, http.StatusCreated, `{"message":"registered"}`)
+	device := &models.Device{DeviceID: "laptop", DeviceName: "Laptop", TailscaleIP: "100.64.0.2"}
+	if err := c.Register(device); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	checkRequest(t, hub, http.MethodPost, "/api/v1/device/register")
+	var sent models.Device
+	if err := json.Unmarshal(hub.requestBody, &sent); err != nil {
+		t.Fatalf("request body %q: %v", hub.requestBody, err)
+	}
+	if sent.DeviceID != "laptop" || sent.DeviceName != "Laptop" || sent.TailscaleIP != "100.64.0.2" {
+		t.Errorf("hub received %+v, want %+v", sent, device)
+	}
+
+	_, c = newFakeHub(t, http.StatusForbidden, "device laptop is disabled\n")
+	var status *StatusError
+	if err := c.Register(device); !errors.As(err, &status) || status.Op != "register" || status.Body != "device laptop is disabled" {
+		t.Errorf("Register refused = %v, want a register StatusError", err)
+	}
+}
+
+// TestIPv6HubURL checks that a bracketed IPv6 hub URL reaches the hub.
+func TestIPv6HubURL(t *testing.T) {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	hub := &fakeHub{status: http.StatusCreated}
+	srv := httptest.NewUnstartedServer(hub)
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+
+	if !strings.HasPrefix(srv.URL, "http://[::1]:") {
+		t.Fatalf("server URL = %q, want a bracketed IPv6 URL", srv.URL)
+	}
+	if err := New(srv.URL, testToken).Push(testEvent()); err != nil {
+		t.Fatalf("Push to %s: %v", srv.URL, err)
+	}
+	checkRequest(t, hub, http.MethodPost, "/api/v1/clipboard/push")
+}
@@ -0,0 +1,127 @@
+// Author: Toluwalase Mebaanne
+// Package client provides chunked, resumable pushes of large clips.
+//
+// WHY a separate file:
+// A chunked push is a small protocol of its own - start, parts, and asking
+// the hub where to continue after a failure - on top of the plain requests
+// in client.go.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// maxChunkRetries is how many failed requests PushChunked rides out before
+// giving up on an upload.
+// WHY a few and not forever: The caller has its own retry loop; this only
+// keeps a blip from throwing away the parts already sent.
+const maxChunkRetries = 3
+
+// StartUpload begins a chunked push, or returns the progress of one the hub
+// already has for the same event.
+func (c *Client) StartUpload(upload *models.Upload) (*models.UploadStatus, error) {
+	var status models.UploadStatus
+	if err := c.do(http.MethodPost, "/api/v1/uploads", upload, http.StatusOK, "upload start", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// UploadStatus returns how much of an upload the hub holds. A finished,
+// expired, or unknown upload is a *StatusError with status 404.
+func (c *Client) UploadStatus(eventID string) (*models.UploadStatus, error) {
+	var status models.UploadStatus
+	if err := c.do(http.MethodGet, "/api/v1/uploads?event_id="+url.QueryEscape(eventID), nil, http.StatusOK, "upload status", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// UploadChunk sends the part of an upload's text starting at offset. last
+// says whether the part completes it; the hub then stores the event and
+// answers like a push.
+func (c *Client) UploadChunk(eventID string, offset int, part []byte, last bool) error {
+	path := fmt.Sprintf("/api/v1/uploads/chunk?event_id=%s&offset=%d", url.QueryEscape(eventID), offset)
+	want := http.StatusOK
+	if last {
+		want = http.StatusCreated
+	}
+	return c.do(http.MethodPost, path, part, want, "upload chunk", nil)
+}
+
+// PushChunked pushes event like Push, sending its text in parts of at most
+// chunkSize bytes. After a failed part it asks the hub how much arrived and
+// continues from there.
+// WHY start over on 404: The upload expired, the hub restarted, or the
+// last part went through and only its answer was lost. Pushing again is
+// safe in every case - the hub ignores an event ID it already stored.
+func (c *Client) PushChunked(event *models.Event, chunkSize int) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	upload := models.Upload{Event: *event, Size: len(event.Text)}
+	upload.Event.Text = ""
+	if upload.Event.TextHash == "" {
+		upload.Event.TextHash = event.ComputeTextHash()
+	}
+	text := []byte(event.Text)
+
+	var status *models.UploadStatus
+	failures := 0
+	for {
+		var err error
+		if status == nil {
+			status, err = c.StartUpload(&upload)
+		} else {
+			end := min(status.Received+chunkSize, len(text))
+			last := end == len(text)
+			err = c.UploadChunk(event.EventID, status.Received, text[status.Received:end], last)
+			switch {
+			case err == nil && last:
+				return nil
+			case err == nil:
+				status.Received = end
+				continue
+			case retryableChunkError(err):
+				// WHY drop the progress: It may be stale; it is asked for
+				// again below, after the backoff.
+				status = nil
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if !retryableChunkError(err) {
+			return err
+		}
+		if failures++; failures > maxChunkRetries {
+			return fmt.Errorf("upload failed after %d retries: %w", maxChunkRetries, err)
+		}
+		time.Sleep(time.Duration(failures) * time.Second)
+
+		var statusErr *StatusError
+		if status, err = c.UploadStatus(event.EventID); errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			status = nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// retryableChunkError reports whether a failed upload request is worth
+// resuming: network errors, and the hub saying a part was misplaced or the
+// upload is gone. Anything else is the hub refusing the clip.
+func retryableChunkError(err error) bool {
+	var status *StatusError
+	if !errors.As(err, &status) {
+		return true
+	}
+	return status.StatusCode == http.StatusConflict || status.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,255 @@
+// Author: Toluwalase Mebaanne
+// Package e2e provides end-to-end encryption of clipboard events between
+// agents that share a key.
+//
+// WHY encrypt on the agents:
+// The hub stores clipboard history on disk and sees every clip in memory.
+// For some households that machine is also the least trusted one - a VPS, a
+// shared home server. With a shared key only the agents can read clips; the
+// hub stores and broadcasts ciphertext and never needs the key.
+//
+// WHAT THE HUB STILL SEES: routing metadata - event ID, source device,
+// channel, content type, timestamps, and the size of the ciphertext. Text,
+// rich text formats, and file names are sealed.
+//
+// WHY AES-256-GCM from the standard library: It is authenticated (a hub
+// can't alter a clip without detection) and needs no extra module. The event
+// ID, source device, and content type are bound in as associated data, so a
+// hub can't replay a sealed clip under another event or device either.
+//
+// DATA KEYS: Clips are normally sealed with a random per-day data key rather
+// than the shared key itself; the data key is stored on the hub wrapped with
+// the shared key (see models.DataKey). Seal and Open take whichever key the
+// caller chose.
+
+package e2e
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// KeySize is the length in bytes of an encryption key.
+const KeySize = 32
+
+// Overhead is how many bytes sealing adds to a payload before base64
+// encoding: the GCM nonce and authentication tag.
+const Overhead = 12 + 16
+
+// ErrDecrypt is returned (wrapped) by Open and UnwrapKey when the
+// ciphertext doesn't authenticate, usually because the sender uses a
+// different key.
+var ErrDecrypt = errors.New("cannot decrypt (different encryption_key?)")
+
+// payload is what gets sealed: every field the hub must not read.
+type payload struct {
+	Text     string            `json:"text"`
+	Formats  map[string]string `json:"formats,omitempty"`
+	FileName string            `json:"file_name,omitempty"`
+}
+
+// GenerateKey returns a new random key in the form ParseKey accepts.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes a key: base64 of KeySize bytes, or a phrase made by
+// FormatPhrase.
+// WHY no passphrases: A memorable passphrase would need a slow key
+// derivation to resist guessing by whoever holds the ciphertext - the hub.
+// A random key copied between machines, like the auth token, avoids that.
+func ParseKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		// WHY fall back only on a decoding error: Phrases contain dashes,
+		// which base64 never does, so they always end up here.
+		if strings.Contains(encoded, "-") {
+			return parsePhrase(encoded)
+		}
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d (generate one with `agent keys generate`)", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// Seal returns a copy of event with its text, formats, and file name
+// encrypted into Text and Encrypted set. The hash covers the ciphertext.
+func Seal(key []byte, event *models.Event) (*models.Event, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	// WHY no HTML escaping: It turns every < and > of an HTML format into
+	// six bytes, eating into the hub's size limit for nothing.
+	var plaintext bytes.Buffer
+	enc := json.NewEncoder(&plaintext)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(payload{Text: event.Text, Formats: event.Formats, FileName: event.FileName}); err != nil {
+		return nil, fmt.Errorf("failed to encode clip: %w", err)
+	}
+	ciphertext, err := seal(aead, plaintext.Bytes(), associatedData(event))
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := *event
+	sealed.Text = ciphertext
+	sealed.Formats = nil
+	sealed.FileName = ""
+	sealed.Encrypted = true
+	sealed.SetTextHash()
+	return &sealed, nil
+}
+
+// Open decrypts a sealed event in place, restoring its text, formats, and
+// file name, and recomputes the hash over the plaintext. The event is then
+// an ordinary clip: Encrypted and KeyID are cleared.
+func Open(key []byte, event *models.Event) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := open(aead, event.Text, associatedData(event))
+	if err != nil {
+		return err
+	}
+	var p payload
+	if err := json.Unmarshal(plaintext, &p); err != nil {
+		return fmt.Errorf("failed to decode decrypted clip: %w", err)
+	}
+
+	event.Text = p.Text
+	event.Formats = p.Formats
+	event.FileName = p.FileName
+	event.Encrypted = false
+	event.KeyID = ""
+	event.SetTextHash()
+	return nil
+}
+
+// NewDataKey returns a new random data key.
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, nil
+}
+
+// WrapKey encrypts the data key keyID with the shared key, for storing on
+// the hub.
+func WrapKey(sharedKey []byte, keyID string, dataKey []byte) (string, error) {
+	aead, err := newAEAD(sharedKey)
+	if err != nil {
+		return "", err
+	}
+	return seal(aead, dataKey, wrapAssociatedData(keyID))
+}
+
+// UnwrapKey decrypts a data key wrapped by WrapKey.
+// WHY check the ID: The ID is bound in as associated data, so a hub can't
+// hand out one day's key as another's.
+func UnwrapKey(sharedKey []byte, keyID, wrapped string) ([]byte, error) {
+	aead, err := newAEAD(sharedKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := open(aead, wrapped, wrapAssociatedData(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("data key %s: %w", keyID, err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("data key %s has %d bytes, want %d", keyID, len(key), KeySize)
+	}
+	return key, nil
+}
+
+// WrappedKeyLength is the length of a key wrapped by WrapKey.
+// WHY exported: The hub checks uploaded keys against it without being able
+// to unwrap them.
+var WrappedKeyLength = base64.StdEncoding.EncodedLen(KeySize + Overhead)
+
+// SealLocal encrypts data an agent keeps on its own disk (e.g., its local
+// history) with key. label names the kind of record; OpenLocal only accepts
+// the same label, so one kind can't be passed off as another.
+func SealLocal(key []byte, label string, data []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	return seal(aead, data, localAssociatedData(label))
+}
+
+// OpenLocal reverses SealLocal.
+func OpenLocal(key []byte, label, sealed string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, sealed, localAssociatedData(label))
+}
+
+// seal encrypts plaintext under a random nonce and returns base64 of the
+// nonce followed by the ciphertext.
+func seal(aead cipher.AEAD, plaintext, ad []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, ad)), nil
+}
+
+// open reverses seal.
+func open(aead cipher.AEAD, ciphertext string, ad []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: malformed ciphertext", ErrDecrypt)
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// newAEAD creates the AES-GCM cipher for key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// localAssociatedData keeps local records apart from clips and wrapped
+// keys, and from each other by label.
+func localAssociatedData(label string) []byte {
+	return []byte("tailclip local\n" + label)
+}
+
+// wrapAssociatedData binds a wrapped key to its ID, and keeps wrapped keys
+// and sealed clips from being mistaken for one another.
+func wrapAssociatedData(keyID string) []byte {
+	return []byte("tailclip data key\n" + keyID)
+}
+
+// associatedData binds a ciphertext to the event's identity and type.
+func associatedData(event *models.Event) []byte {
+	return []byte(event.EventID + "\n" + event.SourceDeviceID + "\n" + event.ContentType)
+}
@@ -0,0 +1,229 @@
+// Author: Toluwalase Mebaanne
+// Tests for sealing clips and wrapping data keys.
+//
+// WHY check tampering field by field: The associated data is what stops a
+// hub from replaying a sealed clip under another event, device, or type.
+// A field that silently dropped out of it would still round-trip.
+
+package e2e
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// testKey returns a key of KeySize bytes filled with b.
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func testClip() *models.Event {
+	event := &models.Event{
+		EventID:        "0195f0a2-7c3e-7b1a-9a4e-2f6d8c1b3a55",
+		SourceDeviceID: "laptop",
+		Timestamp:      time.Date(2026, 3, 14, 9, 26, 53, 0, time.UTC),
+		ContentType:    models.ContentTypeText,
+		Text:           "hello <b>from</b> the laptop",
+		Formats:        map[string]string{"text/html": "hello <b>from</b> the laptop"},
+		Channel:        "work",
+	}
+	event.SetTextHash()
+	return event
+}
+
+func TestSealOpen(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *models.Event
+	}{
+		{"text with formats", testClip()},
+		{"empty text", &models.Event{EventID: "e", SourceDeviceID: "d", ContentType: models.ContentTypeText}},
+		{"file", &models.Event{EventID: "f", SourceDeviceID: "d", ContentType: models.ContentTypeFile,
+			Text: base64.StdEncoding.EncodeToString([]byte("report")), FileName: "report.txt"}},
+	}
+	key := testKey(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.event.SetTextHash()
+			sealed, err := Seal(key, tt.event)
+			if err != nil {
+				t.Fatalf("Seal: %v", err)
+			}
+			if !sealed.Encrypted || sealed.Formats != nil || sealed.FileName != "" {
+				t.Errorf("Seal left fields in the clear: %+v", sealed)
+			}
+			if tt.event.Text != "" && bytes.Contains([]byte(sealed.Text), []byte(tt.event.Text)) {
+				t.Errorf("Seal left the text readable: %q", sealed.Text)
+			}
+			if sealed.TextHash != sealed.ComputeTextHash() {
+				t.Error("Seal's hash doesn't cover the ciphertext")
+			}
+
+			sealed.KeyID = "2026-03-14"
+			if err := Open(key, sealed); err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if sealed.Text != tt.event.Text || sealed.FileName != tt.event.FileName ||
+				len(sealed.Formats) != len(tt.event.Formats) || sealed.TextHash != tt.event.TextHash ||
+				sealed.Encrypted || sealed.KeyID != "" {
+				t.Errorf("Open = %+v, want %+v", sealed, tt.event)
+			}
+			for format, value := range tt.event.Formats {
+				if sealed.Formats[format] != value {
+					t.Errorf("Open format %s = %q, want %q", format, sealed.Formats[format], value)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenRefusesTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    []byte
+		tamper func(*models.Event)
+	}{
+		{"event ID", testKey(1), func(e *models.Event) { e.EventID = "0195f0a2-0000-7b1a-9a4e-2f6d8c1b3a55" }},
+		{"source device ID", testKey(1), func(e *models.Event) { e.SourceDeviceID = "desktop" }},
+		{"content type", testKey(1), func(e *models.Event) { e.ContentType = models.ContentTypeFile }},
+		{"ciphertext", testKey(1), func(e *models.Event) {
+			data, _ := base64.StdEncoding.DecodeString(e.Text)
+			data[len(data)-1] ^= 1
+			e.Text = base64.StdEncoding.EncodeToString(data)
+		}},
+		{"truncated", testKey(1), func(e *models.Event) { e.Text = e.Text[:8] }},
+		{"not base64", testKey(1), func(e *models.Event) { e.Text = "not base64!" }},
+		{"other key", testKey(2), func(*models.Event) {}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := Seal(testKey(1), testClip())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(sealed)
+			before := *sealed
+			if err := Open(tt.key, sealed); !errors.Is(err, ErrDecrypt) {
+				t.Fatalf("Open after changing the %s = %v, want ErrDecrypt", tt.name, err)
+			}
+			if sealed.Text != before.Text || !sealed.Encrypted {
+				t.Errorf("a failed Open changed the event: %+v", sealed)
+			}
+		})
+	}
+}
+
+// TestOpenKnownVector opens AES-256-GCM test case 14 of "The Galois/Counter
+// Mode of Operation" (McGrew and Viega) in seal's format: base64 of the
+// nonce, ciphertext, and tag.
+func TestOpenKnownVector(t *testing.T) {
+	aead, err := newAEAD(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := hex.DecodeString("000000000000000000000000" +
+		"cea7403d4d606b6e074ec5d3baf39d18" + "d0d1c8a799996bf0265b98b5d48ab919")
+	plaintext, err := open(aead, base64.StdEncoding.EncodeToString(sealed), nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if !bytes.Equal(plaintext, make([]byte, 16)) {
+		t.Errorf("open = %x, want 16 zero bytes", plaintext)
+	}
+}
+
+func TestWrapUnwrapKey(t *testing.T) {
+	shared := testKey(1)
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := WrapKey(shared, "2026-03-14", dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wrapped) != WrappedKeyLength {
+		t.Errorf("wrapped key is %d bytes, want WrappedKeyLength (%d)", len(wrapped), WrappedKeyLength)
+	}
+
+	tests := []struct {
+		name    string
+		shared  []byte
+		keyID   string
+		wrapped string
+		ok      bool
+	}{
+		{"same ID", shared, "2026-03-14", wrapped, true},
+		{"another day's ID", shared, "2026-03-15", wrapped, false},
+		{"another generation's ID", shared, "2026-03-14.1", wrapped, false},
+		{"other shared key", testKey(2), "2026-03-14", wrapped, false},
+		{"truncated", shared, "2026-03-14", wrapped[:20], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnwrapKey(tt.shared, tt.keyID, tt.wrapped)
+			switch {
+			case tt.ok && err != nil:
+				t.Errorf("UnwrapKey: %v", err)
+			case tt.ok && !bytes.Equal(got, dataKey):
+				t.Errorf("UnwrapKey = %x, want %x", got, dataKey)
+			case !tt.ok && !errors.Is(err, ErrDecrypt):
+				t.Errorf("UnwrapKey = %x, %v, want ErrDecrypt", got, err)
+			}
+		})
+	}
+}
+
+// TestDomainSeparation checks that a wrapped key, a sealed clip, and a
+// local record can't be opened as one another, even under the same key.
+func TestDomainSeparation(t *testing.T) {
+	key := testKey(1)
+	wrapped, err := WrapKey(key, "2026-03-14", testKey(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenLocal(key, "2026-03-14", wrapped); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("OpenLocal of a wrapped key = %v, want ErrDecrypt", err)
+	}
+	local, err := SealLocal(key, "history", []byte("clip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenLocal(key, "journal", local); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("OpenLocal with another label = %v, want ErrDecrypt", err)
+	}
+	if got, err := OpenLocal(key, "history", local); err != nil || string(got) != "clip" {
+		t.Errorf("OpenLocal = %q, %v, want clip", got, err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key := testKey(7)
+	tests := []struct {
+		name    string
+		encoded string
+		ok      bool
+	}{
+		{"base64", base64.StdEncoding.EncodeToString(key), true},
+		{"base64 with spaces", "  " + base64.StdEncoding.EncodeToString(key) + "\n", true},
+		{"phrase", FormatPhrase(key), true},
+		{"short", base64.StdEncoding.EncodeToString(key[:16]), false},
+		{"not base64", "not a key", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParseKey(tt.encoded)
+		switch {
+		case tt.ok && (err != nil || !bytes.Equal(got, key)):
+			t.Errorf("ParseKey(%s) = %x, %v, want the key", tt.name, got, err)
+		case !tt.ok && err == nil:
+			t.Errorf("ParseKey(%s) succeeded, want an error", tt.name)
+		}
+	}
+}
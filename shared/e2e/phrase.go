@@ -0,0 +1,89 @@
+// Author: Toluwalase Mebaanne
+// Package e2e provides the phrase form of encryption keys.
+//
+// WHY a second form:
+// Base64 is fine to paste between terminals but miserable to read aloud or
+// type from another screen: it mixes cases and confusable characters, and a
+// typo only shows up later as clips that won't decrypt. The phrase uses one
+// case and no symbols, comes in short groups, and carries a checksum, so a
+// mistyped key is refused on import.
+
+package e2e
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+)
+
+// phraseChecksumSize is how many checksum bytes a phrase carries.
+// WHY 2: One wrong character in 65536 slips through, and the phrase stays
+// at 11 groups.
+const phraseChecksumSize = 2
+
+// phraseGroup is the number of characters between dashes.
+const phraseGroup = 5
+
+// phraseEncoding is base32 without padding; its alphabet is upper case
+// letters and the digits 2-7, which avoid 0/O and 1/I confusion.
+var phraseEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// FormatPhrase returns key as a phrase: base32 groups of five characters,
+// e.g. "MZXW6-YTBOI-...", ending in a checksum.
+func FormatPhrase(key []byte) string {
+	encoded := phraseEncoding.EncodeToString(append(bytes.Clone(key), phraseChecksum(key)...))
+	groups := make([]string, 0, len(encoded)/phraseGroup+1)
+	for len(encoded) > phraseGroup {
+		groups = append(groups, encoded[:phraseGroup])
+		encoded = encoded[phraseGroup:]
+	}
+	return strings.Join(append(groups, encoded), "-")
+}
+
+// parsePhrase decodes a phrase made by FormatPhrase. Case, spaces, and
+// dashes don't matter.
+func parsePhrase(phrase string) ([]byte, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(phrase))
+	data, err := phraseEncoding.DecodeString(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key phrase is not valid: %w", err)
+	}
+	// WHY compare with the re-encoded phrase: The last character carries
+	// three bits beyond the key and checksum, which decoding ignores, so a
+	// typo there would go unnoticed - the checksum never sees it.
+	if phraseEncoding.EncodeToString(data) != cleaned {
+		return nil, fmt.Errorf("encryption key phrase has a typo in its last character")
+	}
+	if len(data) != KeySize+phraseChecksumSize {
+		return nil, fmt.Errorf("encryption key phrase has %d characters, want %d", len(cleaned),
+			phraseEncoding.EncodedLen(KeySize+phraseChecksumSize))
+	}
+	key, sum := data[:KeySize], data[KeySize:]
+	if !bytes.Equal(sum, phraseChecksum(key)) {
+		return nil, fmt.Errorf("encryption key phrase has a typo (checksum mismatch)")
+	}
+	return key, nil
+}
+
+// phraseChecksum returns the checksum bytes of key.
+func phraseChecksum(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:phraseChecksumSize]
+}
+
+// Fingerprint returns a short, non-secret identifier of key.
+// WHY: Lets users check that two devices have the same key without showing
+// the key itself.
+// WHY a distinct prefix: The fingerprint must not equal the phrase
+// checksum, or it would reveal part of what a typo check relies on.
+func Fingerprint(key []byte) string {
+	sum := sha256.Sum256(append([]byte("tailclip key fingerprint\n"), key...))
+	return fmt.Sprintf("%x", sum[:6])
+}
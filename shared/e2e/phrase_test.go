@@ -0,0 +1,84 @@
+// Author: Toluwalase Mebaanne
+// Tests for the phrase form of keys.
+
+package e2e
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFormatPhrase(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []byte
+		want string
+	}{
+		{"zero key", make([]byte, KeySize),
+			"AAAAA-AAAAA-AAAAA-AAAAA-AAAAA-AAAAA-AAAAA-AAAAA-AAAAA-AAAAA-AGM2A"},
+		{"bytes 0 to 31", sequenceKey(),
+			"AAAQE-AYEAU-DAOCA-JBIFQ-YDIOB-4IBCE-QTCQK-RMFYY-DENBW-HA5DY-PWGDI"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatPhrase(tt.key); got != tt.want {
+				t.Errorf("FormatPhrase = %s, want %s", got, tt.want)
+			}
+			for _, phrase := range []string{tt.want, strings.ToLower(tt.want), strings.ReplaceAll(tt.want, "-", " "),
+				strings.ReplaceAll(tt.want, "-", "")} {
+				if got, err := parsePhrase(phrase); err != nil || !bytes.Equal(got, tt.key) {
+					t.Errorf("parsePhrase(%q) = %x, %v, want %x", phrase, got, err, tt.key)
+				}
+			}
+		})
+	}
+}
+
+// TestParsePhraseRefusesTypos changes each character of a phrase to every
+// other character of the alphabet; none may decode to a key.
+func TestParsePhraseRefusesTypos(t *testing.T) {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	phrase := FormatPhrase(sequenceKey())
+	for i := range phrase {
+		if phrase[i] == '-' {
+			continue
+		}
+		for _, c := range alphabet {
+			if byte(c) == phrase[i] {
+				continue
+			}
+			typo := phrase[:i] + string(c) + phrase[i+1:]
+			if key, err := parsePhrase(typo); err == nil {
+				t.Errorf("parsePhrase(%s) = %x, want an error for the typo at %d", typo, key, i)
+			}
+		}
+	}
+}
+
+func TestParsePhraseLength(t *testing.T) {
+	phrase := FormatPhrase(sequenceKey())
+	for _, short := range []string{phrase[:len(phrase)-6], phrase + "-AAAAA", ""} {
+		if _, err := parsePhrase(short); err == nil {
+			t.Errorf("parsePhrase(%q) succeeded, want an error", short)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	if got := Fingerprint(make([]byte, KeySize)); got != "c901206ac940" {
+		t.Errorf("Fingerprint(zero key) = %s, want c901206ac940", got)
+	}
+	if Fingerprint(testKey(1)) == Fingerprint(testKey(2)) {
+		t.Error("two keys have the same fingerprint")
+	}
+}
+
+// sequenceKey returns the key with bytes 0, 1, ..., 31.
+func sequenceKey() []byte {
+	key := make([]byte, KeySize)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
@@ -0,0 +1,150 @@
+// Author: Toluwalase Mebaanne
+// Tests for signing clips.
+
+package e2e
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// rfc8032Seed and rfc8032Public are the keys of RFC 8032, section 7.1,
+// TEST 1.
+const (
+	rfc8032Seed   = "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"
+	rfc8032Public = "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"
+)
+
+// rfc8032Key returns the RFC 8032 private key as EncodeSigningKey would.
+func rfc8032Key() string {
+	seed, _ := hex.DecodeString(rfc8032Seed)
+	return base64.StdEncoding.EncodeToString(seed)
+}
+
+func TestSigningKeyEncoding(t *testing.T) {
+	key, err := ParseSigningKey(rfc8032Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, _ := hex.DecodeString(rfc8032Public)
+	if got, want := PublicSigningKey(key), base64.StdEncoding.EncodeToString(public); got != want {
+		t.Errorf("PublicSigningKey = %s, want %s", got, want)
+	}
+	if got := EncodeSigningKey(key); got != rfc8032Key() {
+		t.Errorf("EncodeSigningKey = %s, want the seed %s", got, rfc8032Key())
+	}
+	for _, bad := range []string{"", "not base64", base64.StdEncoding.EncodeToString(make([]byte, 31))} {
+		if _, err := ParseSigningKey(bad); err == nil {
+			t.Errorf("ParseSigningKey(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func signedClip() *models.Event {
+	event := testClip()
+	event.Encrypted = true
+	event.KeyID = "2026-03-14"
+	event.ExpiresAt = time.Date(2026, 3, 14, 9, 31, 53, 0, time.UTC)
+	event.FileName = ""
+	return event
+}
+
+// TestSignEventGolden pins the signature of a fixed clip, computed with the
+// reference code of RFC 8032 over the fields listed in sign.go. Ed25519
+// signs deterministically, so a change here means signedBytes changed, and
+// every agent from before would refuse the clips.
+func TestSignEventGolden(t *testing.T) {
+	key, err := ParseSigningKey(rfc8032Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := signedClip()
+	SignEvent(key, event)
+	const want = "TuWeBPWRKq7KbAQqUJkvjS3WQrYdT9mPEs8BSWD+Xk+W+q+GUAkQKjxCYWXUgKCTbcpo8kDrfXpu3IACC5fLDA=="
+	if event.Signature != want {
+		t.Errorf("Signature = %s, want %s", event.Signature, want)
+	}
+}
+
+func TestVerifyEvent(t *testing.T) {
+	other, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		change func(*models.Event)
+		ok     bool
+	}{
+		{"unchanged", func(*models.Event) {}, true},
+		{"channel, which federation may change", func(e *models.Event) { e.Channel = "home" }, true},
+		{"text hash, which isn't signed", func(e *models.Event) { e.TextHash = "" }, true},
+		{"timestamp below a second", func(e *models.Event) { e.Timestamp = e.Timestamp.Add(500 * time.Millisecond) }, true},
+		{"event ID", func(e *models.Event) { e.EventID = "other" }, false},
+		{"source device ID", func(e *models.Event) { e.SourceDeviceID = "desktop" }, false},
+		{"timestamp", func(e *models.Event) { e.Timestamp = e.Timestamp.Add(time.Second) }, false},
+		{"content type", func(e *models.Event) { e.ContentType = models.ContentTypeFile }, false},
+		{"text", func(e *models.Event) { e.Text += "!" }, false},
+		{"file name", func(e *models.Event) { e.FileName = "x.txt" }, false},
+		{"encrypted flag", func(e *models.Event) { e.Encrypted = false }, false},
+		{"key ID", func(e *models.Event) { e.KeyID = "2026-03-14.1" }, false},
+		{"expiry", func(e *models.Event) { e.ExpiresAt = e.ExpiresAt.Add(time.Hour) }, false},
+		{"expiry removed", func(e *models.Event) { e.ExpiresAt = time.Time{} }, false},
+		{"format changed", func(e *models.Event) { e.Formats["text/html"] = "changed" }, false},
+		{"format added", func(e *models.Event) { e.Formats["text/rtf"] = "" }, false},
+		{"format removed", func(e *models.Event) { e.Formats = nil }, false},
+		{"other signing key", func(e *models.Event) { e.SigningKey = PublicSigningKey(other) }, false},
+		{"signature", func(e *models.Event) { e.Signature = base64.StdEncoding.EncodeToString(make([]byte, 64)) }, false},
+	}
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := signedClip()
+			SignEvent(key, event)
+			tt.change(event)
+			err := VerifyEvent(event)
+			switch {
+			case tt.ok && err != nil:
+				t.Errorf("VerifyEvent: %v", err)
+			case !tt.ok && !errors.Is(err, ErrSignature):
+				t.Errorf("VerifyEvent = %v, want ErrSignature", err)
+			}
+		})
+	}
+}
+
+func TestVerifyEventMalformed(t *testing.T) {
+	tests := []struct {
+		name       string
+		signature  string
+		signingKey string
+	}{
+		{"unsigned", "", ""},
+		{"no signing key", "c2ln", ""},
+		{"short signing key", "c2ln", base64.StdEncoding.EncodeToString(make([]byte, 16))},
+		{"signing key not base64", "c2ln", "not base64"},
+	}
+	for _, tt := range tests {
+		event := signedClip()
+		event.Signature, event.SigningKey = tt.signature, tt.signingKey
+		if err := VerifyEvent(event); err == nil {
+			t.Errorf("VerifyEvent with %s succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	public, _ := hex.DecodeString(rfc8032Public)
+	got := KeyFingerprint(base64.StdEncoding.EncodeToString(public))
+	if len(got) != 19 || got[4] != ' ' || got[9] != ' ' || got[14] != ' ' {
+		t.Errorf("KeyFingerprint = %q, want four groups of four", got)
+	}
+}
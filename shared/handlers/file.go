@@ -0,0 +1,90 @@
+// Author: Toluwalase Mebaanne
+// FileHandler implements the ContentHandler interface for small file transfers.
+//
+// WHY this is Phase 3:
+// Files are binary, and the sync pipeline (JSON over HTTP and WebSocket,
+// TEXT columns in SQLite) carries strings. Base64 fits files into that
+// pipeline unchanged, at the cost of a third more bytes on the wire. That's
+// fine for the small files people actually copy between their own machines;
+// anything large belongs in a real file sync tool, hence the size limit.
+
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxFileSize is the file size limit used when none is configured.
+// WHY 5 MB: Covers screenshots, PDFs, and config bundles, while keeping
+// history rows and the hub's replay buffer from ballooning.
+const DefaultMaxFileSize = 5 * 1024 * 1024 // 5 MB
+
+// FileHandler processes file clipboard content: the file's bytes,
+// base64-encoded.
+type FileHandler struct {
+	// maxSize is the largest accepted file size in bytes, before encoding.
+	maxSize int
+}
+
+// NewFileHandler creates a new FileHandler instance.
+// A non-positive maxSize falls back to DefaultMaxFileSize.
+func NewFileHandler(maxSize int) *FileHandler {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFileSize
+	}
+	return &FileHandler{maxSize: maxSize}
+}
+
+// MaxSize returns the configured file size limit in bytes.
+// WHY exposed: The hub advertises it to agents, like TextHandler.MaxLength.
+func (h *FileHandler) MaxSize() int {
+	return h.maxSize
+}
+
+// CanHandle returns true if the content type is a file.
+func (h *FileHandler) CanHandle(contentType string) bool {
+	return strings.EqualFold(contentType, "file")
+}
+
+// Process checks that content is valid base64 of a non-empty file within
+// the size limit.
+// WHY check the size before decoding: The encoded length bounds the decoded
+// one, so an oversized file is refused without allocating a copy of it.
+func (h *FileHandler) Process(content string) error {
+	if content == "" {
+		return fmt.Errorf("file %w", ErrEmptyContent)
+	}
+	if size := base64.StdEncoding.DecodedLen(len(content)); size > h.maxSize+2 {
+		return fmt.Errorf("file %w: about %d bytes exceeds maximum of %d bytes", ErrContentTooLarge, size, h.maxSize)
+	}
+
+	data, err := DecodeFile(content)
+	if err != nil {
+		return err
+	}
+	if len(data) > h.maxSize {
+		return fmt.Errorf("file %w: %d bytes exceeds maximum of %d bytes", ErrContentTooLarge, len(data), h.maxSize)
+	}
+	return nil
+}
+
+// GetType returns the content type identifier for this handler.
+func (h *FileHandler) GetType() string {
+	return "file"
+}
+
+// EncodeFile returns data in the form file events carry it.
+func EncodeFile(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// DecodeFile returns the bytes of a file event's content.
+func DecodeFile(content string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, fmt.Errorf("file content is not valid base64: %w", err)
+	}
+	return data, nil
+}
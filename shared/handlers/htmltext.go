@@ -0,0 +1,265 @@
+// Author: Toluwalase Mebaanne
+// HTMLToText converts an HTML clip into a readable plain-text version.
+//
+// WHY a small converter instead of an HTML parser dependency:
+// The result only has to be pleasant to paste - paragraphs on their own
+// lines, list items marked, link targets kept - not a faithful rendering.
+// A small tag scanner covers that for the HTML clipboards actually produce,
+// without adding a module to every build.
+
+package handlers
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// hrefPattern extracts the href attribute from an <a> tag.
+var hrefPattern = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+// skippedElements have content that is never shown as text.
+var skippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "template": true, "noscript": true,
+}
+
+// blockElements start on a new line; paragraphElements are also separated
+// from their neighbours by a blank line.
+var (
+	blockElements = map[string]bool{
+		"div": true, "li": true, "tr": true, "ul": true, "ol": true, "dl": true, "dt": true, "dd": true,
+		"table": true, "section": true, "article": true, "header": true, "footer": true, "hr": true,
+	}
+	paragraphElements = map[string]bool{
+		"p": true, "pre": true, "blockquote": true,
+		"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	}
+)
+
+// htmlLink is an open <a> element: its target and where its text starts.
+type htmlLink struct {
+	href  string
+	start int
+}
+
+// HTMLToText returns a plain-text version of an HTML document or fragment:
+// tags removed, entities decoded, block elements on their own lines, list
+// items prefixed with "- ", and links followed by their target in
+// parentheses when it differs from the link text.
+func HTMLToText(doc string) string {
+	var b strings.Builder
+	var links []htmlLink
+	pre := 0
+
+	for len(doc) > 0 {
+		lt := strings.IndexByte(doc, '<')
+		if lt < 0 {
+			writeHTMLText(&b, doc, pre > 0)
+			break
+		}
+		writeHTMLText(&b, doc[:lt], pre > 0)
+		doc = doc[lt:]
+
+		// Comments, doctypes, and processing instructions.
+		if strings.HasPrefix(doc, "<!--") {
+			end := strings.Index(doc, "-->")
+			if end < 0 {
+				break
+			}
+			doc = doc[end+3:]
+			continue
+		}
+		if strings.HasPrefix(doc, "<!") || strings.HasPrefix(doc, "<?") {
+			doc = skipPast(doc, ">")
+			continue
+		}
+
+		tag, rest := cutTag(doc)
+		doc = rest
+		name, closing := tagName(tag)
+		if name == "" {
+			// A lone "<" in text, e.g. "a < b".
+			writeHTMLText(&b, tag, pre > 0)
+			continue
+		}
+
+		switch {
+		case skippedElements[name] && !closing:
+			doc = skipPast(doc, "</"+name)
+			doc = skipPast(doc, ">")
+		case name == "br":
+			b.WriteByte('\n')
+		case name == "pre":
+			ensureBlankLine(&b)
+			if closing {
+				pre = max(pre-1, 0)
+			} else {
+				pre++
+			}
+		case paragraphElements[name]:
+			ensureBlankLine(&b)
+		case name == "li" && !closing:
+			ensureNewline(&b)
+			b.WriteString("- ")
+		case blockElements[name]:
+			ensureNewline(&b)
+		case (name == "td" || name == "th") && !closing:
+			if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+				b.WriteByte('\t')
+			}
+		case name == "a" && !closing:
+			links = append(links, htmlLink{href: tagHref(tag), start: b.Len()})
+		case name == "a" && closing && len(links) > 0:
+			link := links[len(links)-1]
+			links = links[:len(links)-1]
+			writeLinkTarget(&b, link)
+		}
+	}
+
+	return tidyText(b.String())
+}
+
+// writeHTMLText appends a text node, decoding entities and, outside <pre>,
+// collapsing whitespace the way a browser would.
+func writeHTMLText(b *strings.Builder, text string, preformatted bool) {
+	text = html.UnescapeString(text)
+	if preformatted {
+		b.WriteString(text)
+		return
+	}
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		if text != "" && !endsWithSpace(b.String()) {
+			b.WriteByte(' ')
+		}
+		return
+	}
+	if startsWithSpace(text) && !endsWithSpace(b.String()) {
+		b.WriteByte(' ')
+	}
+	b.WriteString(strings.Join(fields, " "))
+	if endsWithSpace(text) {
+		b.WriteByte(' ')
+	}
+}
+
+// writeLinkTarget appends " (href)" after a link's text, or the href alone
+// for a link without text.
+// WHY skip fragment and javascript: links: They mean nothing outside the
+// page the clip came from.
+func writeLinkTarget(b *strings.Builder, link htmlLink) {
+	href := strings.TrimSpace(link.href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return
+	}
+	text := strings.TrimSpace(b.String()[link.start:])
+	switch {
+	case text == "":
+		b.WriteString(href)
+	case text != href && "mailto:"+text != href:
+		b.WriteString(" (" + href + ")")
+	}
+}
+
+// cutTag splits doc, which starts with "<", after the end of that tag.
+// WHY track quotes: An attribute value may contain ">".
+func cutTag(doc string) (tag, rest string) {
+	var quote byte
+	for i := 1; i < len(doc); i++ {
+		switch c := doc[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return doc[:i+1], doc[i+1:]
+		}
+	}
+	return doc, ""
+}
+
+// tagName returns the lower-cased element name of a tag and whether it is a
+// closing tag, or "" if tag isn't one.
+func tagName(tag string) (string, bool) {
+	s := strings.TrimPrefix(tag, "<")
+	closing := strings.HasPrefix(s, "/")
+	s = strings.TrimPrefix(s, "/")
+	end := 0
+	for end < len(s) && (s[end] >= 'a' && s[end] <= 'z' || s[end] >= 'A' && s[end] <= 'Z' || end > 0 && s[end] >= '0' && s[end] <= '9') {
+		end++
+	}
+	return strings.ToLower(s[:end]), closing
+}
+
+// tagHref returns the decoded href attribute of a tag, or "".
+func tagHref(tag string) string {
+	m := hrefPattern.FindStringSubmatch(tag)
+	if m == nil {
+		return ""
+	}
+	return html.UnescapeString(m[1] + m[2] + m[3])
+}
+
+// skipPast returns doc after the first case-insensitive occurrence of
+// marker, or "" if there is none.
+// WHY not strings.Index on strings.ToLower(doc): Some characters change
+// length when lower-cased, so an index into the lower-cased copy doesn't
+// point at the same place in doc - and can point past its end.
+func skipPast(doc, marker string) string {
+	for i := 0; i+len(marker) <= len(doc); i++ {
+		if strings.EqualFold(doc[i:i+len(marker)], marker) {
+			return doc[i+len(marker):]
+		}
+	}
+	return ""
+}
+
+// ensureNewline ends the current line unless the output is empty or already
+// at the start of one.
+func ensureNewline(b *strings.Builder) {
+	if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		b.WriteByte('\n')
+	}
+}
+
+// ensureBlankLine makes the next text start after an empty line.
+func ensureBlankLine(b *strings.Builder) {
+	ensureNewline(b)
+	if s := b.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+		b.WriteByte('\n')
+	}
+}
+
+// tidyText trims trailing spaces from each line, drops runs of blank
+// lines, and trims the whole text.
+func tidyText(text string) string {
+	lines := strings.Split(text, "\n")
+	out := lines[:0]
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// startsWithSpace and endsWithSpace report whether s begins or ends with
+// HTML whitespace; empty output counts as ending in space so no text starts
+// with one.
+func startsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\n\r\f", rune(s[0]))
+}
+
+func endsWithSpace(s string) bool {
+	return s == "" || strings.ContainsRune(" \t\n\r\f", rune(s[len(s)-1]))
+}
@@ -0,0 +1,52 @@
+// Author: Toluwalase Mebaanne
+// Tests for the HTML to plain text conversion.
+
+package handlers
+
+import "testing"
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"paragraphs", "<p>one</p><p>two</p>", "one\n\ntwo"},
+		{"list", "<ul><li>a</li><li>b</li></ul>", "- a\n- b"},
+		{"link", `<a href="https://example.com">site</a>`, "site (https://example.com)"},
+		{"entities", "a &lt; b &amp;&amp; c", "a < b && c"},
+		{"script skipped", "before<script>var x = 1;</script>after", "beforeafter"},
+		{"upper-case skipped element", "before<STYLE>p {}</Style>after", "beforeafter"},
+		{"unterminated script", "before<script>var x", "before"},
+		// Ⱥ lower-cases to a longer rune; an index into a lower-cased copy
+		// of the document ran past its end.
+		{"text that grows when lower-cased", "<script>ȺȺȺȺȺȺȺȺ</script>after", "after"},
+		{"text that grows, unterminated", "<script>ȺȺȺȺȺȺȺȺ", ""},
+		{"doctype with growing text", "<!DOCTYPE ȺȺȺȺ>text", "text"},
+		{"skipped element after growing text", "ȺȺȺȺ<style>p {}</style>after", "ȺȺȺȺafter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTMLToText(tt.doc); got != tt.want {
+				t.Errorf("HTMLToText(%q) = %q, want %q", tt.doc, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipPast(t *testing.T) {
+	tests := []struct {
+		doc, marker, want string
+	}{
+		{"abc</SCRIPT>rest", "</script", ">rest"},
+		{"ȺȺȺ</script>x", "</script", ">x"},
+		{"no marker here", "</script", ""},
+		{"</scrip", "</script", ""},
+		{"", ">", ""},
+	}
+	for _, tt := range tests {
+		if got := skipPast(tt.doc, tt.marker); got != tt.want {
+			t.Errorf("skipPast(%q, %q) = %q, want %q", tt.doc, tt.marker, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Author: Toluwalase Mebaanne
+// HandlerRegistry maps content types to the ContentHandler responsible for them.
+//
+// WHY a registry instead of passing handlers around:
+// Every place that validates content (the hub's push path, transforms, the
+// revalidate command) must agree on which handler owns which type. A
+// registry built once makes "register the new handler" the only step when
+// a content type is added, as the interface doc promises.
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupportedType is returned (wrapped) by Lookup for a content type no
+// registered handler accepts.
+var ErrUnsupportedType = errors.New("unsupported content type")
+
+// HandlerRegistry holds ContentHandlers in registration order.
+// Handlers are registered during setup; Lookup is safe to call concurrently
+// once registration is done.
+type HandlerRegistry struct {
+	handlers []ContentHandler
+}
+
+// NewHandlerRegistry creates a registry with the given handlers registered.
+func NewHandlerRegistry(handlers ...ContentHandler) *HandlerRegistry {
+	r := &HandlerRegistry{}
+	for _, h := range handlers {
+		r.Register(h)
+	}
+	return r
+}
+
+// Register adds a handler.
+// WHY first match wins in Lookup: A handler registered earlier for the same
+// type keeps it, so registration order is the only precedence rule.
+func (r *HandlerRegistry) Register(h ContentHandler) {
+	r.handlers = append(r.handlers, h)
+}
+
+// Lookup returns the handler for contentType.
+// WHY an error instead of nil: The caller usually has to explain the refusal,
+// and the error already names the types that would have been accepted.
+func (r *HandlerRegistry) Lookup(contentType string) (ContentHandler, error) {
+	for _, h := range r.handlers {
+		if h.CanHandle(contentType) {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q (supported: %s)", ErrUnsupportedType, contentType, strings.Join(r.Types(), ", "))
+}
+
+// Types returns the content types of the registered handlers.
+func (r *HandlerRegistry) Types() []string {
+	types := make([]string, 0, len(r.handlers))
+	for _, h := range r.handlers {
+		types = append(types, h.GetType())
+	}
+	return types
+}
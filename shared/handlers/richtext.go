@@ -0,0 +1,85 @@
+// Author: Toluwalase Mebaanne
+// RichTextHandler validates the rich text formats (HTML, RTF) a text clip can
+// carry next to its plain text.
+//
+// WHY not a content type of its own:
+// Rich text is the same clip in a richer form, not different content. It
+// rides along in Event.Formats so that every receiver that can't use it -
+// an older agent, a terminal, a platform whose clipboard tool offers one
+// format at a time - still pastes the plain text.
+
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// RichTextHandler processes one rich text representation of a clip.
+type RichTextHandler struct {
+	// maxLength is the largest accepted size in bytes of a clip's text and
+	// all of its formats together.
+	maxLength int
+}
+
+// NewRichTextHandler creates a new RichTextHandler instance.
+// A non-positive maxLength falls back to DefaultMaxTextLength.
+// WHY the text limit: Formats are stored and broadcast with the text, so
+// they share its budget rather than multiplying it.
+func NewRichTextHandler(maxLength int) *RichTextHandler {
+	if maxLength <= 0 {
+		maxLength = DefaultMaxTextLength
+	}
+	return &RichTextHandler{maxLength: maxLength}
+}
+
+// CanHandle returns true for the supported formats (MIME types).
+func (h *RichTextHandler) CanHandle(format string) bool {
+	return strings.EqualFold(format, "text/html") || strings.EqualFold(format, "text/rtf")
+}
+
+// Process checks that content is non-empty UTF-8 within the size limit.
+func (h *RichTextHandler) Process(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("rich text %w", ErrEmptyContent)
+	}
+	if len(content) > h.maxLength {
+		return fmt.Errorf("rich text %w: %d bytes exceeds maximum of %d bytes", ErrContentTooLarge, len(content), h.maxLength)
+	}
+	// WHY require UTF-8: Formats travel in JSON strings, which would
+	// silently replace invalid bytes and corrupt the document.
+	if !utf8.ValidString(content) {
+		return fmt.Errorf("rich text is not valid UTF-8")
+	}
+	return nil
+}
+
+// ProcessFormats checks every format of a clip whose plain text is
+// textLength bytes long, including their combined size.
+func (h *RichTextHandler) ProcessFormats(formats map[string]string, textLength int) error {
+	total := textLength
+	for format, content := range formats {
+		if !h.CanHandle(format) {
+			return fmt.Errorf("unsupported rich text format %q", format)
+		}
+		if err := h.Process(content); err != nil {
+			return fmt.Errorf("%s: %w", format, err)
+		}
+		// WHY check the header: A clipboard owner that mislabels plain text
+		// as RTF would otherwise make receivers paste it as a broken document.
+		if strings.EqualFold(format, "text/rtf") && !strings.HasPrefix(content, `{\rtf`) {
+			return fmt.Errorf("%s: missing {\\rtf header", format)
+		}
+		total += len(content)
+	}
+	if total > h.maxLength {
+		return fmt.Errorf("rich text %w: %d bytes with formats exceeds maximum of %d bytes", ErrContentTooLarge, total, h.maxLength)
+	}
+	return nil
+}
+
+// GetType returns the handler's identifier.
+func (h *RichTextHandler) GetType() string {
+	return "richtext"
+}
@@ -0,0 +1,82 @@
+// Author: Toluwalase Mebaanne
+// SealedHandler validates the content of end-to-end encrypted events.
+//
+// WHY a handler of its own:
+// The hub can't read a sealed clip, so the text and file handlers' checks
+// (emptiness, UTF-8, decoded file size) can't run on it. What the hub can
+// still enforce is the shape of the ciphertext and a size bound, so a
+// sealed push can't be used to get around the configured limits.
+
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/tmair/tailclip/shared/e2e"
+)
+
+// sealedSlack covers what the sealed payload adds besides the content
+// itself: JSON field names and quoting, and the file name.
+const sealedSlack = 4 * 1024
+
+// SealedHandler processes the ciphertext of encrypted events: base64 of the
+// nonce, the encrypted payload, and the authentication tag.
+type SealedHandler struct {
+	// maxSize is the largest accepted ciphertext in bytes, before encoding.
+	maxSize int
+}
+
+// NewSealedHandler creates a SealedHandler for a hub with the given text
+// and file limits. Non-positive limits fall back to their defaults.
+// WHY derive the bound from the plaintext limits: A sealed clip holds a
+// text clip with its formats (together up to maxTextLength, but JSON may
+// escape them to about twice that), or a base64 file. Anything larger
+// could not have been valid before sealing.
+func NewSealedHandler(maxTextLength, maxFileSize int) *SealedHandler {
+	if maxTextLength <= 0 {
+		maxTextLength = DefaultMaxTextLength
+	}
+	if maxFileSize <= 0 {
+		maxFileSize = DefaultMaxFileSize
+	}
+	payload := max(2*maxTextLength, base64.StdEncoding.EncodedLen(maxFileSize))
+	return &SealedHandler{maxSize: payload + sealedSlack + e2e.Overhead}
+}
+
+// MaxEncodedLength returns the longest accepted content, after base64.
+// WHY exposed: The hub sizes its request body limit with it.
+func (h *SealedHandler) MaxEncodedLength() int {
+	return base64.StdEncoding.EncodedLen(h.maxSize)
+}
+
+// CanHandle returns true for the content types that can be sealed.
+func (h *SealedHandler) CanHandle(contentType string) bool {
+	return strings.EqualFold(contentType, "text") || strings.EqualFold(contentType, "file")
+}
+
+// Process checks that content is base64 ciphertext within the size limit.
+// WHY check the size before decoding: As with files, the encoded length
+// bounds the decoded one.
+func (h *SealedHandler) Process(content string) error {
+	if content == "" {
+		return fmt.Errorf("sealed %w", ErrEmptyContent)
+	}
+	if len(content) > h.MaxEncodedLength() {
+		return fmt.Errorf("sealed %w: %d bytes exceeds maximum of %d bytes", ErrContentTooLarge, len(content), h.MaxEncodedLength())
+	}
+	data, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return fmt.Errorf("sealed content is not valid base64: %w", err)
+	}
+	if len(data) <= e2e.Overhead {
+		return fmt.Errorf("sealed content is too short to be a ciphertext")
+	}
+	return nil
+}
+
+// GetType returns the handler's identifier.
+func (h *SealedHandler) GetType() string {
+	return "sealed"
+}
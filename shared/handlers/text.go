@@ -15,28 +15,52 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
 
-// MaxTextLength is the maximum allowed text content length in bytes.
+// DefaultMaxTextLength is the text size limit used when none is configured.
 // WHY: Prevents abuse and memory issues from extremely large clipboard contents.
 // 1MB is generous for text while protecting against accidental binary pastes.
-const MaxTextLength = 1 * 1024 * 1024 // 1 MB
+const DefaultMaxTextLength = 1 * 1024 * 1024 // 1 MB
+
+// Sentinel errors returned (wrapped) by Process.
+// WHY exported sentinels: Callers map them to different outcomes - the hub
+// answers 413 for oversized content but 400 for empty content, and the agent
+// tells the user why a clip was skipped. errors.Is keeps that mapping robust
+// to message wording changes.
+var (
+	ErrEmptyContent    = errors.New("content is empty")
+	ErrContentTooLarge = errors.New("content too large")
+)
 
 // TextHandler processes plain text clipboard content.
 // WHY a struct instead of bare functions:
 // Struct-based handlers can carry configuration (e.g., max length, encoding)
 // and satisfy the ContentHandler interface cleanly. This also allows
 // dependency injection for testing.
-type TextHandler struct{}
+type TextHandler struct {
+	// maxLength is the largest accepted text size in bytes.
+	maxLength int
+}
 
 // NewTextHandler creates a new TextHandler instance.
 // WHY a constructor: Provides a consistent creation pattern across all handlers.
-// As handlers grow to accept configuration, the constructor is where defaults
-// and validation will live.
-func NewTextHandler() *TextHandler {
-	return &TextHandler{}
+// A non-positive maxLength falls back to DefaultMaxTextLength so callers can
+// pass an unset config value straight through.
+func NewTextHandler(maxLength int) *TextHandler {
+	if maxLength <= 0 {
+		maxLength = DefaultMaxTextLength
+	}
+	return &TextHandler{maxLength: maxLength}
+}
+
+// MaxLength returns the configured text size limit in bytes.
+// WHY exposed: The hub advertises it to agents (capability negotiation) so
+// both sides enforce the same limit.
+func (h *TextHandler) MaxLength() int {
+	return h.maxLength
 }
 
 // CanHandle returns true if the content type is plain text.
@@ -56,14 +80,14 @@ func (h *TextHandler) Process(content string) error {
 	// WHY: Syncing empty strings is pointless and likely indicates
 	// a clipboard clear event, not actual content to share
 	if strings.TrimSpace(content) == "" {
-		return fmt.Errorf("text content is empty")
+		return fmt.Errorf("text %w", ErrEmptyContent)
 	}
 
 	// Enforce size limit
 	// WHY: Protects the hub from memory pressure and ensures SQLite
 	// rows stay within reasonable bounds for query performance
-	if len(content) > MaxTextLength {
-		return fmt.Errorf("text content exceeds maximum length of %d bytes", MaxTextLength)
+	if len(content) > h.maxLength {
+		return fmt.Errorf("text %w: %d bytes exceeds maximum of %d bytes", ErrContentTooLarge, len(content), h.maxLength)
 	}
 
 	return nil
@@ -0,0 +1,151 @@
+// Author: Toluwalase Mebaanne
+// Package i18n provides a minimal message catalog for user-facing strings.
+// WHY: Notifications, tray menus, and CLI output are read by people, not
+// parsed by tools, so they should speak the user's language. Log messages
+// stay in English on purpose - they're for debugging and bug reports, where
+// a single language keeps them searchable.
+//
+// WHY a hand-rolled catalog instead of golang.org/x/text/message:
+// TailClip only needs key lookup plus fmt-style arguments. A flat JSON file
+// per locale is something a community translator can edit without knowing
+// Go, and it avoids pulling a large dependency into every agent binary.
+
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// defaultLocale is the fallback when no translation exists for a key.
+// WHY English: It's the language the strings are authored in, so the
+// English catalog is always complete.
+const defaultLocale = "en"
+
+// localeFiles holds the bundled translations, one JSON object per locale.
+// WHY go:embed: Agents ship as a single binary - translations must travel
+// inside it rather than as loose files next to the executable.
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Catalog maps message keys to fmt format strings for one locale.
+type Catalog map[string]string
+
+var (
+	// mu protects catalogs and current.
+	// WHY: The locale is set at startup but may change on config reload
+	// while notification goroutines are reading messages.
+	mu       sync.RWMutex
+	catalogs = map[string]Catalog{}
+	current  = defaultLocale
+)
+
+// init loads every bundled locale file.
+// WHY panic on bad JSON: A malformed bundled catalog is a build-time mistake,
+// not a runtime condition - failing loudly on first launch catches it in CI.
+func init() {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("i18n: failed to read bundled locales: %v", err))
+	}
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("i18n: failed to read %s: %v", entry.Name(), err))
+		}
+		var catalog Catalog
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("i18n: failed to parse %s: %v", entry.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(entry.Name(), ".json")] = catalog
+	}
+}
+
+// Register adds or replaces the catalog for a locale.
+// WHY exported: Lets a translation be loaded at runtime (or in tests)
+// without rebuilding the binary.
+func Register(locale string, catalog Catalog) {
+	mu.Lock()
+	defer mu.Unlock()
+	catalogs[normalize(locale)] = catalog
+}
+
+// Init selects the active locale from, in priority order: the configured
+// value, TAILCLIP_LOCALE, then the standard POSIX locale variables.
+// WHY this order: An explicit config setting is the user's deliberate choice;
+// the environment is the OS-wide default. Returns the locale actually used.
+func Init(configured string) string {
+	candidates := []string{
+		configured,
+		os.Getenv("TAILCLIP_LOCALE"),
+		os.Getenv("LC_ALL"),
+		os.Getenv("LC_MESSAGES"),
+		os.Getenv("LANG"),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	current = defaultLocale
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		if locale := resolve(candidate); locale != "" {
+			current = locale
+			break
+		}
+	}
+	return current
+}
+
+// T returns the message for key in the active locale, formatted with args.
+// WHY fall back to English, then to the key itself: A partially translated
+// catalog should still produce readable output, and a missing key should be
+// visible (not an empty notification) so it gets reported and fixed.
+func T(key string, args ...any) string {
+	mu.RLock()
+	format, ok := catalogs[current][key]
+	if !ok {
+		format, ok = catalogs[defaultLocale][key]
+	}
+	mu.RUnlock()
+
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// resolve maps a requested locale onto an available catalog, trying the full
+// tag first ("pt-br") and then the base language ("pt"). Callers hold mu.
+func resolve(requested string) string {
+	locale := normalize(requested)
+	if _, ok := catalogs[locale]; ok {
+		return locale
+	}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		if _, ok := catalogs[base]; ok {
+			return base
+		}
+	}
+	return ""
+}
+
+// normalize converts POSIX-style locale strings ("de_DE.UTF-8") into the
+// lowercase, hyphenated form used for catalog file names ("de-de").
+// WHY: Environment variables and config files spell locales inconsistently.
+func normalize(locale string) string {
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
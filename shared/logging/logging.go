@@ -0,0 +1,138 @@
+// Author: Toluwalase Mebaanne
+// Package logging provides leveled, per-component logging for the hub and
+// agent, built on log/slog.
+//
+// WHY a shared package instead of calling slog directly:
+// Both binaries need the same log_level and log_format handling, and every
+// line should say which part of the program wrote it. A Logger per
+// component carries that name; Setup decides once, from the config, what
+// reaches the output and in which format.
+//
+// WHY printf-style methods:
+// Log lines in TailClip are sentences written for the person reading
+// agent.log, not field dumps. Errorf and friends keep them that way while
+// adding the level and component as structured fields - which is what JSON
+// output and log shippers need.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Log levels accepted in log_level.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// Log formats accepted in log_format.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Levels and Formats list the accepted values, for config validation.
+var (
+	Levels  = []string{LevelDebug, LevelInfo, LevelWarn, LevelError}
+	Formats = []string{FormatText, FormatJSON}
+)
+
+// Validate checks a log_level and log_format pair.
+func Validate(level, format string) error {
+	if !slices.Contains(Levels, level) {
+		return fmt.Errorf("log_level must be one of %s, got %q", strings.Join(Levels, ", "), level)
+	}
+	if !slices.Contains(Formats, format) {
+		return fmt.Errorf("log_format must be one of %s, got %q", strings.Join(Formats, ", "), format)
+	}
+	return nil
+}
+
+// Setup sends all logging - Loggers and the standard log package alike - to
+// w at level and above, formatted as format. Invalid values fall back to
+// info and text; configs are validated before this is called.
+// WHY include the standard log package: Libraries (and anything not yet
+// using a Logger) still reach the same output, at info level.
+func Setup(w io.Writer, level, format string) {
+	opts := &slog.HandlerOptions{Level: parseLevel(level)}
+	var handler slog.Handler
+	if format == FormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// parseLevel converts a log_level value to a slog level.
+func parseLevel(level string) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Logger writes log lines for one component, e.g. "sync" or "broadcast".
+// WHY resolve the output on every call: Component loggers are package-level
+// variables, created before main has read the config and called Setup.
+type Logger struct {
+	component string
+}
+
+// For returns the Logger for component.
+func For(component string) *Logger {
+	return &Logger{component: component}
+}
+
+// Debugf logs details only worth seeing while troubleshooting.
+func (l *Logger) Debugf(format string, args ...any) {
+	l.logf(slog.LevelDebug, format, args...)
+}
+
+// Infof logs normal operation.
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(slog.LevelInfo, format, args...)
+}
+
+// Warnf logs something wrong that the program works around.
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(slog.LevelWarn, format, args...)
+}
+
+// Errorf logs a failed operation.
+func (l *Logger) Errorf(format string, args ...any) {
+	l.logf(slog.LevelError, format, args...)
+}
+
+// Fatalf logs at error level and exits with status 1.
+func (l *Logger) Fatalf(format string, args ...any) {
+	l.logf(slog.LevelError, format, args...)
+	os.Exit(1)
+}
+
+// logf formats and writes one line if level is enabled.
+// WHY check first: Debug lines are often on hot paths (every poll, every
+// broadcast); formatting them only to drop them would cost for nothing.
+func (l *Logger) logf(level slog.Level, format string, args ...any) {
+	logger := slog.Default()
+	ctx := context.Background()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	logger.Log(ctx, level, fmt.Sprintf(format, args...), "component", l.component)
+}
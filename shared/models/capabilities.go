@@ -0,0 +1,43 @@
+// Author: Toluwalase Mebaanne
+// Package models defines the core data structures for TailClip.
+// These models represent the shared state across hub and agent components.
+
+package models
+
+// Capabilities describes the limits and features a hub supports.
+// WHY a negotiated struct: Hub and agents are configured separately and
+// upgraded at different times. Agents fetch this on (re)connect and adopt the
+// stricter of their own and the hub's limits, so a clip the hub would reject
+// is skipped locally - with a clear message - instead of failing mid-push.
+type Capabilities struct {
+	// MaxTextLength is the largest text payload (bytes) the hub accepts
+	// WHY: Lets agents enforce the same limit before spending bandwidth
+	MaxTextLength int `json:"max_text_length"`
+
+	// MaxFileSize is the largest file (bytes, before encoding) the hub
+	// accepts. Zero means the hub predates file sync
+	// WHY omitempty: Old agents ignore it, and an old hub's zero tells new
+	// agents not to send files at all
+	MaxFileSize int `json:"max_file_size,omitempty"`
+
+	// WireVersion is the hub's wire format version (see shared/wire). Zero
+	// means the hub predates versioning
+	// WHY: Lets agents warn about a hub they can't fully talk to before
+	// anything fails
+	WireVersion int `json:"wire_version,omitempty"`
+
+	// DataKeys is true when the hub stores per-day data keys for encrypted
+	// clips (see DataKey)
+	// WHY: Agents seal clips with the shared key directly on older hubs
+	DataKeys bool `json:"data_keys,omitempty"`
+
+	// ChunkSize is the largest part the hub accepts in a chunked upload
+	// (see Upload); zero on hubs without chunked uploads
+	// WHY: Agents only split large clips when the hub can reassemble them
+	ChunkSize int `json:"chunk_size,omitempty"`
+
+	// Compression lists the text compressions the hub decodes on push (see
+	// Event.Compression); empty on hubs that predate compression
+	// WHY: Agents only compress for a hub that can decompress
+	Compression []string `json:"compression,omitempty"`
+}
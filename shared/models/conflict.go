@@ -0,0 +1,30 @@
+// Author: Toluwalase Mebaanne
+// Package models defines the core data structures for TailClip.
+// These models represent the shared state across hub and agent components.
+
+package models
+
+import (
+	"time"
+)
+
+// DeviceConflict records two machines connecting with the same device ID.
+// WHY record it: A shared device_id (usually a copied config file) makes the
+// two machines knock each other offline in turn, which looks like flaky
+// sync. A persistent record turns that into an explainable event.
+type DeviceConflict struct {
+	// DeviceID is the device ID both machines claimed
+	DeviceID string `json:"device_id" db:"device_id"`
+
+	// ExistingAddr is the address of the connection that was already open
+	ExistingAddr string `json:"existing_addr" db:"existing_addr"`
+
+	// NewAddr is the address of the connection that caused the conflict
+	NewAddr string `json:"new_addr" db:"new_addr"`
+
+	// Action is what the hub did, per its duplicate_device_policy
+	Action string `json:"action" db:"action"`
+
+	// DetectedAt is when the conflict was detected (UTC)
+	DetectedAt time.Time `json:"detected_at" db:"detected_at"`
+}
@@ -0,0 +1,108 @@
+// Author: Toluwalase Mebaanne
+// Package models defines the core data structures for TailClip.
+// These models represent the shared state across hub and agent components.
+
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keyIDLayout is the form of a data key ID: the UTC day the key encrypts.
+const keyIDLayout = "2006-01-02"
+
+// keyGenerationSep separates a data key ID's day from its generation.
+const keyGenerationSep = "."
+
+// DataKey is a per-day key that end-to-end encrypted clips are sealed with,
+// wrapped (encrypted) with the agents' shared encryption_key.
+// WHY per-day keys on the hub: Deleting a day's wrapped key makes every clip
+// sealed with it unreadable at once, even to someone holding the shared key
+// and a copy of the history. Row deletion can't promise that - deleted
+// pages linger on SSDs and in backups. The hub can store the wrapped keys
+// because it can't unwrap them.
+type DataKey struct {
+	// KeyID names the key: the UTC day it is used for, as YYYY-MM-DD,
+	// followed by .N for the Nth key started that day by a rotation (see
+	// NextDataKeyID)
+	// WHY a day: Shredding by date ("everything before March") is how
+	// people think about clearing history, and one key per day keeps the
+	// number of keys to fetch small
+	KeyID string `json:"key_id" db:"key_id"`
+
+	// Wrapped is the key encrypted with the shared encryption_key, base64
+	Wrapped string `json:"wrapped" db:"wrapped"`
+
+	// CreatedAt is when the first agent uploaded the key
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// DataKeyRewrap replaces the wrapped form of a data key after the shared
+// encryption_key was rotated. The key itself stays the same, so clips
+// sealed with it stay readable - with the new shared key only. Clips sealed
+// later that day use a new key (see NextDataKeyID).
+type DataKeyRewrap struct {
+	KeyID string `json:"key_id"`
+
+	// Wrapped is the key wrapped with the new shared key, base64
+	Wrapped string `json:"wrapped"`
+
+	// Previous is the wrapped form being replaced
+	// WHY: The hub only replaces a key still stored as Previous, so
+	// concurrent rotations can't mix shared keys
+	Previous string `json:"previous"`
+}
+
+// DataKeyID returns the ID of the first data key for clips sealed at t:
+// the day, which is also how shredding names the keys to destroy.
+func DataKeyID(t time.Time) string {
+	return t.UTC().Format(keyIDLayout)
+}
+
+// NextDataKeyID returns the ID of the key that replaces the valid key ID
+// id for the rest of its day: 2026-03-14 is followed by 2026-03-14.1, and
+// that by 2026-03-14.2.
+// WHY a new key after rotating the shared key: Rewrapping keeps the day's
+// key, and whoever leaked the old shared key may also hold the old wrapped
+// form. Clips sealed after the rotation must not open with it.
+func NextDataKeyID(id string) string {
+	day, generation, _ := strings.Cut(id, keyGenerationSep)
+	n, _ := strconv.Atoi(generation)
+	return day + keyGenerationSep + strconv.Itoa(n+1)
+}
+
+// DataKeyDay returns the day part of the valid key ID id.
+func DataKeyDay(id string) string {
+	day, _, _ := strings.Cut(id, keyGenerationSep)
+	return day
+}
+
+// ValidateKeyID checks that id has the form DataKeyID or NextDataKeyID
+// produces.
+// WHY strict: IDs are compared as strings when shredding by date, which
+// only orders correctly for this exact form. A generation never changes
+// that: "2026-03-14.1" sorts after "2026-03-14" and before "2026-03-15".
+func ValidateKeyID(id string) error {
+	day, generation, found := strings.Cut(id, keyGenerationSep)
+	if ValidateKeyDay(day) != nil || found && !validGeneration(generation) {
+		return &ValidationError{Field: "key_id", Reason: "must be a date as YYYY-MM-DD, optionally followed by .N"}
+	}
+	return nil
+}
+
+// ValidateKeyDay checks that day has the form DataKeyID produces.
+func ValidateKeyDay(day string) error {
+	if t, err := time.Parse(keyIDLayout, day); err != nil || DataKeyID(t) != day {
+		return &ValidationError{Field: "key_id", Reason: "must be a date as YYYY-MM-DD"}
+	}
+	return nil
+}
+
+// validGeneration reports whether s is a generation NextDataKeyID makes: a
+// positive number without leading zeros.
+func validGeneration(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && strconv.Itoa(n) == s
+}
@@ -0,0 +1,54 @@
+// Author: Toluwalase Mebaanne
+// Tests for data key IDs and their generations.
+
+package models
+
+import "testing"
+
+func TestValidateKeyID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"2026-03-14", true},
+		{"2026-03-14.1", true},
+		{"2026-03-14.12", true},
+		{"2026-03-14.0", false},
+		{"2026-03-14.01", false},
+		{"2026-03-14.", false},
+		{"2026-03-14.+1", false},
+		{"2026-03-14.-1", false},
+		{"2026-3-14", false},
+		{"2026-02-30", false},
+		{"2026-03-14.1.1", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateKeyID(tt.id); (err == nil) != tt.valid {
+			t.Errorf("ValidateKeyID(%q) = %v, want valid %v", tt.id, err, tt.valid)
+		}
+	}
+	if err := ValidateKeyDay("2026-03-14.1"); err == nil {
+		t.Error("ValidateKeyDay accepted a generation")
+	}
+}
+
+func TestNextDataKeyID(t *testing.T) {
+	tests := []struct{ id, want string }{
+		{"2026-03-14", "2026-03-14.1"},
+		{"2026-03-14.1", "2026-03-14.2"},
+		{"2026-03-14.9", "2026-03-14.10"},
+	}
+	for _, tt := range tests {
+		got := NextDataKeyID(tt.id)
+		if got != tt.want {
+			t.Errorf("NextDataKeyID(%s) = %s, want %s", tt.id, got, tt.want)
+		}
+		if err := ValidateKeyID(got); err != nil {
+			t.Errorf("NextDataKeyID(%s) = %s, which is invalid: %v", tt.id, got, err)
+		}
+		if DataKeyDay(got) != DataKeyDay(tt.id) {
+			t.Errorf("NextDataKeyID(%s) = %s, on another day", tt.id, got)
+		}
+	}
+}
@@ -36,6 +36,55 @@ type Device struct {
 	// WHY: Users may want to temporarily disable sync on specific devices
 	// Also useful for administrative control (ban misbehaving devices)
 	Enabled bool `json:"enabled" db:"enabled"`
+
+	// Notify controls whether receiving agents should show a notification
+	// for clips originating from this device
+	// WHY stored on the hub: The preference describes the source device
+	// (e.g., silent for my own laptop, loud for the shared family PC), so it
+	// belongs in one central place rather than duplicated in every agent config
+	Notify bool `json:"notify" db:"notify"`
+
+	// StoreHistory controls whether clips from this device are kept in hub history
+	// WHY: A machine handling sensitive client data may still want to paste
+	// into other devices, but nothing it copies should persist on the hub.
+	// When false its clips are broadcast live and never written to storage
+	StoreHistory bool `json:"store_history" db:"store_history"`
+
+	// NodeID is the Tailscale node (StableID) this device is bound to
+	// WHY: In tailnet_identity mode, requests for this device_id are only
+	// accepted from this node. Set by the hub, never by the agent; empty
+	// means unbound
+	NodeID string `json:"node_id,omitempty" db:"node_id"`
+
+	// SigningKey is the public half of the key the device signs its clips
+	// with (see Event.Signature), base64-encoded; empty if it doesn't sign
+	// WHY on the hub: The first key a device registers sticks, so nobody
+	// else holding the shared token can push signed clips in its name.
+	// Replacing it takes the hub's token (DELETE /api/v1/devices/{id}/signing-key)
+	SigningKey string `json:"signing_key,omitempty" db:"signing_key"`
+
+	// HasToken is true once the hub has issued the device its own auth
+	// token (see `agent enroll`)
+	// WHY only a flag: The hub keeps just a hash of the token and shows the
+	// token itself once, when issuing it. Set by the hub, never by the agent
+	HasToken bool `json:"has_token,omitempty" db:"-"`
+}
+
+// DeviceStatus is a registered device as listed by the hub, with its
+// current status.
+type DeviceStatus struct {
+	Device
+
+	// Online is true when the device checked in within the last five
+	// minutes (see IsOnline) or is connected
+	// WHY both: Agents only check in when they start or reconnect, so a
+	// device that has been connected for hours is online despite an old
+	// LastSeenUTC
+	Online bool `json:"online"`
+
+	// Connected is true while the device has a WebSocket connection open
+	// to the hub
+	Connected bool `json:"connected"`
 }
 
 // IsOnline checks if the device has been seen recently (within the last 5 minutes).
@@ -16,6 +16,7 @@ import (
 type Event struct {
 	// EventID uniquely identifies this clipboard event
 	// WHY: Prevents duplicate processing and enables event ordering/tracking
+	// A UUID or ULID; agents choose the scheme (see KnownEventIDSchemes)
 	EventID string `json:"event_id" db:"event_id"`
 
 	// SourceDeviceID identifies which device created this clipboard event
@@ -32,14 +33,175 @@ type Event struct {
 
 	// Text contains the actual clipboard text content
 	// WHY: Stores the payload that needs to be synchronized across devices
+	// File clips carry the file base64-encoded here (see ContentTypeFile)
 	Text string `json:"text" db:"text"`
 
+	// Formats holds richer representations of a text clip, keyed by format
+	// (FormatHTML, FormatRTF). Text is always the plain-text fallback
+	// WHY alongside Text instead of a new content type: Hubs and agents that
+	// predate rich text ignore the field and still sync the plain text
+	Formats map[string]string `json:"formats,omitempty" db:"formats"`
+
+	// Encrypted marks a clip sealed by the source agent (see shared/e2e):
+	// Text holds the ciphertext of the text, formats, and file name, which
+	// are empty on the wire
+	// WHY a flag the hub can read: It must skip content checks and rewrites
+	// it can't perform on ciphertext, and receivers must know to decrypt
+	Encrypted bool `json:"encrypted,omitempty" db:"encrypted"`
+
+	// KeyID names the DataKey an encrypted clip is sealed with; empty when
+	// it is sealed with the shared key directly
+	// WHY: Receivers fetch that key from the hub, and shredding it makes the
+	// clip unreadable
+	KeyID string `json:"key_id,omitempty" db:"key_id"`
+
+	// Signature is the source device's Ed25519 signature over the clip (see
+	// e2e.SignEvent), base64-encoded; empty for unsigned clips
+	// WHY: Receivers that know the device's key can tell a clip it really
+	// sent from one a compromised hub made up in its name. The hub stores
+	// and forwards it, and leaves signed clips' content alone
+	Signature string `json:"signature,omitempty" db:"signature"`
+
+	// SigningKey is the public key Signature was made with, base64-encoded
+	// WHY carried on every clip: Agents pin a device's key the first time
+	// they see it, and the hub checks it against the key the device
+	// registered. Neither needs a separate lookup
+	SigningKey string `json:"signing_key,omitempty" db:"signing_key"`
+
+	// Compression names how Text is compressed on the wire (CompressionGzip);
+	// empty for uncompressed text. A compressed Text is the base64 of the
+	// compressed bytes, while TextHash still covers the original text
+	// WHY not persisted: It only describes this transfer. Hub and agents
+	// decompress on receipt, and only send it to peers that can decode it
+	Compression string `json:"compression,omitempty" db:"-"`
+
+	// FileName is the base name of a file clip; empty for other types
+	// WHY: Receivers save the file under it
+	FileName string `json:"file_name,omitempty" db:"file_name"`
+
+	// BlobURL is where to download the text of a file clip the hub keeps in
+	// its blob store (see the hub's blobs config); Text is empty then. A
+	// path ("/api/v1/blobs/ID") is on the hub and needs the auth token; a
+	// full URL is presigned and must be fetched without it
+	// WHY not persisted: It is made for each response. Presigned URLs
+	// expire, and the hub's address is the client's business
+	BlobURL string `json:"blob_url,omitempty" db:"-"`
+
+	// BlobKey names the object holding the text of an offloaded file clip;
+	// empty when the text is in the events table
+	// WHY never on the wire: Only the hub can reach the store; clients get
+	// BlobURL
+	BlobKey string `json:"-" db:"blob"`
+
 	// TextHash is a SHA-256 hash of the text content
 	// WHY: Enables efficient deduplication without comparing full text content
 	// Also useful for privacy (can check if content matches without storing plain text)
 	TextHash string `json:"text_hash" db:"text_hash"`
+
+	// Channel is the named stream this event was pushed to (e.g., "work")
+	// WHY: Lets one hub serve separate groups of devices or purposes; agents
+	// only receive channels they subscribe to. Empty means DefaultChannel
+	Channel string `json:"channel,omitempty" db:"channel"`
+
+	// OriginHub names the federated hub (see the hub's federation config) a
+	// clip was relayed from; empty for clips pushed to this hub directly
+	// WHY: Shows where a friend's clip came from, and keeps relayed clips
+	// from being relayed again. Set on the hub only, like Note
+	OriginHub string `json:"origin_hub,omitempty" db:"origin_hub"`
+
+	// Guest marks a clip pushed by a device on a temporary guest pass (see
+	// the hub's `hub guest` command)
+	// WHY: Receivers can tell a borrowed machine's clips from the
+	// household's own. Set on the hub only, like OriginHub
+	Guest bool `json:"guest,omitempty" db:"guest"`
+
+	// Note is a short annotation attached to the event after the fact
+	// (e.g., "staging DB password - rotate Friday")
+	// WHY: Turns history into a lightweight shared scratchpad. Set on the hub
+	// only - agents never push a note with a clip
+	Note string `json:"note,omitempty" db:"note"`
+
+	// Pinned keeps the event in history regardless of retention_days and
+	// history_limit
+	// WHY: Snippets pasted again and again (an address, a license key) are
+	// worth keeping forever, while the rest of history ages out. Set on the
+	// hub only, like Note
+	Pinned bool `json:"pinned,omitempty" db:"pinned"`
+
+	// PinnedFor lists devices that keep this event in their quick-access
+	// list (`agent pins`) until it is unpinned for them
+	// WHY per device: The Wi-Fi password belongs on the guest laptop, the
+	// deploy command on the work machine; neither should crowd the others'
+	// lists. Retention keeps these events like pinned ones. Set on the hub
+	// only, like Pinned
+	PinnedFor []string `json:"pinned_for,omitempty" db:"pinned_for"`
+
+	// Silent is a broadcast-time hint asking receiving agents not to notify
+	// WHY not persisted: It is derived from the source device's preference
+	// when the hub broadcasts, so changing the preference affects future
+	// deliveries without rewriting stored history
+	Silent bool `json:"silent,omitempty" db:"-"`
+
+	// HubReceivedAt is when the hub accepted the push (hub clock, UTC)
+	// WHY: Together with Timestamp (origin) and HubBroadcastAt, lets the
+	// receiving agent split end-to-end latency into upload, hub, and
+	// delivery legs. Not persisted - it only describes this delivery
+	HubReceivedAt time.Time `json:"hub_received_at,omitzero" db:"-"`
+
+	// HubBroadcastAt is when the hub wrote the event to WebSocket clients
+	// WHY: See HubReceivedAt
+	HubBroadcastAt time.Time `json:"hub_broadcast_at,omitzero" db:"-"`
+
+	// Delayed marks a broadcast the hub deliberately held back (quiet hours)
+	// WHY: Receivers skip latency reporting for it - hours of intentional
+	// delay would swamp the sync latency percentiles
+	Delayed bool `json:"delayed,omitempty" db:"-"`
+
+	// Provisional marks a clip broadcast before the hub finished storing it
+	// (the hub's broadcast_before_store option)
+	// WHY: A receiver can't assume a provisional clip is in history yet -
+	// if the write fails, it never will be
+	Provisional bool `json:"provisional,omitempty" db:"-"`
+
+	// Seq is the hub's broadcast sequence number for this delivery
+	// WHY: Agents report the last one they saw when resuming a WebSocket
+	// session (see Session), so the hub knows where to replay from. Sequence
+	// numbers restart with the hub; they only have meaning within a session
+	Seq uint64 `json:"seq,omitempty" db:"-"`
+
+	// Replayed marks an event re-sent after a resumed reconnect
+	// WHY: Like Delayed, its latency says nothing about sync speed
+	Replayed bool `json:"replayed,omitempty" db:"-"`
+
+	// Archived marks an event the hub read back from its archive after
+	// retention pruned it (see the hub's archive config)
+	// WHY not persisted: It describes where this copy came from; the event
+	// is no longer in history
+	Archived bool `json:"archived,omitempty" db:"-"`
+
+	// ExpiresAt marks a transient clip (e.g., a password) and when it stops
+	// being valid (UTC). Zero means the clip never expires
+	// WHY: Set by the source agent for clips matching its sensitive
+	// patterns. The hub never stores such clips, and receivers put back
+	// their previous clipboard content once it passes
+	ExpiresAt time.Time `json:"expires_at,omitzero" db:"-"`
+}
+
+// IsTransient reports whether the event carries an expiry time.
+func (e *Event) IsTransient() bool {
+	return !e.ExpiresAt.IsZero()
 }
 
+// IsSigned reports whether the event carries a signature.
+func (e *Event) IsSigned() bool {
+	return e.Signature != ""
+}
+
+// DefaultChannel is the channel used when an event or agent names none.
+// WHY a named default instead of "no channel": Every event then belongs to
+// exactly one channel, so routing and subscriptions need no special case.
+const DefaultChannel = "default"
+
 // ComputeTextHash generates a SHA-256 hash of the event's text content.
 // WHY: Centralized hash computation ensures consistency across the application.
 // This is used for deduplication and quick content comparison.
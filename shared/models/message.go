@@ -0,0 +1,192 @@
+// Author: Toluwalase Mebaanne
+// Package models defines the core data structures for TailClip.
+// These models represent the shared state across hub and agent components.
+
+package models
+
+// WebSocket message types.
+// WHY a type field: The WebSocket carries more than clipboard events (latency
+// reports up, presence down). Tagging messages lets each side tell kinds
+// apart instead of guessing from the shape of the JSON.
+//
+// WHY events stay untagged: Older agents decode every hub message as an
+// Event, so events stay bare (an empty type means "event") and the hub only
+// sends control messages to agents that opt in when connecting (see
+// WebSocketFeaturePresence). A control message decoded as an event would
+// otherwise be written to the clipboard as empty text. shared/wire applies
+// these rules when encoding and decoding.
+const (
+	MessageTypeLatency  = "latency"
+	MessageTypePresence = "presence"
+	MessageTypeAlert    = "alert"
+	MessageTypeSession  = "session"
+	MessageTypeChunk    = "chunk"
+	MessageTypeDeleted  = "deleted"
+	MessageTypeSnapshot = "snapshot"
+	MessageTypePin      = "pin"
+)
+
+// WebSocket features an agent can request via the comma-separated
+// `features` query parameter when connecting.
+const (
+	// WebSocketFeaturePresence asks for Presence messages.
+	WebSocketFeaturePresence = "presence"
+	// WebSocketFeatureAlerts asks for Alert messages.
+	WebSocketFeatureAlerts = "alerts"
+	// WebSocketFeatureResume asks for a Session message and, when the
+	// `resume` query parameter names the previous session, a replay of the
+	// events missed while disconnected.
+	WebSocketFeatureResume = "resume"
+	// WebSocketFeatureFiles asks for file events (ContentTypeFile).
+	// WHY opt-in: Older agents would paste the base64 content as text.
+	WebSocketFeatureFiles = "files"
+	// WebSocketFeatureEncrypted asks for end-to-end encrypted events.
+	// WHY opt-in: Older agents, and agents without the key, would paste the
+	// ciphertext as text.
+	WebSocketFeatureEncrypted = "encrypted"
+	// WebSocketFeatureChunks asks for large events as a series of Chunk
+	// messages instead of one frame.
+	WebSocketFeatureChunks = "chunks"
+	// WebSocketFeatureCompressed asks for large events with compressed text
+	// (see Event.Compression).
+	// WHY opt-in: Older agents would paste the base64 of the compressed text.
+	WebSocketFeatureCompressed = "compressed"
+	// WebSocketFeatureDeletions asks for Deleted messages.
+	WebSocketFeatureDeletions = "deletions"
+	// WebSocketFeatureSnapshot asks for a Snapshot message before anything
+	// else. The `snapshot_limit` query parameter sets how many events it
+	// holds.
+	WebSocketFeatureSnapshot = "snapshot"
+	// WebSocketFeaturePins asks for Pin messages about the connecting device.
+	WebSocketFeaturePins = "pins"
+	// WebSocketFeatureBlobs asks for file events the hub keeps in its blob
+	// store by reference (see Event.BlobURL) instead of with their text.
+	// WHY opt-in: Older agents would save an empty file.
+	WebSocketFeatureBlobs = "blobs"
+)
+
+// Presence tells an agent how many *other* devices are connected to the hub.
+// WHY: With no one else online, every push is wasted work; agents use this
+// to slow clipboard polling and save battery.
+type Presence struct {
+	Type  string `json:"type"`
+	Peers int    `json:"peers"`
+}
+
+// Alert is a message from the hub that agents show to the user as a
+// notification and never write to the clipboard.
+// WHY: Some problems (e.g., two machines sharing a device ID) are only
+// visible to the hub, but only the people at the devices can fix them.
+type Alert struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+
+	// Announcement is true for a message an operator sent to every device
+	// (see Announce), e.g. "hub restarting in 5 minutes".
+	// WHY an alert: Agents that opted in to alerts already show them and
+	// never touch the clipboard; older ones show announcements as alerts.
+	Announcement bool `json:"announcement,omitempty"`
+}
+
+// MaxAnnouncementLength is the longest announcement message, in characters.
+// WHY a limit: It ends up in a notification, which shows a line or two.
+const MaxAnnouncementLength = 500
+
+// Announce is the request body of POST /api/v1/admin/announce.
+type Announce struct {
+	Message string `json:"message"`
+
+	// DeviceIDs limits the announcement to these devices; empty means all.
+	DeviceIDs []string `json:"device_ids,omitempty"`
+}
+
+// AnnounceResult is the response to POST /api/v1/admin/announce.
+type AnnounceResult struct {
+	// Delivered is how many connected devices were sent the announcement.
+	// WHY only connected ones: An announcement is about now; one that
+	// arrived hours later ("restarting in 5 minutes") would mislead.
+	Delivered int `json:"delivered"`
+}
+
+// Session is the first message on a connection that requested
+// WebSocketFeatureResume. The agent presents Token when it reconnects.
+// WHY: A laptop waking from sleep reconnects seconds later, but whatever was
+// copied elsewhere in the meantime was broadcast to a dead socket. Resuming
+// the session lets the hub send exactly those events instead of nothing.
+type Session struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+
+	// Resumed is true when the presented token was accepted; otherwise this
+	// is a new session and nothing was replayed.
+	Resumed bool `json:"resumed"`
+
+	// Replayed is how many missed events follow this message.
+	Replayed int `json:"replayed"`
+
+	// Gap is true when more events were missed than the hub still holds,
+	// so some clips are only in history.
+	Gap bool `json:"gap,omitempty"`
+}
+
+// Chunk is one part of a WebSocket message too large to send in one frame
+// (see shared/wire). The parts of a message are sent in order, with nothing
+// in between, and joined by the receiver.
+// WHY: A multi-megabyte frame holds the connection - and every other message
+// behind it - until it is fully written, and proxies and WebSocket libraries
+// often cap frame sizes far below the hub's file limit.
+type Chunk struct {
+	Type string `json:"type"`
+
+	// EventID is the event the chunked message carries, or "snapshot" for a
+	// Snapshot
+	EventID string `json:"event_id"`
+
+	// Index is this part's position, from 0, and Total the number of parts
+	Index int `json:"index"`
+	Total int `json:"total"`
+
+	// Data is this part of the encoded message
+	Data string `json:"data"`
+}
+
+// Deleted tells agents that an event was deleted from the hub's history.
+// WHY: Deleting an accidentally synced password from history doesn't take
+// it off the devices it already reached. Agents that still hold it on their
+// clipboard clear it (see agent/sync.go).
+type Deleted struct {
+	Type    string `json:"type"`
+	EventID string `json:"event_id"`
+}
+
+// Pin tells an agent that an event was pinned for it (see Event.PinnedFor)
+// or unpinned.
+// WHY a message: The pin is usually set from another device or the hub,
+// and the clip should show up in this device's quick-access list at once.
+type Pin struct {
+	Type    string `json:"type"`
+	EventID string `json:"event_id"`
+	Pinned  bool   `json:"pinned"`
+
+	// Event is the pinned event, content included; nil when unpinning.
+	// WHY included: The agent may never have received the clip - it could
+	// be days old, or from a channel this device doesn't subscribe to.
+	Event *Event `json:"event,omitempty"`
+}
+
+// Snapshot is the first message on a connection that requested
+// WebSocketFeatureSnapshot: the hub's state at the moment of connecting.
+// WHY: A dashboard that only shows what arrives live starts out blank and
+// stays that way until someone copies something. The snapshot fills it in,
+// and nothing broadcast after it is missed.
+type Snapshot struct {
+	Type string `json:"type"`
+
+	// Events are the latest stored events the connection would have been
+	// sent, newest first
+	Events []Event `json:"events"`
+
+	// Devices are the IDs of the devices connected to the hub, including
+	// the one receiving the snapshot
+	Devices []string `json:"devices"`
+}
@@ -0,0 +1,35 @@
+// Author: Toluwalase Mebaanne
+// Package models defines the core data structures for TailClip.
+// These models represent the shared state across hub and agent components.
+
+package models
+
+import (
+	"time"
+)
+
+// RejectedEvent is a metadata-only record of an event the hub refused.
+// WHY keep a record at all: A rejected clip otherwise vanishes without a
+// trace - the user copied something, it never arrived, and nothing explains
+// why. Storing who/what/why (never the content) makes that discoverable.
+type RejectedEvent struct {
+	// EventID is the rejected event's ID, if the request got far enough to parse it
+	EventID string `json:"event_id" db:"event_id"`
+
+	// SourceDeviceID is the device that attempted the push, if known
+	SourceDeviceID string `json:"source_device_id" db:"source_device_id"`
+
+	// ContentType is the declared content type, if known
+	ContentType string `json:"content_type" db:"content_type"`
+
+	// Size is the payload size in bytes
+	// WHY size but not content: Enough to explain "too large" rejections
+	// without retaining data the hub just decided not to accept
+	Size int `json:"size" db:"size"`
+
+	// Reason is a human-readable explanation of the rejection
+	Reason string `json:"reason" db:"reason"`
+
+	// RejectedAt is when the hub refused the event (UTC)
+	RejectedAt time.Time `json:"rejected_at" db:"rejected_at"`
+}
@@ -0,0 +1,132 @@
+// Author: Toluwalase Mebaanne
+// Package models defines the core data structures for TailClip.
+// These models represent the shared state across hub and agent components.
+
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// LatencyReport is sent by a receiving agent after applying a synced event.
+//
+// WHY legs instead of one number: A slow sync can be the origin's upload,
+// the hub (storage), or delivery to the receiver. Only HubMs is measured on
+// a single clock; the other legs compare clocks on two machines and include
+// any skew between them, which Tailscale peers running NTP keep small.
+type LatencyReport struct {
+	Type           string `json:"type"`
+	EventID        string `json:"event_id"`
+	SourceDeviceID string `json:"source_device_id"`
+
+	// UploadMs is origin timestamp → hub received
+	UploadMs int64 `json:"upload_ms"`
+	// HubMs is hub received → hub broadcast (storage and fan-out)
+	HubMs int64 `json:"hub_ms"`
+	// DeliveryMs is hub broadcast → applied to the receiver's clipboard
+	DeliveryMs int64 `json:"delivery_ms"`
+	// TotalMs is origin timestamp → applied
+	TotalMs int64 `json:"total_ms"`
+}
+
+// NewLatencyReport computes the latency legs for an event applied at appliedAt.
+// WHY zero legs for missing hub timestamps: Events from an older hub lack
+// them; TotalMs is still meaningful on its own.
+func NewLatencyReport(event *Event, appliedAt time.Time) LatencyReport {
+	report := LatencyReport{
+		Type:           MessageTypeLatency,
+		EventID:        event.EventID,
+		SourceDeviceID: event.SourceDeviceID,
+		TotalMs:        appliedAt.Sub(event.Timestamp).Milliseconds(),
+	}
+	if !event.HubReceivedAt.IsZero() && !event.HubBroadcastAt.IsZero() {
+		report.UploadMs = event.HubReceivedAt.Sub(event.Timestamp).Milliseconds()
+		report.HubMs = event.HubBroadcastAt.Sub(event.HubReceivedAt).Milliseconds()
+		report.DeliveryMs = appliedAt.Sub(event.HubBroadcastAt).Milliseconds()
+	}
+	return report
+}
+
+// Percentiles summarizes a latency distribution in milliseconds.
+type Percentiles struct {
+	P50 int64 `json:"p50"`
+	P90 int64 `json:"p90"`
+	P99 int64 `json:"p99"`
+	Max int64 `json:"max"`
+}
+
+// NewPercentiles returns nearest-rank percentiles of values (sorted in place).
+// WHY clamp negatives to zero: Cross-machine legs can go slightly negative
+// from clock skew; "faster than instant" is noise, not a measurement.
+func NewPercentiles(values []int64) Percentiles {
+	if len(values) == 0 {
+		return Percentiles{}
+	}
+	for i, v := range values {
+		if v < 0 {
+			values[i] = 0
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	rank := func(p int) int64 {
+		idx := (p*len(values)+99)/100 - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return values[idx]
+	}
+	return Percentiles{
+		P50: rank(50),
+		P90: rank(90),
+		P99: rank(99),
+		Max: values[len(values)-1],
+	}
+}
+
+// LatencyStats aggregates recent latency reports.
+type LatencyStats struct {
+	// Samples is how many reports the percentiles are computed over
+	Samples    int         `json:"samples"`
+	UploadMs   Percentiles `json:"upload_ms"`
+	HubMs      Percentiles `json:"hub_ms"`
+	DeliveryMs Percentiles `json:"delivery_ms"`
+	TotalMs    Percentiles `json:"total_ms"`
+}
+
+// RetentionStats describes the hub's automatic pruning since it started.
+type RetentionStats struct {
+	// Runs is how many times the retention job has run
+	Runs int `json:"runs"`
+	// Pruned is how many events it deleted in total
+	Pruned int64 `json:"pruned"`
+	// LastRunAt is when it last ran (UTC); zero if it hasn't
+	LastRunAt time.Time `json:"last_run_at,omitzero"`
+	// LastPruned is how many events the last run deleted
+	LastPruned int64 `json:"last_pruned"`
+	// LastError is why the last run failed; empty if it succeeded
+	LastError string `json:"last_error,omitempty"`
+}
+
+// HistoryPolicy describes the history endpoint's page sizes.
+// WHY in stats: Clients can discover how much one request returns instead
+// of assuming the defaults.
+type HistoryPolicy struct {
+	// DefaultLimit is the page size when a request names no limit
+	DefaultLimit int `json:"default_limit"`
+	// MaxLimit is the largest page; larger limits are clamped to it
+	MaxLimit int `json:"max_limit"`
+}
+
+// HubStats is the response of the hub stats endpoint.
+type HubStats struct {
+	ConnectedClients int            `json:"connected_clients"`
+	Latency          LatencyStats   `json:"latency"`
+	Retention        RetentionStats `json:"retention"`
+	// ClipClasses counts clips by source device and class ("url", "code",
+	// "short_text", "long_text", "image", "file", "encrypted"); only
+	// present when the hub's clip_class_stats is on
+	ClipClasses map[string]map[string]int64 `json:"clip_classes,omitempty"`
+	History     HistoryPolicy               `json:"history"`
+}
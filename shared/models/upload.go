@@ -0,0 +1,34 @@
+// Author: Toluwalase Mebaanne
+// Package models defines the core data structures for TailClip.
+// These models represent the shared state across hub and agent components.
+
+package models
+
+// Upload starts a chunked push: the event without its text, and how long
+// the text is. The text follows in parts (see the hub's /api/v1/uploads).
+// WHY chunked pushes: A large clip sent as one request starts over from
+// byte zero whenever the connection drops - on a laptop switching networks,
+// possibly forever. Parts let the agent pick up where the hub left off.
+type Upload struct {
+	// Event is the event being pushed; its Text is empty and its TextHash
+	// covers the full text, which the hub checks once it has all parts
+	Event Event `json:"event"`
+
+	// Size is the length of the event's text in bytes
+	Size int `json:"size"`
+}
+
+// UploadStatus reports how far a chunked push has got.
+type UploadStatus struct {
+	EventID string `json:"event_id"`
+
+	// Received is how many bytes of the text the hub holds; the next part
+	// must start there
+	Received int `json:"received"`
+
+	// Size is the length of the whole text in bytes
+	Size int `json:"size"`
+
+	// ChunkSize is the largest part the hub accepts
+	ChunkSize int `json:"chunk_size"`
+}
@@ -0,0 +1,281 @@
+// Author: Toluwalase Mebaanne
+// Package models defines the core data structures for TailClip.
+// These models represent the shared state across hub and agent components.
+
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Field limits enforced by ValidateEvent.
+// WHY bounded: IDs and channel names end up in SQLite indexes, log lines,
+// WebSocket query strings, and notifications. None of them has a reason to
+// be long, and unbounded values let one bad payload bloat all of those.
+const (
+	MaxDeviceIDLength = 128
+	MaxChannelLength  = 64
+	MaxFileNameLength = 255
+)
+
+// Content types.
+const (
+	// ContentTypeText is the content type of plain text clips.
+	ContentTypeText = "text"
+	// ContentTypeFile is the content type of file clips: Text holds the
+	// file's bytes base64-encoded and FileName its base name.
+	ContentTypeFile = "file"
+)
+
+// KnownContentTypes lists the content types the hub accepts.
+// WHY a closed list: An unknown type is stored but can't be validated or
+// rendered by anything, so it only produces history rows nobody can read.
+// Types are added here when a handler for them exists.
+var KnownContentTypes = []string{ContentTypeText, ContentTypeFile}
+
+// Event ID schemes agents can generate event IDs with (the agent's
+// event_id_scheme). ValidateEvent accepts IDs from any of them.
+const (
+	// EventIDUUIDv4 is a random UUID.
+	EventIDUUIDv4 = "uuidv4"
+	// EventIDUUIDv7 is a UUID that starts with its creation time in
+	// milliseconds, so IDs sort in the order they were made.
+	EventIDUUIDv7 = "uuidv7"
+	// EventIDULID is a ULID: 26 characters of Crockford base32 that start
+	// with the creation time, like EventIDUUIDv7, and are shorter to read.
+	EventIDULID = "ulid"
+)
+
+// KnownEventIDSchemes lists the supported event ID schemes.
+var KnownEventIDSchemes = []string{EventIDUUIDv4, EventIDUUIDv7, EventIDULID}
+
+// CompressionGzip marks an event whose text is gzip-compressed (see
+// Event.Compression).
+const CompressionGzip = "gzip"
+
+// Rich text formats an Event may carry in Formats, named by MIME type.
+const (
+	FormatHTML = "text/html"
+	FormatRTF  = "text/rtf"
+)
+
+// KnownFormats lists the rich text formats the hub accepts.
+var KnownFormats = []string{FormatHTML, FormatRTF}
+
+// ValidationError reports which field of an event is invalid and why.
+// WHY structured: Callers (the hub's 400 response, the rejected-events
+// record, the agent's journal) can show the field without parsing text.
+type ValidationError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// ValidateEvent checks an event's fields against the wire schema.
+// Content rules (emptiness, size) are the content handlers' job; this only
+// guarantees the event is well-formed enough to store, index, and route.
+//
+// An empty TextHash or Channel is allowed: the hub fills them in.
+func ValidateEvent(e *Event) error {
+	if !isUUID(e.EventID) && !isULID(e.EventID) {
+		return &ValidationError{Field: "event_id", Reason: "must be a UUID or ULID"}
+	}
+	if err := validateName("source_device_id", e.SourceDeviceID, MaxDeviceIDLength, true); err != nil {
+		return err
+	}
+	if !slices.Contains(KnownContentTypes, e.ContentType) {
+		return &ValidationError{Field: "content_type",
+			Reason: fmt.Sprintf("must be one of %s", strings.Join(KnownContentTypes, ", "))}
+	}
+	// WHY skip the hash for compressed text: It covers the original text,
+	// which is checked once the receiver has decompressed it.
+	switch e.Compression {
+	case "":
+		if e.TextHash != "" && e.TextHash != e.ComputeTextHash() {
+			return &ValidationError{Field: "text_hash", Reason: "does not match text"}
+		}
+	case CompressionGzip:
+	default:
+		return &ValidationError{Field: "compression", Reason: fmt.Sprintf("must be empty or %s", CompressionGzip)}
+	}
+	if e.Channel != "" {
+		if err := ValidateChannel(e.Channel); err != nil {
+			return err
+		}
+	}
+	if err := validateSignature(e); err != nil {
+		return err
+	}
+	// WHY sealed clips skip the content-shape checks: Their formats and
+	// file name travel inside the ciphertext, where only the receiving
+	// agent can check them (after decrypting, with this same function).
+	if e.Encrypted {
+		if len(e.Formats) > 0 || e.FileName != "" {
+			return &ValidationError{Field: "encrypted", Reason: "formats and file_name must be inside the ciphertext"}
+		}
+		if e.KeyID != "" {
+			return ValidateKeyID(e.KeyID)
+		}
+		return nil
+	}
+	if e.KeyID != "" {
+		return &ValidationError{Field: "key_id", Reason: "only allowed on encrypted clips"}
+	}
+	if err := validateFormats(e); err != nil {
+		return err
+	}
+	if e.ContentType == ContentTypeFile {
+		return validateFileName(e.FileName)
+	}
+	return nil
+}
+
+// validateFormats checks a clip's rich text formats.
+// WHY text only: Formats are alternatives to the plain text; a file has no
+// other representation.
+func validateFormats(e *Event) error {
+	if len(e.Formats) == 0 {
+		return nil
+	}
+	if e.ContentType != ContentTypeText {
+		return &ValidationError{Field: "formats", Reason: "only allowed on text clips"}
+	}
+	for format := range e.Formats {
+		if !slices.Contains(KnownFormats, format) {
+			return &ValidationError{Field: "formats",
+				Reason: fmt.Sprintf("must be one of %s", strings.Join(KnownFormats, ", "))}
+		}
+	}
+	return nil
+}
+
+// ValidateChannel checks a channel name outside of an event (e.g., in a
+// config) with the same rules as Event.Channel, except that it is required.
+// WHY no commas: Agents subscribe with a comma-separated channel list, so a
+// channel containing one could never be subscribed to.
+func ValidateChannel(channel string) error {
+	if err := validateName("channel", channel, MaxChannelLength, true); err != nil {
+		return err
+	}
+	if strings.Contains(channel, ",") {
+		return &ValidationError{Field: "channel", Reason: "must not contain commas"}
+	}
+	return nil
+}
+
+// ValidateDeviceID checks a device ID outside of an event (registration,
+// WebSocket connections) with the same rules as Event.SourceDeviceID.
+func ValidateDeviceID(deviceID string) error {
+	return validateName("device_id", deviceID, MaxDeviceIDLength, true)
+}
+
+// validateName checks an identifier-like string: bounded length and no
+// control characters.
+func validateName(field, value string, maxLength int, required bool) error {
+	if value == "" {
+		if required {
+			return &ValidationError{Field: field, Reason: "is required"}
+		}
+		return nil
+	}
+	if len(value) > maxLength {
+		return &ValidationError{Field: field, Reason: fmt.Sprintf("exceeds %d bytes", maxLength)}
+	}
+	// WHY reject control characters: Newlines and escapes in an ID forge
+	// extra log lines and garble terminal output of maintenance commands.
+	if strings.ContainsFunc(value, unicode.IsControl) {
+		return &ValidationError{Field: field, Reason: "contains control characters"}
+	}
+	return nil
+}
+
+// validateFileName checks a file clip's name.
+// WHY a bare name only: Receivers save the file under this name. A path
+// separator or ".." would let a sender choose where on the receiver's disk
+// the file lands.
+func validateFileName(name string) error {
+	if err := validateName("file_name", name, MaxFileNameLength, true); err != nil {
+		return err
+	}
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return &ValidationError{Field: "file_name", Reason: "must be a file name without a path"}
+	}
+	return nil
+}
+
+// isUUID reports whether s is a UUID in canonical 8-4-4-4-12 hex form.
+// WHY not parse with the uuid package: models stays dependency-free, and
+// only the textual shape matters here.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isULID reports whether s is a ULID: 26 characters of Crockford base32,
+// in either case, whose first character keeps the timestamp within 48 bits.
+func isULID(s string) bool {
+	if len(s) != 26 || s[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		if !(c >= '0' && c <= '9' || c >= 'A' && c <= 'Z') || strings.IndexByte("ILOU", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Encoded lengths of an Ed25519 signature and public key (see
+// Event.Signature).
+const (
+	SignatureLength  = 88
+	SigningKeyLength = 44
+)
+
+// validateSignature checks that a signature and its key come together and
+// have the right lengths.
+// WHY only the shape: Whether the signature verifies is for the receiver to
+// decide, against the key it trusts (see shared/e2e).
+func validateSignature(e *Event) error {
+	if e.Signature == "" && e.SigningKey == "" {
+		return nil
+	}
+	if len(e.Signature) != SignatureLength {
+		return &ValidationError{Field: "signature", Reason: fmt.Sprintf("must be %d characters of base64", SignatureLength)}
+	}
+	return ValidateSigningKey(e.SigningKey)
+}
+
+// ValidateSigningKey checks the shape of a base64-encoded Ed25519 public key.
+func ValidateSigningKey(key string) error {
+	if len(key) != SigningKeyLength {
+		return &ValidationError{Field: "signing_key", Reason: fmt.Sprintf("must be %d characters of base64", SigningKeyLength)}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Author: Toluwalase Mebaanne
+// Chunking of large WebSocket messages and pushes.
+//
+// WHY split encoded messages rather than event fields:
+// Any message can then be chunked without the receiver knowing its type in
+// advance - it joins the parts and decodes the result with Unmarshal, as
+// if it had arrived in one frame.
+
+package wire
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// ChunkSize is the largest part, in bytes, of a chunked message or push.
+// WHY 256 KB: Small enough to stay below common frame and body limits of
+// proxies, and for a dropped connection to lose little; large enough that
+// a 5 MB file needs only a few dozen parts.
+const ChunkSize = 256 * 1024
+
+// Split cuts an encoded message for eventID into Chunk messages of at most
+// size bytes, or returns nil if it fits into one.
+// WHY cut at rune boundaries: Data travels in a JSON string, which would
+// replace half of a split UTF-8 sequence and corrupt the message.
+func Split(eventID string, data []byte, size int) []models.Chunk {
+	if len(data) <= size {
+		return nil
+	}
+	var parts []string
+	for len(data) > 0 {
+		cut := min(size, len(data))
+		for cut < len(data) && cut > 0 && !utf8.RuneStart(data[cut]) {
+			cut--
+		}
+		parts = append(parts, string(data[:cut]))
+		data = data[cut:]
+	}
+	chunks := make([]models.Chunk, len(parts))
+	for i, part := range parts {
+		chunks[i] = models.Chunk{EventID: eventID, Index: i, Total: len(parts), Data: part}
+	}
+	return chunks
+}
+
+// Joiner reassembles chunked messages received in order. The zero value is
+// ready to use; it holds one message at a time.
+type Joiner struct {
+	eventID string
+	total   int
+	next    int
+	data    []byte
+}
+
+// Add appends a part and returns the complete message once its last part
+// has arrived, or nil while parts are missing.
+// WHY restart on a new first part: If a connection drops mid-message, the
+// hub sends the whole message again (see session resume); a stale partial
+// must not be glued to it.
+func (j *Joiner) Add(chunk *models.Chunk) ([]byte, error) {
+	if chunk.Index == 0 {
+		j.reset()
+		j.eventID, j.total = chunk.EventID, chunk.Total
+	}
+	if chunk.EventID != j.eventID || chunk.Total != j.total || chunk.Index != j.next || chunk.Index >= chunk.Total {
+		j.reset()
+		return nil, fmt.Errorf("unexpected chunk %d/%d of %s", chunk.Index+1, chunk.Total, chunk.EventID)
+	}
+	j.data = append(j.data, chunk.Data...)
+	j.next++
+	if j.next < j.total {
+		return nil, nil
+	}
+	data := j.data
+	j.reset()
+	return data, nil
+}
+
+// reset drops any partial message.
+func (j *Joiner) reset() {
+	*j = Joiner{}
+}
@@ -0,0 +1,104 @@
+// Author: Toluwalase Mebaanne
+// Compression of large event text.
+//
+// WHY compress on top of chunking:
+// Chunking makes a big paste survive a flaky link; compression makes it
+// cheaper on a slow one. Phone tethering and exit nodes move a few hundred
+// KB/s at best, and logs, JSON, and source code - what people actually paste
+// in bulk - shrink to a fifth or less.
+//
+// WHY gzip only:
+// It is in the standard library. zstd compresses faster and a little
+// better, but would be the first compression dependency on both sides; the
+// Compression field leaves room to add it later without a format change.
+//
+// Encrypted clips are never compressed: ciphertext doesn't shrink, and
+// compressing before sealing would let the size of a clip leak its content.
+
+package wire
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// DefaultCompressThreshold is the text length, in bytes, above which hub and
+// agents compress by default.
+// WHY 16 KB: Below that a clip is a few packets either way, and the CPU
+// spent compressing buys nothing noticeable.
+const DefaultCompressThreshold = 16 * 1024
+
+// Compressions lists the compressions this build can decode.
+var Compressions = []string{models.CompressionGzip}
+
+// ErrTooLarge is returned by Decompress when the text expands past its limit.
+var ErrTooLarge = errors.New("decompressed text exceeds the size limit")
+
+// Compress returns a copy of event with its text gzip-compressed when the
+// text is longer than threshold bytes and compression makes it smaller.
+// Otherwise, or when threshold is zero, it returns event itself. event is
+// never modified.
+func Compress(event *models.Event, threshold int) *models.Event {
+	if threshold <= 0 || len(event.Text) <= threshold || event.Encrypted || event.Compression != "" {
+		return event
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, event.Text); err != nil {
+		return event
+	}
+	if err := zw.Close(); err != nil {
+		return event
+	}
+	// WHY compare encoded lengths: Base64 adds a third; text that shrinks
+	// by less than that (already compressed files) would only grow.
+	if base64.StdEncoding.EncodedLen(buf.Len()) >= len(event.Text) {
+		return event
+	}
+
+	compressed := *event
+	compressed.Text = base64.StdEncoding.EncodeToString(buf.Bytes())
+	compressed.Compression = models.CompressionGzip
+	return &compressed
+}
+
+// Decompress restores the text of a compressed event in place; other
+// events are left alone. limit caps the decompressed text in bytes.
+// WHY a limit: A few KB of gzip can expand to gigabytes; the receiver's
+// content limits would only see the text after it was all in memory.
+func Decompress(event *models.Event, limit int) error {
+	switch event.Compression {
+	case "":
+		return nil
+	case models.CompressionGzip:
+	default:
+		return fmt.Errorf("unknown compression %q", event.Compression)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(event.Text)
+	if err != nil {
+		return fmt.Errorf("failed to decode compressed text: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decompress text: %w", err)
+	}
+	text, err := io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+	if err != nil {
+		return fmt.Errorf("failed to decompress text: %w", err)
+	}
+	if len(text) > limit {
+		return ErrTooLarge
+	}
+
+	event.Text = string(text)
+	event.Compression = ""
+	return nil
+}
@@ -0,0 +1,188 @@
+// Author: Toluwalase Mebaanne
+// Package wire defines how TailClip messages look on the wire, and which
+// versions of that format a build can talk to.
+//
+// WHY a separate package from models:
+// models describes what an event *is*; wire describes how it is framed
+// between processes - which WebSocket messages are tagged, which stay bare
+// for old agents, what an error body looks like. Hub and agents are
+// upgraded one machine at a time, so these rules must be written down in
+// one place rather than re-derived by every json.Marshal call.
+//
+// COMPATIBILITY RULES (what makes adjacent versions interoperate):
+//   - Unknown JSON fields are ignored by every decoder, so adding a field
+//     never needs a version bump.
+//   - New WebSocket message types are only sent to peers that asked for
+//     them via a models.WebSocketFeature*; Unmarshal reports the rest as
+//     ErrUnknownType and receivers skip them.
+//   - Version is bumped only when an existing field changes meaning or
+//     shape. MinVersion says how far back this build still understands.
+
+package wire
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+// Version is the wire format version this build speaks.
+const Version = 1
+
+// MinVersion is the oldest peer version this build interoperates with.
+const MinVersion = 1
+
+// Compatible reports whether a peer speaking version v can talk to this
+// build. Zero means the peer predates versioning, whose format is version 1.
+func Compatible(v int) bool {
+	if v == 0 {
+		v = 1
+	}
+	return v >= MinVersion && v <= Version
+}
+
+// ErrUnknownType is returned by Unmarshal for a message type this build
+// doesn't know - typically one added by a newer peer. Receivers skip it.
+var ErrUnknownType = errors.New("unknown message type")
+
+// Message is one WebSocket message. Exactly one field is set.
+type Message struct {
+	Event    *models.Event
+	Presence *models.Presence
+	Alert    *models.Alert
+	Session  *models.Session
+	Latency  *models.LatencyReport
+	Chunk    *models.Chunk
+	Deleted  *models.Deleted
+	Snapshot *models.Snapshot
+	Pin      *models.Pin
+}
+
+// header is decoded first to route a message by type.
+type header struct {
+	Type string `json:"type"`
+}
+
+// Marshal encodes msg, tagging control messages with their type.
+// WHY events stay untagged: Agents from before message types existed decode
+// every hub message as an Event; a bare event is what they understand.
+func Marshal(msg *Message) ([]byte, error) {
+	switch {
+	case msg.Event != nil:
+		return json.Marshal(msg.Event)
+	case msg.Presence != nil:
+		presence := *msg.Presence
+		presence.Type = models.MessageTypePresence
+		return json.Marshal(presence)
+	case msg.Alert != nil:
+		alert := *msg.Alert
+		alert.Type = models.MessageTypeAlert
+		return json.Marshal(alert)
+	case msg.Session != nil:
+		session := *msg.Session
+		session.Type = models.MessageTypeSession
+		return json.Marshal(session)
+	case msg.Latency != nil:
+		report := *msg.Latency
+		report.Type = models.MessageTypeLatency
+		return json.Marshal(report)
+	case msg.Chunk != nil:
+		chunk := *msg.Chunk
+		chunk.Type = models.MessageTypeChunk
+		return json.Marshal(chunk)
+	case msg.Deleted != nil:
+		deleted := *msg.Deleted
+		deleted.Type = models.MessageTypeDeleted
+		return json.Marshal(deleted)
+	case msg.Snapshot != nil:
+		snapshot := *msg.Snapshot
+		snapshot.Type = models.MessageTypeSnapshot
+		return json.Marshal(snapshot)
+	case msg.Pin != nil:
+		pin := *msg.Pin
+		pin.Type = models.MessageTypePin
+		return json.Marshal(pin)
+	}
+	return nil, errors.New("empty message")
+}
+
+// Unmarshal decodes a WebSocket message. An untagged message is an event.
+// It returns ErrUnknownType (wrapped) for types this build doesn't know.
+func Unmarshal(data []byte) (*Message, error) {
+	var h header
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("failed to decode message: %w", err)
+	}
+
+	msg := &Message{}
+	var target any
+	switch h.Type {
+	case "":
+		msg.Event = &models.Event{}
+		target = msg.Event
+	case models.MessageTypePresence:
+		msg.Presence = &models.Presence{}
+		target = msg.Presence
+	case models.MessageTypeAlert:
+		msg.Alert = &models.Alert{}
+		target = msg.Alert
+	case models.MessageTypeSession:
+		msg.Session = &models.Session{}
+		target = msg.Session
+	case models.MessageTypeLatency:
+		msg.Latency = &models.LatencyReport{}
+		target = msg.Latency
+	case models.MessageTypeChunk:
+		msg.Chunk = &models.Chunk{}
+		target = msg.Chunk
+	case models.MessageTypeDeleted:
+		msg.Deleted = &models.Deleted{}
+		target = msg.Deleted
+	case models.MessageTypeSnapshot:
+		msg.Snapshot = &models.Snapshot{}
+		target = msg.Snapshot
+	case models.MessageTypePin:
+		msg.Pin = &models.Pin{}
+		target = msg.Pin
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownType, h.Type)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return nil, fmt.Errorf("failed to decode %s message: %w", typeName(h.Type), err)
+	}
+	return msg, nil
+}
+
+// typeName names a message type for errors.
+func typeName(messageType string) string {
+	if messageType == "" {
+		return "event"
+	}
+	return messageType
+}
+
+// ErrorResponse is the JSON body of a structured hub error (currently the
+// 400 for an invalid event). Other errors are plain text.
+// WHY structured: Agents and scripts can show which field was wrong without
+// parsing the message.
+type ErrorResponse struct {
+	Error  string `json:"error"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// InvalidEvent returns the error body for an event that failed validation.
+func InvalidEvent(invalid *models.ValidationError) ErrorResponse {
+	return ErrorResponse{Error: "invalid event", Field: invalid.Field, Reason: invalid.Reason}
+}
+
+// DecodeError parses a hub error body, returning nil if it isn't one.
+func DecodeError(body []byte) *ErrorResponse {
+	var resp ErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Error == "" {
+		return nil
+	}
+	return &resp
+}
@@ -0,0 +1,251 @@
+// Author: Toluwalase Mebaanne
+// Golden tests for the wire format.
+//
+// WHY golden files:
+// The format is a promise to peers running other versions, not an
+// implementation detail. testdata/v1 holds what this version sends; a diff
+// there is a format change and needs the compatibility rules in wire.go.
+// testdata/v0 holds what peers from before versioning send, and
+// testdata/newer what a newer peer may send; both must keep decoding.
+// Regenerate testdata/v1 with `go test ./shared/wire -update`, then review
+// the diff.
+
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tmair/tailclip/shared/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the testdata/v1 golden files")
+
+// goldenTime keeps timestamps in the golden files stable.
+var goldenTime = time.Date(2026, 3, 14, 9, 26, 53, 0, time.UTC)
+
+func goldenEvent() *models.Event {
+	return &models.Event{
+		EventID:        "0195f0a2-7c3e-7b1a-9a4e-2f6d8c1b3a55",
+		SourceDeviceID: "laptop",
+		Timestamp:      goldenTime,
+		ContentType:    models.ContentTypeText,
+		Text:           "hello from the laptop",
+		TextHash:       "9f2c",
+		Channel:        "work",
+		Seq:            42,
+	}
+}
+
+// goldenMessages are the messages in testdata/v1, one per message type.
+func goldenMessages() map[string]*Message {
+	return map[string]*Message{
+		"event":    {Event: goldenEvent()},
+		"presence": {Presence: &models.Presence{Peers: 2}},
+		"alert":    {Alert: &models.Alert{Message: "Hub restarting at 22:00", Announcement: true}},
+		"session":  {Session: &models.Session{Token: "resume-token", Resumed: true, Replayed: 3}},
+		"latency": {Latency: &models.LatencyReport{EventID: "0195f0a2-7c3e-7b1a-9a4e-2f6d8c1b3a55",
+			SourceDeviceID: "laptop", UploadMs: 12, HubMs: 3, DeliveryMs: 40, TotalMs: 55}},
+		"chunk":    {Chunk: &models.Chunk{EventID: "0195f0a2-7c3e-7b1a-9a4e-2f6d8c1b3a55", Index: 1, Total: 3, Data: "part two"}},
+		"deleted":  {Deleted: &models.Deleted{EventID: "0195f0a2-7c3e-7b1a-9a4e-2f6d8c1b3a55"}},
+		"snapshot": {Snapshot: &models.Snapshot{Events: []models.Event{*goldenEvent()}, Devices: []string{"desktop", "laptop"}}},
+		"pin":      {Pin: &models.Pin{EventID: "0195f0a2-7c3e-7b1a-9a4e-2f6d8c1b3a55", Pinned: true}},
+	}
+}
+
+// readGolden reads a golden file and compacts it, so the files can be
+// indented for review.
+func readGolden(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return buf.Bytes()
+}
+
+// writeGolden stores data indented at path.
+func writeGolden(t *testing.T, path string, data []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteByte('\n')
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMessagesGolden checks that every message type encodes to its golden
+// file and that the golden file decodes back to the same message.
+func TestMessagesGolden(t *testing.T) {
+	for name, msg := range goldenMessages() {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("testdata", "v1", name+".json")
+			data, err := Marshal(msg)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if *update {
+				writeGolden(t, path, data)
+			}
+			golden := readGolden(t, path)
+			if !bytes.Equal(data, golden) {
+				t.Errorf("Marshal changed the wire format:\n got %s\nwant %s", data, golden)
+			}
+
+			decoded, err := Unmarshal(golden)
+			if err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			again, err := Marshal(decoded)
+			if err != nil {
+				t.Fatalf("Marshal after Unmarshal: %v", err)
+			}
+			if !bytes.Equal(again, golden) {
+				t.Errorf("round trip changed the message:\n got %s\nwant %s", again, golden)
+			}
+		})
+	}
+}
+
+// TestUnmarshalOlderPeers checks messages from agents and hubs that predate
+// wire versions and message types: a bare event with only the original
+// fields.
+func TestUnmarshalOlderPeers(t *testing.T) {
+	msg, err := Unmarshal(readGolden(t, filepath.Join("testdata", "v0", "event.json")))
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if msg.Event == nil {
+		t.Fatalf("Unmarshal = %+v, want an event", msg)
+	}
+	want := models.Event{EventID: "evt-1", SourceDeviceID: "old-laptop", Timestamp: goldenTime,
+		ContentType: models.ContentTypeText, Text: "hello", TextHash: "2cf2"}
+	if msg.Event.EventID != want.EventID || msg.Event.SourceDeviceID != want.SourceDeviceID ||
+		!msg.Event.Timestamp.Equal(want.Timestamp) || msg.Event.ContentType != want.ContentType ||
+		msg.Event.Text != want.Text || msg.Event.TextHash != want.TextHash {
+		t.Errorf("Unmarshal = %+v, want %+v", msg.Event, want)
+	}
+}
+
+// TestUnmarshalNewerPeers checks the two compatibility rules that let a
+// newer peer talk to this build: unknown fields are ignored and unknown
+// message types are reported as ErrUnknownType.
+func TestUnmarshalNewerPeers(t *testing.T) {
+	msg, err := Unmarshal(readGolden(t, filepath.Join("testdata", "newer", "event_extra_fields.json")))
+	if err != nil {
+		t.Fatalf("Unmarshal of an event with unknown fields: %v", err)
+	}
+	if msg.Event == nil || msg.Event.EventID != "evt-2" || msg.Event.Text != "from the future" {
+		t.Errorf("Unmarshal = %+v, want event evt-2", msg.Event)
+	}
+
+	msg, err = Unmarshal(readGolden(t, filepath.Join("testdata", "newer", "presence_extra_fields.json")))
+	if err != nil {
+		t.Fatalf("Unmarshal of a presence message with unknown fields: %v", err)
+	}
+	if msg.Presence == nil || msg.Presence.Peers != 4 {
+		t.Errorf("Unmarshal = %+v, want presence with 4 peers", msg.Presence)
+	}
+
+	_, err = Unmarshal(readGolden(t, filepath.Join("testdata", "newer", "unknown_type.json")))
+	if !errors.Is(err, ErrUnknownType) {
+		t.Errorf("Unmarshal of an unknown type = %v, want ErrUnknownType", err)
+	}
+}
+
+func TestMarshalEmpty(t *testing.T) {
+	if _, err := Marshal(&Message{}); err == nil {
+		t.Error("Marshal of an empty message succeeded, want an error")
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	for _, data := range []string{``, `not json`, `{"type": "presence", "peers": "two"}`} {
+		if _, err := Unmarshal([]byte(data)); err == nil || errors.Is(err, ErrUnknownType) {
+			t.Errorf("Unmarshal(%q) = %v, want a decode error", data, err)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	tests := []struct {
+		version int
+		want    bool
+	}{
+		{0, true}, // before versioning, the version 1 format
+		{MinVersion, true},
+		{Version, true},
+		{Version + 1, false},
+		{-1, false},
+	}
+	for _, tt := range tests {
+		if got := Compatible(tt.version); got != tt.want {
+			t.Errorf("Compatible(%d) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+// TestErrorResponseGolden checks the structured error body in both
+// directions.
+func TestErrorResponseGolden(t *testing.T) {
+	path := filepath.Join("testdata", "v1", "error_invalid_event.json")
+	data, err := json.Marshal(InvalidEvent(&models.ValidationError{Field: "text", Reason: "exceeds 1048576 bytes"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		writeGolden(t, path, data)
+	}
+	golden := readGolden(t, path)
+	if !bytes.Equal(data, golden) {
+		t.Errorf("error body changed:\n got %s\nwant %s", data, golden)
+	}
+
+	want := ErrorResponse{Error: "invalid event", Field: "text", Reason: "exceeds 1048576 bytes"}
+	if got := DecodeError(golden); got == nil || *got != want {
+		t.Errorf("DecodeError(golden) = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want *ErrorResponse
+	}{
+		{"plain text, as before structured errors", "unauthorized\n", nil},
+		{"empty", "", nil},
+		{"no error field", `{"field": "text"}`, nil},
+		{"message only", `{"error": "invalid event"}`, &ErrorResponse{Error: "invalid event"}},
+		{"newer hub", readGoldenString(t, filepath.Join("testdata", "newer", "error_extra_fields.json")),
+			&ErrorResponse{Error: "invalid event", Field: "channel", Reason: "unknown channel"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DecodeError([]byte(tt.body))
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("DecodeError(%q) = %+v, want nil", tt.body, got)
+			case tt.want != nil && (got == nil || *got != *tt.want):
+				t.Errorf("DecodeError(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func readGoldenString(t *testing.T, path string) string {
+	return string(readGolden(t, path))
+}